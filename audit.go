@@ -0,0 +1,75 @@
+package prolog
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/ichiban/prolog/engine"
+)
+
+// AuditRecord is an entry of the audit log. It tells which clauses contributed to a solution of a query.
+type AuditRecord struct {
+	Query    string        `json:"query"`
+	Solution int           `json:"solution"`
+	Clauses  []AuditClause `json:"clauses"`
+	Proof    []AuditProof  `json:"proof"`
+}
+
+// AuditClause is a clause in AuditRecord.
+type AuditClause struct {
+	Predicate string `json:"predicate"`
+	Clause    string `json:"clause"`
+	Metadata  string `json:"metadata,omitempty"`
+}
+
+// AuditProof is a node of the proof tree in AuditRecord. Children are the proofs of the goals in the clause body.
+type AuditProof struct {
+	AuditClause
+	Children []AuditProof `json:"children,omitempty"`
+}
+
+func writeAuditRecord(w io.Writer, vm *engine.VM, query string, n int, env *engine.Env) error {
+	r := AuditRecord{
+		Query:    query,
+		Solution: n,
+		Clauses:  []AuditClause{},
+	}
+	for _, p := range engine.Derivation(env) {
+		r.Clauses = append(r.Clauses, auditClause(vm, p))
+	}
+	r.Proof = auditProofs(vm, engine.ProofTree(env))
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(&r)
+}
+
+func auditClause(vm *engine.VM, p engine.Provenance) AuditClause {
+	c := AuditClause{
+		Predicate: writeq(vm, p.Indicator),
+		Clause:    writeq(vm, p.Clause),
+	}
+	if p.Metadata != nil {
+		c.Metadata = writeq(vm, p.Metadata)
+	}
+	return c
+}
+
+func auditProofs(vm *engine.VM, ps []*engine.Proof) []AuditProof {
+	ret := make([]AuditProof, len(ps))
+	for i, p := range ps {
+		ret[i] = AuditProof{
+			AuditClause: auditClause(vm, p.Provenance),
+			Children:    auditProofs(vm, p.Children),
+		}
+	}
+	return ret
+}
+
+func writeq(vm *engine.VM, t engine.Term) string {
+	var sb strings.Builder
+	s := engine.NewOutputTextStream(&sb)
+	_, _ = engine.WriteTerm(vm, s, t, engine.List(engine.NewAtom("quoted").Apply(engine.NewAtom("true"))), engine.Success, nil).Force(context.Background())
+	return sb.String()
+}
@@ -8,7 +8,7 @@
 :-(op(1200, fx, [:-, ?-])).
 :-(op(1105, xfy, '|')).
 :-(op(1100, xfy, ;)).
-:-(op(1050, xfy, ->)).
+:-(op(1050, xfy, [->, *->])).
 :-(op(1000, xfy, ',')).
 :-(op(900, fy, \+)).
 :-(op(700, xfx, [=, \=])).
@@ -39,6 +39,10 @@ P; Q :- call((P; Q)).
 
 If -> Then :- If, !, Then.
 
+If *-> Then :- If, Then.
+
+if(If, Then, Else) :- (If *-> Then; Else).
+
 % Term unification
 
 X \= Y :- \+(X = Y).
@@ -82,6 +86,14 @@ retractall(Head) :-
   fail.
 retractall(_).
 
+% Recorded database
+
+recorda(Key, Value) :- recorda(Key, Value, _).
+
+recordz(Key, Value) :- recordz(Key, Value, _).
+
+recorded(Key, Value) :- recorded(Key, Value, _).
+
 % Stream selection and control
 
 open(Filename, Mode, Stream) :-
@@ -97,10 +109,6 @@ at_end_of_stream :-
   current_input(S),
   at_end_of_stream(S).
 
-at_end_of_stream(Stream) :-
-  stream_property(Stream, end_of_stream(E)), !,
-  (E = at; E = past).
-
 % Character input/output
 
 get_char(Char) :-
@@ -200,6 +208,15 @@ once(P) :- P, !.
 
 false :- fail.
 
+call_cleanup(Goal, Cleanup) :- setup_call_cleanup(true, Goal, Cleanup).
+
+fallback(Primary, Fallback) :- fallback(Primary, Fallback, [_]).
+
+current_goal(Goal) :-
+  prolog_current_frame(F),
+  prolog_frame_attribute(F, parent, P),
+  prolog_frame_attribute(P, goal, Goal).
+
 % Atomic term processing
 
 % Implementation defined hooks
@@ -222,38 +239,3 @@ member(X, [_|Xs]) :- member(X, Xs).
 select(E, [E|Xs], Xs).
 select(E, [X|Xs], [X|Ys]) :-
   select(E, Xs, Ys).
-
-maplist(_Cont_1, []).
-maplist(Cont_1, [E1|E1s]) :-
-  call(Cont_1, E1),
-  maplist(Cont_1, E1s).
-
-maplist(_Cont_2, [], []).
-maplist(Cont_2, [E1|E1s], [E2|E2s]) :-
-  call(Cont_2, E1, E2),
-  maplist(Cont_2, E1s, E2s).
-
-maplist(_Cont_3, [], [], []).
-maplist(Cont_3, [E1|E1s], [E2|E2s], [E3|E3s]) :-
-  call(Cont_3, E1, E2, E3),
-  maplist(Cont_3, E1s, E2s, E3s).
-
-maplist(_Cont_4, [], [], [], []).
-maplist(Cont_4, [E1|E1s], [E2|E2s], [E3|E3s], [E4|E4s]) :-
-  call(Cont_4, E1, E2, E3, E4),
-  maplist(Cont_4, E1s, E2s, E3s, E4s).
-
-maplist(_Cont_5, [], [], [], [], []).
-maplist(Cont_5, [E1|E1s], [E2|E2s], [E3|E3s], [E4|E4s], [E5|E5s]) :-
-  call(Cont_5, E1, E2, E3, E4, E5),
-  maplist(Cont_5, E1s, E2s, E3s, E4s, E5s).
-
-maplist(_Cont_6, [], [], [], [], [], []).
-maplist(Cont_6, [E1|E1s], [E2|E2s], [E3|E3s], [E4|E4s], [E5|E5s], [E6|E6s]) :-
-  call(Cont_6, E1, E2, E3, E4, E5, E6),
-  maplist(Cont_6, E1s, E2s, E3s, E4s, E5s, E6s).
-
-maplist(_Cont_7, [], [], [], [], [], [], []).
-maplist(Cont_7, [E1|E1s], [E2|E2s], [E3|E3s], [E4|E4s], [E5|E5s], [E6|E6s], [E7|E7s]) :-
-  call(Cont_7, E1, E2, E3, E4, E5, E6, E7),
-  maplist(Cont_7, E1s, E2s, E3s, E4s, E5s, E6s, E7s).
@@ -0,0 +1,144 @@
+// Package cache provides a cache of the results of ground queries for read-heavy rule services.
+//
+// A result is cached only if the query would be pure if the dynamic procedures were static, i.e. it doesn't depend on
+// I/O nor foreign predicates not declared pure. The result is dropped when any of the procedures the query
+// transitively calls is modified e.g. by assertz/1 or retract/1, redefined, or removed. See engine.VM.Dependencies.
+package cache
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/ichiban/prolog"
+	"github.com/ichiban/prolog/engine"
+)
+
+// Cache is a layer on an Interpreter which caches the results of ground queries.
+// It's safe for concurrent use as long as the Interpreter is.
+type Cache struct {
+	i *prolog.Interpreter
+
+	mu      sync.Mutex
+	entries engine.VariantTable // of entry keyed by the queries.
+	stats   Stats
+}
+
+type entry struct {
+	deps *engine.Dependencies
+	ok   bool
+}
+
+// Stats is the statistics of a Cache.
+type Stats struct {
+	Hits   int // Queries answered from the cache.
+	Misses int // Queries run on the interpreter including the ones which can't be cached.
+}
+
+// New returns a Cache on i.
+func New(i *prolog.Interpreter) *Cache {
+	return &Cache{i: i}
+}
+
+// Holds tells if the query has a solution. Unless the query is ground and its result may be cached, it simply runs the
+// query on the interpreter. Exceptions are returned as errors and never cached.
+func (c *Cache) Holds(ctx context.Context, query string, args ...interface{}) (bool, error) {
+	vm := &c.i.VM
+	p := engine.NewParser(vm, strings.NewReader(query))
+	if err := p.SetPlaceholder(engine.NewAtom("?"), args...); err != nil {
+		return false, err
+	}
+	goal, err := p.Term()
+	if err != nil {
+		return false, err
+	}
+
+	if !ground(goal) {
+		c.count(false)
+		return engine.Call(vm, goal, engine.Success, nil).Force(ctx)
+	}
+
+	c.mu.Lock()
+	v, ok := c.entries.Get(goal, nil)
+	if ok && v.(entry).deps.Changed() {
+		c.entries.Delete(goal, nil)
+		ok = false
+	}
+	c.mu.Unlock()
+	if ok {
+		c.count(true)
+		return v.(entry).ok, nil
+	}
+
+	c.count(false)
+	// The snapshot is taken before the execution so that the changes made during the execution invalidate the result.
+	deps, cacheable := vm.Dependencies(goal, nil)
+	ok, err = engine.Call(vm, goal, engine.Success, nil).Force(ctx)
+	if err != nil || !cacheable {
+		return ok, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries.Put(goal, entry{deps: deps, ok: ok}, nil)
+	return ok, nil
+}
+
+// Len returns the number of the cached results including the stale ones which haven't been looked up since the change.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries.Len()
+}
+
+// Purge drops the stale results.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries.Range(func(goal engine.Term, v interface{}) bool {
+		if v.(entry).deps.Changed() {
+			c.entries.Delete(goal, nil)
+		}
+		return true
+	})
+}
+
+// TableStats returns the statistics of the storage of the cached results.
+func (c *Cache) TableStats() engine.VariantTableStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries.Stats()
+}
+
+// Stats returns the statistics of the Cache so far.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+func (c *Cache) count(hit bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if hit {
+		c.stats.Hits++
+	} else {
+		c.stats.Misses++
+	}
+}
+
+func ground(t engine.Term) bool {
+	ts := []engine.Term{t}
+	for len(ts) > 0 {
+		t, ts = ts[len(ts)-1], ts[:len(ts)-1]
+		switch t := t.(type) {
+		case engine.Variable:
+			return false
+		case engine.Compound:
+			for i := 0; i < t.Arity(); i++ {
+				ts = append(ts, t.Arg(i))
+			}
+		}
+	}
+	return true
+}
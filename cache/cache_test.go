@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ichiban/prolog"
+)
+
+const program = `
+:- dynamic(role/2).
+role(alice, admin).
+role(bob, user).
+
+can(User, delete) :- role(User, admin).
+can(User, read) :- role(User, _).
+
+unrelated(a).
+`
+
+func TestCache_Holds(t *testing.T) {
+	i := prolog.New(nil, nil)
+	assert.NoError(t, i.Exec(program))
+	c := New(i)
+	ctx := context.Background()
+
+	ok, err := c.Holds(ctx, `can(alice, delete).`)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = c.Holds(ctx, `can( alice , delete ). % The same goal.`)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, Stats{Hits: 1, Misses: 1}, c.Stats())
+
+	// Failures are cached as well.
+	ok, err = c.Holds(ctx, `can(bob, delete).`)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = c.Holds(ctx, `can(bob, delete).`)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, Stats{Hits: 2, Misses: 2}, c.Stats())
+	assert.Equal(t, 2, c.Len())
+
+	t.Run("invalidation", func(t *testing.T) {
+		assert.NoError(t, i.QuerySolution(`retract(role(bob, user)), assertz(role(bob, admin)).`).Err())
+
+		ok, err := c.Holds(ctx, `can(bob, delete).`)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, Stats{Hits: 2, Misses: 3}, c.Stats())
+
+		// A change to a procedure it doesn't depend on keeps the result.
+		assert.NoError(t, i.Exec(`unrelated(b).`))
+		ok, err = c.Holds(ctx, `can(bob, delete).`)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, Stats{Hits: 3, Misses: 3}, c.Stats())
+
+		// So does the result of alice although role/2 changed since it was cached. It's stale.
+		assert.Equal(t, 2, c.Len())
+		c.Purge()
+		assert.Equal(t, 1, c.Len())
+		assert.Equal(t, 1, c.TableStats().Entries)
+		assert.Equal(t, 1, c.TableStats().Tombstones)
+	})
+
+	t.Run("not cached", func(t *testing.T) {
+		c := New(i)
+
+		// Not ground.
+		ok, err := c.Holds(ctx, `can(X, delete).`)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		// Impure.
+		ok, err = c.Holds(ctx, `can(alice, delete), assertz(role(carol, user)).`)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		// Exception.
+		_, err = c.Holds(ctx, `can(alice, delete), atom_length(1, _).`)
+		assert.Error(t, err)
+
+		assert.Equal(t, 0, c.Len())
+		assert.Equal(t, Stats{Misses: 3}, c.Stats())
+	})
+
+	t.Run("syntax error", func(t *testing.T) {
+		_, err := New(i).Holds(ctx, `can(`)
+		assert.Error(t, err)
+	})
+}
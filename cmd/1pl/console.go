@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"unicode/utf8"
+)
+
+const keyCtrlC = 3
+
+// console reads the standard input on a single goroutine so that the terminal and the keys after each answer share
+// one stream of bytes. Since the raw mode turns off ISIG, Ctrl-C doesn't raise SIGINT. Instead, a Ctrl-C typed while
+// no one is waiting for input, i.e. while a query is running, calls the function given by onInterrupt.
+type console struct {
+	mu        sync.Mutex
+	interrupt func()
+	cond      *sync.Cond
+	buf       []byte
+	err       error
+	waiting   int // The number of readers waiting for input.
+}
+
+func newConsole(r io.Reader) *console {
+	var c console
+	c.cond = sync.NewCond(&c.mu)
+	go c.read(r)
+	return &c
+}
+
+func (c *console) onInterrupt(f func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interrupt = f
+}
+
+func (c *console) read(r io.Reader) {
+	b := make([]byte, 256)
+	for {
+		n, err := r.Read(b)
+
+		var interrupt func()
+		c.mu.Lock()
+		for _, e := range b[:n] {
+			if e == keyCtrlC && c.waiting == 0 {
+				interrupt = c.interrupt
+				continue
+			}
+			c.buf = append(c.buf, e)
+		}
+		c.err = err
+		c.mu.Unlock()
+		c.cond.Broadcast()
+
+		if interrupt != nil {
+			interrupt()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// wait blocks until there's some input. The caller must hold the lock.
+func (c *console) wait() error {
+	c.waiting++
+	defer func() {
+		c.waiting--
+	}()
+	for len(c.buf) == 0 {
+		if c.err != nil {
+			return c.err
+		}
+		c.cond.Wait()
+	}
+	return nil
+}
+
+// Read reads up to the end of the line at most so that the terminal doesn't hold the bytes for the keys.
+func (c *console) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.wait(); err != nil {
+		return 0, err
+	}
+	b := c.buf
+	if i := bytes.IndexAny(b, "\r\n"); i >= 0 {
+		b = b[:i+1]
+	}
+	n := copy(p, b)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// ReadRune reads a key.
+func (c *console) ReadRune() (rune, int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.wait(); err != nil {
+		return 0, 0, err
+	}
+	r, n := utf8.DecodeRune(c.buf)
+	c.buf = c.buf[n:]
+	return r, n, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsole(t *testing.T) {
+	t.Run("lines and keys", func(t *testing.T) {
+		c := newConsole(&chunkReader{chunks: []string{"foo.\r;", "bar.\r"}})
+
+		b := make([]byte, 256)
+		n, err := c.Read(b)
+		assert.NoError(t, err)
+		assert.Equal(t, "foo.\r", string(b[:n]))
+
+		r, _, err := c.ReadRune()
+		assert.NoError(t, err)
+		assert.Equal(t, ';', r)
+
+		n, err = c.Read(b)
+		assert.NoError(t, err)
+		assert.Equal(t, "bar.\r", string(b[:n]))
+
+		_, err = c.Read(b)
+		assert.Equal(t, io.EOF, err)
+	})
+
+	t.Run("interrupt while running", func(t *testing.T) {
+		in, out := io.Pipe()
+		c := newConsole(in)
+		interrupted := make(chan struct{}, 1)
+		c.onInterrupt(func() {
+			interrupted <- struct{}{}
+		})
+
+		_, err := out.Write([]byte{'a', keyCtrlC, 'b'})
+		assert.NoError(t, err)
+		select {
+		case <-interrupted:
+		case <-time.After(time.Second):
+			t.Fatal("not interrupted")
+		}
+
+		// Ctrl-C is consumed while the rest is kept for the next read.
+		b := make([]byte, 256)
+		n, err := c.Read(b)
+		assert.NoError(t, err)
+		assert.Equal(t, "ab", string(b[:n]))
+	})
+
+	t.Run("key while waiting", func(t *testing.T) {
+		in, out := io.Pipe()
+		c := newConsole(in)
+		c.onInterrupt(func() {
+			t.Error("interrupted")
+		})
+
+		go func() {
+			// Let ReadRune wait first.
+			for {
+				c.mu.Lock()
+				waiting := c.waiting
+				c.mu.Unlock()
+				if waiting > 0 {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			_, _ = out.Write([]byte{keyCtrlC})
+		}()
+
+		r, _, err := c.ReadRune()
+		assert.NoError(t, err)
+		assert.Equal(t, rune(keyCtrlC), r)
+	})
+}
+
+type chunkReader struct {
+	chunks []string
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.chunks[0])
+	r.chunks = r.chunks[1:]
+	return n, nil
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"github.com/ichiban/prolog"
 	"github.com/ichiban/prolog/engine"
 	"io"
+	"io/fs"
+	"os"
+	"strings"
 )
 
 // New creates a prolog.Interpreter with some helper predicates.
@@ -14,5 +18,93 @@ func New(r io.Reader, w io.Writer) *prolog.Interpreter {
 	i.Register2(engine.NewAtom("go_string"), func(vm *engine.VM, term, s engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
 		return engine.Unify(vm, s, engine.NewAtom(fmt.Sprintf("%#v", term)), k, env)
 	})
+	i.Register1(engine.NewAtom("save_session"), SaveSession)
+	i.Register1(engine.NewAtom("restore_session"), RestoreSession)
 	return i
 }
+
+// SaveSession writes the dynamic predicates, the flags, and the operators to file so that restore_session/1 can
+// bring them back in another run. See engine.VM.SaveSession.
+func SaveSession(vm *engine.VM, file engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+	name, err := fileName(file, env)
+	if err != nil {
+		return engine.Error(err)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return engine.Error(fileError(err, engine.NewAtom("open"), file, env))
+	}
+	if err := vm.SaveSession(f); err != nil {
+		_ = f.Close()
+		return engine.Error(err)
+	}
+	if err := f.Close(); err != nil {
+		return engine.Error(err)
+	}
+	return k(env)
+}
+
+// RestoreSession restores the dynamic predicates, the flags, and the operators saved by save_session/1 from file.
+func RestoreSession(vm *engine.VM, file engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+	name, err := fileName(file, env)
+	if err != nil {
+		return engine.Error(err)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return engine.Error(fileError(err, engine.NewAtom("open"), file, env))
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	if err := vm.LoadImage(f); err != nil {
+		return engine.Error(err)
+	}
+	return k(env)
+}
+
+// fileName returns the file name which is either an atom, a list of characters, or a list of character codes.
+func fileName(file engine.Term, env *engine.Env) (string, error) {
+	switch f := env.Resolve(file).(type) {
+	case engine.Variable:
+		return "", engine.InstantiationError(env)
+	case engine.Atom:
+		return f.String(), nil
+	}
+
+	var sb strings.Builder
+	iter := engine.ListIterator{List: file, Env: env}
+	for iter.Next() {
+		switch e := env.Resolve(iter.Current()).(type) {
+		case engine.Variable:
+			return "", engine.InstantiationError(env)
+		case engine.Atom:
+			if r := []rune(e.String()); len(r) == 1 {
+				_, _ = sb.WriteRune(r[0])
+				continue
+			}
+		case engine.Integer:
+			_, _ = sb.WriteRune(rune(e))
+			continue
+		}
+		return "", engine.TypeError(engine.ValidTypeAtom, file, env)
+	}
+	if err := iter.Err(); err != nil {
+		return "", engine.TypeError(engine.ValidTypeAtom, file, env)
+	}
+	return sb.String(), nil
+}
+
+// fileError converts err into an ISO error if possible.
+func fileError(err error, operation, file engine.Term, env *engine.Env) error {
+	var formal engine.Term
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		formal = engine.NewAtom("existence_error").Apply(engine.NewAtom("source_sink"), file)
+	case errors.Is(err, fs.ErrPermission):
+		formal = engine.NewAtom("permission_error").Apply(operation, engine.NewAtom("source_sink"), file)
+	default:
+		return err
+	}
+	return engine.NewException(engine.NewAtom("error").Apply(formal, engine.NewVariable()), env)
+}
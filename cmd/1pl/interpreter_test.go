@@ -1,9 +1,12 @@
 package main
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/ichiban/prolog"
 )
 
 func TestNew(t *testing.T) {
@@ -11,4 +14,23 @@ func TestNew(t *testing.T) {
 		p := New(nil, nil)
 		assert.NoError(t, p.QuerySolution(`go_string("foo", '"foo"').`).Err())
 	})
+
+	t.Run("save_session/restore_session", func(t *testing.T) {
+		session := filepath.Join(t.TempDir(), "session")
+
+		p := New(nil, nil)
+		assert.NoError(t, p.Exec(`rule(X) :- fact(X).`))
+		assert.NoError(t, p.QuerySolution(`assertz(fact(a)), op(700, xfx, ===>), set_prolog_flag(unknown, fail).`).Err())
+		assert.NoError(t, p.QuerySolution(`save_session(?).`, session).Err())
+
+		q := New(nil, nil)
+		assert.NoError(t, q.Exec(`rule(X) :- fact(X).`))
+		assert.NoError(t, q.QuerySolution(`restore_session(?).`, session).Err())
+		assert.NoError(t, q.QuerySolution(`rule(a), current_op(700, xfx, ===>), current_prolog_flag(unknown, fail).`).Err())
+		assert.Equal(t, prolog.ErrNoSolutions, q.QuerySolution(`undefined.`).Err())
+
+		err := q.QuerySolution(`catch(restore_session(?), error(existence_error(source_sink, _), _), fail).`, filepath.Join(t.TempDir(), "none")).Err()
+		assert.Equal(t, prolog.ErrNoSolutions, err)
+		assert.Error(t, q.QuerySolution(`restore_session(_).`).Err())
+	})
 }
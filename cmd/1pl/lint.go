@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ichiban/prolog/engine"
+	"github.com/ichiban/prolog/lint"
+)
+
+var severities = map[string]engine.Severity{
+	"informational": engine.SeverityInformational,
+	"warning":       engine.SeverityWarning,
+	"error":         engine.SeverityError,
+}
+
+// runLint runs `1pl lint [-json] [-severity S] file...` and returns the exit status. It's 1 if there're findings of
+// the severity S or higher, and 2 if the files can't be checked.
+func runLint(ctx context.Context, stdout, stderr io.Writer, args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	asJSON := flags.Bool("json", false, `write the findings as a JSON array`)
+	severity := flags.String("severity", "warning", `report the findings of the severity or higher: informational, warning, or error`)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	min, ok := severities[*severity]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown severity: %s\n", *severity)
+		return 2
+	}
+
+	texts := make([]string, flags.NArg())
+	for n, f := range flags.Args() {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		texts[n] = string(b)
+	}
+
+	// Consult the files beforehand so that the predicates defined in the other files aren't reported undefined.
+	i := New(nil, nil)
+	for _, t := range texts {
+		_ = i.Compile(ctx, t)
+	}
+
+	findings := []lint.Finding{}
+	for n, file := range flags.Args() {
+		fs, err := lint.Text(ctx, i, file, texts[n])
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		for _, f := range fs {
+			if f.Severity >= min {
+				findings = append(findings, f)
+			}
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(findings); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+	} else {
+		for _, f := range findings {
+			fmt.Fprintln(stdout, f)
+		}
+	}
+
+	if len(findings) > 0 {
+		return 1
+	}
+	return 0
+}
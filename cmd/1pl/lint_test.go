@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunLint(t *testing.T) {
+	dir := t.TempDir()
+	a, b, clean := filepath.Join(dir, "a.pl"), filepath.Join(dir, "b.pl"), filepath.Join(dir, "clean.pl")
+	assert.NoError(t, os.WriteFile(a, []byte("foo(X).\nbar :- baz, qux.\n"), 0644))
+	assert.NoError(t, os.WriteFile(b, []byte("baz.\n"), 0644))
+	assert.NoError(t, os.WriteFile(clean, []byte("baz.\n"), 0644))
+
+	tests := []struct {
+		title          string
+		args           []string
+		status         int
+		stdout, stderr string
+	}{
+		{
+			title:  "text",
+			args:   []string{a, b},
+			status: 1,
+			stdout: a + ":1:1: warning: Singleton variables: [X] (singleton)\n" +
+				a + ":2:1: warning: Unknown procedure: qux/0 (undefined)\n",
+		},
+		{
+			title:  "severity",
+			args:   []string{"-severity", "error", a},
+			status: 0,
+		},
+		{
+			title:  "json",
+			args:   []string{"-json", "-severity", "informational", a},
+			status: 1,
+			stdout: `[
+	{
+		"file": "` + a + `",
+		"line": 1,
+		"column": 1,
+		"severity": "warning",
+		"check": "singleton",
+		"message": "Singleton variables: [X]"
+	},
+	{
+		"file": "` + a + `",
+		"line": 2,
+		"column": 1,
+		"severity": "warning",
+		"check": "undefined",
+		"message": "Unknown procedure: baz/0"
+	},
+	{
+		"file": "` + a + `",
+		"line": 2,
+		"column": 1,
+		"severity": "warning",
+		"check": "undefined",
+		"message": "Unknown procedure: qux/0"
+	},
+	{
+		"file": "` + a + `",
+		"line": 2,
+		"column": 1,
+		"severity": "informational",
+		"check": "purity",
+		"message": "bar/0 is not pure"
+	}
+]
+`,
+		},
+		{
+			title:  "clean",
+			args:   []string{"-json", clean},
+			status: 0,
+			stdout: "[]\n",
+		},
+		{
+			title:  "unknown severity",
+			args:   []string{"-severity", "fatal", a},
+			status: 2,
+			stderr: "unknown severity: fatal\n",
+		},
+		{
+			title:  "no such file",
+			args:   []string{filepath.Join(dir, "missing.pl")},
+			status: 2,
+			stderr: "open " + filepath.Join(dir, "missing.pl") + ": no such file or directory\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			assert.Equal(t, tt.status, runLint(context.Background(), &stdout, &stderr, tt.args))
+			assert.Equal(t, tt.stdout, stdout.String())
+			assert.Equal(t, tt.stderr, stderr.String())
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"flag"
@@ -11,20 +10,15 @@ import (
 	"os"
 	"os/signal"
 	"runtime/debug"
-	"sort"
 	"strings"
 
 	"golang.org/x/crypto/ssh/terminal"
 
-	"github.com/ichiban/prolog"
 	"github.com/ichiban/prolog/engine"
+	"github.com/ichiban/prolog/toplevel"
 )
 
-const (
-	prompt          = "?- "
-	contPrompt      = "|- "
-	userInputPrompt = "|: "
-)
+const userInputPrompt = "|: "
 
 var version = func() string {
 	info, ok := debug.ReadBuildInfo()
@@ -36,10 +30,31 @@ var version = func() string {
 }()
 
 func main() {
-	var verbose bool
+	var (
+		verbose     bool
+		saveImage   string
+		chromeTrace string
+	)
 	flag.BoolVar(&verbose, "v", false, `verbose`)
+	flag.StringVar(&saveImage, "save-image", "", `save an image of the consulted files to the path and exit`)
+	flag.StringVar(&chromeTrace, "chrome-trace", "", `write the successful calls to the path in Chrome trace event format`)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [file...]\n       %s lint [-json] [-severity S] file...\n", os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
+	if flag.Arg(0) == "lint" {
+		os.Exit(runLint(context.Background(), os.Stdout, os.Stderr, flag.Args()[1:]))
+	}
+
+	if saveImage != "" {
+		if err := save(saveImage, flag.Args()); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	fmt.Printf(`Top level for ichiban/prolog %s
 This is for testing purposes only!
 See https://github.com/ichiban/prolog for more details.
@@ -63,13 +78,31 @@ Type Ctrl-C or 'halt.' to exit.
 		}
 	}
 
-	t := terminal.NewTerminal(os.Stdin, prompt)
+	in := newConsole(os.Stdin)
+	t := terminal.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{Reader: in, Writer: os.Stdin}, toplevel.Prompt)
 	defer fmt.Printf("\r\n")
 
 	log.SetOutput(t)
 
 	i := New(&userInput{t: t}, t)
 	i.Register1(engine.NewAtom("halt"), halt)
+	if chromeTrace != "" {
+		f, err := os.Create(chromeTrace)
+		if err != nil {
+			log.Panic(err)
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		ct := engine.NewChromeTrace(f)
+		defer func() {
+			_ = ct.Close()
+		}()
+		i.OnTrace = ct.Record
+	}
 	i.Unknown = func(name engine.Atom, args []engine.Term, env *engine.Env) {
 		var sb strings.Builder
 		s := engine.NewOutputTextStream(&sb)
@@ -82,99 +115,43 @@ Type Ctrl-C or 'halt.' to exit.
 		log.Panic(err)
 	}
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
-	defer stop()
-
-	var buf strings.Builder
-	keys := bufio.NewReader(os.Stdin)
-	for {
-		switch err := handleLine(ctx, &buf, i, t, keys); err {
-		case nil:
-			break
-		case io.EOF:
-			return
-		default:
-			log.Panic(err)
-		}
+	tl := toplevel.New(i, t)
+	tl.Keys = in
+
+	// Ctrl-C aborts the current query, not the process.
+	in.onInterrupt(tl.Interrupt)
+	if !terminal.IsTerminal(0) { // Otherwise, the raw mode turns Ctrl-C into a key instead of SIGINT.
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		defer signal.Stop(interrupt)
+		go func() {
+			for range interrupt {
+				tl.Interrupt()
+			}
+		}()
 	}
-}
 
-func handleLine(ctx context.Context, buf *strings.Builder, p *prolog.Interpreter, t *terminal.Terminal, keys *bufio.Reader) (err error) {
-	line, err := t.ReadLine()
-	if err != nil {
-		return err
-	}
-	_, _ = buf.WriteString(line)
-	_, _ = buf.WriteString("\n")
-
-	sols, err := p.QueryContext(ctx, buf.String())
-	switch err {
-	case nil:
-		buf.Reset()
-		t.SetPrompt(prompt)
-	case io.EOF:
-		// Returns without resetting buf.
-		t.SetPrompt(contPrompt)
-		return nil
-	default:
-		log.Printf("failed to query: %v", err)
-		buf.Reset()
-		t.SetPrompt(prompt)
-		return nil
+	if err := tl.Run(context.Background()); err != nil {
+		log.Panic(err)
 	}
-	defer func() {
-		_ = sols.Close()
-	}()
-
-	var exists bool
-	for sols.Next() {
-		exists = true
-
-		m := map[string]prolog.TermString{}
-		_ = sols.Scan(m)
-
-		var buf bytes.Buffer
-		if len(m) == 0 {
-			_, _ = fmt.Fprintf(&buf, "%t", true)
-		} else {
-			ls := make([]string, 0, len(m))
-			for v, t := range m {
-				ls = append(ls, fmt.Sprintf("%s = %s", v, t))
-			}
-			sort.Strings(ls)
-			_, _ = fmt.Fprint(&buf, strings.Join(ls, ",\n"))
-		}
-		if _, err := t.Write(buf.Bytes()); err != nil {
-			return err
-		}
+}
 
-		r, _, err := keys.ReadRune()
-		if err != nil {
-			return err
-		}
-		if r != ';' {
-			r = '.'
-		}
-		if _, err := fmt.Fprintf(t, "%s\n", string(r)); err != nil {
-			return err
-		}
-		if r == '.' {
-			break
-		}
+// save consults the files and saves the image to the path. See prolog.NewWithImage.
+func save(path string, files []string) error {
+	i := New(nil, nil)
+	if err := i.QuerySolution(`findall(F, (member(X, ?), atom_chars(F, X)), Fs), consult(Fs).`, files).Err(); err != nil {
+		return err
 	}
 
-	if err := sols.Err(); err != nil {
-		log.Print(err)
-		return nil
+	f, err := os.Create(path)
+	if err != nil {
+		return err
 	}
-
-	if !exists {
-		if _, err := fmt.Fprintf(t, "%t.\n", false); err != nil {
-			return err
-		}
+	if err := i.SaveImage(f); err != nil {
+		_ = f.Close()
+		return err
 	}
-
-	return nil
+	return f.Close()
 }
 
 type userInput struct {
@@ -185,7 +162,7 @@ type userInput struct {
 func (u *userInput) Read(p []byte) (n int, err error) {
 	if u.buf.Len() == 0 {
 		u.t.SetPrompt(userInputPrompt)
-		defer u.t.SetPrompt(prompt)
+		defer u.t.SetPrompt(toplevel.Prompt)
 		line, err := u.t.ReadLine()
 		if err != nil {
 			return 0, err
@@ -0,0 +1,445 @@
+package engine
+
+import (
+	"container/heap"
+	"context"
+	"io"
+)
+
+// AggregateAll aggregates all the solutions of goal as specified by spec and unifies the result with result.
+// spec is one of count, sum(Expr), max(Expr), min(Expr), bag(Template), set(Template), or topk(K, Key).
+// topk(K, Key) results in the K greatest instances of Key in the standard order of terms from the greatest.
+// Unlike bagof/3 and setof/3, it doesn't backtrack over the free variables of goal.
+func AggregateAll(vm *VM, spec, goal, result Term, k Cont, env *Env) *Promise {
+	a, err := newAggregation(vm, spec, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	return Delay(func(ctx context.Context) *Promise {
+		acc := a.init
+		if _, err := Call(vm, goal, func(env *Env) *Promise {
+			var err error
+			acc, err = a.step(acc, env)
+			if err != nil {
+				return Error(err)
+			}
+			return Bool(false) // ask for more solutions
+		}, env).Force(ctx); err != nil {
+			return Error(err)
+		}
+		r, ok := a.finish(acc)
+		if !ok {
+			return Bool(false)
+		}
+		return Unify(vm, result, r, k, env)
+	})
+}
+
+// FoldAll calls folder with the accumulator and a new one, i.e. call(Folder, V0, V1), for each solution of goal in
+// turn starting from v0, and unifies v with the last accumulator. folder usually shares variables with goal to see the
+// solution e.g. foldall(plus(X), member(X, L), 0, Sum). It fails if folder fails for a solution.
+// Unlike foldl/4 over the list made by findall/3, it keeps only the accumulator.
+func FoldAll(vm *VM, folder, goal, v0, v Term, k Cont, env *Env) *Promise {
+	return Delay(func(ctx context.Context) *Promise {
+		acc, err := renamedCopy(v0, nil, env)
+		if err != nil {
+			return Error(err)
+		}
+		failed := false
+		if _, err := Call(vm, goal, func(env *Env) *Promise {
+			next := NewVariable()
+			ok, err := Call2(vm, folder, acc, next, func(env *Env) *Promise {
+				var err error
+				acc, err = renamedCopy(next, nil, env)
+				if err != nil {
+					return Error(err)
+				}
+				return Bool(true)
+			}, env).Force(ctx)
+			if err != nil {
+				return Error(err)
+			}
+			if !ok {
+				failed = true
+				return Bool(true) // stop
+			}
+			return Bool(false) // ask for more solutions
+		}, env).Force(ctx); err != nil {
+			return Error(err)
+		}
+		if failed {
+			return Bool(false)
+		}
+		return Unify(vm, v, acc, k, env)
+	})
+}
+
+// ForAllCount succeeds iff action succeeds for every solution of cond, i.e. \+ (Cond, \+ Action), and unifies count
+// with the number of the solutions. It stops at the first solution for which action fails.
+func ForAllCount(vm *VM, cond, action, count Term, k Cont, env *Env) *Promise {
+	switch c := env.Resolve(count).(type) {
+	case Variable, Integer:
+		break
+	default:
+		return Error(typeError(validTypeInteger, c, env))
+	}
+
+	return Delay(func(ctx context.Context) *Promise {
+		var (
+			n      Integer
+			failed bool
+		)
+		if _, err := Call(vm, cond, func(env *Env) *Promise {
+			ok, err := Call(vm, action, Success, env).Force(ctx)
+			if err != nil {
+				return Error(err)
+			}
+			if !ok {
+				failed = true
+				return Bool(true) // stop
+			}
+			n++
+			return Bool(false) // ask for more solutions
+		}, env).Force(ctx); err != nil {
+			return Error(err)
+		}
+		if failed {
+			return Bool(false)
+		}
+		return Unify(vm, count, n, k, env)
+	})
+}
+
+// AggregateWindow aggregates every size consecutive solutions of goal as specified by spec and unifies result with the
+// aggregate of each window in turn on backtracking. The last window may have fewer solutions. If size is 0, all the
+// solutions are in one window. spec is the same as aggregate_all/3.
+// Since it keeps only the current window and yields its aggregate before asking goal for more solutions, it works for
+// goals with too many or even infinitely many solutions.
+func AggregateWindow(vm *VM, spec, size, goal, result Term, k Cont, env *Env) *Promise {
+	if _, err := newAggregation(vm, spec, env); err != nil {
+		return Error(err)
+	}
+	var window Integer
+	switch s := env.Resolve(size).(type) {
+	case Variable:
+		return Error(InstantiationError(env))
+	case Integer:
+		if s < 0 {
+			return Error(domainError(validDomainNotLessThanZero, s, env))
+		}
+		window = s
+	default:
+		return Error(typeError(validTypeInteger, s, env))
+	}
+
+	var (
+		a   *aggregation
+		acc Term
+		n   Integer
+	)
+	reset := func() {
+		a, _ = newAggregation(vm, spec, env)
+		acc, n = a.init, 0
+	}
+	yield := func() *Promise {
+		r, ok := a.finish(acc)
+		reset()
+		if !ok {
+			return Bool(false)
+		}
+		return Unify(vm, result, r, k, env)
+	}
+	reset()
+	return Delay(func(context.Context) *Promise {
+		return Call(vm, goal, func(genv *Env) *Promise {
+			var err error
+			acc, err = a.step(acc, genv)
+			if err != nil {
+				return Error(err)
+			}
+			n++
+			if n != window {
+				return Bool(false) // ask for more solutions
+			}
+			return yield()
+		}, env)
+	}, func(context.Context) *Promise {
+		if n == 0 {
+			return Bool(false)
+		}
+		return yield()
+	})
+}
+
+// aggregation is the accumulation of solutions specified by an aggregation spec.
+type aggregation struct {
+	init   Term
+	step   func(acc Term, env *Env) (Term, error)
+	finish func(acc Term) (Term, bool)
+	bulk   bool // Whether it keeps every solution e.g. bag(Template).
+}
+
+func newAggregation(vm *VM, spec Term, env *Env) (*aggregation, error) {
+	var (
+		init   Term
+		step   func(acc Term, env *Env) (Term, error)
+		finish = func(acc Term) (Term, bool) { return acc, true }
+		bulk   bool
+	)
+	switch s := env.Resolve(spec).(type) {
+	case Variable:
+		return nil, InstantiationError(env)
+	case Atom:
+		if s != atomCount {
+			return nil, domainError(validDomainAggregateSpec, spec, env)
+		}
+		init = Integer(0)
+		step = func(acc Term, _ *Env) (Term, error) {
+			return acc.(Integer) + 1, nil
+		}
+	case Compound:
+		if s.Functor() == atomTopK && s.Arity() == 2 {
+			return newTopK(s.Arg(0), s.Arg(1), env)
+		}
+		if s.Arity() != 1 {
+			return nil, domainError(validDomainAggregateSpec, spec, env)
+		}
+		arg := s.Arg(0)
+		switch s.Functor() {
+		case atomSum:
+			init = Integer(0)
+			step = func(acc Term, env *Env) (Term, error) {
+				return vm.eval(atomPlus.Apply(acc, arg), env)
+			}
+		case atomMax, atomMin:
+			f := s.Functor()
+			step = func(acc Term, env *Env) (Term, error) {
+				if acc == nil {
+					return vm.eval(arg, env)
+				}
+				return vm.eval(f.Apply(acc, arg), env)
+			}
+			finish = func(acc Term) (Term, bool) {
+				return acc, acc != nil // max and min of no solutions fail.
+			}
+		case atomBag, atomSet:
+			var (
+				c  = termCopier{arena: true}
+				ts []Term
+			)
+			step = func(_ Term, env *Env) (Term, error) {
+				c.reset()
+				t, err := c.copy(arg, env)
+				if err != nil {
+					return nil, err
+				}
+				ts = append(ts, t)
+				return nil, nil
+			}
+			set := s.Functor() == atomSet
+			finish = func(Term) (Term, bool) {
+				if set {
+					ts = sortUnique(ts)
+				}
+				return List(ts...), true
+			}
+			bulk = true
+		default:
+			return nil, domainError(validDomainAggregateSpec, spec, env)
+		}
+	default:
+		return nil, typeError(validTypeCallable, spec, env)
+	}
+	return &aggregation{init: init, step: step, finish: finish, bulk: bulk}, nil
+}
+
+// newTopK returns an aggregation which keeps the k greatest instances of key in a heap.
+func newTopK(k, key Term, env *Env) (*aggregation, error) {
+	var n Integer
+	switch k := env.Resolve(k).(type) {
+	case Variable:
+		return nil, InstantiationError(env)
+	case Integer:
+		if k < 0 {
+			return nil, domainError(validDomainNotLessThanZero, k, env)
+		}
+		n = k
+	default:
+		return nil, typeError(validTypeInteger, k, env)
+	}
+
+	h := termHeap{env: env}
+	return &aggregation{
+		step: func(_ Term, env *Env) (Term, error) {
+			if n == 0 {
+				return nil, nil
+			}
+			t, err := renamedCopy(key, nil, env)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case Integer(len(h.terms)) < n:
+				heap.Push(&h, t)
+			case t.Compare(h.terms[0], nil) > 0:
+				h.terms[0] = t
+				heap.Fix(&h, 0)
+			}
+			return nil, nil
+		},
+		finish: func(Term) (Term, bool) {
+			ts := make([]Term, len(h.terms))
+			for i := len(ts) - 1; i >= 0; i-- {
+				ts[i] = heap.Pop(&h).(Term)
+			}
+			return List(ts...), true
+		},
+	}, nil
+}
+
+// termHeap is a min-heap of terms in the standard order.
+type termHeap struct {
+	terms []Term
+	env   *Env
+}
+
+func (h termHeap) Len() int {
+	return len(h.terms)
+}
+
+func (h termHeap) Less(i, j int) bool {
+	return h.terms[i].Compare(h.terms[j], h.env) < 0
+}
+
+func (h termHeap) Swap(i, j int) {
+	h.terms[i], h.terms[j] = h.terms[j], h.terms[i]
+}
+
+func (h *termHeap) Push(x any) {
+	h.terms = append(h.terms, x.(Term))
+}
+
+func (h *termHeap) Pop() any {
+	t := h.terms[len(h.terms)-1]
+	h.terms = h.terms[:len(h.terms)-1]
+	return t
+}
+
+// Generator produces terms for aggregate_stream/4 one by one. If it also implements io.Closer, it's closed once
+// aggregate_stream/4 is done with it.
+type Generator interface {
+	// Next returns the next term. It returns false if there are no more terms.
+	Next(ctx context.Context) (Term, bool, error)
+}
+
+// RegisterGenerator registers a function which returns a new Generator each time aggregate_stream/4 reads
+// generator(name).
+func (vm *VM) RegisterGenerator(name Atom, g func() Generator) {
+	if vm.generators == nil {
+		vm.generators = map[Atom]func() Generator{}
+	}
+	vm.generators[name] = g
+}
+
+// AggregateStream aggregates the terms from source which unify with template as specified by spec and unifies the
+// result with result. source is either generator(Name) of a Generator registered by VM.RegisterGenerator or an input
+// text stream of Prolog terms each followed by a period. spec is one of count, sum(Expr), max(Expr), min(Expr), or
+// topk(K, Key) as well as aggregate_all/3. Unlike aggregate_all/3, the terms are processed one by one without
+// making a list of them. So the source can be larger than the memory.
+func AggregateStream(vm *VM, spec, template, source, result Term, k Cont, env *Env) *Promise {
+	a, err := newAggregation(vm, spec, env)
+	if err != nil {
+		return Error(err)
+	}
+	if a.bulk {
+		return Error(domainError(validDomainAggregateSpec, spec, env))
+	}
+
+	var g Generator
+	if s, ok := env.Resolve(source).(Compound); ok && s.Functor() == atomGenerator && s.Arity() == 1 {
+		switch name := env.Resolve(s.Arg(0)).(type) {
+		case Variable:
+			return Error(InstantiationError(env))
+		case Atom:
+			newGenerator, ok := vm.generators[name]
+			if !ok {
+				return Error(existenceError(objectTypeGenerator, source, env))
+			}
+			g = newGenerator()
+		default:
+			return Error(typeError(validTypeAtom, name, env))
+		}
+	} else {
+		s, err := stream(vm, source, env)
+		if err != nil {
+			return Error(err)
+		}
+		g = &streamGenerator{vm: vm, stream: s, source: source, env: env}
+	}
+
+	return Delay(func(ctx context.Context) *Promise {
+		if c, ok := g.(io.Closer); ok {
+			defer func() {
+				_ = c.Close()
+			}()
+		}
+		acc := a.init
+		for {
+			t, ok, err := g.Next(ctx)
+			if err != nil {
+				return Error(err)
+			}
+			if !ok {
+				break
+			}
+			env, ok := env.Unify(template, t)
+			if !ok {
+				continue
+			}
+			acc, err = a.step(acc, env)
+			if err != nil {
+				return Error(err)
+			}
+		}
+		r, ok := a.finish(acc)
+		if !ok {
+			return Bool(false)
+		}
+		return Unify(vm, result, r, k, env)
+	})
+}
+
+// streamGenerator reads terms from an input text stream.
+type streamGenerator struct {
+	vm     *VM
+	stream *Stream
+	source Term
+	env    *Env
+}
+
+func (g *streamGenerator) Next(ctx context.Context) (Term, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	p := NewParser(g.vm, g.stream)
+	p.atomScope = atomScopeOf(g.env)
+	defer func() {
+		_ = g.stream.UnreadRune()
+	}()
+	t, err := p.Term()
+	switch err {
+	case nil:
+		return t, true, nil
+	case io.EOF:
+		return nil, false, nil
+	case errWrongIOMode:
+		return nil, false, permissionError(operationInput, permissionTypeStream, g.source, g.env)
+	case errWrongStreamType:
+		return nil, false, permissionError(operationInput, permissionTypeBinaryStream, g.source, g.env)
+	case errPastEndOfStream:
+		return nil, false, permissionError(operationInput, permissionTypePastEndOfStream, g.source, g.env)
+	default:
+		return nil, false, syntaxError(err, g.env)
+	}
+}
@@ -0,0 +1,376 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregateAll(t *testing.T) {
+	x, r := NewVariable(), NewVariable()
+	member := func(x Term, ts ...Term) Term {
+		return NewAtom("member").Apply(x, List(ts...))
+	}
+	f := NewAtom("f")
+
+	tests := []struct {
+		title      string
+		spec, goal Term
+		ok         bool
+		err        error
+		result     Term
+	}{
+		{title: "count", spec: atomCount, goal: member(x, NewAtom("a"), NewAtom("b")), ok: true, result: Integer(2)},
+		{title: "count: no solutions", spec: atomCount, goal: atomFail, ok: true, result: Integer(0)},
+		{title: "sum", spec: atomSum.Apply(x), goal: member(x, Integer(1), Float(2.5)), ok: true, result: Float(3.5)},
+		{title: "sum: no solutions", spec: atomSum.Apply(x), goal: atomFail, ok: true, result: Integer(0)},
+		{title: "max", spec: atomMax.Apply(x), goal: member(x, Integer(1), Integer(3), Integer(2)), ok: true, result: Integer(3)},
+		{title: "max: expression", spec: atomMax.Apply(atomMinus.Apply(x)), goal: member(x, Integer(1), Integer(3)), ok: true, result: Integer(-1)},
+		{title: "max: no solutions", spec: atomMax.Apply(x), goal: atomFail, ok: false},
+		{title: "min", spec: atomMin.Apply(x), goal: member(x, Integer(2), Integer(1), Integer(3)), ok: true, result: Integer(1)},
+		{title: "bag", spec: atomBag.Apply(f.Apply(x)), goal: member(x, NewAtom("b"), NewAtom("a"), NewAtom("b")), ok: true, result: List(f.Apply(NewAtom("b")), f.Apply(NewAtom("a")), f.Apply(NewAtom("b")))},
+		{title: "set", spec: atomSet.Apply(x), goal: member(x, NewAtom("b"), NewAtom("a"), NewAtom("b")), ok: true, result: List(NewAtom("a"), NewAtom("b"))},
+		{title: "set: no solutions", spec: atomSet.Apply(x), goal: atomFail, ok: true, result: List()},
+		{title: "topk", spec: atomTopK.Apply(Integer(2), x), goal: member(x, Integer(2), Integer(5), Integer(1), Integer(3)), ok: true, result: List(Integer(5), Integer(3))},
+		{title: "topk: less solutions", spec: atomTopK.Apply(Integer(3), x), goal: member(x, NewAtom("a"), NewAtom("b")), ok: true, result: List(NewAtom("b"), NewAtom("a"))},
+		{title: "topk: zero", spec: atomTopK.Apply(Integer(0), x), goal: member(x, Integer(1)), ok: true, result: List()},
+		{title: "topk: k is a variable", spec: atomTopK.Apply(NewVariable(), x), goal: atomFail, err: InstantiationError(nil)},
+		{title: "topk: k is not an integer", spec: atomTopK.Apply(NewAtom("a"), x), goal: atomFail, err: typeError(validTypeInteger, NewAtom("a"), nil)},
+		{title: "topk: k is negative", spec: atomTopK.Apply(Integer(-1), x), goal: atomFail, err: domainError(validDomainNotLessThanZero, Integer(-1), nil)},
+
+		{title: "spec is a variable", spec: NewVariable(), goal: atomFail, err: InstantiationError(nil)},
+		{title: "unknown spec", spec: NewAtom("foo"), goal: atomFail, err: domainError(validDomainAggregateSpec, NewAtom("foo"), nil)},
+		{title: "unknown compound spec", spec: NewAtom("foo").Apply(NewAtom("a")), goal: atomFail, err: domainError(validDomainAggregateSpec, NewAtom("foo").Apply(NewAtom("a")), nil)},
+		{title: "spec is not callable", spec: Integer(1), goal: atomFail, err: typeError(validTypeCallable, Integer(1), nil)},
+	}
+
+	var vm VM
+	vm.Register0(atomFail, func(*VM, Cont, *Env) *Promise {
+		return Bool(false)
+	})
+	vm.Register2(NewAtom("member"), func(vm *VM, elem, list Term, k Cont, env *Env) *Promise {
+		var ks []func(context.Context) *Promise
+		iter := ListIterator{List: list, Env: env}
+		for iter.Next() {
+			e := iter.Current()
+			ks = append(ks, func(context.Context) *Promise {
+				return Unify(vm, elem, e, k, env)
+			})
+		}
+		return Delay(ks...)
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			ok, err := AggregateAll(&vm, tt.spec, tt.goal, r, func(env *Env) *Promise {
+				assert.Equal(t, tt.result, env.Resolve(r))
+				return Bool(true)
+			}, nil).Force(context.Background())
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.err, err)
+		})
+	}
+
+	t.Run("not evaluable", func(t *testing.T) {
+		_, err := AggregateAll(&vm, atomSum.Apply(x), member(x, NewAtom("a")), r, Success, nil).Force(context.Background())
+		formal := func(err error) Term {
+			return err.(Exception).Term().(Compound).Arg(0)
+		}
+		assert.Equal(t, formal(typeError(validTypeEvaluable, atomSlash.Apply(NewAtom("a"), Integer(0)), nil)), formal(err))
+	})
+}
+
+// sliceGenerator generates the terms in the slice.
+type sliceGenerator struct {
+	terms  []Term
+	closed bool
+}
+
+func (g *sliceGenerator) Next(context.Context) (Term, bool, error) {
+	if len(g.terms) == 0 {
+		return nil, false, nil
+	}
+	var t Term
+	t, g.terms = g.terms[0], g.terms[1:]
+	return t, true, nil
+}
+
+func (g *sliceGenerator) Close() error {
+	g.closed = true
+	return nil
+}
+
+func TestAggregateStream(t *testing.T) {
+	x, y, r := NewVariable(), NewVariable(), NewVariable()
+	item := NewAtom("item")
+
+	var (
+		vm   VM
+		last *sliceGenerator
+	)
+	vm.RegisterGenerator(NewAtom("items"), func() Generator {
+		last = &sliceGenerator{terms: []Term{
+			item.Apply(NewAtom("a"), Integer(3)),
+			item.Apply(NewAtom("b"), Integer(1)),
+			NewAtom("other"),
+			item.Apply(NewAtom("c"), Integer(2)),
+		}}
+		return last
+	})
+	items := atomGenerator.Apply(NewAtom("items"))
+
+	tests := []struct {
+		title                  string
+		spec, template, source Term
+		ok                     bool
+		err                    error
+		result                 Term
+	}{
+		{title: "count", spec: atomCount, template: item.Apply(x, y), source: items, ok: true, result: Integer(3)},
+		{title: "sum", spec: atomSum.Apply(y), template: item.Apply(x, y), source: items, ok: true, result: Integer(6)},
+		{title: "max", spec: atomMax.Apply(y), template: item.Apply(x, y), source: items, ok: true, result: Integer(3)},
+		{title: "min", spec: atomMin.Apply(y), template: item.Apply(x, y), source: items, ok: true, result: Integer(1)},
+		{title: "min: no terms", spec: atomMin.Apply(y), template: NewAtom("none"), source: items, ok: false},
+		{title: "topk", spec: atomTopK.Apply(Integer(2), atomMinus.Apply(y, x)), template: item.Apply(x, y), source: items, ok: true, result: List(atomMinus.Apply(Integer(3), NewAtom("a")), atomMinus.Apply(Integer(2), NewAtom("c")))},
+
+		{title: "bag", spec: atomBag.Apply(NewAtom("a")), template: x, source: items, err: domainError(validDomainAggregateSpec, atomBag.Apply(NewAtom("a")), nil)},
+		{title: "unknown generator", spec: atomCount, template: x, source: atomGenerator.Apply(NewAtom("foo")), err: existenceError(objectTypeGenerator, atomGenerator.Apply(NewAtom("foo")), nil)},
+		{title: "generator is a variable", spec: atomCount, template: x, source: atomGenerator.Apply(y), err: InstantiationError(nil)},
+		{title: "generator is not an atom", spec: atomCount, template: x, source: atomGenerator.Apply(Integer(1)), err: typeError(validTypeAtom, Integer(1), nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			ok, err := AggregateStream(&vm, tt.spec, tt.template, tt.source, r, func(env *Env) *Promise {
+				assert.Equal(t, tt.result, env.Resolve(r))
+				return Bool(true)
+			}, nil).Force(context.Background())
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.err, err)
+		})
+	}
+
+	t.Run("closed", func(t *testing.T) {
+		_, err := AggregateStream(&vm, atomCount, x, items, r, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, last.closed)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		s := NewInputTextStream(strings.NewReader(`
+item(a, 3).
+item(b, 1).
+other.
+item(c, 2).
+`))
+		ok, err := AggregateStream(&vm, atomSum.Apply(y), item.Apply(x, y), s, r, func(env *Env) *Promise {
+			assert.Equal(t, Integer(6), env.Resolve(r))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("syntax error", func(t *testing.T) {
+		s := NewInputTextStream(strings.NewReader(`item(a, 3). foo bar.`))
+		_, err := AggregateStream(&vm, atomCount, x, s, r, Success, nil).Force(context.Background())
+		assert.Error(t, err)
+	})
+}
+
+// registerMember registers member/2 and fail/0 to vm.
+func registerMember(vm *VM) {
+	vm.Register0(atomFail, func(*VM, Cont, *Env) *Promise {
+		return Bool(false)
+	})
+	vm.Register2(NewAtom("member"), func(vm *VM, elem, list Term, k Cont, env *Env) *Promise {
+		var ks []func(context.Context) *Promise
+		iter := ListIterator{List: list, Env: env}
+		for iter.Next() {
+			e := iter.Current()
+			ks = append(ks, func(context.Context) *Promise {
+				return Unify(vm, elem, e, k, env)
+			})
+		}
+		return Delay(ks...)
+	})
+}
+
+func TestFoldAll(t *testing.T) {
+	x, v := NewVariable(), NewVariable()
+	member := func(x Term, ts ...Term) Term {
+		return NewAtom("member").Apply(x, List(ts...))
+	}
+	plus := NewAtom("plus")
+
+	var vm VM
+	registerMember(&vm)
+	vm.Register3(plus, func(vm *VM, x, y, z Term, k Cont, env *Env) *Promise {
+		return Unify(vm, z, env.Resolve(x).(Integer)+env.Resolve(y).(Integer), k, env)
+	})
+	vm.Register3(NewAtom("cons"), func(vm *VM, x, xs, ys Term, k Cont, env *Env) *Promise {
+		return Unify(vm, ys, Cons(x, xs), k, env)
+	})
+	vm.Register2(NewAtom("never"), func(*VM, Term, Term, Cont, *Env) *Promise {
+		return Bool(false)
+	})
+
+	tests := []struct {
+		title        string
+		folder, goal Term
+		v0           Term
+		ok           bool
+		err          error
+		v            Term
+	}{
+		{title: "sum", folder: plus.Apply(x), goal: member(x, Integer(1), Integer(2), Integer(3)), v0: Integer(0), ok: true, v: Integer(6)},
+		{title: "reverse", folder: NewAtom("cons").Apply(x), goal: member(x, NewAtom("a"), NewAtom("b")), v0: List(), ok: true, v: List(NewAtom("b"), NewAtom("a"))},
+		{title: "no solutions", folder: plus.Apply(x), goal: atomFail, v0: Integer(0), ok: true, v: Integer(0)},
+		{title: "folder fails", folder: NewAtom("never"), goal: member(x, Integer(1)), v0: Integer(0), ok: false},
+		{title: "goal is a variable", folder: plus.Apply(x), goal: NewVariable(), v0: Integer(0), err: InstantiationError(nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			ok, err := FoldAll(&vm, tt.folder, tt.goal, tt.v0, v, func(env *Env) *Promise {
+				assert.Zero(t, tt.v.Compare(v, env))
+				return Bool(true)
+			}, nil).Force(context.Background())
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.err, err)
+		})
+	}
+}
+
+func TestForAllCount(t *testing.T) {
+	x, n := NewVariable(), NewVariable()
+	member := func(x Term, ts ...Term) Term {
+		return NewAtom("member").Apply(x, List(ts...))
+	}
+	a, b := NewAtom("a"), NewAtom("b")
+
+	var vm VM
+	registerMember(&vm)
+
+	tests := []struct {
+		title        string
+		cond, action Term
+		count        Term
+		ok           bool
+		err          error
+		n            Term
+	}{
+		{title: "all", cond: member(x, a, b), action: member(x, b, a), count: n, ok: true, n: Integer(2)},
+		{title: "no solutions", cond: atomFail, action: atomFail, count: n, ok: true, n: Integer(0)},
+		{title: "some", cond: member(x, a, b), action: member(x, a), count: n, ok: false},
+		{title: "count is bound", cond: member(x, a, b), action: member(x, b, a), count: Integer(3), ok: false},
+		{title: "count is not an integer", cond: member(x, a, b), action: member(x, b, a), count: a, err: typeError(validTypeInteger, a, nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			ok, err := ForAllCount(&vm, tt.cond, tt.action, tt.count, func(env *Env) *Promise {
+				assert.Equal(t, tt.n, env.Resolve(n))
+				return Bool(true)
+			}, nil).Force(context.Background())
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.err, err)
+		})
+	}
+
+	t.Run("stops at the first counterexample", func(t *testing.T) {
+		var c int
+		vm.Register1(NewAtom("checked"), func(_ *VM, x Term, k Cont, env *Env) *Promise {
+			c++
+			return Bool(env.Resolve(x) != a)
+		})
+		ok, err := ForAllCount(&vm, member(x, b, a, b), NewAtom("checked").Apply(x), n, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, 2, c)
+	})
+}
+
+func TestAggregateWindow(t *testing.T) {
+	x, r := NewVariable(), NewVariable()
+	nat := NewAtom("nat")
+
+	var vm VM
+	registerMember(&vm)
+	// nat(X) enumerates the natural numbers forever.
+	var enumerate func(i Integer, x Term, k Cont, env *Env) *Promise
+	enumerate = func(i Integer, x Term, k Cont, env *Env) *Promise {
+		return Delay(func(context.Context) *Promise {
+			return Unify(&vm, x, i, k, env)
+		}, func(context.Context) *Promise {
+			return enumerate(i+1, x, k, env)
+		})
+	}
+	vm.Register1(nat, func(_ *VM, x Term, k Cont, env *Env) *Promise {
+		return enumerate(0, x, k, env)
+	})
+
+	results := func(spec, size, goal Term, limit int) ([]Term, error) {
+		var rs []Term
+		_, err := AggregateWindow(&vm, spec, size, goal, r, func(env *Env) *Promise {
+			rs = append(rs, env.Resolve(r))
+			return Bool(len(rs) == limit)
+		}, nil).Force(context.Background())
+		return rs, err
+	}
+
+	t.Run("infinite", func(t *testing.T) {
+		rs, err := results(atomSum.Apply(x), Integer(3), nat.Apply(x), 3)
+		assert.NoError(t, err)
+		assert.Equal(t, []Term{Integer(3), Integer(12), Integer(21)}, rs)
+	})
+
+	t.Run("last window", func(t *testing.T) {
+		rs, err := results(atomBag.Apply(x), Integer(2), NewAtom("member").Apply(x, List(Integer(1), Integer(2), Integer(3))), 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []Term{List(Integer(1), Integer(2)), List(Integer(3))}, rs)
+	})
+
+	t.Run("one window", func(t *testing.T) {
+		rs, err := results(atomCount, Integer(0), NewAtom("member").Apply(x, List(Integer(1), Integer(2), Integer(3))), 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []Term{Integer(3)}, rs)
+	})
+
+	t.Run("no solutions", func(t *testing.T) {
+		rs, err := results(atomCount, Integer(2), atomFail, 0)
+		assert.NoError(t, err)
+		assert.Empty(t, rs)
+	})
+
+	t.Run("the goal bindings don't leak", func(t *testing.T) {
+		ok, err := AggregateWindow(&vm, atomCount, Integer(1), nat.Apply(x), r, func(env *Env) *Promise {
+			_, ok := env.Resolve(x).(Variable)
+			return Bool(ok)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("size is a variable", func(t *testing.T) {
+		_, err := results(atomCount, NewVariable(), atomFail, 0)
+		assert.Equal(t, InstantiationError(nil), err)
+	})
+
+	t.Run("size is not an integer", func(t *testing.T) {
+		_, err := results(atomCount, NewAtom("a"), atomFail, 0)
+		assert.Equal(t, typeError(validTypeInteger, NewAtom("a"), nil), err)
+	})
+
+	t.Run("size is negative", func(t *testing.T) {
+		_, err := results(atomCount, Integer(-1), atomFail, 0)
+		assert.Equal(t, domainError(validDomainNotLessThanZero, Integer(-1), nil), err)
+	})
+
+	t.Run("unknown spec", func(t *testing.T) {
+		_, err := results(NewAtom("foo"), Integer(1), atomFail, 0)
+		assert.Equal(t, domainError(validDomainAggregateSpec, NewAtom("foo"), nil), err)
+	})
+}
@@ -18,8 +18,16 @@ var (
 		sync.RWMutex
 		names []string
 		atoms map[string]Atom
+
+		// temporary is a set of atoms interned through AtomScopes with the number of scopes holding them.
+		temporary map[Atom]int
+		// generations are the numbers of times each entry of names was released.
+		generations []uint32
+		// free is a list of the entries released by AtomScopes which will be reused for new atoms.
+		free []int
 	}{
-		atoms: map[string]Atom{},
+		atoms:     map[string]Atom{},
+		temporary: map[Atom]int{},
 	}
 )
 
@@ -38,6 +46,10 @@ var (
 	atomLessThan          = NewAtom("<")
 	atomEqual             = NewAtom("=")
 	atomGreaterThan       = NewAtom(">")
+	atomAtLessThan        = NewAtom("@<")
+	atomAtLessOrEqual     = NewAtom("@=<")
+	atomAtGreaterThan     = NewAtom("@>")
+	atomAtGreaterOrEqual  = NewAtom("@>=")
 	atomDot               = NewAtom(".")
 	atomComma             = NewAtom(",")
 	atomBar               = NewAtom("|")
@@ -45,6 +57,7 @@ var (
 	atomSemiColon         = NewAtom(";")
 	atomNegation          = NewAtom(`\+`)
 	atomThen              = NewAtom("->")
+	atomSoftCut           = NewAtom("*->")
 	atomCaret             = NewAtom("^")
 	atomArrow             = NewAtom("-->")
 	atomBackSlash         = NewAtom(`\`)
@@ -57,7 +70,9 @@ var (
 	atomAbs                     = NewAtom("abs")
 	atomAccess                  = NewAtom("access")
 	atomAcos                    = NewAtom("acos")
+	atomAggregateSpec           = NewAtom("aggregate_spec")
 	atomAlias                   = NewAtom("alias")
+	atomAny                     = NewAtom("any")
 	atomAppend                  = NewAtom("append")
 	atomAsin                    = NewAtom("asin")
 	atomAt                      = NewAtom("at")
@@ -65,11 +80,16 @@ var (
 	atomAtan2                   = NewAtom("atan2")
 	atomAtom                    = NewAtom("atom")
 	atomAtomic                  = NewAtom("atomic")
+	atomBacktrace               = NewAtom("backtrace")
+	atomBag                     = NewAtom("bag")
 	atomBinary                  = NewAtom("binary")
 	atomBinaryStream            = NewAtom("binary_stream")
+	atomBoolean                 = NewAtom("boolean")
 	atomBounded                 = NewAtom("bounded")
+	atomBuiltIn                 = NewAtom("built_in")
 	atomByte                    = NewAtom("byte")
 	atomCall                    = NewAtom("call")
+	atomCallDepth               = NewAtom("call_depth")
 	atomCallable                = NewAtom("callable")
 	atomCeiling                 = NewAtom("ceiling")
 	atomCharConversion          = NewAtom("char_conversion")
@@ -77,20 +97,32 @@ var (
 	atomCharacterCode           = NewAtom("character_code")
 	atomCharacterCodeList       = NewAtom("character_code_list")
 	atomChars                   = NewAtom("chars")
+	atomClauseMetadata          = NewAtom("clause_metadata")
+	atomClauses                 = NewAtom("clauses")
 	atomCloseOption             = NewAtom("close_option")
 	atomCodes                   = NewAtom("codes")
+	atomCompat                  = NewAtom("compat")
 	atomCompound                = NewAtom("compound")
 	atomCos                     = NewAtom("cos")
+	atomCount                   = NewAtom("count")
 	atomCreate                  = NewAtom("create")
+	atomDate                    = NewAtom("date")
+	atomDBReference             = NewAtom("db_reference")
 	atomDebug                   = NewAtom("debug")
+	atomDefined                 = NewAtom("defined")
+	atomDialect                 = NewAtom("dialect")
+	atomDiff                    = NewAtom("diff")
+	atomDirective               = NewAtom("directive")
 	atomDiscontiguous           = NewAtom("discontiguous")
 	atomDiv                     = NewAtom("div")
 	atomDomainError             = NewAtom("domain_error")
 	atomDoubleQuotes            = NewAtom("double_quotes")
 	atomDynamic                 = NewAtom("dynamic")
 	atomE                       = NewAtom("E")
+	atomEpsilon                 = NewAtom("epsilon")
 	atomEOFAction               = NewAtom("eof_action")
 	atomEOFCode                 = NewAtom("eof_code")
+	atomEncoding                = NewAtom("encoding")
 	atomEndOfFile               = NewAtom("end_of_file")
 	atomEndOfStream             = NewAtom("end_of_stream")
 	atomEnsureLoaded            = NewAtom("ensure_loaded")
@@ -99,6 +131,9 @@ var (
 	atomEvaluationError         = NewAtom("evaluation_error")
 	atomExistenceError          = NewAtom("existence_error")
 	atomExp                     = NewAtom("exp")
+	atomFactSchema              = NewAtom("fact_schema")
+	atomFallback                = NewAtom("fallback")
+	atomFallbackSubstitution    = NewAtom("fallback_substitution")
 	atomFX                      = NewAtom("fx")
 	atomFY                      = NewAtom("fy")
 	atomFail                    = NewAtom("fail")
@@ -110,41 +145,74 @@ var (
 	atomFloat                   = NewAtom("float")
 	atomFloatFractionalPart     = NewAtom("float_fractional_part")
 	atomFloatIntegerPart        = NewAtom("float_integer_part")
+	atomFormat                  = NewAtom("format")
+	atomGoalFailed              = NewAtom("goal_failed")
 	atomFloatOverflow           = NewAtom("float_overflow")
 	atomFloor                   = NewAtom("floor")
+	atomFloundering             = NewAtom("floundering")
 	atomForce                   = NewAtom("force")
+	atomForeignCallTime         = NewAtom("foreign_call_time")
+	atomFrame                   = NewAtom("frame")
+	atomFrameAttribute          = NewAtom("frame_attribute")
+	atomGenerator               = NewAtom("generator")
+	atomGround                  = NewAtom("ground")
+	atomHashAlgorithm           = NewAtom("hash_algorithm")
+	atomMD5                     = NewAtom("md5")
+	atomSHA1                    = NewAtom("sha1")
+	atomSHA256                  = NewAtom("sha256")
+	atomGo                      = NewAtom("go")
+	atomGoal                    = NewAtom("goal")
 	atomIOMode                  = NewAtom("io_mode")
+	atomISO                     = NewAtom("iso")
+	atomISOLatin1               = NewAtom("iso_latin_1")
 	atomIgnoreOps               = NewAtom("ignore_ops")
+	atomImage                   = NewAtom("image")
 	atomInByte                  = NewAtom("in_byte")
 	atomInCharacter             = NewAtom("in_character")
 	atomInCharacterCode         = NewAtom("in_character_code")
 	atomInclude                 = NewAtom("include")
+	atomIndex                   = NewAtom("index")
+	atomInferences              = NewAtom("inferences")
 	atomInitialization          = NewAtom("initialization")
 	atomInput                   = NewAtom("input")
+	atomInformational           = NewAtom("informational")
 	atomInstantiationError      = NewAtom("instantiation_error")
 	atomIntOverflow             = NewAtom("int_overflow")
 	atomInteger                 = NewAtom("integer")
 	atomIntegerRoundingFunction = NewAtom("integer_rounding_function")
+	atomIs                      = NewAtom("is")
+	atomLatin1                  = NewAtom("latin_1")
+	atomLevel                   = NewAtom("level")
 	atomList                    = NewAtom("list")
+	atomLocal                   = NewAtom("local")
 	atomLog                     = NewAtom("log")
+	atomLoopCheck               = NewAtom("loop_check")
+	atomLoopError               = NewAtom("loop_error")
 	atomMax                     = NewAtom("max")
 	atomMaxArity                = NewAtom("max_arity")
 	atomMaxDepth                = NewAtom("max_depth")
+	atomMaxTaggedInteger        = NewAtom("max_tagged_integer")
 	atomMaxInteger              = NewAtom("max_integer")
 	atomMemory                  = NewAtom("memory")
+	atomMessageHook             = NewAtom("message_hook")
+	atomMessageKind             = NewAtom("message_kind")
 	atomMin                     = NewAtom("min")
+	atomMinTaggedInteger        = NewAtom("min_tagged_integer")
 	atomMinInteger              = NewAtom("min_integer")
 	atomMod                     = NewAtom("mod")
 	atomMode                    = NewAtom("mode")
 	atomModify                  = NewAtom("modify")
 	atomMultifile               = NewAtom("multifile")
 	atomNonEmptyList            = NewAtom("non_empty_list")
+	atomNonNeg                  = NewAtom("nonneg")
 	atomNot                     = NewAtom("not")
 	atomNotLessThanZero         = NewAtom("not_less_than_zero")
 	atomNumber                  = NewAtom("number")
+	atomNumberOfClauses         = NewAtom("number_of_clauses")
 	atomNumberVars              = NewAtom("numbervars")
 	atomOff                     = NewAtom("off")
 	atomOn                      = NewAtom("on")
+	atomOneOf                   = NewAtom("oneof")
 	atomOpen                    = NewAtom("open")
 	atomOperator                = NewAtom("operator")
 	atomOperatorPriority        = NewAtom("operator_priority")
@@ -152,8 +220,9 @@ var (
 	atomOrder                   = NewAtom("order")
 	atomOutput                  = NewAtom("output")
 	atomPair                    = NewAtom("pair")
+	atomParent                  = NewAtom("parent")
 	atomPast                    = NewAtom("past")
-	atomPastEndOfStream         = NewAtom("past_enf_of_stream")
+	atomPastEndOfStream         = NewAtom("past_end_of_stream")
 	atomPermissionError         = NewAtom("permission_error")
 	atomPhrase                  = NewAtom("phrase")
 	atomPi                      = NewAtom("pi")
@@ -161,7 +230,9 @@ var (
 	atomPredicateIndicator      = NewAtom("predicate_indicator")
 	atomPrivateProcedure        = NewAtom("private_procedure")
 	atomProcedure               = NewAtom("procedure")
+	atomPredicateProperty       = NewAtom("predicate_property")
 	atomPrologFlag              = NewAtom("prolog_flag")
+	atomPure                    = NewAtom("pure")
 	atomQuoted                  = NewAtom("quoted")
 	atomRead                    = NewAtom("read")
 	atomReadOption              = NewAtom("read_option")
@@ -170,38 +241,56 @@ var (
 	atomRepresentationError     = NewAtom("representation_error")
 	atomReset                   = NewAtom("reset")
 	atomResourceError           = NewAtom("resource_error")
+	atomResumableQuery          = NewAtom("resumable_query")
 	atomRound                   = NewAtom("round")
+	atomSchemaError             = NewAtom("schema_error")
+	atomSchemaType              = NewAtom("schema_type")
+	atomSet                     = NewAtom("set")
 	atomSign                    = NewAtom("sign")
+	atomSilent                  = NewAtom("silent")
 	atomSin                     = NewAtom("sin")
 	atomSingletons              = NewAtom("singletons")
 	atomSmallE                  = NewAtom("e")
 	atomSourceSink              = NewAtom("source_sink")
 	atomSqrt                    = NewAtom("sqrt")
+	atomStatic                  = NewAtom("static")
 	atomStaticProcedure         = NewAtom("static_procedure")
 	atomStream                  = NewAtom("stream")
 	atomStreamOption            = NewAtom("stream_option")
+	atomStreamLine              = NewAtom("stream_line")
 	atomStreamOrAlias           = NewAtom("stream_or_alias")
 	atomStreamPosition          = NewAtom("stream_position")
 	atomStreamProperty          = NewAtom("stream_property")
+	atomString                  = NewAtom("string")
+	atomSum                     = NewAtom("sum")
 	atomSyntaxError             = NewAtom("syntax_error")
 	atomTan                     = NewAtom("tan")
 	atomTermExpansion           = NewAtom("term_expansion")
+	atomTerms                   = NewAtom("terms")
 	atomText                    = NewAtom("text")
 	atomTextStream              = NewAtom("text_stream")
+	atomTime                    = NewAtom("time")
+	atomTimeZone                = NewAtom("time_zone")
+	atomTopK                    = NewAtom("topk")
 	atomTowardZero              = NewAtom("toward_zero")
+	atomTrail                   = NewAtom("trail")
 	atomTrue                    = NewAtom("true")
 	atomTruncate                = NewAtom("truncate")
 	atomType                    = NewAtom("type")
 	atomTypeError               = NewAtom("type_error")
+	atomUTC                     = NewAtom("UTC")
+	atomUTF8                    = NewAtom("utf8")
 	atomUnbounded               = NewAtom("unbounded")
 	atomUndefined               = NewAtom("undefined")
 	atomUnderflow               = NewAtom("underflow")
 	atomUnknown                 = NewAtom("unknown")
+	atomUser                    = NewAtom("user")
 	atomUserInput               = NewAtom("user_input")
 	atomUserOutput              = NewAtom("user_output")
 	atomVar                     = NewAtom("$VAR")
 	atomVariableNames           = NewAtom("variable_names")
 	atomVariables               = NewAtom("variables")
+	atomViolation               = NewAtom("violation")
 	atomWarning                 = NewAtom("warning")
 	atomWrite                   = NewAtom("write")
 	atomWriteOption             = NewAtom("write_option")
@@ -210,6 +299,7 @@ var (
 	atomXFY                     = NewAtom("xfy")
 	atomXor                     = NewAtom("xor")
 	atomYF                      = NewAtom("yf")
+	atomYield                   = NewAtom("yield")
 	atomYFX                     = NewAtom("yfx")
 	atomZeroDivisor             = NewAtom("zero_divisor")
 )
@@ -226,18 +316,50 @@ func NewAtom(name string) Atom {
 
 	atomTable.Lock()
 	defer atomTable.Unlock()
+	return internPermanent(name)
+}
 
+// internPermanent interns a multi-char name as a permanent atom. The caller must hold the lock.
+func internPermanent(name string) Atom {
 	a, ok := atomTable.atoms[name]
 	if ok {
+		delete(atomTable.temporary, a) // It's not temporary anymore.
 		return a
 	}
 
-	a = Atom(len(atomTable.names) + (utf8.MaxRune + 1))
+	return internAtom(name)
+}
+
+// internAtom adds a new entry to the atom table. The caller must hold the lock.
+func internAtom(name string) Atom {
+	var i int
+	if n := len(atomTable.free); n > 0 {
+		i, atomTable.free = atomTable.free[n-1], atomTable.free[:n-1]
+		atomTable.names[i] = name
+	} else {
+		i = len(atomTable.names)
+		atomTable.names = append(atomTable.names, name)
+		atomTable.generations = append(atomTable.generations, 0)
+	}
+	a := newTableAtom(i, atomTable.generations[i])
 	atomTable.atoms[name] = a
-	atomTable.names = append(atomTable.names, name)
 	return a
 }
 
+// An atom in the table consists of the index of its entry offset by utf8.MaxRune+1 in the lower 32 bits and
+// the generation of the entry in the upper 32 bits. Since an entry released by AtomScope.Release gets a new generation,
+// a stale atom never turns into another atom reusing the entry.
+const atomGenerationShift = 32
+
+func newTableAtom(i int, generation uint32) Atom {
+	return Atom(generation)<<atomGenerationShift | Atom(i+(utf8.MaxRune+1))
+}
+
+// entry returns the index of the entry in the table and the generation of the atom.
+func (a Atom) entry() (int, uint32) {
+	return int(uint32(a) - (utf8.MaxRune + 1)), uint32(a >> atomGenerationShift)
+}
+
 // WriteTerm outputs the Atom to an io.Writer.
 func (a Atom) WriteTerm(w io.Writer, opts *WriteOptions, _ *Env) error {
 	ew := errWriter{w: w}
@@ -301,7 +423,11 @@ func (a Atom) String() string {
 	}
 	atomTable.RLock()
 	defer atomTable.RUnlock()
-	return atomTable.names[a-(utf8.MaxRune+1)]
+	i, g := a.entry()
+	if atomTable.generations[i] != g {
+		return "" // Released.
+	}
+	return atomTable.names[i]
 }
 
 // Apply returns a Compound which Functor is the Atom and args are the arguments. If the arguments are empty,
@@ -350,6 +476,8 @@ func quotedIdentEscape(s string) string {
 		return `\\`
 	case `'`:
 		return `\'`
+	case `"`:
+		return `\"`
 	default:
 		var ret []string
 		for _, r := range s {
@@ -0,0 +1,187 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// varAtomScope is a special variable bound to the AtomScope of the execution, if any.
+var varAtomScope = NewVariable()
+
+// AtomScope is a set of temporary atoms. Atoms made from runtime data e.g. by atom_codes/2 or read_term/2 are
+// interned in the scope if the execution is in the scope. See Env.WithAtomScope.
+// Release reclaims the atoms unless they're stored in the database or interned by NewAtom in the meantime.
+//
+// Atoms obtained in the scope must not be used after Release. Such an atom has an empty name and never equals to
+// another atom.
+type AtomScope struct {
+	mu    sync.Mutex
+	atoms map[Atom]struct{}
+}
+
+// NewAtomScope creates an empty AtomScope.
+func NewAtomScope() *AtomScope {
+	return &AtomScope{atoms: map[Atom]struct{}{}}
+}
+
+// NewAtom interns the given string as a temporary atom of the scope and returns an Atom.
+// If the atom already exists and isn't temporary, it returns the atom as NewAtom does.
+func (s *AtomScope) NewAtom(name string) Atom {
+	// A one-char atom is just a rune.
+	if r, n := utf8.DecodeLastRuneInString(name); r != utf8.RuneError && n == len(name) {
+		return Atom(r)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	atomTable.Lock()
+	defer atomTable.Unlock()
+
+	a, ok := atomTable.atoms[name]
+	if !ok {
+		a = internAtom(name)
+	} else if _, ok := atomTable.temporary[a]; !ok {
+		return a
+	}
+
+	if _, ok := s.atoms[a]; !ok {
+		s.atoms[a] = struct{}{}
+		atomTable.temporary[a]++
+	}
+	return a
+}
+
+// Len returns the number of temporary atoms held by the scope.
+func (s *AtomScope) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.atoms)
+}
+
+// Release removes the temporary atoms held only by the scope from the atom table.
+func (s *AtomScope) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	atomTable.Lock()
+	defer atomTable.Unlock()
+
+	for a := range s.atoms {
+		n, ok := atomTable.temporary[a]
+		switch {
+		case !ok:
+			break
+		case n > 1:
+			atomTable.temporary[a] = n - 1
+		default:
+			delete(atomTable.temporary, a)
+			i, _ := a.entry()
+			delete(atomTable.atoms, atomTable.names[i])
+			atomTable.names[i] = ""
+			atomTable.generations[i]++
+			atomTable.free = append(atomTable.free, i)
+		}
+	}
+	s.atoms = map[Atom]struct{}{}
+}
+
+// WriteTerm outputs the AtomScope to an io.Writer.
+func (s *AtomScope) WriteTerm(w io.Writer, _ *WriteOptions, _ *Env) error {
+	_, err := fmt.Fprintf(w, "<atom_scope>(%p)", s)
+	return err
+}
+
+// Compare compares the AtomScope with a Term.
+func (s *AtomScope) Compare(t Term, env *Env) int {
+	return CompareAtomic[*AtomScope](s, t, func(s *AtomScope, t *AtomScope) int {
+		switch x, y := uintptr(unsafe.Pointer(s)), uintptr(unsafe.Pointer(t)); {
+		case x > y:
+			return 1
+		case x < y:
+			return -1
+		default:
+			return 0
+		}
+	}, env)
+}
+
+// WithAtomScope returns an Env in which atoms made from runtime data are interned in the scope.
+func (e *Env) WithAtomScope(s *AtomScope) *Env {
+	return e.bind(varAtomScope, s)
+}
+
+func atomScopeOf(env *Env) *AtomScope {
+	t, ok := env.lookup(varAtomScope)
+	if !ok {
+		return nil
+	}
+	s, _ := t.(*AtomScope)
+	return s
+}
+
+// newAtom interns the given string in the AtomScope of env if any.
+func newAtom(name string, env *Env) Atom {
+	if s := atomScopeOf(env); s != nil {
+		return s.NewAtom(name)
+	}
+	return NewAtom(name)
+}
+
+// persistAtoms makes the temporary atoms in t permanent since t is going to outlive the execution.
+func persistAtoms(t Term, env *Env) {
+	atomTable.RLock()
+	n := len(atomTable.temporary)
+	atomTable.RUnlock()
+	if n == 0 {
+		return
+	}
+
+	var as []Atom
+	visited := map[termID]struct{}{}
+	var collect func(t Term)
+	collect = func(t Term) {
+		switch t := env.Resolve(t).(type) {
+		case Atom:
+			as = append(as, t)
+		case Compound:
+			if _, ok := visited[id(t)]; ok {
+				return
+			}
+			visited[id(t)] = struct{}{}
+			as = append(as, t.Functor())
+			for i := 0; i < t.Arity(); i++ {
+				collect(t.Arg(i))
+			}
+		}
+	}
+	collect(t)
+
+	atomTable.Lock()
+	defer atomTable.Unlock()
+	for _, a := range as {
+		delete(atomTable.temporary, a)
+	}
+}
+
+// AtomStats is a snapshot of the atom table.
+type AtomStats struct {
+	// Atoms is the number of atoms in the table. One-char atoms are not counted since they're not in the table.
+	Atoms int
+	// Temporary is the number of atoms held by AtomScopes.
+	Temporary int
+	// Free is the number of released entries waiting to be reused.
+	Free int
+}
+
+// AtomStats returns the statistics of the atom table shared among VMs.
+func (vm *VM) AtomStats() AtomStats {
+	atomTable.RLock()
+	defer atomTable.RUnlock()
+	return AtomStats{
+		Atoms:     len(atomTable.atoms),
+		Temporary: len(atomTable.temporary),
+		Free:      len(atomTable.free),
+	}
+}
@@ -0,0 +1,153 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAtomScope_NewAtom(t *testing.T) {
+	t.Run("one-char", func(t *testing.T) {
+		s := NewAtomScope()
+		assert.Equal(t, Atom('a'), s.NewAtom("a"))
+		assert.Equal(t, 0, s.Len())
+	})
+
+	t.Run("permanent", func(t *testing.T) {
+		a := NewAtom("atom_scope_permanent")
+		s := NewAtomScope()
+		assert.Equal(t, a, s.NewAtom("atom_scope_permanent"))
+		assert.Equal(t, 0, s.Len())
+		s.Release()
+		assert.Equal(t, "atom_scope_permanent", a.String())
+	})
+
+	t.Run("temporary", func(t *testing.T) {
+		var vm VM
+		before := vm.AtomStats()
+
+		s := NewAtomScope()
+		a := s.NewAtom("atom_scope_temporary")
+		assert.Equal(t, a, s.NewAtom("atom_scope_temporary"))
+		assert.Equal(t, "atom_scope_temporary", a.String())
+		assert.Equal(t, 1, s.Len())
+		assert.Equal(t, before.Temporary+1, vm.AtomStats().Temporary)
+
+		s.Release()
+		assert.Equal(t, 0, s.Len())
+		after := vm.AtomStats()
+		assert.Equal(t, before.Temporary, after.Temporary)
+		assert.Equal(t, before.Atoms, after.Atoms)
+
+		// The released entry is reused but the stale atom doesn't turn into the new one.
+		b := NewAtom("atom_scope_reused")
+		ai, _ := a.entry()
+		bi, _ := b.entry()
+		assert.Equal(t, ai, bi)
+		assert.NotEqual(t, a, b)
+		assert.Equal(t, "atom_scope_reused", b.String())
+		assert.Equal(t, "", a.String())
+	})
+
+	t.Run("shared by scopes", func(t *testing.T) {
+		s1, s2 := NewAtomScope(), NewAtomScope()
+		a := s1.NewAtom("atom_scope_shared")
+		assert.Equal(t, a, s2.NewAtom("atom_scope_shared"))
+		s1.Release()
+		assert.Equal(t, "atom_scope_shared", a.String())
+		s2.Release()
+		assert.Equal(t, "", a.String())
+	})
+
+	t.Run("promoted by NewAtom", func(t *testing.T) {
+		s := NewAtomScope()
+		a := s.NewAtom("atom_scope_promoted")
+		assert.Equal(t, a, NewAtom("atom_scope_promoted"))
+		s.Release()
+		assert.Equal(t, "atom_scope_promoted", a.String())
+	})
+}
+
+func TestAtomScope_builtins(t *testing.T) {
+	t.Run("atom_codes", func(t *testing.T) {
+		s := NewAtomScope()
+		a := NewVariable()
+		var vm VM
+		ok, err := AtomCodes(&vm, a, CodeList("atom_scope_codes"), func(env *Env) *Promise {
+			assert.Equal(t, "atom_scope_codes", env.Resolve(a).(Atom).String())
+			return Bool(true)
+		}, NewEnv().WithAtomScope(s)).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, 1, s.Len())
+		s.Release()
+	})
+
+	t.Run("assertz", func(t *testing.T) {
+		s := NewAtomScope()
+		env := NewEnv().WithAtomScope(s)
+		a := newAtom("atom_scope_asserted", env)
+		var vm VM
+		ok, err := Assertz(&vm, NewAtom("foo").Apply(a), Success, env).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		s.Release()
+		assert.Equal(t, "atom_scope_asserted", a.String())
+	})
+
+	t.Run("recordz", func(t *testing.T) {
+		s := NewAtomScope()
+		env := NewEnv().WithAtomScope(s)
+		key := newAtom("atom_scope_record_key", env)
+		value := newAtom("atom_scope_record_value", env)
+		var vm VM
+		ok, err := Recordz(&vm, key, value, NewVariable(), Success, env).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		s.Release()
+		assert.Equal(t, "atom_scope_record_key", key.String())
+		assert.Equal(t, "atom_scope_record_value", value.String())
+
+		ok, err = Recorded(&vm, NewAtom("atom_scope_record_key"), value, NewVariable(), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		s := NewAtomScope()
+		env := NewEnv().WithAtomScope(s)
+		primary := newAtom("atom_scope_primary", env)
+		alternative := newAtom("atom_scope_alternative", env)
+		ball := newAtom("atom_scope_ball", env)
+		var vm VM
+		ok, err := Fallback(&vm, atomSlash.Apply(primary, Integer(0)), atomSlash.Apply(alternative, Integer(0)), List(ball), Success, env).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		s.Release()
+		assert.Equal(t, "atom_scope_primary", primary.String())
+		assert.Equal(t, "atom_scope_alternative", alternative.String())
+		assert.Equal(t, "atom_scope_ball", ball.String())
+
+		fb, ok := vm.fallbacks[procedureIndicator{name: NewAtom("atom_scope_primary"), arity: 0}]
+		assert.True(t, ok)
+		assert.Equal(t, NewAtom("atom_scope_alternative"), fb.pi.name)
+		assert.Equal(t, []Term{NewAtom("atom_scope_ball")}, fb.catchers)
+	})
+
+	t.Run("read_term", func(t *testing.T) {
+		s := NewAtomScope()
+		var vm VM
+		in := NewInputTextStream(strings.NewReader("atom_scope_read."))
+		x := NewVariable()
+		ok, err := ReadTerm(&vm, in, x, List(), func(env *Env) *Promise {
+			assert.Equal(t, "atom_scope_read", env.Resolve(x).(Atom).String())
+			return Bool(true)
+		}, NewEnv().WithAtomScope(s)).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, 1, s.Len())
+		s.Release()
+	})
+}
@@ -0,0 +1,178 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"strings"
+	"unsafe"
+)
+
+// varFrame is a special variable bound to the innermost procedure being executed while the backtrace is tracked or
+// current_prolog_flag(debug, on).
+var varFrame = NewVariable()
+
+// Frame is a procedure in the backtrace of an exception.
+type Frame struct {
+	// Indicator is the predicate indicator of the procedure e.g. foo/1.
+	Indicator Term
+
+	// Foreign tells if the procedure is a foreign predicate written in Go.
+	Foreign bool
+
+	// Go is the Go stack of the foreign predicate from the innermost function which called back into Prolog.
+	// It's empty if the foreign predicate raised the exception by itself or didn't call back into Prolog.
+	Go []runtime.Frame
+}
+
+// String returns a human-readable representation of the frame.
+func (f Frame) String() string {
+	var sb strings.Builder
+	_ = f.Indicator.WriteTerm(&sb, &defaultWriteOptions, nil)
+	if !f.Foreign {
+		return sb.String()
+	}
+	_, _ = sb.WriteString(" (go)")
+	for _, g := range f.Go {
+		_, _ = fmt.Fprintf(&sb, "\n\t%s\n\t\t%s:%d", g.Function, g.File, g.Line)
+	}
+	return sb.String()
+}
+
+// Term returns the Prolog representation of the frame i.e. PI for a Prolog procedure and
+// go(PI, [frame(Function, File, Line), ...]) for a foreign predicate.
+func (f Frame) Term() Term {
+	if !f.Foreign {
+		return f.Indicator
+	}
+	gs := make([]Term, len(f.Go))
+	for i, g := range f.Go {
+		gs[i] = atomFrame.Apply(NewAtom(g.Function), NewAtom(g.File), Integer(g.Line))
+	}
+	return atomGo.Apply(f.Indicator, List(gs...))
+}
+
+// backtrace is the chain of procedures from the innermost to the outermost at the point an exception was raised.
+type backtrace struct {
+	frames []Frame
+}
+
+// frame is a node of the chain of procedures being executed.
+type frame struct {
+	pi     procedureIndicator
+	args   []Term
+	entry  uintptr // The entry address of the foreign predicate. 0 for user-defined ones.
+	parent *frame
+}
+
+func frameOf(env *Env) *frame {
+	t, ok := env.lookup(varFrame)
+	if !ok {
+		return nil
+	}
+	f, _ := t.(*frame)
+	return f
+}
+
+// enter records the procedure in env if the backtrace is tracked or current_prolog_flag(debug, on).
+// The returned continuation restores the frame of the caller once the procedure exits.
+func (vm *VM) enter(pi procedureIndicator, p procedure, args []Term, k Cont, env *Env) (Cont, *Env) {
+	if !vm.TrackBacktrace && !vm.debug {
+		return k, env
+	}
+	parent := frameOf(env)
+	f := frame{pi: pi, args: args, parent: parent}
+	if _, ok := p.(*userDefined); !ok {
+		f.entry = reflect.ValueOf(p).Pointer()
+	}
+	return func(env *Env) *Promise {
+		return k(env.bind(varFrame, parent))
+	}, env.bind(varFrame, &f)
+}
+
+// backtraceOf returns the backtrace at env. It returns nil unless the backtrace is tracked.
+func backtraceOf(env *Env) *backtrace {
+	f := frameOf(env)
+	if f == nil {
+		return nil
+	}
+	var (
+		b      backtrace
+		stack  []runtime.Frame
+		traced bool
+	)
+	for ; f != nil; f = f.parent {
+		fr := Frame{Indicator: f.pi.Term(), Foreign: f.entry != 0}
+		if fr.Foreign {
+			if !traced {
+				stack, traced = goStack(), true
+			}
+			fr.Go = goFrames(stack, f.entry)
+		}
+		b.frames = append(b.frames, fr)
+	}
+	return &b
+}
+
+// goStack returns the current Go stack from the innermost.
+func goStack() []runtime.Frame {
+	pcs := make([]uintptr, 64)
+	for {
+		n := runtime.Callers(3, pcs)
+		if n < len(pcs) {
+			pcs = pcs[:n]
+			break
+		}
+		pcs = make([]uintptr, 2*len(pcs))
+	}
+	var gs []runtime.Frame
+	frames := runtime.CallersFrames(pcs)
+	for {
+		g, more := frames.Next()
+		gs = append(gs, g)
+		if !more {
+			return gs
+		}
+	}
+}
+
+// goFrames returns the Go frames of the foreign predicate at entry which called back into Prolog.
+// They're from the innermost caller of Promise.Force up to the predicate itself.
+func goFrames(gs []runtime.Frame, entry uintptr) []runtime.Frame {
+	start := -1
+	for i, g := range gs {
+		switch {
+		case g.Function == forceFunction:
+			start = i + 1
+		case g.Entry == entry:
+			if start < 0 {
+				return nil
+			}
+			return gs[start : i+1 : i+1]
+		}
+	}
+	return nil
+}
+
+var forceFunction = runtime.FuncForPC(reflect.ValueOf((*Promise).Force).Pointer()).Name()
+
+// WriteTerm outputs the frame to an io.Writer.
+func (f *frame) WriteTerm(w io.Writer, _ *WriteOptions, _ *Env) error {
+	_, err := fmt.Fprintf(w, "<frame>(%p)", f)
+	return err
+}
+
+// Compare compares the frame with a Term.
+func (f *frame) Compare(t Term, env *Env) int {
+	return CompareAtomic[*frame](f, t, func(f *frame, g *frame) int {
+		switch x, y := uintptr(unsafe.Pointer(f)), uintptr(unsafe.Pointer(g)); {
+		case x > y:
+			return 1
+		case x < y:
+			return -1
+		default:
+			return 0
+		}
+	}, env)
+}
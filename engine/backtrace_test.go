@@ -0,0 +1,134 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestException_Backtrace(t *testing.T) {
+	newVM := func() *VM {
+		var vm VM
+		vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+		vm.operators.define(1200, operatorSpecifierFX, atomIf)
+		vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+		vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+		vm.Register1(NewAtom("throw"), Throw)
+		vm.Register3(NewAtom("catch_with_backtrace"), CatchWithBacktrace)
+		vm.Register0(atomTrue, func(_ *VM, k Cont, env *Env) *Promise {
+			return k(env)
+		})
+
+		// callback/1 calls back into Prolog from Go and passes the exception through.
+		vm.Register1(NewAtom("callback"), func(vm *VM, goal Term, k Cont, env *Env) *Promise {
+			ok, err := Call(vm, goal, Success, env).Force(context.Background())
+			if err != nil {
+				return Error(err)
+			}
+			if !ok {
+				return Bool(false)
+			}
+			return k(env)
+		})
+
+		assert.NoError(t, vm.Compile(context.Background(), `
+p :- callback(q), true.
+q :- r, true.
+r :- throw(error(oops, ctx)).
+s(E) :- catch_with_backtrace(p, E, true).
+`))
+		return &vm
+	}
+
+	pi := func(name string, arity int) Term {
+		return atomSlash.Apply(NewAtom(name), Integer(arity))
+	}
+
+	t.Run("tracked", func(t *testing.T) {
+		vm := newVM()
+		vm.TrackBacktrace = true
+		_, err := vm.Arrive(NewAtom("p"), nil, Success, nil).Force(context.Background())
+		e, ok := err.(Exception)
+		assert.True(t, ok)
+		assert.Equal(t, atomError.Apply(NewAtom("oops"), NewAtom("ctx")), e.Term())
+
+		bt := e.Backtrace()
+		assert.Len(t, bt, 5)
+		for i, f := range []Frame{
+			{Indicator: pi("throw", 1), Foreign: true},
+			{Indicator: pi("r", 0)},
+			{Indicator: pi("q", 0)},
+			{Indicator: pi("callback", 1), Foreign: true},
+			{Indicator: pi("p", 0)},
+		} {
+			assert.Equal(t, f.Indicator, bt[i].Indicator)
+			assert.Equal(t, f.Foreign, bt[i].Foreign)
+		}
+
+		// Only the foreign predicate which called back into Prolog has its Go stack.
+		assert.Empty(t, bt[0].Go)
+		gs := bt[3].Go
+		assert.NotEmpty(t, gs)
+		assert.True(t, strings.HasPrefix(gs[len(gs)-1].Function, "github.com/ichiban/prolog/engine.TestException_Backtrace."))
+		assert.Contains(t, bt[3].String(), "callback/1 (go)")
+	})
+
+	t.Run("not tracked", func(t *testing.T) {
+		vm := newVM()
+		_, err := vm.Arrive(NewAtom("p"), nil, Success, nil).Force(context.Background())
+		e, ok := err.(Exception)
+		assert.True(t, ok)
+		assert.Nil(t, e.Backtrace())
+	})
+
+	t.Run("catch_with_backtrace", func(t *testing.T) {
+		vm := newVM()
+		vm.TrackBacktrace = true
+		e := NewVariable()
+		ok, err := vm.Arrive(NewAtom("s"), []Term{e}, func(env *Env) *Promise {
+			ball, ok := env.Resolve(e).(Compound)
+			assert.True(t, ok)
+			assert.Equal(t, atomError, ball.Functor())
+			assert.Equal(t, NewAtom("oops"), ball.Arg(0))
+			c, ok := ball.Arg(1).(Compound)
+			assert.True(t, ok)
+			assert.Equal(t, atomBacktrace, c.Functor())
+			assert.Equal(t, NewAtom("ctx"), c.Arg(0))
+
+			var frames []Term
+			iter := ListIterator{List: c.Arg(1)}
+			for iter.Next() {
+				frames = append(frames, iter.Current())
+			}
+			assert.Len(t, frames, 7)
+			assert.Equal(t, atomGo.Apply(pi("throw", 1), List()), frames[0])
+			assert.Equal(t, pi("r", 0), frames[1])
+			assert.Equal(t, pi("q", 0), frames[2])
+			assert.Equal(t, atomGo, frames[3].(Compound).Functor())
+			assert.Equal(t, pi("p", 0), frames[4])
+			assert.Equal(t, atomGo.Apply(pi("catch_with_backtrace", 3), List()), frames[5])
+			assert.Equal(t, pi("s", 1), frames[6])
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("frames are restored on exit", func(t *testing.T) {
+		vm := newVM()
+		vm.TrackBacktrace = true
+		assert.NoError(t, vm.Compile(context.Background(), `
+a :- b, throw(error(oops, ctx)).
+b.
+`))
+		_, err := vm.Arrive(NewAtom("a"), nil, Success, nil).Force(context.Background())
+		e, ok := err.(Exception)
+		assert.True(t, ok)
+		bt := e.Backtrace()
+		assert.Len(t, bt, 2)
+		assert.Equal(t, pi("throw", 1), bt[0].Indicator)
+		assert.Equal(t, pi("a", 0), bt[1].Indicator)
+	})
+}
@@ -21,9 +21,21 @@ func Repeat(_ *VM, k Cont, env *Env) *Promise {
 }
 
 // Negate calls goal and returns false if it succeeds. Otherwise, invokes the continuation.
+// While current_prolog_flag(floundering, warning), it warns if goal binds the variables which were unbound when it was
+// called.
 func Negate(vm *VM, goal Term, k Cont, env *Env) *Promise {
 	return Delay(func(ctx context.Context) *Promise {
-		ok, err := Call(vm, goal, Success, env).Force(ctx)
+		found := Success
+		if vm.floundering {
+			if free := env.freeVariables(goal); len(free) > 0 {
+				g := env.simplify(goal)
+				found = func(env *Env) *Promise {
+					vm.checkFloundering(ctx, g, free, env)
+					return Bool(true)
+				}
+			}
+		}
+		ok, err := Call(vm, goal, found, env).Force(ctx)
 		if err != nil {
 			return Error(err)
 		}
@@ -390,44 +402,96 @@ func CopyTerm(vm *VM, in, out Term, k Cont, env *Env) *Promise {
 }
 
 func renamedCopy(t Term, copied map[termID]Term, env *Env) (Term, error) {
-	if copied == nil {
-		copied = map[termID]Term{}
+	c := termCopier{copied: copied}
+	return c.copy(t, env)
+}
+
+// termCopier makes renamed copies of terms.
+// If arena is set, it allocates the copies in chunks so that copying a lot of small terms is cheap.
+type termCopier struct {
+	copied map[termID]Term
+	arena  bool
+
+	args      []Term
+	compounds []compound
+}
+
+const copierChunkSize = 1024
+
+// reset forgets the variables copied so far so that the next copy doesn't share them.
+func (c *termCopier) reset() {
+	for k := range c.copied {
+		delete(c.copied, k)
+	}
+}
+
+func (c *termCopier) makeArgs(n int) ([]Term, error) {
+	if !c.arena || n > copierChunkSize/32 {
+		return makeSlice(n)
+	}
+	if len(c.args) < n {
+		args, err := makeSlice(copierChunkSize)
+		if err != nil {
+			return nil, err
+		}
+		c.args = args
+	}
+	var args []Term
+	args, c.args = c.args[:n:n], c.args[n:]
+	return args, nil
+}
+
+func (c *termCopier) newCompound() *compound {
+	if !c.arena {
+		return &compound{}
+	}
+	if len(c.compounds) == 0 {
+		c.compounds = make([]compound, copierChunkSize/8)
+	}
+	var cp *compound
+	cp, c.compounds = &c.compounds[0], c.compounds[1:]
+	return cp
+}
+
+func (c *termCopier) copy(t Term, env *Env) (Term, error) {
+	if c.copied == nil {
+		c.copied = map[termID]Term{}
 	}
 	t = env.Resolve(t)
-	if c, ok := copied[id(t)]; ok {
-		return c, nil
+	if cp, ok := c.copied[id(t)]; ok {
+		return cp, nil
 	}
 	switch t := t.(type) {
 	case Variable:
 		v := NewVariable()
-		copied[id(t)] = v
+		c.copied[id(t)] = v
 		return v, nil
 	case charList, codeList:
 		return t, nil
 	case list:
-		s, err := makeSlice(len(t))
+		s, err := c.makeArgs(len(t))
 		if err != nil {
 			return nil, resourceError(resourceMemory, env)
 		}
 		l := list(s)
-		copied[id(t)] = l
+		c.copied[id(t)] = l
 		for i := range t {
-			c, err := renamedCopy(t[i], copied, env)
+			cp, err := c.copy(t[i], env)
 			if err != nil {
 				return nil, err
 			}
-			l[i] = c
+			l[i] = cp
 		}
 		return l, nil
 	case *partial:
 		var p partial
-		copied[id(t)] = &p
-		cp, err := renamedCopy(t.Compound, copied, env)
+		c.copied[id(t)] = &p
+		cp, err := c.copy(t.Compound, env)
 		if err != nil {
 			return nil, err
 		}
 		p.Compound = cp.(Compound)
-		cp, err = renamedCopy(*t.tail, copied, env)
+		cp, err = c.copy(*t.tail, env)
 		if err != nil {
 			return nil, err
 		}
@@ -435,23 +499,21 @@ func renamedCopy(t Term, copied map[termID]Term, env *Env) (Term, error) {
 		p.tail = &tail
 		return &p, nil
 	case Compound:
-		args, err := makeSlice(t.Arity())
+		args, err := c.makeArgs(t.Arity())
 		if err != nil {
 			return nil, resourceError(resourceMemory, env)
 		}
-		c := compound{
-			functor: t.Functor(),
-			args:    args,
-		}
-		copied[id(t)] = &c
+		cp := c.newCompound()
+		cp.functor, cp.args = t.Functor(), args
+		c.copied[id(t)] = cp
 		for i := 0; i < t.Arity(); i++ {
-			cp, err := renamedCopy(t.Arg(i), copied, env)
+			arg, err := c.copy(t.Arg(i), env)
 			if err != nil {
 				return nil, err
 			}
-			c.args[i] = cp
+			cp.args[i] = arg
 		}
-		return &c, nil
+		return cp, nil
 	default:
 		return t, nil
 	}
@@ -459,6 +521,23 @@ func renamedCopy(t Term, copied map[termID]Term, env *Env) (Term, error) {
 
 // TermVariables succeeds if vars unifies with a list of variables in term.
 func TermVariables(vm *VM, term, vars Term, k Cont, env *Env) *Promise {
+	ret, err := termVariables(term, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	iter := ListIterator{List: vars, Env: env, AllowPartial: true}
+	for iter.Next() {
+	}
+	if err := iter.Err(); err != nil {
+		return Error(err)
+	}
+
+	return Unify(vm, vars, List(ret...), k, env)
+}
+
+// termVariables returns the distinct variables in term in the depth-first, left-to-right order.
+func termVariables(term Term, env *Env) ([]Term, error) {
 	var (
 		witness  = map[Variable]struct{}{}
 		ret      []Term
@@ -476,7 +555,7 @@ func TermVariables(vm *VM, term, vars Term, k Cont, env *Env) *Promise {
 		case Compound:
 			args, err := makeSlice(t.Arity())
 			if err != nil {
-				return Error(resourceError(resourceMemory, env))
+				return nil, resourceError(resourceMemory, env)
 			}
 			for i := 0; i < t.Arity(); i++ {
 				args[i] = t.Arg(i)
@@ -484,15 +563,7 @@ func TermVariables(vm *VM, term, vars Term, k Cont, env *Env) *Promise {
 			traverse = append(args, traverse...)
 		}
 	}
-
-	iter := ListIterator{List: vars, Env: env, AllowPartial: true}
-	for iter.Next() {
-	}
-	if err := iter.Err(); err != nil {
-		return Error(err)
-	}
-
-	return Unify(vm, vars, List(ret...), k, env)
+	return ret, nil
 }
 
 var operatorSpecifiers = map[Atom]operatorSpecifier{
@@ -559,6 +630,7 @@ func Op(vm *VM, priority, specifier, op Term, k Cont, env *Env) *Promise {
 		}
 	}
 
+	persistAtoms(op, env)
 	for _, name := range names {
 		if class := spec.class(); vm.operators.definedInClass(name, spec.class()) {
 			vm.operators.remove(name, class)
@@ -669,9 +741,7 @@ func CurrentOp(vm *VM, priority, specifier, op Term, k Cont, env *Env) *Promise
 
 // Assertz appends t to the database.
 func Assertz(vm *VM, t Term, k Cont, env *Env) *Promise {
-	if err := assertMerge(vm, t, func(existing, new []clause) []clause {
-		return append(existing, new...)
-	}, env); err != nil {
+	if err := assertMerge(vm, t, nil, false, env); err != nil {
 		return Error(err)
 	}
 	return k(env)
@@ -679,15 +749,13 @@ func Assertz(vm *VM, t Term, k Cont, env *Env) *Promise {
 
 // Asserta prepends t to the database.
 func Asserta(vm *VM, t Term, k Cont, env *Env) *Promise {
-	if err := assertMerge(vm, t, func(existing, new []clause) []clause {
-		return append(new, existing...)
-	}, env); err != nil {
+	if err := assertMerge(vm, t, nil, true, env); err != nil {
 		return Error(err)
 	}
 	return k(env)
 }
 
-func assertMerge(vm *VM, t Term, merge func([]clause, []clause) []clause, env *Env) error {
+func assertMerge(vm *VM, t Term, ref *DBRef, front bool, env *Env) error {
 	pi, arg, err := piArg(t, env)
 	if err != nil {
 		return err
@@ -700,6 +768,10 @@ func assertMerge(vm *VM, t Term, merge func([]clause, []clause) []clause, env *E
 		}
 	}
 
+	db := vm.database()
+	db.Lock()
+	defer db.Unlock()
+
 	if vm.procedures == nil {
 		vm.procedures = map[procedureIndicator]procedure{}
 	}
@@ -713,13 +785,114 @@ func assertMerge(vm *VM, t Term, merge func([]clause, []clause) []clause, env *E
 	if err != nil {
 		return err
 	}
+	persistAtoms(t, env)
+	if ref != nil {
+		ref.pi = pi
+		for i := range added {
+			added[i].ref = ref
+		}
+	}
 
 	u, ok := p.(*userDefined)
 	if !ok || !u.dynamic {
 		return permissionError(operationModify, permissionTypeStaticProcedure, pi.Term(), env)
 	}
 
-	u.clauses = merge(u.clauses, added)
+	if vs := schemaViolations(u.schema, t, env); len(vs) > 0 {
+		return schemaError(vs, env)
+	}
+
+	if err := vm.allocClauses(len(added), added.size(), env); err != nil {
+		return err
+	}
+	if front {
+		u.clauses = append(added, u.clauses...)
+	} else {
+		u.clauses = append(u.clauses, added...)
+	}
+	u.generation++
+	u.addIndexes(added, front)
+	vm.invalidatePurity()
+	return nil
+}
+
+// AssertFacts appends the facts to the database in order just like assertz/1 for each of them. It's meant for loading
+// a large number of facts from Go: the clauses are allocated and indexed per procedure rather than per fact, and the
+// declared indexes are built as the facts are added instead of on the first call.
+// The facts which don't conform to the fact schemas are left out and reported by schema_error(Violations) at the end.
+func (vm *VM) AssertFacts(facts []Term) error {
+	db := vm.database()
+	db.Lock()
+	defer db.Unlock()
+
+	if vm.procedures == nil {
+		vm.procedures = map[procedureIndicator]procedure{}
+	}
+
+	type batch struct {
+		u     *userDefined
+		added clauses
+	}
+	var (
+		batches    = map[procedureIndicator]*batch{}
+		order      []*batch
+		violations []Term
+	)
+	for _, f := range facts {
+		pi, arg, err := piArg(f, nil)
+		if err != nil {
+			return err
+		}
+		if pi == (procedureIndicator{name: atomIf, arity: 2}) {
+			pi, _, err = piArg(arg(0), nil)
+			if err != nil {
+				return err
+			}
+		}
+
+		b, ok := batches[pi]
+		if !ok {
+			p, ok := vm.procedures[pi]
+			if !ok {
+				p = &userDefined{dynamic: true}
+				vm.procedures[pi] = p
+			}
+			u, ok := p.(*userDefined)
+			if !ok || !u.dynamic {
+				return permissionError(operationModify, permissionTypeStaticProcedure, pi.Term(), nil)
+			}
+			b = &batch{u: u}
+			batches[pi] = b
+			order = append(order, b)
+		}
+
+		if vs := schemaViolations(b.u.schema, f, nil); len(vs) > 0 {
+			violations = append(violations, vs...)
+			continue
+		}
+
+		cs, err := compile(f, nil)
+		if err != nil {
+			return err
+		}
+		persistAtoms(f, nil)
+		b.added = append(b.added, cs...)
+	}
+
+	for _, b := range order {
+		if err := vm.allocClauses(len(b.added), b.added.size(), nil); err != nil {
+			return err
+		}
+		b.u.clauses = append(b.u.clauses, b.added...)
+		b.u.generation++
+		b.u.addIndexes(b.added, false)
+		b.u.buildIndexes()
+	}
+	vm.invalidatePurity()
+
+	if len(violations) > 0 {
+		return schemaError(violations, nil)
+	}
 	return nil
 }
 
@@ -733,10 +906,19 @@ func BagOf(vm *VM, template, goal, instances Term, k Cont, env *Env) *Promise {
 // SetOf collects all the solutions of goal as instances, which unify with template. instances don't contain duplications.
 func SetOf(vm *VM, template, goal, instances Term, k Cont, env *Env) *Promise {
 	return collectionOf(vm, func(tList []Term, env *Env) Term {
-		return env.set(tList...)
+		// Once the bindings are applied, the copies can be sorted without looking up env.
+		for i := range tList {
+			tList[i] = env.simplify(tList[i])
+		}
+		return List(sortUnique(tList)...)
 	}, template, goal, instances, k, env)
 }
 
+// solutionGroup is a group of solutions of bagof/3 or setof/3 which witnesses are variants.
+type solutionGroup struct {
+	wList, tList []Term
+}
+
 func collectionOf(vm *VM, agg func([]Term, *Env) Term, template, goal, instances Term, k Cont, env *Env) *Promise {
 	fvs := newFreeVariablesSet(goal, template, env)
 	w, err := makeSlice(len(fvs))
@@ -763,37 +945,60 @@ func collectionOf(vm *VM, agg func([]Term, *Env) Term, template, goal, instances
 
 	return FindAll(vm, atomPlus.Apply(witness, template), g, s, func(env *Env) *Promise {
 		s, _ := slice(s, env)
-		ks := make([]func(context.Context) *Promise, 0, len(s))
-		for len(s) > 0 {
-			var wt Compound
-			wt, s = s[0].(Compound), s[1:]
-			w, t := wt.Arg(0), wt.Arg(1) // W+T
-			wList, tList := []Term{w}, []Term{t}
-			n := 0 // https://github.com/golang/go/wiki/SliceTricks#filter-in-place
-			for _, e := range s {
-				e := e.(Compound)
-				ww, tt := e.Arg(0), e.Arg(1) // WW+TT
-				if variant(ww, w, env) {
-					wList = append(wList, ww)
-					tList = append(tList, tt)
-				} else { // keep
-					s[n] = e
-					n++
-				}
+
+		// Group the solutions by the witnesses up to variants in the order of their first appearance.
+		var (
+			groups []*solutionGroup
+			table  VariantTable
+		)
+		for _, e := range s {
+			e := e.(Compound)
+			w, t := e.Arg(0), e.Arg(1) // W+T
+
+			var g *solutionGroup
+			if v, ok := table.Get(w, env); ok {
+				g = v.(*solutionGroup)
+			} else {
+				g = &solutionGroup{}
+				groups = append(groups, g)
+				table.Put(w, g, env)
 			}
-			s = s[:n]
-			ks = append(ks, func(context.Context) *Promise {
+			g.wList = append(g.wList, w)
+			g.tList = append(g.tList, t)
+		}
+
+		ks := make([]func(context.Context) *Promise, len(groups))
+		for i := range groups {
+			g := groups[i]
+			ks[i] = func(context.Context) *Promise {
 				env := env
-				for _, w = range wList {
+				for _, w := range g.wList {
 					env, _ = env.Unify(witness, w)
 				}
-				return Unify(vm, agg(tList, env), instances, k, env)
-			})
+				return Unify(vm, agg(g.tList, env), instances, k, env)
+			}
 		}
 		return Delay(ks...)
 	}, env)
 }
 
+// sortUnique sorts ts in the standard order and removes the duplicates in place.
+// ts must not contain bound variables since they're compared without env.
+func sortUnique(ts []Term) []Term {
+	sort.Slice(ts, func(i, j int) bool {
+		return ts[i].Compare(ts[j], nil) == -1
+	})
+	n := 0
+	for _, t := range ts {
+		if n > 0 && ts[n-1].Compare(t, nil) == 0 {
+			continue
+		}
+		ts[n] = t
+		n++
+	}
+	return ts[:n]
+}
+
 func variant(t1, t2 Term, env *Env) bool {
 	s := map[Variable]Variable{}
 	rest := [][2]Term{
@@ -858,12 +1063,14 @@ func FindAll(vm *VM, template, goal, instances Term, k Cont, env *Env) *Promise
 	}
 	return Delay(func(ctx context.Context) *Promise {
 		var answers []Term
+		c := termCopier{arena: true}
 		if _, err := Call(vm, goal, func(env *Env) *Promise {
-			c, err := renamedCopy(template, nil, env)
+			c.reset()
+			t, err := c.copy(template, env)
 			if err != nil {
 				return Error(err)
 			}
-			answers = append(answers, c)
+			answers = append(answers, t)
 			return Bool(false) // ask for more solutions
 		}, env).Force(ctx); err != nil {
 			return Error(err)
@@ -1018,6 +1225,105 @@ func KeySort(vm *VM, pairs, sorted Term, k Cont, env *Env) *Promise {
 	return Unify(vm, sorted, List(elems...), k, env)
 }
 
+// MSort succeeds if sorted is a sorted list of elements of list. Unlike sort/2, it doesn't remove duplicates.
+func MSort(vm *VM, list, sorted Term, k Cont, env *Env) *Promise {
+	return Sort4(vm, Integer(0), atomAtLessOrEqual, list, sorted, k, env)
+}
+
+// Sort4 succeeds if sorted is a list of elements of list sorted by the key-th arguments in order.
+// If key is 0, the elements themselves are compared. order is one of @<, @=<, @>, and @>=.
+// @< and @> remove the elements with duplicated keys while @=< and @>= keep them in the original order.
+func Sort4(vm *VM, key, order, list, sorted Term, k Cont, env *Env) *Promise {
+	var n int
+	switch key := env.Resolve(key).(type) {
+	case Variable:
+		return Error(InstantiationError(env))
+	case Integer:
+		if key < 0 {
+			return Error(domainError(validDomainNotLessThanZero, key, env))
+		}
+		n = int(key)
+	default:
+		return Error(typeError(validTypeInteger, key, env))
+	}
+
+	var desc, dedup bool
+	switch o := env.Resolve(order).(type) {
+	case Variable:
+		return Error(InstantiationError(env))
+	case Atom:
+		switch o {
+		case atomAtLessThan:
+			dedup = true
+		case atomAtLessOrEqual:
+			break
+		case atomAtGreaterThan:
+			desc, dedup = true, true
+		case atomAtGreaterOrEqual:
+			desc = true
+		default:
+			return Error(domainError(validDomainOrder, o, env))
+		}
+	default:
+		return Error(typeError(validTypeAtom, o, env))
+	}
+
+	var elems, keys []Term
+	iter := ListIterator{List: list, Env: env}
+	for iter.Next() {
+		e := env.Resolve(iter.Current())
+		elems = append(elems, e)
+		if n == 0 {
+			keys = append(keys, e)
+			continue
+		}
+		switch c := e.(type) {
+		case Variable:
+			return Error(InstantiationError(env))
+		case Compound:
+			if c.Arity() < n {
+				return Error(typeError(validTypeCompound, c, env))
+			}
+			keys = append(keys, c.Arg(n-1))
+		default:
+			return Error(typeError(validTypeCompound, c, env))
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return Error(err)
+	}
+
+	iter = ListIterator{List: sorted, Env: env, AllowPartial: true}
+	for iter.Next() {
+	}
+	if err := iter.Err(); err != nil {
+		return Error(err)
+	}
+
+	// Sort the indices so that the elements and the keys move together.
+	idx := make([]int, len(elems))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		o := keys[idx[i]].Compare(keys[idx[j]], env)
+		if desc {
+			return o == 1
+		}
+		return o == -1
+	})
+
+	ret := make([]Term, 0, len(elems))
+	for i, j := range idx {
+		if dedup && i > 0 && keys[j].Compare(keys[idx[i-1]], env) == 0 {
+			continue
+		}
+		ret = append(ret, elems[j])
+	}
+
+	return Unify(vm, sorted, List(ret...), k, env)
+}
+
 // Throw throws ball as an exception.
 func Throw(_ *VM, ball Term, _ Cont, env *Env) *Promise {
 	switch b := env.Resolve(ball).(type) {
@@ -1030,13 +1336,34 @@ func Throw(_ *VM, ball Term, _ Cont, env *Env) *Promise {
 
 // Catch calls goal. If an exception is thrown and unifies with catcher, it calls recover.
 func Catch(vm *VM, goal, catcher, recover Term, k Cont, env *Env) *Promise {
+	return catchBall(vm, goal, catcher, recover, Exception.Term, k, env)
+}
+
+// CatchWithBacktrace is like Catch but an exception error(Formal, Context) comes with its backtrace as
+// error(Formal, backtrace(Context, Frames)) if it's tracked. See VM.TrackBacktrace and Frame.Term.
+func CatchWithBacktrace(vm *VM, goal, catcher, recover Term, k Cont, env *Env) *Promise {
+	return catchBall(vm, goal, catcher, recover, func(e Exception) Term {
+		c, ok := e.term.(Compound)
+		if e.backtrace == nil || !ok || c.Functor() != atomError || c.Arity() != 2 {
+			return e.term
+		}
+		frames := make([]Term, len(e.backtrace.frames))
+		for i, f := range e.backtrace.frames {
+			frames[i] = f.Term()
+		}
+		return atomError.Apply(c.Arg(0), atomBacktrace.Apply(c.Arg(1), List(frames...)))
+	}, k, env)
+}
+
+// catchBall calls goal. If an exception is thrown and its ball unifies with catcher, it calls recover.
+func catchBall(vm *VM, goal, catcher, recover Term, ball func(Exception) Term, k Cont, env *Env) *Promise {
 	return catch(func(err error) *Promise {
 		e, ok := err.(Exception)
 		if !ok {
 			e = Exception{term: atomError.Apply(NewAtom("system_error"), NewAtom(err.Error()))}
 		}
 
-		env, ok := env.Unify(catcher, e.term)
+		env, ok := env.Unify(catcher, ball(e))
 		if !ok {
 			return nil
 		}
@@ -1047,6 +1374,42 @@ func Catch(vm *VM, goal, catcher, recover Term, k Cont, env *Env) *Promise {
 	})
 }
 
+// SetupCallCleanup calls setup once, and then goal. cleanup is called once when goal is over.
+// It's either when goal succeeds without choice points, fails, raises an exception, is cut, or is abandoned e.g. by
+// closing the solutions or cancelling the context. The result and the exception of cleanup are ignored.
+// cleanup sees the bindings of the last solution of goal unless goal failed.
+func SetupCallCleanup(vm *VM, setup, goal, cleanup Term, k Cont, env *Env) *Promise {
+	return Delay(func(ctx context.Context) *Promise {
+		var setupEnv *Env
+		ok, err := Call(vm, setup, func(env *Env) *Promise {
+			setupEnv = env
+			return Bool(true)
+		}, env).Force(ctx)
+		if err != nil {
+			return Error(err)
+		}
+		if !ok {
+			return Bool(false)
+		}
+
+		exitEnv := setupEnv
+		return withCleanup(func(ctx context.Context, failed bool) {
+			env := exitEnv
+			if failed {
+				env = setupEnv
+			}
+			_, _ = Call(vm, cleanup, Success, env).Force(ctx)
+		}, func(frame *Promise) *Promise {
+			return Call(vm, goal, func(env *Env) *Promise {
+				exitEnv = env
+				return exited(frame, func(context.Context) *Promise {
+					return k(env)
+				})
+			}, setupEnv)
+		})
+	})
+}
+
 // CurrentPredicate matches pi with a predicate indicator of the user-defined procedures in the database.
 func CurrentPredicate(vm *VM, pi Term, k Cont, env *Env) *Promise {
 	switch pi := env.Resolve(pi).(type) {
@@ -1081,6 +1444,97 @@ func CurrentPredicate(vm *VM, pi Term, k Cont, env *Env) *Promise {
 	return Delay(ks...)
 }
 
+// PredicateProperty succeeds iff the procedure of head has property. The properties are built_in, dynamic, static,
+// multifile, discontiguous, defined, number_of_clauses(N), and pure. See VM.IsPure for pure.
+func PredicateProperty(vm *VM, head, property Term, k Cont, env *Env) *Promise {
+	var pis []procedureIndicator
+	switch h := env.Resolve(head).(type) {
+	case Variable:
+		for pi := range vm.procedures {
+			pis = append(pis, pi)
+		}
+	case Atom:
+		pis = append(pis, procedureIndicator{name: h, arity: 0})
+	case Compound:
+		pis = append(pis, procedureIndicator{name: h.Functor(), arity: Integer(h.Arity())})
+	default:
+		return Error(typeError(validTypeCallable, head, env))
+	}
+
+	switch p := env.Resolve(property).(type) {
+	case Variable:
+		break
+	case Atom:
+		switch p {
+		case atomBuiltIn, atomDynamic, atomStatic, atomMultifile, atomDiscontiguous, atomDefined, atomPure:
+			break
+		default:
+			return Error(domainError(validDomainPredicateProperty, property, env))
+		}
+	case Compound:
+		if p.Functor() != atomNumberOfClauses || p.Arity() != 1 {
+			return Error(domainError(validDomainPredicateProperty, property, env))
+		}
+	default:
+		return Error(domainError(validDomainPredicateProperty, property, env))
+	}
+
+	var ks []func(context.Context) *Promise
+	for _, pi := range pis {
+		pi := pi
+		p, ok := vm.procedures[pi]
+		if !ok {
+			continue
+		}
+		ks = append(ks, func(context.Context) *Promise {
+			args := make([]Term, pi.arity)
+			for i := range args {
+				args[i] = NewVariable()
+			}
+			return Unify(vm, head, pi.name.Apply(args...), func(env *Env) *Promise {
+				props := []Term{atomDefined}
+				switch p := p.(type) {
+				case *userDefined:
+					if p.dynamic {
+						props = append(props, atomDynamic)
+					} else {
+						props = append(props, atomStatic)
+					}
+					if p.multifile {
+						props = append(props, atomMultifile)
+					}
+					if p.discontiguous {
+						props = append(props, atomDiscontiguous)
+					}
+					props = append(props, atomNumberOfClauses.Apply(Integer(len(p.clauses))))
+				default:
+					props = append(props, atomBuiltIn, atomStatic)
+				}
+				// The analysis traverses the program. Do it only when it's asked for.
+				var asked bool
+				switch prop := env.Resolve(property).(type) {
+				case Variable:
+					asked = true
+				case Atom:
+					asked = prop == atomPure
+				}
+				if asked && vm.IsPure(pi.name, int(pi.arity)) {
+					props = append(props, atomPure)
+				}
+				ks := make([]func(context.Context) *Promise, len(props))
+				for i := range props {
+					prop := props[i]
+					ks[i] = func(context.Context) *Promise {
+						return Unify(vm, property, prop, k, env)
+					}
+				}
+				return Delay(ks...)
+			}, env)
+		})
+	}
+	return Delay(ks...)
+}
+
 // Retract removes the first clause that matches with t.
 func Retract(vm *VM, t Term, k Cont, env *Env) *Promise {
 	t = rulify(t, env)
@@ -1108,9 +1562,17 @@ func Retract(vm *VM, t Term, k Cont, env *Env) *Promise {
 		raw := rulify(c.raw, env)
 		ks[i] = func(_ context.Context) *Promise {
 			return Unify(vm, t, raw, func(env *Env) *Promise {
+				db := vm.database()
+				db.Lock()
 				j := i - deleted
-				u.clauses, u.clauses[len(u.clauses)-1] = append(u.clauses[:j], u.clauses[j+1:]...), clause{}
+				removed := clauses{u.clauses[j]}
+				vm.freeClauses(removed)
+				u.clauses = append(u.clauses[:j:j], u.clauses[j+1:]...) // Copy on write. The callers may be iterating u.clauses.
+				u.generation++
+				u.removeIndexes(removed)
+				vm.invalidatePurity()
 				deleted++
+				db.Unlock()
 				return k(env)
 			}, env)
 		}
@@ -1142,10 +1604,17 @@ func Abolish(vm *VM, pi Term, k Cont, env *Env) *Promise {
 					return Error(domainError(validDomainNotLessThanZero, arity, env))
 				}
 				key := procedureIndicator{name: name, arity: arity}
-				if u, ok := vm.procedures[key].(*userDefined); !ok || !u.dynamic {
+				db := vm.database()
+				db.Lock()
+				u, ok := vm.procedures[key].(*userDefined)
+				if !ok || !u.dynamic {
+					db.Unlock()
 					return Error(permissionError(operationModify, permissionTypeStaticProcedure, key.Term(), env))
 				}
+				vm.freeClauses(u.clauses)
 				delete(vm.procedures, key)
+				vm.invalidatePurity()
+				db.Unlock()
 				return k(env)
 			default:
 				return Error(typeError(validTypeInteger, arity, env))
@@ -1219,6 +1688,9 @@ func stream(vm *VM, streamOrAlias Term, env *Env) (*Stream, error) {
 		}
 		return v, nil
 	case *Stream:
+		if s.closed {
+			return nil, existenceError(objectTypeStream, streamOrAlias, env)
+		}
 		return s, nil
 	default:
 		return nil, domainError(validDomainStreamOrAlias, streamOrAlias, env)
@@ -1325,6 +1797,7 @@ func handleStreamOptionAlias(vm *VM, s *Stream, o Compound, env *Env) error {
 		if _, ok := vm.streams.lookup(a); ok {
 			return permissionError(operationOpen, permissionTypeSourceSink, o, env)
 		}
+		persistAtoms(a, env)
 		s.alias = a
 		vm.streams.add(s)
 		return nil
@@ -1401,38 +1874,53 @@ func Close(vm *VM, streamOrAlias, options Term, k Cont, env *Env) *Promise {
 		case Variable:
 			return Error(InstantiationError(env))
 		case Compound:
-			switch option.Functor() {
-			case atomForce:
-				if option.Arity() != 1 {
-					return Error(domainError(validDomainStreamOption, option, env))
-				}
-
+			if option.Functor() == atomForce && option.Arity() == 1 {
 				switch v := env.Resolve(option.Arg(0)).(type) {
+				case Variable:
+					return Error(InstantiationError(env))
 				case Atom:
 					switch v {
 					case atomFalse:
 						force = false
+						continue
 					case atomTrue:
 						force = true
-					default:
-						return Error(domainError(validDomainStreamOption, option, env))
+						continue
 					}
-				default:
-					return Error(domainError(validDomainStreamOption, option, env))
 				}
 			}
+			return Error(domainError(validDomainCloseOption, option, env))
 		default:
-			return Error(domainError(validDomainStreamOption, option, env))
+			return Error(domainError(validDomainCloseOption, option, env))
 		}
 	}
 	if err := iter.Err(); err != nil {
 		return Error(err)
 	}
 
+	// 8.11.6.1 a) Closing the standard streams has no effect.
+	if s.alias == atomUserInput || s.alias == atomUserOutput {
+		return k(env)
+	}
+
+	// A stream inherited from another VM e.g. by Fork belongs to the VM. So we just forget it.
+	if s.vm != nil && s.vm != vm {
+		vm.streams.remove(s)
+		return k(env)
+	}
+
 	if err := s.Close(); err != nil && !force {
 		return Error(err)
 	}
 
+	// 8.11.6.1 d, e) The current streams go back to the standard ones.
+	if vm.input == s {
+		vm.input, _ = vm.streams.lookup(atomUserInput)
+	}
+	if vm.output == s {
+		vm.output, _ = vm.streams.lookup(atomUserOutput)
+	}
+
 	return k(env)
 }
 
@@ -1733,6 +2221,7 @@ func ReadTerm(vm *VM, streamOrAlias, out, options Term, k Cont, env *Env) *Promi
 	}
 
 	p := NewParser(vm, s)
+	p.atomScope = atomScopeOf(env)
 	defer func() {
 		_ = s.UnreadRune()
 	}()
@@ -1753,13 +2242,19 @@ func ReadTerm(vm *VM, streamOrAlias, out, options Term, k Cont, env *Env) *Promi
 		return Error(syntaxError(err, env))
 	}
 
-	var singletons, variables, variableNames []Term
+	// Unlike the others, variables include anonymous ones.
+	variables, err := termVariables(t, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	var singletons, variableNames []Term
 	for _, v := range p.Vars {
+		pair := atomEqual.Apply(v.Name, v.Variable)
 		if v.Count == 1 {
-			singletons = append(singletons, v.Variable)
+			singletons = append(singletons, pair)
 		}
-		variables = append(variables, v.Variable)
-		variableNames = append(variableNames, atomEqual.Apply(v.Name, v.Variable))
+		variableNames = append(variableNames, pair)
 	}
 
 	return Unify(vm, tuple(
@@ -1846,7 +2341,7 @@ func GetChar(vm *VM, streamOrAlias, char Term, k Cont, env *Env) *Promise {
 	case Variable:
 		break
 	case Atom:
-		if len([]rune(c.String())) != 1 {
+		if c != atomEndOfFile && len([]rune(c.String())) != 1 {
 			return Error(typeError(validTypeInCharacter, char, env))
 		}
 	default:
@@ -1922,7 +2417,7 @@ func PeekChar(vm *VM, streamOrAlias, char Term, k Cont, env *Env) *Promise {
 	case Variable:
 		break
 	case Atom:
-		if len([]rune(c.String())) != 1 {
+		if c != atomEndOfFile && len([]rune(c.String())) != 1 {
 			return Error(typeError(validTypeInCharacter, char, env))
 		}
 	default:
@@ -2053,7 +2548,7 @@ func AtomConcat(vm *VM, atom1, atom2, atom3 Term, k Cont, env *Env) *Promise {
 				return Error(InstantiationError(env))
 			case Atom:
 				return Delay(func(context.Context) *Promise {
-					return Unify(vm, a3, NewAtom(a1.String()+a2.String()), k, env)
+					return Unify(vm, a3, newAtom(a1.String()+a2.String(), env), k, env)
 				})
 			default:
 				return Error(typeError(validTypeAtom, atom2, env))
@@ -2082,7 +2577,7 @@ func AtomConcat(vm *VM, atom1, atom2, atom3 Term, k Cont, env *Env) *Promise {
 		for i := range s {
 			a1, a2 := s[:i], s[i:]
 			ks = append(ks, func(context.Context) *Promise {
-				return Unify(vm, pattern, tuple(NewAtom(a1), NewAtom(a2)), k, env)
+				return Unify(vm, pattern, tuple(newAtom(a1, env), newAtom(a2, env)), k, env)
 			})
 		}
 		ks = append(ks, func(context.Context) *Promise {
@@ -2100,8 +2595,6 @@ func SubAtom(vm *VM, atom, before, length, after, subAtom Term, k Cont, env *Env
 	case Variable:
 		return Error(InstantiationError(env))
 	case Atom:
-		rs := []rune(whole.String())
-
 		if err := checkPositiveInteger(before, env); err != nil {
 			return Error(err)
 		}
@@ -2114,29 +2607,154 @@ func SubAtom(vm *VM, atom, before, length, after, subAtom Term, k Cont, env *Env
 			return Error(err)
 		}
 
-		switch env.Resolve(subAtom).(type) {
-		case Variable, Atom:
+		s := newRuneIndex(whole.String())
+		pattern := tuple(before, length, after, subAtom)
+		switch sub := env.Resolve(subAtom).(type) {
+		case Variable:
 			break
+		case Atom:
+			if b, ok := env.Resolve(before).(Integer); ok {
+				if b > s.len() || !strings.HasPrefix(s.s[s.offset(int(b)):], sub.String()) {
+					return Bool(false)
+				}
+				l := Integer(utf8.RuneCountInString(sub.String()))
+				return Unify(vm, pattern, tuple(b, l, s.len()-b-l, sub), k, env)
+			}
+			return subAtomSearch(vm, s, sub.String(), 0, pattern, k, env)
 		default:
 			return Error(typeError(validTypeAtom, subAtom, env))
 		}
 
-		pattern := tuple(before, length, after, subAtom)
-		var ks []func(context.Context) *Promise
-		for i := 0; i <= len(rs); i++ {
-			for j := i; j <= len(rs); j++ {
-				before, length, after, subAtom := Integer(i), Integer(j-i), Integer(len(rs)-j), NewAtom(string(rs[i:j]))
-				ks = append(ks, func(context.Context) *Promise {
-					return Unify(vm, pattern, tuple(before, length, after, subAtom), k, env)
-				})
+		// Narrow down the candidates with the known integers so that we don't enumerate what can't unify.
+		n := s.len()
+		b, bOK := env.Resolve(before).(Integer)
+		l, lOK := env.Resolve(length).(Integer)
+		a, aOK := env.Resolve(after).(Integer)
+		lo, hi := Integer(0), n
+		switch {
+		case bOK:
+			lo, hi = b, b
+		case lOK && aOK:
+			lo, hi = n-l-a, n-l-a
+		case lOK:
+			hi = n - l
+		case aOK:
+			hi = n - a
+		}
+		lengths := func(b Integer) (Integer, Integer) {
+			switch {
+			case lOK:
+				return l, l
+			case aOK:
+				return n - b - a, n - b - a
+			default:
+				return 0, n - b
 			}
 		}
-		return Delay(ks...)
+		return subAtomRange(vm, s, lo, hi, lengths, pattern, k, env)
 	default:
 		return Error(typeError(validTypeAtom, atom, env))
 	}
 }
 
+// subAtomRange enumerates the substrings of s which start from lo to hi and have the lengths given by lengths.
+// Each candidate is made into an atom only when it's about to be unified.
+func subAtomRange(vm *VM, s runeIndex, lo, hi Integer, lengths func(Integer) (Integer, Integer), pattern Term, k Cont, env *Env) *Promise {
+	n := s.len()
+	if lo < 0 {
+		lo = 0
+	}
+	for ; lo <= hi && lo <= n; lo++ {
+		l, lMax := lengths(lo)
+		if l < 0 {
+			l = 0
+		}
+		if lMax > n-lo {
+			lMax = n - lo
+		}
+		if l <= lMax {
+			return subAtomLengths(vm, s, lo, hi, l, lMax, lengths, pattern, k, env)
+		}
+	}
+	return Bool(false)
+}
+
+func subAtomLengths(vm *VM, s runeIndex, b, hi, l, lMax Integer, lengths func(Integer) (Integer, Integer), pattern Term, k Cont, env *Env) *Promise {
+	return Delay(func(context.Context) *Promise {
+		sub := newAtom(s.slice(int(b), int(b+l)), env)
+		return Unify(vm, pattern, tuple(b, l, s.len()-b-l, sub), k, env)
+	}, func(context.Context) *Promise {
+		if l < lMax {
+			return subAtomLengths(vm, s, b, hi, l+1, lMax, lengths, pattern, k, env)
+		}
+		return subAtomRange(vm, s, b+1, hi, lengths, pattern, k, env)
+	})
+}
+
+// subAtomSearch enumerates the occurrences of sub in s from the byte offset off.
+func subAtomSearch(vm *VM, s runeIndex, sub string, off int, pattern Term, k Cont, env *Env) *Promise {
+	i := strings.Index(s.s[off:], sub)
+	if i < 0 {
+		return Bool(false)
+	}
+	i += off
+	b, l := s.runePos(i), Integer(utf8.RuneCountInString(sub))
+	return Delay(func(context.Context) *Promise {
+		return Unify(vm, pattern, tuple(b, l, s.len()-b-l, newAtom(sub, env)), k, env)
+	}, func(context.Context) *Promise {
+		// Occurrences may overlap. Resume right after the first character of this one.
+		if i == len(s.s) {
+			return Bool(false)
+		}
+		_, size := utf8.DecodeRuneInString(s.s[i:])
+		return subAtomSearch(vm, s, sub, i+size, pattern, k, env)
+	})
+}
+
+// runeIndex converts between the character positions and the byte offsets of a string.
+type runeIndex struct {
+	s       string
+	offsets []int // The byte offsets of the characters followed by len(s). nil if s is ASCII only.
+}
+
+func newRuneIndex(s string) runeIndex {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			offsets := make([]int, 0, utf8.RuneCountInString(s)+1)
+			for j := range s {
+				offsets = append(offsets, j)
+			}
+			return runeIndex{s: s, offsets: append(offsets, len(s))}
+		}
+	}
+	return runeIndex{s: s}
+}
+
+func (r runeIndex) len() Integer {
+	if r.offsets == nil {
+		return Integer(len(r.s))
+	}
+	return Integer(len(r.offsets) - 1)
+}
+
+func (r runeIndex) slice(i, j int) string {
+	return r.s[r.offset(i):r.offset(j)]
+}
+
+func (r runeIndex) offset(i int) int {
+	if r.offsets == nil {
+		return i
+	}
+	return r.offsets[i]
+}
+
+func (r runeIndex) runePos(off int) Integer {
+	if r.offsets == nil {
+		return Integer(off)
+	}
+	return Integer(sort.SearchInts(r.offsets, off))
+}
+
 func checkPositiveInteger(n Term, env *Env) error {
 	switch b := env.Resolve(n).(type) {
 	case Variable:
@@ -2174,7 +2792,7 @@ func AtomChars(vm *VM, atom, chars Term, k Cont, env *Env) *Promise {
 		if err := iter.Err(); err != nil {
 			return Error(err)
 		}
-		return Unify(vm, atom, NewAtom(sb.String()), k, env)
+		return Unify(vm, atom, newAtom(sb.String(), env), k, env)
 	case Atom:
 		iter := ListIterator{List: chars, Env: env, AllowPartial: true}
 		for iter.Next() {
@@ -2226,7 +2844,7 @@ func AtomCodes(vm *VM, atom, codes Term, k Cont, env *Env) *Promise {
 		if err := iter.Err(); err != nil {
 			return Error(err)
 		}
-		return Unify(vm, atom, NewAtom(sb.String()), k, env)
+		return Unify(vm, atom, newAtom(sb.String(), env), k, env)
 	case Atom:
 		iter := ListIterator{List: codes, Env: env, AllowPartial: true}
 		for iter.Next() {
@@ -2429,6 +3047,9 @@ func StreamProperty(vm *VM, stream, property Term, k Cont, env *Env) *Promise {
 			streams = append(streams, v)
 		}
 	case *Stream:
+		if s.closed {
+			return Error(existenceError(objectTypeStream, stream, env))
+		}
 		streams = append(streams, s)
 	default:
 		return Error(domainError(validDomainStream, stream, env))
@@ -2492,6 +3113,19 @@ func isInteger(t Term, env *Env) bool {
 	}
 }
 
+// AtEndOfStream succeeds iff the stream represented by streamOrAlias is at or past the end of stream.
+func AtEndOfStream(vm *VM, streamOrAlias Term, k Cont, env *Env) *Promise {
+	s, err := stream(vm, streamOrAlias, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	if s.endOfStream == endOfStreamNot {
+		return Bool(false)
+	}
+	return k(env)
+}
+
 // SetStreamPosition sets the position property of the stream represented by streamOrAlias.
 func SetStreamPosition(vm *VM, streamOrAlias, position Term, k Cont, env *Env) *Promise {
 	s, err := stream(vm, streamOrAlias, env)
@@ -2512,7 +3146,7 @@ func SetStreamPosition(vm *VM, streamOrAlias, position Term, k Cont, env *Env) *
 			return Error(err)
 		}
 	default:
-		return Error(typeError(validTypeInteger, position, env))
+		return Error(domainError(validDomainStreamPosition, position, env))
 	}
 }
 
@@ -2621,6 +3255,14 @@ func SetPrologFlag(vm *VM, flag, value Term, k Cont, env *Env) *Promise {
 			modify = modifyUnknown
 		case atomDoubleQuotes:
 			modify = modifyDoubleQuotes
+		case atomDialect:
+			modify = modifyDialect
+		case atomFloundering:
+			modify = modifyFloundering
+		case atomEncoding:
+			modify = modifyEncoding
+		case atomLoopCheck:
+			modify = modifyLoopCheck
 		default:
 			return Error(domainError(validDomainPrologFlag, f, env))
 		}
@@ -2687,6 +3329,8 @@ func modifyDoubleQuotes(vm *VM, value Atom) error {
 		vm.doubleQuotes = doubleQuotesChars
 	case atomAtom:
 		vm.doubleQuotes = doubleQuotesAtom
+	case atomString:
+		vm.doubleQuotes = doubleQuotesString
 	default:
 		return domainError(validDomainFlagValue, atomPlus.Apply(atomDoubleQuotes, value), nil)
 	}
@@ -2700,7 +3344,7 @@ func CurrentPrologFlag(vm *VM, flag, value Term, k Cont, env *Env) *Promise {
 		break
 	case Atom:
 		switch f {
-		case atomBounded, atomMaxInteger, atomMinInteger, atomIntegerRoundingFunction, atomCharConversion, atomDebug, atomMaxArity, atomUnknown, atomDoubleQuotes:
+		case atomBounded, atomMaxInteger, atomMinInteger, atomIntegerRoundingFunction, atomCharConversion, atomDebug, atomMaxArity, atomUnknown, atomDoubleQuotes, atomDialect, atomFloundering, atomEncoding, atomLoopCheck:
 			break
 		default:
 			return Error(domainError(validDomainPrologFlag, f, env))
@@ -2720,6 +3364,10 @@ func CurrentPrologFlag(vm *VM, flag, value Term, k Cont, env *Env) *Promise {
 		tuple(atomMaxArity, atomUnbounded),
 		tuple(atomUnknown, NewAtom(vm.unknown.String())),
 		tuple(atomDoubleQuotes, NewAtom(vm.doubleQuotes.String())),
+		tuple(atomDialect, NewAtom(vm.dialect.String())),
+		tuple(atomFloundering, flounderingFlag(vm.floundering)),
+		tuple(atomEncoding, NewAtom(vm.encoding.String())),
+		tuple(atomLoopCheck, loopCheckFlag(vm.loopCheck)),
 	}
 	ks := make([]func(context.Context) *Promise, len(flags))
 	for i := range flags {
@@ -2731,6 +3379,20 @@ func CurrentPrologFlag(vm *VM, flag, value Term, k Cont, env *Env) *Promise {
 	return Delay(ks...)
 }
 
+// modifiableFlags returns the pairs of the flags which set_prolog_flag/2 can modify and their values.
+func (vm *VM) modifiableFlags() [][2]Term {
+	return [][2]Term{
+		{atomCharConversion, onOff(vm.charConvEnabled)},
+		{atomDebug, onOff(vm.debug)},
+		{atomUnknown, NewAtom(vm.unknown.String())},
+		{atomDoubleQuotes, NewAtom(vm.doubleQuotes.String())},
+		{atomDialect, NewAtom(vm.dialect.String())},
+		{atomFloundering, flounderingFlag(vm.floundering)},
+		{atomEncoding, NewAtom(vm.encoding.String())},
+		{atomLoopCheck, loopCheckFlag(vm.loopCheck)},
+	}
+}
+
 func onOff(b bool) Atom {
 	if b {
 		return atomOn
@@ -3006,3 +3668,109 @@ func appendLists(vm *VM, xs, ys, zs Term, k Cont, env *Env) *Promise {
 		}, env)
 	})
 }
+
+// MapList1 succeeds iff closure succeeds for the elements of list1.
+func MapList1(vm *VM, closure, list1 Term, k Cont, env *Env) *Promise {
+	return foldLists(vm, closure, []Term{list1}, nil, nil, k, env)
+}
+
+// MapList2 succeeds iff closure succeeds for the corresponding elements of list1 and list2.
+func MapList2(vm *VM, closure, list1, list2 Term, k Cont, env *Env) *Promise {
+	return foldLists(vm, closure, []Term{list1, list2}, nil, nil, k, env)
+}
+
+// MapList3 succeeds iff closure succeeds for the corresponding elements of the lists.
+func MapList3(vm *VM, closure, list1, list2, list3 Term, k Cont, env *Env) *Promise {
+	return foldLists(vm, closure, []Term{list1, list2, list3}, nil, nil, k, env)
+}
+
+// MapList4 succeeds iff closure succeeds for the corresponding elements of the lists.
+func MapList4(vm *VM, closure, list1, list2, list3, list4 Term, k Cont, env *Env) *Promise {
+	return foldLists(vm, closure, []Term{list1, list2, list3, list4}, nil, nil, k, env)
+}
+
+// MapList5 succeeds iff closure succeeds for the corresponding elements of the lists.
+func MapList5(vm *VM, closure, list1, list2, list3, list4, list5 Term, k Cont, env *Env) *Promise {
+	return foldLists(vm, closure, []Term{list1, list2, list3, list4, list5}, nil, nil, k, env)
+}
+
+// MapList6 succeeds iff closure succeeds for the corresponding elements of the lists.
+func MapList6(vm *VM, closure, list1, list2, list3, list4, list5, list6 Term, k Cont, env *Env) *Promise {
+	return foldLists(vm, closure, []Term{list1, list2, list3, list4, list5, list6}, nil, nil, k, env)
+}
+
+// MapList7 succeeds iff closure succeeds for the corresponding elements of the lists.
+func MapList7(vm *VM, closure, list1, list2, list3, list4, list5, list6, list7 Term, k Cont, env *Env) *Promise {
+	return foldLists(vm, closure, []Term{list1, list2, list3, list4, list5, list6, list7}, nil, nil, k, env)
+}
+
+// FoldL1 folds list1 from the left by calling closure with an element, the accumulator v0, and the next accumulator.
+// v unifies with the final accumulator.
+func FoldL1(vm *VM, closure, list1, v0, v Term, k Cont, env *Env) *Promise {
+	return foldLists(vm, closure, []Term{list1}, v0, v, k, env)
+}
+
+// FoldL2 folds list1 and list2 from the left by calling closure with the corresponding elements and the accumulators.
+func FoldL2(vm *VM, closure, list1, list2, v0, v Term, k Cont, env *Env) *Promise {
+	return foldLists(vm, closure, []Term{list1, list2}, v0, v, k, env)
+}
+
+// FoldL3 folds list1, list2, and list3 from the left by calling closure with the corresponding elements and the
+// accumulators.
+func FoldL3(vm *VM, closure, list1, list2, list3, v0, v Term, k Cont, env *Env) *Promise {
+	return foldLists(vm, closure, []Term{list1, list2, list3}, v0, v, k, env)
+}
+
+// foldLists calls closure for the corresponding elements of lists. If v0 is not nil, it also passes the accumulators.
+func foldLists(vm *VM, closure Term, lists []Term, v0, v Term, k Cont, env *Env) *Promise {
+	/*
+		foldl_([], [], ..., V, V).
+		foldl_([X1|Xs1], [X2|Xs2], ..., V0, V) :- call(Closure, X1, X2, ..., V0, V1), foldl_(Xs1, Xs2, ..., V1, V).
+	*/
+
+	// As if the first argument is indexed, we don't leave a choice point if the first list is instantiated.
+	empty, cons := true, true
+	switch l := env.Resolve(lists[0]).(type) {
+	case Variable:
+		break
+	case Compound:
+		empty, cons = false, l.Functor() == atomDot && l.Arity() == 2
+	default:
+		empty, cons = l == atomEmptyList, false
+	}
+
+	ks := make([]func(context.Context) *Promise, 0, 2)
+	if empty {
+		ks = append(ks, func(context.Context) *Promise {
+			nils := make([]Term, len(lists))
+			for i := range nils {
+				nils[i] = atomEmptyList
+			}
+			xs, ys := lists, nils
+			if v0 != nil {
+				xs, ys = append(xs[:len(xs):len(xs)], v0), append(ys, v)
+			}
+			return Unify(vm, tuple(xs...), tuple(ys...), k, env)
+		})
+	}
+	if cons {
+		ks = append(ks, func(context.Context) *Promise {
+			elems, tails, conses := make([]Term, len(lists), len(lists)+2), make([]Term, len(lists)), make([]Term, len(lists))
+			for i := range lists {
+				elems[i], tails[i] = NewVariable(), NewVariable()
+				conses[i] = Cons(elems[i], tails[i])
+			}
+			var v1 Term
+			if v0 != nil {
+				v1 = NewVariable()
+				elems = append(elems, v0, v1)
+			}
+			return Unify(vm, tuple(lists...), tuple(conses...), func(env *Env) *Promise {
+				return callN(vm, closure, elems, func(env *Env) *Promise {
+					return foldLists(vm, closure, tails, v1, v, k, env)
+				}, env)
+			}, env)
+		})
+	}
+	return Delay(ks...)
+}
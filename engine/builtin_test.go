@@ -2283,6 +2283,59 @@ func TestSort(t *testing.T) {
 	})
 }
 
+func TestMSort(t *testing.T) {
+	sorted := NewVariable()
+	ok, err := MSort(nil, List(NewAtom("a"), NewAtom("c"), NewAtom("b"), NewAtom("a")), sorted, func(env *Env) *Promise {
+		assert.Equal(t, List(NewAtom("a"), NewAtom("a"), NewAtom("b"), NewAtom("c")), env.Resolve(sorted))
+		return Bool(true)
+	}, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestSort4(t *testing.T) {
+	f := NewAtom("f")
+	a, b, c := NewAtom("a"), NewAtom("b"), NewAtom("c")
+	list := List(f.Apply(Integer(2), a), f.Apply(Integer(1), b), f.Apply(Integer(2), c), f.Apply(Integer(1), a))
+	sorted := NewVariable()
+
+	tests := []struct {
+		title            string
+		key, order, list Term
+		sorted           Term
+		err              error
+	}{
+		{title: "whole term, ascending", key: Integer(0), order: atomAtLessThan, list: List(c, a, b, a), sorted: List(a, b, c)},
+		{title: "whole term, ascending with duplicates", key: Integer(0), order: atomAtLessOrEqual, list: List(c, a, b, a), sorted: List(a, a, b, c)},
+		{title: "whole term, descending", key: Integer(0), order: atomAtGreaterThan, list: List(c, a, b, a), sorted: List(c, b, a)},
+		{title: "whole term, descending with duplicates", key: Integer(0), order: atomAtGreaterOrEqual, list: List(c, a, b, a), sorted: List(c, b, a, a)},
+		{title: "key, ascending", key: Integer(1), order: atomAtLessThan, list: list, sorted: List(f.Apply(Integer(1), b), f.Apply(Integer(2), a))},
+		{title: "key, ascending with duplicates", key: Integer(1), order: atomAtLessOrEqual, list: list, sorted: List(f.Apply(Integer(1), b), f.Apply(Integer(1), a), f.Apply(Integer(2), a), f.Apply(Integer(2), c))},
+		{title: "key, descending with duplicates", key: Integer(2), order: atomAtGreaterOrEqual, list: list, sorted: List(f.Apply(Integer(2), c), f.Apply(Integer(1), b), f.Apply(Integer(2), a), f.Apply(Integer(1), a))},
+
+		{title: "key is a variable", key: NewVariable(), order: atomAtLessThan, list: List(), err: InstantiationError(nil)},
+		{title: "key is not an integer", key: a, order: atomAtLessThan, list: List(), err: typeError(validTypeInteger, a, nil)},
+		{title: "key is negative", key: Integer(-1), order: atomAtLessThan, list: List(), err: domainError(validDomainNotLessThanZero, Integer(-1), nil)},
+		{title: "order is a variable", key: Integer(0), order: NewVariable(), list: List(), err: InstantiationError(nil)},
+		{title: "order is not an atom", key: Integer(0), order: Integer(0), list: List(), err: typeError(validTypeAtom, Integer(0), nil)},
+		{title: "order is not an order", key: Integer(0), order: atomLessThan, list: List(), err: domainError(validDomainOrder, atomLessThan, nil)},
+		{title: "element is not a compound", key: Integer(1), order: atomAtLessThan, list: List(a), err: typeError(validTypeCompound, a, nil)},
+		{title: "element doesn't have the key", key: Integer(3), order: atomAtLessThan, list: List(f.Apply(a)), err: typeError(validTypeCompound, f.Apply(a), nil)},
+		{title: "list is a partial list", key: Integer(0), order: atomAtLessThan, list: PartialList(NewVariable(), a), err: InstantiationError(nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			ok, err := Sort4(nil, tt.key, tt.order, tt.list, sorted, func(env *Env) *Promise {
+				assert.Equal(t, tt.sorted, env.Resolve(sorted))
+				return Bool(true)
+			}, nil).Force(context.Background())
+			assert.Equal(t, tt.err == nil, ok)
+			assert.Equal(t, tt.err, err)
+		})
+	}
+}
+
 func TestKeySort(t *testing.T) {
 	t.Run("ok", func(t *testing.T) {
 		t.Run("variable", func(t *testing.T) {
@@ -2441,6 +2494,120 @@ func TestCatch(t *testing.T) {
 	})
 }
 
+func TestSetupCallCleanup(t *testing.T) {
+	var records []Term
+	var vm VM
+	vm.Register2(atomEqual, Unify)
+	vm.Register1(NewAtom("throw"), Throw)
+	vm.Register0(atomTrue, func(_ *VM, k Cont, env *Env) *Promise {
+		return k(env)
+	})
+	vm.Register0(atomFail, func(*VM, Cont, *Env) *Promise {
+		return Bool(false)
+	})
+	vm.Register1(NewAtom("choice"), func(vm *VM, x Term, k Cont, env *Env) *Promise {
+		return Delay(func(context.Context) *Promise {
+			return Unify(vm, x, Integer(1), k, env)
+		}, func(context.Context) *Promise {
+			return Unify(vm, x, Integer(2), k, env)
+		})
+	})
+	vm.Register1(NewAtom("record"), func(_ *VM, x Term, k Cont, env *Env) *Promise {
+		records = append(records, env.Resolve(x))
+		return k(env)
+	})
+	vm.Register3(NewAtom("setup_call_cleanup"), SetupCallCleanup)
+
+	x := NewVariable()
+	record := NewAtom("record").Apply(x)
+	choice := NewAtom("choice").Apply(x)
+
+	t.Run("deterministic exit", func(t *testing.T) {
+		records = nil
+		ok, err := SetupCallCleanup(&vm, atomTrue, atomEqual.Apply(x, Integer(1)), record, func(env *Env) *Promise {
+			assert.Equal(t, []Term{Integer(1)}, records)
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("cut", func(t *testing.T) {
+		records = nil
+		goal := atomComma.Apply(NewAtom("setup_call_cleanup").Apply(atomTrue, choice, record), atomCut)
+		ok, err := Call(&vm, goal, func(env *Env) *Promise {
+			assert.Equal(t, []Term{Integer(1)}, records)
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("last solution", func(t *testing.T) {
+		records = nil
+		ok, err := SetupCallCleanup(&vm, atomTrue, choice, record, Failure, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, []Term{Integer(2)}, records)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		records = nil
+		goal := atomComma.Apply(choice, atomEqual.Apply(x, Integer(3)))
+		ok, err := SetupCallCleanup(&vm, atomTrue, goal, record, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.Len(t, records, 1)
+		_, ok = records[0].(Variable)
+		assert.True(t, ok)
+	})
+
+	t.Run("exception in goal", func(t *testing.T) {
+		records = nil
+		_, err := SetupCallCleanup(&vm, atomTrue, NewAtom("throw").Apply(NewAtom("e")), NewAtom("record").Apply(NewAtom("done")), Success, nil).Force(context.Background())
+		assert.Equal(t, NewException(NewAtom("e"), nil), err)
+		assert.Equal(t, []Term{NewAtom("done")}, records)
+	})
+
+	t.Run("exception after exit", func(t *testing.T) {
+		records = nil
+		_, err := SetupCallCleanup(&vm, atomTrue, choice, record, func(*Env) *Promise {
+			assert.Empty(t, records)
+			return Error(errors.New("failed"))
+		}, nil).Force(context.Background())
+		assert.Error(t, err)
+		assert.Equal(t, []Term{Integer(1)}, records)
+	})
+
+	t.Run("abandoned", func(t *testing.T) {
+		records = nil
+		ok, err := SetupCallCleanup(&vm, atomTrue, choice, record, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, []Term{Integer(1)}, records)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		records = nil
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_, err := SetupCallCleanup(&vm, atomTrue, choice, record, func(*Env) *Promise {
+			cancel()
+			return Bool(false)
+		}, nil).Force(ctx)
+		assert.Equal(t, context.Canceled, err)
+		assert.Equal(t, []Term{Integer(1)}, records)
+	})
+
+	t.Run("setup fails", func(t *testing.T) {
+		records = nil
+		ok, err := SetupCallCleanup(&vm, atomFail, atomTrue, record, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.Empty(t, records)
+	})
+}
+
 func TestCurrentPredicate(t *testing.T) {
 	t.Run("user defined predicate", func(t *testing.T) {
 		vm := VM{procedures: map[procedureIndicator]procedure{
@@ -2559,6 +2726,62 @@ func TestCurrentPredicate(t *testing.T) {
 	})
 }
 
+func TestVM_AssertFacts(t *testing.T) {
+	foo, bar := NewAtom("foo"), NewAtom("bar")
+
+	t.Run("ok", func(t *testing.T) {
+		var vm VM
+		assert.NoError(t, vm.DeclareIndex(foo, 1, 1))
+		assert.NoError(t, vm.AssertFacts([]Term{
+			foo.Apply(NewAtom("a")),
+			bar.Apply(Integer(1)),
+			foo.Apply(NewAtom("b")),
+			atomIf.Apply(foo.Apply(NewAtom("c")), atomTrue),
+		}))
+
+		u := vm.procedures[procedureIndicator{name: foo, arity: 1}].(*userDefined)
+		assert.Len(t, u.clauses, 3)
+		assert.True(t, u.indexes[0].built.Load())
+		assert.Len(t, u.candidates([]Term{NewAtom("b")}, nil), 1)
+
+		u = vm.procedures[procedureIndicator{name: bar, arity: 1}].(*userDefined)
+		assert.True(t, u.dynamic)
+		assert.Len(t, u.clauses, 1)
+	})
+
+	t.Run("schema", func(t *testing.T) {
+		var vm VM
+		ok, err := FactSchema(&vm, foo.Apply(atomInteger), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		assert.Equal(t, schemaError([]Term{
+			atomViolation.Apply(foo.Apply(NewAtom("a")), Integer(1), atomInteger, NewAtom("a")),
+		}, nil), vm.AssertFacts([]Term{
+			foo.Apply(Integer(1)),
+			foo.Apply(NewAtom("a")),
+			foo.Apply(Integer(2)),
+		}))
+
+		u := vm.procedures[procedureIndicator{name: foo, arity: 1}].(*userDefined)
+		assert.Len(t, u.clauses, 2)
+	})
+
+	t.Run("static", func(t *testing.T) {
+		vm := VM{procedures: map[procedureIndicator]procedure{
+			{name: foo, arity: 1}: &userDefined{},
+		}}
+		assert.Equal(t, permissionError(operationModify, permissionTypeStaticProcedure, atomSlash.Apply(foo, Integer(1)), nil), vm.AssertFacts([]Term{
+			foo.Apply(NewAtom("a")),
+		}))
+	})
+
+	t.Run("variable", func(t *testing.T) {
+		var vm VM
+		assert.Equal(t, InstantiationError(nil), vm.AssertFacts([]Term{NewVariable()}))
+	})
+}
+
 func TestAssertz(t *testing.T) {
 	t.Run("append", func(t *testing.T) {
 		var vm VM
@@ -2577,7 +2800,7 @@ func TestAssertz(t *testing.T) {
 		assert.NoError(t, err)
 		assert.True(t, ok)
 
-		assert.Equal(t, &userDefined{dynamic: true, clauses: []clause{
+		assert.Equal(t, &userDefined{dynamic: true, generation: 2, clauses: []clause{
 			{
 				pi: procedureIndicator{
 					name:  NewAtom("foo"),
@@ -2707,7 +2930,7 @@ func TestAsserta(t *testing.T) {
 		assert.NoError(t, err)
 		assert.True(t, ok)
 
-		assert.Equal(t, &userDefined{dynamic: true, clauses: []clause{
+		assert.Equal(t, &userDefined{dynamic: true, generation: 2, clauses: []clause{
 			{
 				pi: procedureIndicator{name: NewAtom("foo"), arity: 1},
 				raw: &compound{
@@ -2758,7 +2981,7 @@ func TestAsserta(t *testing.T) {
 		assert.NoError(t, err)
 		assert.True(t, ok)
 
-		assert.Equal(t, &userDefined{dynamic: true, clauses: []clause{
+		assert.Equal(t, &userDefined{dynamic: true, generation: 2, clauses: []clause{
 			{
 				pi: procedureIndicator{name: NewAtom("foo"), arity: 0},
 				raw: &compound{
@@ -2906,6 +3129,79 @@ func TestAsserta(t *testing.T) {
 	})
 }
 
+func TestPredicateProperty(t *testing.T) {
+	foo, bar := NewAtom("foo"), NewAtom("bar")
+	vm := VM{
+		procedures: map[procedureIndicator]procedure{
+			{name: foo, arity: 1}: &userDefined{dynamic: true, multifile: true, clauses: []clause{
+				{raw: foo.Apply(NewAtom("a"))},
+			}},
+			{name: bar, arity: 0}: &userDefined{discontiguous: true, clauses: []clause{
+				{raw: bar},
+				{raw: atomIf.Apply(bar, atomEqual.Apply(NewAtom("a"), NewAtom("a")))},
+			}},
+			{name: atomEqual, arity: 2}: Predicate2(Unify),
+		},
+	}
+	vm.DeclarePure(atomEqual, 2)
+
+	properties := func(t *testing.T, head, prop Term) []Term {
+		var ret []Term
+		ok, err := PredicateProperty(&vm, head, prop, func(env *Env) *Promise {
+			ret = append(ret, env.Resolve(prop))
+			return Bool(false)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		return ret
+	}
+
+	t.Run("dynamic", func(t *testing.T) {
+		assert.Equal(t, []Term{atomDefined, atomDynamic, atomMultifile, atomNumberOfClauses.Apply(Integer(1))}, properties(t, foo.Apply(NewVariable()), NewVariable()))
+	})
+
+	t.Run("static", func(t *testing.T) {
+		assert.Equal(t, []Term{atomDefined, atomStatic, atomDiscontiguous, atomNumberOfClauses.Apply(Integer(2)), atomPure}, properties(t, bar, NewVariable()))
+		assert.Equal(t, []Term{atomPure}, properties(t, bar, atomPure))
+		assert.Empty(t, properties(t, foo.Apply(NewVariable()), atomPure))
+	})
+
+	t.Run("built-in", func(t *testing.T) {
+		assert.Equal(t, []Term{atomDefined, atomBuiltIn, atomStatic, atomPure}, properties(t, atomEqual.Apply(NewVariable(), NewVariable()), NewVariable()))
+	})
+
+	t.Run("undefined", func(t *testing.T) {
+		assert.Empty(t, properties(t, NewAtom("baz"), NewVariable()))
+	})
+
+	t.Run("head is a variable", func(t *testing.T) {
+		head := NewVariable()
+		var heads []Term
+		ok, err := PredicateProperty(&vm, head, atomDynamic, func(env *Env) *Promise {
+			heads = append(heads, env.Resolve(head))
+			return Bool(false)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.Len(t, heads, 1)
+		assert.Equal(t, foo, heads[0].(Compound).Functor())
+	})
+
+	t.Run("head is not callable", func(t *testing.T) {
+		_, err := PredicateProperty(&vm, Integer(0), NewVariable(), Success, nil).Force(context.Background())
+		assert.Equal(t, typeError(validTypeCallable, Integer(0), nil), err)
+	})
+
+	t.Run("unknown property", func(t *testing.T) {
+		_, err := PredicateProperty(&vm, bar, NewAtom("foo"), Success, nil).Force(context.Background())
+		assert.Equal(t, domainError(validDomainPredicateProperty, NewAtom("foo"), nil), err)
+		_, err = PredicateProperty(&vm, bar, foo.Apply(NewVariable()), Success, nil).Force(context.Background())
+		assert.Error(t, err)
+		_, err = PredicateProperty(&vm, bar, Integer(0), Success, nil).Force(context.Background())
+		assert.Equal(t, domainError(validDomainPredicateProperty, Integer(0), nil), err)
+	})
+}
+
 func TestRetract(t *testing.T) {
 	t.Run("retract the first one", func(t *testing.T) {
 		vm := VM{
@@ -2925,7 +3221,7 @@ func TestRetract(t *testing.T) {
 		assert.NoError(t, err)
 		assert.True(t, ok)
 
-		assert.Equal(t, &userDefined{dynamic: true, clauses: []clause{
+		assert.Equal(t, &userDefined{dynamic: true, generation: 1, clauses: []clause{
 			{raw: &compound{functor: NewAtom("foo"), args: []Term{NewAtom("b")}}},
 			{raw: &compound{functor: NewAtom("foo"), args: []Term{NewAtom("c")}}},
 		}}, vm.procedures[procedureIndicator{name: NewAtom("foo"), arity: 1}])
@@ -2949,7 +3245,7 @@ func TestRetract(t *testing.T) {
 		assert.NoError(t, err)
 		assert.True(t, ok)
 
-		assert.Equal(t, &userDefined{dynamic: true, clauses: []clause{
+		assert.Equal(t, &userDefined{dynamic: true, generation: 1, clauses: []clause{
 			{raw: &compound{functor: NewAtom("foo"), args: []Term{NewAtom("a")}}},
 			{raw: &compound{functor: NewAtom("foo"), args: []Term{NewAtom("c")}}},
 		}}, vm.procedures[procedureIndicator{name: NewAtom("foo"), arity: 1}])
@@ -3861,11 +4157,11 @@ func TestClose(t *testing.T) {
 		assert.False(t, ok)
 	})
 
-	t.Run("an element E of the Options list is neither a variable nor a stream-option", func(t *testing.T) {
+	t.Run("an element E of the Options list is neither a variable nor a close-option", func(t *testing.T) {
 		t.Run("not a compound", func(t *testing.T) {
 			var vm VM
 			ok, err := Close(&vm, &Stream{}, List(NewAtom("foo")), Success, nil).Force(context.Background())
-			assert.Equal(t, domainError(validDomainStreamOption, NewAtom("foo"), nil), err)
+			assert.Equal(t, domainError(validDomainCloseOption, NewAtom("foo"), nil), err)
 			assert.False(t, ok)
 		})
 
@@ -3873,26 +4169,80 @@ func TestClose(t *testing.T) {
 			t.Run("force but arity is not 1", func(t *testing.T) {
 				var vm VM
 				ok, err := Close(&vm, &Stream{}, List(atomForce.Apply(NewAtom("a"), NewAtom("b"))), Success, nil).Force(context.Background())
-				assert.Equal(t, domainError(validDomainStreamOption, atomForce.Apply(NewAtom("a"), NewAtom("b")), nil), err)
+				assert.Equal(t, domainError(validDomainCloseOption, atomForce.Apply(NewAtom("a"), NewAtom("b")), nil), err)
 				assert.False(t, ok)
 			})
 
 			t.Run("force but the argument is a variable", func(t *testing.T) {
 				var vm VM
-				_, err := Close(&vm, &Stream{}, List(atomForce.Apply(NewVariable())), Success, nil).Force(context.Background())
-				_, ok := NewEnv().Unify(domainError(validDomainStreamOption, atomForce.Apply(NewVariable()), nil).term, err.(Exception).term)
-				assert.True(t, ok)
+				ok, err := Close(&vm, &Stream{}, List(atomForce.Apply(NewVariable())), Success, nil).Force(context.Background())
+				assert.Equal(t, InstantiationError(nil), err)
+				assert.False(t, ok)
 			})
 
 			t.Run("force but the argument is neither true nor false", func(t *testing.T) {
 				var vm VM
 				ok, err := Close(&vm, &Stream{}, List(atomForce.Apply(NewAtom("meh"))), Success, nil).Force(context.Background())
-				assert.Equal(t, domainError(validDomainStreamOption, atomForce.Apply(NewAtom("meh")), nil), err)
+				assert.Equal(t, domainError(validDomainCloseOption, atomForce.Apply(NewAtom("meh")), nil), err)
+				assert.False(t, ok)
+			})
+
+			t.Run("not force", func(t *testing.T) {
+				var vm VM
+				ok, err := Close(&vm, &Stream{}, List(NewAtom("foo").Apply(atomTrue)), Success, nil).Force(context.Background())
+				assert.Equal(t, domainError(validDomainCloseOption, NewAtom("foo").Apply(atomTrue), nil), err)
 				assert.False(t, ok)
 			})
 		})
 	})
 
+	t.Run("streamOrAlias is a closed stream", func(t *testing.T) {
+		var vm VM
+		s := NewOutputTextStream(io.Discard)
+		ok, err := Close(&vm, s, List(), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = Close(&vm, s, List(), Success, nil).Force(context.Background())
+		assert.Equal(t, existenceError(objectTypeStream, s, nil), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("standard streams", func(t *testing.T) {
+		var m struct {
+			mockWriter
+			mockCloser
+		}
+		defer m.mockCloser.AssertExpectations(t) // Never closed.
+
+		var (
+			vm   VM
+			user = NewOutputTextStream(&m)
+		)
+		vm.SetUserOutput(user)
+		ok, err := Close(&vm, atomUserOutput, List(), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		s, err := stream(&vm, atomUserOutput, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, user, s)
+	})
+
+	t.Run("current output", func(t *testing.T) {
+		var (
+			vm   VM
+			user = NewOutputTextStream(io.Discard)
+			s    = NewOutputTextStream(io.Discard)
+		)
+		vm.SetUserOutput(user)
+		vm.output = s
+		ok, err := Close(&vm, s, List(), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, user, vm.output)
+	})
+
 	t.Run("streamOrAlias is not associated with an open stream", func(t *testing.T) {
 		var vm VM
 		ok, err := Close(&vm, NewAtom("foo"), List(), Success, nil).Force(context.Background())
@@ -4428,7 +4778,7 @@ func TestReadTerm(t *testing.T) {
 			y, ok := c.args[2].(Variable)
 			assert.True(t, ok)
 
-			assert.Equal(t, List(y), env.Resolve(singletons))
+			assert.Equal(t, List(atomEqual.Apply(NewAtom("Y"), y)), env.Resolve(singletons))
 
 			return Bool(true)
 		}, nil).Force(context.Background())
@@ -4688,6 +5038,28 @@ func TestReadTerm(t *testing.T) {
 
 	})
 
+	t.Run("anonymous and underscore variables", func(t *testing.T) {
+		s := NewInputTextStream(strings.NewReader(`f(X, _, _Y, X, _).`))
+		v, variables, variableNames, singletons := NewVariable(), NewVariable(), NewVariable(), NewVariable()
+
+		var vm VM
+		ok, err := ReadTerm(&vm, s, v, List(
+			atomVariables.Apply(variables),
+			atomVariableNames.Apply(variableNames),
+			atomSingletons.Apply(singletons),
+		), func(env *Env) *Promise {
+			c := env.Resolve(v).(Compound)
+			x, a1, y, a2 := c.Arg(0), c.Arg(1), c.Arg(2), c.Arg(4)
+			assert.NotEqual(t, a1, a2)
+			assert.Equal(t, List(x, a1, y, a2), env.Resolve(variables))
+			assert.Equal(t, List(atomEqual.Apply(NewAtom("X"), x), atomEqual.Apply(NewAtom("_Y"), y)), env.Resolve(variableNames))
+			assert.Equal(t, List(atomEqual.Apply(NewAtom("_Y"), y)), env.Resolve(singletons))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
 	t.Run("the sequence of tokens cannot be parsed as a term using the current set of operator definitions", func(t *testing.T) {
 		f, err := os.Open("testdata/unexpected_op.txt")
 		assert.NoError(t, err)
@@ -5678,6 +6050,68 @@ func TestSubAtom(t *testing.T) {
 		assert.True(t, ok)
 	})
 
+	subAtoms := func(t *testing.T, atom, before, length, after, sub Term) []string {
+		var ret []string
+		ok, err := SubAtom(nil, atom, before, length, after, sub, func(env *Env) *Promise {
+			var sb strings.Builder
+			for _, t := range []Term{before, length, after, sub} {
+				switch t := env.Resolve(t).(type) {
+				case Integer:
+					fmt.Fprintf(&sb, "%d ", t)
+				case Atom:
+					sb.WriteString(t.String())
+				}
+			}
+			ret = append(ret, sb.String())
+			return Bool(false)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		return ret
+	}
+
+	t.Run("all", func(t *testing.T) {
+		assert.Equal(t, []string{"0 0 2 ", "0 1 1 a", "0 2 0 ab", "1 0 1 ", "1 1 0 b", "2 0 0 "}, subAtoms(t, NewAtom("ab"), NewVariable(), NewVariable(), NewVariable(), NewVariable()))
+	})
+
+	t.Run("multibyte", func(t *testing.T) {
+		assert.Equal(t, []string{"0 1 2 ア", "1 1 1 イ", "2 1 0 ウ"}, subAtoms(t, NewAtom("アイウ"), NewVariable(), Integer(1), NewVariable(), NewVariable()))
+		assert.Equal(t, []string{"1 1 1 イ"}, subAtoms(t, NewAtom("アイウ"), NewVariable(), NewVariable(), NewVariable(), NewAtom("イ")))
+		assert.Equal(t, []string{"1 2 0 イウ"}, subAtoms(t, NewAtom("アイウ"), Integer(1), NewVariable(), Integer(0), NewVariable()))
+	})
+
+	t.Run("before is bound", func(t *testing.T) {
+		assert.Equal(t, []string{"1 0 2 ", "1 1 1 b", "1 2 0 bc"}, subAtoms(t, NewAtom("abc"), Integer(1), NewVariable(), NewVariable(), NewVariable()))
+		assert.Equal(t, []string{"1 1 1 b"}, subAtoms(t, NewAtom("abc"), Integer(1), NewVariable(), NewVariable(), NewAtom("b")))
+		assert.Empty(t, subAtoms(t, NewAtom("abc"), Integer(0), NewVariable(), NewVariable(), NewAtom("b")))
+		assert.Empty(t, subAtoms(t, NewAtom("abc"), Integer(4), NewVariable(), NewVariable(), NewVariable()))
+		assert.Empty(t, subAtoms(t, NewAtom("abc"), Integer(4), NewVariable(), NewVariable(), NewAtom("")))
+	})
+
+	t.Run("after is bound", func(t *testing.T) {
+		assert.Equal(t, []string{"0 2 1 ab", "1 1 1 b", "2 0 1 "}, subAtoms(t, NewAtom("abc"), NewVariable(), NewVariable(), Integer(1), NewVariable()))
+		assert.Equal(t, []string{"1 1 1 b"}, subAtoms(t, NewAtom("abc"), NewVariable(), Integer(1), Integer(1), NewVariable()))
+		assert.Empty(t, subAtoms(t, NewAtom("abc"), NewVariable(), Integer(3), Integer(1), NewVariable()))
+	})
+
+	t.Run("empty sub atom", func(t *testing.T) {
+		assert.Equal(t, []string{"0 0 2 ", "1 0 1 ", "2 0 0 "}, subAtoms(t, NewAtom("ab"), NewVariable(), NewVariable(), NewVariable(), NewAtom("")))
+	})
+
+	t.Run("large atom", func(t *testing.T) {
+		large := NewAtom(strings.Repeat("a", 1<<20) + "b")
+		assert.Equal(t, []string{"1000 3 1047574 aaa"}, subAtoms(t, large, Integer(1000), Integer(3), NewVariable(), NewVariable()))
+		assert.Equal(t, []string{"1048575 2 0 ab"}, subAtoms(t, large, NewVariable(), NewVariable(), NewVariable(), NewAtom("ab")))
+
+		var c int
+		ok, err := SubAtom(nil, large, NewVariable(), NewVariable(), NewVariable(), NewVariable(), func(*Env) *Promise {
+			c++
+			return Bool(c == 1000)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
 	t.Run("atom is a variable", func(t *testing.T) {
 		ok, err := SubAtom(nil, NewVariable(), NewVariable(), NewVariable(), NewVariable(), NewVariable(), Success, nil).Force(context.Background())
 		assert.Equal(t, InstantiationError(nil), err)
@@ -6254,6 +6688,43 @@ func TestSetStreamPosition(t *testing.T) {
 		assert.Equal(t, permissionError(operationReposition, permissionTypeStream, s, env), err)
 		assert.False(t, ok)
 	})
+
+	t.Run("position is neither a variable nor a stream position term", func(t *testing.T) {
+		s := &Stream{source: os.Stdin, mode: ioModeRead, reposition: true}
+
+		var vm VM
+		ok, err := SetStreamPosition(&vm, s, NewAtom("foo"), Success, nil).Force(context.Background())
+		assert.Equal(t, domainError(validDomainStreamPosition, NewAtom("foo"), nil), err)
+		assert.False(t, ok)
+	})
+}
+
+func TestAtEndOfStream(t *testing.T) {
+	t.Run("not", func(t *testing.T) {
+		var vm VM
+		ok, err := AtEndOfStream(&vm, NewInputTextStream(strings.NewReader("a")), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("past", func(t *testing.T) {
+		var vm VM
+		vm.SetUserInput(NewInputTextStream(strings.NewReader("")))
+		ok, err := GetChar(&vm, atomUserInput, atomEndOfFile, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = AtEndOfStream(&vm, atomUserInput, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("streamOrAlias is not associated with an open stream", func(t *testing.T) {
+		var vm VM
+		ok, err := AtEndOfStream(&vm, NewAtom("foo"), Success, nil).Force(context.Background())
+		assert.Equal(t, existenceError(objectTypeStream, NewAtom("foo"), nil), err)
+		assert.False(t, ok)
+	})
 }
 
 func TestCharConversion(t *testing.T) {
@@ -6553,6 +7024,14 @@ func TestSetPrologFlag(t *testing.T) {
 			assert.Equal(t, doubleQuotesAtom, vm.doubleQuotes)
 		})
 
+		t.Run("string", func(t *testing.T) {
+			var vm VM
+			ok, err := SetPrologFlag(&vm, atomDoubleQuotes, atomString, Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, doubleQuotesString, vm.doubleQuotes)
+		})
+
 		t.Run("unknown", func(t *testing.T) {
 			var vm VM
 			ok, err := SetPrologFlag(&vm, atomDoubleQuotes, NewAtom("foo"), Success, nil).Force(context.Background())
@@ -6561,6 +7040,81 @@ func TestSetPrologFlag(t *testing.T) {
 		})
 	})
 
+	t.Run("dialect", func(t *testing.T) {
+		t.Run("compat", func(t *testing.T) {
+			var vm VM
+			not := procedureIndicator{name: atomNot, arity: 1}
+			concatAtom := procedureIndicator{name: NewAtom("concat_atom"), arity: 2}
+			vm.procedures = map[procedureIndicator]procedure{
+				concatAtom: &userDefined{},
+			}
+			ok, err := SetPrologFlag(&vm, atomDialect, atomCompat, Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, dialectCompat, vm.dialect)
+			assert.Contains(t, vm.procedures, not)
+			assert.Equal(t, &userDefined{}, vm.procedures[concatAtom])
+
+			ok, err = SetPrologFlag(&vm, atomDialect, atomISO, Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, dialectISO, vm.dialect)
+			assert.NotContains(t, vm.procedures, not)
+			assert.Equal(t, &userDefined{}, vm.procedures[concatAtom])
+		})
+
+		t.Run("unknown", func(t *testing.T) {
+			var vm VM
+			ok, err := SetPrologFlag(&vm, atomDialect, NewAtom("foo"), Success, nil).Force(context.Background())
+			assert.Equal(t, domainError(validDomainFlagValue, atomPlus.Apply(atomDialect, NewAtom("foo")), nil), err)
+			assert.False(t, ok)
+		})
+	})
+
+	t.Run("floundering", func(t *testing.T) {
+		t.Run("warning", func(t *testing.T) {
+			var vm VM
+			ok, err := SetPrologFlag(&vm, atomFloundering, atomWarning, Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.True(t, vm.floundering)
+
+			ok, err = SetPrologFlag(&vm, atomFloundering, atomOff, Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.False(t, vm.floundering)
+		})
+
+		t.Run("unknown", func(t *testing.T) {
+			var vm VM
+			ok, err := SetPrologFlag(&vm, atomFloundering, NewAtom("foo"), Success, nil).Force(context.Background())
+			assert.Equal(t, domainError(validDomainFlagValue, atomPlus.Apply(atomFloundering, NewAtom("foo")), nil), err)
+			assert.False(t, ok)
+		})
+	})
+
+	t.Run("encoding", func(t *testing.T) {
+		t.Run("latin_1", func(t *testing.T) {
+			var vm VM
+			ok, err := SetPrologFlag(&vm, atomEncoding, atomLatin1, Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, encodingISOLatin1, vm.encoding)
+
+			ok, err = SetPrologFlag(&vm, atomEncoding, atomUTF8, Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, encodingUTF8, vm.encoding)
+		})
+
+		t.Run("unknown", func(t *testing.T) {
+			var vm VM
+			ok, err := SetPrologFlag(&vm, atomEncoding, NewAtom("foo"), Success, nil).Force(context.Background())
+			assert.Equal(t, domainError(validDomainFlagValue, atomPlus.Apply(atomEncoding, NewAtom("foo")), nil), err)
+			assert.False(t, ok)
+		})
+	})
+
 	t.Run("flag is a variable", func(t *testing.T) {
 		var vm VM
 		ok, err := SetPrologFlag(&vm, NewVariable(), atomFail, Success, nil).Force(context.Background())
@@ -6676,6 +7230,18 @@ func TestCurrentPrologFlag(t *testing.T) {
 			case 8:
 				assert.Equal(t, atomDoubleQuotes, env.Resolve(flag))
 				assert.Equal(t, NewAtom(vm.doubleQuotes.String()), env.Resolve(value))
+			case 9:
+				assert.Equal(t, atomDialect, env.Resolve(flag))
+				assert.Equal(t, atomISO, env.Resolve(value))
+			case 10:
+				assert.Equal(t, atomFloundering, env.Resolve(flag))
+				assert.Equal(t, atomOff, env.Resolve(value))
+			case 11:
+				assert.Equal(t, atomEncoding, env.Resolve(flag))
+				assert.Equal(t, atomUTF8, env.Resolve(value))
+			case 12:
+				assert.Equal(t, atomLoopCheck, env.Resolve(flag))
+				assert.Equal(t, atomOff, env.Resolve(value))
 			default:
 				assert.Fail(t, "unreachable")
 			}
@@ -6684,7 +7250,7 @@ func TestCurrentPrologFlag(t *testing.T) {
 		}, nil).Force(context.Background())
 		assert.NoError(t, err)
 		assert.False(t, ok)
-		assert.Equal(t, 9, c)
+		assert.Equal(t, 13, c)
 	})
 
 	t.Run("flag is neither a variable nor an atom", func(t *testing.T) {
@@ -6747,6 +7313,17 @@ term_expansion(f(X), g(X)).
 			},
 			ok: true,
 		},
+		{
+			title: "terminal sequence: packed",
+			in:    atomArrow.Apply(s.Apply(a), CodeList("bc")),
+			out: func() Term {
+				return atomIf.Apply(
+					s.Apply(a, lastVariable()+1, lastVariable()+3),
+					atomEqual.Apply(lastVariable()+1, PartialCodeList("bc", lastVariable()+3)),
+				)
+			},
+			ok: true,
+		},
 		{
 			title: "terminal sequence: variable in head",
 			in:    atomArrow.Apply(x, List(b)),
@@ -6943,6 +7520,20 @@ term_expansion(f(X), g(X)).
 			},
 			ok: true,
 		},
+		{
+			title: "soft-cut: ok",
+			in:    atomArrow.Apply(s, atomSoftCut.Apply(a, b)),
+			out: func() Term {
+				return atomIf.Apply(
+					s.Apply(lastVariable()+1, lastVariable()+3),
+					atomSoftCut.Apply(
+						a.Apply(lastVariable()+1, lastVariable()+4),
+						b.Apply(lastVariable()+4, lastVariable()+3),
+					),
+				)
+			},
+			ok: true,
+		},
 		{
 			title: "if-then: lhs is not callable",
 			in:    atomArrow.Apply(s, atomThen.Apply(Integer(0), b)),
@@ -7588,3 +8179,111 @@ func setMemFree(n int64) func() {
 		memFree = orig
 	}
 }
+
+func TestMapList(t *testing.T) {
+	var vm VM
+	vm.Register2(NewAtom("succ"), Succ)
+	vm.Register3(NewAtom("plus"), func(vm *VM, x, y, z Term, k Cont, env *Env) *Promise {
+		return Is(vm, z, atomPlus.Apply(x, y), k, env)
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		l := NewVariable()
+		ok, err := MapList2(&vm, NewAtom("succ"), List(Integer(1), Integer(2), Integer(3)), l, func(env *Env) *Promise {
+			_, ok := env.Unify(l, List(Integer(2), Integer(3), Integer(4)))
+			assert.True(t, ok)
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("reverse", func(t *testing.T) {
+		l := NewVariable()
+		ok, err := MapList2(&vm, NewAtom("succ"), l, List(Integer(2), Integer(3)), func(env *Env) *Promise {
+			_, ok := env.Unify(l, List(Integer(1), Integer(2)))
+			assert.True(t, ok)
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("closure", func(t *testing.T) {
+		l := NewVariable()
+		ok, err := MapList3(&vm, NewAtom("plus"), List(Integer(1), Integer(2)), List(Integer(10), Integer(20)), l, func(env *Env) *Promise {
+			_, ok := env.Unify(l, List(Integer(11), Integer(22)))
+			assert.True(t, ok)
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("different lengths", func(t *testing.T) {
+		ok, err := MapList2(&vm, NewAtom("succ"), List(Integer(1), Integer(2)), List(Integer(2)), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("lists of lengths", func(t *testing.T) {
+		l := NewVariable()
+		var lens []int
+		_, err := MapList1(&vm, NewAtom("succ").Apply(Integer(0)), l, func(env *Env) *Promise {
+			iter := ListIterator{List: l, Env: env}
+			n := 0
+			for iter.Next() {
+				n++
+			}
+			lens = append(lens, n)
+			return Bool(len(lens) == 3)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []int{0, 1, 2}, lens)
+	})
+
+	t.Run("not callable", func(t *testing.T) {
+		_, err := MapList1(&vm, Integer(0), List(Integer(1)), Success, nil).Force(context.Background())
+		assert.Equal(t, typeError(validTypeCallable, Integer(0), nil), err)
+	})
+}
+
+func TestFoldL(t *testing.T) {
+	var vm VM
+	vm.Register3(NewAtom("plus"), func(vm *VM, x, y, z Term, k Cont, env *Env) *Promise {
+		return Is(vm, z, atomPlus.Apply(x, y), k, env)
+	})
+	vm.Register4(NewAtom("dot"), func(vm *VM, x, y, v0, v Term, k Cont, env *Env) *Promise {
+		return Is(vm, v, atomPlus.Apply(v0, atomAsterisk.Apply(x, y)), k, env)
+	})
+
+	t.Run("sum", func(t *testing.T) {
+		v := NewVariable()
+		ok, err := FoldL1(&vm, NewAtom("plus"), List(Integer(1), Integer(2), Integer(3)), Integer(0), v, func(env *Env) *Promise {
+			assert.Equal(t, Integer(6), env.Resolve(v))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("dot product", func(t *testing.T) {
+		v := NewVariable()
+		ok, err := FoldL2(&vm, NewAtom("dot"), List(Integer(1), Integer(2)), List(Integer(3), Integer(4)), Integer(0), v, func(env *Env) *Promise {
+			assert.Equal(t, Integer(11), env.Resolve(v))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		v := NewVariable()
+		ok, err := FoldL3(&vm, NewAtom("foo"), List(), List(), List(), NewAtom("a"), v, func(env *Env) *Promise {
+			assert.Equal(t, NewAtom("a"), env.Resolve(v))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+}
@@ -13,39 +13,98 @@ type userDefined struct {
 
 	// 7.4.3 says "If no clauses are defined for a procedure indicated by a directive ... then the procedure shall exist but have no clauses."
 	clauses
+
+	indexes []*index
+
+	schema []Term // The types of the arguments of the facts declared by fact_schema/1.
+
+	generation uint64 // Incremented whenever the clauses are modified in place. See Dependencies.
+}
+
+// fork returns a copy of u which can be modified independently.
+func (u *userDefined) fork() *userDefined {
+	f := *u
+	if u.dynamic {
+		f.clauses = make(clauses, len(u.clauses))
+		copy(f.clauses, u.clauses)
+	} else {
+		// Make sure appending to the clauses e.g. by multifile doesn't overwrite the shared array.
+		f.clauses = u.clauses[:len(u.clauses):len(u.clauses)]
+	}
+	// Index tables are built lazily. Each copy needs its own.
+	f.indexes = make([]*index, len(u.indexes))
+	for i, idx := range u.indexes {
+		f.indexes[i] = &index{args: idx.args}
+	}
+	return &f
 }
 
 type clauses []clause
 
 func (cs clauses) call(vm *VM, args []Term, k Cont, env *Env) *Promise {
-	var p *Promise
-	ks := make([]func(context.Context) *Promise, len(cs))
+	var (
+		p  = Delay()
+		ks = make([]func(context.Context) *Promise, 0, len(cs))
+	)
 	for i := range cs {
-		i, c := i, cs[i]
-		ks[i] = func(context.Context) *Promise {
-			vars := make([]Variable, len(c.vars))
-			for i := range vars {
-				vars[i] = NewVariable()
+		c := &cs[i] // The clauses are never modified in place. See Retract.
+		if !c.mayMatch(args, env) {
+			continue
+		}
+		ks = append(ks, func(context.Context) *Promise {
+			if err := vm.allocTerms(c, env); err != nil {
+				return Error(err)
 			}
+			vars := make([]Term, len(c.vars)) // exec makes the variables on their first occurrences.
+			k, env := vm.derive(c, k, env)
 			return vm.exec(c.bytecode, vars, k, args, nil, env, p)
-		}
+		})
 	}
-	p = Delay(ks...)
+	p.delayed = ks
 	return p
 }
 
+// mayMatch tells if the head of c may unify with args by looking at the first argument.
+// It's a quick check to skip the clauses which fail right away without setting them up.
+func (c *clause) mayMatch(args []Term, env *Env) bool {
+	if len(args) == 0 || len(c.bytecode) == 0 {
+		return true
+	}
+	switch op := c.bytecode[0]; op.opcode {
+	case opGetConst:
+		if _, ok := op.operand.(Compound); ok {
+			return true
+		}
+		a := env.Resolve(args[0])
+		if _, ok := a.(Variable); ok {
+			return true
+		}
+		return a == op.operand
+	case opGetList, opGetPartial, opGetFunctor, opGetPacked:
+		switch env.Resolve(args[0]).(type) {
+		case Variable, Compound:
+			return true
+		default:
+			return false
+		}
+	default:
+		return true
+	}
+}
+
 func compile(t Term, env *Env) (clauses, error) {
 	t = env.Resolve(t)
 	if t, ok := t.(Compound); ok && t.Functor() == atomIf && t.Arity() == 2 {
 		var cs clauses
 		head, body := t.Arg(0), t.Arg(1)
+		raw := env.simplify(t)
 		iter := altIterator{Alt: body, Env: env}
 		for iter.Next() {
 			c, err := compileClause(head, iter.Current(), env)
 			if err != nil {
 				return nil, typeError(validTypeCallable, body, env)
 			}
-			c.raw = t
+			c.raw = raw
 			cs = append(cs, c)
 		}
 		return cs, nil
@@ -61,6 +120,10 @@ type clause struct {
 	raw      Term
 	vars     []Variable
 	bytecode bytecode
+	metadata Term
+	ref      *DBRef
+
+	nested int // The depth of the disjunctions and if-then-elses being compiled.
 }
 
 func compileClause(head Term, body Term, env *Env) (clause, error) {
@@ -89,7 +152,11 @@ func (c *clause) compileHead(head Term, env *Env) {
 
 func (c *clause) compileBody(body Term, env *Env) error {
 	c.bytecode = append(c.bytecode, instruction{opcode: opEnter})
-	iter := seqIterator{Seq: body, Env: env}
+	return c.compileGoals(body, env)
+}
+
+func (c *clause) compileGoals(goals Term, env *Env) error {
+	iter := seqIterator{Seq: goals, Env: env}
 	for iter.Next() {
 		if err := c.compilePred(iter.Current(), env); err != nil {
 			return err
@@ -98,6 +165,44 @@ func (c *clause) compileBody(body Term, env *Env) error {
 	return nil
 }
 
+// compileDisj compiles (Left; Right) inline so that a cut in either branch cuts the clause.
+func (c *clause) compileDisj(left, right Term, env *Env) error {
+	c.nested++
+	defer func() { c.nested-- }()
+	disj := len(c.bytecode)
+	c.bytecode = append(c.bytecode, instruction{opcode: opDisj})
+	if err := c.compileGoals(left, env); err != nil {
+		return err
+	}
+	return c.compileElse(disj, right, env)
+}
+
+// compileIfThenElse compiles (Cond -> Then; Else) or (Cond *-> Then; Else) inline so that a cut in either Then or Else cuts the clause.
+func (c *clause) compileIfThenElse(op opcode, cond, then, els Term, env *Env) error {
+	c.compileBodyArg(cond, env)
+	c.nested++
+	defer func() { c.nested-- }()
+	ite := len(c.bytecode)
+	c.bytecode = append(c.bytecode, instruction{opcode: op})
+	if err := c.compileGoals(then, env); err != nil {
+		return err
+	}
+	return c.compileElse(ite, els, env)
+}
+
+// compileElse compiles the else branch of the branching instruction at the index and resolves its jumps.
+// The offsets are relative to the instruction following the one holding them.
+func (c *clause) compileElse(branch int, els Term, env *Env) error {
+	jump := len(c.bytecode)
+	c.bytecode = append(c.bytecode, instruction{opcode: opJump})
+	c.bytecode[branch].operand = Integer(jump - branch)
+	if err := c.compileGoals(els, env); err != nil {
+		return err
+	}
+	c.bytecode[jump].operand = Integer(len(c.bytecode) - (jump + 1))
+	return nil
+}
+
 var errNotCallable = errors.New("not callable")
 
 func (c *clause) compilePred(p Term, env *Env) error {
@@ -113,6 +218,31 @@ func (c *clause) compilePred(p Term, env *Env) error {
 		c.bytecode = append(c.bytecode, instruction{opcode: opCall, operand: procedureIndicator{name: p, arity: 0}})
 		return nil
 	case Compound:
+		switch {
+		case p.Functor() == atomSemiColon && p.Arity() == 2:
+			if cond, ok := env.Resolve(p.Arg(0)).(Compound); ok && cond.Arity() == 2 {
+				switch cond.Functor() {
+				case atomThen:
+					return c.compileIfThenElse(opIfThen, cond.Arg(0), cond.Arg(1), p.Arg(1), env)
+				case atomSoftCut:
+					return c.compileIfThenElse(opSoftCut, cond.Arg(0), cond.Arg(1), p.Arg(1), env)
+				}
+			}
+			return c.compileDisj(p.Arg(0), p.Arg(1), env)
+		case p.Functor() == atomThen && p.Arity() == 2:
+			return c.compileIfThenElse(opIfThen, p.Arg(0), p.Arg(1), atomFail, env)
+		case p.Functor() == atomSoftCut && p.Arity() == 2:
+			if err := c.compilePred(atomCall.Apply(p.Arg(0)), env); err != nil {
+				return err
+			}
+			return c.compileGoals(p.Arg(1), env)
+		case p.Functor() == atomIs && p.Arity() == 2:
+			if v, ok := c.firstOccurrence(p.Arg(0), p.Arg(1), env); ok {
+				c.compileBodyArg(p.Arg(1), env)
+				c.bytecode = append(c.bytecode, instruction{opcode: opIs, operand: c.varOffset(v)})
+				return nil
+			}
+		}
 		for i := 0; i < p.Arity(); i++ {
 			c.compileBodyArg(p.Arg(i), env)
 		}
@@ -126,7 +256,11 @@ func (c *clause) compilePred(p Term, env *Env) error {
 func (c *clause) compileHeadArg(a Term, env *Env) {
 	switch a := env.Resolve(a).(type) {
 	case Variable:
-		c.bytecode = append(c.bytecode, instruction{opcode: opGetVar, operand: c.varOffset(a)})
+		op := opGetVar
+		if !c.seen(a) {
+			op = opGetFirstVar
+		}
+		c.bytecode = append(c.bytecode, instruction{opcode: op, operand: c.varOffset(a)})
 	case charList, codeList: // Treat them as if they're atomic.
 		c.bytecode = append(c.bytecode, instruction{opcode: opGetConst, operand: a})
 	case list:
@@ -136,6 +270,12 @@ func (c *clause) compileHeadArg(a Term, env *Env) {
 		}
 		c.bytecode = append(c.bytecode, instruction{opcode: opPop})
 	case *partial:
+		if _, _, _, ok := unpack(a); ok {
+			c.bytecode = append(c.bytecode, instruction{opcode: opGetPacked, operand: a.Compound})
+			c.compileHeadArg(*a.tail, env)
+			c.bytecode = append(c.bytecode, instruction{opcode: opPop})
+			break
+		}
 		prefix := a.Compound.(list)
 		c.bytecode = append(c.bytecode, instruction{opcode: opGetPartial, operand: Integer(len(prefix))})
 		c.compileHeadArg(*a.tail, env)
@@ -167,6 +307,12 @@ func (c *clause) compileBodyArg(a Term, env *Env) {
 		}
 		c.bytecode = append(c.bytecode, instruction{opcode: opPop})
 	case *partial:
+		if _, _, _, ok := unpack(a); ok {
+			c.bytecode = append(c.bytecode, instruction{opcode: opPutPacked, operand: a.Compound})
+			c.compileBodyArg(*a.tail, env)
+			c.bytecode = append(c.bytecode, instruction{opcode: opPop})
+			break
+		}
 		var l int
 		iter := ListIterator{List: a.Compound}
 		for iter.Next() {
@@ -190,6 +336,28 @@ func (c *clause) compileBodyArg(a Term, env *Env) {
 	}
 }
 
+// firstOccurrence tells if t is a variable which appears in the clause for the first time and not in the expression.
+// Only the ones outside of disjunctions and if-then-elses count since the other branches don't assign them.
+func (c *clause) firstOccurrence(t, expression Term, env *Env) (Variable, bool) {
+	v, ok := env.Resolve(t).(Variable)
+	if !ok || c.nested > 0 || c.seen(v) {
+		return 0, false
+	}
+	if contains(expression, v, env) {
+		return 0, false
+	}
+	return v, true
+}
+
+func (c *clause) seen(o Variable) bool {
+	for _, v := range c.vars {
+		if v == o {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *clause) varOffset(o Variable) Integer {
 	for i, v := range c.vars {
 		if v == o {
@@ -452,6 +452,53 @@ func PartialList(tail Term, ts ...Term) Term {
 	}
 }
 
+// PartialCharList returns a character list of s followed by tail.
+// The characters are stored contiguously and the list cells are materialized only when they're accessed.
+func PartialCharList(s string, tail Term) Term {
+	return packedList(s, tail, false)
+}
+
+// PartialCodeList returns a character code list of s followed by tail.
+// The codes are stored contiguously and the list cells are materialized only when they're accessed.
+func PartialCodeList(s string, tail Term) Term {
+	return packedList(s, tail, true)
+}
+
+func packedList(s string, tail Term, codes bool) Term {
+	var l Term
+	if codes {
+		l = CodeList(s)
+	} else {
+		l = CharList(s)
+	}
+	switch {
+	case s == "":
+		return tail
+	case tail == atomEmptyList:
+		return l
+	default:
+		return &partial{Compound: l.(Compound), tail: &tail}
+	}
+}
+
+// unpack returns the text and the tail of a character list, a code list, or a partial list of them.
+func unpack(t Term) (s string, tail Term, codes bool, ok bool) {
+	switch t := t.(type) {
+	case charList:
+		return string(t), atomEmptyList, false, true
+	case codeList:
+		return string(t), atomEmptyList, true, true
+	case *partial:
+		switch c := t.Compound.(type) {
+		case charList:
+			return string(c), *t.tail, false, true
+		case codeList:
+			return string(c), *t.tail, true, true
+		}
+	}
+	return "", nil, false, false
+}
+
 // set returns a list of ts which elements are unique.
 func (e *Env) set(ts ...Term) Term {
 	sort.Slice(ts, func(i, j int) bool {
@@ -128,6 +128,25 @@ func TestPartialList(t *testing.T) {
 	}
 }
 
+func TestPartialCharList(t *testing.T) {
+	x := Term(NewVariable())
+	assert.Equal(t, x, PartialCharList("", x))
+	assert.Equal(t, charList("abc"), PartialCharList("abc", atomEmptyList))
+	assert.Equal(t, &partial{Compound: charList("abc"), tail: &x}, PartialCharList("abc", x))
+}
+
+func TestPartialCodeList(t *testing.T) {
+	x := Term(NewVariable())
+	assert.Equal(t, x, PartialCodeList("", x))
+	assert.Equal(t, codeList("abc"), PartialCodeList("abc", atomEmptyList))
+	assert.Equal(t, &partial{Compound: codeList("abc"), tail: &x}, PartialCodeList("abc", x))
+
+	l := PartialCodeList("ab", x).(Compound)
+	assert.Equal(t, Integer('a'), l.Arg(0))
+	assert.Equal(t, Integer('b'), l.Arg(1).(Compound).Arg(0))
+	assert.Equal(t, x, l.Arg(1).(Compound).Arg(1))
+}
+
 func TestEnv_Set(t *testing.T) {
 	env := NewEnv()
 	assert.Equal(t, List(), env.set())
@@ -0,0 +1,331 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+// DBRef is a reference to a clause or a record in the database. See assertz/2, recordz/3, and erase/1.
+type DBRef struct {
+	// clause
+	pi procedureIndicator
+
+	// record
+	record bool
+	key    recordKey
+	term   Term
+}
+
+// WriteTerm outputs the DBRef to an io.Writer.
+func (r *DBRef) WriteTerm(w io.Writer, _ *WriteOptions, _ *Env) error {
+	kind := "clause"
+	if r.record {
+		kind = "record"
+	}
+	_, err := fmt.Fprintf(w, "<%s>(%p)", kind, r)
+	return err
+}
+
+// Compare compares the DBRef with a Term.
+func (r *DBRef) Compare(t Term, env *Env) int {
+	return CompareAtomic[*DBRef](r, t, func(r *DBRef, s *DBRef) int {
+		switch x, y := uintptr(unsafe.Pointer(r)), uintptr(unsafe.Pointer(s)); {
+		case x > y:
+			return 1
+		case x < y:
+			return -1
+		default:
+			return 0
+		}
+	}, env)
+}
+
+// recordKey is a key of the recorded database. Only the name and arity matter if it's a compound.
+type recordKey struct {
+	name  Term // Atom or Integer.
+	arity Integer
+}
+
+func newRecordKey(key Term, env *Env) (recordKey, error) {
+	switch k := env.Resolve(key).(type) {
+	case Variable:
+		return recordKey{}, InstantiationError(env)
+	case Atom, Integer:
+		return recordKey{name: k}, nil
+	case Compound:
+		return recordKey{name: k.Functor(), arity: Integer(k.Arity())}, nil
+	default:
+		return recordKey{}, typeError(validTypeAtomic, key, env)
+	}
+}
+
+// Term returns the most general term for the key.
+func (k recordKey) Term() Term {
+	if k.arity == 0 {
+		return k.name
+	}
+	args := make([]Term, k.arity)
+	for i := range args {
+		args[i] = NewVariable()
+	}
+	return k.name.(Atom).Apply(args...)
+}
+
+// AssertaRef prepends t to the database and unifies ref with the reference to the clause.
+func AssertaRef(vm *VM, t, ref Term, k Cont, env *Env) *Promise {
+	r := &DBRef{}
+	if err := assertMerge(vm, t, r, true, env); err != nil {
+		return Error(err)
+	}
+	return Unify(vm, ref, r, k, env)
+}
+
+// AssertzRef appends t to the database and unifies ref with the reference to the clause.
+func AssertzRef(vm *VM, t, ref Term, k Cont, env *Env) *Promise {
+	r := &DBRef{}
+	if err := assertMerge(vm, t, r, false, env); err != nil {
+		return Error(err)
+	}
+	return Unify(vm, ref, r, k, env)
+}
+
+// AssertScoped appends facts to the database just like assertz/1 for each of them and returns a function which erases
+// them. If any of them can't be asserted, the ones asserted so far are erased and the error is returned.
+func (vm *VM) AssertScoped(facts []Term, env *Env) (erase func(), err error) {
+	refs := make([]*DBRef, 0, len(facts))
+	erase = func() {
+		for i := len(refs) - 1; i >= 0; i-- {
+			// The fact may have been retracted already. Then, it's an existence error which we can ignore.
+			_, _ = Erase(vm, refs[i], Success, nil).Force(context.Background())
+		}
+	}
+	for _, f := range facts {
+		r := &DBRef{}
+		if err := assertMerge(vm, f, r, false, env); err != nil {
+			erase()
+			return nil, err
+		}
+		refs = append(refs, r)
+	}
+	return erase, nil
+}
+
+// WithFacts appends the elements of facts to the database just like assertz/1, calls goal, and erases them once goal is
+// over just like setup_call_cleanup/3. That is, they're erased even if goal raises an exception, is cut, or abandoned.
+func WithFacts(vm *VM, facts, goal Term, k Cont, env *Env) *Promise {
+	var fs []Term
+	iter := ListIterator{List: facts, Env: env}
+	for iter.Next() {
+		fs = append(fs, iter.Current())
+	}
+	if err := iter.Err(); err != nil {
+		return Error(err)
+	}
+
+	return Delay(func(ctx context.Context) *Promise {
+		erase, err := vm.AssertScoped(fs, env)
+		if err != nil {
+			return Error(err)
+		}
+		return withCleanup(func(context.Context, bool) {
+			erase()
+		}, func(frame *Promise) *Promise {
+			return Call(vm, goal, func(env *Env) *Promise {
+				return exited(frame, func(context.Context) *Promise {
+					return k(env)
+				})
+			}, env)
+		})
+	})
+}
+
+// Erase removes the clause or the record referenced by ref from the database.
+func Erase(vm *VM, ref Term, k Cont, env *Env) *Promise {
+	r, err := dbRef(ref, env)
+	if err != nil {
+		return Error(err)
+	}
+	if err := vm.erase(r, ref, env); err != nil {
+		return Error(err)
+	}
+	return k(env)
+}
+
+func (vm *VM) erase(r *DBRef, ref Term, env *Env) error {
+	db := vm.database()
+	db.Lock()
+	defer db.Unlock()
+
+	if r.record {
+		rs := vm.records[r.key]
+		for i, e := range rs {
+			if e != r {
+				continue
+			}
+			// Make a new slice so that the ongoing recorded/3 calls are not affected.
+			vm.records[r.key] = append(rs[:i:i], rs[i+1:]...)
+			return nil
+		}
+		return existenceError(objectTypeDBReference, ref, env)
+	}
+
+	u, ok := vm.procedures[r.pi].(*userDefined)
+	if !ok {
+		return existenceError(objectTypeDBReference, ref, env)
+	}
+	if !u.dynamic {
+		return permissionError(operationModify, permissionTypeStaticProcedure, r.pi.Term(), env)
+	}
+	var erased clauses
+	cs := make(clauses, 0, len(u.clauses))
+	for _, c := range u.clauses {
+		if c.ref != r {
+			cs = append(cs, c)
+			continue
+		}
+		erased = append(erased, c)
+	}
+	if len(erased) == 0 {
+		return existenceError(objectTypeDBReference, ref, env)
+	}
+	vm.freeClauses(erased)
+	u.clauses = cs
+	u.generation++
+	u.removeIndexes(erased)
+	vm.invalidatePurity()
+	return nil
+}
+
+// Instance unifies t with the clause or the record referenced by ref.
+func Instance(vm *VM, ref, t Term, k Cont, env *Env) *Promise {
+	r, err := dbRef(ref, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	var raw Term
+	if r.record {
+		for _, e := range vm.records[r.key] {
+			if e == r {
+				raw = r.term
+				break
+			}
+		}
+	} else if u, ok := vm.procedures[r.pi].(*userDefined); ok {
+		for _, c := range u.clauses {
+			if c.ref == r {
+				raw = rulify(c.raw, env)
+				break
+			}
+		}
+	}
+	if raw == nil {
+		return Error(existenceError(objectTypeDBReference, ref, env))
+	}
+
+	c, err := renamedCopy(raw, nil, env)
+	if err != nil {
+		return Error(err)
+	}
+	return Unify(vm, t, c, k, env)
+}
+
+// Recorda records value as the first record of key and unifies ref with the reference to the record.
+func Recorda(vm *VM, key, value, ref Term, k Cont, env *Env) *Promise {
+	return record(vm, key, value, ref, func(existing []*DBRef, r *DBRef) []*DBRef {
+		return append([]*DBRef{r}, existing...)
+	}, k, env)
+}
+
+// Recordz records value as the last record of key and unifies ref with the reference to the record.
+func Recordz(vm *VM, key, value, ref Term, k Cont, env *Env) *Promise {
+	return record(vm, key, value, ref, func(existing []*DBRef, r *DBRef) []*DBRef {
+		return append(existing[:len(existing):len(existing)], r)
+	}, k, env)
+}
+
+func record(vm *VM, key, value, ref Term, merge func([]*DBRef, *DBRef) []*DBRef, k Cont, env *Env) *Promise {
+	rk, err := newRecordKey(key, env)
+	if err != nil {
+		return Error(err)
+	}
+	persistAtoms(rk.name, nil)
+
+	t, err := renamedCopy(value, nil, env)
+	if err != nil {
+		return Error(err)
+	}
+	persistAtoms(t, nil)
+
+	r := DBRef{record: true, key: rk, term: t}
+	db := vm.database()
+	db.Lock()
+	if vm.records == nil {
+		vm.records = map[recordKey][]*DBRef{}
+	}
+	if _, ok := vm.records[rk]; !ok {
+		vm.recordKeys = append(vm.recordKeys, rk)
+	}
+	vm.records[rk] = merge(vm.records[rk], &r)
+	db.Unlock()
+	return Unify(vm, ref, &r, k, env)
+}
+
+// Recorded succeeds iff there's a record of value under key referenced by ref.
+func Recorded(vm *VM, key, value, ref Term, k Cont, env *Env) *Promise {
+	var rs []*DBRef
+	switch r := env.Resolve(ref).(type) {
+	case Variable:
+		var keys []recordKey
+		if _, ok := env.Resolve(key).(Variable); ok {
+			keys = vm.recordKeys
+		} else {
+			rk, err := newRecordKey(key, env)
+			if err != nil {
+				return Error(err)
+			}
+			keys = []recordKey{rk}
+		}
+		for _, rk := range keys {
+			rs = append(rs, vm.records[rk]...)
+		}
+	case *DBRef:
+		if !r.record {
+			return Bool(false)
+		}
+		for _, e := range vm.records[r.key] {
+			if e == r {
+				rs = []*DBRef{r}
+				break
+			}
+		}
+	default:
+		return Error(typeError(validTypeDBReference, ref, env))
+	}
+
+	ks := make([]func(context.Context) *Promise, len(rs))
+	for i := range rs {
+		r := rs[i]
+		ks[i] = func(context.Context) *Promise {
+			t, err := renamedCopy(r.term, nil, env)
+			if err != nil {
+				return Error(err)
+			}
+			return Unify(vm, tuple(key, value, ref), tuple(r.key.Term(), t, r), k, env)
+		}
+	}
+	return Delay(ks...)
+}
+
+func dbRef(ref Term, env *Env) (*DBRef, error) {
+	switch r := env.Resolve(ref).(type) {
+	case Variable:
+		return nil, InstantiationError(env)
+	case *DBRef:
+		return r, nil
+	default:
+		return nil, typeError(validTypeDBReference, ref, env)
+	}
+}
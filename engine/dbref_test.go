@@ -0,0 +1,224 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDBRef_WriteTerm(t *testing.T) {
+	var buf bytes.Buffer
+	r := &DBRef{}
+	assert.NoError(t, r.WriteTerm(&buf, nil, nil))
+	assert.Equal(t, fmt.Sprintf("<clause>(%p)", r), buf.String())
+
+	buf.Reset()
+	r = &DBRef{record: true}
+	assert.NoError(t, r.WriteTerm(&buf, nil, nil))
+	assert.Equal(t, fmt.Sprintf("<record>(%p)", r), buf.String())
+}
+
+func TestDBRef_Compare(t *testing.T) {
+	r := &DBRef{}
+	assert.Equal(t, 0, r.Compare(r, nil))
+	assert.Equal(t, 1, r.Compare(NewAtom("a"), nil))
+	assert.Equal(t, -1, r.Compare(NewAtom("f").Apply(NewAtom("a")), nil))
+}
+
+func TestAssertzRef(t *testing.T) {
+	var vm VM
+	ref1, ref2 := NewVariable(), NewVariable()
+	foo := NewAtom("foo")
+
+	var env *Env
+	ok, err := AssertzRef(&vm, foo.Apply(NewAtom("a")), ref1, func(e *Env) *Promise {
+		return AssertzRef(&vm, foo.Apply(NewAtom("b")), ref2, func(e *Env) *Promise {
+			env = e
+			return Bool(true)
+		}, e)
+	}, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.IsType(t, &DBRef{}, env.Resolve(ref1))
+	assert.NotSame(t, env.Resolve(ref1), env.Resolve(ref2))
+
+	t.Run("instance", func(t *testing.T) {
+		c := NewVariable()
+		ok, err := Instance(&vm, ref2, c, func(env *Env) *Promise {
+			assert.Equal(t, atomIf.Apply(foo.Apply(NewAtom("b")), atomTrue), env.Resolve(c))
+			return Bool(true)
+		}, env).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("erase", func(t *testing.T) {
+		ok, err := Erase(&vm, ref1, Success, env).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		u := vm.procedures[procedureIndicator{name: foo, arity: 1}].(*userDefined)
+		assert.Len(t, u.clauses, 1)
+		assert.Equal(t, foo.Apply(NewAtom("b")), u.clauses[0].raw)
+
+		_, err = Erase(&vm, ref1, Success, env).Force(context.Background())
+		assert.Equal(t, existenceError(objectTypeDBReference, ref1, env), err)
+
+		_, err = Instance(&vm, ref1, NewVariable(), Success, env).Force(context.Background())
+		assert.Equal(t, existenceError(objectTypeDBReference, ref1, env), err)
+	})
+
+	t.Run("asserta", func(t *testing.T) {
+		ref := NewVariable()
+		ok, err := AssertaRef(&vm, foo.Apply(NewAtom("c")), ref, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		u := vm.procedures[procedureIndicator{name: foo, arity: 1}].(*userDefined)
+		assert.Equal(t, foo.Apply(NewAtom("c")), u.clauses[0].raw)
+	})
+}
+
+func TestErase(t *testing.T) {
+	t.Run("variable", func(t *testing.T) {
+		var vm VM
+		_, err := Erase(&vm, NewVariable(), Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(nil), err)
+	})
+
+	t.Run("not a reference", func(t *testing.T) {
+		var vm VM
+		_, err := Erase(&vm, NewAtom("a"), Success, nil).Force(context.Background())
+		assert.Equal(t, typeError(validTypeDBReference, NewAtom("a"), nil), err)
+	})
+
+	t.Run("static", func(t *testing.T) {
+		pi := procedureIndicator{name: NewAtom("foo"), arity: 0}
+		r := &DBRef{pi: pi}
+		vm := VM{procedures: map[procedureIndicator]procedure{
+			pi: &userDefined{clauses: clauses{{pi: pi, raw: NewAtom("foo"), ref: r}}},
+		}}
+		_, err := Erase(&vm, r, Success, nil).Force(context.Background())
+		assert.Equal(t, permissionError(operationModify, permissionTypeStaticProcedure, pi.Term(), nil), err)
+	})
+}
+
+func TestWithFacts(t *testing.T) {
+	foo := NewAtom("foo")
+	facts := List(foo.Apply(NewAtom("a")), foo.Apply(NewAtom("b")))
+	count := func(vm *VM) int {
+		u, ok := vm.procedures[procedureIndicator{name: foo, arity: 1}].(*userDefined)
+		if !ok {
+			return 0
+		}
+		return len(u.clauses)
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		var vm VM
+		var n int
+		vm.Register0(NewAtom("check"), func(vm *VM, k Cont, env *Env) *Promise {
+			n = count(vm)
+			return k(env)
+		})
+		ok, err := WithFacts(&vm, facts, NewAtom("check"), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, 2, n)
+		assert.Equal(t, 0, count(&vm))
+	})
+
+	t.Run("exception", func(t *testing.T) {
+		var vm VM
+		vm.Register1(NewAtom("throw"), Throw)
+		_, err := WithFacts(&vm, facts, NewAtom("throw").Apply(NewAtom("e")), Success, nil).Force(context.Background())
+		assert.Equal(t, NewException(NewAtom("e"), nil), err)
+		assert.Equal(t, 0, count(&vm))
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		var vm VM
+		vm.Register0(atomFail, func(*VM, Cont, *Env) *Promise {
+			return Bool(false)
+		})
+		ok, err := WithFacts(&vm, facts, atomFail, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, 0, count(&vm))
+	})
+
+	t.Run("retracted by goal", func(t *testing.T) {
+		var vm VM
+		vm.Register1(NewAtom("retract"), Retract)
+		ok, err := WithFacts(&vm, facts, NewAtom("retract").Apply(foo.Apply(NewAtom("a"))), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, 0, count(&vm))
+	})
+
+	t.Run("partially asserted", func(t *testing.T) {
+		var vm VM
+		_, err := WithFacts(&vm, List(foo.Apply(NewAtom("a")), Integer(1)), atomTrue, Success, nil).Force(context.Background())
+		assert.Equal(t, typeError(validTypeCallable, Integer(1), nil), err)
+		assert.Equal(t, 0, count(&vm))
+	})
+
+	t.Run("facts is a partial list", func(t *testing.T) {
+		var vm VM
+		_, err := WithFacts(&vm, PartialList(NewVariable(), foo.Apply(NewAtom("a"))), atomTrue, Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(nil), err)
+	})
+}
+
+func TestRecorded(t *testing.T) {
+	var vm VM
+	r1, r2, r3 := NewVariable(), NewVariable(), NewVariable()
+	var env *Env
+	ok, err := Recordz(&vm, NewAtom("k"), NewAtom("b"), r1, func(e *Env) *Promise {
+		return Recorda(&vm, NewAtom("k").Apply(NewVariable()), NewAtom("f").Apply(NewVariable()), r2, func(e *Env) *Promise {
+			return Recordz(&vm, Integer(1), NewAtom("c"), r3, func(e *Env) *Promise {
+				env = e
+				return Bool(true)
+			}, e)
+		}, e)
+	}, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	all := func(key, value, ref Term) []Term {
+		var ts []Term
+		_, err := Recorded(&vm, key, value, ref, func(env *Env) *Promise {
+			ts = append(ts, env.Resolve(value))
+			return Bool(false)
+		}, env).Force(context.Background())
+		assert.NoError(t, err)
+		return ts
+	}
+
+	assert.Equal(t, []Term{NewAtom("b")}, all(NewAtom("k"), NewVariable(), NewVariable()))
+	assert.Len(t, all(NewVariable(), NewAtom("f").Apply(NewVariable()), NewVariable()), 1)
+	assert.Len(t, all(NewVariable(), NewVariable(), NewVariable()), 3)
+	assert.Len(t, all(NewAtom("k").Apply(NewAtom("x")), NewVariable(), NewVariable()), 1)
+	assert.Equal(t, []Term{NewAtom("c")}, all(NewVariable(), NewVariable(), r3))
+
+	t.Run("erase", func(t *testing.T) {
+		ok, err := Erase(&vm, r1, Success, env).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Empty(t, all(NewAtom("k"), NewVariable(), NewVariable()))
+
+		_, err = Instance(&vm, r1, NewVariable(), Success, env).Force(context.Background())
+		assert.Equal(t, existenceError(objectTypeDBReference, r1, env), err)
+	})
+
+	t.Run("key is not valid", func(t *testing.T) {
+		_, err := Recorda(&vm, Float(1), NewAtom("a"), NewVariable(), Success, nil).Force(context.Background())
+		assert.Equal(t, typeError(validTypeAtomic, Float(1), nil), err)
+
+		_, err = Recorded(&vm, NewVariable(), NewVariable(), NewAtom("a"), Success, nil).Force(context.Background())
+		assert.Equal(t, typeError(validTypeDBReference, NewAtom("a"), nil), err)
+	})
+}
@@ -9,6 +9,9 @@ import (
 
 // Phrase succeeds if the difference list of s0-s satisfies the grammar rule of grBody.
 func Phrase(vm *VM, grBody, s0, s Term, k Cont, env *Env) *Promise {
+	if _, ok := env.Resolve(grBody).(Variable); ok {
+		return Error(InstantiationError(env))
+	}
 	goal, err := dcgBody(grBody, s0, s, env)
 	if err != nil {
 		return Error(err)
@@ -69,6 +72,10 @@ func dcgNonTerminal(nonTerminal, list, rest Term, env *Env) (Term, error) {
 }
 
 func dcgTerminals(terminals, list, rest Term, env *Env) (Term, error) {
+	if s, tail, codes, ok := unpack(env.Resolve(terminals)); ok && tail == atomEmptyList {
+		return atomEqual.Apply(list, packedList(s, rest, codes)), nil
+	}
+
 	var elems []Term
 	iter := ListIterator{List: terminals, Env: env}
 	for iter.Next() {
@@ -104,7 +111,7 @@ func init() {
 		},
 		{name: atomSemiColon, arity: 2}: func(args []Term, list, rest Term, env *Env) (Term, error) {
 			body := dcgBody
-			if t, ok := env.Resolve(args[0]).(Compound); ok && t.Functor() == atomThen && t.Arity() == 2 {
+			if t, ok := env.Resolve(args[0]).(Compound); ok && (t.Functor() == atomThen || t.Functor() == atomSoftCut) && t.Arity() == 2 {
 				body = dcgCBody
 			}
 			either, err := body(args[0], list, rest, env)
@@ -160,6 +167,18 @@ func init() {
 			}
 			return atomThen.Apply(cond, then), nil
 		},
+		{name: atomSoftCut, arity: 2}: func(args []Term, list, rest Term, env *Env) (Term, error) {
+			v := NewVariable()
+			cond, err := dcgBody(args[0], list, v, env)
+			if err != nil {
+				return nil, err
+			}
+			then, err := dcgBody(args[1], v, rest, env)
+			if err != nil {
+				return nil, err
+			}
+			return atomSoftCut.Apply(cond, then), nil
+		},
 	}
 }
 
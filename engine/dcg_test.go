@@ -33,4 +33,36 @@ func TestVM_Phrase(t *testing.T) {
 		_, err := Phrase(&vm, Integer(0), s0, s, Success, nil).Force(context.Background())
 		assert.Error(t, err)
 	})
+
+	t.Run("instantiation error", func(t *testing.T) {
+		s0, s := NewVariable(), NewVariable()
+		var vm VM
+		_, err := Phrase(&vm, NewVariable(), s0, s, Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(nil), err)
+	})
+}
+
+func TestVM_Phrase_packed(t *testing.T) {
+	var vm VM
+	vm.operators.define(1200, operatorSpecifierXFX, atomArrow)
+	vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+	vm.Register2(atomEqual, Unify)
+	vm.doubleQuotes = doubleQuotesCodes
+	assert.NoError(t, vm.Compile(context.Background(), `
+greeting --> "hello", " ", name.
+name --> "world".
+name --> "prolog".
+`))
+
+	rest := NewVariable()
+	ok, err := Phrase(&vm, NewAtom("greeting"), CodeList("hello prolog!"), rest, func(env *Env) *Promise {
+		assert.Equal(t, CodeList("!"), env.Resolve(rest))
+		return Bool(true)
+	}, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = Phrase(&vm, NewAtom("greeting"), CodeList("hello there"), rest, Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, ok)
 }
@@ -0,0 +1,222 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+)
+
+// decompile reconstructs the clause from its bytecode. The result is equivalent to the clause it was compiled from but
+// not necessarily identical since the compilation normalizes some constructs:
+//
+//   - A variable goal G is call(G).
+//   - Cond -> Then without else is (Cond -> Then ; fail) which is decompiled back to Cond -> Then.
+//   - Cond *-> Then without else is (call(Cond), Then).
+//   - A clause whose body is a disjunction at the top level is compiled to a clause per alternative.
+//
+// The variables are the ones in c.vars so that the result shares them with the bytecode.
+func (c *clause) decompile() (Term, error) {
+	d := decompiler{pc: c.bytecode, vars: c.vars}
+
+	var args []Term
+	for d.pos < len(d.pc) && d.pc[d.pos].opcode != opEnter && d.pc[d.pos].opcode != opExit {
+		a, err := d.arg()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, a)
+	}
+	if len(args) != int(c.pi.arity) {
+		return nil, fmt.Errorf("%s has %d arguments in bytecode", c.pi, len(args))
+	}
+	head := c.pi.name.Apply(args...)
+
+	if d.pos >= len(d.pc) {
+		return nil, errors.New("bytecode without exit")
+	}
+	if d.pc[d.pos].opcode == opExit {
+		return head, nil
+	}
+	d.pos++ // opEnter
+	body, err := d.goals(len(d.pc) - 1)
+	if err != nil {
+		return nil, err
+	}
+	if d.pc[d.pos].opcode != opExit {
+		return nil, errors.New("bytecode without exit")
+	}
+	return atomIf.Apply(head, body), nil
+}
+
+type decompiler struct {
+	pc   bytecode
+	pos  int
+	vars []Variable
+}
+
+func (d *decompiler) next() (instruction, error) {
+	if d.pos >= len(d.pc) {
+		return instruction{}, errors.New("unexpected end of bytecode")
+	}
+	op := d.pc[d.pos]
+	d.pos++
+	return op, nil
+}
+
+func (d *decompiler) variable(operand Term) (Term, error) {
+	n, ok := operand.(Integer)
+	if !ok || n < 0 || int(n) >= len(d.vars) {
+		return nil, fmt.Errorf("invalid variable offset: %v", operand)
+	}
+	return d.vars[n], nil
+}
+
+// arg reads an argument of the head or a goal.
+func (d *decompiler) arg() (Term, error) {
+	op, err := d.next()
+	if err != nil {
+		return nil, err
+	}
+	switch op.opcode {
+	case opGetConst, opPutConst:
+		return op.operand, nil
+	case opGetVar, opGetFirstVar, opPutVar:
+		return d.variable(op.operand)
+	case opGetFunctor, opPutFunctor:
+		pi := op.operand.(procedureIndicator)
+		args, err := d.args(int(pi.arity))
+		if err != nil {
+			return nil, err
+		}
+		return pi.name.Apply(args...), nil
+	case opGetList, opPutList:
+		args, err := d.args(int(op.operand.(Integer)))
+		if err != nil {
+			return nil, err
+		}
+		return List(args...), nil
+	case opGetPartial, opPutPartial:
+		args, err := d.args(int(op.operand.(Integer)) + 1) // The tail comes first.
+		if err != nil {
+			return nil, err
+		}
+		return PartialList(args[0], args[1:]...), nil
+	case opGetPacked, opPutPacked:
+		args, err := d.args(1)
+		if err != nil {
+			return nil, err
+		}
+		return &partial{Compound: op.operand.(Compound), tail: &args[0]}, nil
+	default:
+		return nil, fmt.Errorf("unexpected opcode in argument: %d", op.opcode)
+	}
+}
+
+// args reads n arguments followed by opPop.
+func (d *decompiler) args(n int) ([]Term, error) {
+	args := make([]Term, n)
+	for i := range args {
+		a, err := d.arg()
+		if err != nil {
+			return nil, err
+		}
+		args[i] = a
+	}
+	if op, err := d.next(); err != nil || op.opcode != opPop {
+		return nil, errors.New("compound without pop")
+	}
+	return args, nil
+}
+
+// goals reads the goals up to the instruction at end and returns their conjunction.
+func (d *decompiler) goals(end int) (Term, error) {
+	var (
+		goals []Term
+		args  []Term
+	)
+	for d.pos < end {
+		switch op := d.pc[d.pos]; op.opcode {
+		case opCall:
+			d.pos++
+			pi := op.operand.(procedureIndicator)
+			n := len(args) - int(pi.arity)
+			if n < 0 {
+				return nil, fmt.Errorf("%s without enough arguments", pi)
+			}
+			goal := pi.name.Apply(append([]Term(nil), args[n:]...)...) // args is reused for the next goal.
+			goals, args = append(goals, goal), args[:n]
+		case opCut:
+			d.pos++
+			goals = append(goals, atomCut)
+		case opIs:
+			d.pos++
+			v, err := d.variable(op.operand)
+			if err != nil {
+				return nil, err
+			}
+			if len(args) != 1 {
+				return nil, errors.New("is/2 without expression")
+			}
+			goals, args = append(goals, atomIs.Apply(v, args[0])), nil
+		case opDisj, opIfThen, opSoftCut:
+			left, right, err := d.branches()
+			if err != nil {
+				return nil, err
+			}
+			if op.opcode == opDisj {
+				goals = append(goals, atomSemiColon.Apply(left, right))
+				break
+			}
+			if len(args) != 1 {
+				return nil, errors.New("if-then-else without condition")
+			}
+			arrow := atomThen
+			if op.opcode == opSoftCut {
+				arrow = atomSoftCut
+			}
+			cond := arrow.Apply(args[0], left)
+			args = nil
+			if op.opcode == opIfThen && right == atomFail {
+				goals = append(goals, cond)
+				break
+			}
+			goals = append(goals, atomSemiColon.Apply(cond, right))
+		default:
+			a, err := d.arg()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, a)
+		}
+	}
+	if len(args) > 0 {
+		return nil, errors.New("arguments without goal")
+	}
+	if len(goals) == 0 {
+		return atomTrue, nil
+	}
+	return seq(atomComma, goals...), nil
+}
+
+// branches reads the branching instruction at the position and both of its branches.
+func (d *decompiler) branches() (Term, Term, error) {
+	branch := d.pos
+	d.pos++
+	jump := branch + int(d.pc[branch].operand.(Integer))
+	if jump <= branch || jump >= len(d.pc) || d.pc[jump].opcode != opJump {
+		return nil, nil, errors.New("branch without jump")
+	}
+	left, err := d.goals(jump)
+	if err != nil {
+		return nil, nil, err
+	}
+	d.pos++
+	end := jump + 1 + int(d.pc[jump].operand.(Integer))
+	if end > len(d.pc) {
+		return nil, nil, errors.New("jump out of bytecode")
+	}
+	right, err := d.goals(end)
+	if err != nil {
+		return nil, nil, err
+	}
+	return left, right, nil
+}
@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClause_decompile(t *testing.T) {
+	var vm VM
+	vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+	vm.operators.define(1200, operatorSpecifierFX, atomIf)
+	vm.operators.define(1100, operatorSpecifierXFY, atomSemiColon)
+	vm.operators.define(1050, operatorSpecifierXFY, atomThen)
+	vm.operators.define(1050, operatorSpecifierXFY, atomSoftCut)
+	vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+	vm.operators.define(900, operatorSpecifierFY, atomNegation)
+	vm.operators.define(700, operatorSpecifierXFX, atomEqual)
+	vm.operators.define(700, operatorSpecifierXFX, atomIs)
+	vm.operators.define(700, operatorSpecifierXFX, atomGreaterThan)
+	vm.operators.define(500, operatorSpecifierYFX, atomPlus)
+	vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+	vm.operators.define(200, operatorSpecifierFY, atomMinus)
+
+	parse := func(t *testing.T, s string) Term {
+		t.Helper()
+		p := NewParser(&vm, strings.NewReader(s+"."))
+		term, err := p.Term()
+		assert.NoError(t, err)
+		return term
+	}
+
+	show := func(t Term) string {
+		var sb strings.Builder
+		_ = t.WriteTerm(&sb, &WriteOptions{ops: vm.operators, quoted: true}, nil)
+		return sb.String()
+	}
+
+	tests := []struct {
+		title  string
+		source string
+		want   []string
+	}{
+		{title: "atom", source: `foo`, want: []string{`foo`}},
+		{title: "fact", source: `foo(a, 1, 2.0, "abc", X, X, _)`, want: []string{`foo(a, 1, 2.0, "abc", X, X, _)`}},
+		{title: "compound", source: `foo(f(X, g(Y)), [a, X|T], [Y], [a|T])`, want: []string{`foo(f(X, g(Y)), [a, X|T], [Y], [a|T])`}},
+		{title: "rule", source: `foo(X) :- bar(X, Y), baz(f(Y), [a, b|Z], Z)`, want: []string{`foo(X) :- bar(X, Y), baz(f(Y), [a, b|Z], Z)`}},
+		{title: "true", source: `foo :- true`, want: []string{`foo :- true`}},
+		{title: "cut", source: `foo(X) :- bar(X), !, baz`, want: []string{`foo(X) :- bar(X), !, baz`}},
+		{title: "nested conjunction", source: `foo :- (a, b), c`, want: []string{`foo :- (a, b), c`}},
+		{title: "variable goal", source: `foo(G) :- G`, want: []string{`foo(G) :- call(G)`}},
+		{title: "is", source: `foo(X, Y) :- Y is X + 1, bar(Y)`, want: []string{`foo(X, Y) :- Y is X + 1, bar(Y)`}},
+		{title: "is bound", source: `foo(X, Y) :- Y = 1, Y is X + 1`, want: []string{`foo(X, Y) :- Y = 1, Y is X + 1`}},
+		{title: "disjunction", source: `foo(X) :- a, (b(X) ; c(X), !), d`, want: []string{`foo(X) :- a, (b(X) ; c(X), !), d`}},
+		{title: "top level disjunction", source: `foo(X) :- a(X) ; b(X)`, want: []string{`foo(X) :- a(X)`, `foo(X) :- b(X)`}},
+		{title: "if-then-else", source: `foo(X) :- (bar(X), X = 1 -> baz ; X = 2 -> qux ; true), x`, want: []string{`foo(X) :- ((bar(X), X = 1) -> baz ; (X = 2 -> qux ; true)), x`}},
+		{title: "if-then", source: `foo(X) :- (bar(X) -> baz(X)), x`, want: []string{`foo(X) :- (bar(X) -> baz(X)), x`}},
+		{title: "if-then-fail", source: `foo(X) :- (bar(X) -> baz(X) ; fail)`, want: []string{`foo(X) :- (bar(X) -> baz(X))`}},
+		{title: "soft-cut", source: `foo(X) :- (bar(X) *-> baz(X) ; qux)`, want: []string{`foo(X) :- (bar(X) *-> baz(X) ; qux)`}},
+		{title: "soft-cut without else", source: `foo(X) :- (bar(X) *-> baz(X))`, want: []string{`foo(X) :- call(bar(X)), baz(X)`}},
+		{title: "is in branch", source: `foo(X, Y) :- (X > 0 -> Y is X ; Y is -X)`, want: []string{`foo(X, Y) :- (X > 0 -> Y is X ; Y is -X)`}},
+		{title: "negation", source: `foo(X) :- \+ bar(X)`, want: []string{`foo(X) :- \+ bar(X)`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			cs, err := compile(parse(t, tt.source), nil)
+			assert.NoError(t, err)
+			assert.Len(t, cs, len(tt.want))
+			for i, c := range cs {
+				got, err := c.decompile()
+				assert.NoError(t, err)
+				assert.True(t, variant(parse(t, tt.want[i]), got, nil), "%s", show(got))
+
+				// Compiling it again results in the same bytecode.
+				rs, err := compile(got, nil)
+				assert.NoError(t, err)
+				assert.Len(t, rs, 1)
+				assert.Equal(t, c.bytecode, rs[0].bytecode)
+			}
+		})
+	}
+
+	t.Run("program", func(t *testing.T) {
+		assert.NoError(t, vm.Compile(context.Background(), `
+:- dynamic(counter/1).
+counter(0).
+append([], L, L).
+append([X|L1], L2, [X|L3]) :- append(L1, L2, L3).
+max(X, Y, Z) :- (X > Y -> Z = X ; Z = Y).
+first([X|_], X) :- !.
+first(_, none).
+codes("abc").
+walk(G, X) :- G, (X = a ; X = b, !), \+ counter(X).
+incr :- counter(N), N1 is N + 1, retract(counter(N)), assertz(counter(N1)).
+`))
+		for _, p := range vm.procedures {
+			u, ok := p.(*userDefined)
+			if !ok {
+				continue
+			}
+			for _, c := range u.clauses {
+				got, err := c.decompile()
+				assert.NoError(t, err)
+				rs, err := compile(got, nil)
+				assert.NoError(t, err)
+				assert.Len(t, rs, 1)
+				assert.Equal(t, c.bytecode, rs[0].bytecode, "%s", show(got))
+			}
+		}
+	})
+
+	t.Run("asserted", func(t *testing.T) {
+		var (
+			x, y = NewVariable(), NewVariable()
+			vm   VM
+		)
+		env := NewEnv().bind(y, NewAtom("f").Apply(x))
+		ok, err := Assertz(&vm, atomIf.Apply(NewAtom("foo").Apply(x, y), NewAtom("bar").Apply(y, NewVariable())), Success, env).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		c := vm.procedures[procedureIndicator{name: NewAtom("foo"), arity: 2}].(*userDefined).clauses[0]
+		got, err := c.decompile()
+		assert.NoError(t, err)
+		assert.True(t, variant(parse(t, `foo(X, f(X)) :- bar(f(X), _)`), got, nil), "%s", show(got))
+		assert.True(t, variant(c.raw, got, nil))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, b := range []bytecode{
+			nil,
+			{{opcode: opGetConst, operand: NewAtom("a")}},
+			{{opcode: opGetFunctor, operand: procedureIndicator{name: NewAtom("f"), arity: 1}}, {opcode: opExit}},
+			{{opcode: opGetVar, operand: Integer(1)}, {opcode: opExit}},
+			{{opcode: opEnter}, {opcode: opPutConst, operand: NewAtom("a")}, {opcode: opExit}},
+			{{opcode: opEnter}, {opcode: opDisj, operand: Integer(3)}, {opcode: opExit}},
+		} {
+			c := clause{pi: procedureIndicator{name: NewAtom("foo"), arity: 1}, bytecode: b}
+			_, err := c.decompile()
+			assert.Error(t, err)
+		}
+	})
+}
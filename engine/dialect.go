@@ -0,0 +1,192 @@
+package engine
+
+import (
+	"strings"
+)
+
+type dialect int
+
+const (
+	dialectISO dialect = iota
+	dialectCompat
+)
+
+func (d dialect) String() string {
+	return [...]string{
+		dialectISO:    "iso",
+		dialectCompat: "compat",
+	}[d]
+}
+
+// dialectShims are the non-ISO predicates from other Prolog systems which are available while
+// current_prolog_flag(dialect, compat).
+var dialectShims = map[procedureIndicator]procedure{
+	{name: atomNot, arity: 1}:                   Predicate1(Negate),
+	{name: NewAtom("concat_atom"), arity: 2}:    Predicate2(ConcatAtom),
+	{name: NewAtom("concat_atom"), arity: 3}:    Predicate3(ConcatAtomSeparator),
+	{name: NewAtom("writef"), arity: 2}:         Predicate2(Writef),
+	{name: NewAtom("string_to_atom"), arity: 2}: Predicate2(StringToAtom),
+}
+
+func modifyDialect(vm *VM, value Atom) error {
+	db := vm.database()
+	db.Lock()
+	defer db.Unlock()
+
+	switch value {
+	case atomISO:
+		// Remove the shims unless they're overridden by user-defined ones.
+		for pi := range dialectShims {
+			if _, ok := vm.procedures[pi].(*userDefined); !ok {
+				delete(vm.procedures, pi)
+			}
+		}
+		vm.dialect = dialectISO
+		vm.invalidatePurity()
+	case atomCompat:
+		if vm.procedures == nil {
+			vm.procedures = map[procedureIndicator]procedure{}
+		}
+		for pi, p := range dialectShims {
+			if _, ok := vm.procedures[pi]; !ok {
+				vm.procedures[pi] = p
+			}
+		}
+		vm.dialect = dialectCompat
+		vm.invalidatePurity()
+	default:
+		return domainError(validDomainFlagValue, atomPlus.Apply(atomDialect, value), nil)
+	}
+	return nil
+}
+
+// ConcatAtom concatenates the atomic elements of list into atom.
+func ConcatAtom(vm *VM, list, atom Term, k Cont, env *Env) *Promise {
+	return ConcatAtomSeparator(vm, list, atomEmpty, atom, k, env)
+}
+
+// ConcatAtomSeparator concatenates the atomic elements of list with separator into atom.
+// If list is not instantiated, it splits atom by separator instead.
+func ConcatAtomSeparator(vm *VM, list, separator, atom Term, k Cont, env *Env) *Promise {
+	sep, err := atomicText(separator, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	var ss []string
+	iter := ListIterator{List: list, Env: env, AllowPartial: true}
+	for iter.Next() {
+		if _, ok := env.Resolve(iter.Current()).(Variable); ok {
+			return splitAtom(vm, list, sep, atom, k, env)
+		}
+		s, err := atomicText(iter.Current(), env)
+		if err != nil {
+			return Error(err)
+		}
+		ss = append(ss, s)
+	}
+	if err := iter.Err(); err != nil {
+		return Error(err)
+	}
+	if _, ok := iter.Suffix().(Variable); ok {
+		return splitAtom(vm, list, sep, atom, k, env)
+	}
+
+	return Unify(vm, atom, newAtom(strings.Join(ss, sep), env), k, env)
+}
+
+func splitAtom(vm *VM, list Term, sep string, atom Term, k Cont, env *Env) *Promise {
+	if sep == "" {
+		return Error(InstantiationError(env))
+	}
+
+	s, err := atomicText(atom, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	var as []Term
+	for _, e := range strings.Split(s, sep) {
+		as = append(as, newAtom(e, env))
+	}
+	return Unify(vm, list, List(as...), k, env)
+}
+
+// Writef writes format to the current output stream while substituting %w and %d with the elements of args.
+// \n and \l in format are replaced by new lines.
+func Writef(vm *VM, format, args Term, k Cont, env *Env) *Promise {
+	f, err := atomicText(format, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	var as []Term
+	iter := ListIterator{List: args, Env: env}
+	for iter.Next() {
+		as = append(as, iter.Current())
+	}
+	if err := iter.Err(); err != nil {
+		return Error(err)
+	}
+
+	w, err := vm.output.textWriter()
+	if err != nil {
+		return Error(err)
+	}
+
+	opts := WriteOptions{
+		ops:        vm.operators,
+		priority:   1200,
+		numberVars: true,
+	}
+	var sb strings.Builder
+	for rs := []rune(f); len(rs) > 0; rs = rs[1:] {
+		switch {
+		case len(rs) > 1 && rs[0] == '%' && (rs[1] == 'w' || rs[1] == 'd'):
+			if len(as) == 0 {
+				return Error(domainError(validDomainNonEmptyList, List(), env))
+			}
+			if err := env.Resolve(as[0]).WriteTerm(&sb, &opts, env); err != nil {
+				return Error(err)
+			}
+			as, rs = as[1:], rs[1:]
+		case len(rs) > 1 && rs[0] == '\\' && (rs[1] == 'n' || rs[1] == 'l'):
+			_, _ = sb.WriteRune('\n')
+			rs = rs[1:]
+		default:
+			_, _ = sb.WriteRune(rs[0])
+		}
+	}
+
+	if _, err := w.Write([]byte(sb.String())); err != nil {
+		return Error(err)
+	}
+	return k(env)
+}
+
+// StringToAtom converts between str and atom. Unlike atom_string/2, str can be any text if it's instantiated.
+func StringToAtom(vm *VM, str, atom Term, k Cont, env *Env) *Promise {
+	if _, ok := env.Resolve(str).(Variable); ok {
+		return AtomString(vm, atom, str, k, env)
+	}
+
+	s, err := textOf(str, env)
+	if err != nil {
+		return Error(err)
+	}
+	return Unify(vm, atom, newAtom(s, env), k, env)
+}
+
+// atomicText returns the text of an atomic term.
+func atomicText(t Term, env *Env) (string, error) {
+	switch t := env.Resolve(t).(type) {
+	case Variable:
+		return "", InstantiationError(env)
+	case Atom:
+		return t.String(), nil
+	case Integer, Float, String:
+		return textOf(t, env)
+	default:
+		return "", typeError(validTypeAtomic, t, env)
+	}
+}
@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcatAtom(t *testing.T) {
+	x := NewVariable()
+
+	tests := []struct {
+		title     string
+		list, sep Term
+		atom      Term
+		ok        bool
+		err       error
+		env       map[Variable]Term
+	}{
+		{title: "concat", list: List(NewAtom("a"), Integer(1), Float(2.5), String("s"), atomEmptyList), sep: atomEmpty, atom: x, ok: true, env: map[Variable]Term{
+			x: NewAtom("a12.5s[]"),
+		}},
+		{title: "separator", list: List(NewAtom("a"), NewAtom("b")), sep: NewAtom(", "), atom: x, ok: true, env: map[Variable]Term{
+			x: NewAtom("a, b"),
+		}},
+		{title: "empty", list: List(), sep: NewAtom("-"), atom: x, ok: true, env: map[Variable]Term{
+			x: atomEmpty,
+		}},
+		{title: "split", list: x, sep: NewAtom("-"), atom: NewAtom("a-b-c"), ok: true, env: map[Variable]Term{
+			x: List(NewAtom("a"), NewAtom("b"), NewAtom("c")),
+		}},
+		{title: "split: partial", list: PartialList(x, NewAtom("a")), sep: NewAtom("-"), atom: NewAtom("a-b"), ok: true, env: map[Variable]Term{
+			x: List(NewAtom("b")),
+		}},
+		{title: "split: no separator", list: x, sep: atomEmpty, atom: NewAtom("abc"), err: InstantiationError(nil)},
+		{title: "split: atom is a variable", list: x, sep: NewAtom("-"), atom: NewVariable(), err: InstantiationError(nil)},
+		{title: "element is not atomic", list: List(NewAtom("f").Apply(NewAtom("a"))), sep: atomEmpty, atom: x, err: typeError(validTypeAtomic, NewAtom("f").Apply(NewAtom("a")), nil)},
+		{title: "separator is a variable", list: List(), sep: NewVariable(), atom: x, err: InstantiationError(nil)},
+		{title: "not a list", list: NewAtom("a"), sep: atomEmpty, atom: x, err: typeError(validTypeList, NewAtom("a"), nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			ok, err := ConcatAtomSeparator(nil, tt.list, tt.sep, tt.atom, func(env *Env) *Promise {
+				for k, v := range tt.env {
+					assert.Equal(t, v, env.Resolve(k))
+				}
+				return Bool(true)
+			}, nil).Force(context.Background())
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.err, err)
+		})
+	}
+
+	t.Run("without separator", func(t *testing.T) {
+		ok, err := ConcatAtom(nil, List(NewAtom("a"), NewAtom("b")), NewAtom("ab"), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+}
+
+func TestWritef(t *testing.T) {
+	tests := []struct {
+		title        string
+		format, args Term
+		ok           bool
+		err          error
+		output       string
+	}{
+		{title: "ok", format: NewAtom(`%w and %d\n`), args: List(NewAtom("a"), NewAtom("f").Apply(Integer(1))), ok: true, output: "a and f(1)\n"},
+		{title: "new line", format: NewAtom(`a\lb`), args: List(), ok: true, output: "a\nb"},
+		{title: "percent", format: NewAtom(`100%`), args: List(), ok: true, output: "100%"},
+		{title: "not enough arguments", format: NewAtom(`%w`), args: List(), err: domainError(validDomainNonEmptyList, List(), nil)},
+		{title: "format is a variable", format: NewVariable(), args: List(), err: InstantiationError(nil)},
+		{title: "args is not a list", format: NewAtom(`%w`), args: NewAtom("a"), err: typeError(validTypeList, NewAtom("a"), nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			var buf bytes.Buffer
+			var vm VM
+			vm.SetUserOutput(NewOutputTextStream(&buf))
+			ok, err := Writef(&vm, tt.format, tt.args, Success, nil).Force(context.Background())
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.output, buf.String())
+		})
+	}
+}
+
+func TestStringToAtom(t *testing.T) {
+	t.Run("string to atom", func(t *testing.T) {
+		a := NewVariable()
+		ok, err := StringToAtom(nil, String("abc"), a, func(env *Env) *Promise {
+			assert.Equal(t, NewAtom("abc"), env.Resolve(a))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("codes to atom", func(t *testing.T) {
+		ok, err := StringToAtom(nil, CodeList("abc"), NewAtom("abc"), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("atom to string", func(t *testing.T) {
+		s := NewVariable()
+		ok, err := StringToAtom(nil, s, NewAtom("abc"), func(env *Env) *Promise {
+			assert.Equal(t, String("abc"), env.Resolve(s))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("both variables", func(t *testing.T) {
+		ok, err := StringToAtom(nil, NewVariable(), NewVariable(), Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(nil), err)
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,183 @@
+package engine
+
+import (
+	"bytes"
+	"sort"
+)
+
+// ProcedureDiff is the difference of a user-defined procedure between two programs.
+type ProcedureDiff struct {
+	// Indicator is the predicate indicator of the procedure e.g. foo/1.
+	Indicator Term
+
+	// Added are the clauses only in the new program and Removed are the ones only in the old program.
+	Added, Removed []Term
+
+	// Changed are the clauses of the old program replaced by the ones of the new program in the same positions.
+	Changed []ClauseChange
+}
+
+// ClauseChange is a clause replaced by another.
+type ClauseChange struct {
+	Old, New Term
+}
+
+// DiffPrograms compares the procedures of two programs e.g. AllClauses of two VMs or ReadImageProcedures of two images.
+// It returns the differences sorted by the predicate indicators. The procedures which have the same clauses in the same
+// order are excluded. Clauses are the same if they're variants of each other.
+//
+// The clauses are matched by the longest common subsequence. Unmatched clauses between the matches are reported as
+// changed in pairs and the rest of them are reported as added or removed.
+func DiffPrograms(old, new []Procedure) []ProcedureDiff {
+	type sides struct {
+		old, new []Provenance
+	}
+	ps := map[procedureIndicator]*sides{}
+	get := func(p Procedure) *sides {
+		// The indicators are in the form of Name/Arity as Procedure.Indicator is.
+		var pi procedureIndicator
+		if c, ok := p.Indicator.(Compound); ok && c.Arity() == 2 {
+			pi.name, _ = c.Arg(0).(Atom)
+			pi.arity, _ = c.Arg(1).(Integer)
+		}
+		q, ok := ps[pi]
+		if !ok {
+			q = &sides{}
+			ps[pi] = q
+		}
+		return q
+	}
+	for _, p := range old {
+		get(p).old = p.Clauses
+	}
+	for _, p := range new {
+		get(p).new = p.Clauses
+	}
+
+	pis := make([]procedureIndicator, 0, len(ps))
+	for pi := range ps {
+		pis = append(pis, pi)
+	}
+	sort.Slice(pis, func(i, j int) bool {
+		if x, y := pis[i].name.String(), pis[j].name.String(); x != y {
+			return x < y
+		}
+		return pis[i].arity < pis[j].arity
+	})
+
+	var ds []ProcedureDiff
+	for _, pi := range pis {
+		p := ps[pi]
+		d := diffClauses(p.old, p.new)
+		if len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 {
+			continue
+		}
+		d.Indicator = pi.Term()
+		ds = append(ds, d)
+	}
+	return ds
+}
+
+func diffClauses(old, new []Provenance) ProcedureDiff {
+	// Trim the common prefix and suffix so that a small change to a large table of facts is cheap.
+	var pre int
+	for pre < len(old) && pre < len(new) && variant(old[pre].Clause, new[pre].Clause, nil) {
+		pre++
+	}
+	old, new = old[pre:], new[pre:]
+	var suf int
+	for suf < len(old) && suf < len(new) && variant(old[len(old)-1-suf].Clause, new[len(new)-1-suf].Clause, nil) {
+		suf++
+	}
+	old, new = old[:len(old)-suf], new[:len(new)-suf]
+
+	// lcs[i][j] is the length of the longest common subsequence of old[i:] and new[j:].
+	lcs := make([][]int, len(old)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(new)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(new) - 1; j >= 0; j-- {
+			switch {
+			case variant(old[i].Clause, new[j].Clause, nil):
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var (
+		d              ProcedureDiff
+		removed, added []Term
+	)
+	flush := func() {
+		for len(removed) > 0 && len(added) > 0 {
+			d.Changed = append(d.Changed, ClauseChange{Old: removed[0], New: added[0]})
+			removed, added = removed[1:], added[1:]
+		}
+		d.Removed = append(d.Removed, removed...)
+		d.Added = append(d.Added, added...)
+		removed, added = nil, nil
+	}
+	i, j := 0, 0
+	for i < len(old) || j < len(new) {
+		switch {
+		case i < len(old) && j < len(new) && variant(old[i].Clause, new[j].Clause, nil):
+			flush()
+			i++
+			j++
+		case j == len(new) || (i < len(old) && lcs[i+1][j] >= lcs[i][j+1]):
+			removed = append(removed, old[i].Clause)
+			i++
+		default:
+			added = append(added, new[j].Clause)
+			j++
+		}
+	}
+	flush()
+	return d
+}
+
+// DiffProgram compares two programs and unifies diff with the list of the differences of the procedures in the form of
+// diff(PI, Added, Removed, Changed) where Changed is a list of Old-New.
+// A program is either the atom user for the database of vm or the file name of an image written by SaveImage or
+// SaveSession.
+func DiffProgram(vm *VM, old, new, diff Term, k Cont, env *Env) *Promise {
+	o, err := vm.program(old, env)
+	if err != nil {
+		return Error(err)
+	}
+	n, err := vm.program(new, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	ds := DiffPrograms(o, n)
+	ts := make([]Term, len(ds))
+	for i, d := range ds {
+		cs := make([]Term, len(d.Changed))
+		for j, c := range d.Changed {
+			cs[j] = pair(c.Old, c.New)
+		}
+		ts[i] = atomDiff.Apply(d.Indicator, List(d.Added...), List(d.Removed...), List(cs...))
+	}
+	return Unify(vm, diff, List(ts...), k, env)
+}
+
+func (vm *VM) program(p Term, env *Env) ([]Procedure, error) {
+	if p, ok := env.Resolve(p).(Atom); ok && p == atomUser {
+		return vm.AllClauses(), nil
+	}
+	_, b, err := vm.open(p, env)
+	if err != nil {
+		return nil, err
+	}
+	ps, err := ReadImageProcedures(bytes.NewReader(b))
+	if err != nil {
+		return nil, domainError(validDomainImage, p, env)
+	}
+	return ps, nil
+}
@@ -0,0 +1,131 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffPrograms(t *testing.T) {
+	compile := func(text string) *VM {
+		var vm VM
+		vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+		vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+		assert.NoError(t, vm.Compile(context.Background(), text))
+		return &vm
+	}
+
+	old := compile(`
+same(X) :- foo(X).
+fact(a).
+fact(b).
+fact(c).
+fact(d).
+rule(X) :- foo(X).
+rule(X) :- bar(X).
+gone.
+`)
+	new := compile(`
+same(Y) :- foo(Y).
+fact(a).
+fact(c).
+fact(d).
+fact(e).
+rule(X) :- foo(X), baz(X).
+rule(X) :- bar(X).
+rule(X) :- qux(X).
+born.
+`)
+
+	x := NewVariable()
+	ds := DiffPrograms(old.AllClauses(), new.AllClauses())
+	assert.Len(t, ds, 4)
+	assert.Equal(t, ProcedureDiff{
+		Indicator: atomSlash.Apply(NewAtom("born"), Integer(0)),
+		Added:     []Term{NewAtom("born")},
+	}, ds[0])
+	assert.Equal(t, ProcedureDiff{
+		Indicator: atomSlash.Apply(NewAtom("fact"), Integer(1)),
+		Added:     []Term{NewAtom("fact").Apply(NewAtom("e"))},
+		Removed:   []Term{NewAtom("fact").Apply(NewAtom("b"))},
+	}, ds[1])
+	assert.Equal(t, ProcedureDiff{
+		Indicator: atomSlash.Apply(NewAtom("gone"), Integer(0)),
+		Removed:   []Term{NewAtom("gone")},
+	}, ds[2])
+
+	assert.Equal(t, atomSlash.Apply(NewAtom("rule"), Integer(1)), ds[3].Indicator)
+	assert.Len(t, ds[3].Added, 1)
+	assert.True(t, variant(atomIf.Apply(NewAtom("rule").Apply(x), NewAtom("qux").Apply(x)), ds[3].Added[0], nil))
+	assert.Empty(t, ds[3].Removed)
+	assert.Len(t, ds[3].Changed, 1)
+	assert.True(t, variant(atomIf.Apply(NewAtom("rule").Apply(x), NewAtom("foo").Apply(x)), ds[3].Changed[0].Old, nil))
+	assert.True(t, variant(atomIf.Apply(NewAtom("rule").Apply(x), seq(atomComma, NewAtom("foo").Apply(x), NewAtom("baz").Apply(x))), ds[3].Changed[0].New, nil))
+
+	assert.Empty(t, DiffPrograms(old.AllClauses(), old.AllClauses()))
+}
+
+func TestDiffProgram(t *testing.T) {
+	var vm VM
+	vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+	vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+	assert.NoError(t, vm.Compile(context.Background(), `
+foo(a).
+foo(b).
+`))
+	var buf bytes.Buffer
+	assert.NoError(t, vm.SaveImage(&buf))
+	vm.FS = fstest.MapFS{
+		"old.img":     &fstest.MapFile{Data: buf.Bytes()},
+		"corrupt.img": &fstest.MapFile{Data: []byte("foo")},
+	}
+	assert.NoError(t, vm.Compile(context.Background(), `
+foo(a).
+foo(c).
+bar.
+`))
+
+	t.Run("ok", func(t *testing.T) {
+		diff := NewVariable()
+		ok, err := DiffProgram(&vm, NewAtom("old.img"), atomUser, diff, func(env *Env) *Promise {
+			assert.Equal(t, List(
+				atomDiff.Apply(atomSlash.Apply(NewAtom("bar"), Integer(0)), List(NewAtom("bar")), List(), List()),
+				atomDiff.Apply(atomSlash.Apply(NewAtom("foo"), Integer(1)), List(), List(), List(
+					pair(NewAtom("foo").Apply(NewAtom("b")), NewAtom("foo").Apply(NewAtom("c"))),
+				)),
+			), env.Resolve(diff))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("same", func(t *testing.T) {
+		ok, err := DiffProgram(&vm, atomUser, atomUser, List(), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("old is a variable", func(t *testing.T) {
+		_, err := DiffProgram(&vm, NewVariable(), atomUser, NewVariable(), Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(nil), err)
+	})
+
+	t.Run("new is neither a variable nor an atom", func(t *testing.T) {
+		_, err := DiffProgram(&vm, atomUser, Integer(0), NewVariable(), Success, nil).Force(context.Background())
+		assert.Equal(t, typeError(validTypeAtom, Integer(0), nil), err)
+	})
+
+	t.Run("no such file", func(t *testing.T) {
+		_, err := DiffProgram(&vm, NewAtom("missing.img"), atomUser, NewVariable(), Success, nil).Force(context.Background())
+		assert.Equal(t, existenceError(objectTypeSourceSink, NewAtom("missing.img"), nil), err)
+	})
+
+	t.Run("not an image", func(t *testing.T) {
+		_, err := DiffProgram(&vm, NewAtom("corrupt.img"), atomUser, NewVariable(), Success, nil).Force(context.Background())
+		assert.Equal(t, domainError(validDomainImage, NewAtom("corrupt.img"), nil), err)
+	})
+}
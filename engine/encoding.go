@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"io"
+	"unicode/utf8"
+)
+
+// A Prolog text is read in the encoding of current_prolog_flag(encoding, E) which is utf8 by default.
+// A directive :- encoding(E). switches the encoding for the rest of the text so that legacy files in ISO Latin-1 can be
+// consulted as they are. Since the bytes are decoded into characters before they're tokenized, the characters in
+// errors and in the atoms read are the same as the ones in UTF-8 texts.
+
+type encoding int
+
+const (
+	encodingUTF8 encoding = iota
+	encodingISOLatin1
+)
+
+func (e encoding) String() string {
+	return [...]string{
+		encodingUTF8:      "utf8",
+		encodingISOLatin1: "iso_latin_1",
+	}[e]
+}
+
+// encodingOf returns the encoding named a. latin_1 is an alias of iso_latin_1.
+func encodingOf(a Atom) (encoding, bool) {
+	switch a {
+	case atomUTF8:
+		return encodingUTF8, true
+	case atomISOLatin1, atomLatin1:
+		return encodingISOLatin1, true
+	default:
+		return 0, false
+	}
+}
+
+func modifyEncoding(vm *VM, value Atom) error {
+	e, ok := encodingOf(value)
+	if !ok {
+		return domainError(validDomainFlagValue, atomPlus.Apply(atomEncoding, value), nil)
+	}
+	vm.encoding = e
+	return nil
+}
+
+// decoder reads the characters of a Prolog text in the encoding which may change in the middle of the text.
+type decoder struct {
+	s   string
+	enc encoding
+}
+
+func (d *decoder) ReadRune() (rune, int, error) {
+	if len(d.s) == 0 {
+		return 0, 0, io.EOF
+	}
+	switch d.enc {
+	case encodingISOLatin1:
+		r := rune(d.s[0])
+		d.s = d.s[1:]
+		return r, 1, nil
+	default:
+		r, n := utf8.DecodeRuneInString(d.s)
+		d.s = d.s[n:]
+		return r, n, nil
+	}
+}
+
+// setEncoding switches the encoding of the rest of the text as :- encoding(E).
+func (t *text) setEncoding(e Term) error {
+	switch e := e.(type) {
+	case Variable:
+		return InstantiationError(nil)
+	case Atom:
+		enc, ok := encodingOf(e)
+		if !ok {
+			return domainError(validDomainEncoding, e, nil)
+		}
+		t.decoder.enc = enc
+		return nil
+	default:
+		return typeError(validTypeAtom, e, nil)
+	}
+}
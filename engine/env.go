@@ -1,47 +1,32 @@
 package engine
 
+import "sync"
+
 var varContext = NewVariable()
 
 var rootContext = NewAtom("root")
 
-type envKey int64
-
-func newEnvKey(v Variable) envKey {
-	// A new Variable is always bigger than the previous ones.
-	// So, if we used the Variable itself as the key, insertions to the Env tree would be skewed to the right.
-	k := envKey(v)
-	if k/2 != 0 {
-		k *= -1
-	}
-	return k
-}
-
-type color uint8
-
-const (
-	red color = iota
-	black
-)
-
 // Env is a mapping from variables to terms.
+//
+// Env is persistent; binding a variable returns a new Env and leaves the original one intact. Instead of copying a
+// path of a tree for every binding, the Envs derived from the same Env share a store of bindings. Only one of them
+// is the current version of the store. The others are the differences from another version (Baker's rerooting).
+// Accessing an older version, e.g. on backtracking, rewinds the store to it by reverting the differences in between
+// just like undoing a trail. So a binding costs only one allocation of Env.
 type Env struct {
-	// basically, this is Red-Black tree from Purely Functional Data Structures by Okazaki.
-	color       color
-	left, right *Env
-	binding
-}
+	store *envStore
 
-type binding struct {
-	key   envKey
-	value Term
-	// attributes?
+	// next is nil if the Env is the current version of the store.
+	// Otherwise, the Env is next with variable bound to value, or unbound if value is nil.
+	next     *Env
+	variable Variable
+	value    Term
 }
 
-var rootEnv = &Env{
-	binding: binding{
-		key:   newEnvKey(varContext),
-		value: rootContext,
-	},
+// envStore is the bindings of the current version of Envs.
+type envStore struct {
+	mu       sync.Mutex
+	bindings map[Variable]Term
 }
 
 // NewEnv creates an empty environment.
@@ -51,141 +36,108 @@ func NewEnv() *Env {
 
 // lookup returns a term that the given variable is bound to.
 func (e *Env) lookup(v Variable) (Term, bool) {
-	k := newEnvKey(v)
-
-	node := e
-	if node == nil {
-		node = rootEnv
-	}
-	for {
-		if node == nil {
-			return nil, false
-		}
-		switch {
-		case k < node.key:
-			node = node.left
-		case k > node.key:
-			node = node.right
-		default:
-			return node.value, true
+	if e == nil {
+		if v == varContext {
+			return rootContext, true
 		}
+		return nil, false
 	}
+
+	s := e.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.reroot()
+	t, ok := s.bindings[v]
+	return t, ok
 }
 
 // bind adds a new entry to the environment.
 func (e *Env) bind(v Variable, t Term) *Env {
-	k := newEnvKey(v)
-
-	node := e
-	if node == nil {
-		node = rootEnv
+	if e == nil {
+		e = &Env{store: &envStore{bindings: map[Variable]Term{varContext: rootContext}}}
 	}
-	ret := *node.insert(k, t)
-	ret.color = black
-	return &ret
+
+	s := e.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.reroot()
+	ret := &Env{store: s}
+	e.next, e.variable, e.value = ret, v, s.bindings[v]
+	s.bindings[v] = t
+	return ret
 }
 
-func (e *Env) insert(k envKey, v Term) *Env {
-	if e == nil {
-		return &Env{color: red, binding: binding{key: k, value: v}}
+// reroot makes e the current version of the store. The store must be locked.
+func (e *Env) reroot() {
+	if e.next == nil {
+		return
 	}
-	switch {
-	case k < e.key:
-		ret := *e
-		ret.left = e.left.insert(k, v)
-		ret.balance()
-		return &ret
-	case k > e.key:
-		ret := *e
-		ret.right = e.right.insert(k, v)
-		ret.balance()
-		return &ret
-	default:
-		ret := *e
-		ret.value = v
-		return &ret
+
+	// Reverse the chain of the differences from e to the current version.
+	var cur *Env
+	for n := e; n != nil; {
+		next := n.next
+		n.next = cur
+		cur, n = n, next
 	}
-}
 
-func (e *Env) balance() {
-	var (
-		a, b, c, d *Env
-		x, y, z    binding
-	)
-	switch {
-	case e.left != nil && e.left.color == red:
-		switch {
-		case e.left.left != nil && e.left.left.color == red:
-			a = e.left.left.left
-			b = e.left.left.right
-			c = e.left.right
-			d = e.right
-			x = e.left.left.binding
-			y = e.left.binding
-			z = e.binding
-		case e.left.right != nil && e.left.right.color == red:
-			a = e.left.left
-			b = e.left.right.left
-			c = e.left.right.right
-			d = e.right
-			x = e.left.binding
-			y = e.left.right.binding
-			z = e.binding
-		default:
-			return
+	// Then, walk back from the current version to e while reverting the differences.
+	bs := e.store.bindings
+	for cur != e {
+		n := cur.next
+		old, ok := bs[n.variable]
+		if !ok {
+			old = nil
 		}
-	case e.right != nil && e.right.color == red:
-		switch {
-		case e.right.left != nil && e.right.left.color == red:
-			a = e.left
-			b = e.right.left.left
-			c = e.right.left.right
-			d = e.right.right
-			x = e.binding
-			y = e.right.left.binding
-			z = e.right.binding
-		case e.right.right != nil && e.right.right.color == red:
-			a = e.left
-			b = e.right.left
-			c = e.right.right.left
-			d = e.right.right.right
-			x = e.binding
-			y = e.right.binding
-			z = e.right.right.binding
-		default:
-			return
+		if n.value == nil {
+			delete(bs, n.variable)
+		} else {
+			bs[n.variable] = n.value
 		}
-	default:
-		return
+		cur.variable, cur.value = n.variable, old
+		cur = n
 	}
-	*e = Env{
-		color:   red,
-		left:    &Env{color: black, left: a, right: b, binding: x},
-		right:   &Env{color: black, left: c, right: d, binding: z},
-		binding: y,
+	e.value = nil
+}
+
+// detach returns a copy of e which doesn't share the store with e.
+// The copy is for another goroutine so that the goroutines don't rewind the same store back and forth.
+func (e *Env) detach() *Env {
+	if e == nil {
+		return nil
 	}
+
+	s := e.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.reroot()
+	bs := make(map[Variable]Term, len(s.bindings))
+	for v, t := range s.bindings {
+		bs[v] = t
+	}
+	return &Env{store: &envStore{bindings: bs}}
 }
 
 // Resolve follows the variable chain and returns the first non-variable term or the last free variable.
 func (e *Env) Resolve(t Term) Term {
-	var stop []Variable
+	var buf [4]Variable // Long chains are rare. Avoid allocating for the short ones.
+	stop := buf[:0]
 	for t != nil {
-		switch v := t.(type) {
-		case Variable:
-			for _, s := range stop {
-				if v == s {
-					return v
-				}
-			}
-			ref, ok := e.lookup(v)
-			if !ok {
-				return v
+		v, ok := t.(Variable)
+		if !ok {
+			return t
+		}
+		for _, s := range stop {
+			if v == s {
+				return t
 			}
-			stop = append(stop, v)
-			t = ref
-		default:
-			return v
 		}
+		ref, ok := e.lookup(v)
+		if !ok {
+			return t
+		}
+		stop = append(stop, v)
+		t = ref
 	}
 	return nil
 }
@@ -268,6 +220,29 @@ func (e *Env) unifyWithOccursCheck(x, y Term) (*Env, bool) {
 	return e.unify(x, y, true)
 }
 
+// unifyPacked unifies packed lists x and y by comparing their texts at once instead of cell by cell.
+// If either of them is not a packed list, handled is false.
+func (e *Env) unifyPacked(x, y Term, occursCheck bool) (env *Env, ok, handled bool) {
+	sx, tx, cx, ok := unpack(x)
+	if !ok {
+		return e, false, false
+	}
+	sy, ty, cy, ok := unpack(y)
+	if !ok || cx != cy {
+		return e, false, false
+	}
+
+	n := len(sx)
+	if len(sy) < n {
+		n = len(sy)
+	}
+	if sx[:n] != sy[:n] {
+		return e, false, true
+	}
+	env, ok = e.unify(packedList(sx[n:], tx, cx), packedList(sy[n:], ty, cy), occursCheck)
+	return env, ok, true
+}
+
 func (e *Env) unify(x, y Term, occursCheck bool) (*Env, bool) {
 	x, y = e.Resolve(x), e.Resolve(y)
 	switch x := x.(type) {
@@ -285,6 +260,9 @@ func (e *Env) unify(x, y Term, occursCheck bool) (*Env, bool) {
 		case Variable:
 			return e.unify(y, x, occursCheck)
 		case Compound:
+			if e, ok, handled := e.unifyPacked(x, y, occursCheck); handled {
+				return e, ok
+			}
 			if x.Functor() != y.Functor() {
 				return e, false
 			}
@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"testing"
@@ -9,22 +10,56 @@ import (
 )
 
 func TestEnv_Bind(t *testing.T) {
-	a := NewVariable()
+	a, b := NewVariable(), NewVariable()
 
 	var env *Env
-	assert.Equal(t, &Env{
-		color: black,
-		left: &Env{
-			binding: binding{
-				key:   newEnvKey(a),
-				value: NewAtom("a"),
-			},
-		},
-		binding: binding{
-			key:   newEnvKey(varContext),
-			value: NewAtom("root"),
-		},
-	}, env.bind(a, NewAtom("a")))
+	env1 := env.bind(a, NewAtom("a"))
+	env2 := env1.bind(b, NewAtom("b"))
+	env3 := env1.bind(b, NewAtom("c"))
+	env4 := env2.bind(a, NewAtom("d"))
+
+	// Access them back and forth so that the store is rewound to each of them.
+	for i := 0; i < 2; i++ {
+		for _, tt := range []struct {
+			env  *Env
+			a, b Term
+		}{
+			{env: env},
+			{env: env1, a: NewAtom("a")},
+			{env: env2, a: NewAtom("a"), b: NewAtom("b")},
+			{env: env3, a: NewAtom("a"), b: NewAtom("c")},
+			{env: env4, a: NewAtom("d"), b: NewAtom("b")},
+		} {
+			v, ok := tt.env.lookup(a)
+			assert.Equal(t, tt.a != nil, ok)
+			assert.Equal(t, tt.a, v)
+			v, ok = tt.env.lookup(b)
+			assert.Equal(t, tt.b != nil, ok)
+			assert.Equal(t, tt.b, v)
+			v, ok = tt.env.lookup(varContext)
+			assert.True(t, ok)
+			assert.Equal(t, rootContext, v)
+		}
+	}
+}
+
+func TestEnv_Detach(t *testing.T) {
+	a, b := NewVariable(), NewVariable()
+
+	env := NewEnv().bind(a, NewAtom("a"))
+	d := env.detach()
+	_ = env.bind(b, NewAtom("b"))
+	d = d.bind(b, NewAtom("c"))
+
+	v, ok := d.lookup(a)
+	assert.True(t, ok)
+	assert.Equal(t, NewAtom("a"), v)
+	v, ok = d.lookup(b)
+	assert.True(t, ok)
+	assert.Equal(t, NewAtom("c"), v)
+	_, ok = env.lookup(b)
+	assert.False(t, ok)
+	assert.NotSame(t, env.store, d.store)
 }
 
 func TestEnv_Lookup(t *testing.T) {
@@ -73,6 +108,49 @@ func TestEnv_Simplify(t *testing.T) {
 	assert.Equal(t, 2, suffix.Arity())
 }
 
+func TestEnv_Unify(t *testing.T) {
+	t.Run("packed lists", func(t *testing.T) {
+		x, y := NewVariable(), NewVariable()
+
+		tests := []struct {
+			title string
+			x, y  Term
+			ok    bool
+			env   map[Variable]Term
+		}{
+			{title: "same", x: CodeList("abc"), y: CodeList("abc"), ok: true},
+			{title: "different", x: CodeList("abc"), y: CodeList("abd"), ok: false},
+			{title: "different kinds", x: CodeList("abc"), y: CharList("abc"), ok: false},
+			{title: "prefix", x: PartialCodeList("ab", x), y: CodeList("abc"), ok: true, env: map[Variable]Term{
+				x: CodeList("c"),
+			}},
+			{title: "whole", x: PartialCodeList("abc", x), y: CodeList("abc"), ok: true, env: map[Variable]Term{
+				x: atomEmptyList,
+			}},
+			{title: "longer prefix", x: PartialCharList("abc", x), y: PartialCharList("a", y), ok: true, env: map[Variable]Term{
+				y: PartialCharList("bc", x),
+			}},
+			{title: "too short", x: PartialCodeList("abcd", x), y: CodeList("abc"), ok: false},
+			{title: "multibyte", x: PartialCharList("αβ", x), y: CharList("αβγ"), ok: true, env: map[Variable]Term{
+				x: CharList("γ"),
+			}},
+			{title: "cells", x: PartialCodeList("ab", x), y: List(Integer('a'), Integer('b'), Integer('c')), ok: true, env: map[Variable]Term{
+				x: List(Integer('c')),
+			}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.title, func(t *testing.T) {
+				env, ok := NewEnv().Unify(tt.x, tt.y)
+				assert.Equal(t, tt.ok, ok)
+				for v, e := range tt.env {
+					assert.Equal(t, 0, e.Compare(env.Resolve(v), env))
+				}
+			})
+		}
+	})
+}
+
 func TestContains(t *testing.T) {
 	var env *Env
 	assert.True(t, contains(NewAtom("a"), NewAtom("a"), env))
@@ -84,3 +162,63 @@ func TestContains(t *testing.T) {
 	assert.True(t, contains(&compound{functor: NewAtom("f"), args: []Term{NewAtom("a")}}, NewAtom("a"), env))
 	assert.False(t, contains(&compound{functor: NewAtom("f")}, NewAtom("a"), env))
 }
+
+// BenchmarkEnv measures the bindings of the variables on the classic list-processing programs.
+// Run with -benchmem to see the allocations per inference.
+func BenchmarkEnv(b *testing.B) {
+	var vm VM
+	vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+	vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+	if err := vm.Compile(context.Background(), `
+app([], L, L).
+app([X|L1], L2, [X|L3]) :- app(L1, L2, L3).
+
+nrev([], []).
+nrev([X|L0], L) :- nrev(L0, L1), app(L1, [X], L).
+
+rev(L0, L) :- rev(L0, [], L).
+rev([], L, L).
+rev([X|L0], A, L) :- rev(L0, [X|A], L).
+`); err != nil {
+		b.Fatal(err)
+	}
+
+	list := func(n int) Term {
+		ts := make([]Term, n)
+		for i := range ts {
+			ts[i] = Integer(i)
+		}
+		return List(ts...)
+	}
+
+	for _, tt := range []struct {
+		name string
+		goal Atom
+		args func() []Term
+	}{
+		{name: "append 100k", goal: NewAtom("app"), args: func() []Term {
+			return []Term{list(100_000), List(), NewVariable()}
+		}},
+		{name: "reverse 100k", goal: NewAtom("rev"), args: func() []Term {
+			return []Term{list(100_000), NewVariable()}
+		}},
+		{name: "naive reverse 1k", goal: NewAtom("nrev"), args: func() []Term {
+			return []Term{list(1_000), NewVariable()}
+		}},
+	} {
+		b.Run(tt.name, func(b *testing.B) {
+			args := tt.args()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ok, err := vm.Arrive(tt.goal, args, Success, nil).Force(context.Background())
+				if err != nil {
+					b.Fatal(err)
+				}
+				if !ok {
+					b.Fatal("failed")
+				}
+			}
+		})
+	}
+}
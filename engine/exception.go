@@ -4,9 +4,14 @@ import (
 	"bytes"
 )
 
+// errorMaxDepth bounds the depth of the terms written in error messages so that a huge culprit doesn't make
+// an unreadable message.
+const errorMaxDepth = 10
+
 // Exception is an error represented by a prolog term.
 type Exception struct {
-	term Term
+	term      Term
+	backtrace *backtrace
 }
 
 // NewException creates an Exception from a copy of the given Term.
@@ -15,7 +20,7 @@ func NewException(term Term, env *Env) Exception {
 	if err != nil {
 		return err.(Exception) // Must be error(resource_error(memory), _).
 	}
-	return Exception{term: c}
+	return Exception{term: c, backtrace: backtraceOf(env)}
 }
 
 // Term returns the underlying Term of the Exception.
@@ -23,12 +28,65 @@ func (e Exception) Term() Term {
 	return e.term
 }
 
+// Backtrace returns the procedures which were being executed when the Exception was raised from the innermost.
+// It returns nil unless the backtrace was tracked. See VM.TrackBacktrace.
+func (e Exception) Backtrace() []Frame {
+	if e.backtrace == nil {
+		return nil
+	}
+	return append([]Frame(nil), e.backtrace.frames...)
+}
+
+// Error returns the written form of the underlying Term.
+// Its variables are named _A, _B, ... in the order of appearance so that the message is stable.
 func (e Exception) Error() string {
+	opts := defaultWriteOptions
+	opts.maxDepth = errorMaxDepth
+	opts.variableNames = map[Variable]Atom{}
+	for i, v := range appendVisibleVariables(nil, e.term, opts.maxDepth) {
+		var buf bytes.Buffer
+		_, _ = buf.WriteString("_")
+		_ = writeCompoundNumberVars(&buf, Integer(i))
+		opts.variableNames[v] = NewAtom(buf.String())
+	}
+
 	var buf bytes.Buffer
-	_ = e.term.WriteTerm(&buf, &defaultWriteOptions, nil)
+	_ = e.term.WriteTerm(&buf, &opts, nil)
 	return buf.String()
 }
 
+// appendVisibleVariables appends the variables in t which are written within maxDepth.
+// As well as the writer, the elements of a list get deeper one by one.
+func appendVisibleVariables(vs []Variable, t Term, maxDepth Integer) []Variable {
+	switch t := t.(type) {
+	case Variable:
+		for _, v := range vs {
+			if v == t {
+				return vs
+			}
+		}
+		return append(vs, t)
+	case Compound:
+		if t.Functor() == atomDot && t.Arity() == 2 {
+			if maxDepth == 0 {
+				return vs
+			}
+			vs = appendVisibleVariables(vs, t.Arg(0), maxDepth)
+			return appendVisibleVariables(vs, t.Arg(1), maxDepth-1)
+		}
+		maxDepth--
+		if maxDepth == 0 {
+			return vs
+		}
+		for i := 0; i < t.Arity(); i++ {
+			vs = appendVisibleVariables(vs, t.Arg(i), maxDepth)
+		}
+		return vs
+	default:
+		return vs
+	}
+}
+
 // InstantiationError returns an instantiation error exception.
 func InstantiationError(env *Env) Exception {
 	return NewException(atomError.Apply(atomInstantiationError, varContext), env)
@@ -53,6 +111,9 @@ const (
 	validTypePredicateIndicator
 	validTypePair
 	validTypeFloat
+	validTypeText
+	validTypeDBReference
+	validTypeFrame
 )
 
 var validTypeAtoms = [...]Atom{
@@ -71,14 +132,39 @@ var validTypeAtoms = [...]Atom{
 	validTypePredicateIndicator: atomPredicateIndicator,
 	validTypePair:               atomPair,
 	validTypeFloat:              atomFloat,
-}
+	validTypeText:               atomText,
+	validTypeDBReference:        atomDBReference,
+	validTypeFrame:              atomFrame,
+}
+
+// Valid types of type errors. Pass one of them to TypeError as typ.
+var (
+	ValidTypeAtom               = atomAtom
+	ValidTypeAtomic             = atomAtomic
+	ValidTypeByte               = atomByte
+	ValidTypeCallable           = atomCallable
+	ValidTypeCharacter          = atomCharacter
+	ValidTypeCompound           = atomCompound
+	ValidTypeEvaluable          = atomEvaluable
+	ValidTypeInByte             = atomInByte
+	ValidTypeInCharacter        = atomInCharacter
+	ValidTypeInteger            = atomInteger
+	ValidTypeList               = atomList
+	ValidTypeNumber             = atomNumber
+	ValidTypePredicateIndicator = atomPredicateIndicator
+	ValidTypePair               = atomPair
+	ValidTypeFloat              = atomFloat
+	ValidTypeText               = atomText
+	ValidTypeDBReference        = atomDBReference
+	ValidTypeFrame              = atomFrame
+)
 
 // Term returns an Atom for the validType.
 func (t validType) Term() Term {
 	return validTypeAtoms[t]
 }
 
-// TypeError creates a new type error exception.
+// TypeError creates a new type error exception e.g. TypeError(ValidTypeInteger, foo, env).
 func TypeError(typ, culprit Term, env *Env) Exception {
 	return NewException(atomError.Apply(atomTypeError.Apply(typ, culprit), varContext), env)
 }
@@ -111,6 +197,18 @@ const (
 	validDomainWriteOption
 
 	validDomainOrder
+	validDomainAggregateSpec
+	validDomainPredicateProperty
+	validDomainHashAlgorithm
+	validDomainTimeZone
+	validDomainDate
+	validDomainFormat
+	validDomainMessageKind
+	validDomainSchemaType
+	validDomainImage
+	validDomainEncoding
+	validDomainFallback
+	validDomainFrameAttribute
 )
 
 var validDomainAtoms = [...]Atom{
@@ -132,14 +230,60 @@ var validDomainAtoms = [...]Atom{
 	validDomainStreamProperty:    atomStreamProperty,
 	validDomainWriteOption:       atomWriteOption,
 	validDomainOrder:             atomOrder,
-}
+	validDomainAggregateSpec:     atomAggregateSpec,
+	validDomainPredicateProperty: atomPredicateProperty,
+	validDomainHashAlgorithm:     atomHashAlgorithm,
+	validDomainTimeZone:          atomTimeZone,
+	validDomainDate:              atomDate,
+	validDomainFormat:            atomFormat,
+	validDomainMessageKind:       atomMessageKind,
+	validDomainSchemaType:        atomSchemaType,
+	validDomainImage:             atomImage,
+	validDomainEncoding:          atomEncoding,
+	validDomainFallback:          atomFallback,
+	validDomainFrameAttribute:    atomFrameAttribute,
+}
+
+// Valid domains of domain errors. Pass one of them to DomainError as domain.
+var (
+	ValidDomainCharacterCodeList = atomCharacterCodeList
+	ValidDomainCloseOption       = atomCloseOption
+	ValidDomainFlagValue         = atomFlagValue
+	ValidDomainIOMode            = atomIOMode
+	ValidDomainNonEmptyList      = atomNonEmptyList
+	ValidDomainNotLessThanZero   = atomNotLessThanZero
+	ValidDomainOperatorPriority  = atomOperatorPriority
+	ValidDomainOperatorSpecifier = atomOperatorSpecifier
+	ValidDomainPrologFlag        = atomPrologFlag
+	ValidDomainReadOption        = atomReadOption
+	ValidDomainSourceSink        = atomSourceSink
+	ValidDomainStream            = atomStream
+	ValidDomainStreamOption      = atomStreamOption
+	ValidDomainStreamOrAlias     = atomStreamOrAlias
+	ValidDomainStreamPosition    = atomStreamPosition
+	ValidDomainStreamProperty    = atomStreamProperty
+	ValidDomainWriteOption       = atomWriteOption
+	ValidDomainOrder             = atomOrder
+	ValidDomainAggregateSpec     = atomAggregateSpec
+	ValidDomainPredicateProperty = atomPredicateProperty
+	ValidDomainHashAlgorithm     = atomHashAlgorithm
+	ValidDomainTimeZone          = atomTimeZone
+	ValidDomainDate              = atomDate
+	ValidDomainFormat            = atomFormat
+	ValidDomainMessageKind       = atomMessageKind
+	ValidDomainSchemaType        = atomSchemaType
+	ValidDomainImage             = atomImage
+	ValidDomainEncoding          = atomEncoding
+	ValidDomainFallback          = atomFallback
+	ValidDomainFrameAttribute    = atomFrameAttribute
+)
 
 // Term returns an Atom for the validDomain.
 func (vd validDomain) Term() Term {
 	return validDomainAtoms[vd]
 }
 
-// DomainError creates a new domain error exception.
+// DomainError creates a new domain error exception e.g. DomainError(ValidDomainNotLessThanZero, -1, env).
 func DomainError(domain, culprit Term, env *Env) Exception {
 	return NewException(atomError.Apply(atomDomainError.Apply(domain, culprit), varContext), env)
 }
@@ -156,22 +300,43 @@ const (
 	objectTypeProcedure objectType = iota
 	objectTypeSourceSink
 	objectTypeStream
+	objectTypeDBReference
+	objectTypeGenerator
+	objectTypeResumableQuery
 )
 
 var objectTypeAtoms = [...]Atom{
-	objectTypeProcedure:  atomProcedure,
-	objectTypeSourceSink: atomSourceSink,
-	objectTypeStream:     atomStream,
-}
+	objectTypeProcedure:      atomProcedure,
+	objectTypeSourceSink:     atomSourceSink,
+	objectTypeStream:         atomStream,
+	objectTypeDBReference:    atomDBReference,
+	objectTypeGenerator:      atomGenerator,
+	objectTypeResumableQuery: atomResumableQuery,
+}
+
+// Object types of existence errors. Pass one of them to ExistenceError as objectType.
+var (
+	ObjectTypeProcedure      = atomProcedure
+	ObjectTypeSourceSink     = atomSourceSink
+	ObjectTypeStream         = atomStream
+	ObjectTypeDBReference    = atomDBReference
+	ObjectTypeGenerator      = atomGenerator
+	ObjectTypeResumableQuery = atomResumableQuery
+)
 
 // Term returns an Atom for the objectType.
 func (ot objectType) Term() Term {
 	return objectTypeAtoms[ot]
 }
 
+// ExistenceError creates a new existence error exception e.g. ExistenceError(ObjectTypeProcedure, foo/1, env).
+func ExistenceError(objectType, culprit Term, env *Env) Exception {
+	return NewException(atomError.Apply(atomExistenceError.Apply(objectType, culprit), varContext), env)
+}
+
 // existenceError creates a new existence error exception.
 func existenceError(objectType objectType, culprit Term, env *Env) Exception {
-	return NewException(atomError.Apply(atomExistenceError.Apply(objectType.Term(), culprit), varContext), env)
+	return ExistenceError(objectType.Term(), culprit, env)
 }
 
 // operation is the operation to be performed.
@@ -197,6 +362,17 @@ var operationAtoms = [...]Atom{
 	operationReposition: atomReposition,
 }
 
+// Operations of permission errors. Pass one of them to PermissionError as operation.
+var (
+	OperationAccess     = atomAccess
+	OperationCreate     = atomCreate
+	OperationInput      = atomInput
+	OperationModify     = atomModify
+	OperationOpen       = atomOpen
+	OperationOutput     = atomOutput
+	OperationReposition = atomReposition
+)
+
 // Term returns an Atom for the operation.
 func (o operation) Term() Term {
 	return operationAtoms[o]
@@ -229,14 +405,33 @@ var permissionTypeAtoms = [...]Atom{
 	permissionTypeTextStream:       atomTextStream,
 }
 
+// Permission types of permission errors. Pass one of them to PermissionError as permissionType.
+var (
+	PermissionTypeBinaryStream     = atomBinaryStream
+	PermissionTypeFlag             = atomFlag
+	PermissionTypeOperator         = atomOperator
+	PermissionTypePastEndOfStream  = atomPastEndOfStream
+	PermissionTypePrivateProcedure = atomPrivateProcedure
+	PermissionTypeStaticProcedure  = atomStaticProcedure
+	PermissionTypeSourceSink       = atomSourceSink
+	PermissionTypeStream           = atomStream
+	PermissionTypeTextStream       = atomTextStream
+)
+
 // Term returns an Atom for the permissionType.
 func (pt permissionType) Term() Term {
 	return permissionTypeAtoms[pt]
 }
 
+// PermissionError creates a new permission error exception
+// e.g. PermissionError(OperationModify, PermissionTypeStaticProcedure, foo/1, env).
+func PermissionError(operation, permissionType, culprit Term, env *Env) Exception {
+	return NewException(atomError.Apply(atomPermissionError.Apply(operation, permissionType, culprit), varContext), env)
+}
+
 // permissionError creates a new permission error exception.
 func permissionError(operation operation, permissionType permissionType, culprit Term, env *Env) Exception {
-	return NewException(atomError.Apply(atomPermissionError.Apply(operation.Term(), permissionType.Term(), culprit), varContext), env)
+	return PermissionError(operation.Term(), permissionType.Term(), culprit, env)
 }
 
 // flag is an implementation defined limit.
@@ -260,14 +455,29 @@ var flagAtoms = [...]Atom{
 	flagMinInteger:      atomMinInteger,
 }
 
+// Limits of representation errors. Pass one of them to RepresentationError as flag.
+var (
+	FlagCharacter       = atomCharacter
+	FlagCharacterCode   = atomCharacterCode
+	FlagInCharacterCode = atomInCharacterCode
+	FlagMaxArity        = atomMaxArity
+	FlagMaxInteger      = atomMaxInteger
+	FlagMinInteger      = atomMinInteger
+)
+
 // Term returns an Atom for the flag.
 func (f flag) Term() Term {
 	return flagAtoms[f]
 }
 
+// RepresentationError creates a new representation error exception e.g. RepresentationError(FlagMaxArity, env).
+func RepresentationError(flag Term, env *Env) Exception {
+	return NewException(atomError.Apply(atomRepresentationError.Apply(flag), varContext), env)
+}
+
 // representationError creates a new representation error exception.
 func representationError(limit flag, env *Env) Exception {
-	return NewException(atomError.Apply(atomRepresentationError.Apply(limit.Term()), varContext), env)
+	return RepresentationError(limit.Term(), env)
 }
 
 // resource is a resource required to complete execution.
@@ -278,27 +488,64 @@ const (
 	resourceFiniteMemory resource = iota
 
 	resourceMemory
+	resourceClauses
+	resourceInferences
+	resourceForeignCallTime
+	resourceTerms
+	resourceTrail
+	resourceCallDepth
+	resourceTime
 )
 
 var resourceAtoms = [...]Atom{
-	resourceFiniteMemory: atomFiniteMemory,
-	resourceMemory:       atomMemory,
-}
+	resourceFiniteMemory:    atomFiniteMemory,
+	resourceMemory:          atomMemory,
+	resourceClauses:         atomClauses,
+	resourceInferences:      atomInferences,
+	resourceForeignCallTime: atomForeignCallTime,
+	resourceTerms:           atomTerms,
+	resourceTrail:           atomTrail,
+	resourceCallDepth:       atomCallDepth,
+	resourceTime:            atomTime,
+}
+
+// Resources of resource errors. Pass one of them to ResourceError as resource.
+var (
+	ResourceFiniteMemory    = atomFiniteMemory
+	ResourceMemory          = atomMemory
+	ResourceClauses         = atomClauses
+	ResourceInferences      = atomInferences
+	ResourceForeignCallTime = atomForeignCallTime
+	ResourceTerms           = atomTerms
+	ResourceTrail           = atomTrail
+	ResourceCallDepth       = atomCallDepth
+	ResourceTime            = atomTime
+)
 
 // Term returns an Atom for the resource.
 func (r resource) Term() Term {
 	return resourceAtoms[r]
 }
 
+// ResourceError creates a new resource error exception e.g. ResourceError(ResourceMemory, env).
+func ResourceError(resource Term, env *Env) Exception {
+	// We can't call renamedCopy() since it can lead th resource_error(memory).
+	return Exception{term: atomError.Apply(atomResourceError.Apply(resource), env.Resolve(varContext))}
+}
+
 // resourceError creates a new resource error exception.
 func resourceError(resource resource, env *Env) Exception {
-	// We can't call renamedCopy() since it can lead th resource_error(memory).
-	return Exception{term: atomError.Apply(atomResourceError.Apply(resource.Term()), env.Resolve(varContext))}
+	return ResourceError(resource.Term(), env)
+}
+
+// SyntaxError creates a new syntax error exception. detail is an implementation dependent atom describing the error.
+func SyntaxError(detail Term, env *Env) Exception {
+	return NewException(atomError.Apply(atomSyntaxError.Apply(detail), varContext), env)
 }
 
 // syntaxError creates a new syntax error exception.
 func syntaxError(err error, env *Env) Exception {
-	return NewException(atomError.Apply(atomSyntaxError.Apply(NewAtom(err.Error())), varContext), env)
+	return SyntaxError(NewAtom(err.Error()), env)
 }
 
 // exceptionalValue is an evaluable functor's result which is not a number.
@@ -324,12 +571,26 @@ var exceptionalValueAtoms = [...]Atom{
 	exceptionalValueUndefined:     atomUndefined,
 }
 
+// Exceptional values of evaluation errors. Pass one of them to EvaluationError as value.
+var (
+	ExceptionalValueFloatOverflow = atomFloatOverflow
+	ExceptionalValueIntOverflow   = atomIntOverflow
+	ExceptionalValueUnderflow     = atomUnderflow
+	ExceptionalValueZeroDivisor   = atomZeroDivisor
+	ExceptionalValueUndefined     = atomUndefined
+)
+
 // Term returns an Atom for the exceptionalValue.
 func (ev exceptionalValue) Term() Term {
 	return exceptionalValueAtoms[ev]
 }
 
+// EvaluationError creates a new evaluation error exception e.g. EvaluationError(ExceptionalValueZeroDivisor, env).
+func EvaluationError(value Term, env *Env) Exception {
+	return NewException(atomError.Apply(atomEvaluationError.Apply(value), varContext), env)
+}
+
 // evaluationError creates a new evaluation error exception.
 func evaluationError(ev exceptionalValue, env *Env) Exception {
-	return NewException(atomError.Apply(atomEvaluationError.Apply(ev.Term()), varContext), env)
+	return EvaluationError(ev.Term(), env)
 }
@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -16,6 +17,30 @@ func TestNewException(t *testing.T) {
 func TestException_Error(t *testing.T) {
 	e := Exception{term: NewAtom("foo")}
 	assert.Equal(t, "foo", e.Error())
+
+	t.Run("variables", func(t *testing.T) {
+		x, y := NewVariable(), NewVariable()
+		e := Exception{term: NewAtom("foo").Apply(y, x, y)}
+		assert.Equal(t, "foo(_A,_B,_A)", e.Error())
+	})
+
+	t.Run("huge culprit", func(t *testing.T) {
+		elems := make([]Term, 100000)
+		for i := range elems {
+			elems[i] = NewVariable()
+		}
+		e := typeError(validTypeInteger, List(elems...), nil)
+		assert.Equal(t, "error(type_error(integer,[_A,_B,_C,_D,_E,_F,_G,_H|...]),root)", e.Error())
+	})
+
+	t.Run("deep culprit", func(t *testing.T) {
+		var c Term = NewVariable()
+		for i := 0; i < 1000; i++ {
+			c = NewAtom("f").Apply(c)
+		}
+		e := typeError(validTypeInteger, c, nil)
+		assert.Equal(t, "error(type_error(integer,f(f(f(f(f(f(f(f(...))))))))),root)", e.Error())
+	})
 }
 
 func TestInstantiationError(t *testing.T) {
@@ -45,3 +70,72 @@ func TestTypeError(t *testing.T) {
 func TestExceptionalValue_Error(t *testing.T) {
 	assert.Equal(t, "int_overflow", exceptionalValueIntOverflow.Error())
 }
+
+func TestExistenceError(t *testing.T) {
+	pi := atomSlash.Apply(NewAtom("foo"), Integer(1))
+	assert.Equal(t, existenceError(objectTypeProcedure, pi, nil), ExistenceError(ObjectTypeProcedure, pi, nil))
+}
+
+func TestPermissionError(t *testing.T) {
+	pi := atomSlash.Apply(NewAtom("foo"), Integer(1))
+	assert.Equal(t, permissionError(operationModify, permissionTypeStaticProcedure, pi, nil), PermissionError(OperationModify, PermissionTypeStaticProcedure, pi, nil))
+}
+
+func TestRepresentationError(t *testing.T) {
+	assert.Equal(t, representationError(flagMaxArity, nil), RepresentationError(FlagMaxArity, nil))
+}
+
+func TestResourceError(t *testing.T) {
+	assert.Equal(t, resourceError(resourceMemory, nil), ResourceError(ResourceMemory, nil))
+}
+
+func TestSyntaxError(t *testing.T) {
+	assert.Equal(t, syntaxError(errors.New("unexpected token"), nil), SyntaxError(NewAtom("unexpected token"), nil))
+}
+
+func TestEvaluationError(t *testing.T) {
+	assert.Equal(t, evaluationError(exceptionalValueZeroDivisor, nil), EvaluationError(ExceptionalValueZeroDivisor, nil))
+}
+
+// The exported atoms have to cover the ones the builtins use so that foreign predicates can raise the same errors.
+func TestExportedErrorAtoms(t *testing.T) {
+	assert.Equal(t, validTypeAtoms[:], []Atom{
+		ValidTypeAtom, ValidTypeAtomic, ValidTypeByte, ValidTypeCallable, ValidTypeCharacter, ValidTypeCompound,
+		ValidTypeEvaluable, ValidTypeInByte, ValidTypeInCharacter, ValidTypeInteger, ValidTypeList, ValidTypeNumber,
+		ValidTypePredicateIndicator, ValidTypePair, ValidTypeFloat, ValidTypeText, ValidTypeDBReference,
+		ValidTypeFrame,
+	})
+	assert.Equal(t, validDomainAtoms[:], []Atom{
+		ValidDomainCharacterCodeList, ValidDomainCloseOption, ValidDomainFlagValue, ValidDomainIOMode,
+		ValidDomainNonEmptyList, ValidDomainNotLessThanZero, ValidDomainOperatorPriority, ValidDomainOperatorSpecifier,
+		ValidDomainPrologFlag, ValidDomainReadOption, ValidDomainSourceSink, ValidDomainStream, ValidDomainStreamOption,
+		ValidDomainStreamOrAlias, ValidDomainStreamPosition, ValidDomainStreamProperty, ValidDomainWriteOption,
+		ValidDomainOrder, ValidDomainAggregateSpec, ValidDomainPredicateProperty, ValidDomainHashAlgorithm,
+		ValidDomainTimeZone, ValidDomainDate, ValidDomainFormat, ValidDomainMessageKind, ValidDomainSchemaType,
+		ValidDomainImage, ValidDomainEncoding, ValidDomainFallback, ValidDomainFrameAttribute,
+	})
+	assert.Equal(t, objectTypeAtoms[:], []Atom{
+		ObjectTypeProcedure, ObjectTypeSourceSink, ObjectTypeStream, ObjectTypeDBReference, ObjectTypeGenerator,
+		ObjectTypeResumableQuery,
+	})
+	assert.Equal(t, operationAtoms[:], []Atom{
+		OperationAccess, OperationCreate, OperationInput, OperationModify, OperationOpen, OperationOutput,
+		OperationReposition,
+	})
+	assert.Equal(t, permissionTypeAtoms[:], []Atom{
+		PermissionTypeBinaryStream, PermissionTypeFlag, PermissionTypeOperator, PermissionTypePastEndOfStream,
+		PermissionTypePrivateProcedure, PermissionTypeStaticProcedure, PermissionTypeSourceSink, PermissionTypeStream,
+		PermissionTypeTextStream,
+	})
+	assert.Equal(t, flagAtoms[:], []Atom{
+		FlagCharacter, FlagCharacterCode, FlagInCharacterCode, FlagMaxArity, FlagMaxInteger, FlagMinInteger,
+	})
+	assert.Equal(t, resourceAtoms[:], []Atom{
+		ResourceFiniteMemory, ResourceMemory, ResourceClauses, ResourceInferences, ResourceForeignCallTime, ResourceTerms,
+		ResourceTrail, ResourceCallDepth, ResourceTime,
+	})
+	assert.Equal(t, exceptionalValueAtoms[:], []Atom{
+		ExceptionalValueFloatOverflow, ExceptionalValueIntOverflow, ExceptionalValueUnderflow,
+		ExceptionalValueZeroDivisor, ExceptionalValueUndefined,
+	})
+}
@@ -0,0 +1,152 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// A call to a predicate with a fallback e.g. fallback(geo_lookup/2, cached_geo_lookup/2, [error(timeout, _)]) calls
+// the fallback predicate with the same arguments instead once the predicate raises an exception whose ball unifies
+// with one of the catchers. The substitution is reported as a warning fallback_substitution(Goal, Fallback, Ball) to
+// message_hook/3 or VM.OnMessage so that the degraded results don't go unnoticed. The solutions the predicate yielded
+// before the exception stand. Fallbacks chain: the fallback predicate may have its own fallback.
+//
+// Only the exceptions raised while the predicate is being executed trigger the fallback. The ones raised by the goals
+// after the predicate exited propagate as they are.
+
+type fallback struct {
+	pi       procedureIndicator
+	catchers []Term
+}
+
+// Fallback declares that a call to the predicate indicated by primary calls the one indicated by alternative instead
+// if it raises an exception which unifies with one of the list catchers. It replaces the previous declaration for
+// primary if any. Both must be of the same arity and the chain of the fallbacks must not come back to primary.
+func Fallback(vm *VM, primary, alternative, catchers Term, k Cont, env *Env) *Promise {
+	p, err := predicateIndicator(primary, env)
+	if err != nil {
+		return Error(err)
+	}
+	a, err := predicateIndicator(alternative, env)
+	if err != nil {
+		return Error(err)
+	}
+	if a.arity != p.arity {
+		return Error(domainError(validDomainFallback, alternative, env))
+	}
+	for pi := a; ; {
+		if pi == p {
+			return Error(domainError(validDomainFallback, alternative, env))
+		}
+		fb, ok := vm.fallbacks[pi]
+		if !ok {
+			break
+		}
+		pi = fb.pi
+	}
+
+	var cs []Term
+	iter := ListIterator{List: catchers, Env: env}
+	for iter.Next() {
+		c, err := renamedCopy(iter.Current(), nil, env)
+		if err != nil {
+			return Error(err)
+		}
+		cs = append(cs, c)
+	}
+	if err := iter.Err(); err != nil {
+		return Error(err)
+	}
+
+	persistAtoms(primary, env)
+	persistAtoms(alternative, env)
+	for _, c := range cs {
+		persistAtoms(c, nil)
+	}
+	if vm.fallbacks == nil {
+		vm.fallbacks = map[procedureIndicator]fallback{}
+	}
+	vm.fallbacks[p] = fallback{pi: a, catchers: cs}
+	return k(env)
+}
+
+// predicateIndicator converts a term Name/Arity into a procedureIndicator.
+func predicateIndicator(t Term, env *Env) (procedureIndicator, error) {
+	switch pi := env.Resolve(t).(type) {
+	case Variable:
+		return procedureIndicator{}, InstantiationError(env)
+	case Compound:
+		if pi.Functor() != atomSlash || pi.Arity() != 2 {
+			return procedureIndicator{}, typeError(validTypePredicateIndicator, pi, env)
+		}
+		switch name := env.Resolve(pi.Arg(0)).(type) {
+		case Variable:
+			return procedureIndicator{}, InstantiationError(env)
+		case Atom:
+			switch arity := env.Resolve(pi.Arg(1)).(type) {
+			case Variable:
+				return procedureIndicator{}, InstantiationError(env)
+			case Integer:
+				if arity < 0 {
+					return procedureIndicator{}, domainError(validDomainNotLessThanZero, arity, env)
+				}
+				return procedureIndicator{name: name, arity: arity}, nil
+			default:
+				return procedureIndicator{}, typeError(validTypeInteger, arity, env)
+			}
+		default:
+			return procedureIndicator{}, typeError(validTypeAtom, name, env)
+		}
+	default:
+		return procedureIndicator{}, typeError(validTypePredicateIndicator, pi, env)
+	}
+}
+
+// callWithFallback calls the procedure and calls the fallback instead if the procedure raises an applicable exception.
+func (vm *VM) callWithFallback(pi procedureIndicator, p procedure, fb fallback, args []Term, k Cont, env *Env) *Promise {
+	var exited bool
+	return catch(func(err error) *Promise {
+		if exited || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return nil
+		}
+		e, ok := err.(Exception)
+		if !ok {
+			e = Exception{term: atomError.Apply(NewAtom("system_error"), NewAtom(err.Error()))}
+		}
+		if !fb.catches(e.term, env) {
+			return nil
+		}
+		return Delay(func(ctx context.Context) *Promise {
+			copied := map[termID]Term{}
+			goal, _ := renamedCopy(pi.name.Apply(args...), copied, env)
+			alt, _ := renamedCopy(fb.pi.name.Apply(args...), copied, env)
+			vm.message(ctx, SeverityWarning, atomFallbackSubstitution.Apply(goal, alt, e.term))
+			return vm.Arrive(fb.pi.name, args, k, env)
+		})
+	}, func(context.Context) *Promise {
+		return vm.arrive(pi, p, args, func(env *Env) *Promise {
+			exited = true
+			return Delay(func(context.Context) *Promise {
+				return k(env)
+			}, func(context.Context) *Promise {
+				exited = false // Backtracked into the procedure.
+				return Bool(false)
+			})
+		}, env)
+	})
+}
+
+func (fb fallback) catches(ball Term, env *Env) bool {
+	for _, c := range fb.catchers {
+		if _, ok := env.Unify(c, ball); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// fallbackSubstitutionLines translates fallback_substitution(Goal, Fallback, Ball) into a human-readable message.
+func fallbackSubstitutionLines(goal, alt, ball Term, w func(Term) string) []string {
+	return []string{fmt.Sprintf("%s raised %s, falling back to %s", w(goal), w(ball), w(alt))}
+}
@@ -0,0 +1,147 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFallback(t *testing.T) {
+	newVM := func(t *testing.T) (*VM, *[]Term) {
+		var (
+			vm       VM
+			messages []Term
+		)
+		vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+		vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+		vm.operators.define(700, operatorSpecifierXFX, atomEqual)
+		vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+		vm.Register1(NewAtom("throw"), Throw)
+		vm.Register2(atomEqual, Unify)
+		vm.OnMessage = func(severity Severity, term Term, _ []string) {
+			assert.Equal(t, SeverityWarning, severity)
+			messages = append(messages, term)
+		}
+		assert.NoError(t, vm.Compile(context.Background(), `
+geo(paris, live).
+geo(_, _) :- throw(error(timeout, geo/2)).
+cached(_, cached).
+stale(_, stale).
+broken(_, _) :- throw(broken).
+`))
+		return &vm, &messages
+	}
+
+	geo, cached, stale, broken := NewAtom("geo"), NewAtom("cached"), NewAtom("stale"), NewAtom("broken")
+	timeout := atomError.Apply(NewAtom("timeout"), atomSlash.Apply(geo, Integer(2)))
+	pi := func(name Atom, arity int) Term {
+		return atomSlash.Apply(name, Integer(arity))
+	}
+	collect := func(vm *VM, goal Term, v Variable) ([]Term, error) {
+		var ts []Term
+		_, err := Call(vm, goal, func(env *Env) *Promise {
+			ts = append(ts, env.Resolve(v))
+			return Bool(false)
+		}, nil).Force(context.Background())
+		return ts, err
+	}
+
+	t.Run("substitution", func(t *testing.T) {
+		vm, messages := newVM(t)
+		ok, err := Fallback(vm, pi(geo, 2), pi(cached, 2), List(atomError.Apply(NewAtom("timeout"), NewVariable())), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		y := NewVariable()
+		ts, err := collect(vm, geo.Apply(NewAtom("paris"), y), y)
+		assert.NoError(t, err)
+		assert.Equal(t, []Term{NewAtom("live"), NewAtom("cached")}, ts)
+
+		assert.Len(t, *messages, 1)
+		m := (*messages)[0].(Compound)
+		assert.Equal(t, atomFallbackSubstitution, m.Functor())
+		assert.Equal(t, timeout, m.Arg(2))
+		assert.Equal(t, []string{"geo(paris,y) raised error(timeout,geo/2), falling back to cached(paris,y)"}, messageLines(vm, atomFallbackSubstitution.Apply(
+			geo.Apply(NewAtom("paris"), NewAtom("y")),
+			cached.Apply(NewAtom("paris"), NewAtom("y")),
+			timeout,
+		), nil))
+	})
+
+	t.Run("chain", func(t *testing.T) {
+		vm, messages := newVM(t)
+		_, err := Fallback(vm, pi(broken, 2), pi(stale, 2), List(NewVariable()), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		_, err = Fallback(vm, pi(geo, 2), pi(broken, 2), List(NewVariable()), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+
+		y := NewVariable()
+		ts, err := collect(vm, geo.Apply(NewAtom("rome"), y), y)
+		assert.NoError(t, err)
+		assert.Equal(t, []Term{NewAtom("stale")}, ts)
+		assert.Len(t, *messages, 2)
+	})
+
+	t.Run("not designated", func(t *testing.T) {
+		vm, messages := newVM(t)
+		_, err := Fallback(vm, pi(geo, 2), pi(cached, 2), List(NewAtom("network")), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+
+		_, err = collect(vm, geo.Apply(NewAtom("rome"), NewVariable()), NewVariable())
+		assert.Equal(t, Exception{term: timeout}, err)
+		assert.Empty(t, *messages)
+	})
+
+	t.Run("after exit", func(t *testing.T) {
+		vm, messages := newVM(t)
+		_, err := Fallback(vm, pi(geo, 2), pi(cached, 2), List(NewVariable()), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+
+		_, err = Call(vm, atomComma.Apply(
+			geo.Apply(NewAtom("paris"), NewVariable()),
+			NewAtom("throw").Apply(NewAtom("later")),
+		), Success, nil).Force(context.Background())
+		assert.Equal(t, Exception{term: NewAtom("later")}, err)
+		assert.Empty(t, *messages)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		vm, _ := newVM(t)
+		tests := []struct {
+			title                          string
+			primary, alternative, catchers Term
+			err                            error
+		}{
+			{title: "primary", primary: NewVariable(), alternative: pi(cached, 2), catchers: List(), err: InstantiationError(nil)},
+			{title: "alternative", primary: pi(geo, 2), alternative: geo, catchers: List(), err: typeError(validTypePredicateIndicator, geo, nil)},
+			{title: "name", primary: atomSlash.Apply(Integer(0), Integer(2)), alternative: pi(cached, 2), catchers: List(), err: typeError(validTypeAtom, Integer(0), nil)},
+			{title: "arity", primary: pi(geo, 2), alternative: pi(cached, 3), catchers: List(), err: domainError(validDomainFallback, pi(cached, 3), nil)},
+			{title: "cycle", primary: pi(geo, 2), alternative: pi(geo, 2), catchers: List(), err: domainError(validDomainFallback, pi(geo, 2), nil)},
+			{title: "catchers", primary: pi(geo, 2), alternative: pi(cached, 2), catchers: PartialList(NewVariable(), NewAtom("network")), err: InstantiationError(nil)},
+		}
+		for _, tt := range tests {
+			t.Run(tt.title, func(t *testing.T) {
+				_, err := Fallback(vm, tt.primary, tt.alternative, tt.catchers, Success, nil).Force(context.Background())
+				assert.Equal(t, tt.err, err)
+			})
+		}
+
+		t.Run("indirect cycle", func(t *testing.T) {
+			_, err := Fallback(vm, pi(geo, 2), pi(cached, 2), List(), Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			_, err = Fallback(vm, pi(cached, 2), pi(geo, 2), List(), Success, nil).Force(context.Background())
+			assert.Equal(t, domainError(validDomainFallback, pi(geo, 2), nil), err)
+		})
+	})
+
+	t.Run("fork", func(t *testing.T) {
+		vm, _ := newVM(t)
+		_, err := Fallback(vm, pi(geo, 2), pi(cached, 2), List(NewVariable()), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		f := vm.Fork()
+		_, err = Fallback(f, pi(geo, 2), pi(stale, 2), List(NewVariable()), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, cached, vm.fallbacks[procedureIndicator{name: geo, arity: 2}].pi.name)
+	})
+}
@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// A negation \+ G flounders if G is called with unbound variables which G binds. Since \+ G fails for any solution of
+// G, it silently reads as "there's no such X at all" instead of "X isn't such" as intended. While
+// current_prolog_flag(floundering, warning), the VM warns about such negations by floundering(\+ G, Vars, Bindings)
+// where Vars are the variables in question and Bindings are the variable names as in read_term/2.
+
+func modifyFloundering(vm *VM, value Atom) error {
+	switch value {
+	case atomOff:
+		vm.floundering = false
+	case atomWarning:
+		vm.floundering = true
+	default:
+		return domainError(validDomainFlagValue, atomPlus.Apply(atomFloundering, value), nil)
+	}
+	return nil
+}
+
+func flounderingFlag(b bool) Atom {
+	if b {
+		return atomWarning
+	}
+	return atomOff
+}
+
+// checkFloundering warns if the goal of the negation bound any of the variables which were free when it was called.
+func (vm *VM) checkFloundering(ctx context.Context, goal Term, free []Variable, env *Env) {
+	var bound []Term
+	for _, v := range free {
+		if _, ok := env.Resolve(v).(Variable); !ok {
+			bound = append(bound, v)
+		}
+	}
+	if len(bound) == 0 {
+		return
+	}
+	vm.message(ctx, SeverityWarning, atomFloundering.Apply(atomNegation.Apply(goal), List(bound...), List()))
+}
+
+// Floundering returns floundering(\+ G, Vars, Bindings) for each negation in the body of clause which flounders
+// statically. vars are the variables of clause as read. It's the check done on consulting while
+// current_prolog_flag(floundering, warning).
+func Floundering(clause Term, vars []ParsedVariable) []Term {
+	bindings := make([]Term, len(vars))
+	for i, v := range vars {
+		bindings[i] = atomEqual.Apply(v.Name, v.Variable)
+	}
+	return flounderingNegations(clause, List(bindings...))
+}
+
+// flounderingNegations statically finds the negations \+ G in the body of the clause which are called with unbound
+// variables that are used after them. Such variables are expected to be bound by the time \+ G is called, but aren't.
+// The variables are unbound if they appear neither in the head nor in the goals before the negation.
+func flounderingNegations(clause, bindings Term) []Term {
+	c, ok := clause.(Compound)
+	if !ok || c.Functor() != atomIf || c.Arity() != 2 {
+		return nil
+	}
+
+	goals := flattenBody(c.Arg(1), nil)
+	seen := map[Variable]struct{}{}
+	for _, v := range (*Env)(nil).freeVariables(c.Arg(0)) {
+		seen[v] = struct{}{}
+	}
+
+	var ws []Term
+	for i, g := range goals {
+		vs := (*Env)(nil).freeVariables(g)
+		if n, ok := g.(Compound); ok && n.Functor() == atomNegation && n.Arity() == 1 {
+			later := map[Variable]struct{}{}
+			for _, g := range goals[i+1:] {
+				for _, v := range (*Env)(nil).freeVariables(g) {
+					later[v] = struct{}{}
+				}
+			}
+			var unbound []Term
+			for _, v := range vs {
+				_, ok := seen[v]
+				_, used := later[v]
+				if !ok && used {
+					unbound = append(unbound, v)
+				}
+			}
+			if len(unbound) > 0 {
+				ws = append(ws, atomFloundering.Apply(g, List(unbound...), bindings))
+			}
+		}
+		for _, v := range vs {
+			seen[v] = struct{}{}
+		}
+	}
+	return ws
+}
+
+// flattenBody returns the goals of the body in the order of appearance looking into the control constructs except for
+// the negations.
+func flattenBody(body Term, goals []Term) []Term {
+	if c, ok := body.(Compound); ok && c.Arity() == 2 {
+		switch c.Functor() {
+		case atomComma, atomSemiColon, atomThen, atomSoftCut:
+			return flattenBody(c.Arg(1), flattenBody(c.Arg(0), goals))
+		}
+	}
+	return append(goals, body)
+}
+
+// flounderingLines translates floundering(Goal, Vars, Bindings) into human-readable lines.
+func flounderingLines(vm *VM, goal, vars, bindings Term, env *Env) []string {
+	opts := WriteOptions{quoted: true, ops: vm.operators, priority: 1200, variableNames: map[Variable]Atom{}}
+	iter := ListIterator{List: bindings, Env: env}
+	for iter.Next() {
+		if b, ok := env.Resolve(iter.Current()).(Compound); ok && b.Functor() == atomEqual && b.Arity() == 2 {
+			n, ok := env.Resolve(b.Arg(0)).(Atom)
+			v, vok := env.Resolve(b.Arg(1)).(Variable)
+			if ok && vok {
+				opts.variableNames[v] = n
+			}
+		}
+	}
+	w := func(t Term) string {
+		var sb strings.Builder
+		_ = env.Resolve(t).WriteTerm(&sb, &opts, env)
+		return sb.String()
+	}
+
+	var vs []string
+	iter = ListIterator{List: vars, Env: env}
+	for iter.Next() {
+		vs = append(vs, w(iter.Current()))
+	}
+	return []string{fmt.Sprintf("Floundering: %s is called with %s unbound", w(goal), strings.Join(vs, ", "))}
+}
@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlounderingNegations(t *testing.T) {
+	x, y, z := NewVariable(), NewVariable(), NewVariable()
+	p, q, r := NewAtom("p"), NewAtom("q"), NewAtom("r")
+	bindings := List(atomEqual.Apply(NewAtom("X"), x))
+
+	tests := []struct {
+		title  string
+		clause Term
+		ws     []Term
+	}{
+		{title: "fact", clause: p.Apply(x)},
+		{title: "bound by the head", clause: atomIf.Apply(p.Apply(x), seq(atomComma, atomNegation.Apply(q.Apply(x)), r.Apply(x)))},
+		{title: "bound before", clause: atomIf.Apply(p, seq(atomComma, r.Apply(x), atomNegation.Apply(q.Apply(x)), r.Apply(x)))},
+		{title: "local", clause: atomIf.Apply(p.Apply(y), seq(atomComma, atomNegation.Apply(q.Apply(x, y)), r.Apply(y)))},
+		{title: "used after", clause: atomIf.Apply(p.Apply(y), seq(atomComma, atomNegation.Apply(q.Apply(x, y)), r.Apply(x))), ws: []Term{
+			atomFloundering.Apply(atomNegation.Apply(q.Apply(x, y)), List(x), bindings),
+		}},
+		{title: "in a control construct", clause: atomIf.Apply(p, atomSemiColon.Apply(atomThen.Apply(atomNegation.Apply(q.Apply(x, z)), r.Apply(x)), r.Apply(z))), ws: []Term{
+			atomFloundering.Apply(atomNegation.Apply(q.Apply(x, z)), List(x, z), bindings),
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			assert.Equal(t, tt.ws, flounderingNegations(tt.clause, bindings))
+		})
+	}
+}
+
+func TestFloundering(t *testing.T) {
+	x, y := NewVariable(), NewVariable()
+	p, q, r := NewAtom("p"), NewAtom("q"), NewAtom("r")
+	clause := atomIf.Apply(p.Apply(y), atomComma.Apply(atomNegation.Apply(q.Apply(x, y)), r.Apply(x)))
+	vars := []ParsedVariable{
+		{Name: NewAtom("X"), Variable: x, Count: 2},
+		{Name: NewAtom("Y"), Variable: y, Count: 2},
+	}
+	assert.Equal(t, []Term{
+		atomFloundering.Apply(atomNegation.Apply(q.Apply(x, y)), List(x), List(atomEqual.Apply(NewAtom("X"), x), atomEqual.Apply(NewAtom("Y"), y))),
+	}, Floundering(clause, vars))
+}
+
+func TestNegate_floundering(t *testing.T) {
+	var (
+		vm    VM
+		lines []string
+	)
+	vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+	vm.operators.define(1200, operatorSpecifierFX, atomIf)
+	vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+	vm.operators.define(900, operatorSpecifierFY, atomNegation)
+	vm.Register1(atomNegation, Negate)
+	vm.Register2(NewAtom("set_prolog_flag"), SetPrologFlag)
+	vm.OnMessage = func(s Severity, _ Term, ls []string) {
+		assert.Equal(t, SeverityWarning, s)
+		lines = append(lines, ls...)
+	}
+
+	assert.NoError(t, vm.Compile(context.Background(), `
+:- set_prolog_flag(floundering, warning).
+colour(red).
+colour(green).
+primary(red).
+secondary(C) :- \+ primary(C), colour(C).
+nonprimary :- \+ primary(X), colour(X).
+`))
+	assert.Equal(t, []string{`Floundering: \+primary(X) is called with X unbound`}, lines)
+
+	// The negation fails silently since primary(C) has a solution.
+	lines = nil
+	ok, err := Call(&vm, NewAtom("secondary").Apply(NewVariable()), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Len(t, lines, 1)
+	assert.Regexp(t, `^Floundering: \\\+primary\(_\d+\) is called with _\d+ unbound$`, lines[0])
+
+	// Ground goals don't flounder.
+	lines = nil
+	ok, err = Call(&vm, NewAtom("secondary").Apply(NewAtom("green")), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Empty(t, lines)
+
+	// Nor do they while the flag is off.
+	assert.NoError(t, modifyFloundering(&vm, atomOff))
+	ok, err = Call(&vm, NewAtom("secondary").Apply(NewVariable()), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Empty(t, lines)
+}
@@ -0,0 +1,64 @@
+package engine
+
+// While current_prolog_flag(debug, on) or VM.TrackBacktrace, the VM keeps the chain of the goals being executed so that
+// debugging tools and assertion libraries can tell where they were called from. prolog_current_frame/1 returns the
+// frame of the running procedure and prolog_frame_attribute/3 inspects a frame and walks up to its ancestors:
+//
+//	where(Caller) :-
+//		prolog_current_frame(F),
+//		prolog_frame_attribute(F, parent, P),
+//		prolog_frame_attribute(P, goal, Caller).
+
+// PrologCurrentFrame unifies f with the frame of the procedure which called prolog_current_frame/1.
+// It fails while the frames aren't kept or at the top of a query.
+func PrologCurrentFrame(vm *VM, f Term, k Cont, env *Env) *Promise {
+	self := frameOf(env) // The frame of prolog_current_frame/1 itself.
+	if self == nil || self.parent == nil {
+		return Bool(false)
+	}
+	return Unify(vm, f, self.parent, k, env)
+}
+
+// PrologFrameAttribute unifies value with the attribute of frame f indicated by key, one of:
+//
+//   - goal: the goal of the frame with the current bindings of its arguments.
+//   - predicate_indicator: the predicate indicator of the procedure e.g. foo/1.
+//   - parent: the frame of the caller. It fails if f is the outermost.
+//   - level: the depth of the frame. The outermost is 1.
+func PrologFrameAttribute(vm *VM, f, key, value Term, k Cont, env *Env) *Promise {
+	var fr *frame
+	switch t := env.Resolve(f).(type) {
+	case Variable:
+		return Error(InstantiationError(env))
+	case *frame:
+		fr = t
+	default:
+		return Error(typeError(validTypeFrame, t, env))
+	}
+
+	switch key := env.Resolve(key).(type) {
+	case Variable:
+		return Error(InstantiationError(env))
+	case Atom:
+		switch key {
+		case atomGoal:
+			return Unify(vm, value, fr.pi.name.Apply(fr.args...), k, env)
+		case atomPredicateIndicator:
+			return Unify(vm, value, fr.pi.Term(), k, env)
+		case atomParent:
+			if fr.parent == nil {
+				return Bool(false)
+			}
+			return Unify(vm, value, fr.parent, k, env)
+		case atomLevel:
+			var n Integer
+			for a := fr; a != nil; a = a.parent {
+				n++
+			}
+			return Unify(vm, value, n, k, env)
+		}
+	default:
+		return Error(typeError(validTypeAtom, key, env))
+	}
+	return Error(domainError(validDomainFrameAttribute, key, env))
+}
@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrologFrameAttribute(t *testing.T) {
+	var (
+		vm     VM
+		frames []*frame
+	)
+	vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+	vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+	vm.operators.define(700, operatorSpecifierXFX, atomEqual)
+	vm.Register2(atomEqual, Unify)
+	vm.Register1(NewAtom("prolog_current_frame"), PrologCurrentFrame)
+	vm.Register1(NewAtom("inspect"), func(vm *VM, f Term, k Cont, env *Env) *Promise {
+		frames = append(frames, env.Resolve(f).(*frame))
+		return k(env)
+	})
+	assert.NoError(t, vm.Compile(context.Background(), `
+p(X) :- q(X, Y), Y = X.
+q(X, _) :- prolog_current_frame(F), inspect(F).
+`))
+	p, q := NewAtom("p"), NewAtom("q")
+	a := NewAtom("a")
+
+	t.Run("not kept", func(t *testing.T) {
+		ok, err := Call(&vm, p.Apply(a), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.Empty(t, frames)
+	})
+
+	assert.NoError(t, modifyDebug(&vm, atomOn))
+	ok, err := Call(&vm, p.Apply(a), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Len(t, frames, 1)
+	f := frames[0]
+
+	attr := func(f, key Term) (Term, error) {
+		v := NewVariable()
+		var value Term
+		ok, err := PrologFrameAttribute(&vm, f, key, v, func(env *Env) *Promise {
+			value = env.Resolve(v)
+			return Bool(true)
+		}, nil).Force(context.Background())
+		if err == nil && !ok {
+			return nil, nil
+		}
+		return value, err
+	}
+
+	t.Run("goal", func(t *testing.T) {
+		g, err := attr(f, atomGoal)
+		assert.NoError(t, err)
+		c, ok := g.(Compound)
+		assert.True(t, ok)
+		assert.Equal(t, q, c.Functor())
+		assert.Equal(t, a, c.Arg(0))
+	})
+
+	t.Run("predicate_indicator", func(t *testing.T) {
+		pi, err := attr(f, atomPredicateIndicator)
+		assert.NoError(t, err)
+		assert.Equal(t, atomSlash.Apply(q, Integer(2)), pi)
+	})
+
+	t.Run("level", func(t *testing.T) {
+		l, err := attr(f, atomLevel)
+		assert.NoError(t, err)
+		assert.Equal(t, Integer(2), l)
+	})
+
+	t.Run("parent", func(t *testing.T) {
+		parent, err := attr(f, atomParent)
+		assert.NoError(t, err)
+		g, err := attr(parent, atomGoal)
+		assert.NoError(t, err)
+		assert.Equal(t, p.Apply(a), g)
+
+		// The outermost has no parent.
+		outermost, err := attr(parent, atomParent)
+		assert.NoError(t, err)
+		assert.Nil(t, outermost)
+	})
+
+	t.Run("top of query", func(t *testing.T) {
+		ok, err := Call(&vm, NewAtom("prolog_current_frame").Apply(NewVariable()), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		tests := []struct {
+			title string
+			frame Term
+			key   Term
+			err   error
+		}{
+			{title: "frame is a variable", frame: NewVariable(), key: atomGoal, err: InstantiationError(nil)},
+			{title: "frame is not a frame", frame: a, key: atomGoal, err: typeError(validTypeFrame, a, nil)},
+			{title: "key is a variable", frame: f, key: NewVariable(), err: InstantiationError(nil)},
+			{title: "key is not an atom", frame: f, key: Integer(1), err: typeError(validTypeAtom, Integer(1), nil)},
+			{title: "unknown key", frame: f, key: NewAtom("foo"), err: domainError(validDomainFrameAttribute, NewAtom("foo"), nil)},
+		}
+		for _, tt := range tests {
+			t.Run(tt.title, func(t *testing.T) {
+				_, err := attr(tt.frame, tt.key)
+				assert.Equal(t, tt.err, err)
+			})
+		}
+	})
+}
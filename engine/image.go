@@ -0,0 +1,674 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// An image is a snapshot of the user-defined procedures of a VM including their compiled bytecode, the operators,
+// the modifiable flags, the character conversions, and the initialization goals. Restoring an image skips parsing and compiling the Prolog texts again.
+//
+// The format is the magic "1PLIMG", the version as a uvarint, the procedures sorted by their indicators, the operators
+// sorted by their names, the flags, the character conversions sorted by their input characters, and the initialization
+// goals.
+// Atoms are written by their names since they're interned differently in each process.
+// Opcodes are written in the encodings of imageOpcodes which don't change within a version.
+//
+// Version 3 added the fact schemas of the procedures and version 4 added the character conversions.
+// Images of the older versions are still loaded as if they had none of them.
+const (
+	imageMagic      = "1PLIMG"
+	imageVersion    = 4
+	imageMinVersion = 2
+)
+
+var (
+	errImageMagic   = errors.New("not an image")
+	errImageVersion = errors.New("unsupported image version")
+)
+
+// imageOpcodes are the encodings of the opcodes in images.
+// Don't change the existing ones. A new opcode gets a new encoding.
+var imageOpcodes = [...]byte{
+	opEnter:       1,
+	opCall:        2,
+	opExit:        3,
+	opGetConst:    4,
+	opPutConst:    5,
+	opGetVar:      6,
+	opPutVar:      7,
+	opGetFunctor:  8,
+	opPutFunctor:  9,
+	opPop:         10,
+	opCut:         11,
+	opGetList:     12,
+	opPutList:     13,
+	opGetPartial:  14,
+	opPutPartial:  15,
+	opGetPacked:   16,
+	opPutPacked:   17,
+	opDisj:        18,
+	opIfThen:      19,
+	opSoftCut:     20,
+	opJump:        21,
+	opGetFirstVar: 22,
+	opIs:          23,
+}
+
+// imageOpcodeDecodings is the reverse of imageOpcodes.
+var imageOpcodeDecodings = func() map[byte]opcode {
+	m := make(map[byte]opcode, len(imageOpcodes))
+	for op, b := range imageOpcodes {
+		m[b] = opcode(op)
+	}
+	return m
+}()
+
+// image term tags.
+const (
+	tagNil byte = iota
+	tagAtom
+	tagInteger
+	tagFloat
+	tagString
+	tagVariable
+	tagCompound
+	tagList
+	tagCharList
+	tagCodeList
+	tagPartial
+	tagProcedureIndicator
+)
+
+// SaveImage writes the user-defined procedures to w. The builtin predicates are not included.
+func (vm *VM) SaveImage(w io.Writer) error {
+	return vm.saveImage(w, false)
+}
+
+// SaveSession writes the dynamic procedures, the operators, the flags, and the character conversions to w in the image format so that the state
+// built interactively e.g. by assertz/1 can be restored by LoadImage later. Unlike SaveImage, the static procedures
+// and the initialization goals are not included since they're restored by consulting the Prolog texts again.
+func (vm *VM) SaveSession(w io.Writer) error {
+	return vm.saveImage(w, true)
+}
+
+func (vm *VM) saveImage(w io.Writer, session bool) error {
+	iw := imageWriter{w: bufio.NewWriter(w)}
+	_, _ = iw.w.WriteString(imageMagic)
+	iw.uvarint(imageVersion)
+
+	pis := vm.userDefinedIndicators(func(u *userDefined) bool {
+		return !session || u.dynamic
+	})
+
+	iw.uvarint(uint64(len(pis)))
+	for _, pi := range pis {
+		iw.procedure(pi, vm.procedures[pi].(*userDefined))
+	}
+
+	var ops []operator
+	for _, os := range vm.operators {
+		for _, o := range os {
+			if o != (operator{}) {
+				ops = append(ops, o)
+			}
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if x, y := ops[i].name.String(), ops[j].name.String(); x != y {
+			return x < y
+		}
+		return ops[i].specifier.class() < ops[j].specifier.class()
+	})
+	iw.uvarint(uint64(len(ops)))
+	for _, o := range ops {
+		iw.string(o.name.String())
+		iw.uvarint(uint64(o.priority))
+		iw.term(o.specifier.term())
+	}
+
+	flags := vm.modifiableFlags()
+	iw.uvarint(uint64(len(flags)))
+	for _, f := range flags {
+		iw.term(f[0])
+		iw.term(f[1])
+	}
+
+	convs := make([]rune, 0, len(vm.charConversions))
+	for r := range vm.charConversions {
+		convs = append(convs, r)
+	}
+	sort.Slice(convs, func(i, j int) bool {
+		return convs[i] < convs[j]
+	})
+	iw.uvarint(uint64(len(convs)))
+	for _, r := range convs {
+		iw.uvarint(uint64(r))
+		iw.uvarint(uint64(vm.charConversions[r]))
+	}
+
+	var goals []Term
+	if !session {
+		goals = vm.initialization
+	}
+	iw.uvarint(uint64(len(goals)))
+	for _, g := range goals {
+		iw.vars = map[Variable]uint64{}
+		iw.term(g)
+	}
+
+	if iw.err != nil {
+		return iw.err
+	}
+	return iw.w.Flush()
+}
+
+// LoadImage reads the image written by SaveImage from r and restores it in vm.
+// The procedures of the same indicators are replaced. So are the operators, the flags, and the character conversions.
+// Then, it runs the initialization goals since their effects other than the database aren't in the image.
+// It also restores the session written by SaveSession.
+func (vm *VM) LoadImage(r io.Reader) error {
+	ir := imageReader{r: bufio.NewReader(r)}
+	magic := make([]byte, len(imageMagic))
+	if _, err := io.ReadFull(ir.r, magic); err != nil || string(magic) != imageMagic {
+		return errImageMagic
+	}
+	v := ir.uvarint()
+	if ir.err == nil && (v < imageMinVersion || v > imageVersion) {
+		return fmt.Errorf("%w: %d", errImageVersion, v)
+	}
+
+	n := ir.count()
+	ps := map[procedureIndicator]*userDefined{}
+	for i := 0; i < n && ir.err == nil; i++ {
+		pi, u := ir.procedure()
+		ps[pi] = u
+	}
+
+	var ops operators
+	ops.init()
+	n = ir.count()
+	for i := 0; i < n && ir.err == nil; i++ {
+		name, priority := NewAtom(ir.string()), ir.uvarint()
+		specifier, _ := ir.term().(Atom)
+		spec, ok := operatorSpecifiers[specifier]
+		if !ok || priority == 0 || priority > 1200 {
+			ir.fail("invalid operator")
+			break
+		}
+		ops.define(Integer(priority), spec, name)
+	}
+
+	var flags [][2]Term
+	n = ir.count()
+	for i := 0; i < n && ir.err == nil; i++ {
+		flags = append(flags, [2]Term{ir.term(), ir.term()})
+	}
+
+	var convs map[rune]rune
+	if v >= 4 {
+		n = ir.count()
+		convs = make(map[rune]rune, n)
+		for i := 0; i < n && ir.err == nil; i++ {
+			in, out := ir.rune(), ir.rune()
+			convs[in] = out
+		}
+	}
+
+	var goals []Term
+	n = ir.count()
+	for i := 0; i < n && ir.err == nil; i++ {
+		ir.vars = nil
+		goals = append(goals, ir.term())
+	}
+
+	if ir.err != nil {
+		return fmt.Errorf("corrupted image: %w", ir.err)
+	}
+
+	if vm.procedures == nil {
+		vm.procedures = map[procedureIndicator]procedure{}
+	}
+	for pi, u := range ps {
+		vm.procedures[pi] = u
+	}
+	vm.invalidatePurity()
+	vm.operators = ops
+	for _, f := range flags {
+		if _, err := SetPrologFlag(vm, f[0], f[1], Success, nil).Force(context.Background()); err != nil {
+			return fmt.Errorf("corrupted image: %w", err)
+		}
+	}
+	if convs != nil {
+		vm.charConversions = convs
+	}
+	for _, g := range goals {
+		ok, err := Call(vm, g, Success, nil).Force(context.Background())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			vm.message(context.Background(), SeverityError, atomGoalFailed.Apply(atomInitialization, g))
+			return errors.New("failed initialization goal")
+		}
+		vm.initialization = append(vm.initialization, g)
+	}
+	return nil
+}
+
+// ReadImageProcedures reads the user-defined procedures from the image written by SaveImage or SaveSession without
+// restoring them in a VM. The rest of the image is not read.
+func ReadImageProcedures(r io.Reader) ([]Procedure, error) {
+	ir := imageReader{r: bufio.NewReader(r)}
+	magic := make([]byte, len(imageMagic))
+	if _, err := io.ReadFull(ir.r, magic); err != nil || string(magic) != imageMagic {
+		return nil, errImageMagic
+	}
+	v := ir.uvarint()
+	if ir.err == nil && (v < imageMinVersion || v > imageVersion) {
+		return nil, fmt.Errorf("%w: %d", errImageVersion, v)
+	}
+
+	n := ir.count()
+	ps := make([]Procedure, 0, n)
+	for i := 0; i < n && ir.err == nil; i++ {
+		pi, u := ir.procedure()
+		ps = append(ps, u.export(pi))
+	}
+	if ir.err != nil {
+		return nil, fmt.Errorf("corrupted image: %w", ir.err)
+	}
+	return ps, nil
+}
+
+const (
+	imageFlagPublic = 1 << iota
+	imageFlagDynamic
+	imageFlagMultifile
+	imageFlagDiscontiguous
+	imageFlagSchema
+)
+
+type imageWriter struct {
+	w    *bufio.Writer
+	err  error
+	buf  [binary.MaxVarintLen64]byte
+	vars map[Variable]uint64
+}
+
+func (iw *imageWriter) uvarint(n uint64) {
+	l := binary.PutUvarint(iw.buf[:], n)
+	_, _ = iw.w.Write(iw.buf[:l])
+}
+
+func (iw *imageWriter) varint(n int64) {
+	l := binary.PutVarint(iw.buf[:], n)
+	_, _ = iw.w.Write(iw.buf[:l])
+}
+
+func (iw *imageWriter) string(s string) {
+	iw.uvarint(uint64(len(s)))
+	_, _ = iw.w.WriteString(s)
+}
+
+func (iw *imageWriter) procedure(pi procedureIndicator, u *userDefined) {
+	iw.string(pi.name.String())
+	iw.varint(int64(pi.arity))
+
+	var flags uint64
+	for _, f := range []struct {
+		set  bool
+		flag uint64
+	}{
+		{set: u.public, flag: imageFlagPublic},
+		{set: u.dynamic, flag: imageFlagDynamic},
+		{set: u.multifile, flag: imageFlagMultifile},
+		{set: u.discontiguous, flag: imageFlagDiscontiguous},
+		{set: u.schema != nil, flag: imageFlagSchema},
+	} {
+		if f.set {
+			flags |= f.flag
+		}
+	}
+	iw.uvarint(flags)
+
+	iw.uvarint(uint64(len(u.indexes)))
+	for _, i := range u.indexes {
+		iw.uvarint(uint64(len(i.args)))
+		for _, a := range i.args {
+			iw.varint(int64(a))
+		}
+	}
+
+	if u.schema != nil {
+		iw.uvarint(uint64(len(u.schema)))
+		for _, t := range u.schema {
+			iw.term(t)
+		}
+	}
+
+	iw.uvarint(uint64(len(u.clauses)))
+	for i := range u.clauses {
+		iw.clause(&u.clauses[i])
+	}
+}
+
+func (iw *imageWriter) clause(c *clause) {
+	// Variables are numbered in each clause. The ones in c.vars come first so that the offsets in the bytecode hold.
+	iw.vars = make(map[Variable]uint64, len(c.vars))
+	for i, v := range c.vars {
+		iw.vars[v] = uint64(i)
+	}
+	iw.uvarint(uint64(len(c.vars)))
+	iw.term(c.raw)
+	iw.term(c.metadata)
+	iw.uvarint(uint64(len(c.bytecode)))
+	for _, i := range c.bytecode {
+		_ = iw.w.WriteByte(imageOpcodes[i.opcode])
+		iw.term(i.operand)
+	}
+}
+
+func (iw *imageWriter) term(t Term) {
+	if iw.err != nil {
+		return
+	}
+	switch t := t.(type) {
+	case nil:
+		_ = iw.w.WriteByte(tagNil)
+	case Atom:
+		_ = iw.w.WriteByte(tagAtom)
+		iw.string(t.String())
+	case Integer:
+		_ = iw.w.WriteByte(tagInteger)
+		iw.varint(int64(t))
+	case Float:
+		_ = iw.w.WriteByte(tagFloat)
+		iw.uvarint(math.Float64bits(float64(t)))
+	case String:
+		_ = iw.w.WriteByte(tagString)
+		iw.string(string(t))
+	case Variable:
+		n, ok := iw.vars[t]
+		if !ok {
+			n = uint64(len(iw.vars))
+			iw.vars[t] = n
+		}
+		_ = iw.w.WriteByte(tagVariable)
+		iw.uvarint(n)
+	case procedureIndicator:
+		_ = iw.w.WriteByte(tagProcedureIndicator)
+		iw.string(t.name.String())
+		iw.varint(int64(t.arity))
+	case charList:
+		_ = iw.w.WriteByte(tagCharList)
+		iw.string(string(t))
+	case codeList:
+		_ = iw.w.WriteByte(tagCodeList)
+		iw.string(string(t))
+	case list:
+		_ = iw.w.WriteByte(tagList)
+		iw.uvarint(uint64(len(t)))
+		for _, e := range t {
+			iw.term(e)
+		}
+	case *partial:
+		_ = iw.w.WriteByte(tagPartial)
+		iw.term(t.Compound)
+		iw.term(*t.tail)
+	case Compound:
+		_ = iw.w.WriteByte(tagCompound)
+		iw.string(t.Functor().String())
+		iw.uvarint(uint64(t.Arity()))
+		for i := 0; i < t.Arity(); i++ {
+			iw.term(t.Arg(i))
+		}
+	default:
+		iw.err = fmt.Errorf("can't save %T in an image", t)
+	}
+}
+
+type imageReader struct {
+	r    *bufio.Reader
+	err  error
+	vars []Variable
+}
+
+func (ir *imageReader) uvarint() uint64 {
+	if ir.err != nil {
+		return 0
+	}
+	n, err := binary.ReadUvarint(ir.r)
+	if err != nil {
+		ir.err = err
+	}
+	return n
+}
+
+func (ir *imageReader) varint() int64 {
+	if ir.err != nil {
+		return 0
+	}
+	n, err := binary.ReadVarint(ir.r)
+	if err != nil {
+		ir.err = err
+	}
+	return n
+}
+
+func (ir *imageReader) byte() byte {
+	if ir.err != nil {
+		return 0
+	}
+	b, err := ir.r.ReadByte()
+	if err != nil {
+		ir.err = err
+	}
+	return b
+}
+
+func (ir *imageReader) string() string {
+	n := ir.count()
+	if ir.err != nil {
+		return ""
+	}
+	// Don't trust n for allocation in case the image is corrupted.
+	var sb strings.Builder
+	if _, err := io.CopyN(&sb, ir.r, int64(n)); err != nil {
+		ir.err = err
+		return ""
+	}
+	return sb.String()
+}
+
+func (ir *imageReader) rune() rune {
+	n := ir.uvarint()
+	if n > utf8.MaxRune || !utf8.ValidRune(rune(n)) {
+		ir.fail("invalid character")
+		return utf8.RuneError
+	}
+	return rune(n)
+}
+
+// count reads a length and makes sure it's not unreasonably large for a corrupted image.
+func (ir *imageReader) count() int {
+	n := ir.uvarint()
+	if n > math.MaxInt32 {
+		ir.fail("count too large")
+		return 0
+	}
+	return int(n)
+}
+
+func (ir *imageReader) procedure() (procedureIndicator, *userDefined) {
+	pi := procedureIndicator{name: NewAtom(ir.string()), arity: Integer(ir.varint())}
+
+	var u userDefined
+	flags := ir.uvarint()
+	u.public = flags&imageFlagPublic != 0
+	u.dynamic = flags&imageFlagDynamic != 0
+	u.multifile = flags&imageFlagMultifile != 0
+	u.discontiguous = flags&imageFlagDiscontiguous != 0
+
+	n := ir.count()
+	for i := 0; i < n && ir.err == nil; i++ {
+		var idx index
+		m := ir.count()
+		for j := 0; j < m && ir.err == nil; j++ {
+			idx.args = append(idx.args, int(ir.varint()))
+		}
+		u.indexes = append(u.indexes, &idx)
+	}
+
+	if flags&imageFlagSchema != 0 {
+		n := ir.count()
+		u.schema = make([]Term, 0, n)
+		for i := 0; i < n && ir.err == nil; i++ {
+			u.schema = append(u.schema, ir.term())
+		}
+	}
+
+	n = ir.count()
+	for i := 0; i < n && ir.err == nil; i++ {
+		u.clauses = append(u.clauses, ir.clause(pi))
+	}
+	return pi, &u
+}
+
+func (ir *imageReader) clause(pi procedureIndicator) clause {
+	c := clause{pi: pi}
+	n := ir.count()
+	ir.vars = nil
+	for i := 0; i < n && ir.err == nil; i++ {
+		ir.vars = append(ir.vars, NewVariable())
+	}
+	c.vars = ir.vars[:len(ir.vars):len(ir.vars)]
+	c.raw = ir.term()
+	c.metadata = ir.term()
+	n = ir.count()
+	for i := 0; i < n && ir.err == nil; i++ {
+		op, ok := imageOpcodeDecodings[ir.byte()]
+		if !ok {
+			ir.fail("unknown opcode")
+			break
+		}
+		c.bytecode = append(c.bytecode, instruction{opcode: op, operand: ir.term()})
+	}
+	if ir.err == nil {
+		if err := c.bytecode.validate(len(c.vars)); err != nil {
+			ir.fail(err.Error())
+		}
+	}
+	return c
+}
+
+// validate makes sure the bytecode doesn't make the VM go out of bounds nor misinterpret operands.
+func (pc bytecode) validate(vars int) error {
+	if len(pc) == 0 || pc[len(pc)-1].opcode != opExit {
+		return errors.New("bytecode without exit")
+	}
+	for i, op := range pc {
+		var ok bool
+		switch op.opcode {
+		case opEnter, opExit, opPop, opCut:
+			ok = op.operand == nil
+		case opGetConst, opPutConst:
+			ok = op.operand != nil
+		case opGetVar, opPutVar, opGetFirstVar, opIs:
+			n, isInt := op.operand.(Integer)
+			ok = isInt && n >= 0 && int(n) < vars
+		case opCall, opGetFunctor, opPutFunctor:
+			pi, isPI := op.operand.(procedureIndicator)
+			ok = isPI && pi.arity >= 0
+		case opGetList, opPutList, opGetPartial, opPutPartial:
+			n, isInt := op.operand.(Integer)
+			ok = isInt && n >= 0
+		case opGetPacked, opPutPacked:
+			_, ok = op.operand.(Compound)
+		case opDisj, opIfThen, opSoftCut, opJump:
+			// The offsets are relative to the next instruction.
+			n, isInt := op.operand.(Integer)
+			ok = isInt && n >= 0 && i+1+int(n) < len(pc)
+		}
+		if !ok {
+			return fmt.Errorf("invalid instruction at %d", i)
+		}
+	}
+	return nil
+}
+
+func (ir *imageReader) term() Term {
+	switch tag := ir.byte(); tag {
+	case tagNil:
+		return nil
+	case tagAtom:
+		return NewAtom(ir.string())
+	case tagInteger:
+		return Integer(ir.varint())
+	case tagFloat:
+		return Float(math.Float64frombits(ir.uvarint()))
+	case tagString:
+		return String(ir.string())
+	case tagVariable:
+		// Variables are numbered in the order of appearance.
+		switch n := ir.count(); {
+		case ir.err != nil:
+			return nil
+		case n < len(ir.vars):
+			return ir.vars[n]
+		case n == len(ir.vars):
+			v := NewVariable()
+			ir.vars = append(ir.vars, v)
+			return v
+		default:
+			ir.fail("variable out of order")
+			return nil
+		}
+	case tagProcedureIndicator:
+		return procedureIndicator{name: NewAtom(ir.string()), arity: Integer(ir.varint())}
+	case tagCharList:
+		return charList(ir.string())
+	case tagCodeList:
+		return codeList(ir.string())
+	case tagList:
+		var l list
+		n := ir.count()
+		for i := 0; i < n && ir.err == nil; i++ {
+			l = append(l, ir.term())
+		}
+		return l
+	case tagPartial:
+		c, ok := ir.term().(Compound)
+		if !ok {
+			ir.fail("partial list without prefix")
+			return nil
+		}
+		tail := ir.term()
+		return &partial{Compound: c, tail: &tail}
+	case tagCompound:
+		f := NewAtom(ir.string())
+		var args []Term
+		n := ir.count()
+		for i := 0; i < n && ir.err == nil; i++ {
+			args = append(args, ir.term())
+		}
+		return f.Apply(args...)
+	default:
+		ir.fail(fmt.Sprintf("unknown tag %d", tag))
+		return nil
+	}
+}
+
+func (ir *imageReader) fail(msg string) {
+	if ir.err == nil {
+		ir.err = errors.New(msg)
+	}
+}
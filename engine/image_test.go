@@ -0,0 +1,218 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVM_SaveImage(t *testing.T) {
+	var vm VM
+	vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+	vm.operators.define(1200, operatorSpecifierFX, atomIf)
+	vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+	vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+	vm.Register2(atomEqual, Unify)
+	vm.Register1(NewAtom("dynamic"), func(vm *VM, pi Term, k Cont, env *Env) *Promise {
+		return k(env)
+	})
+	vm.Register3(NewAtom("op"), Op)
+	vm.Register2(NewAtom("set_prolog_flag"), SetPrologFlag)
+	var inits int
+	vm.Register1(NewAtom("init"), func(vm *VM, x Term, k Cont, env *Env) *Promise {
+		inits++
+		return Unify(vm, x, NewAtom("done"), k, env)
+	})
+	assert.NoError(t, vm.Compile(context.Background(), `
+:- dynamic(edge/2).
+:- index(edge/2, [2]).
+:- op(700, xfx, ===>).
+:- set_prolog_flag(unknown, fail).
+:- initialization(init(_)).
+edge(a, b).
+edge(b, c).
+path(X, Y) :- edge(X, Y).
+path(X, Z) :- edge(X, Y), path(Y, Z).
+data(f(X, "abc", 1.5, 0'a, [x, y|T]), X, T).
+`))
+
+	var buf bytes.Buffer
+	assert.NoError(t, vm.SaveImage(&buf))
+
+	var restored VM
+	restored.Register2(atomEqual, Unify)
+	restored.Register2(NewAtom("set_prolog_flag"), SetPrologFlag)
+	var restoredInits int
+	restored.Register1(NewAtom("init"), func(vm *VM, x Term, k Cont, env *Env) *Promise {
+		restoredInits++
+		return Unify(vm, x, NewAtom("done"), k, env)
+	})
+	assert.NoError(t, restored.LoadImage(bytes.NewReader(buf.Bytes())))
+	assert.Equal(t, 1, inits)
+	assert.Equal(t, 1, restoredInits)
+	assert.Equal(t, vm.operators, restored.operators)
+	assert.Equal(t, unknownFail, restored.unknown)
+
+	pi := procedureIndicator{name: NewAtom("edge"), arity: 2}
+	u := restored.procedures[pi].(*userDefined)
+	assert.True(t, u.dynamic)
+	assert.Len(t, u.indexes, 1)
+	assert.Equal(t, []int{1}, u.indexes[0].args)
+
+	var zs []Term
+	z := NewVariable()
+	_, err := restored.Arrive(NewAtom("path"), []Term{NewAtom("a"), z}, func(env *Env) *Promise {
+		zs = append(zs, env.Resolve(z))
+		return Bool(false)
+	}, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []Term{NewAtom("b"), NewAtom("c")}, zs)
+
+	d, x, tail := NewVariable(), NewVariable(), NewVariable()
+	ok, err := restored.Arrive(NewAtom("data"), []Term{d, x, tail}, func(env *Env) *Promise {
+		var sb bytes.Buffer
+		assert.NoError(t, env.Resolve(d).WriteTerm(&sb, &WriteOptions{quoted: true}, env))
+		assert.Regexp(t, `^f\(_\d+,\[a,b,c\],1\.5,97,\[x,y\|_\d+\]\)$`, sb.String())
+		_, ok := env.Unify(tuple(x, tail), tuple(NewAtom("x"), NewAtom("t")))
+		assert.True(t, ok)
+		return Bool(true)
+	}, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	t.Run("deterministic", func(t *testing.T) {
+		var again bytes.Buffer
+		assert.NoError(t, restored.SaveImage(&again))
+		assert.Equal(t, buf.Bytes(), again.Bytes())
+	})
+
+	t.Run("custom term", func(t *testing.T) {
+		var vm VM
+		vm.procedures = map[procedureIndicator]procedure{
+			{name: NewAtom("foo"), arity: 0}: &userDefined{clauses: clauses{{raw: &Stream{}}}},
+		}
+		assert.Error(t, vm.SaveImage(&bytes.Buffer{}))
+	})
+}
+
+func TestVM_SaveSession(t *testing.T) {
+	var vm VM
+	vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+	vm.operators.define(1200, operatorSpecifierFX, atomIf)
+	vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+	vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+	vm.Register1(NewAtom("dynamic"), func(vm *VM, pi Term, k Cont, env *Env) *Promise {
+		return k(env)
+	})
+	vm.Register3(NewAtom("op"), Op)
+	vm.Register2(NewAtom("set_prolog_flag"), SetPrologFlag)
+	vm.Register1(NewAtom("assertz"), Assertz)
+	var inits int
+	vm.Register0(NewAtom("init"), func(vm *VM, k Cont, env *Env) *Promise {
+		inits++
+		return k(env)
+	})
+	assert.NoError(t, vm.Compile(context.Background(), `
+:- dynamic(fact/1).
+:- initialization(init).
+rule(X) :- fact(X).
+`))
+	_, err := Assertz(&vm, NewAtom("fact").Apply(NewAtom("a")), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	_, err = Op(&vm, Integer(700), atomXFX, NewAtom("===>"), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	_, err = SetPrologFlag(&vm, atomUnknown, atomFail, Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	_, err = SetPrologFlag(&vm, atomCharConversion, atomOn, Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	_, err = CharConversion(&vm, NewAtom("&"), NewAtom(","), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, vm.SaveSession(&buf))
+
+	var restored VM
+	restored.Register2(NewAtom("set_prolog_flag"), SetPrologFlag)
+	restored.initialization = []Term{NewAtom("init")}
+	assert.NoError(t, restored.LoadImage(bytes.NewReader(buf.Bytes())))
+	assert.Equal(t, 1, inits)
+	assert.Equal(t, vm.operators, restored.operators)
+	assert.Equal(t, unknownFail, restored.unknown)
+	assert.Equal(t, []Term{NewAtom("init")}, restored.initialization)
+	assert.True(t, restored.charConvEnabled)
+	assert.Equal(t, map[rune]rune{'&': ','}, restored.charConversions)
+
+	_, ok := restored.procedures[procedureIndicator{name: NewAtom("rule"), arity: 1}]
+	assert.False(t, ok)
+	u, ok := restored.procedures[procedureIndicator{name: NewAtom("fact"), arity: 1}].(*userDefined)
+	assert.True(t, ok)
+	assert.True(t, u.dynamic)
+	assert.Len(t, u.clauses, 1)
+}
+
+func TestVM_LoadImage(t *testing.T) {
+	var vm VM
+	assert.Equal(t, errImageMagic, vm.LoadImage(bytes.NewReader([]byte("foo"))))
+	assert.True(t, errors.Is(vm.LoadImage(bytes.NewReader([]byte(imageMagic+"\x01"))), errImageVersion))
+	assert.Error(t, vm.LoadImage(bytes.NewReader([]byte(imageMagic+"\x02\x01\x03foo"))))
+	assert.Error(t, vm.LoadImage(bytes.NewReader([]byte(imageMagic+"\x02\x01\x03foo\x00\x00\x00\x01\x00\xff"))))
+
+	// foo :- <unknown opcode>.
+	assert.EqualError(t, vm.LoadImage(bytes.NewReader([]byte(imageMagic+"\x02\x01\x03foo\x00\x00\x00\x01\x00\x00\x00\x01\xff"))), "corrupted image: unknown opcode")
+	// foo :- <put the 5th variable of none>, <exit>.
+	assert.EqualError(t, vm.LoadImage(bytes.NewReader([]byte(imageMagic+"\x02\x01\x03foo\x00\x00\x00\x01\x00\x00\x00\x02\x07\x02\x0a\x03\x00"))), "corrupted image: invalid instruction at 0")
+	// foo :- <jump beyond the end>, <exit>.
+	assert.EqualError(t, vm.LoadImage(bytes.NewReader([]byte(imageMagic+"\x02\x01\x03foo\x00\x00\x00\x01\x00\x00\x00\x02\x15\x02\x02\x03\x00"))), "corrupted image: invalid instruction at 0")
+	// foo :- <call>.
+	assert.EqualError(t, vm.LoadImage(bytes.NewReader([]byte(imageMagic+"\x02\x01\x03foo\x00\x00\x00\x01\x00\x00\x00\x01\x02\x0b\x03bar\x00"))), "corrupted image: bytecode without exit")
+	// An operator of an unknown specifier.
+	assert.EqualError(t, vm.LoadImage(bytes.NewReader([]byte(imageMagic+"\x02\x00\x01\x03===\xbc\x05\x01\x03foo"))), "corrupted image: invalid operator")
+	// A character conversion from an invalid character.
+	assert.EqualError(t, vm.LoadImage(bytes.NewReader([]byte(imageMagic+"\x04\x00\x00\x00\x01\x80\x80\xc4\x00\x2c"))), "corrupted image: invalid character")
+	assert.Nil(t, vm.procedures)
+	assert.Nil(t, vm.operators)
+	assert.Nil(t, vm.charConversions)
+
+	t.Run("migration", func(t *testing.T) {
+		// Version 3 images have no character conversions so that the current ones are kept.
+		vm := VM{charConversions: map[rune]rune{'&': ','}}
+		assert.NoError(t, vm.LoadImage(bytes.NewReader([]byte(imageMagic+"\x03\x00\x00\x00\x00"))))
+		assert.Equal(t, map[rune]rune{'&': ','}, vm.charConversions)
+
+		// Whereas version 4 images replace them.
+		assert.NoError(t, vm.LoadImage(bytes.NewReader([]byte(imageMagic+"\x04\x00\x00\x00\x01\x61\x62\x00"))))
+		assert.Equal(t, map[rune]rune{'a': 'b'}, vm.charConversions)
+	})
+}
+
+func TestReadImageProcedures(t *testing.T) {
+	var vm VM
+	vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+	vm.operators.define(1200, operatorSpecifierFX, atomIf)
+	vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+	vm.Register1(NewAtom("dynamic"), func(vm *VM, pi Term, k Cont, env *Env) *Promise {
+		return k(env)
+	})
+	assert.NoError(t, vm.Compile(context.Background(), `
+:- dynamic(foo/1).
+foo(a).
+foo(b).
+bar.
+`))
+	var buf bytes.Buffer
+	assert.NoError(t, vm.SaveImage(&buf))
+
+	ps, err := ReadImageProcedures(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, vm.AllClauses(), ps)
+
+	_, err = ReadImageProcedures(bytes.NewReader([]byte("foo")))
+	assert.Equal(t, errImageMagic, err)
+	_, err = ReadImageProcedures(bytes.NewReader([]byte(imageMagic + "\x01")))
+	assert.True(t, errors.Is(err, errImageVersion))
+	_, err = ReadImageProcedures(bytes.NewReader([]byte(imageMagic + "\x02\x01\x03foo")))
+	assert.Error(t, err)
+}
@@ -0,0 +1,400 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// index is a hash table of clauses keyed by the ground arguments at the specified positions.
+// It's declared by the directive index/2 and built on the first call. Then, it's kept up to date as clauses are
+// asserted or retracted.
+type index struct {
+	args []int // 0-based positions of the arguments.
+
+	mu      sync.Mutex // Guards the hash table while it's built or modified.
+	built   atomic.Bool
+	buckets map[string]clauses
+	rest    clauses // clauses which may match any key.
+}
+
+// invalidate discards the hash table so that it's rebuilt on the next call.
+func (i *index) invalidate() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.built.Store(false)
+	i.buckets = nil
+	i.rest = nil
+}
+
+// key returns the hash key of the arguments at the positions if they're all ground.
+func (i *index) key(args []Term, env *Env) (string, bool) {
+	var sb strings.Builder
+	for _, n := range i.args {
+		if n < 0 || n >= len(args) {
+			return "", false
+		}
+		if writeTermKey(&sb, args[n], nil, env) != nil {
+			return "", false
+		}
+	}
+	return sb.String(), true
+}
+
+// lookup returns the clauses which may match the key in the original order.
+func (i *index) lookup(cs clauses, key string) clauses {
+	if !i.built.Load() {
+		i.mu.Lock()
+		if !i.built.Load() {
+			i.build(cs)
+		}
+		i.mu.Unlock()
+	}
+	if b, ok := i.buckets[key]; ok {
+		return b
+	}
+	return i.rest
+}
+
+func (i *index) build(cs clauses) {
+	i.buckets = map[string]clauses{}
+	i.rest = nil
+	for _, c := range cs {
+		i.insert(c, false)
+	}
+	i.built.Store(true)
+}
+
+// add puts the clauses either in front of or after the existing ones if the hash table is already built.
+func (i *index) add(added clauses, front bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if !i.built.Load() {
+		return
+	}
+	if front {
+		for j := len(added) - 1; j >= 0; j-- {
+			i.insert(added[j], true)
+		}
+		return
+	}
+	for _, c := range added {
+		i.insert(c, false)
+	}
+}
+
+// insert puts the clause in the bucket of its key. The buckets are never modified in place except for appending
+// so that the callers looking into them aren't affected.
+func (i *index) insert(c clause, front bool) {
+	put := func(cs clauses) clauses {
+		if front {
+			return append(clauses{c}, cs...)
+		}
+		return append(cs, c)
+	}
+
+	k, ok := i.key(c.headArgs(), nil)
+	if !ok {
+		// It may match any key, so it goes to every bucket including the ones which will be made later.
+		for key, b := range i.buckets {
+			i.buckets[key] = put(b)
+		}
+		i.rest = put(i.rest)
+		return
+	}
+	b, ok := i.buckets[k]
+	if !ok {
+		b = append(clauses{}, i.rest...)
+	}
+	i.buckets[k] = put(b)
+}
+
+// remove takes the clauses out of the buckets if the hash table is already built.
+func (i *index) remove(removed clauses) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if !i.built.Load() {
+		return
+	}
+	for _, c := range removed {
+		k, ok := i.key(c.headArgs(), nil)
+		if !ok {
+			for key, b := range i.buckets {
+				i.buckets[key] = b.without(c)
+			}
+			i.rest = i.rest.without(c)
+			continue
+		}
+		if b, ok := i.buckets[k]; ok {
+			i.buckets[k] = b.without(c)
+		}
+	}
+}
+
+// without returns a copy of cs except for c.
+func (cs clauses) without(c clause) clauses {
+	ret := make(clauses, 0, len(cs))
+	for _, e := range cs {
+		if !e.same(c) {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+// same tells if the clauses are the same ones in the same order.
+func (cs clauses) same(os clauses) bool {
+	if len(cs) != len(os) {
+		return false
+	}
+	for i := range cs {
+		if !cs[i].same(os[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// same tells if the clauses are from the same compilation. Copies of a clause e.g. by Fork share the bytecode.
+func (c *clause) same(o clause) bool {
+	return len(c.bytecode) > 0 && len(o.bytecode) > 0 && &c.bytecode[0] == &o.bytecode[0]
+}
+
+// writeTermKey writes a representation of t which is identical iff the terms are identical.
+// If vars is not nil, variables are numbered in the order of appearance so that the representation is identical iff
+// the terms are variants. It returns the first term in t which can't be represented or a variable while vars is nil.
+// It doesn't recurse so that a deep term e.g. a long list doesn't exhaust the stack.
+func writeTermKey(sb *strings.Builder, t Term, vars map[Variable]int, env *Env) Term {
+	ts := []Term{t}
+	for len(ts) > 0 {
+		t, ts = ts[len(ts)-1], ts[:len(ts)-1]
+		if t == nil { // The end of a compound.
+			_, _ = sb.WriteString(")")
+			continue
+		}
+		switch t := env.Resolve(t).(type) {
+		case Variable:
+			if vars == nil {
+				return t
+			}
+			n, ok := vars[t]
+			if !ok {
+				n = len(vars)
+				vars[t] = n
+			}
+			_, _ = fmt.Fprintf(sb, "v%d;", n)
+		case Atom:
+			_, _ = fmt.Fprintf(sb, "a%d;", t)
+		case Integer:
+			_, _ = fmt.Fprintf(sb, "i%d;", t)
+		case Float:
+			_, _ = fmt.Fprintf(sb, "f%s;", strconv.FormatFloat(float64(t), 'g', -1, 64))
+		case String:
+			_, _ = fmt.Fprintf(sb, "s%s;", strconv.Quote(string(t)))
+		case Compound:
+			_, _ = fmt.Fprintf(sb, "c%d/%d(", t.Functor(), t.Arity())
+			ts = append(ts, nil)
+			for i := t.Arity() - 1; i >= 0; i-- {
+				ts = append(ts, t.Arg(i))
+			}
+		default:
+			return t
+		}
+	}
+	return nil
+}
+
+// headArgs returns the arguments of the clause head.
+func (c *clause) headArgs() []Term {
+	h := c.raw
+	if r, ok := h.(Compound); ok && r.Functor() == atomIf && r.Arity() == 2 {
+		h = r.Arg(0)
+	}
+	var args []Term
+	if h, ok := h.(Compound); ok {
+		args = make([]Term, h.Arity())
+		for i := range args {
+			args[i] = h.Arg(i)
+		}
+	}
+	return args
+}
+
+// indexArgs converts a list of 1-based argument positions to 0-based ones.
+func indexArgs(positions Term, env *Env) ([]int, error) {
+	var args []int
+	iter := ListIterator{List: positions, Env: env}
+	for iter.Next() {
+		switch n := env.Resolve(iter.Current()).(type) {
+		case Variable:
+			return nil, InstantiationError(env)
+		case Integer:
+			if n < 0 {
+				return nil, domainError(validDomainNotLessThanZero, n, env)
+			}
+			// As well as arg/3, the 0th argument doesn't exist. Such an index will never be used.
+			args = append(args, int(n)-1)
+		default:
+			return nil, typeError(validTypeInteger, n, env)
+		}
+	}
+	return args, iter.Err()
+}
+
+// DeclareIndex declares an index of the procedure on the arguments at the 1-based positions just like the directive
+// index/2. Unlike the directive, it keeps the clauses of the procedure if it already exists. Otherwise, it creates an
+// empty dynamic procedure.
+func (vm *VM) DeclareIndex(name Atom, arity int, positions ...int) error {
+	pi := procedureIndicator{name: name, arity: Integer(arity)}
+
+	db := vm.database()
+	db.Lock()
+	defer db.Unlock()
+
+	if vm.procedures == nil {
+		vm.procedures = map[procedureIndicator]procedure{}
+	}
+	p, ok := vm.procedures[pi]
+	if !ok {
+		p = &userDefined{dynamic: true}
+		vm.procedures[pi] = p
+	}
+	u, ok := p.(*userDefined)
+	if !ok {
+		return permissionError(operationModify, permissionTypeStaticProcedure, pi.Term(), nil)
+	}
+
+	args, err := indexPositions(positions)
+	if err != nil {
+		return err
+	}
+	for _, i := range u.indexes {
+		if equalInts(i.args, args) {
+			return nil
+		}
+	}
+	u.indexes = append(u.indexes, &index{args: args})
+	return nil
+}
+
+// Reindex replaces the indexes of the procedure with the ones on the arguments at the 1-based positions e.g. when the
+// callers turned out to look it up by other arguments. The hash tables of the new indexes are built from the clauses
+// before they're swapped in at once so that the calls in the meantime keep using the old indexes instead of waiting
+// for the new ones to be built on the first call. If the clauses are asserted or retracted while they're built, they're
+// built again. Call it in a goroutine to reindex a procedure of a long-running service in the background.
+func (vm *VM) Reindex(ctx context.Context, name Atom, arity int, positions ...[]int) error {
+	pi := procedureIndicator{name: name, arity: Integer(arity)}
+	u, ok := vm.procedures[pi].(*userDefined)
+	if !ok {
+		return existenceError(objectTypeProcedure, pi.Term(), nil)
+	}
+
+	var args [][]int
+	for _, ps := range positions {
+		a, err := indexPositions(ps)
+		if err != nil {
+			return err
+		}
+		args = append(args, a)
+	}
+
+	for {
+		cs := u.clauses
+		indexes := make([]*index, len(args))
+		for i, a := range args {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			indexes[i] = &index{args: a}
+			indexes[i].build(cs)
+		}
+		if cs.same(u.clauses) {
+			u.indexes = indexes
+			return nil
+		}
+	}
+}
+
+// indexPositions converts 1-based argument positions to 0-based ones.
+func indexPositions(positions []int) ([]int, error) {
+	args := make([]int, len(positions))
+	for i, n := range positions {
+		if n < 0 {
+			return nil, domainError(validDomainNotLessThanZero, Integer(n), nil)
+		}
+		args[i] = n - 1
+	}
+	return args, nil
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (u *userDefined) call(vm *VM, args []Term, k Cont, env *Env) *Promise {
+	return u.candidates(args, env).call(vm, args, k, env)
+}
+
+// candidates returns the clauses which may match the arguments.
+// If more than one index is applicable, we pick the one with the most arguments.
+func (u *userDefined) candidates(args []Term, env *Env) clauses {
+	var (
+		best *index
+		key  string
+	)
+	for _, i := range u.indexes {
+		if best != nil && len(i.args) <= len(best.args) {
+			continue
+		}
+		if k, ok := i.key(args, env); ok {
+			best, key = i, k
+		}
+	}
+	if best == nil {
+		return u.clauses
+	}
+	return best.lookup(u.clauses, key)
+}
+
+// invalidateIndexes has to be called whenever the clauses are modified other than by addIndexes or removeIndexes.
+func (u *userDefined) invalidateIndexes() {
+	for _, i := range u.indexes {
+		i.invalidate()
+	}
+}
+
+// addIndexes updates the indexes for the clauses added in front of or after the existing ones.
+func (u *userDefined) addIndexes(added clauses, front bool) {
+	for _, i := range u.indexes {
+		i.add(added, front)
+	}
+}
+
+// buildIndexes builds the hash tables of the indexes which aren't built yet.
+func (u *userDefined) buildIndexes() {
+	for _, i := range u.indexes {
+		i.mu.Lock()
+		if !i.built.Load() {
+			i.build(u.clauses)
+		}
+		i.mu.Unlock()
+	}
+}
+
+// removeIndexes updates the indexes for the removed clauses.
+func (u *userDefined) removeIndexes(removed clauses) {
+	for _, i := range u.indexes {
+		i.remove(removed)
+	}
+}
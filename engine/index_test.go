@@ -0,0 +1,265 @@
+package engine
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserDefined_candidates(t *testing.T) {
+	var vm VM
+	vm.operators.define(1200, operatorSpecifierFX, atomIf)
+	vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+	vm.Register1(NewAtom("throw"), Throw)
+	assert.NoError(t, vm.Compile(context.Background(), `
+:- index(edge/2, [1, 2]).
+:- index(edge/2, [2]).
+edge(a, b).
+edge(b, c).
+edge(X, X).
+edge(a, c).
+edge(f(a), "x").
+edge(b, a).
+`))
+
+	u := vm.procedures[procedureIndicator{name: NewAtom("edge"), arity: 2}].(*userDefined)
+	assert.Len(t, u.indexes, 2)
+
+	// positions returns the positions of the clauses in the procedure.
+	positions := func(cs clauses) []int {
+		ps := []int{}
+		for _, c := range cs {
+			for i := range u.clauses {
+				if c.raw == u.clauses[i].raw {
+					ps = append(ps, i)
+				}
+			}
+		}
+		return ps
+	}
+
+	y := NewVariable()
+	a, b, c := NewAtom("a"), NewAtom("b"), NewAtom("c")
+
+	tests := []struct {
+		title     string
+		args      []Term
+		env       *Env
+		positions []int
+	}{
+		{title: "both", args: []Term{a, c}, positions: []int{2, 3}},
+		{title: "second", args: []Term{y, c}, positions: []int{1, 2, 3}},
+		{title: "bound variable", args: []Term{y, c}, env: NewEnv().bind(y, a), positions: []int{2, 3}},
+		{title: "compound and list", args: []Term{NewAtom("f").Apply(a), List(NewAtom("x"))}, positions: []int{2, 4}},
+		{title: "no such key", args: []Term{NewAtom("z"), NewAtom("z")}, positions: []int{2}},
+		{title: "not applicable", args: []Term{a, y}, positions: []int{0, 1, 2, 3, 4, 5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			assert.Equal(t, tt.positions, positions(u.candidates(tt.args, tt.env)))
+		})
+	}
+
+	t.Run("invalidated", func(t *testing.T) {
+		assert.Equal(t, []int{0, 2}, positions(u.candidates([]Term{a, b}, nil)))
+		u.clauses = u.clauses[1:]
+		u.invalidateIndexes()
+		assert.Equal(t, []int{1}, positions(u.candidates([]Term{a, b}, nil)))
+	})
+
+	t.Run("concurrent lookups", func(t *testing.T) {
+		u.invalidateIndexes()
+		var wg sync.WaitGroup
+		for n := 0; n < 8; n++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.Len(t, u.candidates([]Term{a, c}, nil), 2)
+			}()
+		}
+		wg.Wait()
+	})
+}
+
+func TestUserDefined_candidates_updated(t *testing.T) {
+	var vm VM
+	vm.operators.define(1200, operatorSpecifierFX, atomIf)
+	vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+	vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+	vm.Register1(NewAtom("throw"), Throw)
+	assert.NoError(t, vm.Compile(context.Background(), `
+:- dynamic(edge/2).
+:- index(edge/2, [1]).
+edge(a, 1).
+edge(b, 2).
+edge(X, 3).
+`))
+
+	u := vm.procedures[procedureIndicator{name: NewAtom("edge"), arity: 2}].(*userDefined)
+	idx := u.indexes[0]
+	a, b, c := NewAtom("a"), NewAtom("b"), NewAtom("c")
+	edge := func(x, y Term) Term {
+		return NewAtom("edge").Apply(x, y)
+	}
+
+	// seconds returns the second arguments of the candidate clauses.
+	seconds := func(x Term) []Term {
+		var ret []Term
+		for _, c := range u.candidates([]Term{x, NewVariable()}, nil) {
+			ret = append(ret, c.headArgs()[1])
+		}
+		return ret
+	}
+
+	assert.Equal(t, []Term{Integer(1), Integer(3)}, seconds(a))
+
+	ok, err := Assertz(&vm, edge(a, Integer(4)), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = Asserta(&vm, edge(a, Integer(0)), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = Assertz(&vm, edge(NewVariable(), Integer(5)), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = Assertz(&vm, edge(c, Integer(6)), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// The hash table is updated in place instead of being rebuilt.
+	assert.True(t, idx.built.Load())
+	assert.Equal(t, []Term{Integer(0), Integer(1), Integer(3), Integer(4), Integer(5)}, seconds(a))
+	assert.Equal(t, []Term{Integer(2), Integer(3), Integer(5)}, seconds(b))
+	assert.Equal(t, []Term{Integer(3), Integer(5), Integer(6)}, seconds(c))
+	assert.Equal(t, []Term{Integer(3), Integer(5)}, seconds(NewAtom("d")))
+
+	ok, err = Retract(&vm, edge(a, Integer(1)), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = Retract(&vm, edge(NewAtom("z"), Integer(3)), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	assert.True(t, idx.built.Load())
+	assert.Equal(t, []Term{Integer(0), Integer(4), Integer(5)}, seconds(a))
+	assert.Equal(t, []Term{Integer(2), Integer(5)}, seconds(b))
+	assert.Equal(t, []Term{Integer(5), Integer(6)}, seconds(c))
+	assert.Equal(t, []Term{Integer(5)}, seconds(NewAtom("d")))
+}
+
+func TestIndexArgs(t *testing.T) {
+	args, err := indexArgs(List(Integer(1), Integer(2)), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 1}, args)
+
+	_, err = indexArgs(List(NewVariable()), nil)
+	assert.Equal(t, InstantiationError(nil), err)
+
+	_, err = indexArgs(List(NewAtom("a")), nil)
+	assert.Equal(t, typeError(validTypeInteger, NewAtom("a"), nil), err)
+
+	_, err = indexArgs(List(Integer(-1)), nil)
+	assert.Equal(t, domainError(validDomainNotLessThanZero, Integer(-1), nil), err)
+
+	_, err = indexArgs(NewAtom("a"), nil)
+	assert.Equal(t, typeError(validTypeList, NewAtom("a"), nil), err)
+}
+
+func TestVM_DeclareIndex(t *testing.T) {
+	edge := NewAtom("edge")
+
+	t.Run("existing", func(t *testing.T) {
+		var vm VM
+		ok, err := Assertz(&vm, edge.Apply(NewAtom("a"), Integer(1)), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		assert.NoError(t, vm.DeclareIndex(edge, 2, 1))
+		assert.NoError(t, vm.DeclareIndex(edge, 2, 1))
+
+		u := vm.procedures[procedureIndicator{name: edge, arity: 2}].(*userDefined)
+		assert.Len(t, u.clauses, 1)
+		assert.Len(t, u.indexes, 1)
+		assert.Equal(t, []int{0}, u.indexes[0].args)
+	})
+
+	t.Run("new", func(t *testing.T) {
+		var vm VM
+		assert.NoError(t, vm.DeclareIndex(edge, 2, 2))
+		u := vm.procedures[procedureIndicator{name: edge, arity: 2}].(*userDefined)
+		assert.True(t, u.dynamic)
+		assert.Equal(t, []int{1}, u.indexes[0].args)
+	})
+
+	t.Run("negative", func(t *testing.T) {
+		var vm VM
+		assert.Equal(t, domainError(validDomainNotLessThanZero, Integer(-1), nil), vm.DeclareIndex(edge, 2, -1))
+	})
+
+	t.Run("builtin", func(t *testing.T) {
+		var vm VM
+		vm.Register2(edge, func(_ *VM, _, _ Term, k Cont, env *Env) *Promise {
+			return k(env)
+		})
+		assert.Equal(t, permissionError(operationModify, permissionTypeStaticProcedure, atomSlash.Apply(edge, Integer(2)), nil), vm.DeclareIndex(edge, 2, 1))
+	})
+}
+
+func TestVM_Reindex(t *testing.T) {
+	edge := NewAtom("edge")
+	a, b, c := NewAtom("a"), NewAtom("b"), NewAtom("c")
+
+	var vm VM
+	for _, args := range [][2]Term{{a, b}, {b, c}, {a, c}} {
+		ok, err := Assertz(&vm, edge.Apply(args[0], args[1]), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	}
+	assert.NoError(t, vm.DeclareIndex(edge, 2, 1))
+	u := vm.procedures[procedureIndicator{name: edge, arity: 2}].(*userDefined)
+	old := u.indexes[0]
+
+	t.Run("ok", func(t *testing.T) {
+		assert.NoError(t, vm.Reindex(context.Background(), edge, 2, []int{2}, []int{1, 2}))
+		assert.Len(t, u.indexes, 2)
+		assert.Equal(t, []int{1}, u.indexes[0].args)
+		assert.Equal(t, []int{0, 1}, u.indexes[1].args)
+
+		// The new indexes are ready before the first call while the old one is left intact.
+		assert.True(t, u.indexes[0].built.Load())
+		assert.True(t, u.indexes[1].built.Load())
+		assert.False(t, old.built.Load())
+		assert.Len(t, u.candidates([]Term{NewVariable(), c}, nil), 2)
+		assert.Len(t, u.candidates([]Term{a, c}, nil), 1)
+
+		// They're kept up to date as well as the declared ones.
+		ok, err := Assertz(&vm, edge.Apply(c, c), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Len(t, u.candidates([]Term{NewVariable(), c}, nil), 3)
+	})
+
+	t.Run("no indexes", func(t *testing.T) {
+		assert.NoError(t, vm.Reindex(context.Background(), edge, 2))
+		assert.Empty(t, u.indexes)
+		assert.Len(t, u.candidates([]Term{NewVariable(), c}, nil), 4)
+	})
+
+	t.Run("unknown procedure", func(t *testing.T) {
+		assert.Equal(t, existenceError(objectTypeProcedure, atomSlash.Apply(edge, Integer(3)), nil), vm.Reindex(context.Background(), edge, 3, []int{1}))
+	})
+
+	t.Run("negative", func(t *testing.T) {
+		assert.Equal(t, domainError(validDomainNotLessThanZero, Integer(-1), nil), vm.Reindex(context.Background(), edge, 2, []int{-1}))
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.Equal(t, context.Canceled, vm.Reindex(ctx, edge, 2, []int{1}))
+		assert.Empty(t, u.indexes)
+	})
+}
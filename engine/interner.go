@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"unicode/utf8"
+)
+
+// Interner is a set of atoms interned in advance for the Go strings which appear over and over on ingestion hot paths
+// e.g. functors and enumerated values of millions of facts. Looking up an Interner doesn't take the lock of the atom
+// table and, with AtomBytes, doesn't convert the bytes to a string either.
+//
+// An Interner is read-only after NewInterner and safe for concurrent use.
+type Interner struct {
+	atoms map[string]Atom
+}
+
+// NewInterner interns names as permanent atoms at once and returns an Interner holding them.
+func NewInterner(names ...string) *Interner {
+	i := Interner{atoms: make(map[string]Atom, len(names))}
+
+	atomTable.Lock()
+	defer atomTable.Unlock()
+
+	for _, n := range names {
+		if _, ok := i.atoms[n]; ok {
+			continue
+		}
+		// A one-char atom is just a rune.
+		if r, s := utf8.DecodeLastRuneInString(n); r != utf8.RuneError && s == len(n) {
+			i.atoms[n] = Atom(r)
+			continue
+		}
+		i.atoms[n] = internPermanent(n)
+	}
+	return &i
+}
+
+// Lookup returns the atom of name if it's interned in advance.
+func (i *Interner) Lookup(name string) (Atom, bool) {
+	a, ok := i.atoms[name]
+	return a, ok
+}
+
+// Atom returns the atom of name. It falls back to NewAtom if name isn't interned in advance.
+func (i *Interner) Atom(name string) Atom {
+	if a, ok := i.atoms[name]; ok {
+		return a
+	}
+	return NewAtom(name)
+}
+
+// AtomBytes returns the atom of the name given as bytes e.g. a field of a record read by bufio.Scanner.
+// It allocates a string only if the name isn't interned in advance.
+func (i *Interner) AtomBytes(name []byte) Atom {
+	if a, ok := i.atoms[string(name)]; ok { // The compiler doesn't allocate a string for the lookup.
+		return a
+	}
+	return NewAtom(string(name))
+}
+
+// Atoms returns the atoms of names in the same order. It's handy to build the functors of facts once:
+//
+//	fs := i.Atoms("person", "name", "age")
+//	person, name, age := fs[0], fs[1], fs[2]
+func (i *Interner) Atoms(names ...string) []Atom {
+	as := make([]Atom, len(names))
+	for j, n := range names {
+		as[j] = i.Atom(n)
+	}
+	return as
+}
+
+// Len returns the number of the atoms interned in advance.
+func (i *Interner) Len() int {
+	return len(i.atoms)
+}
@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewInterner(t *testing.T) {
+	i := NewInterner("interner_foo", "interner_bar", "interner_foo", "a", "")
+	assert.Equal(t, 4, i.Len())
+
+	t.Run("same as NewAtom", func(t *testing.T) {
+		for _, n := range []string{"interner_foo", "interner_bar", "a", ""} {
+			a, ok := i.Lookup(n)
+			assert.True(t, ok)
+			assert.Equal(t, NewAtom(n), a)
+		}
+	})
+
+	t.Run("promotes temporary", func(t *testing.T) {
+		s := NewAtomScope()
+		a := s.NewAtom("interner_promoted")
+		i := NewInterner("interner_promoted")
+		s.Release()
+		assert.Equal(t, a, i.Atom("interner_promoted"))
+		assert.Equal(t, "interner_promoted", a.String())
+	})
+}
+
+func TestInterner_Lookup(t *testing.T) {
+	i := NewInterner("interner_lookup")
+	_, ok := i.Lookup("interner_not_interned")
+	assert.False(t, ok)
+}
+
+func TestInterner_Atom(t *testing.T) {
+	i := NewInterner("interner_atom")
+	assert.Equal(t, NewAtom("interner_atom"), i.Atom("interner_atom"))
+	assert.Equal(t, NewAtom("interner_atom_other"), i.Atom("interner_atom_other"))
+	_, ok := i.Lookup("interner_atom_other")
+	assert.False(t, ok)
+}
+
+func TestInterner_AtomBytes(t *testing.T) {
+	i := NewInterner("interner_bytes")
+	assert.Equal(t, NewAtom("interner_bytes"), i.AtomBytes([]byte("interner_bytes")))
+	assert.Equal(t, NewAtom("interner_bytes_other"), i.AtomBytes([]byte("interner_bytes_other")))
+
+	b := []byte("interner_bytes")
+	assert.Zero(t, testing.AllocsPerRun(100, func() {
+		_ = i.AtomBytes(b)
+	}))
+}
+
+func TestInterner_Atoms(t *testing.T) {
+	i := NewInterner("interner_person", "interner_name")
+	assert.Equal(t, []Atom{NewAtom("interner_person"), NewAtom("interner_name"), Atom('x')}, i.Atoms("interner_person", "interner_name", "x"))
+}
+
+func BenchmarkInterner_AtomBytes(b *testing.B) {
+	i := NewInterner("benchmark_interner")
+	name := []byte("benchmark_interner")
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		_ = i.AtomBytes(name)
+	}
+}
@@ -142,6 +142,13 @@ func TestAltIterator_Next(t *testing.T) {
 		assert.Equal(t, seq(atomSemiColon, atomThen.Apply(NewAtom("a"), NewAtom("b")), NewAtom("c")), iter.Current())
 		assert.False(t, iter.Next())
 	})
+
+	t.Run("soft-cut", func(t *testing.T) {
+		iter := altIterator{Alt: seq(atomSemiColon, atomSoftCut.Apply(NewAtom("a"), NewAtom("b")), NewAtom("c"))}
+		assert.True(t, iter.Next())
+		assert.Equal(t, seq(atomSemiColon, atomSoftCut.Apply(NewAtom("a"), NewAtom("b")), NewAtom("c")), iter.Current())
+		assert.False(t, iter.Next())
+	})
 }
 
 func TestAnyIterator_Next(t *testing.T) {
@@ -17,11 +17,19 @@ type Lexer struct {
 
 	buf    bytes.Buffer
 	offset int
+
+	maxNumberLength int // See ReadLimits.
+	maxQuotedLength int // See ReadLimits.
+
+	limit     int    // The maximum length of the current token. 0 means no limit.
+	limitName string // What limit means e.g. "number length".
+	length    int    // The number of runes accepted for the current token.
 }
 
 // Token returns the next token.
 func (l *Lexer) Token() (Token, error) {
 	l.offset = l.buf.Len()
+	l.limit, l.length = 0, 0
 	return l.layoutTextSequence(false)
 }
 
@@ -34,6 +42,9 @@ func (l *Lexer) next() (rune, error) {
 }
 
 func (l *Lexer) rawNext() (rune, error) {
+	if l.limit > 0 && l.length > l.limit {
+		return 0, limitError{name: l.limitName, max: l.limit}
+	}
 	r, _, err := l.input.ReadRune()
 	return r, err
 }
@@ -51,6 +62,7 @@ func (l *Lexer) backup() {
 
 func (l *Lexer) accept(r rune) {
 	_, _ = l.buf.WriteRune(r)
+	l.length++
 }
 
 func (l *Lexer) chunk() string {
@@ -194,14 +206,17 @@ func (l *Lexer) token(afterLayout bool) (Token, error) {
 		l.accept(r)
 		return l.graphicToken()
 	case r == '\'':
+		l.limit, l.limitName = l.maxQuotedLength, "quoted length"
 		l.accept(r)
 		return l.quotedToken()
 	case r == '_', isCapitalLetterChar(r):
 		l.accept(r)
 		return l.variableToken()
 	case isDecimalDigitChar(r):
+		l.limit, l.limitName = l.maxNumberLength, "number length"
 		return l.integerToken(r)
 	case r == '"':
+		l.limit, l.limitName = l.maxQuotedLength, "quoted length"
 		l.accept(r)
 		return l.doubleQuotedListToken()
 	case r == '(':
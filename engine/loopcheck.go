@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unsafe"
+)
+
+// While current_prolog_flag(loop_check, error), a call to a user-defined procedure raises loop_error(Cycle) if more
+// than VM.LoopThreshold variants of the goal are already being executed i.e. on the call stack. Since the goal can't
+// learn anything new from the variant which called it, it's most likely an accidental infinite recursion e.g. a
+// left-recursive rule or a path search in a cyclic graph. Cycle is the list of the goals from the nearest variant to
+// the goal. It's for development since it costs a variant check against the call stack for every call.
+
+// varAncestors is a special variable bound to the innermost goal being executed while loops are checked.
+var varAncestors = NewVariable()
+
+// ancestor is a goal on the call stack.
+type ancestor struct {
+	goal   Term
+	env    *Env // The environment of the goal when it's called.
+	key    string
+	parent *ancestor
+}
+
+// WriteTerm outputs the ancestor to an io.Writer.
+func (a *ancestor) WriteTerm(w io.Writer, _ *WriteOptions, _ *Env) error {
+	_, err := fmt.Fprintf(w, "<ancestor>(%p)", a)
+	return err
+}
+
+// Compare compares the ancestor with a Term.
+func (a *ancestor) Compare(t Term, env *Env) int {
+	return CompareAtomic[*ancestor](a, t, func(a *ancestor, b *ancestor) int {
+		switch x, y := uintptr(unsafe.Pointer(a)), uintptr(unsafe.Pointer(b)); {
+		case x > y:
+			return 1
+		case x < y:
+			return -1
+		default:
+			return 0
+		}
+	}, env)
+}
+
+func modifyLoopCheck(vm *VM, value Atom) error {
+	switch value {
+	case atomOff:
+		vm.loopCheck = false
+	case atomError:
+		vm.loopCheck = true
+	default:
+		return domainError(validDomainFlagValue, atomPlus.Apply(atomLoopCheck, value), nil)
+	}
+	return nil
+}
+
+func loopCheckFlag(b bool) Atom {
+	if b {
+		return atomError
+	}
+	return atomOff
+}
+
+// checkLoop raises loop_error(Cycle) if the goal recurs on the call stack while loops are checked.
+// The returned continuation restores the call stack of the caller once the goal exits.
+func (vm *VM) checkLoop(pi procedureIndicator, p procedure, args []Term, k Cont, env *Env) (Cont, *Env, error) {
+	if !vm.loopCheck {
+		return k, env, nil
+	}
+	if _, ok := p.(*userDefined); !ok {
+		return k, env, nil
+	}
+
+	goal := pi.name.Apply(args...)
+	key, _, ok := variantKey(goal, env)
+	if !ok {
+		return k, env, nil
+	}
+
+	var parent *ancestor
+	if t, ok := env.lookup(varAncestors); ok {
+		parent, _ = t.(*ancestor)
+	}
+	var (
+		n       int
+		nearest *ancestor
+	)
+	for a := parent; a != nil; a = a.parent {
+		if a.key != key {
+			continue
+		}
+		if nearest == nil {
+			nearest = a
+		}
+		n++
+	}
+	if n > vm.LoopThreshold {
+		var cycle []Term
+		for a := parent; a != nearest.parent; a = a.parent {
+			c, err := renamedCopy(a.goal, nil, a.env)
+			if err != nil {
+				return nil, nil, err
+			}
+			cycle = append(cycle, c)
+		}
+		for i, j := 0, len(cycle)-1; i < j; i, j = i+1, j-1 {
+			cycle[i], cycle[j] = cycle[j], cycle[i]
+		}
+		c, err := renamedCopy(goal, nil, env)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, loopError(append(cycle, c), env)
+	}
+
+	return func(env *Env) *Promise {
+		return k(env.bind(varAncestors, parent))
+	}, env.bind(varAncestors, &ancestor{goal: goal, env: env, key: key, parent: parent}), nil
+}
+
+func loopError(cycle []Term, env *Env) Exception {
+	return NewException(atomError.Apply(atomLoopError.Apply(List(cycle...)), varContext), env)
+}
+
+// loopErrorMessage translates the cycle of loop_error(Cycle) into a human-readable message.
+func loopErrorMessage(cycle Term, w func(Term) string, env *Env) string {
+	var goals []string
+	iter := ListIterator{List: cycle, Env: env}
+	for iter.Next() {
+		goals = append(goals, w(iter.Current()))
+	}
+	return "Infinite loop: " + strings.Join(goals, " -> ")
+}
@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVM_checkLoop(t *testing.T) {
+	var vm VM
+	vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+	vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+	vm.operators.define(700, operatorSpecifierXFX, atomIs)
+	vm.operators.define(500, operatorSpecifierYFX, atomMinus)
+	vm.operators.define(500, operatorSpecifierYFX, atomPlus)
+	vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+	vm.Register2(atomIs, Is)
+	assert.NoError(t, vm.Compile(context.Background(), `
+p(X) :- q(X).
+q(X) :- p(X).
+
+nat(0).
+nat(N) :- nat(M), N is M + 1.
+
+count(0) :- !.
+count(N) :- N1 is N - 1, count(N1).
+`))
+	assert.NoError(t, modifyLoopCheck(&vm, atomError))
+	p, q, nat := NewAtom("p"), NewAtom("q"), NewAtom("nat")
+	a := NewAtom("a")
+
+	t.Run("mutual recursion", func(t *testing.T) {
+		_, err := Call(&vm, p.Apply(a), Success, nil).Force(context.Background())
+		assert.Equal(t, Exception{term: atomError.Apply(atomLoopError.Apply(List(p.Apply(a), q.Apply(a), p.Apply(a))), atomSlash.Apply(p, Integer(1)))}, err)
+		assert.Equal(t, []string{"p/1: Infinite loop: p(a) -> q(a) -> p(a)"}, messageLines(&vm, err.(Exception).Term(), nil))
+	})
+
+	t.Run("left recursion", func(t *testing.T) {
+		_, err := Call(&vm, nat.Apply(NewVariable()), func(*Env) *Promise {
+			return Bool(false) // ask for more solutions
+		}, nil).Force(context.Background())
+		e, ok := err.(Exception)
+		assert.True(t, ok)
+		cycle := e.Term().(Compound).Arg(0).(Compound).Arg(0)
+		ts, err := slice(cycle, nil)
+		assert.NoError(t, err)
+		assert.Len(t, ts, 2)
+		assert.True(t, variant(ts[0], ts[1], nil))
+	})
+
+	t.Run("threshold", func(t *testing.T) {
+		vm.LoopThreshold = 2
+		defer func() {
+			vm.LoopThreshold = 0
+		}()
+		_, err := Call(&vm, p.Apply(a), Success, nil).Force(context.Background())
+		assert.Equal(t, Exception{term: atomError.Apply(atomLoopError.Apply(List(p.Apply(a), q.Apply(a), p.Apply(a))), atomSlash.Apply(p, Integer(1)))}, err)
+	})
+
+	t.Run("no loops", func(t *testing.T) {
+		ok, err := Call(&vm, NewAtom("count").Apply(Integer(10)), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		// The goals which have exited are off the call stack.
+		ok, err = Call(&vm, atomComma.Apply(NewAtom("count").Apply(Integer(1)), NewAtom("count").Apply(Integer(1))), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("off", func(t *testing.T) {
+		assert.NoError(t, modifyLoopCheck(&vm, atomOff))
+		defer func() {
+			assert.NoError(t, modifyLoopCheck(&vm, atomError))
+		}()
+		k, env, err := vm.checkLoop(procedureIndicator{name: p, arity: 1}, vm.procedures[procedureIndicator{name: p, arity: 1}], []Term{a}, Success, nil)
+		assert.NoError(t, err)
+		assert.NotNil(t, k)
+		assert.Nil(t, env)
+	})
+
+	t.Run("unknown value", func(t *testing.T) {
+		assert.Equal(t, domainError(validDomainFlagValue, atomPlus.Apply(atomLoopCheck, NewAtom("foo")), nil), modifyLoopCheck(&vm, NewAtom("foo")))
+	})
+}
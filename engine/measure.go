@@ -0,0 +1,149 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// varDepth is a special variable bound to the number of the procedures being executed while a goal is measured.
+var varDepth = NewVariable()
+
+// Ceilings limit the resources a goal run by VM.Measure consumes. A zero field means no limit.
+// Exceeding one of them raises resource_error(R) where R is terms, trail, call_depth, or time.
+type Ceilings struct {
+	// Terms is the maximum number of terms the clauses build. See Measurement.Terms.
+	Terms int64
+
+	// Trail is the maximum number of variables bound at once. See Measurement.Trail.
+	Trail int
+
+	// Depth is the maximum nesting of procedure calls. See Measurement.Depth.
+	Depth int
+
+	// Time is the maximum duration of the execution.
+	Time time.Duration
+}
+
+// Measurement is the resources a goal run by VM.Measure consumed.
+type Measurement struct {
+	// Terms is the number of compound terms and variables the clauses built. It's an estimate based on the bytecode
+	// of the clauses executed including the ones which failed to unify.
+	Terms int64
+
+	// Trail is the peak number of variables bound at once. Bindings are undone on backtracking.
+	Trail int
+
+	// Depth is the peak nesting of procedure calls which haven't exited yet, including tail calls.
+	Depth int
+
+	// Inferences is the number of predicate calls.
+	Inferences int64
+
+	// Time is the duration of the execution.
+	Time time.Duration
+}
+
+type measurement struct {
+	mu       sync.Mutex // Parallel goals are measured concurrently.
+	ceilings Ceilings
+	Measurement
+}
+
+// Measure calls goal for the first solution under the ceilings and returns the resources it consumed even if it failed
+// or raised an exception. It's meant for tests asserting that rules stay within budgets on large inputs.
+// While it's measuring, the VM must not run other queries concurrently.
+func (vm *VM) Measure(ctx context.Context, goal Term, env *Env, c Ceilings) (Measurement, bool, error) {
+	m := measurement{ceilings: c}
+	vm.measurement = &m
+	defer func() {
+		vm.measurement = nil
+	}()
+
+	parent := ctx
+	if c.Time > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Time)
+		defer cancel()
+	}
+	start := vm.now()
+	ok, err := Call(vm, goal, Success, env).Force(ctx)
+	m.Time = vm.now().Sub(start)
+	if errors.Is(err, context.DeadlineExceeded) && parent.Err() == nil {
+		err = resourceError(resourceTime, env)
+	}
+	return m.Measurement, ok, err
+}
+
+// measure accounts for the call of a procedure while a goal is measured.
+// The returned continuation restores the depth of the caller once the procedure exits.
+func (vm *VM) measure(k Cont, env *Env) (Cont, *Env, error) {
+	m := vm.measurement
+	if m == nil {
+		return k, env, nil
+	}
+
+	var parent Integer
+	if t, ok := env.lookup(varDepth); ok {
+		parent, _ = t.(Integer)
+	}
+	env = env.bind(varDepth, parent+1)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Inferences++
+	if d := int(parent + 1); d > m.Depth {
+		m.Depth = d
+	}
+	if t := env.bindings(); t > m.Trail {
+		m.Trail = t
+	}
+	if c := m.ceilings.Depth; c > 0 && m.Depth > c {
+		return nil, nil, resourceError(resourceCallDepth, env)
+	}
+	if c := m.ceilings.Trail; c > 0 && m.Trail > c {
+		return nil, nil, resourceError(resourceTrail, env)
+	}
+	return func(env *Env) *Promise {
+		return k(env.bind(varDepth, parent))
+	}, env, nil
+}
+
+// allocTerms accounts for the terms the clause builds while a goal is measured.
+func (vm *VM) allocTerms(c *clause, env *Env) error {
+	m := vm.measurement
+	if m == nil {
+		return nil
+	}
+
+	n := int64(len(c.vars))
+	for _, op := range c.bytecode {
+		switch op.opcode {
+		case opGetFunctor, opPutFunctor, opGetPacked, opPutPacked:
+			n++
+		case opGetList, opPutList, opGetPartial, opPutPartial:
+			n += int64(op.operand.(Integer))
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Terms += n
+	if c := m.ceilings.Terms; c > 0 && m.Terms > c {
+		return resourceError(resourceTerms, env)
+	}
+	return nil
+}
+
+// bindings returns the number of the variables bound in e.
+func (e *Env) bindings() int {
+	if e == nil {
+		return 0
+	}
+	s := e.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.reroot()
+	return len(s.bindings)
+}
@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVM_Measure(t *testing.T) {
+	var vm VM
+	vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+	vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+	vm.operators.define(700, operatorSpecifierXFX, atomIs)
+	vm.operators.define(500, operatorSpecifierYFX, atomMinus)
+	vm.Register2(atomIs, Is)
+	assert.NoError(t, vm.Compile(context.Background(), `
+count(0) :- !.
+count(N) :- N1 is N - 1, count(N1).
+
+list(0, []) :- !.
+list(N, [N|Xs]) :- N1 is N - 1, list(N1, Xs).
+
+loop :- loop.
+`))
+	count := func(n int) Term {
+		return NewAtom("count").Apply(Integer(n))
+	}
+	list := func(n int) Term {
+		return NewAtom("list").Apply(Integer(n), NewVariable())
+	}
+	exceeded := func(r resource, name string, arity int) error {
+		return Exception{term: atomError.Apply(atomResourceError.Apply(r.Term()), atomSlash.Apply(NewAtom(name), Integer(arity)))}
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		m, ok, err := vm.Measure(context.Background(), count(10), nil, Ceilings{})
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, int64(11), m.Inferences)
+		assert.Equal(t, 11, m.Depth)
+		assert.Greater(t, m.Trail, 0)
+		assert.Greater(t, m.Terms, int64(0))
+		assert.Greater(t, m.Time, time.Duration(0))
+
+		// The usage grows with the input.
+		n, ok, err := vm.Measure(context.Background(), count(20), nil, Ceilings{})
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, int64(21), n.Inferences)
+		assert.Equal(t, 21, n.Depth)
+		assert.Greater(t, n.Terms, m.Terms)
+
+		// Building a list takes more terms than counting and binds the variables for the elements.
+		l, ok, err := vm.Measure(context.Background(), list(10), nil, Ceilings{})
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Greater(t, l.Terms, m.Terms)
+		assert.Greater(t, l.Trail, m.Trail)
+		assert.Greater(t, l.Trail, 10)
+
+		// It's not measuring anymore.
+		assert.Nil(t, vm.measurement)
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		m, ok, err := vm.Measure(context.Background(), NewAtom("list").Apply(Integer(3), List()), nil, Ceilings{})
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, int64(1), m.Inferences)
+	})
+
+	t.Run("terms", func(t *testing.T) {
+		m, _, err := vm.Measure(context.Background(), count(100), nil, Ceilings{Terms: 10})
+		assert.Equal(t, exceeded(resourceTerms, "count", 1), err)
+		assert.Greater(t, m.Terms, int64(10))
+	})
+
+	t.Run("trail", func(t *testing.T) {
+		m, _, err := vm.Measure(context.Background(), list(100), nil, Ceilings{Trail: 10})
+		assert.Equal(t, exceeded(resourceTrail, "list", 2), err)
+		assert.Greater(t, m.Trail, 10)
+	})
+
+	t.Run("depth", func(t *testing.T) {
+		m, _, err := vm.Measure(context.Background(), count(100), nil, Ceilings{Depth: 10})
+		assert.Equal(t, exceeded(resourceCallDepth, "count", 1), err)
+		assert.Equal(t, 11, m.Depth)
+	})
+
+	t.Run("time", func(t *testing.T) {
+		m, _, err := vm.Measure(context.Background(), NewAtom("loop"), nil, Ceilings{Time: 10 * time.Millisecond})
+		assert.Equal(t, resourceError(resourceTime, nil), err)
+		assert.GreaterOrEqual(t, m.Time, 10*time.Millisecond)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, _, err := vm.Measure(ctx, NewAtom("loop"), nil, Ceilings{Time: time.Minute})
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+}
@@ -0,0 +1,205 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Severity is the kind of a message.
+type Severity uint8
+
+// Severities of messages.
+const (
+	SeverityInformational Severity = iota
+	SeverityWarning
+	SeverityError
+	SeveritySilent
+)
+
+var severityAtoms = [...]Atom{
+	SeverityInformational: atomInformational,
+	SeverityWarning:       atomWarning,
+	SeverityError:         atomError,
+	SeveritySilent:        atomSilent,
+}
+
+// String returns the name of the severity e.g. "warning".
+func (s Severity) String() string {
+	return severityAtoms[s].String()
+}
+
+func severityOf(kind Term, env *Env) (Severity, error) {
+	switch k := env.Resolve(kind).(type) {
+	case Variable:
+		return 0, InstantiationError(env)
+	case Atom:
+		for s, a := range severityAtoms {
+			if a == k {
+				return Severity(s), nil
+			}
+		}
+		return 0, domainError(validDomainMessageKind, k, env)
+	default:
+		return 0, typeError(validTypeAtom, k, env)
+	}
+}
+
+var severityPrefixes = [...]string{
+	SeverityInformational: "% ",
+	SeverityWarning:       "Warning: ",
+	SeverityError:         "ERROR: ",
+}
+
+// PrintMessage reports term as a message of kind which is one of informational, warning, error, or silent.
+// If the user-defined message_hook(Term, Kind, Lines) succeeds, that's it. Otherwise, the message is passed to
+// VM.OnMessage if it's set, or written to the user output with the prefix of kind unless kind is silent.
+func PrintMessage(vm *VM, kind, term Term, k Cont, env *Env) *Promise {
+	s, err := severityOf(kind, env)
+	if err != nil {
+		return Error(err)
+	}
+	t := env.simplify(term)
+	lines := messageLines(vm, t, nil)
+	return Delay(func(ctx context.Context) *Promise {
+		if err := vm.printMessage(ctx, s, t, lines); err != nil {
+			return Error(err)
+		}
+		return k(env)
+	})
+}
+
+// MessageToCodes unifies codes with the text of term as a message of kind. The lines are separated by newlines.
+func MessageToCodes(vm *VM, term, kind, codes Term, k Cont, env *Env) *Promise {
+	if _, err := severityOf(kind, env); err != nil {
+		return Error(err)
+	}
+	lines := messageLines(vm, term, env)
+	return Unify(vm, codes, CodeList(strings.Join(lines, "\n")), k, env)
+}
+
+// message delivers the message originated in the VM e.g. a failed directive to VM.OnMessage and message_hook/3.
+// Unlike print_message/2, it doesn't write to the user output since the caller reports it in another way too.
+func (vm *VM) message(ctx context.Context, s Severity, term Term) {
+	lines := messageLines(vm, term, nil)
+	if vm.messageHook(ctx, s, term, lines) || vm.OnMessage == nil {
+		return
+	}
+	vm.OnMessage(s, term, lines)
+}
+
+func (vm *VM) printMessage(ctx context.Context, s Severity, term Term, lines []string) error {
+	if vm.messageHook(ctx, s, term, lines) {
+		return nil
+	}
+	if vm.OnMessage != nil {
+		vm.OnMessage(s, term, lines)
+		return nil
+	}
+	if s == SeveritySilent || vm.output == nil {
+		return nil
+	}
+	w, err := vm.output.textWriter()
+	if err != nil {
+		return err
+	}
+	for _, l := range lines {
+		if _, err := fmt.Fprintf(w, "%s%s\n", severityPrefixes[s], l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// messageHook calls the user-defined message_hook/3 if any and tells if it succeeded.
+func (vm *VM) messageHook(ctx context.Context, s Severity, term Term, lines []string) bool {
+	pi := procedureIndicator{name: atomMessageHook, arity: 3}
+	if _, ok := vm.procedures[pi].(*userDefined); !ok {
+		return false
+	}
+	ls := make([]Term, len(lines))
+	for i, l := range lines {
+		ls[i] = NewAtom(l)
+	}
+	ok, _ := vm.Arrive(atomMessageHook, []Term{term, severityAtoms[s], List(ls...)}, Success, nil).Force(ctx)
+	return ok
+}
+
+// messageLines translates term into human-readable lines.
+func messageLines(vm *VM, term Term, env *Env) []string {
+	w := func(t Term) string {
+		var sb strings.Builder
+		_ = env.Resolve(t).WriteTerm(&sb, &WriteOptions{quoted: true, ops: vm.operators, priority: 1200}, env)
+		return sb.String()
+	}
+
+	switch t := env.Resolve(term).(type) {
+	case Atom:
+		return strings.Split(t.String(), "\n")
+	case String:
+		return strings.Split(string(t), "\n")
+	case Compound:
+		switch {
+		case t.Functor() == atomError && t.Arity() == 2:
+			if f, ok := env.Resolve(t.Arg(0)).(Compound); ok && f.Functor() == atomSchemaError && f.Arity() == 1 {
+				return schemaErrorLines(f.Arg(0), w, env)
+			}
+			msg := errorMessage(t.Arg(0), w, env)
+			if c, ok := env.Resolve(t.Arg(1)).(Compound); ok && c.Functor() == atomSlash && c.Arity() == 2 {
+				msg = w(c) + ": " + msg
+			}
+			return []string{msg}
+		case t.Functor() == atomFloundering && t.Arity() == 3:
+			return flounderingLines(vm, t.Arg(0), t.Arg(1), t.Arg(2), env)
+		case t.Functor() == atomFallbackSubstitution && t.Arity() == 3:
+			return fallbackSubstitutionLines(t.Arg(0), t.Arg(1), t.Arg(2), w)
+		case t.Functor() == atomGoalFailed && t.Arity() == 2:
+			return []string{fmt.Sprintf("Goal (%s) failed: %s", w(t.Arg(0)), w(t.Arg(1)))}
+		case t.Functor() == atomStreamLine && t.Arity() == 3:
+			if line, err := textOf(t.Arg(2), env); err == nil {
+				return []string{fmt.Sprintf("%s %s: %s", w(t.Arg(0)), w(t.Arg(1)), line)}
+			}
+		}
+		if s, err := textOf(t, env); err == nil {
+			return strings.Split(s, "\n")
+		}
+	}
+	return []string{"Unknown message: " + w(term)}
+}
+
+func errorMessage(formal Term, w func(Term) string, env *Env) string {
+	switch f := env.Resolve(formal).(type) {
+	case Atom:
+		if f == atomInstantiationError {
+			return "Arguments are not sufficiently instantiated"
+		}
+	case Compound:
+		arg := func(i int) string {
+			return w(f.Arg(i))
+		}
+		switch {
+		case f.Functor() == atomTypeError && f.Arity() == 2:
+			return fmt.Sprintf("Type error: `%s' expected, found `%s'", arg(0), arg(1))
+		case f.Functor() == atomDomainError && f.Arity() == 2:
+			return fmt.Sprintf("Domain error: `%s' expected, found `%s'", arg(0), arg(1))
+		case f.Functor() == atomExistenceError && f.Arity() == 2:
+			if env.Resolve(f.Arg(0)) == atomProcedure {
+				return fmt.Sprintf("Unknown procedure: %s", arg(1))
+			}
+			return fmt.Sprintf("%s `%s' does not exist", arg(0), arg(1))
+		case f.Functor() == atomPermissionError && f.Arity() == 3:
+			return fmt.Sprintf("No permission to %s %s `%s'", arg(0), arg(1), arg(2))
+		case f.Functor() == atomRepresentationError && f.Arity() == 1:
+			return fmt.Sprintf("Cannot represent due to `%s'", arg(0))
+		case f.Functor() == atomEvaluationError && f.Arity() == 1:
+			return fmt.Sprintf("Arithmetic: evaluation error: `%s'", arg(0))
+		case f.Functor() == atomResourceError && f.Arity() == 1:
+			return fmt.Sprintf("Not enough resources: %s", arg(0))
+		case f.Functor() == atomSyntaxError && f.Arity() == 1:
+			return fmt.Sprintf("Syntax error: %s", arg(0))
+		case f.Functor() == atomLoopError && f.Arity() == 1:
+			return loopErrorMessage(f.Arg(0), w, env)
+		}
+	}
+	return "Unknown error term: " + w(formal)
+}
@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintMessage(t *testing.T) {
+	type message struct {
+		severity Severity
+		term     Term
+		lines    []string
+	}
+
+	t.Run("OnMessage", func(t *testing.T) {
+		var ms []message
+		vm := VM{OnMessage: func(severity Severity, term Term, lines []string) {
+			ms = append(ms, message{severity: severity, term: term, lines: lines})
+		}}
+		vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+
+		x := NewVariable()
+		env := NewEnv().bind(x, NewAtom("foo"))
+		ok, err := PrintMessage(&vm, atomWarning, atomError.Apply(atomTypeError.Apply(atomInteger, x), atomSlash.Apply(NewAtom("bar"), Integer(1))), Success, env).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = PrintMessage(&vm, atomSilent, NewAtom("line 1\nline 2"), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		assert.Equal(t, []message{
+			{severity: SeverityWarning, term: atomError.Apply(atomTypeError.Apply(atomInteger, NewAtom("foo")), atomSlash.Apply(NewAtom("bar"), Integer(1))), lines: []string{"bar/1: Type error: `integer' expected, found `foo'"}},
+			{severity: SeveritySilent, term: NewAtom("line 1\nline 2"), lines: []string{"line 1", "line 2"}},
+		}, ms)
+	})
+
+	t.Run("user output", func(t *testing.T) {
+		var buf bytes.Buffer
+		var vm VM
+		vm.SetUserOutput(NewOutputTextStream(&buf))
+		for _, kind := range []Atom{atomInformational, atomWarning, atomError, atomSilent} {
+			ok, err := PrintMessage(&vm, kind, NewAtom("hello"), Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		}
+		assert.Equal(t, "% hello\nWarning: hello\nERROR: hello\n", buf.String())
+	})
+
+	t.Run("message_hook", func(t *testing.T) {
+		var ms []message
+		vm := VM{OnMessage: func(severity Severity, term Term, lines []string) {
+			ms = append(ms, message{severity: severity, term: term, lines: lines})
+		}}
+		vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+		vm.operators.define(700, operatorSpecifierXFX, atomEqual)
+		vm.Register2(atomEqual, Unify)
+		assert.NoError(t, vm.Compile(context.Background(), `
+message_hook(hooked, warning, Lines) :- Lines = ['hooked'].
+`))
+
+		for _, m := range []Term{NewAtom("hooked"), NewAtom("not_hooked")} {
+			ok, err := PrintMessage(&vm, atomWarning, m, Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		}
+		assert.Equal(t, []message{
+			{severity: SeverityWarning, term: NewAtom("not_hooked"), lines: []string{"not_hooked"}},
+		}, ms)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		var vm VM
+		_, err := PrintMessage(&vm, NewVariable(), NewAtom("foo"), Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(nil), err)
+		_, err = PrintMessage(&vm, Integer(1), NewAtom("foo"), Success, nil).Force(context.Background())
+		assert.Equal(t, typeError(validTypeAtom, Integer(1), nil), err)
+		_, err = PrintMessage(&vm, NewAtom("loud"), NewAtom("foo"), Success, nil).Force(context.Background())
+		assert.Equal(t, domainError(validDomainMessageKind, NewAtom("loud"), nil), err)
+	})
+
+	t.Run("originated in the VM", func(t *testing.T) {
+		var ms []message
+		vm := VM{OnMessage: func(severity Severity, term Term, lines []string) {
+			ms = append(ms, message{severity: severity, term: term, lines: lines})
+		}}
+		vm.operators.define(1200, operatorSpecifierFX, atomIf)
+		vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+		vm.Register0(atomFail, func(*VM, Cont, *Env) *Promise {
+			return Bool(false)
+		})
+		vm.unknown = unknownWarning
+
+		assert.Equal(t, errors.New("failed directive: fail"), vm.Compile(context.Background(), `:- fail.`))
+		_, err := vm.Arrive(NewAtom("foo"), nil, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+
+		assert.Equal(t, []message{
+			{severity: SeverityError, term: atomGoalFailed.Apply(atomDirective, atomFail), lines: []string{"Goal (directive) failed: fail"}},
+			{severity: SeverityWarning, term: atomError.Apply(atomExistenceError.Apply(atomProcedure, atomSlash.Apply(NewAtom("foo"), Integer(0))), atomSlash.Apply(NewAtom("foo"), Integer(0))), lines: []string{"foo/0: Unknown procedure: foo/0"}},
+		}, ms)
+	})
+}
+
+func TestMessageToCodes(t *testing.T) {
+	var vm VM
+	vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+
+	tests := []struct {
+		title string
+		term  Term
+		text  string
+	}{
+		{title: "text", term: CharList("foo\nbar"), text: "foo\nbar"},
+		{title: "instantiation error", term: atomError.Apply(atomInstantiationError, NewVariable()), text: "Arguments are not sufficiently instantiated"},
+		{title: "domain error", term: atomError.Apply(atomDomainError.Apply(atomOrder, NewAtom("<")), NewVariable()), text: "Domain error: `order' expected, found `<'"},
+		{title: "existence error", term: atomError.Apply(atomExistenceError.Apply(atomSourceSink, NewAtom("foo.pl")), NewVariable()), text: "source_sink `'foo.pl'' does not exist"},
+		{title: "permission error", term: atomError.Apply(atomPermissionError.Apply(atomModify, atomStaticProcedure, NewAtom("foo")), NewVariable()), text: "No permission to modify static_procedure `foo'"},
+		{title: "representation error", term: atomError.Apply(atomRepresentationError.Apply(atomMaxInteger), NewVariable()), text: "Cannot represent due to `max_integer'"},
+		{title: "evaluation error", term: atomError.Apply(atomEvaluationError.Apply(atomZeroDivisor), NewVariable()), text: "Arithmetic: evaluation error: `zero_divisor'"},
+		{title: "resource error", term: atomError.Apply(atomResourceError.Apply(atomMemory), NewVariable()), text: "Not enough resources: memory"},
+		{title: "syntax error", term: atomError.Apply(atomSyntaxError.Apply(NewAtom("oops")), NewVariable()), text: "Syntax error: oops"},
+		{title: "unknown error", term: atomError.Apply(NewAtom("oops"), NewVariable()), text: "Unknown error term: oops"},
+		{title: "goal failed", term: atomGoalFailed.Apply(atomInitialization, NewAtom("foo")), text: "Goal (initialization) failed: foo"},
+		{title: "unknown", term: NewAtom("foo").Apply(Integer(1)), text: "Unknown message: foo(1)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			ok, err := MessageToCodes(&vm, tt.term, atomError, CodeList(tt.text), Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		})
+	}
+}
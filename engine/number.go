@@ -11,7 +11,11 @@ var (
 )
 
 var constants = map[Atom]Number{
-	atomPi: Float(math.Pi),
+	atomPi:               Float(math.Pi),
+	atomSmallE:           Float(math.E),
+	atomEpsilon:          Float(math.Nextafter(1, 2) - 1),
+	atomMaxTaggedInteger: maxInt,
+	atomMinTaggedInteger: minInt,
 }
 
 var unaryFunctors = map[Atom]func(Number) (Number, error){
@@ -65,7 +69,7 @@ type Number interface {
 	number()
 }
 
-func eval(expression Term, env *Env) (_ Number, err error) {
+func (vm *VM) eval(expression Term, env *Env) (_ Number, err error) {
 	defer func() {
 		var ev exceptionalValue
 		if errors.As(err, &ev) {
@@ -78,6 +82,9 @@ func eval(expression Term, env *Env) (_ Number, err error) {
 		return nil, InstantiationError(env)
 	case Atom:
 		c, ok := constants[t]
+		if !ok && vm != nil {
+			c, ok = vm.constants[t]
+		}
 		if !ok {
 			return nil, typeError(validTypeEvaluable, atomSlash.Apply(t, Integer(0)), env)
 		}
@@ -91,7 +98,7 @@ func eval(expression Term, env *Env) (_ Number, err error) {
 			if !ok {
 				return nil, typeError(validTypeEvaluable, atomSlash.Apply(t.Functor(), Integer(1)), env)
 			}
-			x, err := eval(t.Arg(0), env)
+			x, err := vm.eval(t.Arg(0), env)
 			if err != nil {
 				return nil, err
 			}
@@ -101,11 +108,11 @@ func eval(expression Term, env *Env) (_ Number, err error) {
 			if !ok {
 				return nil, typeError(validTypeEvaluable, atomSlash.Apply(t.Functor(), Integer(2)), env)
 			}
-			x, err := eval(t.Arg(0), env)
+			x, err := vm.eval(t.Arg(0), env)
 			if err != nil {
 				return nil, err
 			}
-			y, err := eval(t.Arg(1), env)
+			y, err := vm.eval(t.Arg(1), env)
 			if err != nil {
 				return nil, err
 			}
@@ -118,9 +125,19 @@ func eval(expression Term, env *Env) (_ Number, err error) {
 	}
 }
 
+// RegisterConstant registers a named constant which evaluates to value in arithmetic e.g. is/2 and </2 so that
+// configuration values can be used in expressions like `Limit is max_retries * 2`. The standard constants e.g. pi and
+// e take precedence over the registered ones of the same names.
+func (vm *VM) RegisterConstant(name Atom, value Number) {
+	if vm.constants == nil {
+		vm.constants = map[Atom]Number{}
+	}
+	vm.constants[name] = value
+}
+
 // Is evaluates expression and unifies the result with result.
 func Is(vm *VM, result, expression Term, k Cont, env *Env) *Promise {
-	v, err := eval(expression, env)
+	v, err := vm.eval(expression, env)
 	if err != nil {
 		return Error(err)
 	}
@@ -128,13 +145,13 @@ func Is(vm *VM, result, expression Term, k Cont, env *Env) *Promise {
 }
 
 // Equal succeeds iff e1 equals to e2.
-func Equal(_ *VM, e1, e2 Term, k Cont, env *Env) *Promise {
-	ev1, err := eval(e1, env)
+func Equal(vm *VM, e1, e2 Term, k Cont, env *Env) *Promise {
+	ev1, err := vm.eval(e1, env)
 	if err != nil {
 		return Error(err)
 	}
 
-	ev2, err := eval(e2, env)
+	ev2, err := vm.eval(e2, env)
 	if err != nil {
 		return Error(err)
 	}
@@ -163,13 +180,13 @@ func Equal(_ *VM, e1, e2 Term, k Cont, env *Env) *Promise {
 }
 
 // NotEqual succeeds iff e1 doesn't equal to e2.
-func NotEqual(_ *VM, e1, e2 Term, k Cont, env *Env) *Promise {
-	ev1, err := eval(e1, env)
+func NotEqual(vm *VM, e1, e2 Term, k Cont, env *Env) *Promise {
+	ev1, err := vm.eval(e1, env)
 	if err != nil {
 		return Error(err)
 	}
 
-	ev2, err := eval(e2, env)
+	ev2, err := vm.eval(e2, env)
 	if err != nil {
 		return Error(err)
 	}
@@ -198,13 +215,13 @@ func NotEqual(_ *VM, e1, e2 Term, k Cont, env *Env) *Promise {
 }
 
 // LessThan succeeds iff e1 is less than e2.
-func LessThan(_ *VM, e1, e2 Term, k Cont, env *Env) *Promise {
-	ev1, err := eval(e1, env)
+func LessThan(vm *VM, e1, e2 Term, k Cont, env *Env) *Promise {
+	ev1, err := vm.eval(e1, env)
 	if err != nil {
 		return Error(err)
 	}
 
-	ev2, err := eval(e2, env)
+	ev2, err := vm.eval(e2, env)
 	if err != nil {
 		return Error(err)
 	}
@@ -233,13 +250,13 @@ func LessThan(_ *VM, e1, e2 Term, k Cont, env *Env) *Promise {
 }
 
 // GreaterThan succeeds iff e1 is greater than e2.
-func GreaterThan(_ *VM, e1, e2 Term, k Cont, env *Env) *Promise {
-	ev1, err := eval(e1, env)
+func GreaterThan(vm *VM, e1, e2 Term, k Cont, env *Env) *Promise {
+	ev1, err := vm.eval(e1, env)
 	if err != nil {
 		return Error(err)
 	}
 
-	ev2, err := eval(e2, env)
+	ev2, err := vm.eval(e2, env)
 	if err != nil {
 		return Error(err)
 	}
@@ -268,13 +285,13 @@ func GreaterThan(_ *VM, e1, e2 Term, k Cont, env *Env) *Promise {
 }
 
 // LessThanOrEqual succeeds iff e1 is less than or equal to e2.
-func LessThanOrEqual(_ *VM, e1, e2 Term, k Cont, env *Env) *Promise {
-	ev1, err := eval(e1, env)
+func LessThanOrEqual(vm *VM, e1, e2 Term, k Cont, env *Env) *Promise {
+	ev1, err := vm.eval(e1, env)
 	if err != nil {
 		return Error(err)
 	}
 
-	ev2, err := eval(e2, env)
+	ev2, err := vm.eval(e2, env)
 	if err != nil {
 		return Error(err)
 	}
@@ -303,13 +320,13 @@ func LessThanOrEqual(_ *VM, e1, e2 Term, k Cont, env *Env) *Promise {
 }
 
 // GreaterThanOrEqual succeeds iff e1 is greater than or equal to e2.
-func GreaterThanOrEqual(_ *VM, e1, e2 Term, k Cont, env *Env) *Promise {
-	ev1, err := eval(e1, env)
+func GreaterThanOrEqual(vm *VM, e1, e2 Term, k Cont, env *Env) *Promise {
+	ev1, err := vm.eval(e1, env)
 	if err != nil {
 		return Error(err)
 	}
 
-	ev2, err := eval(e2, env)
+	ev2, err := vm.eval(e2, env)
 	if err != nil {
 		return Error(err)
 	}
@@ -23,6 +23,11 @@ func TestIs(t *testing.T) {
 		{title: "float", result: Float(1), expression: Float(1), ok: true},
 
 		{title: "pi", result: Float(math.Pi), expression: atomPi, ok: true},
+		{title: "e", result: Float(math.E), expression: atomSmallE, ok: true},
+		{title: "epsilon", result: Float(2.220446049250313e-16), expression: atomEpsilon, ok: true},
+		{title: "max_tagged_integer", result: Integer(math.MaxInt64), expression: atomMaxTaggedInteger, ok: true},
+		{title: "min_tagged_integer", result: Integer(math.MinInt64), expression: atomMinTaggedInteger, ok: true},
+		{title: "unknown constant", expression: foo, err: typeError(validTypeEvaluable, atomSlash.Apply(foo, Integer(0)), nil)},
 
 		{title: "1 + 1", result: Integer(2), expression: atomPlus.Apply(Integer(1), Integer(1)), ok: true},
 		{title: "maxInt + 1", expression: atomPlus.Apply(Integer(math.MaxInt64), Integer(1)), err: evaluationError(exceptionalValueIntOverflow, nil)},
@@ -289,6 +294,39 @@ func TestIs(t *testing.T) {
 	}
 }
 
+func TestVM_RegisterConstant(t *testing.T) {
+	var vm VM
+	maxRetries := NewAtom("max_retries")
+	vm.RegisterConstant(maxRetries, Integer(3))
+	vm.RegisterConstant(atomPi, Integer(3))
+
+	t.Run("is", func(t *testing.T) {
+		ok, err := Is(&vm, Integer(6), atomAsterisk.Apply(maxRetries, Integer(2)), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("comparison", func(t *testing.T) {
+		ok, err := LessThan(&vm, Integer(2), maxRetries, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("standard constants take precedence", func(t *testing.T) {
+		ok, err := Is(&vm, Float(math.Pi), atomPi, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("fork", func(t *testing.T) {
+		f := vm.Fork()
+		f.RegisterConstant(maxRetries, Integer(5))
+		ok, err := Is(&vm, Integer(3), maxRetries, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+}
+
 func TestEqual(t *testing.T) {
 	var vm VM
 	t.Run("integer", func(t *testing.T) {
@@ -0,0 +1,212 @@
+package engine
+
+import (
+	"context"
+)
+
+// parallel runs the goals at the beginning of pc concurrently if they're pure and independent of each other.
+// The goals must be plain predicate calls i.e. not control constructs nor cuts.
+// Each goal searches for its solutions on its own goroutine while their solutions are consumed lazily in the order of
+// the sequential execution. A later goal's solutions, failure, or error take effect only after the preceding goals
+// produced solutions. So the result is the same as the sequential one.
+// It returns false if there are less than 2 such goals so that the caller proceeds sequentially.
+func (vm *VM) parallel(pc bytecode, vars []Term, cont Cont, env *Env, cutParent *Promise) (*Promise, bool) {
+	// Collect the leading plain goals first since the purity analysis is relatively expensive.
+	var (
+		segments []bytecode
+		start    int
+	)
+scan:
+	for i, op := range pc {
+		switch op.opcode {
+		case opPutConst, opPutVar, opPutFunctor, opPop, opPutList, opPutPartial, opPutPacked:
+			continue
+		case opCall:
+			segments = append(segments, pc[start:i+1:i+1])
+			start = i + 1
+		default:
+			break scan
+		}
+	}
+	if len(segments) < 2 {
+		return nil, false
+	}
+
+	var goals []*parallelGoal
+	start = 0
+	for _, s := range segments {
+		g := parallelGoal{code: s}
+		if !g.eligible(vm, goals, vars, env) {
+			break
+		}
+		goals = append(goals, &g)
+		start += len(s)
+	}
+	if len(goals) < 2 {
+		return nil, false
+	}
+	rest := pc[start:]
+
+	return Delay(func(ctx context.Context) *Promise {
+		ctx, cancel := context.WithCancel(ctx)
+		for _, g := range goals {
+			g.start(ctx, vm, vars, env)
+		}
+
+		// The goals are cancelled once the conjunction is exhausted, cut, or unwound by an error.
+		return withCleanup(func(context.Context, bool) {
+			cancel()
+		}, func(frame *Promise) *Promise {
+			return joinParallelGoals(vm, goals, func(env *Env) *Promise {
+				return exited(frame, func(context.Context) *Promise {
+					return vm.exec(rest, vars, cont, nil, nil, env, cutParent)
+				})
+			}, env)
+		})
+	}), true
+}
+
+type parallelGoal struct {
+	code bytecode
+	vars []Term // The unbound variables in the arguments.
+
+	next      chan parallelSolution // Closed when the goal is exhausted.
+	solutions [][]Term              // The values of vars for each solution received so far.
+	err       error                 // The error which terminated the goal. Valid after next is closed.
+	rest      int64                 // The inferences after the last solution. Valid after next is closed.
+}
+
+type parallelSolution struct {
+	vals       []Term
+	inferences int64 // The inferences since the previous solution.
+}
+
+// eligible tells if the goal is pure, has finite solutions unless it recurses infinitely, and shares no unbound
+// variables with the preceding goals.
+func (g *parallelGoal) eligible(vm *VM, preceding []*parallelGoal, vars []Term, env *Env) bool {
+	pi := g.code[len(g.code)-1].operand.(procedureIndicator)
+	if !vm.pure(pi, true) {
+		return false
+	}
+
+	for _, op := range g.code {
+		if op.opcode != opPutVar {
+			continue
+		}
+		vs, err := termVariables(variable(vars, op.operand.(Integer)), env)
+		if err != nil {
+			return false
+		}
+		g.vars = append(g.vars, vs...)
+	}
+
+	for _, p := range preceding {
+		for _, v := range p.vars {
+			for _, w := range g.vars {
+				if v == w {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// start runs the goal on a goroutine. It searches for the next solution while the current one is waiting to be
+// consumed so that it doesn't run far ahead of the consumer e.g. in case of infinite solutions.
+func (g *parallelGoal) start(ctx context.Context, vm *VM, vars []Term, env *Env) {
+	// The goal doesn't modify the database since it's pure. So a shallow copy of vm suffices.
+	f := *vm
+	f.Parallel = false // Don't run goals in parallel recursively.
+
+	g.next = make(chan parallelSolution, 1)
+	code := append(g.code, instruction{opcode: opExit})
+	vars = append([]Term(nil), vars...) // The rest of the clause may assign its first-occurrence variables.
+	env = env.detach()                  // The rest of the clause may rewind the store of env.
+	go func() {
+		defer close(g.next)
+		reported := f.usage.Inferences
+		_, g.err = f.exec(code, vars, func(env *Env) *Promise {
+			s := parallelSolution{vals: make([]Term, len(g.vars)), inferences: f.usage.Inferences - reported}
+			for i, v := range g.vars {
+				s.vals[i] = env.simplify(v)
+			}
+			reported = f.usage.Inferences
+			select {
+			case g.next <- s:
+				return Bool(false) // ask for more solutions
+			case <-ctx.Done():
+				return Error(ctx.Err())
+			}
+		}, nil, nil, env, nil).Force(ctx)
+		g.rest = f.usage.Inferences - reported
+	}()
+}
+
+// solution returns the i-th solution of the goal. It waits for the goal if it's not found yet.
+// It returns false if the goal has less solutions.
+func (g *parallelGoal) solution(ctx context.Context, vm *VM, i int, env *Env) ([]Term, bool, error) {
+	for len(g.solutions) <= i {
+		if g.next == nil {
+			return nil, false, g.err
+		}
+		var (
+			s  parallelSolution
+			ok bool
+		)
+		select {
+		case s, ok = <-g.next:
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+		if !ok {
+			g.next = nil
+			s.inferences = g.rest
+		}
+		vm.usage.Inferences += s.inferences
+		if q := vm.Quota.Inferences; q > 0 && vm.usage.Inferences > q {
+			return nil, false, resourceError(resourceInferences, env)
+		}
+		if !ok {
+			return nil, false, g.err
+		}
+		g.solutions = append(g.solutions, s.vals)
+	}
+	return g.solutions[i], true, nil
+}
+
+// joinParallelGoals enumerates the combinations of the solutions as if the goals ran sequentially.
+func joinParallelGoals(vm *VM, goals []*parallelGoal, k Cont, env *Env) *Promise {
+	if len(goals) == 0 {
+		return k(env)
+	}
+	return goals[0].alternatives(vm, 0, func(env *Env) *Promise {
+		return joinParallelGoals(vm, goals[1:], k, env)
+	}, env)
+}
+
+// alternatives continues on k with the i-th solution and the following ones on backtracking.
+func (g *parallelGoal) alternatives(vm *VM, i int, k Cont, env *Env) *Promise {
+	return Delay(func(ctx context.Context) *Promise {
+		vals, ok, err := g.solution(ctx, vm, i, env)
+		if err != nil {
+			return Error(err)
+		}
+		if !ok {
+			return Bool(false)
+		}
+		return Delay(func(context.Context) *Promise {
+			env := env
+			for i, v := range g.vars {
+				var ok bool
+				env, ok = env.Unify(v, vals[i])
+				if !ok {
+					return Bool(false)
+				}
+			}
+			return k(env)
+		}, func(context.Context) *Promise {
+			return g.alternatives(vm, i+1, k, env)
+		})
+	})
+}
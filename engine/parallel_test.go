@@ -0,0 +1,256 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVM_Parallel(t *testing.T) {
+	newVM := func(t *testing.T) *VM {
+		var vm VM
+		vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+		vm.operators.define(1200, operatorSpecifierFX, atomIf)
+		vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+		vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+		vm.operators.define(700, operatorSpecifierXFX, atomEqual)
+		vm.Register2(atomEqual, Unify)
+		vm.DeclarePure(atomEqual, 2)
+		vm.Register1(NewAtom("throw"), Throw)
+		vm.DeclarePure(NewAtom("throw"), 1)
+		vm.Register0(NewAtom("repeat"), Repeat)
+		vm.DeclarePure(NewAtom("repeat"), 0)
+
+		// rendezvous/1 succeeds only if the two calls meet each other, which never happens sequentially.
+		meet := make(chan struct{})
+		vm.Register1(NewAtom("rendezvous"), func(_ *VM, role Term, k Cont, env *Env) *Promise {
+			var ok bool
+			switch env.Resolve(role) {
+			case NewAtom("left"):
+				select {
+				case meet <- struct{}{}:
+					ok = true
+				case <-time.After(100 * time.Millisecond):
+				}
+			default:
+				select {
+				case <-meet:
+					ok = true
+				case <-time.After(100 * time.Millisecond):
+				}
+			}
+			if !ok {
+				return Bool(false)
+			}
+			return k(env)
+		})
+		vm.DeclarePure(NewAtom("rendezvous"), 1)
+		vm.Register1(NewAtom("impure_rendezvous"), func(vm *VM, role Term, k Cont, env *Env) *Promise {
+			return vm.Arrive(NewAtom("rendezvous"), []Term{role}, k, env)
+		})
+
+		assert.NoError(t, vm.Compile(context.Background(), `
+:- dynamic(d/1).
+p(1).
+p(2).
+q(a).
+q(b).
+q(c).
+d(x).
+both(X, Y) :- p(X), q(Y).
+shared(X) :- p(X), p(X).
+concurrent :- rendezvous(left), rendezvous(right).
+impure :- impure_rendezvous(left), rendezvous(right).
+state(X, Y) :- d(X), q(Y).
+fail_goal(X) :- X = a, X = b.
+throw_goal(X) :- throw(X).
+fail_throw :- fail_goal(_), throw_goal(oops).
+throw_fail :- throw_goal(oops), fail_goal(_).
+generator(X) :- repeat, X = a.
+nat(0).
+nat(s(X)) :- nat(X).
+nats(X, Y) :- nat(X), nat(Y).
+`))
+		vm.Parallel = true
+		return &vm
+	}
+
+	solutions := func(t *testing.T, vm *VM, name string, arity int) [][]Term {
+		args := make([]Term, arity)
+		for i := range args {
+			args[i] = NewVariable()
+		}
+		var sols [][]Term
+		ok, err := vm.Arrive(NewAtom(name), args, func(env *Env) *Promise {
+			sol := make([]Term, len(args))
+			for i, a := range args {
+				sol[i] = env.Resolve(a)
+			}
+			sols = append(sols, sol)
+			return Bool(false)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		return sols
+	}
+
+	t.Run("sequential order", func(t *testing.T) {
+		vm := newVM(t)
+		vm.Quota.Inferences = 1000
+		assert.Equal(t, [][]Term{
+			{Integer(1), NewAtom("a")},
+			{Integer(1), NewAtom("b")},
+			{Integer(1), NewAtom("c")},
+			{Integer(2), NewAtom("a")},
+			{Integer(2), NewAtom("b")},
+			{Integer(2), NewAtom("c")},
+		}, solutions(t, vm, "both", 2))
+		assert.Greater(t, vm.Usage().Inferences, int64(0))
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		assert.Len(t, solutions(t, newVM(t), "concurrent", 0), 1)
+	})
+
+	t.Run("shared variables", func(t *testing.T) {
+		assert.Equal(t, [][]Term{{Integer(1)}, {Integer(2)}}, solutions(t, newVM(t), "shared", 1))
+	})
+
+	t.Run("impure", func(t *testing.T) {
+		assert.Empty(t, solutions(t, newVM(t), "impure", 0))
+	})
+
+	t.Run("dynamic", func(t *testing.T) {
+		assert.Len(t, solutions(t, newVM(t), "state", 2), 3)
+	})
+
+	t.Run("failure before error", func(t *testing.T) {
+		assert.Empty(t, solutions(t, newVM(t), "fail_throw", 0))
+	})
+
+	t.Run("error before failure", func(t *testing.T) {
+		vm := newVM(t)
+		_, err := vm.Arrive(NewAtom("throw_fail"), nil, Success, nil).Force(context.Background())
+		assert.Equal(t, NewException(NewAtom("oops"), nil), err)
+	})
+
+	t.Run("infinite generators", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		vm := newVM(t)
+		assert.False(t, vm.pure(procedureIndicator{name: NewAtom("generator"), arity: 1}, true))
+
+		x, y := NewVariable(), NewVariable()
+		var sols [][]Term
+		ok, err := vm.Arrive(NewAtom("nats"), []Term{x, y}, func(env *Env) *Promise {
+			sols = append(sols, []Term{env.Resolve(x), env.Resolve(y)})
+			return Bool(len(sols) == 3)
+		}, nil).Force(ctx)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		zero := Integer(0)
+		s := NewAtom("s")
+		assert.Equal(t, [][]Term{
+			{zero, zero},
+			{zero, s.Apply(zero)},
+			{zero, s.Apply(s.Apply(zero))},
+		}, sols)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		vm := newVM(t)
+		vm.Parallel = false
+		assert.Empty(t, solutions(t, vm, "concurrent", 0))
+	})
+}
+
+func TestVM_pure_cached(t *testing.T) {
+	var vm VM
+	vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+	vm.operators.define(1200, operatorSpecifierFX, atomIf)
+	vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+	assert.NoError(t, vm.Compile(context.Background(), `
+:- dynamic(d/1).
+p :- q.
+q.
+`))
+	pi := procedureIndicator{name: NewAtom("p"), arity: 0}
+	assert.True(t, vm.pure(pi, false))
+	assert.Contains(t, vm.purity.result, purityKey{pi: pi})
+
+	// Any change to the database invalidates the cache.
+	ok, err := Assertz(&vm, NewAtom("d").Apply(NewAtom("a")), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Empty(t, vm.purity.result)
+
+	assert.True(t, vm.pure(pi, false))
+	ok, err = Retract(&vm, NewAtom("d").Apply(NewAtom("a")), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Empty(t, vm.purity.result)
+
+	assert.True(t, vm.pure(pi, false))
+	assert.NoError(t, vm.Compile(context.Background(), `
+q :- d(_).
+`))
+	assert.False(t, vm.pure(pi, false))
+}
+
+// BenchmarkVM_Parallel compares the sequential and parallel execution of 4 independent goals.
+// The CPU-bound goals speed up as many as the available cores. The latency-bound ones speed up even on a single core.
+func BenchmarkVM_Parallel(b *testing.B) {
+	newVM := func(parallel bool) *VM {
+		var vm VM
+		vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+		vm.operators.define(1200, operatorSpecifierFX, atomIf)
+		vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+		vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+		vm.operators.define(700, operatorSpecifierXFX, atomIs)
+		vm.operators.define(700, operatorSpecifierXFX, atomLessThan)
+		vm.operators.define(500, operatorSpecifierYFX, atomPlus)
+		vm.operators.define(500, operatorSpecifierYFX, atomMinus)
+		vm.Register2(atomIs, Is)
+		vm.DeclarePure(atomIs, 2)
+		vm.Register2(atomLessThan, LessThan)
+		vm.DeclarePure(atomLessThan, 2)
+
+		// lookup/1 stands for a pure predicate waiting for an external resource e.g. a remote cache.
+		vm.Register1(NewAtom("lookup"), func(_ *VM, _ Term, k Cont, env *Env) *Promise {
+			time.Sleep(time.Millisecond)
+			return k(env)
+		})
+		vm.DeclarePure(NewAtom("lookup"), 1)
+
+		if err := vm.Compile(context.Background(), `
+fib(N, N) :- N < 2.
+fib(N, F) :- 1 < N, N1 is N - 1, N2 is N - 2, fib(N1, F1), fib(N2, F2), F is F1 + F2.
+cpu :- fib(15, _), fib(15, _), fib(15, _), fib(15, _).
+latency :- lookup(a), lookup(b), lookup(c), lookup(d).
+`); err != nil {
+			b.Fatal(err)
+		}
+		vm.Parallel = parallel
+		return &vm
+	}
+
+	for _, goal := range []string{"cpu", "latency"} {
+		for _, parallel := range []bool{false, true} {
+			name := goal + "/sequential"
+			if parallel {
+				name = goal + "/parallel"
+			}
+			b.Run(name, func(b *testing.B) {
+				vm := newVM(parallel)
+				for i := 0; i < b.N; i++ {
+					if _, err := vm.Arrive(NewAtom(goal), nil, Success, nil).Force(context.Background()); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
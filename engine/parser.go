@@ -24,19 +24,43 @@ type Parser struct {
 	operators    operators
 	doubleQuotes doubleQuotes
 
+	// Vars are the named variables of the last term read by Term in the order of appearance.
+	// Anonymous variables are not included.
 	Vars []ParsedVariable
 
 	placeholder Atom
 	args        []Term
 
+	atomScope *AtomScope
+
+	limits ReadLimits
+	depth  int   // The nesting of the term being read.
+	err    error // The limit exceeded. Once it's set, the parser doesn't read any further.
+
 	buf tokenRingBuffer
 }
 
+// ReadLimits bounds the terms read by a parser. Zero means no limit. Exceeding one of them is a syntax error.
+type ReadLimits struct {
+	// MaxDepth is the maximum nesting of terms including the parenthesized ones e.g. f(g(a)) is 3 deep.
+	MaxDepth int
+
+	// MaxArity is the maximum number of arguments of a compound term in functional notation.
+	MaxArity int
+
+	// MaxNumberLength is the maximum number of characters of a number literal.
+	MaxNumberLength int
+
+	// MaxQuotedLength is the maximum number of characters of a quoted atom or a double-quoted list including the
+	// quotes and the escape sequences as they're written.
+	MaxQuotedLength int
+}
+
 // ParsedVariable is a set of information regarding a variable in a parsed term.
 type ParsedVariable struct {
-	Name     Atom
+	Name     Atom // The name as spelled in the source.
 	Variable Variable
-	Count    int
+	Count    int // The number of occurrences. 1 means it's a singleton.
 }
 
 // NewParser creates a new parser from the current VM and io.RuneReader.
@@ -46,11 +70,26 @@ func NewParser(vm *VM, r io.RuneReader) *Parser {
 	}
 	return &Parser{
 		lexer: Lexer{
-			input: newRuneRingBuffer(r),
+			input:           newRuneRingBuffer(r),
+			maxNumberLength: vm.ReadLimits.MaxNumberLength,
+			maxQuotedLength: vm.ReadLimits.MaxQuotedLength,
 		},
 		operators:    vm.operators,
 		doubleQuotes: vm.doubleQuotes,
+		limits:       vm.ReadLimits,
+	}
+}
+
+// SetAtomScope makes the parser intern atoms in the scope.
+func (p *Parser) SetAtomScope(s *AtomScope) {
+	p.atomScope = s
+}
+
+func (p *Parser) newAtom(name string) Atom {
+	if p.atomScope != nil {
+		return p.atomScope.NewAtom(name)
 	}
+	return NewAtom(name)
 }
 
 // SetPlaceholder registers placeholder and its arguments. Every occurrence of placeholder will be replaced by arguments.
@@ -79,7 +118,9 @@ func (p *Parser) termOf(o reflect.Value) (Term, error) {
 		case doubleQuotesCodes:
 			return CodeList(o.String()), nil
 		case doubleQuotesAtom:
-			return NewAtom(o.String()), nil
+			return p.newAtom(o.String()), nil
+		case doubleQuotesString:
+			return String(o.String()), nil
 		default:
 			return CharList(o.String()), nil
 		}
@@ -100,9 +141,15 @@ func (p *Parser) termOf(o reflect.Value) (Term, error) {
 }
 
 func (p *Parser) next() (Token, error) {
+	if p.err != nil {
+		return Token{}, p.err
+	}
 	if p.buf.empty() {
 		t, err := p.lexer.Token()
 		if err != nil {
+			if _, ok := err.(limitError); ok {
+				p.err = err
+			}
 			return Token{}, err
 		}
 		p.buf.put(t)
@@ -120,7 +167,18 @@ func (p *Parser) current() Token {
 
 // Term parses a term followed by a full stop.
 func (p *Parser) Term() (Term, error) {
+	p.Vars = nil
+	p.depth, p.err = 0, nil
+
 	t, err := p.term(1201)
+	if p.err != nil {
+		return nil, p.err
+	}
+	// Operators of yfx and yf make the term deeper without the recursion of the parser.
+	if max := p.limits.MaxDepth; err == nil && max > 0 && termDepth(t) > max {
+		p.err = limitError{name: "term depth", max: max}
+		return nil, p.err
+	}
 	switch err {
 	case nil:
 		break
@@ -334,18 +392,32 @@ const (
 	doubleQuotesChars doubleQuotes = iota
 	doubleQuotesCodes
 	doubleQuotesAtom
+	doubleQuotesString
 )
 
 func (d doubleQuotes) String() string {
 	return [...]string{
-		doubleQuotesCodes: "codes",
-		doubleQuotesChars: "chars",
-		doubleQuotesAtom:  "atom",
+		doubleQuotesCodes:  "codes",
+		doubleQuotesChars:  "chars",
+		doubleQuotesAtom:   "atom",
+		doubleQuotesString: "string",
 	}[d]
 }
 
 // Loosely based on Pratt parser explained in this article: https://matklad.github.io/2020/04/13/simple-but-powerful-pratt-parsing.html
 func (p *Parser) term(maxPriority Integer) (Term, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	if max := p.limits.MaxDepth; max > 0 && p.depth >= max {
+		p.err = limitError{name: "term depth", max: max}
+		return nil, p.err
+	}
+	p.depth++
+	defer func() {
+		p.depth--
+	}()
+
 	var lhs Term
 	switch op, err := p.prefix(maxPriority); err {
 	case nil:
@@ -477,10 +549,10 @@ func (p *Parser) op(maxPriority Integer) (Atom, error) {
 	switch t.kind {
 	case tokenComma:
 		if maxPriority >= 1000 {
-			return NewAtom(t.val), nil
+			return p.newAtom(t.val), nil
 		}
 	case tokenBar:
-		return NewAtom(t.val), nil
+		return p.newAtom(t.val), nil
 	}
 
 	p.backup()
@@ -523,6 +595,8 @@ func (p *Parser) term0(maxPriority Integer) (Term, error) {
 			return CharList(unDoubleQuote(t.val)), nil
 		case doubleQuotesCodes:
 			return CodeList(unDoubleQuote(t.val)), nil
+		case doubleQuotesString:
+			return String(unDoubleQuote(t.val)), nil
 		default:
 			p.backup()
 			break
@@ -580,7 +654,7 @@ func (p *Parser) variable(s string) (Term, error) {
 	if s == "_" {
 		return NewVariable(), nil
 	}
-	n := NewAtom(s)
+	n := p.newAtom(s)
 	for i, pv := range p.Vars {
 		if pv.Name == n {
 			p.Vars[i].Count++
@@ -643,7 +717,7 @@ func (p *Parser) atom() (Atom, error) {
 	case tokenDoubleQuotedList:
 		switch p.doubleQuotes {
 		case doubleQuotesAtom:
-			return NewAtom(unDoubleQuote(t.val)), nil
+			return p.newAtom(unDoubleQuote(t.val)), nil
 		default:
 			p.backup()
 			return 0, errExpectation
@@ -661,9 +735,9 @@ func (p *Parser) name() (Atom, error) {
 	}
 	switch t.kind {
 	case tokenLetterDigit, tokenGraphic, tokenSemicolon, tokenCut:
-		return NewAtom(t.val), nil
+		return p.newAtom(t.val), nil
 	case tokenQuoted:
-		return NewAtom(unquote(t.val)), nil
+		return p.newAtom(unquote(t.val)), nil
 	default:
 		p.backup()
 		return 0, errExpectation
@@ -734,6 +808,10 @@ func (p *Parser) functionalNotation(functor Atom) (Term, error) {
 		for {
 			switch t, _ := p.next(); t.kind {
 			case tokenComma:
+				if max := p.limits.MaxArity; max > 0 && len(args) >= max {
+					p.err = limitError{name: "arity", max: max}
+					return nil, p.err
+				}
 				arg, err := p.arg()
 				if err != nil {
 					return nil, err
@@ -950,3 +1028,48 @@ type unexpectedTokenError struct {
 func (e unexpectedTokenError) Error() string {
 	return fmt.Sprintf("unexpected token: %s", e.actual)
 }
+
+// termDepth returns the nesting of t where the elements of a list are one level deeper than the list.
+func termDepth(t Term) int {
+	type node struct {
+		term  Term
+		depth int
+	}
+	var (
+		max   int
+		stack = []node{{term: t, depth: 1}}
+	)
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if n.depth > max {
+			max = n.depth
+		}
+		c, ok := n.term.(Compound)
+		if !ok {
+			continue
+		}
+		if c.Functor() == atomDot && c.Arity() == 2 {
+			iter := ListIterator{List: c}
+			for iter.Next() {
+				stack = append(stack, node{term: iter.Current(), depth: n.depth + 1})
+			}
+			stack = append(stack, node{term: iter.Suffix(), depth: n.depth + 1})
+			continue
+		}
+		for i := 0; i < c.Arity(); i++ {
+			stack = append(stack, node{term: c.Arg(i), depth: n.depth + 1})
+		}
+	}
+	return max
+}
+
+// limitError means the input exceeds one of ReadLimits.
+type limitError struct {
+	name string
+	max  int
+}
+
+func (e limitError) Error() string {
+	return fmt.Sprintf("%s exceeds %d", e.name, e.max)
+}
@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"context"
 	"errors"
 	"io"
 	"strings"
@@ -136,6 +137,7 @@ func TestParser_Term(t *testing.T) {
 		{input: `"abc".`, doubleQuotes: doubleQuotesChars, term: charList("abc")},
 		{input: `"abc".`, doubleQuotes: doubleQuotesCodes, term: codeList("abc")},
 		{input: `"abc".`, doubleQuotes: doubleQuotesAtom, term: NewAtom("abc")},
+		{input: `"abc".`, doubleQuotes: doubleQuotesString, term: String("abc")},
 		{input: `"don""t panic".`, doubleQuotes: doubleQuotesAtom, term: NewAtom("don\"t panic")},
 		{input: "\"this is \\\na double-quoted string\".", doubleQuotes: doubleQuotesAtom, term: NewAtom("this is a double-quoted string")},
 		{input: `"\a".`, doubleQuotes: doubleQuotesAtom, term: NewAtom("\a")},
@@ -212,6 +214,13 @@ func TestParser_Replace(t *testing.T) {
 			args:         []interface{}{1.0, 2, "foo", []string{"a", "b", "c"}},
 			term:         List(Float(1.0), Integer(2), NewAtom("foo"), List(NewAtom("a"), NewAtom("b"), NewAtom("c"))),
 		},
+		{
+			title:        "string",
+			doubleQuotes: doubleQuotesString,
+			input:        `[?, ?, ?, ?].`,
+			args:         []interface{}{1.0, 2, "foo", []string{"a", "b", "c"}},
+			term:         List(Float(1.0), Integer(2), String("foo"), List(String("a"), String("b"), String("c"))),
+		},
 		{
 			title: "invalid argument",
 			input: `[?].`,
@@ -322,3 +331,118 @@ func TestParser_More(t *testing.T) {
 	assert.Equal(t, NewAtom("bar"), term)
 	assert.False(t, p.More())
 }
+
+func TestParser_Vars(t *testing.T) {
+	p := Parser{
+		lexer: Lexer{
+			input: newRuneRingBuffer(strings.NewReader(`f(Foo, _, Foo, Bar). g(Foo).`)),
+		},
+	}
+	term, err := p.Term()
+	assert.NoError(t, err)
+	c := term.(Compound)
+	assert.Equal(t, []ParsedVariable{
+		{Name: NewAtom("Foo"), Variable: c.Arg(0).(Variable), Count: 2},
+		{Name: NewAtom("Bar"), Variable: c.Arg(3).(Variable), Count: 1},
+	}, p.Vars)
+
+	// Vars are of the last term.
+	term, err = p.Term()
+	assert.NoError(t, err)
+	c = term.(Compound)
+	assert.Equal(t, []ParsedVariable{
+		{Name: NewAtom("Foo"), Variable: c.Arg(0).(Variable), Count: 1},
+	}, p.Vars)
+}
+
+func TestParser_ReadLimits(t *testing.T) {
+	limits := ReadLimits{MaxDepth: 4, MaxArity: 3, MaxNumberLength: 5, MaxQuotedLength: 6}
+	tests := []struct {
+		input string
+		ok    bool
+		err   error
+	}{
+		{input: `f(g(h(a))).`, ok: true},
+		{input: `f(g(h(i(a)))).`, err: limitError{name: "term depth", max: 4}},
+		{input: `((((a)))).`, err: limitError{name: "term depth", max: 4}},
+		{input: `[[[[a]]]].`, err: limitError{name: "term depth", max: 4}},
+		{input: `- - - - a.`, err: limitError{name: "term depth", max: 4}},
+		{input: `1 + 2 + 3 + 4.`, ok: true},
+		{input: `1 + 2 + 3 + 4 + 5.`, err: limitError{name: "term depth", max: 4}},
+		{input: `[a, b, c, d, e, f].`, ok: true},
+		{input: `f(a, b, c).`, ok: true},
+		{input: `f(a, b, c, d).`, err: limitError{name: "arity", max: 3}},
+		{input: `12345.`, ok: true},
+		{input: `123456.`, err: limitError{name: "number length", max: 5}},
+		{input: `1.2345.`, err: limitError{name: "number length", max: 5}},
+		{input: `0x12345.`, err: limitError{name: "number length", max: 5}},
+		{input: `'abcd'.`, ok: true},
+		{input: `'abcde'.`, err: limitError{name: "quoted length", max: 6}},
+		{input: `'\n\n\n'.`, err: limitError{name: "quoted length", max: 6}},
+		{input: `"abcde".`, err: limitError{name: "quoted length", max: 6}},
+		{input: `abcdefghijklmn.`, ok: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			p := NewParser(&VM{ReadLimits: limits}, strings.NewReader(tc.input))
+			p.operators.define(500, operatorSpecifierYFX, atomPlus)
+			p.operators.define(200, operatorSpecifierFY, atomMinus)
+			term, err := p.Term()
+			assert.Equal(t, tc.err, err)
+			assert.Equal(t, tc.ok, term != nil)
+		})
+	}
+
+	t.Run("next term", func(t *testing.T) {
+		p := NewParser(&VM{ReadLimits: limits}, strings.NewReader(`f(g(h(i(a)))). foo.`))
+		_, err := p.Term()
+		assert.Equal(t, limitError{name: "term depth", max: 4}, err)
+		_, err = p.Term()
+		assert.Error(t, err) // The rest of the term is left.
+	})
+
+	t.Run("read_term", func(t *testing.T) {
+		var vm VM
+		vm.ReadLimits = limits
+		s := NewInputTextStream(strings.NewReader(`f(a, b, c, d).`))
+		ok, err := ReadTerm(&vm, s, NewVariable(), List(), Success, nil).Force(context.Background())
+		assert.Equal(t, syntaxError(limitError{name: "arity", max: 3}, nil), err)
+		assert.False(t, ok)
+	})
+}
+
+func FuzzParser_Term(f *testing.F) {
+	for _, s := range []string{
+		`foo(X, [a, b|T], "abc", 'q\n', 0'a, 0x1F, 1.5e10, {x}).`,
+		`a :- b, (c -> d ; e), \+ f.`,
+		`[[[[[[[[a]]]]]]]].`,
+		`- - - - - - 1.`,
+		`1 + 2 + 3 + 4 + 5 + 6 + 7 + 8 + 9.`,
+		`f(a, b, c, d, e, f, g).`,
+		`12345678901234567890.`,
+		`'aaaaaaaaaaaaaaaaaaaaaaaaaa'.`,
+	} {
+		f.Add(s)
+	}
+
+	limits := ReadLimits{MaxDepth: 8, MaxArity: 4, MaxNumberLength: 16, MaxQuotedLength: 16}
+	f.Fuzz(func(t *testing.T, input string) {
+		vm := VM{ReadLimits: limits}
+		vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+		vm.operators.define(1100, operatorSpecifierXFY, atomSemiColon)
+		vm.operators.define(1050, operatorSpecifierXFY, atomThen)
+		vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+		vm.operators.define(900, operatorSpecifierFY, atomNegation)
+		vm.operators.define(500, operatorSpecifierYFX, atomPlus)
+		vm.operators.define(200, operatorSpecifierFY, atomMinus)
+		p := NewParser(&vm, strings.NewReader(input))
+		for i := 0; i < 8; i++ {
+			term, err := p.Term()
+			if err != nil {
+				return
+			}
+			assert.LessOrEqual(t, termDepth(term), limits.MaxDepth)
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package engine
+
+import "sort"
+
+// Procedure is a user-defined procedure with its properties and clauses.
+type Procedure struct {
+	// Indicator is the predicate indicator of the procedure e.g. foo/1.
+	Indicator Term
+
+	Dynamic       bool
+	Multifile     bool
+	Discontiguous bool
+	Public        bool
+
+	// Schema is the argument of fact_schema/1 directive for the procedure. It's nil if there's no such directive.
+	Schema Term
+
+	// Clauses are the clauses of the procedure in the order of the database.
+	Clauses []Provenance
+}
+
+// Clauses returns the user-defined procedure of name/arity with its clauses as they were compiled.
+// Unlike clause/2, it returns the clauses of private procedures as well. ok is false if there's no such procedure.
+func (vm *VM) Clauses(name Atom, arity int) (p Procedure, ok bool) {
+	pi := procedureIndicator{name: name, arity: Integer(arity)}
+	u, ok := vm.procedures[pi].(*userDefined)
+	if !ok {
+		return Procedure{}, false
+	}
+	return u.export(pi), true
+}
+
+// AllClauses returns every user-defined procedure with its clauses sorted by the predicate indicators.
+// Foreign predicates are excluded.
+func (vm *VM) AllClauses() []Procedure {
+	pis := vm.userDefinedIndicators(func(*userDefined) bool { return true })
+	ps := make([]Procedure, len(pis))
+	for i, pi := range pis {
+		ps[i] = vm.procedures[pi].(*userDefined).export(pi)
+	}
+	return ps
+}
+
+// userDefinedIndicators returns the indicators of the user-defined procedures which satisfy f sorted by name and arity.
+func (vm *VM) userDefinedIndicators(f func(*userDefined) bool) []procedureIndicator {
+	var pis []procedureIndicator
+	for pi, p := range vm.procedures {
+		if u, ok := p.(*userDefined); ok && f(u) {
+			pis = append(pis, pi)
+		}
+	}
+	sort.Slice(pis, func(i, j int) bool {
+		if x, y := pis[i].name.String(), pis[j].name.String(); x != y {
+			return x < y
+		}
+		return pis[i].arity < pis[j].arity
+	})
+	return pis
+}
+
+func (u *userDefined) export(pi procedureIndicator) Procedure {
+	p := Procedure{
+		Indicator:     pi.Term(),
+		Dynamic:       u.dynamic,
+		Multifile:     u.multifile,
+		Discontiguous: u.discontiguous,
+		Public:        u.public,
+		Clauses:       make([]Provenance, len(u.clauses)),
+	}
+	if u.schema != nil {
+		p.Schema = pi.name.Apply(u.schema...)
+	}
+	for i, c := range u.clauses {
+		p.Clauses[i] = Provenance{Indicator: p.Indicator, Clause: c.raw, Metadata: c.metadata}
+	}
+	return p
+}
@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVM_Clauses(t *testing.T) {
+	var vm VM
+	vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+	vm.operators.define(1200, operatorSpecifierFX, atomIf)
+	vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+	vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+	vm.Register1(NewAtom("write"), func(_ *VM, _ Term, k Cont, env *Env) *Promise {
+		return k(env)
+	})
+	assert.NoError(t, vm.Compile(context.Background(), `
+:- dynamic(user/2).
+:- fact_schema(user(atom, integer)).
+user(alice, 30).
+:- clause_metadata(source(test)).
+greet(X) :- user(X, _), write(X).
+`))
+
+	t.Run("dynamic", func(t *testing.T) {
+		p, ok := vm.Clauses(NewAtom("user"), 2)
+		assert.True(t, ok)
+		assert.Equal(t, atomSlash.Apply(NewAtom("user"), Integer(2)), p.Indicator)
+		assert.True(t, p.Dynamic)
+		assert.False(t, p.Multifile)
+		assert.Equal(t, NewAtom("user").Apply(NewAtom("atom"), NewAtom("integer")), p.Schema)
+		assert.Equal(t, []Provenance{
+			{Indicator: p.Indicator, Clause: NewAtom("user").Apply(NewAtom("alice"), Integer(30))},
+		}, p.Clauses)
+	})
+
+	t.Run("static", func(t *testing.T) {
+		p, ok := vm.Clauses(NewAtom("greet"), 1)
+		assert.True(t, ok)
+		assert.False(t, p.Dynamic)
+		assert.Nil(t, p.Schema)
+		assert.Len(t, p.Clauses, 1)
+		c := p.Clauses[0]
+		assert.Equal(t, NewAtom("source").Apply(NewAtom("test")), c.Metadata)
+		r, ok := c.Clause.(Compound)
+		assert.True(t, ok)
+		assert.Equal(t, atomIf, r.Functor())
+	})
+
+	t.Run("foreign", func(t *testing.T) {
+		_, ok := vm.Clauses(NewAtom("write"), 1)
+		assert.False(t, ok)
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		_, ok := vm.Clauses(NewAtom("foo"), 0)
+		assert.False(t, ok)
+	})
+}
+
+func TestVM_AllClauses(t *testing.T) {
+	var vm VM
+	vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+	vm.operators.define(1200, operatorSpecifierFX, atomIf)
+	vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+	vm.Register0(NewAtom("halt"), func(_ *VM, k Cont, env *Env) *Promise {
+		return k(env)
+	})
+	assert.NoError(t, vm.Compile(context.Background(), `
+:- dynamic(empty/0).
+:- discontiguous(foo/1).
+foo(b).
+bar.
+foo(a, b).
+foo(a).
+`))
+
+	var pis []Term
+	for _, p := range vm.AllClauses() {
+		pis = append(pis, p.Indicator)
+	}
+	assert.Equal(t, []Term{
+		atomSlash.Apply(NewAtom("bar"), Integer(0)),
+		atomSlash.Apply(NewAtom("empty"), Integer(0)),
+		atomSlash.Apply(NewAtom("foo"), Integer(1)),
+		atomSlash.Apply(NewAtom("foo"), Integer(2)),
+	}, pis)
+
+	p := vm.AllClauses()[2]
+	assert.True(t, p.Discontiguous)
+	assert.Equal(t, []Provenance{
+		{Indicator: p.Indicator, Clause: NewAtom("foo").Apply(NewAtom("b"))},
+		{Indicator: p.Indicator, Clause: NewAtom("foo").Apply(NewAtom("a"))},
+	}, p.Clauses)
+}
@@ -23,6 +23,15 @@ type Promise struct {
 	cutParent *Promise
 	repeat    bool
 	recover   func(error) *Promise
+
+	// cleanup is called once the promise leaves the stack i.e. it's exhausted, cut, unwound by an error, or abandoned.
+	// failed tells if it's exhausted, which means the bindings made under the promise are undone.
+	cleanup func(ctx context.Context, failed bool)
+	// exit is a promise with cleanup whose goal succeeded. If the goal left no choice points, we call cleanup right away.
+	exit *Promise
+
+	// height is the position in the stack where the promise was pushed last time.
+	height int
 }
 
 // Delay delays an execution of k.
@@ -74,9 +83,29 @@ func catch(recover func(error) *Promise, k func(context.Context) *Promise) *Prom
 	}
 }
 
+// withCleanup returns a promise that calls cleanup once the execution of k is over.
+// It's either when k leaves no choice points after success, or when the promise leaves the stack.
+// k is given the promise so that it can mark its success with exited.
+func withCleanup(cleanup func(ctx context.Context, failed bool), k func(frame *Promise) *Promise) *Promise {
+	p := Promise{cleanup: cleanup}
+	p.delayed = []func(context.Context) *Promise{func(context.Context) *Promise {
+		return k(&p)
+	}}
+	return &p
+}
+
+// exited returns a promise that continues on k after the goal of the frame made by withCleanup succeeded.
+func exited(frame *Promise, k func(context.Context) *Promise) *Promise {
+	return &Promise{
+		delayed: []func(context.Context) *Promise{k},
+		exit:    frame,
+	}
+}
+
 // Force enforces the delayed execution and returns the result. (i.e. trampoline)
 func (p *Promise) Force(ctx context.Context) (ok bool, err error) {
 	stack := promiseStack{p}
+	defer stack.abandon(ctx)
 	for len(stack) > 0 {
 		select {
 		case <-ctx.Done():
@@ -87,31 +116,60 @@ func (p *Promise) Force(ctx context.Context) (ok bool, err error) {
 			if len(p.delayed) == 0 {
 				switch {
 				case p.err != nil:
-					if err := stack.recover(p.err); err != nil {
+					if err := stack.recover(ctx, p.err); err != nil {
 						return false, err
 					}
 					continue
 				case p.ok:
 					return true, nil
 				default:
+					p.runCleanup(ctx, true)
 					continue
 				}
 			}
 
 			// If cut, we eliminate other possibilities.
 			if p.cutParent != nil {
-				stack.popUntil(p.cutParent)
+				stack.popUntil(ctx, p.cutParent)
 				p.cutParent = nil // we don't have to do this again when we revisit.
 			}
 
+			// If the goal of a frame succeeded deterministically, we don't have to wait for backtracking.
+			if p.exit != nil {
+				if stack.deterministic(p.exit) {
+					p.exit.runCleanup(ctx, false)
+				}
+				p.exit = nil
+			}
+
 			// Try the child promises from left to right.
+			p.height = len(stack)
 			q := p.child(ctx)
-			stack = append(stack, p, q)
+			if p.alive() {
+				stack = append(stack, p)
+			}
+			stack = append(stack, q)
 		}
 	}
 	return false, nil
 }
 
+// alive reports whether the promise still has to stay in the stack after its child is taken.
+// Otherwise, we don't push it back so that deterministic execution doesn't grow the stack.
+func (p *Promise) alive() bool {
+	return len(p.delayed) > 0 || p.repeat || p.recover != nil || p.cleanup != nil
+}
+
+// runCleanup calls the cleanup if it's not called yet.
+func (p *Promise) runCleanup(ctx context.Context, failed bool) {
+	f := p.cleanup
+	if f == nil {
+		return
+	}
+	p.cleanup = nil
+	f(ctx, failed)
+}
+
 func (p *Promise) child(ctx context.Context) (promise *Promise) {
 	defer ensurePromise(&promise)
 	defer func() {
@@ -140,18 +198,42 @@ func (s *promiseStack) pop() *Promise {
 	return p
 }
 
-func (s *promiseStack) popUntil(p *Promise) {
-	for len(*s) > 0 {
-		if pop := s.pop(); pop == p {
-			break
+// popUntil pops the promise and the ones above it.
+// Since the promise might have been dropped from the stack after its last child was taken, we rely on its height.
+func (s *promiseStack) popUntil(ctx context.Context, p *Promise) {
+	for len(*s) > p.height {
+		s.pop().runCleanup(ctx, false)
+	}
+}
+
+// deterministic checks if the frame is in the stack and there's no choice points above it.
+func (s promiseStack) deterministic(frame *Promise) bool {
+	if frame.height >= len(s) || s[frame.height] != frame {
+		return false
+	}
+	for _, p := range s[frame.height+1:] {
+		if len(p.delayed) > 0 || p.repeat {
+			return false
 		}
 	}
+	return true
+}
+
+// abandon calls the cleanups of the promises left in the stack once the execution is over.
+func (s *promiseStack) abandon(ctx context.Context) {
+	if ctx.Err() != nil {
+		ctx = context.Background() // Cleanups still have to run even if the execution is cancelled.
+	}
+	for len(*s) > 0 {
+		s.pop().runCleanup(ctx, false)
+	}
 }
 
-func (s *promiseStack) recover(err error) error {
+func (s *promiseStack) recover(ctx context.Context, err error) error {
 	// look for an ancestor promise with a recovering function that is applicable to the error.
 	for len(*s) > 0 {
 		pop := s.pop()
+		pop.runCleanup(ctx, false)
 		if pop.recover == nil {
 			continue
 		}
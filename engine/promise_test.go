@@ -2,6 +2,7 @@ package engine
 
 import (
 	"context"
+	"runtime"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -72,4 +73,67 @@ func TestPromise_Force(t *testing.T) {
 		assert.True(t, ok)
 		assert.Equal(t, 10, count)
 	})
+
+	t.Run("deterministic", func(t *testing.T) {
+		heapAlloc := func() uint64 {
+			runtime.GC()
+			var m runtime.MemStats
+			runtime.ReadMemStats(&m)
+			return m.HeapAlloc
+		}
+
+		// A chain of promises without choices runs in constant space.
+		var (
+			before, after uint64
+			chain         func(n int) *Promise
+		)
+		chain = func(n int) *Promise {
+			switch n {
+			case 1000:
+				before = heapAlloc()
+			case 100000:
+				after = heapAlloc()
+				return Bool(true)
+			}
+			return Delay(func(context.Context) *Promise {
+				return chain(n + 1)
+			})
+		}
+
+		ok, err := chain(0).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Less(t, int64(after)-int64(before), int64(1<<20))
+	})
+
+	t.Run("cut after the last choice", func(t *testing.T) {
+		var res []int
+		var p *Promise
+		p = Delay(func(context.Context) *Promise {
+			res = append(res, 1)
+			return Bool(false)
+		}, func(context.Context) *Promise {
+			res = append(res, 2)
+			return Delay(func(context.Context) *Promise {
+				// p is no longer in the stack since it has no more choices.
+				return cut(p, func(context.Context) *Promise {
+					res = append(res, 3)
+					return Bool(false)
+				})
+			}, func(context.Context) *Promise {
+				res = append(res, 4)
+				return Bool(true)
+			})
+		})
+
+		ok, err := Delay(func(context.Context) *Promise {
+			return p
+		}, func(context.Context) *Promise {
+			res = append(res, 5)
+			return Bool(true)
+		}).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, []int{1, 2, 3, 5}, res)
+	})
 }
@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+// varDerivation is a special variable bound to the chain of clauses used so far while the derivation is tracked.
+var varDerivation = NewVariable()
+
+// varDerivationFrame is a special variable bound to the clause whose body is being executed.
+var varDerivationFrame = NewVariable()
+
+// Provenance describes a clause which contributed to a solution.
+type Provenance struct {
+	// Indicator is the predicate indicator of the clause e.g. foo/1.
+	Indicator Term
+
+	// Clause is the clause as it was compiled.
+	Clause Term
+
+	// Metadata is the argument of clause_metadata/1 directive in effect when the clause was consulted.
+	// It's nil if there's no such directive.
+	Metadata Term
+}
+
+// Proof is a node of a proof tree. It's a clause and the proofs of the goals in its body in the order of use.
+type Proof struct {
+	Provenance
+	Children []*Proof
+}
+
+// WithDerivation returns an Env in which the clauses used for the execution are recorded even if
+// VM.TrackDerivation is off. It enables the tracking for a single query.
+func (e *Env) WithDerivation() *Env {
+	return e.bind(varDerivation, rootDerivation)
+}
+
+// Derivation returns the clauses which contributed to env in the order of use.
+// It returns nil unless the derivation was tracked during the execution. See VM.TrackDerivation and Env.WithDerivation.
+func Derivation(env *Env) []Provenance {
+	var ps []Provenance
+	for d := derivationOf(env); d != nil && d != rootDerivation; d = d.prev {
+		ps = append(ps, d.Provenance)
+	}
+	for i, j := 0, len(ps)-1; i < j; i, j = i+1, j-1 {
+		ps[i], ps[j] = ps[j], ps[i]
+	}
+	return ps
+}
+
+// ProofTree returns the proof trees of the goals of the query which contributed to env.
+// It returns nil unless the derivation was tracked during the execution.
+func ProofTree(env *Env) []*Proof {
+	var ds []*derivation
+	for d := derivationOf(env); d != nil && d != rootDerivation; d = d.prev {
+		ds = append(ds, d)
+	}
+
+	var roots []*Proof
+	proofs := make(map[*derivation]*Proof, len(ds))
+	for i := len(ds) - 1; i >= 0; i-- {
+		d := ds[i]
+		p := Proof{Provenance: d.Provenance}
+		proofs[d] = &p
+		if parent, ok := proofs[d.parent]; ok {
+			parent.Children = append(parent.Children, &p)
+			continue
+		}
+		roots = append(roots, &p)
+	}
+	return roots
+}
+
+// derivation is a node of the chain of clauses from the latest to the earliest.
+type derivation struct {
+	Provenance
+	prev   *derivation // The clause used right before.
+	parent *derivation // The clause whose body called this clause.
+}
+
+// rootDerivation marks the beginning of the chain.
+var rootDerivation = &derivation{}
+
+func derivationOf(env *Env) *derivation {
+	t, ok := env.lookup(varDerivation)
+	if !ok {
+		return nil
+	}
+	d, _ := t.(*derivation)
+	return d
+}
+
+// derive records the clause c in env if the derivation is tracked.
+// The returned continuation restores the frame of the caller once c exits.
+func (vm *VM) derive(c *clause, k Cont, env *Env) (Cont, *Env) {
+	if c.pi.name == Atom(0) { // Exclude the transient clauses made by call/1.
+		return k, env
+	}
+	prev := derivationOf(env)
+	if prev == nil {
+		if !vm.TrackDerivation {
+			return k, env
+		}
+		prev = rootDerivation
+	}
+	var parent *derivation
+	if t, ok := env.lookup(varDerivationFrame); ok {
+		parent, _ = t.(*derivation)
+	}
+	d := derivation{
+		Provenance: Provenance{
+			Indicator: c.pi.Term(),
+			Clause:    c.raw,
+			Metadata:  c.metadata,
+		},
+		prev:   prev,
+		parent: parent,
+	}
+	return func(env *Env) *Promise {
+		return k(env.bind(varDerivationFrame, parent))
+	}, env.bind(varDerivation, &d).bind(varDerivationFrame, &d)
+}
+
+// WriteTerm outputs the derivation to an io.Writer.
+func (d *derivation) WriteTerm(w io.Writer, _ *WriteOptions, _ *Env) error {
+	_, err := fmt.Fprintf(w, "<derivation>(%p)", d)
+	return err
+}
+
+// Compare compares the derivation with a Term.
+func (d *derivation) Compare(t Term, env *Env) int {
+	return CompareAtomic[*derivation](d, t, func(d *derivation, e *derivation) int {
+		switch x, y := uintptr(unsafe.Pointer(d)), uintptr(unsafe.Pointer(e)); {
+		case x > y:
+			return 1
+		case x < y:
+			return -1
+		default:
+			return 0
+		}
+	}, env)
+}
@@ -0,0 +1,288 @@
+package engine
+
+import (
+	"reflect"
+	"sync"
+)
+
+// metaPredicates are the predicates which call some of their arguments as goals.
+// Each element tells how many extra arguments are added to the argument when it's called, or -1 if it's not a goal.
+// A call to them is pure iff the goals are pure regardless of their definitions.
+var metaPredicates = map[procedureIndicator][]int{
+	{name: atomComma, arity: 2}:                       {0, 0},
+	{name: atomSemiColon, arity: 2}:                   {0, 0},
+	{name: atomThen, arity: 2}:                        {0, 0},
+	{name: atomSoftCut, arity: 2}:                     {0, 0},
+	{name: atomNegation, arity: 1}:                    {0},
+	{name: atomNot, arity: 1}:                         {0},
+	{name: atomCaret, arity: 2}:                       {-1, 0},
+	{name: NewAtom("once"), arity: 1}:                 {0},
+	{name: atomCall, arity: 1}:                        {0},
+	{name: atomCall, arity: 2}:                        {1, -1},
+	{name: atomCall, arity: 3}:                        {2, -1, -1},
+	{name: atomCall, arity: 4}:                        {3, -1, -1, -1},
+	{name: atomCall, arity: 5}:                        {4, -1, -1, -1, -1},
+	{name: atomCall, arity: 6}:                        {5, -1, -1, -1, -1, -1},
+	{name: atomCall, arity: 7}:                        {6, -1, -1, -1, -1, -1, -1},
+	{name: atomCall, arity: 8}:                        {7, -1, -1, -1, -1, -1, -1, -1},
+	{name: NewAtom("catch"), arity: 3}:                {0, -1, 0},
+	{name: NewAtom("catch_with_backtrace"), arity: 3}: {0, -1, 0},
+	{name: NewAtom("call_nth"), arity: 2}:             {0, -1},
+	{name: NewAtom("findall"), arity: 3}:              {-1, 0, -1},
+	{name: NewAtom("bagof"), arity: 3}:                {-1, 0, -1},
+	{name: NewAtom("setof"), arity: 3}:                {-1, 0, -1},
+	{name: NewAtom("aggregate_all"), arity: 3}:        {-1, 0, -1},
+	{name: NewAtom("aggregate_window"), arity: 4}:     {-1, -1, 0, -1},
+	{name: NewAtom("foldall"), arity: 4}:              {2, 0, -1, -1},
+	{name: NewAtom("forall_count"), arity: 3}:         {0, 0, -1},
+	{name: NewAtom("maplist"), arity: 2}:              {1, -1},
+	{name: NewAtom("maplist"), arity: 3}:              {2, -1, -1},
+	{name: NewAtom("maplist"), arity: 4}:              {3, -1, -1, -1},
+	{name: NewAtom("maplist"), arity: 5}:              {4, -1, -1, -1, -1},
+	{name: NewAtom("maplist"), arity: 6}:              {5, -1, -1, -1, -1, -1},
+	{name: NewAtom("maplist"), arity: 7}:              {6, -1, -1, -1, -1, -1, -1},
+	{name: NewAtom("maplist"), arity: 8}:              {7, -1, -1, -1, -1, -1, -1, -1},
+	{name: NewAtom("foldl"), arity: 4}:                {3, -1, -1, -1},
+	{name: NewAtom("foldl"), arity: 5}:                {4, -1, -1, -1, -1},
+	{name: NewAtom("foldl"), arity: 6}:                {5, -1, -1, -1, -1, -1},
+}
+
+// unboundedPredicates are the builtin predicates which may have infinitely many solutions e.g. repeat/0.
+// They're pure but a goal calling them might never be exhausted. So they're never run in parallel.
+var unboundedPredicates = map[procedureIndicator]struct{}{
+	{name: NewAtom("repeat"), arity: 0}:  {},
+	{name: NewAtom("between"), arity: 3}: {},
+	{name: NewAtom("length"), arity: 2}:  {},
+}
+
+// DeclarePure declares that the foreign predicate of name/arity has no side effects i.e. no I/O, no modification of
+// the database, and its result depends only on its arguments. The purity analysis trusts the declaration.
+func (vm *VM) DeclarePure(name Atom, arity int) {
+	if vm.pures == nil {
+		vm.pures = map[procedureIndicator]struct{}{}
+	}
+	vm.pures[procedureIndicator{name: name, arity: Integer(arity)}] = struct{}{}
+	vm.invalidatePurity()
+}
+
+// IsPure tells if the predicate of name/arity is certified to have no side effects.
+// A user-defined predicate is pure iff it's static and every goal in its clauses transitively calls only pure
+// predicates. Calls to variable goals, dynamic predicates, undefined predicates, and foreign predicates not declared
+// by DeclarePure are considered impure. The result reflects the current database.
+func (vm *VM) IsPure(name Atom, arity int) bool {
+	return vm.pure(procedureIndicator{name: name, arity: Integer(arity)}, false)
+}
+
+// purityKey is a key of the cached results of the purity analysis.
+type purityKey struct {
+	pi      procedureIndicator
+	bounded bool // Whether calls to unboundedPredicates count as impure.
+}
+
+// purityCache holds the results of the purity analysis until the database changes.
+type purityCache struct {
+	mu     sync.Mutex
+	result map[purityKey]bool
+}
+
+// invalidatePurity drops the cached results of the purity analysis. It's called whenever procedures change.
+func (vm *VM) invalidatePurity() {
+	if vm.purity == nil {
+		vm.purity = &purityCache{}
+		return
+	}
+	vm.purity.mu.Lock()
+	defer vm.purity.mu.Unlock()
+	vm.purity.result = nil
+}
+
+// pure tells if the procedure is pure. If bounded is true, it also requires that the procedure never calls
+// unboundedPredicates so that its solutions are finite unless it recurses infinitely by itself.
+func (vm *VM) pure(pi procedureIndicator, bounded bool) bool {
+	key := purityKey{pi: pi, bounded: bounded}
+	c := vm.purity
+	if c != nil {
+		c.mu.Lock()
+		ret, ok := c.result[key]
+		c.mu.Unlock()
+		if ok {
+			return ret
+		}
+	}
+
+	ret := vm.checkPurity(pi, bounded)
+
+	if c != nil {
+		c.mu.Lock()
+		if c.result == nil {
+			c.result = map[purityKey]bool{}
+		}
+		c.result[key] = ret
+		c.mu.Unlock()
+	}
+	return ret
+}
+
+func (vm *VM) checkPurity(pi procedureIndicator, bounded bool) bool {
+	c := purityChecker{vm: vm, bounded: bounded, deps: map[procedureIndicator][]procedureIndicator{}, impure: map[procedureIndicator]bool{}}
+	c.visit(pi)
+	c.propagate()
+	return !c.impure[pi]
+}
+
+// Dependencies is a snapshot of the procedures a goal transitively calls. See VM.Dependencies.
+type Dependencies struct {
+	vm    *VM
+	procs []dependency
+}
+
+type dependency struct {
+	pi         procedureIndicator
+	p          procedure
+	generation uint64
+}
+
+// Dependencies returns the procedures goal transitively calls if its results depend only on them and its arguments.
+// That is, goal would be pure if the dynamic procedures were static. Otherwise, ok is false.
+// The results of goal stay the same until Changed of the returned Dependencies reports true.
+func (vm *VM) Dependencies(goal Term, env *Env) (_ *Dependencies, ok bool) {
+	c := purityChecker{vm: vm, dynamic: true, deps: map[procedureIndicator][]procedureIndicator{}, impure: map[procedureIndicator]bool{}}
+	var query procedureIndicator // The zero value stands for goal. It's never a procedure.
+	c.deps[query] = nil
+	c.goal(query, env.simplify(goal), 0)
+	c.propagate()
+	if c.impure[query] {
+		return nil, false
+	}
+
+	d := Dependencies{vm: vm, procs: make([]dependency, 0, len(c.deps)-1)}
+	for pi := range c.deps {
+		if pi == query {
+			continue
+		}
+		dep := dependency{pi: pi, p: vm.procedures[pi]}
+		if u, ok := dep.p.(*userDefined); ok {
+			dep.generation = u.generation
+		}
+		d.procs = append(d.procs, dep)
+	}
+	return &d, true
+}
+
+// Changed tells if any of the procedures have been defined, redefined, modified, or removed since the snapshot.
+func (d *Dependencies) Changed() bool {
+	for _, dep := range d.procs {
+		p := d.vm.procedures[dep.pi]
+		if !sameProcedure(p, dep.p) {
+			return true
+		}
+		if u, ok := p.(*userDefined); ok && u.generation != dep.generation {
+			return true
+		}
+	}
+	return false
+}
+
+// sameProcedure tells if p and q are the same user-defined procedure or the same foreign predicate.
+func sameProcedure(p, q procedure) bool {
+	if p == nil || q == nil {
+		return p == nil && q == nil
+	}
+	pv, qv := reflect.ValueOf(p), reflect.ValueOf(q)
+	return pv.Type() == qv.Type() && pv.Pointer() == qv.Pointer()
+}
+
+type purityChecker struct {
+	vm      *VM
+	bounded bool
+	dynamic bool // Whether dynamic procedures count as pure. See Dependencies.
+	deps    map[procedureIndicator][]procedureIndicator
+	impure  map[procedureIndicator]bool
+}
+
+// propagate makes the callers of impure procedures impure.
+func (c *purityChecker) propagate() {
+	for changed := true; changed; {
+		changed = false
+		for p, ds := range c.deps {
+			if c.impure[p] {
+				continue
+			}
+			for _, d := range ds {
+				if c.impure[d] {
+					c.impure[p] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+}
+
+func (c *purityChecker) visit(pi procedureIndicator) {
+	if _, ok := c.deps[pi]; ok {
+		return
+	}
+	c.deps[pi] = nil
+
+	if _, ok := unboundedPredicates[pi]; ok && c.bounded {
+		c.impure[pi] = true
+		return
+	}
+
+	if _, ok := c.vm.pures[pi]; ok {
+		return
+	}
+
+	u, ok := c.vm.procedures[pi].(*userDefined)
+	if !ok || (u.dynamic && !c.dynamic) {
+		c.impure[pi] = true
+		return
+	}
+	for _, cl := range u.clauses {
+		if b, ok := cl.raw.(Compound); ok && b.Functor() == atomIf && b.Arity() == 2 {
+			c.goal(pi, b.Arg(1), 0)
+		}
+	}
+}
+
+// goal examines the goal in the body of caller which is called with extra arguments.
+func (c *purityChecker) goal(caller procedureIndicator, g Term, extra int) {
+	var (
+		pi   procedureIndicator
+		args []Term
+	)
+	switch g := g.(type) {
+	case Atom:
+		if g == atomCut && extra == 0 {
+			return
+		}
+		pi = procedureIndicator{name: g, arity: Integer(extra)}
+	case Compound:
+		pi = procedureIndicator{name: g.Functor(), arity: Integer(g.Arity() + extra)}
+		args = make([]Term, g.Arity())
+		for i := range args {
+			args[i] = g.Arg(i)
+		}
+	default: // Variables are unknown goals. The others raise type errors.
+		c.impure[caller] = true
+		return
+	}
+
+	if spec, ok := metaPredicates[pi]; ok {
+		for i, n := range spec {
+			if n < 0 {
+				continue
+			}
+			if i >= len(args) { // The goal is given at runtime.
+				c.impure[caller] = true
+				return
+			}
+			c.goal(caller, args[i], n)
+		}
+		return
+	}
+
+	c.deps[caller] = append(c.deps[caller], pi)
+	c.visit(pi)
+}
@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVM_IsPure(t *testing.T) {
+	var vm VM
+	vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+	vm.operators.define(1200, operatorSpecifierFX, atomIf)
+	vm.operators.define(1100, operatorSpecifierXFY, atomSemiColon)
+	vm.operators.define(1050, operatorSpecifierXFY, atomThen)
+	vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+	vm.operators.define(900, operatorSpecifierFY, atomNegation)
+	vm.operators.define(700, operatorSpecifierXFX, atomEqual)
+	vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+	vm.Register1(NewAtom("write"), func(_ *VM, _ Term, k Cont, env *Env) *Promise {
+		return k(env)
+	})
+	vm.Register2(atomEqual, Unify)
+	vm.DeclarePure(atomEqual, 2)
+	assert.NoError(t, vm.Compile(context.Background(), `
+:- dynamic(counter/1).
+fact(a).
+rule(X) :- fact(X), X = a, !.
+control(X) :- (fact(X) -> fact(a) ; \+ fact(X)), findall(Y, fact(Y), _).
+closure(X) :- call(rule, X), maplist(fact, [X]).
+even(a).
+even(X) :- odd(X).
+odd(X) :- even(X).
+io(X) :- write(X).
+io_indirect(X) :- rule(X) ; io(X).
+mutual_io(X) :- mutual_io2(X).
+mutual_io2(X) :- mutual_io(X), io(X).
+state(X) :- counter(X).
+variable(G) :- G.
+runtime_closure(G) :- call(G, a).
+undefined :- foo.
+`))
+
+	tests := []struct {
+		name  string
+		arity int
+		pure  bool
+	}{
+		{name: "fact", arity: 1, pure: true},
+		{name: "rule", arity: 1, pure: true},
+		{name: "control", arity: 1, pure: true},
+		{name: "closure", arity: 1, pure: true},
+		{name: "even", arity: 1, pure: true},
+		{name: "=", arity: 2, pure: true},
+		{name: "io", arity: 1, pure: false},
+		{name: "io_indirect", arity: 1, pure: false},
+		{name: "mutual_io", arity: 1, pure: false},
+		{name: "state", arity: 1, pure: false},
+		{name: "counter", arity: 1, pure: false},
+		{name: "variable", arity: 1, pure: false},
+		{name: "runtime_closure", arity: 1, pure: false},
+		{name: "undefined", arity: 0, pure: false},
+		{name: "write", arity: 1, pure: false},
+		{name: "foo", arity: 0, pure: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.pure, vm.IsPure(NewAtom(tt.name), tt.arity))
+		})
+	}
+}
+
+func TestVM_Dependencies(t *testing.T) {
+	var vm VM
+	vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+	vm.operators.define(1200, operatorSpecifierFX, atomIf)
+	vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+	vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+	vm.Register1(NewAtom("write"), func(_ *VM, _ Term, k Cont, env *Env) *Promise {
+		return k(env)
+	})
+	vm.Register1(NewAtom("assertz"), Assertz)
+	vm.Register1(NewAtom("retract"), Retract)
+	assert.NoError(t, vm.Compile(context.Background(), `
+:- dynamic(role/2).
+:- dynamic(other/1).
+role(alice, admin).
+admin(X) :- role(X, admin).
+io(X) :- write(X).
+`))
+
+	_, ok := vm.Dependencies(NewAtom("io").Apply(NewAtom("alice")), nil)
+	assert.False(t, ok)
+	_, ok = vm.Dependencies(NewVariable(), nil)
+	assert.False(t, ok)
+
+	x := NewVariable()
+	env, _ := NewEnv().Unify(x, NewAtom("alice"))
+	d, ok := vm.Dependencies(NewAtom("admin").Apply(x), env)
+	assert.True(t, ok)
+	assert.False(t, d.Changed())
+
+	// A change to an unrelated procedure.
+	_, err := Assertz(&vm, NewAtom("other").Apply(NewAtom("a")), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, d.Changed())
+
+	// A change to a procedure it depends on.
+	_, err = Assertz(&vm, NewAtom("role").Apply(NewAtom("bob"), NewAtom("admin")), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, d.Changed())
+
+	d, ok = vm.Dependencies(NewAtom("admin").Apply(x), env)
+	assert.True(t, ok)
+	_, err = Retract(&vm, NewAtom("role").Apply(NewAtom("bob"), NewAtom("admin")), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, d.Changed())
+
+	// Redefinition.
+	d, ok = vm.Dependencies(NewAtom("admin").Apply(x), env)
+	assert.True(t, ok)
+	assert.NoError(t, vm.Compile(context.Background(), `admin(_).`))
+	assert.True(t, d.Changed())
+}
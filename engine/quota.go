@@ -0,0 +1,134 @@
+package engine
+
+import (
+	"context"
+	"time"
+	"unsafe"
+)
+
+// Quota limits the resources a VM consumes. A zero field means no limit.
+type Quota struct {
+	// Clauses is the maximum net number of clauses added by assertion and consultation.
+	Clauses int
+
+	// Memory is the maximum net number of bytes the added clauses occupy.
+	// The size of a clause is an estimate based on its bytecode.
+	Memory int64
+
+	// Inferences is the maximum number of predicate calls.
+	// Setting it enables counting of the calls. Then, the VM must not run queries concurrently.
+	Inferences int64
+
+	// ForeignCall is the maximum duration of a single call to a foreign predicate registered by the embedder through
+	// Register0 to Register8. The call exceeding it raises resource_error(foreign_call_time) even if the predicate
+	// ignores the context. The builtin predicates aren't timed.
+	// Setting it makes every such call run in its own goroutine. The one which exceeded it isn't stopped. It keeps
+	// running in the background, even after the query is over, until it returns and then its result is discarded.
+	// So the predicate must be safe to abandon e.g. it must not modify the VM nor the terms of the query.
+	// Only the call until it returns a promise is timed. The rest of the query and the alternatives of the promise aren't.
+	ForeignCall time.Duration
+}
+
+// Usage is the resources a VM has consumed.
+// Clauses and Memory decrease as clauses are removed. They may go negative if the removed ones came with the VM e.g. via Fork.
+// Inferences are counted only while Quota.Inferences is set.
+type Usage struct {
+	Clauses    int
+	Memory     int64
+	Inferences int64
+}
+
+// Usage returns the resources the VM has consumed so far.
+func (vm *VM) Usage() Usage {
+	return vm.usage
+}
+
+// ResetInferences starts counting inferences from zero again e.g. for each request.
+func (vm *VM) ResetInferences() {
+	vm.usage.Inferences = 0
+}
+
+// infer counts a predicate call if the quota of inferences is set.
+// Otherwise, it doesn't count since the VM may be running concurrent queries e.g. of a shared policy.
+func (vm *VM) infer(env *Env) error {
+	q := vm.Quota.Inferences
+	if q <= 0 {
+		return nil
+	}
+	vm.usage.Inferences++
+	if vm.usage.Inferences > q {
+		return resourceError(resourceInferences, env)
+	}
+	return nil
+}
+
+// isForeign tells if p is a foreign predicate registered by the embedder.
+func (vm *VM) isForeign(pi procedureIndicator, p procedure) bool {
+	if _, ok := p.(*userDefined); ok {
+		return false
+	}
+	_, ok := vm.foreign[pi]
+	return ok
+}
+
+// callForeign calls the foreign predicate p and gives up on it after Quota.ForeignCall.
+// The call which exceeded it is abandoned rather than stopped. See Quota.ForeignCall.
+func (vm *VM) callForeign(p procedure, args []Term, k Cont, env *Env) *Promise {
+	ch := make(chan *Promise, 1) // So that the goroutine can finish after the timeout.
+	go func() {
+		var promise *Promise
+		defer func() {
+			ch <- promise
+		}()
+		defer ensurePromise(&promise)
+		// The continuation is delayed so that the rest of the query doesn't run in the goroutine.
+		promise = p.call(vm, args, func(env *Env) *Promise {
+			return Delay(func(context.Context) *Promise {
+				return k(env)
+			})
+		}, env)
+	}()
+
+	t := time.NewTimer(vm.Quota.ForeignCall)
+	defer t.Stop()
+	select {
+	case promise := <-ch:
+		return promise
+	case <-t.C:
+		return Error(resourceError(resourceForeignCallTime, env))
+	}
+}
+
+// allocClauses accounts for n clauses of size bytes if they fit in the quota. n and size can be negative for a net change.
+func (vm *VM) allocClauses(n int, size int64, env *Env) error {
+	if q := vm.Quota.Clauses; q > 0 && n > 0 && vm.usage.Clauses+n > q {
+		return resourceError(resourceClauses, env)
+	}
+	if q := vm.Quota.Memory; q > 0 && size > 0 && vm.usage.Memory+size > q {
+		return resourceError(resourceMemory, env)
+	}
+	vm.usage.Clauses += n
+	vm.usage.Memory += size
+	return nil
+}
+
+// freeClauses accounts for the removed clauses.
+func (vm *VM) freeClauses(removed clauses) {
+	vm.usage.Clauses -= len(removed)
+	vm.usage.Memory -= removed.size()
+}
+
+var (
+	clauseSize      = int64(unsafe.Sizeof(clause{}))
+	instructionSize = int64(unsafe.Sizeof(instruction{}))
+	variableSize    = int64(unsafe.Sizeof(Variable(0)))
+)
+
+// size estimates the bytes the clauses occupy. Each instruction roughly corresponds to a node of the raw term.
+func (cs clauses) size() int64 {
+	var n int64
+	for _, c := range cs {
+		n += clauseSize + int64(len(c.bytecode))*(instructionSize+termSize) + int64(len(c.vars))*variableSize
+	}
+	return n
+}
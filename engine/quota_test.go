@@ -0,0 +1,177 @@
+package engine
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVM_Quota(t *testing.T) {
+	foo := NewAtom("foo")
+
+	t.Run("clauses", func(t *testing.T) {
+		var vm VM
+		vm.Quota.Clauses = 2
+		for _, a := range []string{"a", "b"} {
+			ok, err := Assertz(&vm, foo.Apply(NewAtom(a)), Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		}
+		_, err := Assertz(&vm, foo.Apply(NewAtom("c")), Success, nil).Force(context.Background())
+		assert.Equal(t, resourceError(resourceClauses, nil), err)
+		assert.Equal(t, 2, vm.Usage().Clauses)
+
+		ok, err := Retract(&vm, foo.Apply(NewAtom("a")), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, 1, vm.Usage().Clauses)
+
+		ok, err = Asserta(&vm, foo.Apply(NewAtom("c")), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = Abolish(&vm, atomSlash.Apply(foo, Integer(1)), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, Usage{}, vm.Usage())
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		var vm VM
+		ok, err := Assertz(&vm, foo.Apply(NewAtom("a")), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		size := vm.Usage().Memory
+		assert.True(t, size > 0)
+
+		vm.Quota.Memory = size * 3 / 2
+		_, err = Assertz(&vm, foo.Apply(NewAtom("b")), Success, nil).Force(context.Background())
+		assert.Equal(t, resourceError(resourceMemory, nil), err)
+		assert.Equal(t, Usage{Clauses: 1, Memory: size}, vm.Usage())
+	})
+
+	t.Run("erase", func(t *testing.T) {
+		var vm VM
+		ref := NewVariable()
+		var r Term
+		ok, err := AssertzRef(&vm, foo.Apply(NewAtom("a")), ref, func(env *Env) *Promise {
+			r = env.Resolve(ref)
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, 1, vm.Usage().Clauses)
+
+		ok, err = Erase(&vm, r, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, Usage{}, vm.Usage())
+	})
+
+	t.Run("compile", func(t *testing.T) {
+		var vm VM
+		assert.NoError(t, vm.Compile(context.Background(), `foo(a). foo(b). bar(a).`))
+		assert.Equal(t, 3, vm.Usage().Clauses)
+
+		// Redefinition replaces the clauses.
+		assert.NoError(t, vm.Compile(context.Background(), `foo(c).`))
+		assert.Equal(t, 2, vm.Usage().Clauses)
+
+		vm.Quota.Clauses = 3
+		assert.Equal(t, resourceError(resourceClauses, nil), vm.Compile(context.Background(), `baz(a). baz(b).`))
+		assert.Equal(t, 2, vm.Usage().Clauses)
+	})
+
+	t.Run("inferences", func(t *testing.T) {
+		var vm VM
+		vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+		vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+		vm.Register0(NewAtom("true"), func(_ *VM, k Cont, env *Env) *Promise {
+			return k(env)
+		})
+		assert.NoError(t, vm.Compile(context.Background(), `loop :- true, loop.`))
+
+		vm.Quota.Inferences = 100
+		_, err := vm.Arrive(NewAtom("loop"), nil, Success, nil).Force(context.Background())
+		assert.Equal(t, atomResourceError.Apply(atomInferences), err.(Exception).Term().(Compound).Arg(0))
+		assert.Equal(t, int64(101), vm.Usage().Inferences)
+
+		vm.ResetInferences()
+		assert.Equal(t, int64(0), vm.Usage().Inferences)
+
+		// Without the quota, the VM may run concurrent queries. So it doesn't count.
+		vm.Quota.Inferences = 0
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ok, err := vm.Arrive(NewAtom("true"), nil, Success, nil).Force(context.Background())
+				assert.NoError(t, err)
+				assert.True(t, ok)
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int64(0), vm.Usage().Inferences)
+	})
+	t.Run("foreign call", func(t *testing.T) {
+		var vm VM
+		vm.Quota.ForeignCall = 10 * time.Millisecond
+		release := make(chan struct{})
+		defer close(release)
+		vm.Register0(NewAtom("slow"), func(_ *VM, k Cont, env *Env) *Promise {
+			<-release // It ignores the context.
+			return k(env)
+		})
+		vm.Register0(NewAtom("fast"), func(_ *VM, k Cont, env *Env) *Promise {
+			return k(env)
+		})
+		vm.Register0(NewAtom("broken"), func(*VM, Cont, *Env) *Promise {
+			panic("broken")
+		})
+
+		_, err := vm.Arrive(NewAtom("slow"), nil, Success, nil).Force(context.Background())
+		assert.Equal(t, atomError.Apply(atomResourceError.Apply(atomForeignCallTime), atomSlash.Apply(NewAtom("slow"), Integer(0))), err.(Exception).Term())
+
+		// The continuation isn't timed.
+		ok, err := vm.Arrive(NewAtom("fast"), nil, func(env *Env) *Promise {
+			time.Sleep(2 * vm.Quota.ForeignCall)
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		_, err = vm.Arrive(NewAtom("broken"), nil, Success, nil).Force(context.Background())
+		assert.EqualError(t, err, "panic: broken")
+	})
+
+	t.Run("builtin", func(t *testing.T) {
+		var vm VM
+		vm.Quota.ForeignCall = time.Nanosecond
+		vm.Register1(NewAtom("assertz"), Assertz)
+		vm.Register0(NewAtom("foo"), func(_ *VM, k Cont, env *Env) *Promise {
+			return k(env)
+		})
+		assert.Equal(t, map[procedureIndicator]struct{}{{name: NewAtom("foo"), arity: 0}: {}}, vm.foreign)
+		assert.Equal(t, vm.foreign, vm.Fork().foreign)
+
+		// The builtins aren't timed.
+		for i := 0; i < 100; i++ {
+			ok, err := vm.Arrive(NewAtom("assertz"), []Term{NewAtom("bar").Apply(Integer(i))}, Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		}
+		assert.Len(t, vm.procedures[procedureIndicator{name: NewAtom("bar"), arity: 1}].(*userDefined).clauses, 100)
+
+		// Unless they're replaced by the embedder's.
+		vm.Register1(NewAtom("assertz"), func(*VM, Term, Cont, *Env) *Promise {
+			time.Sleep(time.Millisecond)
+			return Bool(true)
+		})
+		_, err := vm.Arrive(NewAtom("assertz"), []Term{NewAtom("bar")}, Success, nil).Force(context.Background())
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"math/rand"
+)
+
+// float64 returns a pseudo-random number in [0.0,1.0) from vm.Rand or the global source.
+func (vm *VM) float64() float64 {
+	if vm.Rand == nil {
+		return rand.Float64()
+	}
+	return vm.Rand.Float64()
+}
+
+// int63n returns a pseudo-random number in [0,n) from vm.Rand or the global source.
+func (vm *VM) int63n(n int64) int64 {
+	if vm.Rand == nil {
+		return rand.Int63n(n)
+	}
+	return vm.Rand.Int63n(n)
+}
+
+// shuffle pseudo-randomizes the order of ts by vm.Rand or the global source.
+func (vm *VM) shuffle(ts []Term) {
+	swap := func(i, j int) {
+		ts[i], ts[j] = ts[j], ts[i]
+	}
+	if vm.Rand == nil {
+		rand.Shuffle(len(ts), swap)
+		return
+	}
+	vm.Rand.Shuffle(len(ts), swap)
+}
+
+// Random unifies x with a pseudo-random float in [0.0,1.0).
+func Random(vm *VM, x Term, k Cont, env *Env) *Promise {
+	return Unify(vm, x, Float(vm.float64()), k, env)
+}
+
+// RandomBetween unifies x with a pseudo-random integer in [low,high]. It fails if high is less than low.
+func RandomBetween(vm *VM, low, high, x Term, k Cont, env *Env) *Promise {
+	var l, h Integer
+	switch low := env.Resolve(low).(type) {
+	case Variable:
+		return Error(InstantiationError(env))
+	case Integer:
+		l = low
+	default:
+		return Error(typeError(validTypeInteger, low, env))
+	}
+	switch high := env.Resolve(high).(type) {
+	case Variable:
+		return Error(InstantiationError(env))
+	case Integer:
+		h = high
+	default:
+		return Error(typeError(validTypeInteger, high, env))
+	}
+	if h < l {
+		return Bool(false)
+	}
+	n := uint64(h) - uint64(l) + 1
+	if n == 0 || n > 1<<63-1 { // The range doesn't fit in int64.
+		return Error(representationError(flagMaxInteger, env))
+	}
+	return Unify(vm, x, l+Integer(vm.int63n(int64(n))), k, env)
+}
+
+// RandomPermutation unifies permutation with a pseudo-random permutation of list.
+func RandomPermutation(vm *VM, list, permutation Term, k Cont, env *Env) *Promise {
+	var elems []Term
+	iter := ListIterator{List: list, Env: env}
+	for iter.Next() {
+		elems = append(elems, iter.Current())
+	}
+	if err := iter.Err(); err != nil {
+		return Error(err)
+	}
+	vm.shuffle(elems)
+	return Unify(vm, permutation, List(elems...), k, env)
+}
+
+// CryptoHash unifies digest with the hexadecimal digest of data by algorithm which is one of md5, sha1, or sha256.
+// data is a text e.g. an atom or a list of codes and hashed in UTF-8.
+func CryptoHash(vm *VM, algorithm, data, digest Term, k Cont, env *Env) *Promise {
+	var h hash.Hash
+	switch a := env.Resolve(algorithm).(type) {
+	case Variable:
+		return Error(InstantiationError(env))
+	case Atom:
+		switch a {
+		case atomMD5:
+			h = md5.New()
+		case atomSHA1:
+			h = sha1.New()
+		case atomSHA256:
+			h = sha256.New()
+		default:
+			return Error(domainError(validDomainHashAlgorithm, a, env))
+		}
+	default:
+		return Error(typeError(validTypeAtom, a, env))
+	}
+
+	s, err := textOf(data, env)
+	if err != nil {
+		return Error(err)
+	}
+	_, _ = h.Write([]byte(s))
+	return Unify(vm, digest, NewAtom(hex.EncodeToString(h.Sum(nil))), k, env)
+}
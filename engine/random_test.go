@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRandom(t *testing.T) {
+	x := NewVariable()
+	var vm VM
+	ok, err := Random(&vm, x, func(env *Env) *Promise {
+		f, ok := env.Resolve(x).(Float)
+		assert.True(t, ok)
+		assert.GreaterOrEqual(t, float64(f), 0.0)
+		assert.Less(t, float64(f), 1.0)
+		return Bool(true)
+	}, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestRandomBetween(t *testing.T) {
+	x := NewVariable()
+
+	t.Run("seeded", func(t *testing.T) {
+		// The same seed results in the same sequence.
+		sequence := func() []Term {
+			vm := VM{Rand: rand.New(rand.NewSource(1))}
+			var ret []Term
+			for i := 0; i < 10; i++ {
+				ok, err := RandomBetween(&vm, Integer(1), Integer(6), x, func(env *Env) *Promise {
+					ret = append(ret, env.Resolve(x))
+					return Bool(true)
+				}, nil).Force(context.Background())
+				assert.NoError(t, err)
+				assert.True(t, ok)
+			}
+			return ret
+		}
+		s := sequence()
+		assert.Equal(t, s, sequence())
+		for _, n := range s {
+			assert.GreaterOrEqual(t, n, Integer(1))
+			assert.LessOrEqual(t, n, Integer(6))
+		}
+	})
+
+	t.Run("single", func(t *testing.T) {
+		var vm VM
+		ok, err := RandomBetween(&vm, Integer(3), Integer(3), Integer(3), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		var vm VM
+		ok, err := RandomBetween(&vm, Integer(3), Integer(2), x, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		var vm VM
+		_, err := RandomBetween(&vm, NewVariable(), Integer(2), x, Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(nil), err)
+		_, err = RandomBetween(&vm, Integer(1), NewAtom("a"), x, Success, nil).Force(context.Background())
+		assert.Equal(t, typeError(validTypeInteger, NewAtom("a"), nil), err)
+		_, err = RandomBetween(&vm, Integer(-1<<63), Integer(1<<63-1), x, Success, nil).Force(context.Background())
+		assert.Equal(t, representationError(flagMaxInteger, nil), err)
+	})
+}
+
+func TestRandomPermutation(t *testing.T) {
+	x := NewVariable()
+	vm := VM{Rand: rand.New(rand.NewSource(1))}
+	list := List(Integer(1), Integer(2), Integer(3), Integer(4), Integer(5))
+	ok, err := RandomPermutation(&vm, list, x, func(env *Env) *Promise {
+		var elems []Term
+		iter := ListIterator{List: x, Env: env}
+		for iter.Next() {
+			elems = append(elems, iter.Current())
+		}
+		assert.ElementsMatch(t, []Term{Integer(1), Integer(2), Integer(3), Integer(4), Integer(5)}, elems)
+		return Bool(true)
+	}, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	_, err = RandomPermutation(&vm, PartialList(NewVariable(), Integer(1)), x, Success, nil).Force(context.Background())
+	assert.Equal(t, InstantiationError(nil), err)
+}
+
+func TestCryptoHash(t *testing.T) {
+	tests := []struct {
+		title           string
+		algorithm, data Term
+		digest          Term
+		err             error
+	}{
+		{title: "md5", algorithm: atomMD5, data: NewAtom("abc"), digest: NewAtom("900150983cd24fb0d6963f7d28e17f72")},
+		{title: "sha1", algorithm: atomSHA1, data: CodeList("abc"), digest: NewAtom("a9993e364706816aba3e25717850c26c9cd0d89d")},
+		{title: "sha256", algorithm: atomSHA256, data: CharList("abc"), digest: NewAtom("ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad")},
+		{title: "algorithm is a variable", algorithm: NewVariable(), data: NewAtom("abc"), err: InstantiationError(nil)},
+		{title: "algorithm is not an atom", algorithm: Integer(1), data: NewAtom("abc"), err: typeError(validTypeAtom, Integer(1), nil)},
+		{title: "unknown algorithm", algorithm: NewAtom("crc32"), data: NewAtom("abc"), err: domainError(validDomainHashAlgorithm, NewAtom("crc32"), nil)},
+		{title: "data is a variable", algorithm: atomMD5, data: NewVariable(), err: InstantiationError(nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			d := NewVariable()
+			var vm VM
+			_, err := CryptoHash(&vm, tt.algorithm, tt.data, d, func(env *Env) *Promise {
+				assert.Equal(t, tt.digest, env.Resolve(d))
+				return Bool(true)
+			}, nil).Force(context.Background())
+			assert.Equal(t, tt.err, err)
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+)
+
+// A resumable query interprets the clauses of the user-defined procedures instead of running their bytecode so that the
+// rest of the query is a term at any point. When it reaches yield/2, it pauses and hands the rest over as a Suspension,
+// which can be serialized and resumed later even in another process with the same program.
+//
+// yield/2 is recognized in the clause bodies of the user-defined procedures, in the control constructs ','/2, ';'/2,
+// and '->'/2 except for the conditions, and in call/N. Elsewhere e.g. in findall/3 or catch/3, it raises
+// existence_error(resumable_query, Out) as well as outside of resumable queries.
+//
+// The choice points left at yield/2 are discarded. The resumed query continues the solution which reached yield/2.
+
+// Outcome tells how far a resumable query went. If both Answer and Suspension are nil, the query failed.
+type Outcome struct {
+	// Answer is the template instantiated by the first solution of the query if it succeeded.
+	Answer Term
+
+	// Suspension is the query paused at yield/2 if it did.
+	Suspension *Suspension
+}
+
+// Suspension is a resumable query paused at yield(Out, In).
+type Suspension struct {
+	// Yielded is Out of yield(Out, In).
+	Yielded Term
+
+	input    Term // In of yield(Out, In).
+	rest     Term // The goals left to run.
+	template Term
+}
+
+// RunResumable runs goal until it succeeds, fails, or pauses at yield/2.
+func (vm *VM) RunResumable(ctx context.Context, goal, template Term) (Outcome, error) {
+	return vm.runResumable(ctx, &goalList{goal: goal}, template, nil)
+}
+
+// Resume continues the suspended query. input is unified with In of yield(Out, In).
+func (vm *VM) Resume(ctx context.Context, s *Suspension, input Term) (Outcome, error) {
+	gs := &goalList{goal: atomEqual.Apply(s.input, input), next: &goalList{goal: s.rest}}
+	return vm.runResumable(ctx, gs, s.template, nil)
+}
+
+func (vm *VM) runResumable(ctx context.Context, gs *goalList, template Term, env *Env) (Outcome, error) {
+	var r resumption
+	ok, err := vm.solveResumable(&r, gs, env).Force(ctx)
+	if err != nil || !ok {
+		return Outcome{}, err
+	}
+	if r.yield == nil {
+		return Outcome{Answer: r.env.simplify(template)}, nil
+	}
+
+	// The suspension shares the variables with the template so that the answer of the resumed query refers to them.
+	var goals []Term
+	for gs := r.rest; gs != nil; gs = gs.next {
+		goals = append(goals, gs.goal)
+	}
+	goals = append(goals, atomTrue)
+	t := r.env.simplify(tuple(r.yield.Arg(0), r.yield.Arg(1), seq(atomComma, goals...), template)).(Compound)
+	return Outcome{Suspension: &Suspension{
+		Yielded:  t.Arg(0),
+		input:    t.Arg(1),
+		rest:     t.Arg(2),
+		template: t.Arg(3),
+	}}, nil
+}
+
+// goalList is the rest of a resumable query. Each goal comes with the promise its cut is local to.
+type goalList struct {
+	goal      Term
+	cutParent *Promise
+	next      *goalList
+}
+
+// resumption is where a resumable query ended up.
+type resumption struct {
+	env   *Env
+	yield Compound
+	rest  *goalList
+}
+
+func (vm *VM) solveResumable(r *resumption, gs *goalList, env *Env) *Promise {
+	return Delay(func(context.Context) *Promise {
+		if gs == nil {
+			r.env = env
+			return Bool(true)
+		}
+		return vm.solveGoal(r, gs, env)
+	})
+}
+
+func (vm *VM) solveGoal(r *resumption, gs *goalList, env *Env) *Promise {
+	next := func(env *Env) *Promise {
+		return vm.solveResumable(r, gs.next, env)
+	}
+	// push puts the goals in front of the rest. Cut in them is local to the same promise as gs.
+	push := func(goals ...Term) *goalList {
+		rest := gs.next
+		for i := len(goals) - 1; i >= 0; i-- {
+			rest = &goalList{goal: goals[i], cutParent: gs.cutParent, next: rest}
+		}
+		return rest
+	}
+
+	switch g := env.Resolve(gs.goal).(type) {
+	case Variable:
+		return Error(InstantiationError(env))
+	case Atom:
+		switch g {
+		case atomTrue:
+			return next(env)
+		case atomCut:
+			return cut(gs.cutParent, func(context.Context) *Promise {
+				return next(env)
+			})
+		}
+	case Compound:
+		switch f, a := g.Functor(), g.Arity(); {
+		case f == atomYield && a == 2:
+			r.env, r.yield, r.rest = env, g, gs.next
+			return Bool(true)
+		case f == atomComma && a == 2:
+			return vm.solveResumable(r, push(g.Arg(0), g.Arg(1)), env)
+		case f == atomThen && a == 2:
+			return vm.solveIfThenElse(r, gs, g.Arg(0), g.Arg(1), atomFail, env)
+		case f == atomSemiColon && a == 2:
+			if c, ok := env.Resolve(g.Arg(0)).(Compound); ok && c.Functor() == atomThen && c.Arity() == 2 {
+				return vm.solveIfThenElse(r, gs, c.Arg(0), c.Arg(1), g.Arg(1), env)
+			}
+			return Delay(func(context.Context) *Promise {
+				return vm.solveResumable(r, push(g.Arg(0)), env)
+			}, func(context.Context) *Promise {
+				return vm.solveResumable(r, push(g.Arg(1)), env)
+			})
+		case f == atomCall && a >= 1:
+			pi, arg, err := piArg(g.Arg(0), env)
+			if err != nil {
+				return Error(err)
+			}
+			args := make([]Term, 0, int(pi.arity)+a-1)
+			for i := 0; i < int(pi.arity); i++ {
+				args = append(args, arg(i))
+			}
+			for i := 1; i < a; i++ {
+				args = append(args, g.Arg(i))
+			}
+			// call/N is opaque to cut.
+			var p *Promise
+			p = Delay(func(context.Context) *Promise {
+				return vm.solveResumable(r, &goalList{goal: pi.name.Apply(args...), cutParent: p, next: gs.next}, env)
+			})
+			return p
+		}
+	default:
+		return Error(typeError(validTypeCallable, g, env))
+	}
+
+	pi, _, err := piArg(gs.goal, env)
+	if err != nil {
+		return Error(err)
+	}
+	u, ok := vm.procedures[pi].(*userDefined)
+	if !ok {
+		return Call(vm, gs.goal, next, env)
+	}
+	return vm.solveUserDefined(r, u, gs, env)
+}
+
+// solveUserDefined tries the clauses of the procedure one by one in the logical update view.
+func (vm *VM) solveUserDefined(r *resumption, u *userDefined, gs *goalList, env *Env) *Promise {
+	if err := vm.infer(env); err != nil {
+		return Error(err)
+	}
+
+	cs := u.clauses
+	ks := make([]func(context.Context) *Promise, len(cs))
+	var p *Promise
+	for i := range cs {
+		c := &cs[i]
+		ks[i] = func(context.Context) *Promise {
+			t, err := renamedCopy(c.raw, nil, nil)
+			if err != nil {
+				return Error(err)
+			}
+			head, body := t, Term(atomTrue)
+			if h, ok := t.(Compound); ok && h.Functor() == atomIf && h.Arity() == 2 {
+				head, body = h.Arg(0), h.Arg(1)
+			}
+			env, ok := env.Unify(head, gs.goal)
+			if !ok {
+				return Bool(false)
+			}
+			return vm.solveResumable(r, &goalList{goal: body, cutParent: p, next: gs.next}, env)
+		}
+	}
+	p = Delay(ks...)
+	return p
+}
+
+// solveIfThenElse runs cond as an ordinary goal and commits to its first solution if any.
+func (vm *VM) solveIfThenElse(r *resumption, gs *goalList, cond, then, els Term, env *Env) *Promise {
+	return Delay(func(ctx context.Context) *Promise {
+		var found *Env
+		ok, err := Call(vm, cond, func(env *Env) *Promise {
+			found = env
+			return Bool(true)
+		}, env).Force(ctx)
+		if err != nil {
+			return Error(err)
+		}
+		if ok {
+			return vm.solveResumable(r, &goalList{goal: then, cutParent: gs.cutParent, next: gs.next}, found)
+		}
+		return vm.solveResumable(r, &goalList{goal: els, cutParent: gs.cutParent, next: gs.next}, env)
+	})
+}
+
+// Yield raises an error since it's only meaningful in resumable queries. See RunResumable.
+func Yield(_ *VM, out, _ Term, _ Cont, env *Env) *Promise {
+	return Error(existenceError(objectTypeResumableQuery, out, env))
+}
+
+// The format of a serialized suspension is the magic "1PLSUS", the version as a uvarint, and the terms Yielded, In,
+// the rest of the query, and the template in the encoding of images. The variables are shared among the terms.
+const (
+	suspensionMagic   = "1PLSUS"
+	suspensionVersion = 1
+)
+
+var errSuspensionMagic = errors.New("not a suspension")
+
+// MarshalBinary serializes the suspension so that it can be resumed later even in another process.
+// The procedures are referred to by their indicators. So, the process has to have the same program.
+func (s *Suspension) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	iw := imageWriter{w: bufio.NewWriter(&buf), vars: map[Variable]uint64{}}
+	_, _ = iw.w.WriteString(suspensionMagic)
+	iw.uvarint(suspensionVersion)
+	for _, t := range []Term{s.Yielded, s.input, s.rest, s.template} {
+		iw.term(t)
+	}
+	if iw.err != nil {
+		return nil, iw.err
+	}
+	if err := iw.w.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary restores the suspension serialized by MarshalBinary.
+func (s *Suspension) UnmarshalBinary(data []byte) error {
+	ir := imageReader{r: bufio.NewReader(bytes.NewReader(data))}
+	magic := make([]byte, len(suspensionMagic))
+	for i := range magic {
+		magic[i] = ir.byte()
+	}
+	if ir.err != nil || string(magic) != suspensionMagic {
+		return errSuspensionMagic
+	}
+	if v := ir.uvarint(); ir.err == nil && v != suspensionVersion {
+		return errImageVersion
+	}
+	yielded, input, rest, template := ir.term(), ir.term(), ir.term(), ir.term()
+	if ir.err != nil {
+		return ir.err
+	}
+	*s = Suspension{Yielded: yielded, input: input, rest: rest, template: template}
+	return nil
+}
@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVM_RunResumable(t *testing.T) {
+	var vm VM
+	vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+	vm.operators.define(1200, operatorSpecifierFX, atomIf)
+	vm.operators.define(1100, operatorSpecifierXFY, atomSemiColon)
+	vm.operators.define(1050, operatorSpecifierXFY, atomThen)
+	vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+	vm.operators.define(700, operatorSpecifierXFX, atomEqual)
+	vm.Register2(atomEqual, Unify)
+	vm.Register2(atomYield, Yield)
+	vm.Register1(NewAtom("findall_one"), func(vm *VM, g Term, k Cont, env *Env) *Promise {
+		return Call(vm, g, k, env)
+	})
+	assert.NoError(t, vm.Compile(context.Background(), `
+approval(Doc, Result) :-
+	step(Doc, draft, S1),
+	yield(review(Doc), Answer),
+	(   Answer = approved -> Result = published(S1)
+	;   Result = rejected(S1)
+	).
+
+step(_, draft, drafted).
+step(_, draft, redrafted).
+
+twice(X, Y) :- yield(first, X), !, call(yield, second, Y).
+
+nested :- findall_one(yield(x, _)).
+`))
+
+	t.Run("approved", func(t *testing.T) {
+		doc, result := NewVariable(), NewVariable()
+		o, err := vm.RunResumable(context.Background(), NewAtom("approval").Apply(NewAtom("doc1"), result), List(doc, result))
+		assert.NoError(t, err)
+		assert.Nil(t, o.Answer)
+		assert.NotNil(t, o.Suspension)
+		assert.Equal(t, NewAtom("review").Apply(NewAtom("doc1")), o.Suspension.Yielded)
+
+		// It survives a round trip through bytes as if it's resumed in another process.
+		b, err := o.Suspension.MarshalBinary()
+		assert.NoError(t, err)
+		var s Suspension
+		assert.NoError(t, s.UnmarshalBinary(b))
+
+		o, err = vm.Resume(context.Background(), &s, NewAtom("approved"))
+		assert.NoError(t, err)
+		assert.Nil(t, o.Suspension)
+		// The choice point of step/3 is discarded at yield/2.
+		assert.Equal(t, NewAtom("published").Apply(NewAtom("drafted")), o.Answer.(Compound).Arg(1).(Compound).Arg(0))
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		result := NewVariable()
+		o, err := vm.RunResumable(context.Background(), NewAtom("approval").Apply(NewAtom("doc1"), result), result)
+		assert.NoError(t, err)
+		o, err = vm.Resume(context.Background(), o.Suspension, NewAtom("declined"))
+		assert.NoError(t, err)
+		assert.Equal(t, NewAtom("rejected").Apply(NewAtom("drafted")), o.Answer)
+	})
+
+	t.Run("more than once", func(t *testing.T) {
+		x, y := NewVariable(), NewVariable()
+		o, err := vm.RunResumable(context.Background(), NewAtom("twice").Apply(x, y), List(x, y))
+		assert.NoError(t, err)
+		assert.Equal(t, NewAtom("first"), o.Suspension.Yielded)
+		o, err = vm.Resume(context.Background(), o.Suspension, Integer(1))
+		assert.NoError(t, err)
+		assert.Equal(t, NewAtom("second"), o.Suspension.Yielded)
+		o, err = vm.Resume(context.Background(), o.Suspension, Integer(2))
+		assert.NoError(t, err)
+		assert.Equal(t, List(Integer(1), Integer(2)), o.Answer)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		o, err := vm.RunResumable(context.Background(), NewAtom("step").Apply(NewVariable(), NewAtom("final"), NewVariable()), atomTrue)
+		assert.NoError(t, err)
+		assert.Equal(t, Outcome{}, o)
+	})
+
+	t.Run("no yield", func(t *testing.T) {
+		s := NewVariable()
+		o, err := vm.RunResumable(context.Background(), NewAtom("step").Apply(NewAtom("doc"), NewAtom("draft"), s), s)
+		assert.NoError(t, err)
+		assert.Equal(t, NewAtom("drafted"), o.Answer)
+	})
+
+	t.Run("not resumable", func(t *testing.T) {
+		_, err := vm.RunResumable(context.Background(), NewAtom("nested"), atomTrue)
+		assert.Equal(t, atomExistenceError.Apply(atomResumableQuery, NewAtom("x")), err.(Exception).Term().(Compound).Arg(0))
+	})
+
+	t.Run("not a suspension", func(t *testing.T) {
+		var s Suspension
+		assert.Equal(t, errSuspensionMagic, s.UnmarshalBinary([]byte("foo")))
+	})
+}
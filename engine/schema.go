@@ -0,0 +1,240 @@
+package engine
+
+import "fmt"
+
+// FactSchema declares the types of the arguments of the facts of a procedure e.g. fact_schema(user(atom, integer, atom)).
+// Then, the facts added by assertz/1, asserta/1, and Prolog texts are checked against the schema. The facts already in
+// the procedure are checked too. If any of them doesn't conform, it raises schema_error(Violations) where Violations
+// is a list of violation(Fact, N, Type, Culprit) for every argument that doesn't conform.
+//
+// The types are any, atom, atomic, boolean, callable, compound, float, ground, integer, list, nonneg, number, string,
+// text, list(Type), and oneof(List).
+func FactSchema(vm *VM, schema Term, k Cont, env *Env) *Promise {
+	pi, types, err := factSchema(schema, env)
+	if err != nil {
+		return Error(err)
+	}
+	if err := vm.declareSchema(pi, types, env); err != nil {
+		return Error(err)
+	}
+	return k(env)
+}
+
+func (vm *VM) declareSchema(pi procedureIndicator, types []Term, env *Env) error {
+	db := vm.database()
+	db.Lock()
+	defer db.Unlock()
+
+	if vm.procedures == nil {
+		vm.procedures = map[procedureIndicator]procedure{}
+	}
+	p, ok := vm.procedures[pi]
+	if !ok {
+		p = &userDefined{dynamic: true}
+		vm.procedures[pi] = p
+	}
+	u, ok := p.(*userDefined)
+	if !ok {
+		return permissionError(operationModify, permissionTypeStaticProcedure, pi.Term(), env)
+	}
+
+	var vs []Term
+	for _, c := range u.clauses {
+		vs = append(vs, schemaViolations(types, c.raw, nil)...)
+	}
+	if len(vs) > 0 {
+		return schemaError(vs, env)
+	}
+
+	u.schema = types
+	return nil
+}
+
+// factSchema returns the procedure indicator and the types of the arguments of schema.
+func factSchema(schema Term, env *Env) (procedureIndicator, []Term, error) {
+	switch s := env.Resolve(schema).(type) {
+	case Variable:
+		return procedureIndicator{}, nil, InstantiationError(env)
+	case Compound:
+		types := make([]Term, s.Arity())
+		for i := range types {
+			t := env.simplify(s.Arg(i))
+			if err := checkSchemaType(t, env); err != nil {
+				return procedureIndicator{}, nil, err
+			}
+			types[i] = t
+		}
+		return procedureIndicator{name: s.Functor(), arity: Integer(s.Arity())}, types, nil
+	default:
+		return procedureIndicator{}, nil, typeError(validTypeCompound, s, env)
+	}
+}
+
+func checkSchemaType(typ Term, env *Env) error {
+	switch t := env.Resolve(typ).(type) {
+	case Variable:
+		return InstantiationError(env)
+	case Atom:
+		switch t {
+		case atomAny, atomAtom, atomAtomic, atomBoolean, atomCallable, atomCompound, atomFloat, atomGround,
+			atomInteger, atomList, atomNonNeg, atomNumber, atomString, atomText:
+			return nil
+		}
+	case Compound:
+		switch {
+		case t.Functor() == atomList && t.Arity() == 1:
+			return checkSchemaType(t.Arg(0), env)
+		case t.Functor() == atomOneOf && t.Arity() == 1:
+			es, err := slice(t.Arg(0), env)
+			if err != nil {
+				return err
+			}
+			for _, e := range es {
+				if len(env.freeVariables(e)) > 0 {
+					return InstantiationError(env)
+				}
+			}
+			return nil
+		}
+	}
+	return domainError(validDomainSchemaType, typ, env)
+}
+
+// schemaViolations returns violation(Fact, N, Type, Culprit) for each argument of the fact which doesn't conform to
+// the types. Rules are not checked.
+func schemaViolations(types []Term, fact Term, env *Env) []Term {
+	if types == nil {
+		return nil
+	}
+
+	c, ok := env.Resolve(fact).(Compound)
+	if !ok {
+		return nil
+	}
+	if c.Functor() == atomIf && c.Arity() == 2 {
+		if env.Resolve(c.Arg(1)) != atomTrue {
+			return nil
+		}
+		if c, ok = env.Resolve(c.Arg(0)).(Compound); !ok {
+			return nil
+		}
+	}
+	if c.Arity() != len(types) {
+		return nil
+	}
+
+	var vs []Term
+	for i, typ := range types {
+		if a := c.Arg(i); !conforms(typ, a, env) {
+			vs = append(vs, atomViolation.Apply(env.simplify(c), Integer(i+1), typ, env.simplify(a)))
+		}
+	}
+	return vs
+}
+
+// conforms tells if t is of the type.
+func conforms(typ, t Term, env *Env) bool {
+	t = env.Resolve(t)
+	switch typ := env.Resolve(typ).(type) {
+	case Atom:
+		switch typ {
+		case atomAny:
+			return true
+		case atomAtom:
+			_, ok := t.(Atom)
+			return ok
+		case atomAtomic:
+			switch t.(type) {
+			case Variable, Compound:
+				return false
+			default:
+				return true
+			}
+		case atomBoolean:
+			return t == atomTrue || t == atomFalse
+		case atomCallable:
+			switch t.(type) {
+			case Atom, Compound:
+				return true
+			default:
+				return false
+			}
+		case atomCompound:
+			_, ok := t.(Compound)
+			return ok
+		case atomFloat:
+			_, ok := t.(Float)
+			return ok
+		case atomGround:
+			return len(env.freeVariables(t)) == 0
+		case atomInteger:
+			_, ok := t.(Integer)
+			return ok
+		case atomList:
+			_, err := slice(t, env)
+			return err == nil
+		case atomNonNeg:
+			i, ok := t.(Integer)
+			return ok && i >= 0
+		case atomNumber:
+			switch t.(type) {
+			case Integer, Float:
+				return true
+			default:
+				return false
+			}
+		case atomString:
+			_, ok := t.(String)
+			return ok
+		case atomText:
+			switch t.(type) {
+			case Integer, Float:
+				return false
+			}
+			_, err := textOf(t, env)
+			return err == nil
+		}
+	case Compound:
+		switch typ.Functor() {
+		case atomList:
+			es, err := slice(t, env)
+			if err != nil {
+				return false
+			}
+			for _, e := range es {
+				if !conforms(typ.Arg(0), e, env) {
+					return false
+				}
+			}
+			return true
+		case atomOneOf:
+			es, _ := slice(typ.Arg(0), env)
+			for _, e := range es {
+				if e.Compare(t, env) == 0 {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return false
+}
+
+func schemaError(violations []Term, env *Env) Exception {
+	return NewException(atomError.Apply(atomSchemaError.Apply(List(violations...)), varContext), env)
+}
+
+// schemaErrorLines translates the violations of schema_error(Violations) into human-readable lines.
+func schemaErrorLines(violations Term, w func(Term) string, env *Env) []string {
+	var lines []string
+	iter := ListIterator{List: violations, Env: env}
+	for iter.Next() {
+		v, ok := env.Resolve(iter.Current()).(Compound)
+		if !ok || v.Functor() != atomViolation || v.Arity() != 4 {
+			lines = append(lines, "Schema violation: "+w(iter.Current()))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("Schema violation: argument %s of %s: `%s' expected, found `%s'", w(v.Arg(1)), w(v.Arg(0)), w(v.Arg(2)), w(v.Arg(3))))
+	}
+	return lines
+}
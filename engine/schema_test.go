@@ -0,0 +1,174 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFactSchema(t *testing.T) {
+	user := NewAtom("user")
+	schema := user.Apply(atomAtom, atomInteger, atomOneOf.Apply(List(NewAtom("admin"), NewAtom("guest"))))
+
+	t.Run("ok", func(t *testing.T) {
+		var vm VM
+		ok, err := FactSchema(&vm, schema, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = Assertz(&vm, user.Apply(NewAtom("alice"), Integer(30), NewAtom("admin")), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = Assertz(&vm, user.Apply(NewAtom("bob"), NewAtom("thirty"), NewAtom("root")), Success, nil).Force(context.Background())
+		assert.Equal(t, schemaError([]Term{
+			atomViolation.Apply(user.Apply(NewAtom("bob"), NewAtom("thirty"), NewAtom("root")), Integer(2), atomInteger, NewAtom("thirty")),
+			atomViolation.Apply(user.Apply(NewAtom("bob"), NewAtom("thirty"), NewAtom("root")), Integer(3), atomOneOf.Apply(List(NewAtom("admin"), NewAtom("guest"))), NewAtom("root")),
+		}, nil), err)
+		assert.False(t, ok)
+
+		// Rules are not checked.
+		ok, err = Asserta(&vm, atomIf.Apply(user.Apply(NewVariable(), NewVariable(), NewVariable()), atomFail), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		u := vm.procedures[procedureIndicator{name: user, arity: 3}].(*userDefined)
+		assert.Len(t, u.clauses, 2)
+	})
+
+	t.Run("existing facts", func(t *testing.T) {
+		var vm VM
+		ok, err := Assertz(&vm, user.Apply(Integer(1), Integer(30), NewAtom("admin")), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = FactSchema(&vm, schema, Success, nil).Force(context.Background())
+		assert.Equal(t, schemaError([]Term{
+			atomViolation.Apply(user.Apply(Integer(1), Integer(30), NewAtom("admin")), Integer(1), atomAtom, Integer(1)),
+		}, nil), err)
+		assert.False(t, ok)
+
+		u := vm.procedures[procedureIndicator{name: user, arity: 3}].(*userDefined)
+		assert.Nil(t, u.schema)
+	})
+
+	t.Run("schema is a variable", func(t *testing.T) {
+		var vm VM
+		ok, err := FactSchema(&vm, NewVariable(), Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(nil), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("schema is not a compound", func(t *testing.T) {
+		var vm VM
+		ok, err := FactSchema(&vm, Integer(0), Success, nil).Force(context.Background())
+		assert.Equal(t, typeError(validTypeCompound, Integer(0), nil), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		var vm VM
+		ok, err := FactSchema(&vm, user.Apply(NewAtom("foo")), Success, nil).Force(context.Background())
+		assert.Equal(t, domainError(validDomainSchemaType, NewAtom("foo"), nil), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("builtin", func(t *testing.T) {
+		vm := VM{procedures: map[procedureIndicator]procedure{
+			{name: NewAtom("foo"), arity: 1}: Predicate1(func(_ *VM, _ Term, k Cont, env *Env) *Promise {
+				return k(env)
+			}),
+		}}
+		ok, err := FactSchema(&vm, NewAtom("foo").Apply(atomAtom), Success, nil).Force(context.Background())
+		assert.Equal(t, permissionError(operationModify, permissionTypeStaticProcedure, atomSlash.Apply(NewAtom("foo"), Integer(1)), nil), err)
+		assert.False(t, ok)
+	})
+}
+
+func TestVM_Compile_factSchema(t *testing.T) {
+	var vm VM
+	vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+	vm.operators.define(1200, operatorSpecifierFX, atomIf)
+	vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+	vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+
+	// Every violation in the text is reported at once and nothing is loaded.
+	err := vm.Compile(context.Background(), `
+:- fact_schema(user(atom, nonneg, list(atom))).
+user(alice, 30, [admin]).
+user(bob, -1, [guest]).
+user(carol, 40, [1]).
+`)
+	assert.Equal(t, schemaError([]Term{
+		atomViolation.Apply(NewAtom("user").Apply(NewAtom("bob"), Integer(-1), List(NewAtom("guest"))), Integer(2), atomNonNeg, Integer(-1)),
+		atomViolation.Apply(NewAtom("user").Apply(NewAtom("carol"), Integer(40), List(Integer(1))), Integer(3), atomList.Apply(atomAtom), List(Integer(1))),
+	}, nil), err)
+	_, ok := vm.procedures[procedureIndicator{name: NewAtom("user"), arity: 3}]
+	assert.False(t, ok)
+
+	assert.NoError(t, vm.Compile(context.Background(), `
+:- dynamic(user/3).
+:- fact_schema(user(atom, nonneg, list(atom))).
+user(alice, 30, [admin]).
+`))
+
+	// The schema stays with the procedure.
+	ok, err = Assertz(&vm, NewAtom("user").Apply(NewAtom("dave"), Float(1.5), List()), Success, nil).Force(context.Background())
+	assert.Equal(t, schemaError([]Term{
+		atomViolation.Apply(NewAtom("user").Apply(NewAtom("dave"), Float(1.5), atomEmptyList), Integer(2), atomNonNeg, Float(1.5)),
+	}, nil), err)
+	assert.False(t, ok)
+
+	// So does it in images.
+	var buf bytes.Buffer
+	assert.NoError(t, vm.SaveImage(&buf))
+	var loaded VM
+	assert.NoError(t, loaded.LoadImage(&buf))
+	u := loaded.procedures[procedureIndicator{name: NewAtom("user"), arity: 3}].(*userDefined)
+	assert.Equal(t, []Term{atomAtom, atomNonNeg, atomList.Apply(atomAtom)}, u.schema)
+}
+
+func TestConforms(t *testing.T) {
+	tests := []struct {
+		typ, t Term
+		ok     bool
+	}{
+		{typ: atomAny, t: NewVariable(), ok: true},
+		{typ: atomAtom, t: NewAtom("a"), ok: true},
+		{typ: atomAtom, t: String("a"), ok: false},
+		{typ: atomAtomic, t: Float(1), ok: true},
+		{typ: atomAtomic, t: NewAtom("f").Apply(NewAtom("a")), ok: false},
+		{typ: atomBoolean, t: atomTrue, ok: true},
+		{typ: atomBoolean, t: NewAtom("yes"), ok: false},
+		{typ: atomCallable, t: NewAtom("a"), ok: true},
+		{typ: atomCallable, t: Integer(1), ok: false},
+		{typ: atomCompound, t: NewAtom("f").Apply(NewAtom("a")), ok: true},
+		{typ: atomCompound, t: NewAtom("a"), ok: false},
+		{typ: atomFloat, t: Float(1), ok: true},
+		{typ: atomFloat, t: Integer(1), ok: false},
+		{typ: atomGround, t: NewAtom("f").Apply(NewAtom("a")), ok: true},
+		{typ: atomGround, t: NewAtom("f").Apply(NewVariable()), ok: false},
+		{typ: atomInteger, t: Integer(1), ok: true},
+		{typ: atomInteger, t: Float(1), ok: false},
+		{typ: atomList, t: List(Integer(1)), ok: true},
+		{typ: atomList, t: PartialList(NewVariable(), Integer(1)), ok: false},
+		{typ: atomNonNeg, t: Integer(0), ok: true},
+		{typ: atomNonNeg, t: Integer(-1), ok: false},
+		{typ: atomNumber, t: Integer(1), ok: true},
+		{typ: atomNumber, t: NewAtom("1"), ok: false},
+		{typ: atomString, t: String("a"), ok: true},
+		{typ: atomString, t: NewAtom("a"), ok: false},
+		{typ: atomText, t: CharList("a"), ok: true},
+		{typ: atomText, t: Integer(1), ok: false},
+		{typ: atomList.Apply(atomInteger), t: List(Integer(1), Integer(2)), ok: true},
+		{typ: atomList.Apply(atomInteger), t: List(Integer(1), NewAtom("a")), ok: false},
+		{typ: atomOneOf.Apply(List(Integer(1), Integer(2))), t: Integer(2), ok: true},
+		{typ: atomOneOf.Apply(List(Integer(1), Integer(2))), t: Integer(3), ok: false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.ok, conforms(tt.typ, tt.t, nil), "%s: %s", tt.typ, tt.t)
+	}
+}
@@ -0,0 +1,275 @@
+package engine
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var quotedStringEscapePattern = regexp.MustCompile(`[[:cntrl:]]|\\|"`)
+
+// String is a prolog string. Unlike character lists and code lists, it's atomic and holds the text as it is.
+type String string
+
+// WriteTerm outputs the String to an io.Writer.
+func (s String) WriteTerm(w io.Writer, opts *WriteOptions, _ *Env) error {
+	ew := errWriter{w: w}
+	if opts.quoted {
+		_, _ = ew.Write([]byte(`"`))
+		_, _ = ew.Write([]byte(quotedStringEscapePattern.ReplaceAllStringFunc(string(s), quotedIdentEscape)))
+		_, _ = ew.Write([]byte(`"`))
+	} else {
+		_, _ = ew.Write([]byte(s))
+	}
+	return ew.err
+}
+
+// Compare compares the String with a Term.
+func (s String) Compare(t Term, env *Env) int {
+	return CompareAtomic[String](s, t, func(s String, t String) int {
+		return strings.Compare(string(s), string(t))
+	}, env)
+}
+
+func (s String) String() string {
+	return string(s)
+}
+
+// TypeString checks if t is a string.
+func TypeString(_ *VM, t Term, k Cont, env *Env) *Promise {
+	if _, ok := env.Resolve(t).(String); !ok {
+		return Bool(false)
+	}
+	return k(env)
+}
+
+// StringConcat concatenates the texts of string1 and string2 and unifies it with string3 as a string.
+// If either string1 or string2 is not instantiated, it enumerates the splits of string3.
+func StringConcat(vm *VM, string1, string2, string3 Term, k Cont, env *Env) *Promise {
+	_, ok1 := env.Resolve(string1).(Variable)
+	_, ok2 := env.Resolve(string2).(Variable)
+	if !ok1 && !ok2 {
+		s1, err := textOf(string1, env)
+		if err != nil {
+			return Error(err)
+		}
+		s2, err := textOf(string2, env)
+		if err != nil {
+			return Error(err)
+		}
+		return Unify(vm, string3, String(s1+s2), k, env)
+	}
+
+	s3, err := textOf(string3, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	pattern := tuple(string1, string2)
+	ks := make([]func(context.Context) *Promise, 0, len(s3)+1)
+	for i := range s3 {
+		a, b := s3[:i], s3[i:]
+		ks = append(ks, func(context.Context) *Promise {
+			return Unify(vm, pattern, tuple(String(a), String(b)), k, env)
+		})
+	}
+	ks = append(ks, func(context.Context) *Promise {
+		return Unify(vm, pattern, tuple(String(s3), String("")), k, env)
+	})
+	return Delay(ks...)
+}
+
+// SplitString breaks str into substrings at any of the characters in sepChars
+// and removes any of the characters in padChars from both ends of the substrings.
+func SplitString(vm *VM, str, sepChars, padChars, subStrings Term, k Cont, env *Env) *Promise {
+	s, err := textOf(str, env)
+	if err != nil {
+		return Error(err)
+	}
+	sep, err := textOf(sepChars, env)
+	if err != nil {
+		return Error(err)
+	}
+	pad, err := textOf(padChars, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	subs := []string{s}
+	if sep != "" {
+		subs = subs[:0]
+		var start int
+		for i, r := range s {
+			if strings.ContainsRune(sep, r) {
+				subs = append(subs, s[start:i])
+				start = i + utf8.RuneLen(r)
+			}
+		}
+		subs = append(subs, s[start:])
+	}
+
+	ts := make([]Term, len(subs))
+	for i, sub := range subs {
+		ts[i] = String(strings.Trim(sub, pad))
+	}
+	return Unify(vm, subStrings, List(ts...), k, env)
+}
+
+// StringCode unifies code with the character code at the 1-based index of str.
+// It fails if index is out of range.
+func StringCode(vm *VM, index, str, code Term, k Cont, env *Env) *Promise {
+	var n Integer
+	switch i := env.Resolve(index).(type) {
+	case Variable:
+		return Error(InstantiationError(env))
+	case Integer:
+		n = i
+	default:
+		return Error(typeError(validTypeInteger, index, env))
+	}
+
+	s, err := textOf(str, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	if n < 1 {
+		return Bool(false)
+	}
+	for _, r := range s {
+		n--
+		if n == 0 {
+			return Unify(vm, code, Integer(r), k, env)
+		}
+	}
+	return Bool(false)
+}
+
+// StringChars converts between str and a list of characters.
+func StringChars(vm *VM, str, chars Term, k Cont, env *Env) *Promise {
+	if _, ok := env.Resolve(str).(Variable); !ok {
+		s, err := textOf(str, env)
+		if err != nil {
+			return Error(err)
+		}
+		return Unify(vm, chars, CharList(s), k, env)
+	}
+
+	s, err := textOf(chars, env)
+	if err != nil {
+		return Error(err)
+	}
+	return Unify(vm, str, String(s), k, env)
+}
+
+// StringCodes converts between str and a list of character codes.
+func StringCodes(vm *VM, str, codes Term, k Cont, env *Env) *Promise {
+	if _, ok := env.Resolve(str).(Variable); !ok {
+		s, err := textOf(str, env)
+		if err != nil {
+			return Error(err)
+		}
+		return Unify(vm, codes, CodeList(s), k, env)
+	}
+
+	s, err := textOf(codes, env)
+	if err != nil {
+		return Error(err)
+	}
+	return Unify(vm, str, String(s), k, env)
+}
+
+// StringLength unifies length with the number of characters in str.
+func StringLength(vm *VM, str, length Term, k Cont, env *Env) *Promise {
+	s, err := textOf(str, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	switch l := env.Resolve(length).(type) {
+	case Variable:
+		break
+	case Integer:
+		if l < 0 {
+			return Error(domainError(validDomainNotLessThanZero, length, env))
+		}
+	default:
+		return Error(typeError(validTypeInteger, length, env))
+	}
+
+	return Unify(vm, length, Integer(utf8.RuneCountInString(s)), k, env)
+}
+
+// AtomString converts between atom and str.
+func AtomString(vm *VM, atom, str Term, k Cont, env *Env) *Promise {
+	if _, ok := env.Resolve(atom).(Variable); !ok {
+		s, err := textOf(atom, env)
+		if err != nil {
+			return Error(err)
+		}
+		return Unify(vm, str, String(s), k, env)
+	}
+
+	s, err := textOf(str, env)
+	if err != nil {
+		return Error(err)
+	}
+	return Unify(vm, atom, newAtom(s, env), k, env)
+}
+
+// textOf returns the text of t which is either an atom, a string, a number, a list of characters, or a list of codes.
+func textOf(t Term, env *Env) (string, error) {
+	switch t := env.Resolve(t).(type) {
+	case Variable:
+		return "", InstantiationError(env)
+	case Atom:
+		if t == atomEmptyList {
+			return "", nil
+		}
+		return t.String(), nil
+	case String:
+		return string(t), nil
+	case Integer, Float:
+		var sb strings.Builder
+		if err := t.WriteTerm(&sb, &defaultWriteOptions, env); err != nil {
+			return "", err
+		}
+		return sb.String(), nil
+	case charList:
+		return string(t), nil
+	case codeList:
+		return string(t), nil
+	case Compound:
+		if t.Functor() != atomDot || t.Arity() != 2 {
+			return "", typeError(validTypeText, t, env)
+		}
+		var sb strings.Builder
+		iter := ListIterator{List: t, Env: env}
+		for iter.Next() {
+			switch e := env.Resolve(iter.Current()).(type) {
+			case Variable:
+				return "", InstantiationError(env)
+			case Atom:
+				if utf8.RuneCountInString(e.String()) != 1 {
+					return "", typeError(validTypeText, t, env)
+				}
+				_, _ = sb.WriteString(e.String())
+			case Integer:
+				if e < 0 || e > utf8.MaxRune {
+					return "", representationError(flagCharacterCode, env)
+				}
+				_, _ = sb.WriteRune(rune(e))
+			default:
+				return "", typeError(validTypeText, t, env)
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return "", err
+		}
+		return sb.String(), nil
+	default:
+		return "", typeError(validTypeText, t, env)
+	}
+}
@@ -0,0 +1,245 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestString_WriteTerm(t *testing.T) {
+	tests := []struct {
+		title  string
+		s      String
+		opts   WriteOptions
+		output string
+	}{
+		{title: "unquoted", s: `say "hi"`, output: `say "hi"`},
+		{title: "quoted", s: `say "hi"`, opts: WriteOptions{quoted: true}, output: `"say \"hi\""`},
+		{title: "quoted: escape", s: "a\nb\\", opts: WriteOptions{quoted: true}, output: `"a\nb\\"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			var buf bytes.Buffer
+			assert.NoError(t, tt.s.WriteTerm(&buf, &tt.opts, nil))
+			assert.Equal(t, tt.output, buf.String())
+		})
+	}
+}
+
+func TestString_Compare(t *testing.T) {
+	tests := []struct {
+		title string
+		s     String
+		t     Term
+		o     int
+	}{
+		{title: `"b" > X`, s: "b", t: NewVariable(), o: 1},
+		{title: `"b" > 1`, s: "b", t: Integer(1), o: 1},
+		{title: `"b" > b`, s: "b", t: NewAtom("b"), o: 1},
+		{title: `"b" > "a"`, s: "b", t: String("a"), o: 1},
+		{title: `"b" = "b"`, s: "b", t: String("b"), o: 0},
+		{title: `"b" < "c"`, s: "b", t: String("c"), o: -1},
+		{title: `"b" < f(a)`, s: "b", t: NewAtom("f").Apply(NewAtom("a")), o: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			assert.Equal(t, tt.o, tt.s.Compare(tt.t, nil))
+		})
+	}
+}
+
+func TestTypeString(t *testing.T) {
+	ok, err := TypeString(nil, String("foo"), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = TypeString(nil, NewAtom("foo"), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestStringConcat(t *testing.T) {
+	x, y := NewVariable(), NewVariable()
+
+	t.Run("concat", func(t *testing.T) {
+		tests := []struct {
+			title                     string
+			string1, string2, string3 Term
+			ok                        bool
+			err                       error
+			result                    Term
+		}{
+			{title: "strings", string1: String("abc"), string2: String("def"), string3: x, ok: true, result: String("abcdef")},
+			{title: "atom and codes", string1: NewAtom("abc"), string2: CodeList("def"), string3: x, ok: true, result: String("abcdef")},
+			{title: "number", string1: Integer(1), string2: Float(2.5), string3: x, ok: true, result: String("12.5")},
+			{title: "check", string1: String("abc"), string2: String("def"), string3: String("abcxyz"), ok: false},
+			{title: "not text", string1: NewAtom("f").Apply(NewAtom("a")), string2: String("def"), string3: x, err: typeError(validTypeText, NewAtom("f").Apply(NewAtom("a")), nil)},
+			{title: "instantiation", string1: x, string2: y, string3: NewVariable(), err: InstantiationError(nil)},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.title, func(t *testing.T) {
+				ok, err := StringConcat(nil, tt.string1, tt.string2, tt.string3, func(env *Env) *Promise {
+					assert.Equal(t, tt.result, env.Resolve(x))
+					return Bool(true)
+				}, nil).Force(context.Background())
+				assert.Equal(t, tt.ok, ok)
+				assert.Equal(t, tt.err, err)
+			})
+		}
+	})
+
+	t.Run("split", func(t *testing.T) {
+		var ret [][2]Term
+		ok, err := StringConcat(nil, x, y, String("ab"), func(env *Env) *Promise {
+			ret = append(ret, [2]Term{env.Resolve(x), env.Resolve(y)})
+			return Bool(false)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, [][2]Term{
+			{String(""), String("ab")},
+			{String("a"), String("b")},
+			{String("ab"), String("")},
+		}, ret)
+	})
+}
+
+func TestSplitString(t *testing.T) {
+	subs := NewVariable()
+
+	tests := []struct {
+		title              string
+		str, sepChars, pad Term
+		err                error
+		result             Term
+	}{
+		{title: "fields", str: String("a.b.c.d"), sepChars: String("."), pad: String(""), result: List(String("a"), String("b"), String("c"), String("d"))},
+		{title: "padded", str: String("/home//jan///nice/path"), sepChars: String("/"), pad: String(""), result: List(String(""), String("home"), String(""), String("jan"), String(""), String(""), String("nice"), String("path"))},
+		{title: "trim", str: String("  a word "), sepChars: String(""), pad: String(" "), result: List(String("a word"))},
+		{title: "split and trim", str: String("SWI-Prolog, 7.0"), sepChars: String(","), pad: String(" "), result: List(String("SWI-Prolog"), String("7.0"))},
+		{title: "empty", str: String(""), sepChars: String(""), pad: String(""), result: List(String(""))},
+		{title: "instantiation", str: NewVariable(), sepChars: String(""), pad: String(""), err: InstantiationError(nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			ok, err := SplitString(nil, tt.str, tt.sepChars, tt.pad, subs, func(env *Env) *Promise {
+				assert.Equal(t, tt.result, env.Resolve(subs))
+				return Bool(true)
+			}, nil).Force(context.Background())
+			assert.Equal(t, tt.err == nil, ok)
+			assert.Equal(t, tt.err, err)
+		})
+	}
+}
+
+func TestStringCode(t *testing.T) {
+	code := NewVariable()
+
+	tests := []struct {
+		title      string
+		index, str Term
+		ok         bool
+		err        error
+		result     Term
+	}{
+		{title: "first", index: Integer(1), str: String("abc"), ok: true, result: Integer('a')},
+		{title: "last", index: Integer(3), str: String("abc"), ok: true, result: Integer('c')},
+		{title: "multibyte", index: Integer(2), str: String("αβγ"), ok: true, result: Integer('β')},
+		{title: "zero", index: Integer(0), str: String("abc"), ok: false},
+		{title: "out of range", index: Integer(4), str: String("abc"), ok: false},
+		{title: "index is variable", index: NewVariable(), str: String("abc"), err: InstantiationError(nil)},
+		{title: "index is not integer", index: NewAtom("a"), str: String("abc"), err: typeError(validTypeInteger, NewAtom("a"), nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			ok, err := StringCode(nil, tt.index, tt.str, code, func(env *Env) *Promise {
+				assert.Equal(t, tt.result, env.Resolve(code))
+				return Bool(true)
+			}, nil).Force(context.Background())
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.err, err)
+		})
+	}
+}
+
+func TestStringChars(t *testing.T) {
+	x := NewVariable()
+
+	ok, err := StringChars(nil, String("ab"), x, func(env *Env) *Promise {
+		assert.Equal(t, CharList("ab"), env.Resolve(x))
+		return Bool(true)
+	}, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = StringChars(nil, x, List(NewAtom("a"), NewAtom("b")), func(env *Env) *Promise {
+		assert.Equal(t, String("ab"), env.Resolve(x))
+		return Bool(true)
+	}, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	_, err = StringChars(nil, x, NewVariable(), Success, nil).Force(context.Background())
+	assert.Equal(t, InstantiationError(nil), err)
+}
+
+func TestStringCodes(t *testing.T) {
+	x := NewVariable()
+
+	ok, err := StringCodes(nil, String("ab"), x, func(env *Env) *Promise {
+		assert.Equal(t, CodeList("ab"), env.Resolve(x))
+		return Bool(true)
+	}, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = StringCodes(nil, x, List(Integer('a'), Integer('b')), func(env *Env) *Promise {
+		assert.Equal(t, String("ab"), env.Resolve(x))
+		return Bool(true)
+	}, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	_, err = StringCodes(nil, x, List(Integer(-1)), Success, nil).Force(context.Background())
+	assert.Equal(t, representationError(flagCharacterCode, nil), err)
+}
+
+func TestStringLength(t *testing.T) {
+	ok, err := StringLength(nil, String("αβγ"), Integer(3), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	_, err = StringLength(nil, String("abc"), Integer(-1), Success, nil).Force(context.Background())
+	assert.Equal(t, domainError(validDomainNotLessThanZero, Integer(-1), nil), err)
+
+	_, err = StringLength(nil, String("abc"), NewAtom("3"), Success, nil).Force(context.Background())
+	assert.Equal(t, typeError(validTypeInteger, NewAtom("3"), nil), err)
+}
+
+func TestAtomString(t *testing.T) {
+	x := NewVariable()
+
+	ok, err := AtomString(nil, NewAtom("abc"), x, func(env *Env) *Promise {
+		assert.Equal(t, String("abc"), env.Resolve(x))
+		return Bool(true)
+	}, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = AtomString(nil, x, String("abc"), func(env *Env) *Promise {
+		assert.Equal(t, NewAtom("abc"), env.Resolve(x))
+		return Bool(true)
+	}, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	_, err = AtomString(nil, x, NewVariable(), Success, nil).Force(context.Background())
+	assert.Equal(t, InstantiationError(nil), err)
+}
@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+// NewTeeStream returns a stream which reads from or writes to s and copies the data to w.
+// The new stream has the same mode and type as s. An input stream copies the data as it reads them from s in chunks.
+// Closing the new stream flushes w if it has Flush() error method but closes neither s nor w.
+func NewTeeStream(s *Stream, w io.Writer) *Stream {
+	t := &tee{stream: s, w: w}
+	ts := Stream{
+		vm:         s.vm,
+		mode:       s.mode,
+		eofAction:  s.eofAction,
+		streamType: s.streamType,
+	}
+	if s.mode == ioModeRead {
+		ts.source = t
+	} else {
+		ts.sink = t
+	}
+	return &ts
+}
+
+// tee is the source/sink of a stream made by NewTeeStream.
+type tee struct {
+	stream *Stream
+	w      io.Writer
+}
+
+func (t *tee) Read(p []byte) (int, error) {
+	s := t.stream
+	if err := s.initRead(); err != nil {
+		return 0, err
+	}
+	n, err := s.buf.Read(p)
+	s.position += int64(n)
+	s.checkEOS(err)
+	if n > 0 {
+		if _, err := t.w.Write(p[:n]); err != nil {
+			return n, err
+		}
+	}
+	return n, err
+}
+
+func (t *tee) Write(p []byte) (int, error) {
+	n, err := streamWriter{stream: t.stream}.Write(p)
+	if n > 0 {
+		if _, err := t.w.Write(p[:n]); err != nil {
+			return n, err
+		}
+	}
+	return n, err
+}
+
+func (t *tee) Flush() error {
+	if t.stream.mode != ioModeRead {
+		if err := t.stream.Flush(); err != nil {
+			return err
+		}
+	}
+	if f, ok := t.w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (t *tee) Close() error {
+	return t.Flush()
+}
+
+// streamWriter writes to the sink of an output stream regardless of its type.
+type streamWriter struct {
+	stream *Stream
+}
+
+func (w streamWriter) Write(p []byte) (int, error) {
+	s := w.stream
+	if s.mode != ioModeWrite && s.mode != ioModeAppend {
+		return 0, errWrongIOMode
+	}
+	n, err := s.sink.Write(p)
+	s.position += int64(n)
+	return n, err
+}
+
+func (w streamWriter) Flush() error {
+	return w.stream.Flush()
+}
+
+// TeeStream unifies tee with a new stream which reads from or writes to the stream streamOrAlias and copies the data
+// to the output stream mirrorOrAlias e.g. a log file. Closing tee closes neither of them.
+func TeeStream(vm *VM, streamOrAlias, mirrorOrAlias, tee Term, k Cont, env *Env) *Promise {
+	s, err := stream(vm, streamOrAlias, env)
+	if err != nil {
+		return Error(err)
+	}
+	m, err := stream(vm, mirrorOrAlias, env)
+	if err != nil {
+		return Error(err)
+	}
+	if m.mode != ioModeWrite && m.mode != ioModeAppend {
+		return Error(permissionError(operationOutput, permissionTypeStream, mirrorOrAlias, env))
+	}
+	if _, ok := env.Resolve(tee).(Variable); !ok {
+		return Error(InstantiationError(env))
+	}
+	return Unify(vm, tee, NewTeeStream(s, streamWriter{stream: m}), k, env)
+}
+
+// LogStream unifies logged with a new stream which reads from or writes to the stream streamOrAlias and reports every
+// line of the data as a message stream_line(Stream, Direction, Line) of the informational severity where Stream is the
+// alias of the stream if any, Direction is input or output, and Line is a string.
+// The messages go to message_hook/3 or VM.OnMessage e.g. a Go logger.
+// The last line without a newline is reported when logged is closed.
+func LogStream(vm *VM, streamOrAlias, logged Term, k Cont, env *Env) *Promise {
+	s, err := stream(vm, streamOrAlias, env)
+	if err != nil {
+		return Error(err)
+	}
+	if _, ok := env.Resolve(logged).(Variable); !ok {
+		return Error(InstantiationError(env))
+	}
+	var id Term = s
+	if s.alias != 0 {
+		id = s.alias
+	}
+	dir := atomInput
+	if s.mode != ioModeRead {
+		dir = atomOutput
+	}
+	return Unify(vm, logged, NewTeeStream(s, &lineWriter{f: func(line string) {
+		vm.message(context.Background(), SeverityInformational, atomStreamLine.Apply(id, dir, String(line)))
+	}}), k, env)
+}
+
+// lineWriter calls f with every line written to it without the newline, either LF or CRLF.
+type lineWriter struct {
+	f   func(line string)
+	buf bytes.Buffer
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	_, _ = w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		line := w.buf.Next(i + 1)
+		w.f(string(bytes.TrimSuffix(line[:i], []byte("\r"))))
+	}
+	return len(p), nil
+}
+
+// Flush calls f with the incomplete line if any.
+func (w *lineWriter) Flush() error {
+	if w.buf.Len() > 0 {
+		w.f(w.buf.String())
+		w.buf.Reset()
+	}
+	return nil
+}
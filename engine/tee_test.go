@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTeeStream(t *testing.T) {
+	t.Run("input", func(t *testing.T) {
+		var mirror bytes.Buffer
+		s := NewInputTextStream(strings.NewReader("abc"))
+		ts := NewTeeStream(s, &mirror)
+
+		r, _, err := ts.ReadRune()
+		assert.NoError(t, err)
+		assert.Equal(t, 'a', r)
+		assert.Equal(t, "abc", mirror.String())
+		r, _, err = ts.ReadRune()
+		assert.NoError(t, err)
+		assert.Equal(t, 'b', r)
+		r, _, err = ts.ReadRune()
+		assert.NoError(t, err)
+		assert.Equal(t, 'c', r)
+		_, _, err = ts.ReadRune()
+		assert.Equal(t, io.EOF, err)
+
+		assert.Equal(t, "abc", mirror.String())
+		assert.Equal(t, int64(3), s.position)
+		assert.Equal(t, endOfStreamPast, s.endOfStream)
+	})
+
+	t.Run("output", func(t *testing.T) {
+		var sink, mirror bytes.Buffer
+		s := NewOutputBinaryStream(&sink)
+		ts := NewTeeStream(s, &mirror)
+		assert.NoError(t, ts.WriteByte(1))
+		assert.NoError(t, ts.WriteByte(2))
+		assert.Equal(t, []byte{1, 2}, sink.Bytes())
+		assert.Equal(t, []byte{1, 2}, mirror.Bytes())
+		assert.Equal(t, int64(2), s.position)
+
+		// Closing the tee doesn't close the others.
+		assert.NoError(t, ts.Close())
+		assert.False(t, s.closed)
+	})
+}
+
+func TestTeeStream(t *testing.T) {
+	var vm VM
+	var sink, mirror bytes.Buffer
+	s := &Stream{vm: &vm, sink: &sink, mode: ioModeWrite, alias: NewAtom("tee_stream_output")}
+	vm.streams.add(s)
+	m := &Stream{vm: &vm, sink: &mirror, mode: ioModeAppend}
+	in := NewInputTextStream(strings.NewReader(""))
+
+	t.Run("ok", func(t *testing.T) {
+		tee := NewVariable()
+		ok, err := TeeStream(&vm, NewAtom("tee_stream_output"), m, tee, func(env *Env) *Promise {
+			ts, ok := env.Resolve(tee).(*Stream)
+			assert.True(t, ok)
+			w, err := ts.textWriter()
+			assert.NoError(t, err)
+			_, err = w.Write([]byte("hello\n"))
+			assert.NoError(t, err)
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "hello\n", sink.String())
+		assert.Equal(t, "hello\n", mirror.String())
+	})
+
+	t.Run("stream is a variable", func(t *testing.T) {
+		_, err := TeeStream(&vm, NewVariable(), m, NewVariable(), Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(nil), err)
+	})
+
+	t.Run("mirror is an input stream", func(t *testing.T) {
+		_, err := TeeStream(&vm, s, in, NewVariable(), Success, nil).Force(context.Background())
+		assert.Equal(t, permissionError(operationOutput, permissionTypeStream, in, nil), err)
+	})
+
+	t.Run("tee is not a variable", func(t *testing.T) {
+		_, err := TeeStream(&vm, s, m, NewAtom("foo"), Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(nil), err)
+	})
+}
+
+func TestLogStream(t *testing.T) {
+	var (
+		vm    VM
+		terms []Term
+		lines []string
+	)
+	vm.OnMessage = func(severity Severity, term Term, ls []string) {
+		assert.Equal(t, SeverityInformational, severity)
+		terms = append(terms, term)
+		lines = append(lines, ls...)
+	}
+	s := &Stream{vm: &vm, source: strings.NewReader("HELO\r\nQUIT"), mode: ioModeRead, alias: NewAtom("smtp")}
+	vm.streams.add(s)
+
+	logged := NewVariable()
+	ok, err := LogStream(&vm, NewAtom("smtp"), logged, func(env *Env) *Promise {
+		ls := env.Resolve(logged).(*Stream)
+		var sb strings.Builder
+		for {
+			r, _, err := ls.ReadRune()
+			if err != nil {
+				break
+			}
+			_, _ = sb.WriteRune(r)
+		}
+		assert.Equal(t, "HELO\r\nQUIT", sb.String())
+		assert.NoError(t, ls.Close())
+		return Bool(true)
+	}, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []Term{
+		atomStreamLine.Apply(NewAtom("smtp"), atomInput, String("HELO")),
+		atomStreamLine.Apply(NewAtom("smtp"), atomInput, String("QUIT")),
+	}, terms)
+	assert.Equal(t, []string{"smtp input: HELO", "smtp input: QUIT"}, lines)
+
+	t.Run("logged is not a variable", func(t *testing.T) {
+		_, err := LogStream(&vm, s, NewAtom("foo"), Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(nil), err)
+	})
+}
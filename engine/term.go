@@ -104,3 +104,25 @@ func id(t Term) termID {
 		return t // Assuming it's comparable.
 	}
 }
+
+// Key is a comparable representation of a ground term so that Go code can use terms as keys of maps.
+// The keys of two terms are equal iff the terms are identical in the sense of ==/2. See TermKey.
+// A Key is valid only in the process which made it since atoms are interned differently in each process.
+type Key struct {
+	s string
+}
+
+// TermKey returns the Key of the ground term t.
+// It returns an instantiation error if t contains a variable, and an error if t contains a custom atomic term which has
+// no canonical representation. Any depth of t is fine including a long list.
+func TermKey(t Term) (Key, error) {
+	var sb strings.Builder
+	switch c := writeTermKey(&sb, t, nil, nil).(type) {
+	case nil:
+		return Key{s: sb.String()}, nil
+	case Variable:
+		return Key{}, InstantiationError(nil)
+	default:
+		return Key{}, fmt.Errorf("no term key for %T", c)
+	}
+}
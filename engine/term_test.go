@@ -61,3 +61,73 @@ func TestCompareAtomic(t *testing.T) {
 		assert.Equal(t, tt.o, CompareAtomic[*y](tt.a, tt.t, tt.cmp, nil))
 	}
 }
+
+func TestTermKey(t *testing.T) {
+	foo := NewAtom("foo")
+	keys := func(ts ...Term) []Key {
+		ks := make([]Key, len(ts))
+		for i, term := range ts {
+			k, err := TermKey(term)
+			assert.NoError(t, err)
+			ks[i] = k
+		}
+		return ks
+	}
+
+	ks := keys(
+		foo,
+		NewAtom("bar"),
+		Integer(1),
+		Float(1),
+		String("foo"),
+		foo.Apply(Integer(1)),
+		foo.Apply(Integer(1), Integer(2)),
+		foo.Apply(foo.Apply(Integer(1)), Integer(2)),
+		foo.Apply(foo.Apply(Integer(1), Integer(2))),
+		List(Integer(1), Integer(2)),
+		List(List(Integer(1)), Integer(2)),
+	)
+	m := map[Key]int{}
+	for i, k := range ks {
+		m[k] = i
+	}
+	assert.Len(t, m, len(ks))
+
+	// The terms identical to the ones above have the same keys even if they're built differently.
+	for i, k := range keys(
+		NewAtom("foo"),
+		NewAtom("bar"),
+		Integer(1),
+		Float(1.0),
+		String("foo"),
+		NewAtom("foo").Apply(Integer(1)),
+		NewAtom("foo").Apply(Integer(1), Integer(2)),
+		foo.Apply(foo.Apply(Integer(1)), Integer(2)),
+		foo.Apply(foo.Apply(Integer(1), Integer(2))),
+		PartialList(List(Integer(2)), Integer(1)),
+		List(CodeList("\x01"), Integer(2)),
+	) {
+		n, ok := m[k]
+		assert.True(t, ok)
+		assert.Equal(t, i, n)
+	}
+
+	t.Run("deep", func(t *testing.T) {
+		l := make([]Term, 1000000)
+		for i := range l {
+			l[i] = Integer(i)
+		}
+		_, err := TermKey(List(l...))
+		assert.NoError(t, err)
+	})
+
+	t.Run("variable", func(t *testing.T) {
+		_, err := TermKey(foo.Apply(NewVariable()))
+		assert.Equal(t, InstantiationError(nil), err)
+	})
+
+	t.Run("custom atomic term", func(t *testing.T) {
+		_, err := TermKey(foo.Apply(&mockTerm{}))
+		assert.EqualError(t, err, "no term key for *engine.mockTerm")
+	})
+}
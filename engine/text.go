@@ -27,16 +27,13 @@ func (vm *VM) Compile(ctx context.Context, s string, args ...interface{}) error
 		return err
 	}
 
-	if vm.procedures == nil {
-		vm.procedures = map[procedureIndicator]procedure{}
+	// Report all the facts which don't conform to their schemas at once rather than one by one.
+	if len(t.violations) > 0 {
+		return schemaError(t.violations, nil)
 	}
-	for pi, u := range t.clauses {
-		if existing, ok := vm.procedures[pi].(*userDefined); ok && existing.multifile && u.multifile {
-			existing.clauses = append(existing.clauses, u.clauses...)
-			continue
-		}
 
-		vm.procedures[pi] = u
+	if err := vm.mergeText(&t); err != nil {
+		return err
 	}
 
 	for _, g := range t.goals {
@@ -45,16 +42,58 @@ func (vm *VM) Compile(ctx context.Context, s string, args ...interface{}) error
 			return err
 		}
 		if !ok {
+			vm.message(ctx, SeverityError, atomGoalFailed.Apply(atomInitialization, g))
 			var sb strings.Builder
 			s := NewOutputTextStream(&sb)
 			_, _ = WriteTerm(vm, s, g, List(atomQuoted.Apply(atomTrue)), Success, nil).Force(ctx)
 			return fmt.Errorf("failed initialization goal: %s", sb.String())
 		}
+		db := vm.database()
+		db.Lock()
+		vm.initialization = append(vm.initialization, g)
+		db.Unlock()
 	}
 
 	return nil
 }
 
+// mergeText adds the procedures of t to the database.
+func (vm *VM) mergeText(t *text) error {
+	db := vm.database()
+	db.Lock()
+	defer db.Unlock()
+
+	if vm.procedures == nil {
+		vm.procedures = map[procedureIndicator]procedure{}
+	}
+	var (
+		n    int
+		size int64
+	)
+	for pi, u := range t.clauses {
+		n, size = n+len(u.clauses), size+u.clauses.size()
+		if existing, ok := vm.procedures[pi].(*userDefined); ok && !(existing.multifile && u.multifile) {
+			n, size = n-len(existing.clauses), size-existing.clauses.size()
+		}
+	}
+	if err := vm.allocClauses(n, size, nil); err != nil {
+		return err
+	}
+	for pi, u := range t.clauses {
+		if existing, ok := vm.procedures[pi].(*userDefined); ok && existing.multifile && u.multifile {
+			existing.clauses = append(existing.clauses, u.clauses...)
+			existing.generation++
+			existing.indexes = append(existing.indexes, u.indexes...)
+			existing.invalidateIndexes()
+			continue
+		}
+
+		vm.procedures[pi] = u
+	}
+	vm.invalidatePurity()
+	return nil
+}
+
 // Consult executes Prolog texts in files.
 func Consult(vm *VM, files Term, k Cont, env *Env) *Promise {
 	var filenames []Term
@@ -82,14 +121,18 @@ func (vm *VM) compile(ctx context.Context, text *text, s string, args ...interfa
 		text.clauses = map[procedureIndicator]*userDefined{}
 	}
 
-	s = ignoreShebangLine(s)
-	p := NewParser(vm, strings.NewReader(s))
+	// An included text starts in the default encoding and doesn't change the encoding of the including text.
+	defer func(d *decoder) {
+		text.decoder = d
+	}(text.decoder)
+	text.decoder = &decoder{s: ignoreShebangLine(s), enc: vm.encoding}
+	p := NewParser(vm, text.decoder)
 	if err := p.SetPlaceholder(NewAtom("?"), args...); err != nil {
 		return err
 	}
 
 	for p.More() {
-		p.Vars = p.Vars[:]
+		p.doubleQuotes = vm.doubleQuotes // A directive may have changed the flag.
 		t, err := p.Term()
 		if err != nil {
 			return err
@@ -115,6 +158,11 @@ func (vm *VM) compile(ctx context.Context, text *text, s string, args ...interfa
 			if err != nil {
 				return err
 			}
+			if vm.floundering {
+				for _, w := range Floundering(et, p.Vars) {
+					vm.message(ctx, SeverityWarning, w)
+				}
+			}
 			fallthrough
 		default:
 			if len(text.buf) > 0 && pi != text.buf[0].pi {
@@ -127,6 +175,9 @@ func (vm *VM) compile(ctx context.Context, text *text, s string, args ...interfa
 			if err != nil {
 				return err
 			}
+			for i := range cs {
+				cs[i].metadata = text.metadata
+			}
 
 			text.buf = append(text.buf, cs...)
 		}
@@ -153,6 +204,21 @@ func (vm *VM) directive(ctx context.Context, text *text, d Term) error {
 		return text.forEachUserDefined(arg(0), func(u *userDefined) {
 			u.discontiguous = true
 		})
+	case procedureIndicator{name: atomIndex, arity: 2}:
+		args, err := indexArgs(arg(1), nil)
+		if err != nil {
+			return err
+		}
+		return text.forEachUserDefined(arg(0), func(u *userDefined) {
+			u.indexes = append(u.indexes, &index{args: args})
+		})
+	case procedureIndicator{name: atomFactSchema, arity: 1}:
+		pi, types, err := factSchema(arg(0), nil)
+		if err != nil {
+			return err
+		}
+		text.userDefined(pi).schema = types
+		return nil
 	case procedureIndicator{name: atomInitialization, arity: 1}:
 		text.goals = append(text.goals, arg(0))
 		return nil
@@ -163,14 +229,29 @@ func (vm *VM) directive(ctx context.Context, text *text, d Term) error {
 		}
 
 		return vm.compile(ctx, text, string(b))
+	case procedureIndicator{name: atomEncoding, arity: 1}:
+		return text.setEncoding(arg(0))
 	case procedureIndicator{name: atomEnsureLoaded, arity: 1}:
 		return vm.ensureLoaded(ctx, arg(0), nil)
+	case procedureIndicator{name: atomClauseMetadata, arity: 1}:
+		switch m := arg(0).(type) {
+		case Variable:
+			return InstantiationError(nil)
+		case Atom:
+			if m == atomEmptyList {
+				text.metadata = nil
+				return nil
+			}
+		}
+		text.metadata = arg(0)
+		return nil
 	default:
 		ok, err := Call(vm, d, Success, nil).Force(ctx)
 		if err != nil {
 			return err
 		}
 		if !ok {
+			vm.message(ctx, SeverityError, atomGoalFailed.Apply(atomDirective, d))
 			var sb strings.Builder
 			s := NewOutputTextStream(&sb)
 			_, _ = WriteTerm(vm, s, d, List(atomQuoted.Apply(atomTrue)), Success, nil).Force(ctx)
@@ -186,13 +267,16 @@ func (vm *VM) ensureLoaded(ctx context.Context, file Term, env *Env) error {
 		return err
 	}
 
-	if vm.loaded == nil {
-		vm.loaded = map[string]struct{}{}
-	}
 	if _, ok := vm.loaded[f]; ok {
 		return nil
 	}
 	defer func() {
+		db := vm.database()
+		db.Lock()
+		defer db.Unlock()
+		if vm.loaded == nil {
+			vm.loaded = map[string]struct{}{}
+		}
 		vm.loaded[f] = struct{}{}
 	}()
 
@@ -220,9 +304,21 @@ func (vm *VM) open(file Term, env *Env) (string, []byte, error) {
 }
 
 type text struct {
-	buf     clauses
-	clauses map[procedureIndicator]*userDefined
-	goals   []Term
+	buf        clauses
+	clauses    map[procedureIndicator]*userDefined
+	goals      []Term
+	metadata   Term
+	violations []Term   // The violations of the fact schemas.
+	decoder    *decoder // The decoder of the text being compiled. See encoding/1.
+}
+
+func (t *text) userDefined(pi procedureIndicator) *userDefined {
+	u, ok := t.clauses[pi]
+	if !ok {
+		u = &userDefined{}
+		t.clauses[pi] = u
+	}
+	return u
 }
 
 func (t *text) forEachUserDefined(pi Term, f func(u *userDefined)) error {
@@ -243,13 +339,7 @@ func (t *text) forEachUserDefined(pi Term, f func(u *userDefined)) error {
 				case Variable:
 					return InstantiationError(nil)
 				case Integer:
-					pi := procedureIndicator{name: n, arity: a}
-					u, ok := t.clauses[pi]
-					if !ok {
-						u = &userDefined{}
-						t.clauses[pi] = u
-					}
-					f(u)
+					f(t.userDefined(procedureIndicator{name: n, arity: a}))
 				default:
 					return typeError(validTypePredicateIndicator, pi, nil)
 				}
@@ -269,14 +359,13 @@ func (t *text) flush() error {
 	}
 
 	pi := t.buf[0].pi
-	u, ok := t.clauses[pi]
-	if !ok {
-		u = &userDefined{}
-		t.clauses[pi] = u
-	}
+	u := t.userDefined(pi)
 	if len(u.clauses) > 0 && !u.discontiguous {
 		return &discontiguousError{pi: pi}
 	}
+	for _, c := range t.buf {
+		t.violations = append(t.violations, schemaViolations(u.schema, c.raw, nil)...)
+	}
 	u.clauses = append(u.clauses, t.buf...)
 	t.buf = t.buf[:0]
 	return nil
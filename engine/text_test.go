@@ -130,14 +130,14 @@ bar(X, "abc", [a, b], [a, b|Y], f(a)) :- X, !, foo(X, "abc", [a, b], [a, b|Y], f
 						),
 						vars: []Variable{lastVariable() + 1, lastVariable() + 2},
 						bytecode: bytecode{
-							{opcode: opGetVar, operand: Integer(0)},
+							{opcode: opGetFirstVar, operand: Integer(0)},
 							{opcode: opGetConst, operand: charList("abc")},
 							{opcode: opGetList, operand: Integer(2)},
 							{opcode: opGetConst, operand: NewAtom("a")},
 							{opcode: opGetConst, operand: NewAtom("b")},
 							{opcode: opPop},
 							{opcode: opGetPartial, operand: Integer(2)},
-							{opcode: opGetVar, operand: Integer(1)},
+							{opcode: opGetFirstVar, operand: Integer(1)},
 							{opcode: opGetConst, operand: NewAtom("a")},
 							{opcode: opGetConst, operand: NewAtom("b")},
 							{opcode: opPop},
@@ -169,6 +169,57 @@ bar(X, "abc", [a, b], [a, b|Y], f(a)) :- X, !, foo(X, "abc", [a, b], [a, b|Y], f
 				},
 			},
 		}},
+		{title: "control constructs", text: `
+baz(X) :- ;(->(=(X, a), !), true), ;(=(X, b), !).
+`, result: map[procedureIndicator]procedure{
+			{name: NewAtom("foo"), arity: 1}: &userDefined{
+				multifile: true,
+				clauses: clauses{
+					{
+						pi:  procedureIndicator{name: NewAtom("foo"), arity: 1},
+						raw: &compound{functor: NewAtom("foo"), args: []Term{NewAtom("c")}},
+						bytecode: bytecode{
+							{opcode: opGetConst, operand: NewAtom("c")},
+							{opcode: opExit},
+						},
+					},
+				},
+			},
+			{name: NewAtom("baz"), arity: 1}: &userDefined{
+				clauses: clauses{
+					{
+						pi: procedureIndicator{name: NewAtom("baz"), arity: 1},
+						raw: atomIf.Apply(
+							NewAtom("baz").Apply(lastVariable()+3),
+							seq(atomComma,
+								atomSemiColon.Apply(atomThen.Apply(atomEqual.Apply(lastVariable()+3, NewAtom("a")), atomCut), atomTrue),
+								atomSemiColon.Apply(atomEqual.Apply(lastVariable()+3, NewAtom("b")), atomCut),
+							),
+						),
+						vars: []Variable{lastVariable() + 3},
+						bytecode: bytecode{
+							{opcode: opGetFirstVar, operand: Integer(0)},
+							{opcode: opEnter},
+							{opcode: opPutFunctor, operand: procedureIndicator{name: atomEqual, arity: 2}},
+							{opcode: opPutVar, operand: Integer(0)},
+							{opcode: opPutConst, operand: NewAtom("a")},
+							{opcode: opPop},
+							{opcode: opIfThen, operand: Integer(2)},
+							{opcode: opCut},
+							{opcode: opJump, operand: Integer(1)},
+							{opcode: opCall, operand: procedureIndicator{name: atomTrue, arity: 0}},
+							{opcode: opDisj, operand: Integer(4)},
+							{opcode: opPutVar, operand: Integer(0)},
+							{opcode: opPutConst, operand: NewAtom("b")},
+							{opcode: opCall, operand: procedureIndicator{name: atomEqual, arity: 2}},
+							{opcode: opJump, operand: Integer(1)},
+							{opcode: opCut},
+							{opcode: opExit},
+						},
+					},
+				},
+			},
+		}},
 		{title: "dynamic", text: `
 :- dynamic(foo/1).
 foo(a).
@@ -203,7 +254,8 @@ foo(a).
 foo(b).
 `, result: map[procedureIndicator]procedure{
 			{name: NewAtom("foo"), arity: 1}: &userDefined{
-				multifile: true,
+				multifile:  true,
+				generation: 1,
 				clauses: clauses{
 					{
 						pi:  procedureIndicator{name: NewAtom("foo"), arity: 1},
@@ -300,6 +352,75 @@ foo(b).
 				},
 			},
 		}},
+		{title: "encoding", text: ":- encoding(latin_1).\nbar('caf\xe9').\n", result: map[procedureIndicator]procedure{
+			{name: NewAtom("foo"), arity: 1}: &userDefined{
+				multifile: true,
+				clauses: clauses{
+					{
+						pi:  procedureIndicator{name: NewAtom("foo"), arity: 1},
+						raw: &compound{functor: NewAtom("foo"), args: []Term{NewAtom("c")}},
+						bytecode: bytecode{
+							{opcode: opGetConst, operand: NewAtom("c")},
+							{opcode: opExit},
+						},
+					},
+				},
+			},
+			{name: NewAtom("bar"), arity: 1}: &userDefined{
+				clauses: clauses{
+					{
+						pi:  procedureIndicator{name: NewAtom("bar"), arity: 1},
+						raw: &compound{functor: NewAtom("bar"), args: []Term{NewAtom("café")}},
+						bytecode: bytecode{
+							{opcode: opGetConst, operand: NewAtom("café")},
+							{opcode: opExit},
+						},
+					},
+				},
+			},
+		}},
+		{title: "encoding: included", text: `
+:- include('testdata/latin_1').
+bar('café').
+`, result: map[procedureIndicator]procedure{
+			{name: NewAtom("foo"), arity: 1}: &userDefined{
+				multifile: true,
+				clauses: clauses{
+					{
+						pi:  procedureIndicator{name: NewAtom("foo"), arity: 1},
+						raw: &compound{functor: NewAtom("foo"), args: []Term{NewAtom("c")}},
+						bytecode: bytecode{
+							{opcode: opGetConst, operand: NewAtom("c")},
+							{opcode: opExit},
+						},
+					},
+				},
+			},
+			{name: NewAtom("baz"), arity: 1}: &userDefined{
+				clauses: clauses{
+					{
+						pi:  procedureIndicator{name: NewAtom("baz"), arity: 1},
+						raw: &compound{functor: NewAtom("baz"), args: []Term{NewAtom("café")}},
+						bytecode: bytecode{
+							{opcode: opGetConst, operand: NewAtom("café")},
+							{opcode: opExit},
+						},
+					},
+				},
+			},
+			{name: NewAtom("bar"), arity: 1}: &userDefined{
+				clauses: clauses{
+					{
+						pi:  procedureIndicator{name: NewAtom("bar"), arity: 1},
+						raw: &compound{functor: NewAtom("bar"), args: []Term{NewAtom("café")}},
+						bytecode: bytecode{
+							{opcode: opGetConst, operand: NewAtom("café")},
+							{opcode: opExit},
+						},
+					},
+				},
+			},
+		}},
 		{title: "ensure_loaded", text: `
 :- ensure_loaded('testdata/foo').
 `, result: map[procedureIndicator]procedure{
@@ -382,6 +503,68 @@ X :- X.
 		{title: "error: non-callable rule body", text: `
 foo :- 1.
 `, err: typeError(validTypeCallable, Integer(1), nil)},
+		{title: "clause_metadata", text: `
+:- clause_metadata(version(2)).
+bar(a).
+:- clause_metadata([]).
+`, result: map[procedureIndicator]procedure{
+			{name: NewAtom("foo"), arity: 1}: &userDefined{
+				multifile: true,
+				clauses: clauses{
+					{
+						pi:  procedureIndicator{name: NewAtom("foo"), arity: 1},
+						raw: &compound{functor: NewAtom("foo"), args: []Term{NewAtom("c")}},
+						bytecode: bytecode{
+							{opcode: opGetConst, operand: NewAtom("c")},
+							{opcode: opExit},
+						},
+					},
+				},
+			},
+			{name: NewAtom("bar"), arity: 1}: &userDefined{
+				clauses: clauses{
+					{
+						pi:  procedureIndicator{name: NewAtom("bar"), arity: 1},
+						raw: &compound{functor: NewAtom("bar"), args: []Term{NewAtom("a")}},
+						bytecode: bytecode{
+							{opcode: opGetConst, operand: NewAtom("a")},
+							{opcode: opExit},
+						},
+						metadata: &compound{functor: NewAtom("version"), args: []Term{Integer(2)}},
+					},
+				},
+			},
+		}},
+		{title: "double_quotes", text: `
+:- set_prolog_flag(double_quotes, atom).
+bar("a").
+`, result: map[procedureIndicator]procedure{
+			{name: NewAtom("foo"), arity: 1}: &userDefined{
+				multifile: true,
+				clauses: clauses{
+					{
+						pi:  procedureIndicator{name: NewAtom("foo"), arity: 1},
+						raw: &compound{functor: NewAtom("foo"), args: []Term{NewAtom("c")}},
+						bytecode: bytecode{
+							{opcode: opGetConst, operand: NewAtom("c")},
+							{opcode: opExit},
+						},
+					},
+				},
+			},
+			{name: NewAtom("bar"), arity: 1}: &userDefined{
+				clauses: clauses{
+					{
+						pi:  procedureIndicator{name: NewAtom("bar"), arity: 1},
+						raw: &compound{functor: NewAtom("bar"), args: []Term{NewAtom("a")}},
+						bytecode: bytecode{
+							{opcode: opGetConst, operand: NewAtom("a")},
+							{opcode: opExit},
+						},
+					},
+				},
+			},
+		}},
 		{title: "error: non-PI argument, variable", text: `:- dynamic(PI).`, err: InstantiationError(nil)},
 		{title: "error: non-PI argument, not compound", text: `:- dynamic(foo).`, err: typeError(validTypePredicateIndicator, NewAtom("foo"), nil)},
 		{title: "error: non-PI argument, compound", text: `:- dynamic(foo(a, b)).`, err: typeError(validTypePredicateIndicator, NewAtom("foo").Apply(NewAtom("a"), NewAtom("b")), nil)},
@@ -389,6 +572,10 @@ foo :- 1.
 		{title: "error: non-PI argument, arity is variable", text: `:- dynamic(foo/Arity).`, err: InstantiationError(nil)},
 		{title: "error: non-PI argument, arity is not integer", text: `:- dynamic(foo/bar).`, err: typeError(validTypePredicateIndicator, atomSlash.Apply(NewAtom("foo"), NewAtom("bar")), nil)},
 		{title: "error: non-PI argument, name is not atom", text: `:- dynamic(0/2).`, err: typeError(validTypePredicateIndicator, atomSlash.Apply(Integer(0), Integer(2)), nil)},
+		{title: "error: clause_metadata variable", text: `:- clause_metadata(M).`, err: InstantiationError(nil)},
+		{title: "error: encoding variable", text: `:- encoding(E).`, err: InstantiationError(nil)},
+		{title: "error: encoding unknown", text: `:- encoding(foo).`, err: domainError(validDomainEncoding, NewAtom("foo"), nil)},
+		{title: "error: encoding non-atom", text: `:- encoding(1).`, err: typeError(validTypeAtom, Integer(1), nil)},
 		{title: "error: included variable", text: `
 :- include(X).
 `, err: InstantiationError(nil)},
@@ -454,9 +641,11 @@ bar(b).
 			}
 			vm.FS = testdata
 			vm.Register1(NewAtom("throw"), Throw)
+			vm.Register2(NewAtom("set_prolog_flag"), SetPrologFlag)
 			assert.Equal(t, tt.err, vm.Compile(context.Background(), tt.text, tt.args...))
 			if tt.err == nil {
 				delete(vm.procedures, procedureIndicator{name: NewAtom("throw"), arity: 1})
+				delete(vm.procedures, procedureIndicator{name: NewAtom("set_prolog_flag"), arity: 2})
 				assert.Equal(t, tt.result, vm.procedures)
 			}
 		})
@@ -0,0 +1,309 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// now returns the current time from vm.Clock or the system clock.
+func (vm *VM) now() time.Time {
+	if vm.Clock == nil {
+		return time.Now()
+	}
+	return vm.Clock()
+}
+
+// GetTime unifies stamp with the current time in seconds since the Unix epoch as a float.
+func GetTime(vm *VM, stamp Term, k Cont, env *Env) *Promise {
+	return Unify(vm, stamp, stampOf(vm.now()), k, env)
+}
+
+// StampDateTime unifies dateTime with date(Y, M, D, H, Mn, S, Off, TZ, DST) of stamp in timeZone.
+// timeZone is either 'UTC', local, or an offset in seconds west of UTC. If it's a variable, it's unified with the
+// offset of the local time zone. Off is the offset in seconds west of UTC. TZ is the name of the time zone and DST
+// tells if daylight saving time is in effect. They're - if timeZone is an offset.
+func StampDateTime(vm *VM, stamp, dateTime, timeZone Term, k Cont, env *Env) *Promise {
+	t, err := timeOfStamp(stamp, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	named := true
+	switch z := env.Resolve(timeZone).(type) {
+	case Variable:
+		t = t.In(time.Local)
+		_, off := t.Zone()
+		env, _ = env.Unify(z, Integer(-off))
+	case Atom:
+		switch z {
+		case atomUTC:
+			t = t.UTC()
+		case atomLocal:
+			t = t.In(time.Local)
+		default:
+			return Error(domainError(validDomainTimeZone, z, env))
+		}
+	case Integer:
+		t, named = t.In(time.FixedZone("", -int(z))), false
+	default:
+		return Error(typeError(validTypeAtom, z, env))
+	}
+
+	name, off := t.Zone()
+	tz, dst := Term(atomMinus), Term(atomMinus)
+	if named {
+		tz, dst = NewAtom(name), atomFalse
+		if t.IsDST() {
+			dst = atomTrue
+		}
+	}
+	d := atomDate.Apply(
+		Integer(t.Year()),
+		Integer(t.Month()),
+		Integer(t.Day()),
+		Integer(t.Hour()),
+		Integer(t.Minute()),
+		Float(float64(t.Second())+float64(t.Nanosecond())/1e9),
+		Integer(-off),
+		tz,
+		dst,
+	)
+	return Unify(vm, dateTime, d, k, env)
+}
+
+// DateTimeStamp unifies stamp with the time of dateTime in seconds since the Unix epoch.
+// dateTime is either date(Y, M, D, H, Mn, S, Off, TZ, DST) or date(Y, M, D) which is the midnight in UTC.
+// Values out of their ranges are normalized, e.g. date(2000, 1, 32) is February 1st. If Off is a variable, the local
+// time zone is assumed.
+func DateTimeStamp(vm *VM, dateTime, stamp Term, k Cont, env *Env) *Promise {
+	t, err := timeOfDate(dateTime, env)
+	if err != nil {
+		return Error(err)
+	}
+	return Unify(vm, stamp, stampOf(t), k, env)
+}
+
+// FormatTime outputs when by format like strftime(3) to sink.
+// sink is either atom(A), string(S), codes(Cs), chars(Cs), or a stream. when is either a stamp in the local time
+// zone, date(Y, M, D, H, Mn, S, Off, TZ, DST), or date(Y, M, D).
+// The supported conversion specifications are %a, %A, %b, %B, %c, %C, %d, %D, %e, %f (microseconds), %F, %h, %H, %I,
+// %j, %k, %l, %m, %M, %n, %p, %P, %s, %S, %t, %T, %u, %w, %y, %Y, %z, %Z, and %%.
+func FormatTime(vm *VM, sink, format, when Term, k Cont, env *Env) *Promise {
+	f, err := textOf(format, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	t, err := timeOf(when, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	s, err := formatTime(f, t)
+	if err != nil {
+		return Error(domainError(validDomainFormat, format, env))
+	}
+
+	if c, ok := env.Resolve(sink).(Compound); ok && c.Arity() == 1 {
+		switch c.Functor() {
+		case atomAtom:
+			return Unify(vm, c.Arg(0), NewAtom(s), k, env)
+		case atomString:
+			return Unify(vm, c.Arg(0), String(s), k, env)
+		case atomCodes:
+			return Unify(vm, c.Arg(0), CodeList(s), k, env)
+		case atomChars:
+			return Unify(vm, c.Arg(0), CharList(s), k, env)
+		}
+	}
+
+	return WriteTerm(vm, sink, NewAtom(s), List(atomQuoted.Apply(atomFalse)), k, env)
+}
+
+func stampOf(t time.Time) Float {
+	return Float(float64(t.UnixNano()) / 1e9)
+}
+
+func timeOf(t Term, env *Env) (time.Time, error) {
+	if _, ok := env.Resolve(t).(Compound); ok {
+		return timeOfDate(t, env)
+	}
+	tm, err := timeOfStamp(t, env)
+	return tm.In(time.Local), err
+}
+
+func timeOfStamp(stamp Term, env *Env) (time.Time, error) {
+	switch s := env.Resolve(stamp).(type) {
+	case Variable:
+		return time.Time{}, InstantiationError(env)
+	case Integer:
+		return time.Unix(int64(s), 0), nil
+	case Float:
+		sec, frac := math.Modf(float64(s))
+		return time.Unix(int64(sec), int64(math.Round(frac*1e9))), nil
+	default:
+		return time.Time{}, typeError(validTypeNumber, s, env)
+	}
+}
+
+func timeOfDate(dateTime Term, env *Env) (time.Time, error) {
+	var d Compound
+	switch dt := env.Resolve(dateTime).(type) {
+	case Variable:
+		return time.Time{}, InstantiationError(env)
+	case Compound:
+		if dt.Functor() != atomDate || (dt.Arity() != 9 && dt.Arity() != 3) {
+			return time.Time{}, domainError(validDomainDate, dt, env)
+		}
+		d = dt
+	default:
+		return time.Time{}, typeError(validTypeCompound, dt, env)
+	}
+
+	// Seconds may be a float. So the first 5 fields are checked here.
+	var fields [5]Integer
+	n := len(fields)
+	if d.Arity() == 3 {
+		n = 3
+	}
+	for i := 0; i < n; i++ {
+		switch f := env.Resolve(d.Arg(i)).(type) {
+		case Variable:
+			return time.Time{}, InstantiationError(env)
+		case Integer:
+			fields[i] = f
+		default:
+			return time.Time{}, typeError(validTypeInteger, f, env)
+		}
+	}
+	if d.Arity() == 3 {
+		return time.Date(int(fields[0]), time.Month(fields[1]), int(fields[2]), 0, 0, 0, 0, time.UTC), nil
+	}
+
+	var sec, nsec int
+	switch s := env.Resolve(d.Arg(5)).(type) {
+	case Variable:
+		return time.Time{}, InstantiationError(env)
+	case Integer:
+		sec = int(s)
+	case Float:
+		i, frac := math.Modf(float64(s))
+		sec, nsec = int(i), int(math.Round(frac*1e9))
+	default:
+		return time.Time{}, typeError(validTypeNumber, s, env)
+	}
+
+	loc := time.Local
+	switch off := env.Resolve(d.Arg(6)).(type) {
+	case Variable:
+		break
+	case Integer:
+		name := ""
+		if tz, ok := env.Resolve(d.Arg(7)).(Atom); ok && tz != atomMinus {
+			name = tz.String()
+		}
+		loc = time.FixedZone(name, -int(off))
+	default:
+		return time.Time{}, typeError(validTypeInteger, off, env)
+	}
+
+	return time.Date(int(fields[0]), time.Month(fields[1]), int(fields[2]), int(fields[3]), int(fields[4]), sec, nsec, loc), nil
+}
+
+func formatTime(format string, t time.Time) (string, error) {
+	var sb strings.Builder
+	rs := []rune(format)
+	for i := 0; i < len(rs); i++ {
+		if rs[i] != '%' {
+			_, _ = sb.WriteRune(rs[i])
+			continue
+		}
+		i++
+		if i == len(rs) {
+			return "", fmt.Errorf("incomplete conversion specification")
+		}
+		switch rs[i] {
+		case 'a':
+			_, _ = sb.WriteString(t.Format("Mon"))
+		case 'A':
+			_, _ = sb.WriteString(t.Format("Monday"))
+		case 'b', 'h':
+			_, _ = sb.WriteString(t.Format("Jan"))
+		case 'B':
+			_, _ = sb.WriteString(t.Format("January"))
+		case 'c':
+			_, _ = sb.WriteString(t.Format("Mon Jan _2 15:04:05 2006"))
+		case 'C':
+			_, _ = fmt.Fprintf(&sb, "%02d", t.Year()/100)
+		case 'd':
+			_, _ = fmt.Fprintf(&sb, "%02d", t.Day())
+		case 'D':
+			_, _ = sb.WriteString(t.Format("01/02/06"))
+		case 'e':
+			_, _ = fmt.Fprintf(&sb, "%2d", t.Day())
+		case 'f':
+			_, _ = fmt.Fprintf(&sb, "%06d", t.Nanosecond()/1000)
+		case 'F':
+			_, _ = sb.WriteString(t.Format("2006-01-02"))
+		case 'H':
+			_, _ = fmt.Fprintf(&sb, "%02d", t.Hour())
+		case 'I':
+			_, _ = fmt.Fprintf(&sb, "%02d", hour12(t))
+		case 'j':
+			_, _ = fmt.Fprintf(&sb, "%03d", t.YearDay())
+		case 'k':
+			_, _ = fmt.Fprintf(&sb, "%2d", t.Hour())
+		case 'l':
+			_, _ = fmt.Fprintf(&sb, "%2d", hour12(t))
+		case 'm':
+			_, _ = fmt.Fprintf(&sb, "%02d", int(t.Month()))
+		case 'M':
+			_, _ = fmt.Fprintf(&sb, "%02d", t.Minute())
+		case 'n':
+			_ = sb.WriteByte('\n')
+		case 'p':
+			_, _ = sb.WriteString(t.Format("PM"))
+		case 'P':
+			_, _ = sb.WriteString(t.Format("pm"))
+		case 's':
+			_, _ = fmt.Fprintf(&sb, "%d", t.Unix())
+		case 'S':
+			_, _ = fmt.Fprintf(&sb, "%02d", t.Second())
+		case 't':
+			_ = sb.WriteByte('\t')
+		case 'T':
+			_, _ = sb.WriteString(t.Format("15:04:05"))
+		case 'u':
+			wd := int(t.Weekday())
+			if wd == 0 {
+				wd = 7
+			}
+			_, _ = fmt.Fprintf(&sb, "%d", wd)
+		case 'w':
+			_, _ = fmt.Fprintf(&sb, "%d", int(t.Weekday()))
+		case 'y':
+			_, _ = fmt.Fprintf(&sb, "%02d", t.Year()%100)
+		case 'Y':
+			_, _ = fmt.Fprintf(&sb, "%d", t.Year())
+		case 'z':
+			_, _ = sb.WriteString(t.Format("-0700"))
+		case 'Z':
+			name, _ := t.Zone()
+			_, _ = sb.WriteString(name)
+		case '%':
+			_ = sb.WriteByte('%')
+		default:
+			return "", fmt.Errorf("unknown conversion specification: %%%c", rs[i])
+		}
+	}
+	return sb.String(), nil
+}
+
+func hour12(t time.Time) int {
+	if h := t.Hour() % 12; h != 0 {
+		return h
+	}
+	return 12
+}
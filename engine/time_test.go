@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTime(t *testing.T) {
+	vm := VM{Clock: func() time.Time {
+		return time.Date(2023, 4, 5, 6, 7, 8, 500000000, time.UTC)
+	}}
+	ok, err := GetTime(&vm, Float(1680674828.5), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestStampDateTime(t *testing.T) {
+	stamp := Float(1680674828.5) // 2023-04-05T06:07:08.5Z
+	local := time.Unix(1680674828, 500000000).In(time.Local)
+	localName, localOff := local.Zone()
+	localDST := atomFalse
+	if local.IsDST() {
+		localDST = atomTrue
+	}
+
+	tests := []struct {
+		title           string
+		stamp, timeZone Term
+		dateTime        Term
+		err             error
+	}{
+		{title: "UTC", stamp: stamp, timeZone: atomUTC, dateTime: atomDate.Apply(Integer(2023), Integer(4), Integer(5), Integer(6), Integer(7), Float(8.5), Integer(0), atomUTC, atomFalse)},
+		{title: "offset", stamp: Integer(1680674828), timeZone: Integer(-9 * 60 * 60), dateTime: atomDate.Apply(Integer(2023), Integer(4), Integer(5), Integer(15), Integer(7), Float(8), Integer(-9*60*60), atomMinus, atomMinus)},
+		{title: "local", stamp: stamp, timeZone: atomLocal, dateTime: atomDate.Apply(Integer(local.Year()), Integer(local.Month()), Integer(local.Day()), Integer(local.Hour()), Integer(local.Minute()), Float(8.5), Integer(-localOff), NewAtom(localName), localDST)},
+		{title: "stamp is a variable", stamp: NewVariable(), timeZone: atomUTC, err: InstantiationError(nil)},
+		{title: "stamp is not a number", stamp: NewAtom("foo"), timeZone: atomUTC, err: typeError(validTypeNumber, NewAtom("foo"), nil)},
+		{title: "unknown time zone", stamp: stamp, timeZone: NewAtom("mars"), err: domainError(validDomainTimeZone, NewAtom("mars"), nil)},
+		{title: "time zone is not an atom", stamp: stamp, timeZone: Float(1), err: typeError(validTypeAtom, Float(1), nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			d := NewVariable()
+			_, err := StampDateTime(nil, tt.stamp, d, tt.timeZone, func(env *Env) *Promise {
+				assert.Equal(t, tt.dateTime, env.Resolve(d))
+				return Bool(true)
+			}, nil).Force(context.Background())
+			assert.Equal(t, tt.err, err)
+		})
+	}
+
+	t.Run("time zone is a variable", func(t *testing.T) {
+		z := NewVariable()
+		ok, err := StampDateTime(nil, stamp, NewVariable(), z, func(env *Env) *Promise {
+			assert.Equal(t, Integer(-localOff), env.Resolve(z))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+}
+
+func TestDateTimeStamp(t *testing.T) {
+	tests := []struct {
+		title    string
+		dateTime Term
+		stamp    Term
+		err      error
+	}{
+		{title: "date/9", dateTime: atomDate.Apply(Integer(2023), Integer(4), Integer(5), Integer(15), Integer(7), Float(8.5), Integer(-9*60*60), atomMinus, atomMinus), stamp: Float(1680674828.5)},
+		{title: "date/3", dateTime: atomDate.Apply(Integer(2023), Integer(4), Integer(5)), stamp: Float(1680652800)},
+		{title: "normalized", dateTime: atomDate.Apply(Integer(2023), Integer(3), Integer(36)), stamp: Float(1680652800)},
+		{title: "local", dateTime: atomDate.Apply(Integer(2023), Integer(4), Integer(5), Integer(0), Integer(0), Integer(0), NewVariable(), NewVariable(), NewVariable()), stamp: Float(time.Date(2023, 4, 5, 0, 0, 0, 0, time.Local).Unix())},
+		{title: "variable", dateTime: NewVariable(), err: InstantiationError(nil)},
+		{title: "not a compound", dateTime: Integer(1), err: typeError(validTypeCompound, Integer(1), nil)},
+		{title: "not a date", dateTime: atomDate.Apply(Integer(2023), Integer(4)), err: domainError(validDomainDate, atomDate.Apply(Integer(2023), Integer(4)), nil)},
+		{title: "not an integer", dateTime: atomDate.Apply(Integer(2023), NewAtom("apr"), Integer(5)), err: typeError(validTypeInteger, NewAtom("apr"), nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			s := NewVariable()
+			_, err := DateTimeStamp(nil, tt.dateTime, s, func(env *Env) *Promise {
+				assert.Equal(t, tt.stamp, env.Resolve(s))
+				return Bool(true)
+			}, nil).Force(context.Background())
+			assert.Equal(t, tt.err, err)
+		})
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	date := atomDate.Apply(Integer(2023), Integer(4), Integer(5), Integer(15), Integer(7), Float(8.25), Integer(-9*60*60), NewAtom("JST"), atomFalse)
+
+	tests := []struct {
+		title  string
+		format Term
+		when   Term
+		output string
+		err    error
+	}{
+		{title: "date and time", format: NewAtom("%F %T"), when: date, output: "2023-04-05 15:07:08"},
+		{title: "names", format: NewAtom("%a %A %b %B %h"), when: date, output: "Wed Wednesday Apr April Apr"},
+		{title: "numbers", format: NewAtom("%C %d %e %j %m %M %S %u %w %y %Y"), when: date, output: "20 05  5 095 04 07 08 3 3 23 2023"},
+		{title: "hours", format: NewAtom("%H %I %k %l %p %P"), when: date, output: "15 03 15  3 PM pm"},
+		{title: "zone", format: NewAtom("%z %Z"), when: date, output: "+0900 JST"},
+		{title: "misc", format: CodeList("%c%n%t%D %f %s %%"), when: date, output: "Wed Apr  5 15:07:08 2023\n\t04/05/23 250000 1680674828 %"},
+		{title: "stamp", format: NewAtom("%s"), when: Float(1680674828.5), output: "1680674828"},
+		{title: "unknown specification", format: NewAtom("%Q"), when: date, err: domainError(validDomainFormat, NewAtom("%Q"), nil)},
+		{title: "incomplete specification", format: NewAtom("%"), when: date, err: domainError(validDomainFormat, NewAtom("%"), nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			a := NewVariable()
+			_, err := FormatTime(nil, atomAtom.Apply(a), tt.format, tt.when, func(env *Env) *Promise {
+				assert.Equal(t, NewAtom(tt.output), env.Resolve(a))
+				return Bool(true)
+			}, nil).Force(context.Background())
+			assert.Equal(t, tt.err, err)
+		})
+	}
+
+	t.Run("sinks", func(t *testing.T) {
+		for _, s := range []struct {
+			functor Atom
+			output  Term
+		}{
+			{functor: atomString, output: String("2023")},
+			{functor: atomCodes, output: CodeList("2023")},
+			{functor: atomChars, output: CharList("2023")},
+		} {
+			v := NewVariable()
+			ok, err := FormatTime(nil, s.functor.Apply(v), NewAtom("%Y"), date, func(env *Env) *Promise {
+				assert.Equal(t, s.output, env.Resolve(v))
+				return Bool(true)
+			}, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceEvent is a call to a procedure which succeeded. See VM.OnTrace.
+type TraceEvent struct {
+	// Indicator is the predicate indicator of the procedure e.g. foo/1.
+	Indicator Term
+
+	// Foreign tells if the procedure is a foreign predicate written in Go.
+	Foreign bool
+
+	// Start is when the procedure was called and End is when it succeeded.
+	// A nondeterministic procedure may succeed more than once for a call. Each solution is an event from the call.
+	Start, End time.Time
+}
+
+// trace wraps k so that it reports the success of the call to the procedure to vm.OnTrace.
+func (vm *VM) trace(pi procedureIndicator, p procedure, k Cont) Cont {
+	if vm.OnTrace == nil {
+		return k
+	}
+	_, ok := p.(*userDefined)
+	start := vm.now()
+	return func(env *Env) *Promise {
+		vm.OnTrace(TraceEvent{Indicator: pi.Term(), Foreign: !ok, Start: start, End: vm.now()})
+		return k(env)
+	}
+}
+
+// ChromeTrace writes TraceEvents in the Chrome trace event format so that Perfetto (https://ui.perfetto.dev) and
+// chrome://tracing show them on a timeline. Set its Record method to VM.OnTrace.
+//
+// The output is a JSON array of complete events whose timestamps are in microseconds since NewChromeTrace.
+// The array is terminated by Close but the viewers read it without the termination e.g. after a crash.
+type ChromeTrace struct {
+	mu     sync.Mutex
+	w      io.Writer
+	origin time.Time
+	n      int
+	err    error
+}
+
+// NewChromeTrace returns a ChromeTrace which writes to w.
+func NewChromeTrace(w io.Writer) *ChromeTrace {
+	return &ChromeTrace{w: w, origin: time.Now()}
+}
+
+type chromeTraceEvent struct {
+	Name     string  `json:"name"`
+	Category string  `json:"cat"`
+	Phase    string  `json:"ph"`
+	Time     float64 `json:"ts"`
+	Duration float64 `json:"dur"`
+	Process  int     `json:"pid"`
+	Thread   int     `json:"tid"`
+}
+
+// Record writes the event. It's safe for concurrent use.
+// The events of foreign predicates are in the category "go" and the ones of Prolog procedures are in "prolog".
+func (t *ChromeTrace) Record(e TraceEvent) {
+	ce := chromeTraceEvent{
+		Name:     indicatorString(e.Indicator),
+		Category: "prolog",
+		Phase:    "X",
+		Time:     float64(e.Start.Sub(t.origin).Nanoseconds()) / 1e3,
+		Duration: float64(e.End.Sub(e.Start).Nanoseconds()) / 1e3,
+		Process:  1,
+		Thread:   1,
+	}
+	if e.Foreign {
+		ce.Category = "go"
+	}
+	b, err := json.Marshal(&ce)
+	if err != nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err != nil {
+		return
+	}
+	sep := ",\n"
+	if t.n == 0 {
+		sep = "[\n"
+	}
+	t.n++
+	if _, err := io.WriteString(t.w, sep); err != nil {
+		t.err = err
+		return
+	}
+	_, t.err = t.w.Write(b)
+}
+
+// indicatorString returns the predicate indicator in the form of foo/1 instead of /(foo,1).
+func indicatorString(t Term) string {
+	if c, ok := t.(Compound); ok && c.Functor() == atomSlash && c.Arity() == 2 {
+		name, ok := c.Arg(0).(Atom)
+		arity, isInt := c.Arg(1).(Integer)
+		if ok && isInt {
+			return procedureIndicator{name: name, arity: arity}.String()
+		}
+	}
+	var sb strings.Builder
+	_ = t.WriteTerm(&sb, &WriteOptions{quoted: true}, nil)
+	return sb.String()
+}
+
+// Close terminates the JSON array. It returns the first error occurred while writing the events if any.
+// It doesn't close the underlying io.Writer.
+func (t *ChromeTrace) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err != nil {
+		return t.err
+	}
+	s := "\n]\n"
+	if t.n == 0 {
+		s = "[]\n"
+	}
+	_, t.err = io.WriteString(t.w, s)
+	return t.err
+}
@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVM_OnTrace(t *testing.T) {
+	var (
+		vm     VM
+		now    = time.Unix(0, 0)
+		events []TraceEvent
+	)
+	vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+	vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+	vm.operators.define(700, operatorSpecifierXFX, atomEqual)
+	vm.Clock = func() time.Time {
+		now = now.Add(time.Millisecond)
+		return now
+	}
+	vm.OnTrace = func(e TraceEvent) {
+		events = append(events, e)
+	}
+	vm.Register0(NewAtom("go"), func(_ *VM, k Cont, env *Env) *Promise {
+		return k(env)
+	})
+	assert.NoError(t, vm.Compile(context.Background(), `
+foo :- bar(X), X = b, go.
+bar(a).
+bar(b).
+`))
+	vm.Register2(atomEqual, Unify)
+
+	ok, err := vm.Arrive(NewAtom("foo"), nil, Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ms := func(n int) time.Time {
+		return time.Unix(0, 0).Add(time.Duration(n) * time.Millisecond)
+	}
+	bar := atomSlash.Apply(NewAtom("bar"), Integer(1))
+	assert.Equal(t, []TraceEvent{
+		{Indicator: bar, Start: ms(2), End: ms(3)},
+		// a = b failed at 4.
+		{Indicator: bar, Start: ms(2), End: ms(5)},
+		{Indicator: atomSlash.Apply(atomEqual, Integer(2)), Foreign: true, Start: ms(6), End: ms(7)},
+		{Indicator: atomSlash.Apply(NewAtom("go"), Integer(0)), Foreign: true, Start: ms(8), End: ms(9)},
+		{Indicator: atomSlash.Apply(NewAtom("foo"), Integer(0)), Start: ms(1), End: ms(10)},
+	}, events)
+}
+
+func TestChromeTrace(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var buf bytes.Buffer
+		ct := NewChromeTrace(&buf)
+		start := ct.origin.Add(1500 * time.Nanosecond)
+		ct.Record(TraceEvent{Indicator: atomSlash.Apply(NewAtom("foo"), Integer(1)), Start: start, End: start.Add(2 * time.Microsecond)})
+		ct.Record(TraceEvent{Indicator: atomSlash.Apply(NewAtom("It's"), Integer(0)), Foreign: true, Start: start, End: start})
+
+		// It's readable before Close.
+		assert.Equal(t, `[
+{"name":"foo/1","cat":"prolog","ph":"X","ts":1.5,"dur":2,"pid":1,"tid":1},
+{"name":"'It\\'s'/0","cat":"go","ph":"X","ts":1.5,"dur":0,"pid":1,"tid":1}`, buf.String())
+
+		assert.NoError(t, ct.Close())
+		var events []map[string]interface{}
+		assert.NoError(t, json.Unmarshal(buf.Bytes(), &events))
+		assert.Len(t, events, 2)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, NewChromeTrace(&buf).Close())
+		assert.Equal(t, "[]\n", buf.String())
+	})
+
+	t.Run("error", func(t *testing.T) {
+		var m mockWriter
+		m.On("Write", []byte("[\n")).Return(0, errors.New("failed")).Once()
+		defer m.AssertExpectations(t)
+
+		ct := NewChromeTrace(&m)
+		ct.Record(TraceEvent{Indicator: atomSlash.Apply(NewAtom("foo"), Integer(1))})
+		ct.Record(TraceEvent{Indicator: atomSlash.Apply(NewAtom("foo"), Integer(1))})
+		assert.EqualError(t, ct.Close(), "failed")
+	})
+}
@@ -0,0 +1,231 @@
+package engine
+
+import (
+	"hash/fnv"
+	"strings"
+)
+
+// VariantTable is a hash table keyed by terms up to variants, i.e. f(X, Y) and f(A, B) are the same key but f(X, X)
+// isn't. It's the storage shared by the features which look up terms by variants e.g. grouping the solutions of
+// bagof/3 by their witnesses and caching the results of queries. The loop check compares goals by the same keys.
+// It's an open-addressing table with linear probing and a hash which doesn't change from run to run so that the
+// features perform the same way every time. Terms which can't be keyed e.g. custom atomic terms are kept aside and
+// compared one by one. The zero value is an empty table. It's not safe for concurrent use.
+type VariantTable struct {
+	slots      []variantSlot
+	entries    int
+	tombstones int
+	keyBytes   int
+
+	others []variantEntry // The entries of the terms which can't be keyed.
+}
+
+type variantSlot struct {
+	state variantSlotState
+	hash  uint64
+	key   string
+	variantEntry
+}
+
+type variantSlotState uint8
+
+const (
+	variantSlotEmpty variantSlotState = iota
+	variantSlotUsed
+	variantSlotDeleted
+)
+
+type variantEntry struct {
+	term  Term
+	value interface{}
+}
+
+// VariantTableStats is a snapshot of the storage of a VariantTable.
+type VariantTableStats struct {
+	// Entries is the number of the entries.
+	Entries int
+	// Slots is the capacity of the hash table.
+	Slots int
+	// Tombstones is the number of the slots of the deleted entries which haven't been reclaimed yet.
+	Tombstones int
+	// KeyBytes is the total length of the keys of the entries.
+	KeyBytes int
+	// Unkeyed is the number of the entries which are compared one by one.
+	Unkeyed int
+}
+
+// Get returns the value of the entry of which term is a variant of t.
+func (v *VariantTable) Get(t Term, env *Env) (interface{}, bool) {
+	key, h, ok := variantKey(t, env)
+	if !ok {
+		if i := v.other(t, env); i >= 0 {
+			return v.others[i].value, true
+		}
+		return nil, false
+	}
+	if i := v.find(key, h); i >= 0 {
+		return v.slots[i].value, true
+	}
+	return nil, false
+}
+
+// Put sets the value of the entry of which term is a variant of t. If there's no such entry, it adds a new entry for t.
+// t is kept as it is, so it must not be modified afterwards e.g. by binding its variables.
+func (v *VariantTable) Put(t Term, value interface{}, env *Env) {
+	key, h, ok := variantKey(t, env)
+	if !ok {
+		if i := v.other(t, env); i >= 0 {
+			v.others[i].value = value
+			return
+		}
+		v.others = append(v.others, variantEntry{term: t, value: value})
+		return
+	}
+	if i := v.find(key, h); i >= 0 {
+		v.slots[i].value = value
+		return
+	}
+
+	if (v.entries+v.tombstones+1)*4 > len(v.slots)*3 {
+		v.resize()
+	}
+	mask := uint64(len(v.slots) - 1)
+	for i := h & mask; ; i = (i + 1) & mask {
+		s := &v.slots[i]
+		if s.state == variantSlotUsed {
+			continue
+		}
+		if s.state == variantSlotDeleted {
+			v.tombstones--
+		}
+		*s = variantSlot{state: variantSlotUsed, hash: h, key: key, variantEntry: variantEntry{term: t, value: value}}
+		v.entries++
+		v.keyBytes += len(key)
+		return
+	}
+}
+
+// Delete removes the entry of which term is a variant of t. It tells if there was such an entry.
+func (v *VariantTable) Delete(t Term, env *Env) bool {
+	key, h, ok := variantKey(t, env)
+	if !ok {
+		i := v.other(t, env)
+		if i < 0 {
+			return false
+		}
+		v.others = append(v.others[:i], v.others[i+1:]...)
+		return true
+	}
+	i := v.find(key, h)
+	if i < 0 {
+		return false
+	}
+	v.keyBytes -= len(v.slots[i].key)
+	v.slots[i] = variantSlot{state: variantSlotDeleted}
+	v.entries--
+	v.tombstones++
+	return true
+}
+
+// Len returns the number of the entries.
+func (v *VariantTable) Len() int {
+	return v.entries + len(v.others)
+}
+
+// Range calls f with the term and the value of each entry until f returns false. The order is unspecified.
+// f may delete the entry it's called with.
+func (v *VariantTable) Range(f func(t Term, value interface{}) bool) {
+	for i := range v.slots {
+		s := v.slots[i]
+		if s.state != variantSlotUsed {
+			continue
+		}
+		if !f(s.term, s.value) {
+			return
+		}
+	}
+	for _, e := range append([]variantEntry(nil), v.others...) {
+		if !f(e.term, e.value) {
+			return
+		}
+	}
+}
+
+// Reset removes all the entries and releases the storage.
+func (v *VariantTable) Reset() {
+	*v = VariantTable{}
+}
+
+// Stats returns the statistics of the storage.
+func (v *VariantTable) Stats() VariantTableStats {
+	return VariantTableStats{
+		Entries:    v.Len(),
+		Slots:      len(v.slots),
+		Tombstones: v.tombstones,
+		KeyBytes:   v.keyBytes,
+		Unkeyed:    len(v.others),
+	}
+}
+
+// find returns the index of the slot of the key or -1 if there's no such slot.
+func (v *VariantTable) find(key string, h uint64) int {
+	if len(v.slots) == 0 {
+		return -1
+	}
+	mask := uint64(len(v.slots) - 1)
+	for i := h & mask; ; i = (i + 1) & mask {
+		s := &v.slots[i]
+		switch s.state {
+		case variantSlotEmpty:
+			return -1
+		case variantSlotUsed:
+			if s.hash == h && s.key == key {
+				return int(i)
+			}
+		}
+	}
+}
+
+// other returns the index of the unkeyed entry of which term is a variant of t or -1 if there's no such entry.
+func (v *VariantTable) other(t Term, env *Env) int {
+	for i, e := range v.others {
+		if variant(e.term, t, env) {
+			return i
+		}
+	}
+	return -1
+}
+
+// resize makes the table large enough for one more entry and drops the tombstones.
+func (v *VariantTable) resize() {
+	n := 8
+	for (v.entries+1)*4 > n*3 {
+		n *= 2
+	}
+	old := v.slots
+	v.slots = make([]variantSlot, n)
+	v.tombstones = 0
+	mask := uint64(n - 1)
+	for _, s := range old {
+		if s.state != variantSlotUsed {
+			continue
+		}
+		i := s.hash & mask
+		for v.slots[i].state == variantSlotUsed {
+			i = (i + 1) & mask
+		}
+		v.slots[i] = s
+	}
+}
+
+// variantKey returns the key of t which is identical iff the terms are variants, and its hash.
+func variantKey(t Term, env *Env) (string, uint64, bool) {
+	var sb strings.Builder
+	if writeTermKey(&sb, t, map[Variable]int{}, env) != nil {
+		return "", 0, false
+	}
+	key := sb.String()
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return key, h.Sum64(), true
+}
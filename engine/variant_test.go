@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVariantTable(t *testing.T) {
+	f := NewAtom("f")
+	x, y := NewVariable(), NewVariable()
+	m := &mockTerm{} // Custom atomic terms can't be keyed.
+
+	var v VariantTable
+	assert.Equal(t, VariantTableStats{}, v.Stats())
+
+	v.Put(f.Apply(x, y), 1, nil)
+	v.Put(f.Apply(x, x), 2, nil)
+	v.Put(f.Apply(NewAtom("a"), Integer(1)), 3, nil)
+	v.Put(f.Apply(m), 4, nil)
+
+	t.Run("get", func(t *testing.T) {
+		tests := []struct {
+			title string
+			term  Term
+			env   *Env
+			value interface{}
+			ok    bool
+		}{
+			{title: "variant", term: f.Apply(NewVariable(), NewVariable()), value: 1, ok: true},
+			{title: "same variables", term: f.Apply(y, y), value: 2, ok: true},
+			{title: "ground", term: f.Apply(NewAtom("a"), Integer(1)), value: 3, ok: true},
+			{title: "bound variable", term: f.Apply(x, Integer(1)), env: NewEnv().bind(x, NewAtom("a")), value: 3, ok: true},
+			{title: "unkeyed", term: f.Apply(m), value: 4, ok: true},
+			{title: "more specific", term: f.Apply(NewAtom("a"), y), ok: false},
+			{title: "not found", term: NewAtom("g"), ok: false},
+		}
+		for _, tt := range tests {
+			t.Run(tt.title, func(t *testing.T) {
+				value, ok := v.Get(tt.term, tt.env)
+				assert.Equal(t, tt.ok, ok)
+				assert.Equal(t, tt.value, value)
+			})
+		}
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+		v.Put(f.Apply(NewVariable(), NewVariable()), 5, nil)
+		value, ok := v.Get(f.Apply(x, y), nil)
+		assert.True(t, ok)
+		assert.Equal(t, 5, value)
+		assert.Equal(t, 4, v.Len())
+	})
+
+	t.Run("range", func(t *testing.T) {
+		var values []interface{}
+		v.Range(func(_ Term, value interface{}) bool {
+			values = append(values, value)
+			return true
+		})
+		assert.ElementsMatch(t, []interface{}{5, 2, 3, 4}, values)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.True(t, v.Delete(f.Apply(y, y), nil))
+		assert.False(t, v.Delete(f.Apply(y, y), nil))
+		assert.True(t, v.Delete(f.Apply(m), nil))
+		_, ok := v.Get(f.Apply(x, x), nil)
+		assert.False(t, ok)
+
+		s := v.Stats()
+		assert.Equal(t, 2, s.Entries)
+		assert.Equal(t, 1, s.Tombstones)
+		assert.Equal(t, 0, s.Unkeyed)
+		assert.Equal(t, 8, s.Slots)
+
+		// Deleting while ranging.
+		v.Range(func(t Term, _ interface{}) bool {
+			v.Delete(t, nil)
+			return true
+		})
+		assert.Equal(t, 0, v.Len())
+	})
+
+	t.Run("grow", func(t *testing.T) {
+		v.Reset()
+		for i := 0; i < 1000; i++ {
+			v.Put(f.Apply(Integer(i), x), i, nil)
+		}
+		for i := 0; i < 1000; i += 2 {
+			assert.True(t, v.Delete(f.Apply(Integer(i), y), nil))
+		}
+		for i := 0; i < 1000; i++ {
+			value, ok := v.Get(f.Apply(Integer(i), y), nil)
+			assert.Equal(t, i%2 == 1, ok)
+			if ok {
+				assert.Equal(t, i, value)
+			}
+		}
+		s := v.Stats()
+		assert.Equal(t, 500, s.Entries)
+		assert.Equal(t, 2048, s.Slots)
+		assert.Greater(t, s.KeyBytes, 0)
+
+		// Reusing the tombstones doesn't grow the table.
+		for i := 0; i < 1000; i += 2 {
+			v.Put(f.Apply(Integer(i), x), i, nil)
+		}
+		assert.Equal(t, 1000, v.Len())
+		assert.Equal(t, 2048, v.Stats().Slots)
+	})
+}
@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strings"
+)
+
+const modulePath = "github.com/ichiban/prolog"
+
+var versionMajor, versionMinor, versionPatch = moduleVersion()
+
+// Version returns the version of this module e.g. 0, 15, 1 for v0.15.1. See prolog_version/3.
+// It's taken from the build information. So it's 0.0.0 if the module is built from a source tree without a version.
+func Version() (major, minor, patch int) {
+	return versionMajor, versionMinor, versionPatch
+}
+
+func moduleVersion() (major, minor, patch int) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return 0, 0, 0
+	}
+	if info.Main.Path == modulePath {
+		return parseVersion(info.Main.Version)
+	}
+	for _, d := range info.Deps {
+		if d.Path == modulePath {
+			return parseVersion(d.Version)
+		}
+	}
+	return 0, 0, 0
+}
+
+// parseVersion parses a module version e.g. v0.15.1 or v0.15.2-0.20230101000000-abcdefabcdef.
+// The pre-release and build suffixes are ignored. It returns 0.0.0 if v is not a version e.g. (devel).
+func parseVersion(v string) (major, minor, patch int) {
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	if _, err := fmt.Sscanf(v, "%d.%d.%d", &major, &minor, &patch); err != nil {
+		return 0, 0, 0
+	}
+	return major, minor, patch
+}
+
+// Feature is an optional capability of a Prolog implementation. See feature/1.
+type Feature string
+
+// Features which programs may ask for.
+const (
+	FeatureStrings           Feature = "strings"            // String type and string_*/N predicates.
+	FeatureDCG               Feature = "dcg"                // Definite clause grammars.
+	FeatureRecords           Feature = "records"            // Recorded database.
+	FeatureImages            Feature = "images"             // VM images. See VM.SaveImage.
+	FeatureQuotas            Feature = "quotas"             // Resource quotas. See Quota.
+	FeatureParallel          Feature = "parallel"           // Parallel conjunction. Not advertised since VM.Parallel is opt-in.
+	FeatureTabling           Feature = "tabling"            // Tabled execution. Not supported.
+	FeatureCLPFD             Feature = "clpfd"              // Constraint logic programming over finite domains. Not supported.
+	FeatureModules           Feature = "modules"            // Module system. Not supported.
+	FeatureUnboundedIntegers Feature = "unbounded_integers" // Unbounded integers. Not supported.
+)
+
+// supportedFeatures are the features this implementation provides in the order of enumeration.
+var supportedFeatures = []Feature{
+	FeatureStrings,
+	FeatureDCG,
+	FeatureRecords,
+	FeatureImages,
+	FeatureQuotas,
+}
+
+// HasFeature checks if this implementation provides the feature.
+func HasFeature(f Feature) bool {
+	for _, s := range supportedFeatures {
+		if s == f {
+			return true
+		}
+	}
+	return false
+}
+
+// Features returns the features this implementation provides.
+func Features() []Feature {
+	return append([]Feature(nil), supportedFeatures...)
+}
+
+// PrologVersion succeeds iff major, minor, and patch unify with the version of this implementation.
+func PrologVersion(vm *VM, major, minor, patch Term, k Cont, env *Env) *Promise {
+	return Unify(vm, tuple(major, minor, patch), tuple(Integer(versionMajor), Integer(versionMinor), Integer(versionPatch)), k, env)
+}
+
+// FeatureProvided succeeds iff feature is a feature this implementation provides.
+// If feature is a variable, it enumerates the features.
+func FeatureProvided(vm *VM, feature Term, k Cont, env *Env) *Promise {
+	switch f := env.Resolve(feature).(type) {
+	case Variable:
+		ks := make([]func(context.Context) *Promise, len(supportedFeatures))
+		for i := range supportedFeatures {
+			a := NewAtom(string(supportedFeatures[i]))
+			ks[i] = func(context.Context) *Promise {
+				return Unify(vm, f, a, k, env)
+			}
+		}
+		return Delay(ks...)
+	case Atom:
+		if !HasFeature(Feature(f.String())) {
+			return Bool(false)
+		}
+		return k(env)
+	default:
+		return Error(typeError(validTypeAtom, f, env))
+	}
+}
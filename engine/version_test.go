@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasFeature(t *testing.T) {
+	assert.True(t, HasFeature(FeatureStrings))
+	assert.False(t, HasFeature(FeatureTabling))
+	assert.False(t, HasFeature(FeatureParallel))
+	assert.False(t, HasFeature("foo"))
+
+	fs := Features()
+	assert.Contains(t, fs, FeatureDCG)
+	fs[0] = "foo"
+	assert.True(t, HasFeature(FeatureStrings))
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		version             string
+		major, minor, patch int
+	}{
+		{version: "v0.15.1", major: 0, minor: 15, patch: 1},
+		{version: "v1.2.3+incompatible", major: 1, minor: 2, patch: 3},
+		{version: "v0.15.2-0.20230101000000-abcdefabcdef", major: 0, minor: 15, patch: 2},
+		{version: "(devel)"},
+		{version: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			major, minor, patch := parseVersion(tt.version)
+			assert.Equal(t, tt.major, major)
+			assert.Equal(t, tt.minor, minor)
+			assert.Equal(t, tt.patch, patch)
+		})
+	}
+}
+
+func TestPrologVersion(t *testing.T) {
+	t.Run("variables", func(t *testing.T) {
+		major, minor, patch := NewVariable(), NewVariable(), NewVariable()
+		ok, err := PrologVersion(nil, major, minor, patch, func(env *Env) *Promise {
+			ma, mi, pa := Version()
+			assert.Equal(t, Integer(ma), env.Resolve(major))
+			assert.Equal(t, Integer(mi), env.Resolve(minor))
+			assert.Equal(t, Integer(pa), env.Resolve(patch))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("different version", func(t *testing.T) {
+		ok, err := PrologVersion(nil, Integer(versionMajor+1), NewVariable(), NewVariable(), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+}
+
+func TestFeatureProvided(t *testing.T) {
+	t.Run("supported", func(t *testing.T) {
+		ok, err := FeatureProvided(nil, NewAtom("strings"), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("not supported", func(t *testing.T) {
+		ok, err := FeatureProvided(nil, NewAtom("clpfd"), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("enumerate", func(t *testing.T) {
+		f := NewVariable()
+		var fs []Feature
+		ok, err := FeatureProvided(nil, f, func(env *Env) *Promise {
+			fs = append(fs, Feature(env.Resolve(f).(Atom).String()))
+			return Bool(false)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, Features(), fs)
+	})
+
+	t.Run("not an atom", func(t *testing.T) {
+		_, err := FeatureProvided(nil, Integer(1), Success, nil).Force(context.Background())
+		assert.Equal(t, typeError(validTypeAtom, Integer(1), nil), err)
+	})
+}
@@ -5,11 +5,30 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"math/rand"
+	"reflect"
+	"runtime"
 	"strings"
+	"sync"
+	"time"
 )
 
 type bytecode []instruction
 
+// exits reports whether the execution of the bytecode reaches opExit without doing anything else.
+func (pc bytecode) exits() bool {
+	for {
+		switch op := pc[0]; op.opcode {
+		case opExit:
+			return true
+		case opJump:
+			pc = pc[1:][op.operand.(Integer):]
+		default:
+			return false
+		}
+	}
+}
+
 type instruction struct {
 	opcode  opcode
 	operand Term
@@ -34,6 +53,16 @@ const (
 	opPutList
 	opGetPartial
 	opPutPartial
+	opGetPacked
+	opPutPacked
+
+	opDisj
+	opIfThen
+	opSoftCut
+	opJump
+
+	opGetFirstVar
+	opIs
 )
 
 // Success is a continuation that leads to true.
@@ -51,98 +80,169 @@ type VM struct {
 	// Unknown is a callback that is triggered when the VM reaches to an unknown predicate while current_prolog_flag(unknown, warning).
 	Unknown func(name Atom, args []Term, env *Env)
 
+	// OnMessage is a callback that receives the messages of print_message/2 and the ones originated in the VM e.g.
+	// failed directives, failed initialization goals, and unknown procedures while current_prolog_flag(unknown, warning).
+	// term is the message term e.g. goal_failed(directive, foo) and lines are its human-readable text.
+	// It's the place to route the messages to a structured logger. See PrintMessage.
+	OnMessage func(severity Severity, term Term, lines []string)
+
+	// OnTrace is a callback that receives an event for each call to a procedure which succeeded. The calls which failed
+	// or raised exceptions don't produce events. See ChromeTrace to view them on a timeline.
+	OnTrace func(TraceEvent)
+
 	procedures map[procedureIndicator]procedure
 	unknown    unknownAction
+	pures      map[procedureIndicator]struct{} // Foreign predicates without side effects. See DeclarePure.
+	foreign    map[procedureIndicator]struct{} // Foreign predicates registered by the embedder. See Quota.ForeignCall.
+	purity     *purityCache
+	generators map[Atom]func() Generator       // Sources of aggregate_stream/4. See RegisterGenerator.
+	fallbacks  map[procedureIndicator]fallback // See Fallback.
+	constants  map[Atom]Number                 // Named constants of arithmetic. See RegisterConstant.
+	dbMu       *sync.RWMutex                   // See database.
+
+	// Recorded database
+	records    map[recordKey][]*DBRef
+	recordKeys []recordKey
 
 	// FS is a file system that is referenced when the VM loads Prolog texts e.g. ensure_loaded/1.
 	// It has no effect on open/4 nor open/3 which always access the actual file system.
 	FS     fs.FS
 	loaded map[string]struct{}
 
+	// Goals of initialization/1 directives which have been run. They're run again when the VM is restored from an image.
+	initialization []Term
+
 	// Internal/external expression
 	operators       operators
 	charConversions map[rune]rune
 	charConvEnabled bool
 	doubleQuotes    doubleQuotes
 
+	// ReadLimits bounds the terms read by the parsers of the VM e.g. read_term/3, consult/1, and queries so that a
+	// crafted input can't exhaust the stack or the memory.
+	ReadLimits ReadLimits
+
 	// I/O
 	streams       streams
 	input, output *Stream
 
+	// TrackDerivation enables recording of the clauses which contributed to each solution of every query.
+	// See Derivation and ProofTree. To record them for a single query, see Env.WithDerivation.
+	TrackDerivation bool
+
+	// TrackBacktrace enables recording of the procedures being executed so that exceptions come with their backtraces
+	// including the Go stacks of the foreign predicates which called back into Prolog. See Exception.Backtrace.
+	// It keeps the frames of tail calls. So it's for debugging. current_prolog_flag(debug, on) does the same.
+	TrackBacktrace bool
+
+	// Parallel enables concurrent execution of consecutive goals in clause bodies if they're pure and share no unbound
+	// variables. Each goal starts searching for its solutions right away while the solutions are consumed in the order
+	// of the sequential execution. So the results including failures and errors are the same as the sequential ones.
+	// Goals calling predicates of possibly infinite solutions e.g. repeat/0 aren't run in parallel. See IsPure.
+	Parallel bool
+
+	// Rand is the source of pseudo-random numbers for random/1, random_between/3, and random_permutation/2.
+	// Set it with a fixed seed for reproducible results. Since it's not safe for concurrent use, the VM must not run
+	// queries concurrently while it's set. If it's nil, the global source of math/rand is used.
+	Rand *rand.Rand
+
+	// Clock returns the current time for get_time/1. Set it to control the time in tests. If it's nil, time.Now is used.
+	Clock func() time.Time
+
+	// LoopThreshold is the number of the variants of a goal which may be on the call stack when it's called while
+	// current_prolog_flag(loop_check, error). One more raises loop_error(Cycle). See checkLoop.
+	LoopThreshold int
+	loopCheck     bool
+
+	// Quota limits the resources the VM consumes. See Usage.
+	Quota       Quota
+	usage       Usage
+	measurement *measurement // See Measure.
+
 	// Misc
-	debug bool
+	debug       bool
+	dialect     dialect
+	floundering bool     // See flounderingNegations.
+	encoding    encoding // The encoding of Prolog texts. See decoder.
 }
 
 // Register0 registers a predicate of arity 0.
 func (vm *VM) Register0(name Atom, p Predicate0) {
-	if vm.procedures == nil {
-		vm.procedures = map[procedureIndicator]procedure{}
-	}
-	vm.procedures[procedureIndicator{name: name, arity: 0}] = p
+	vm.register(procedureIndicator{name: name, arity: 0}, p)
 }
 
 // Register1 registers a predicate of arity 1.
 func (vm *VM) Register1(name Atom, p Predicate1) {
-	if vm.procedures == nil {
-		vm.procedures = map[procedureIndicator]procedure{}
-	}
-	vm.procedures[procedureIndicator{name: name, arity: 1}] = p
+	vm.register(procedureIndicator{name: name, arity: 1}, p)
 }
 
 // Register2 registers a predicate of arity 2.
 func (vm *VM) Register2(name Atom, p Predicate2) {
-	if vm.procedures == nil {
-		vm.procedures = map[procedureIndicator]procedure{}
-	}
-	vm.procedures[procedureIndicator{name: name, arity: 2}] = p
+	vm.register(procedureIndicator{name: name, arity: 2}, p)
 }
 
 // Register3 registers a predicate of arity 3.
 func (vm *VM) Register3(name Atom, p Predicate3) {
-	if vm.procedures == nil {
-		vm.procedures = map[procedureIndicator]procedure{}
-	}
-	vm.procedures[procedureIndicator{name: name, arity: 3}] = p
+	vm.register(procedureIndicator{name: name, arity: 3}, p)
 }
 
 // Register4 registers a predicate of arity 4.
 func (vm *VM) Register4(name Atom, p Predicate4) {
-	if vm.procedures == nil {
-		vm.procedures = map[procedureIndicator]procedure{}
-	}
-	vm.procedures[procedureIndicator{name: name, arity: 4}] = p
+	vm.register(procedureIndicator{name: name, arity: 4}, p)
 }
 
 // Register5 registers a predicate of arity 5.
 func (vm *VM) Register5(name Atom, p Predicate5) {
-	if vm.procedures == nil {
-		vm.procedures = map[procedureIndicator]procedure{}
-	}
-	vm.procedures[procedureIndicator{name: name, arity: 5}] = p
+	vm.register(procedureIndicator{name: name, arity: 5}, p)
 }
 
 // Register6 registers a predicate of arity 6.
 func (vm *VM) Register6(name Atom, p Predicate6) {
-	if vm.procedures == nil {
-		vm.procedures = map[procedureIndicator]procedure{}
-	}
-	vm.procedures[procedureIndicator{name: name, arity: 6}] = p
+	vm.register(procedureIndicator{name: name, arity: 6}, p)
 }
 
 // Register7 registers a predicate of arity 7.
 func (vm *VM) Register7(name Atom, p Predicate7) {
-	if vm.procedures == nil {
-		vm.procedures = map[procedureIndicator]procedure{}
-	}
-	vm.procedures[procedureIndicator{name: name, arity: 7}] = p
+	vm.register(procedureIndicator{name: name, arity: 7}, p)
 }
 
 // Register8 registers a predicate of arity 8.
 func (vm *VM) Register8(name Atom, p Predicate8) {
+	vm.register(procedureIndicator{name: name, arity: 8}, p)
+}
+
+// register registers the foreign predicate p. Unless it's a builtin predicate, it's timed by Quota.ForeignCall.
+func (vm *VM) register(pi procedureIndicator, p procedure) {
 	if vm.procedures == nil {
 		vm.procedures = map[procedureIndicator]procedure{}
 	}
-	vm.procedures[procedureIndicator{name: name, arity: 8}] = p
+	vm.procedures[pi] = p
+
+	if isBuiltinFunc(p) {
+		delete(vm.foreign, pi)
+		return
+	}
+	if vm.foreign == nil {
+		vm.foreign = map[procedureIndicator]struct{}{}
+	}
+	vm.foreign[pi] = struct{}{}
+}
+
+// enginePkgPath is the import path of this package.
+var enginePkgPath = reflect.TypeOf(VM{}).PkgPath()
+
+// isBuiltinFunc tells if p is a function declared at the top level of this package e.g. Call or Assertz.
+func isBuiltinFunc(p procedure) bool {
+	v := reflect.ValueOf(p)
+	if v.Kind() != reflect.Func {
+		return false
+	}
+	f := runtime.FuncForPC(v.Pointer())
+	if f == nil {
+		return false
+	}
+	name := strings.TrimPrefix(f.Name(), enginePkgPath+".")
+	return name != f.Name() && !strings.Contains(name, ".")
 }
 
 type unknownAction int
@@ -182,6 +282,7 @@ func (vm *VM) Arrive(name Atom, args []Term, k Cont, env *Env) (promise *Promise
 		switch vm.unknown {
 		case unknownWarning:
 			vm.Unknown(name, args, env)
+			vm.message(context.Background(), SeverityWarning, atomError.Apply(atomExistenceError.Apply(atomProcedure, pi.Term()), pi.Term()))
 			fallthrough
 		case unknownFail:
 			return Bool(false)
@@ -190,36 +291,80 @@ func (vm *VM) Arrive(name Atom, args []Term, k Cont, env *Env) (promise *Promise
 		}
 	}
 
+	if fb, ok := vm.fallbacks[pi]; ok {
+		return vm.callWithFallback(pi, p, fb, args, k, env)
+	}
+	return vm.arrive(pi, p, args, k, env)
+}
+
+// arrive calls the procedure found by Arrive.
+func (vm *VM) arrive(pi procedureIndicator, p procedure, args []Term, k Cont, env *Env) *Promise {
 	// bind the special variable to inform the predicate about the context.
-	env = env.bind(varContext, pi.Term())
+	env = env.bind(varContext, pi.contextTerm())
 
+	if err := vm.infer(env); err != nil {
+		return Error(err)
+	}
+	k, env, err := vm.measure(k, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	k, env, err = vm.checkLoop(pi, p, args, k, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	k, env = vm.enter(pi, p, args, k, env)
+	k = vm.trace(pi, p, k)
+	if vm.Quota.ForeignCall > 0 && vm.isForeign(pi, p) {
+		return vm.callForeign(p, args, k, env)
+	}
 	return p.call(vm, args, k, env)
 }
 
-func (vm *VM) exec(pc bytecode, vars []Variable, cont Cont, args []Term, astack [][]Term, env *Env, cutParent *Promise) *Promise {
+func (vm *VM) exec(pc bytecode, vars []Term, cont Cont, args []Term, astack [][]Term, env *Env, cutParent *Promise) *Promise {
 	var (
 		ok  = true
 		op  instruction
 		arg Term
 	)
 	for ok {
+		if vm.Parallel && !vm.TrackDerivation && len(args) == 0 && len(astack) == 0 && derivationOf(env) == nil {
+			if p, ok := vm.parallel(pc, vars, cont, env, cutParent); ok {
+				return p
+			}
+		}
+
 		op, pc = pc[0], pc[1:]
 		switch opcode, operand := op.opcode, op.operand; opcode {
 		case opGetConst:
 			arg, args = args[0], args[1:]
 			env, ok = env.Unify(arg, operand)
 		case opPutConst:
-			args = append(args, operand)
+			args = push(args, operand)
+		case opGetFirstVar:
+			// The variable appears for the first time. Instead of binding a fresh variable, it takes the argument as is.
+			arg, args = args[0], args[1:]
+			vars[operand.(Integer)] = env.Resolve(arg)
 		case opGetVar:
-			v := vars[operand.(Integer)]
+			v := variable(vars, operand.(Integer))
 			arg, args = args[0], args[1:]
 			env, ok = env.Unify(arg, v)
 		case opPutVar:
-			v := vars[operand.(Integer)]
-			args = append(args, v)
+			v := variable(vars, operand.(Integer))
+			args = push(args, v)
 		case opGetFunctor:
 			pi := operand.(procedureIndicator)
 			arg, astack = env.Resolve(args[0]), append(astack, args[1:])
+			if c, isCompound := arg.(Compound); isCompound && c.Functor() == pi.name && c.Arity() == int(pi.arity) {
+				// Read mode: take the arguments as they are instead of unifying them with fresh variables.
+				args = make([]Term, c.Arity())
+				for i := range args {
+					args[i] = c.Arg(i)
+				}
+				break
+			}
 			args = make([]Term, int(pi.arity))
 			for i := range args {
 				args[i] = NewVariable()
@@ -229,27 +374,51 @@ func (vm *VM) exec(pc bytecode, vars []Variable, cont Cont, args []Term, astack
 			pi := operand.(procedureIndicator)
 			vs := make([]Term, int(pi.arity))
 			arg = pi.name.Apply(vs...)
-			args = append(args, arg)
+			args = push(args, arg)
 			astack = append(astack, args)
 			args = vs[:0]
 		case opPop:
 			args, astack = astack[len(astack)-1], astack[:len(astack)-1]
 		case opEnter:
-			break
+			args = nil // The body builds the arguments of the goals from scratch instead of after the caller's.
 		case opCall:
-			pi := operand.(procedureIndicator)
-			return vm.Arrive(pi.name, args, func(env *Env) *Promise {
-				return vm.exec(pc, vars, cont, nil, nil, env, cutParent)
-			}, env)
+			return vm.call(operand.(procedureIndicator), args, pc, vars, cont, env, cutParent)
+		case opIs:
+			// X is E where X appears for the first time. The value goes to the variable slot without binding.
+			pi := procedureIndicator{name: atomIs, arity: 2}
+			if !vm.isBuiltin(pi, Predicate2(Is)) {
+				v := NewVariable()
+				vars[operand.(Integer)] = v
+				return vm.call(pi, append([]Term{v}, args...), pc, vars, cont, env, cutParent)
+			}
+			env = env.bind(varContext, pi.contextTerm())
+			if err := vm.infer(env); err != nil {
+				return Error(err)
+			}
+			v, err := vm.eval(args[0], env)
+			if err != nil {
+				return Error(err)
+			}
+			vars[operand.(Integer)], args = v, nil
 		case opExit:
 			return cont(env)
 		case opCut:
-			return cut(cutParent, func(context.Context) *Promise {
-				return vm.exec(pc, vars, cont, args, astack, env, cutParent)
-			})
+			return vm.execCut(pc, vars, cont, args, astack, env, cutParent)
+		case opDisj:
+			return vm.execDisj(pc, pc[operand.(Integer):], vars, cont, env, cutParent)
+		case opIfThen:
+			return vm.execIfThen(pc, pc[operand.(Integer):], args[0], vars, cont, env, cutParent)
+		case opSoftCut:
+			return vm.execSoftCut(pc, pc[operand.(Integer):], args[0], vars, cont, env, cutParent)
+		case opJump:
+			pc = pc[operand.(Integer):]
 		case opGetList:
 			l := operand.(Integer)
 			arg, astack = args[0], append(astack, args[1:])
+			if ts, isList := readList(arg, int(l), env); isList && env.Resolve(ts[0]) == atomEmptyList {
+				args = ts[1:]
+				break
+			}
 			args = make([]Term, int(l))
 			for i := range args {
 				args[i] = NewVariable()
@@ -259,12 +428,16 @@ func (vm *VM) exec(pc bytecode, vars []Variable, cont Cont, args []Term, astack
 			l := operand.(Integer)
 			vs := make([]Term, int(l))
 			arg = list(vs)
-			args = append(args, arg)
+			args = push(args, arg)
 			astack = append(astack, args)
 			args = vs[:0]
 		case opGetPartial:
 			l := operand.(Integer)
 			arg, astack = args[0], append(astack, args[1:])
+			if ts, isList := readList(arg, int(l), env); isList {
+				args = ts
+				break
+			}
 			args = make([]Term, int(l+1))
 			for i := range args {
 				args[i] = NewVariable()
@@ -277,7 +450,21 @@ func (vm *VM) exec(pc bytecode, vars []Variable, cont Cont, args []Term, astack
 				Compound: list(vs[1:]),
 				tail:     &vs[0],
 			}
-			args = append(args, arg)
+			args = push(args, arg)
+			astack = append(astack, args)
+			args = vs[:0]
+		case opGetPacked:
+			var tail Term = NewVariable()
+			arg, astack = args[0], append(astack, args[1:])
+			args = []Term{tail}
+			env, ok = env.Unify(arg, &partial{Compound: operand.(Compound), tail: &tail})
+		case opPutPacked:
+			vs := make([]Term, 1)
+			arg = &partial{
+				Compound: operand.(Compound),
+				tail:     &vs[0],
+			}
+			args = push(args, arg)
 			astack = append(astack, args)
 			args = vs[:0]
 		}
@@ -286,8 +473,218 @@ func (vm *VM) exec(pc bytecode, vars []Variable, cont Cont, args []Term, astack
 	return Bool(false)
 }
 
+// push appends t to the arguments being built. Goals usually have a few arguments. So it reserves room for them at
+// once instead of growing the arguments one by one.
+func push(args []Term, t Term) []Term {
+	if cap(args) == 0 {
+		args = make([]Term, 0, 4)
+	}
+	return append(args, t)
+}
+
+// variable returns the i-th variable of the clause. It makes a fresh variable if it's not assigned yet.
+func variable(vars []Term, i Integer) Term {
+	v := vars[i]
+	if v == nil {
+		v = NewVariable()
+		vars[i] = v
+	}
+	return v
+}
+
+// readList returns the rest of list t followed by the first n elements of it for the read mode of opGetList and
+// opGetPartial. It's false if t doesn't have n elements without binding variables.
+func readList(t Term, n int, env *Env) ([]Term, bool) {
+	if c, ok := env.Resolve(t).(Compound); !ok || c.Functor() != atomDot || c.Arity() != 2 {
+		return nil, false
+	}
+	ts := make([]Term, n+1)
+	for i := 1; i <= n; i++ {
+		c, ok := env.Resolve(t).(Compound)
+		if !ok || c.Functor() != atomDot || c.Arity() != 2 {
+			return nil, false
+		}
+		ts[i], t = c.Arg(0), c.Arg(1)
+	}
+	ts[0] = t
+	return ts, true
+}
+
+// The instructions which make closures are executed by the methods below instead of exec itself.
+// Otherwise, the closures would move the arguments of every exec to the heap.
+
+func (vm *VM) execCut(pc bytecode, vars []Term, cont Cont, args []Term, astack [][]Term, env *Env, cutParent *Promise) *Promise {
+	return cut(cutParent, func(context.Context) *Promise {
+		return vm.exec(pc, vars, cont, args, astack, env, cutParent)
+	})
+}
+
+func (vm *VM) execDisj(pc, alt bytecode, vars []Term, cont Cont, env *Env, cutParent *Promise) *Promise {
+	// Both branches share the cut parent of the clause so that a cut in either branch is transparent.
+	return Delay(func(context.Context) *Promise {
+		return vm.exec(pc, vars, cont, nil, nil, env, cutParent)
+	}, func(context.Context) *Promise {
+		return vm.exec(alt, vars, cont, nil, nil, env, cutParent)
+	})
+}
+
+func (vm *VM) execIfThen(pc, alt bytecode, cond Term, vars []Term, cont Cont, env *Env, cutParent *Promise) *Promise {
+	// The condition is opaque to cut as it's called by call/1.
+	// Once it succeeds, we cut back to the if-then-else which eliminates the else branch.
+	var p *Promise
+	p = Delay(func(context.Context) *Promise {
+		return Call(vm, cond, func(env *Env) *Promise {
+			return cut(p, func(context.Context) *Promise {
+				return vm.exec(pc, vars, cont, nil, nil, env, cutParent)
+			})
+		}, env)
+	}, func(context.Context) *Promise {
+		return vm.exec(alt, vars, cont, nil, nil, env, cutParent)
+	})
+	return p
+}
+
+func (vm *VM) execSoftCut(pc, alt bytecode, cond Term, vars []Term, cont Cont, env *Env, cutParent *Promise) *Promise {
+	// Unlike execIfThen, we keep the choice points of the condition and take the else branch only if it has no solutions.
+	var found bool
+	return Delay(func(context.Context) *Promise {
+		return Call(vm, cond, func(env *Env) *Promise {
+			found = true
+			return vm.exec(pc, vars, cont, nil, nil, env, cutParent)
+		}, env)
+	}, func(context.Context) *Promise {
+		if found {
+			return Bool(false)
+		}
+		return vm.exec(alt, vars, cont, nil, nil, env, cutParent)
+	})
+}
+
+func (vm *VM) call(pi procedureIndicator, args []Term, pc bytecode, vars []Term, cont Cont, env *Env, cutParent *Promise) *Promise {
+	if pc.exits() { // Last call: we don't need to come back to this clause.
+		return vm.Arrive(pi.name, args, cont, env)
+	}
+	return vm.Arrive(pi.name, args, func(env *Env) *Promise {
+		return vm.exec(pc, vars, cont, nil, nil, env, cutParent)
+	}, env)
+}
+
+// isBuiltin tells if the procedure is the builtin predicate p and not replaced by another.
+func (vm *VM) isBuiltin(pi procedureIndicator, p procedure) bool {
+	q, ok := vm.procedures[pi]
+	if !ok {
+		return false
+	}
+	pv, qv := reflect.ValueOf(p), reflect.ValueOf(q)
+	return pv.Type() == qv.Type() && pv.Kind() == reflect.Func && pv.Pointer() == qv.Pointer()
+}
+
+// dbMuInit guards the lazy creation of the locks of the databases.
+var dbMuInit sync.Mutex
+
+// database returns the lock of the database i.e. the procedures, the records, and the loaded texts. Fork holds it for
+// reading while it copies them and the predicates which modify them e.g. assertz/1 and retract/1 hold it for writing
+// so that a VM can be forked while another goroutine is running queries on it. The flags, the operators, and the
+// streams aren't guarded.
+func (vm *VM) database() *sync.RWMutex {
+	dbMuInit.Lock()
+	defer dbMuInit.Unlock()
+	if vm.dbMu == nil {
+		vm.dbMu = &sync.RWMutex{}
+	}
+	return vm.dbMu
+}
+
+// Fork returns a new VM which starts with the same procedures, records, flags, and operators as vm.
+// Changes to either VM aren't visible to the other so that they can run concurrently.
+// The static procedures share their clauses since they're immutable.
+// The streams including user_input and user_output are shared. Use SetUserInput/SetUserOutput to replace them.
+// Closing a shared stream by close/1 in the new VM only removes it from the new VM and leaves it open for vm.
+// Usage of the new VM starts from zero while Quota is inherited.
+// It's safe to call Fork while vm is running queries which modify the database. See database.
+func (vm *VM) Fork() *VM {
+	db := vm.database()
+	db.RLock()
+	defer db.RUnlock()
+
+	f := *vm
+	f.dbMu = nil
+	f.usage = Usage{}
+
+	f.procedures = make(map[procedureIndicator]procedure, len(vm.procedures))
+	for pi, p := range vm.procedures {
+		if u, ok := p.(*userDefined); ok {
+			p = u.fork()
+		}
+		f.procedures[pi] = p
+	}
+
+	f.pures = make(map[procedureIndicator]struct{}, len(vm.pures))
+	for pi := range vm.pures {
+		f.pures[pi] = struct{}{}
+	}
+	f.purity = &purityCache{}
+
+	f.foreign = make(map[procedureIndicator]struct{}, len(vm.foreign))
+	for pi := range vm.foreign {
+		f.foreign[pi] = struct{}{}
+	}
+
+	f.generators = make(map[Atom]func() Generator, len(vm.generators))
+	for k, v := range vm.generators {
+		f.generators[k] = v
+	}
+
+	f.constants = make(map[Atom]Number, len(vm.constants))
+	for k, v := range vm.constants {
+		f.constants[k] = v
+	}
+
+	f.fallbacks = make(map[procedureIndicator]fallback, len(vm.fallbacks))
+	for k, v := range vm.fallbacks {
+		f.fallbacks[k] = v
+	}
+
+	// Slices of records are never modified in place.
+	f.records = make(map[recordKey][]*DBRef, len(vm.records))
+	for k, rs := range vm.records {
+		f.records[k] = rs
+	}
+	f.recordKeys = vm.recordKeys[:len(vm.recordKeys):len(vm.recordKeys)]
+
+	f.loaded = make(map[string]struct{}, len(vm.loaded))
+	for k, v := range vm.loaded {
+		f.loaded[k] = v
+	}
+
+	f.initialization = vm.initialization[:len(vm.initialization):len(vm.initialization)]
+
+	f.operators = make(operators, len(vm.operators))
+	for k, v := range vm.operators {
+		f.operators[k] = v
+	}
+
+	f.charConversions = make(map[rune]rune, len(vm.charConversions))
+	for k, v := range vm.charConversions {
+		f.charConversions[k] = v
+	}
+
+	f.streams = streams{
+		elems:   append([]*Stream(nil), vm.streams.elems...),
+		aliases: make(map[Atom]*Stream, len(vm.streams.aliases)),
+	}
+	for k, v := range vm.streams.aliases {
+		f.streams.aliases[k] = v
+	}
+
+	return &f
+}
+
 // SetUserInput sets the given stream as user_input.
 func (vm *VM) SetUserInput(s *Stream) {
+	if old, ok := vm.streams.lookup(atomUserInput); ok {
+		vm.streams.remove(old)
+	}
 	s.vm = vm
 	s.alias = atomUserInput
 	vm.streams.add(s)
@@ -296,6 +693,9 @@ func (vm *VM) SetUserInput(s *Stream) {
 
 // SetUserOutput sets the given stream as user_output.
 func (vm *VM) SetUserOutput(s *Stream) {
+	if old, ok := vm.streams.lookup(atomUserOutput); ok {
+		vm.streams.remove(old)
+	}
 	s.vm = vm
 	s.alias = atomUserOutput
 	vm.streams.add(s)
@@ -444,6 +844,33 @@ func (p procedureIndicator) Term() Term {
 	return atomSlash.Apply(p.name, p.arity)
 }
 
+// contextTable memoizes the procedure indicators bound to the context of calls.
+var contextTable = struct {
+	sync.RWMutex
+	terms map[procedureIndicator]Term
+}{
+	terms: map[procedureIndicator]Term{},
+}
+
+// contextTerm returns p as term just like Term but without allocating it for every call of the procedure.
+func (p procedureIndicator) contextTerm() Term {
+	contextTable.RLock()
+	t, ok := contextTable.terms[p]
+	contextTable.RUnlock()
+	if ok {
+		return t
+	}
+
+	contextTable.Lock()
+	defer contextTable.Unlock()
+	t, ok = contextTable.terms[p]
+	if !ok {
+		t = p.Term()
+		contextTable.terms[p] = t
+	}
+	return t
+}
+
 // Apply applies p to args.
 func (p procedureIndicator) Apply(args ...Term) (Term, error) {
 	if p.arity != Integer(len(args)) {
@@ -245,6 +245,122 @@ func TestVM_Arrive(t *testing.T) {
 	})
 }
 
+func TestVM_exec_packed(t *testing.T) {
+	// prefix("ab"||T, T) :- rest("cd"||T).
+	tail := NewVariable()
+	cs, err := compile(atomIf.Apply(
+		NewAtom("prefix").Apply(PartialCodeList("ab", tail), tail),
+		NewAtom("rest").Apply(PartialCodeList("cd", tail)),
+	), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, bytecode{
+		{opcode: opGetPacked, operand: codeList("ab")},
+		{opcode: opGetFirstVar, operand: Integer(0)},
+		{opcode: opPop},
+		{opcode: opGetVar, operand: Integer(0)},
+		{opcode: opEnter},
+		{opcode: opPutPacked, operand: codeList("cd")},
+		{opcode: opPutVar, operand: Integer(0)},
+		{opcode: opPop},
+		{opcode: opCall, operand: procedureIndicator{name: NewAtom("rest"), arity: 1}},
+		{opcode: opExit},
+	}, cs[0].bytecode)
+
+	var vm VM
+	vm.procedures = map[procedureIndicator]procedure{
+		{name: NewAtom("prefix"), arity: 2}: &userDefined{clauses: cs},
+		{name: NewAtom("rest"), arity: 1}: Predicate1(func(_ *VM, l Term, k Cont, env *Env) *Promise {
+			return Unify(nil, l, CodeList("cdxy"), k, env)
+		}),
+	}
+	x := NewVariable()
+	ok, err := vm.Arrive(NewAtom("prefix"), []Term{CodeList("abxy"), x}, func(env *Env) *Promise {
+		assert.Equal(t, CodeList("xy"), env.Resolve(x))
+		return Bool(true)
+	}, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestVM_exec_firstVar(t *testing.T) {
+	// succ(X, Y) :- Z is X + 1, Y = Z.
+	x, y, z := NewVariable(), NewVariable(), NewVariable()
+	cs, err := compile(atomIf.Apply(
+		NewAtom("succ").Apply(x, y),
+		atomComma.Apply(atomIs.Apply(z, atomPlus.Apply(x, Integer(1))), atomEqual.Apply(y, z)),
+	), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, bytecode{
+		{opcode: opGetFirstVar, operand: Integer(0)},
+		{opcode: opGetFirstVar, operand: Integer(1)},
+		{opcode: opEnter},
+		{opcode: opPutFunctor, operand: procedureIndicator{name: atomPlus, arity: 2}},
+		{opcode: opPutVar, operand: Integer(0)},
+		{opcode: opPutConst, operand: Integer(1)},
+		{opcode: opPop},
+		{opcode: opIs, operand: Integer(2)},
+		{opcode: opPutVar, operand: Integer(1)},
+		{opcode: opPutVar, operand: Integer(2)},
+		{opcode: opCall, operand: procedureIndicator{name: atomEqual, arity: 2}},
+		{opcode: opExit},
+	}, cs[0].bytecode)
+
+	t.Run("builtin", func(t *testing.T) {
+		var vm VM
+		vm.procedures = map[procedureIndicator]procedure{
+			{name: NewAtom("succ"), arity: 2}: &userDefined{clauses: cs},
+			{name: atomIs, arity: 2}:          Predicate2(Is),
+			{name: atomEqual, arity: 2}:       Predicate2(Unify),
+		}
+
+		// The arguments are taken as they are and the result of is/2 doesn't go through the environment.
+		// So b is directly bound to the value instead of a chain of variables from the clause.
+		b := NewVariable()
+		ok, err := vm.Arrive(NewAtom("succ"), []Term{Integer(1), b}, func(env *Env) *Promise {
+			v, ok := env.lookup(b)
+			assert.True(t, ok)
+			assert.Equal(t, Integer(2), v)
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("replaced", func(t *testing.T) {
+		var called bool
+		var vm VM
+		vm.procedures = map[procedureIndicator]procedure{
+			{name: NewAtom("succ"), arity: 2}: &userDefined{clauses: cs},
+			{name: atomIs, arity: 2}: Predicate2(func(vm *VM, result, expression Term, k Cont, env *Env) *Promise {
+				called = true
+				return Is(vm, result, expression, k, env)
+			}),
+			{name: atomEqual, arity: 2}: Predicate2(Unify),
+		}
+
+		b := NewVariable()
+		ok, err := vm.Arrive(NewAtom("succ"), []Term{Integer(1), b}, func(env *Env) *Promise {
+			assert.Equal(t, Integer(2), env.Resolve(b))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.True(t, called)
+	})
+
+	t.Run("evaluation error", func(t *testing.T) {
+		var vm VM
+		vm.procedures = map[procedureIndicator]procedure{
+			{name: NewAtom("succ"), arity: 2}: &userDefined{clauses: cs},
+			{name: atomIs, arity: 2}:          Predicate2(Is),
+		}
+
+		// The error comes from is/2 as if it's called.
+		_, err := vm.Arrive(NewAtom("succ"), []Term{NewVariable(), NewVariable()}, Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(NewEnv().bind(varContext, atomSlash.Apply(atomIs, Integer(2)))), err)
+	})
+}
+
 func TestVM_SetUserInput(t *testing.T) {
 	t.Run("file", func(t *testing.T) {
 		var vm VM
@@ -283,3 +399,82 @@ func TestProcedureIndicator_Apply(t *testing.T) {
 		assert.Nil(t, c)
 	})
 }
+
+func TestVM_Fork(t *testing.T) {
+	foo, bar := NewAtom("foo"), NewAtom("bar")
+
+	var vm VM
+	vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+	vm.operators.define(1200, operatorSpecifierFX, atomIf)
+	vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+	vm.Quota.Clauses = 10
+	assert.NoError(t, vm.Compile(context.Background(), `
+:- dynamic(foo/1).
+:- index(foo/1, [1]).
+foo(a).
+foo(b).
+bar(a).
+`))
+
+	f := vm.Fork()
+	assert.Equal(t, vm.Quota, f.Quota)
+	assert.Equal(t, Usage{}, f.Usage())
+
+	ok, err := Retract(f, foo.Apply(NewAtom("a")), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = Assertz(f, foo.Apply(NewAtom("c")), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.NoError(t, f.Compile(context.Background(), `bar(b).`))
+	f.operators.define(700, operatorSpecifierXFX, NewAtom("===>"))
+
+	solutions := func(vm *VM, name Atom) []Term {
+		var ret []Term
+		x := NewVariable()
+		_, err := vm.Arrive(name, []Term{x}, func(env *Env) *Promise {
+			ret = append(ret, env.Resolve(x))
+			return Bool(false)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		return ret
+	}
+	assert.Equal(t, []Term{NewAtom("a"), NewAtom("b")}, solutions(&vm, foo))
+	assert.Equal(t, []Term{NewAtom("b"), NewAtom("c")}, solutions(f, foo))
+	assert.Equal(t, []Term{NewAtom("a")}, solutions(&vm, bar))
+	assert.Equal(t, []Term{NewAtom("b")}, solutions(f, bar))
+	assert.False(t, vm.operators.defined(NewAtom("===>")))
+	assert.NotSame(t, vm.procedures[procedureIndicator{name: foo, arity: 1}].(*userDefined).indexes[0], f.procedures[procedureIndicator{name: foo, arity: 1}].(*userDefined).indexes[0])
+}
+
+func TestVM_Fork_concurrent(t *testing.T) {
+	foo := NewAtom("foo")
+
+	var vm VM
+	vm.operators.define(1200, operatorSpecifierFX, atomIf)
+	vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+	assert.NoError(t, vm.Compile(context.Background(), `:- dynamic(foo/1).`))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			ok, err := Assertz(&vm, foo.Apply(Integer(i)), Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			ok, err = Retract(&vm, foo.Apply(Integer(i)), Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			ok, err = Recordz(&vm, foo, Integer(i), NewVariable(), Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		f := vm.Fork()
+		u := f.procedures[procedureIndicator{name: foo, arity: 1}].(*userDefined)
+		assert.LessOrEqual(t, len(u.clauses), 1)
+	}
+	<-done
+}
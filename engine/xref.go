@@ -0,0 +1,62 @@
+package engine
+
+// UndefinedCalls returns the predicate indicators of the procedures which the body of clause calls but which are
+// neither defined, declared e.g. dynamic, nor foreign at the moment. They're in the order of appearance without
+// duplicates. The goals given at runtime e.g. call(G) aren't examined. It tells the misspelled predicates.
+func (vm *VM) UndefinedCalls(clause Term) []Term {
+	c, ok := clause.(Compound)
+	if !ok || c.Functor() != atomIf || c.Arity() != 2 {
+		return nil
+	}
+	x := xref{vm: vm, seen: map[procedureIndicator]struct{}{}}
+	x.goal(c.Arg(1), 0)
+	return x.undefined
+}
+
+type xref struct {
+	vm        *VM
+	seen      map[procedureIndicator]struct{}
+	undefined []Term
+}
+
+// goal examines the goal which is called with extra arguments.
+func (x *xref) goal(g Term, extra int) {
+	var (
+		pi   procedureIndicator
+		args []Term
+	)
+	switch g := g.(type) {
+	case Atom:
+		if g == atomCut && extra == 0 {
+			return
+		}
+		pi = procedureIndicator{name: g, arity: Integer(extra)}
+	case Compound:
+		pi = procedureIndicator{name: g.Functor(), arity: Integer(g.Arity() + extra)}
+		args = make([]Term, g.Arity())
+		for i := range args {
+			args[i] = g.Arg(i)
+		}
+	default: // Variables are given at runtime. The others raise type errors.
+		return
+	}
+
+	if spec, ok := metaPredicates[pi]; ok {
+		for i, n := range spec {
+			if n < 0 || i >= len(args) {
+				continue
+			}
+			x.goal(args[i], n)
+		}
+		return
+	}
+
+	if _, ok := x.vm.procedures[pi]; ok {
+		return
+	}
+	if _, ok := x.seen[pi]; ok {
+		return
+	}
+	x.seen[pi] = struct{}{}
+	x.undefined = append(x.undefined, pi.Term())
+}
@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVM_UndefinedCalls(t *testing.T) {
+	var vm VM
+	vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+	vm.operators.define(1200, operatorSpecifierFX, atomIf)
+	vm.operators.define(1100, operatorSpecifierXFY, atomSemiColon)
+	vm.operators.define(1050, operatorSpecifierXFY, atomThen)
+	vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+	vm.operators.define(900, operatorSpecifierFY, atomNegation)
+	vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+	vm.Register1(NewAtom("write"), func(_ *VM, _ Term, k Cont, env *Env) *Promise {
+		return k(env)
+	})
+	assert.NoError(t, vm.Compile(context.Background(), `
+:- dynamic(counter/1).
+fact(a).
+`))
+
+	tests := []struct {
+		clause    string
+		undefined []Term
+	}{
+		{clause: `fact(b).`},
+		{clause: `p :- fact(X), write(X), counter(_), !.`},
+		{clause: `p :- fakt(X), write(X), fakt(Y), wirte(Y).`, undefined: []Term{
+			atomSlash.Apply(NewAtom("fakt"), Integer(1)),
+			atomSlash.Apply(NewAtom("wirte"), Integer(1)),
+		}},
+		{clause: `p :- (a -> \+ b ; c), findall(X, d(X), _).`, undefined: []Term{
+			atomSlash.Apply(NewAtom("a"), Integer(0)),
+			atomSlash.Apply(NewAtom("b"), Integer(0)),
+			atomSlash.Apply(NewAtom("c"), Integer(0)),
+			atomSlash.Apply(NewAtom("d"), Integer(1)),
+		}},
+		{clause: `p(G) :- call(G), call(q, a), maplist(fact, [a]).`, undefined: []Term{
+			atomSlash.Apply(NewAtom("q"), Integer(1)),
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.clause, func(t *testing.T) {
+			c, err := NewParser(&vm, strings.NewReader(tt.clause)).Term()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.undefined, vm.UndefinedCalls(c))
+		})
+	}
+}
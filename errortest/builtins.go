@@ -0,0 +1,295 @@
+package errortest
+
+// Builtins is the golden suite of the error conditions of the builtin predicates. Most of them are from ISO/IEC
+// 13211-1 and its corrigenda.
+var Builtins = []Case{
+	// Control constructs
+	{Goal: `call(_)`, Error: `instantiation_error`},
+	{Goal: `call(1)`, Error: `type_error(callable, 1)`},
+	{Goal: `call((fail, 1))`, Error: `type_error(callable, (fail, 1))`},
+	{Goal: `call((write(3), 1))`, Error: `type_error(callable, (write(3), 1))`},
+	{Goal: `call((1; true))`, Error: `type_error(callable, (1; true))`},
+	{Goal: `call(errortest_undefined)`, Error: `existence_error(procedure, errortest_undefined/0)`},
+	{Goal: `call(_, a)`, Error: `instantiation_error`},
+	{Goal: `call(1, a)`, Error: `type_error(callable, 1)`},
+	{Goal: `throw(_)`, Error: `instantiation_error`},
+	{Goal: `setup_call_cleanup(_, true, true)`, Error: `instantiation_error`},
+	{Goal: `setup_call_cleanup(1, true, true)`, Error: `type_error(callable, 1)`},
+	{Goal: `\+ _`, Error: `instantiation_error`},
+	{Goal: `\+ 3`, Error: `type_error(callable, 3)`},
+
+	// Term comparison
+	{Goal: `compare(foo, a, b)`, Error: `domain_error(order, foo)`},
+	{Goal: `compare(1, a, b)`, Error: `type_error(atom, 1)`},
+	{Goal: `sort(_, _)`, Error: `instantiation_error`},
+	{Goal: `sort([a|_], _)`, Error: `instantiation_error`},
+	{Goal: `sort([a|b], _)`, Error: `type_error(list, [a|b])`},
+	{Goal: `sort(foo, _)`, Error: `type_error(list, foo)`},
+	{Goal: `sort([], [a|b])`, Error: `type_error(list, [a|b])`},
+	{Goal: `msort(_, _)`, Error: `instantiation_error`},
+	{Goal: `keysort(_, _)`, Error: `instantiation_error`},
+	{Goal: `keysort([a], _)`, Error: `type_error(pair, a)`},
+	{Goal: `keysort([_], _)`, Error: `instantiation_error`},
+	{Goal: `keysort([a-1|b], _)`, Error: `type_error(list, [a-1|b])`},
+
+	// Term creation and decomposition
+	{Goal: `functor(_, _, _)`, Error: `instantiation_error`},
+	{Goal: `functor(_, foo, _)`, Error: `instantiation_error`},
+	{Goal: `functor(_, foo, a)`, Error: `type_error(integer, a)`},
+	{Goal: `functor(_, foo(a), 1)`, Error: `type_error(atomic, foo(a))`},
+	{Goal: `functor(_, 1.5, 1)`, Error: `type_error(atom, 1.5)`},
+	{Goal: `functor(_, foo, -1)`, Error: `domain_error(not_less_than_zero, -1)`},
+	{Goal: `arg(a, foo(a), _)`, Error: `type_error(integer, a)`},
+	{Goal: `arg(1, _, _)`, Error: `instantiation_error`},
+	{Goal: `arg(1, atom, _)`, Error: `type_error(compound, atom)`},
+	{Goal: `arg(1, 3, _)`, Error: `type_error(compound, 3)`},
+	{Goal: `_ =.. _`, Error: `instantiation_error`},
+	{Goal: `_ =.. [foo|_]`, Error: `instantiation_error`},
+	{Goal: `_ =.. [foo|bar]`, Error: `type_error(list, [foo|bar])`},
+	{Goal: `_ =.. [_, bar]`, Error: `instantiation_error`},
+	{Goal: `_ =.. [3, 1]`, Error: `type_error(atom, 3)`},
+	{Goal: `_ =.. [1.1, foo]`, Error: `type_error(atom, 1.1)`},
+	{Goal: `_ =.. [a(b), 1]`, Error: `type_error(atom, a(b))`},
+	{Goal: `_ =.. 4`, Error: `type_error(list, 4)`},
+	{Goal: `_ =.. [f(a)]`, Error: `type_error(atomic, f(a))`},
+	{Goal: `_ =.. []`, Error: `domain_error(non_empty_list, [])`},
+
+	// Arithmetic evaluation
+	{Goal: `_ is _`, Error: `instantiation_error`},
+	{Goal: `_ is 1 + _`, Error: `instantiation_error`},
+	{Goal: `_ is foo`, Error: `type_error(evaluable, foo/0)`},
+	{Goal: `_ is foo(1)`, Error: `type_error(evaluable, foo/1)`},
+	{Goal: `_ is foo(1, 2)`, Error: `type_error(evaluable, foo/2)`},
+	{Goal: `_ is 1 / 0`, Error: `evaluation_error(zero_divisor)`},
+	{Goal: `_ is 1 // 0`, Error: `evaluation_error(zero_divisor)`},
+	{Goal: `_ is 1 mod 0`, Error: `evaluation_error(zero_divisor)`},
+	{Goal: `_ is 1 rem 0`, Error: `evaluation_error(zero_divisor)`},
+	{Goal: `_ is 1 div 0`, Error: `evaluation_error(zero_divisor)`},
+	{Goal: `_ is 7.0 // 2`, Error: `type_error(integer, 7.0)`},
+	{Goal: `_ is 7.5 mod 2`, Error: `type_error(integer, 7.5)`},
+	{Goal: `_ is 7 rem 2.0`, Error: `type_error(integer, 2.0)`},
+	{Goal: `_ is 1 << 1.0`, Error: `type_error(integer, 1.0)`},
+	{Goal: `_ is 1.0 >> 1`, Error: `type_error(integer, 1.0)`},
+	{Goal: `_ is 1.0 /\ 1`, Error: `type_error(integer, 1.0)`},
+	{Goal: `_ is 1 \/ 1.0`, Error: `type_error(integer, 1.0)`},
+	{Goal: `_ is \ 1.0`, Error: `type_error(integer, 1.0)`},
+	{Goal: `_ is log(0)`, Error: `evaluation_error(undefined)`},
+	{Goal: `_ is log(-1)`, Error: `evaluation_error(undefined)`},
+	{Goal: `_ is sqrt(-1)`, Error: `evaluation_error(undefined)`},
+	{Goal: `_ is max_tagged_integer + 1`, Error: `evaluation_error(int_overflow)`},
+	{Goal: `_ is 2 ^ -1`, Error: `type_error(float, 2)`},
+	{Goal: `1 =:= _`, Error: `instantiation_error`},
+	{Goal: `_ =\= 1`, Error: `instantiation_error`},
+	{Goal: `a < 1`, Error: `type_error(evaluable, a/0)`},
+	{Goal: `1 =< foo(1)`, Error: `type_error(evaluable, foo/1)`},
+	{Goal: `1 > 1 / 0`, Error: `evaluation_error(zero_divisor)`},
+	{Goal: `_ >= 1`, Error: `instantiation_error`},
+
+	// Clause retrieval and information
+	{Goal: `clause(_, _)`, Error: `instantiation_error`},
+	{Goal: `clause(4, _)`, Error: `type_error(callable, 4)`},
+	{Goal: `clause(f(_), 5)`, Error: `type_error(callable, 5)`},
+	{Goal: `clause(atom(_), _)`, Error: `permission_error(access, private_procedure, atom/1)`},
+	{Goal: `current_predicate(4)`, Error: `type_error(predicate_indicator, 4)`},
+	{Goal: `current_predicate(dog)`, Error: `type_error(predicate_indicator, dog)`},
+	{Goal: `current_predicate(0/dog)`, Error: `type_error(predicate_indicator, 0/dog)`},
+
+	// Clause creation and destruction
+	{Goal: `asserta(_)`, Error: `instantiation_error`},
+	{Goal: `asserta(4)`, Error: `type_error(callable, 4)`},
+	{Goal: `asserta((foo :- 4))`, Error: `type_error(callable, 4)`},
+	{Goal: `asserta((atom(_) :- true))`, Error: `permission_error(modify, static_procedure, atom/1)`},
+	{Goal: `assertz(_)`, Error: `instantiation_error`},
+	{Goal: `assertz(4)`, Error: `type_error(callable, 4)`},
+	{Goal: `assertz((foo :- 4))`, Error: `type_error(callable, 4)`},
+	{Goal: `assertz((atom(_) :- true))`, Error: `permission_error(modify, static_procedure, atom/1)`},
+	{Goal: `retract((_ :- true))`, Error: `instantiation_error`},
+	{Goal: `retract((4 :- _))`, Error: `type_error(callable, 4)`},
+	{Goal: `retract((atom(_) :- _ == []))`, Error: `permission_error(modify, static_procedure, atom/1)`},
+	{Goal: `abolish(_)`, Error: `instantiation_error`},
+	{Goal: `abolish(foo/_)`, Error: `instantiation_error`},
+	{Goal: `abolish(foo)`, Error: `type_error(predicate_indicator, foo)`},
+	{Goal: `abolish(foo(_))`, Error: `type_error(predicate_indicator, foo(_))`},
+	{Goal: `abolish(foo/a)`, Error: `type_error(integer, a)`},
+	{Goal: `abolish(foo/(-1))`, Error: `domain_error(not_less_than_zero, -1)`},
+	{Goal: `abolish(5/2)`, Error: `type_error(atom, 5)`},
+	{Goal: `abolish(abolish/1)`, Error: `permission_error(modify, static_procedure, abolish/1)`},
+	{Goal: `erase(_)`, Error: `instantiation_error`},
+	{Goal: `erase(foo)`, Error: `type_error(db_reference, foo)`},
+
+	// Recorded database
+	{Goal: `recorda(_, a, _)`, Error: `instantiation_error`},
+	{Goal: `recordz(_, a, _)`, Error: `instantiation_error`},
+
+	// All solutions
+	{Goal: `findall(_, _, _)`, Error: `instantiation_error`},
+	{Goal: `findall(_, 4, _)`, Error: `type_error(callable, 4)`},
+	{Goal: `findall(_, true, [_|1])`, Error: `type_error(list, [_|1])`},
+	{Goal: `bagof(_, _, _)`, Error: `instantiation_error`},
+	{Goal: `bagof(_, 1, _)`, Error: `type_error(callable, 1)`},
+	{Goal: `bagof(X, _^_, _)`, Error: `instantiation_error`},
+	{Goal: `setof(_, _, _)`, Error: `instantiation_error`},
+	{Goal: `setof(_, 1, _)`, Error: `type_error(callable, 1)`},
+	{Goal: `aggregate_all(_, true, _)`, Error: `instantiation_error`},
+	{Goal: `aggregate_all(foo, true, _)`, Error: `domain_error(aggregate_spec, foo)`},
+
+	// Stream selection and control
+	{Goal: `current_input(foo)`, Error: `domain_error(stream, foo)`},
+	{Goal: `current_output(foo)`, Error: `domain_error(stream, foo)`},
+	{Goal: `set_input(_)`, Error: `instantiation_error`},
+	{Goal: `set_input(1)`, Error: `domain_error(stream_or_alias, 1)`},
+	{Goal: `set_input(foo)`, Error: `existence_error(stream, foo)`},
+	{Goal: `set_input(user_output)`, Error: `permission_error(input, stream, user_output)`},
+	{Goal: `set_output(_)`, Error: `instantiation_error`},
+	{Goal: `set_output(foo)`, Error: `existence_error(stream, foo)`},
+	{Goal: `set_output(user_input)`, Error: `permission_error(output, stream, user_input)`},
+	{Goal: `open(_, read, _)`, Error: `instantiation_error`},
+	{Goal: `open(f, _, _)`, Error: `instantiation_error`},
+	{Goal: `open(f, 1, _)`, Error: `type_error(atom, 1)`},
+	{Goal: `open(f, badmode, _)`, Error: `domain_error(io_mode, badmode)`},
+	{Goal: `open(f(x), read, _)`, Error: `domain_error(source_sink, f(x))`},
+	{Goal: `open('/errortest/nonexistent', read, _)`, Error: `existence_error(source_sink, '/errortest/nonexistent')`},
+	{Goal: `close(_)`, Error: `instantiation_error`},
+	{Goal: `close(foo)`, Error: `existence_error(stream, foo)`},
+	{Goal: `close(1)`, Error: `domain_error(stream_or_alias, 1)`},
+	{Goal: `close(user_input, [force(maybe)])`, Error: `domain_error(close_option, force(maybe))`},
+	{Goal: `close(user_input, foo)`, Error: `type_error(list, foo)`},
+	{Goal: `flush_output(_)`, Error: `instantiation_error`},
+	{Goal: `flush_output(foo)`, Error: `existence_error(stream, foo)`},
+	{Goal: `flush_output(user_input)`, Error: `permission_error(output, stream, user_input)`},
+	{Goal: `stream_property(foo, _)`, Error: `domain_error(stream, foo)`},
+	{Goal: `stream_property(_, foo)`, Error: `domain_error(stream_property, foo)`},
+	{Goal: `at_end_of_stream(_)`, Error: `instantiation_error`},
+	{Goal: `set_stream_position(_, _)`, Error: `instantiation_error`},
+	{Goal: `set_stream_position(user_input, _)`, Error: `instantiation_error`},
+
+	// Character input/output
+	{Goal: `get_char(_, _)`, Error: `instantiation_error`},
+	{Goal: `get_char(user_output, _)`, Error: `permission_error(input, stream, user_output)`},
+	{Goal: `get_char(user_input, 1)`, Error: `type_error(in_character, 1)`},
+	{Goal: `peek_char(user_output, _)`, Error: `permission_error(input, stream, user_output)`},
+	{Goal: `peek_char(user_input, 1)`, Error: `type_error(in_character, 1)`},
+	{Goal: `put_char(_, a)`, Error: `instantiation_error`},
+	{Goal: `put_char(user_output, _)`, Error: `instantiation_error`},
+	{Goal: `put_char(user_output, ab)`, Error: `type_error(character, ab)`},
+	{Goal: `put_char(user_output, 1)`, Error: `type_error(character, 1)`},
+	{Goal: `put_char(user_input, a)`, Error: `permission_error(output, stream, user_input)`},
+
+	// Byte input/output
+	{Goal: `get_byte(_, _)`, Error: `instantiation_error`},
+	{Goal: `get_byte(user_input, _)`, Error: `permission_error(input, text_stream, user_input)`},
+	{Goal: `get_byte(user_input, foo)`, Error: `type_error(in_byte, foo)`},
+	{Goal: `peek_byte(user_input, _)`, Error: `permission_error(input, text_stream, user_input)`},
+	{Goal: `put_byte(user_output, _)`, Error: `instantiation_error`},
+	{Goal: `put_byte(user_output, 65)`, Error: `permission_error(output, text_stream, user_output)`},
+	{Goal: `put_byte(user_output, 256)`, Error: `type_error(byte, 256)`},
+
+	// Term input/output
+	{Goal: `read_term(_, _, [])`, Error: `instantiation_error`},
+	{Goal: `read_term(user_input, _, _)`, Error: `instantiation_error`},
+	{Goal: `read_term(user_input, _, foo)`, Error: `type_error(list, foo)`},
+	{Goal: `read_term(user_input, _, [foo])`, Error: `domain_error(read_option, foo)`},
+	{Goal: `read_term(user_output, _, [])`, Error: `permission_error(input, stream, user_output)`},
+	{Goal: `write_term(_, a, [])`, Error: `instantiation_error`},
+	{Goal: `write_term(user_output, a, _)`, Error: `instantiation_error`},
+	{Goal: `write_term(user_output, a, [_])`, Error: `instantiation_error`},
+	{Goal: `write_term(user_output, a, foo)`, Error: `type_error(list, foo)`},
+	{Goal: `write_term(user_output, a, [quoted(maybe)])`, Error: `domain_error(write_option, quoted(maybe))`},
+	{Goal: `write_term(user_input, a, [])`, Error: `permission_error(output, stream, user_input)`},
+	{Goal: `op(_, xfx, foo)`, Error: `instantiation_error`},
+	{Goal: `op(30, _, foo)`, Error: `instantiation_error`},
+	{Goal: `op(30, xfx, _)`, Error: `instantiation_error`},
+	{Goal: `op(a, xfx, foo)`, Error: `type_error(integer, a)`},
+	{Goal: `op(1201, xfx, foo)`, Error: `domain_error(operator_priority, 1201)`},
+	{Goal: `op(30, yfy, foo)`, Error: `domain_error(operator_specifier, yfy)`},
+	{Goal: `op(30, 1, foo)`, Error: `type_error(atom, 1)`},
+	{Goal: `op(30, xfy, 0)`, Error: `type_error(list, 0)`},
+	{Goal: `op(1000, xfy, ',')`, Error: `permission_error(modify, operator, ',')`},
+	{Goal: `op(1000, xfy, '|')`, Error: `permission_error(modify, operator, '|')`},
+	{Goal: `op(30, xfy, {})`, Error: `permission_error(create, operator, {})`},
+	{Goal: `op(30, xfy, [a|_])`, Error: `instantiation_error`},
+	{Goal: `current_op(1201, _, _)`, Error: `domain_error(operator_priority, 1201)`},
+	{Goal: `current_op(_, yfy, _)`, Error: `domain_error(operator_specifier, yfy)`},
+	{Goal: `current_op(_, 0, _)`, Error: `domain_error(operator_specifier, 0)`},
+	{Goal: `current_op(_, _, 1)`, Error: `type_error(atom, 1)`},
+	{Goal: `char_conversion(_, a)`, Error: `instantiation_error`},
+	{Goal: `char_conversion(ab, a)`, Error: `representation_error(character)`},
+
+	// Atomic term processing
+	{Goal: `atom_length(_, _)`, Error: `instantiation_error`},
+	{Goal: `atom_length(123, _)`, Error: `type_error(atom, 123)`},
+	{Goal: `atom_length(atom, '4')`, Error: `type_error(integer, '4')`},
+	{Goal: `atom_length(atom, -1)`, Error: `domain_error(not_less_than_zero, -1)`},
+	{Goal: `atom_concat(_, _, _)`, Error: `instantiation_error`},
+	{Goal: `atom_concat(a, _, _)`, Error: `instantiation_error`},
+	{Goal: `atom_concat(f(a), b, _)`, Error: `type_error(atom, f(a))`},
+	{Goal: `sub_atom(_, _, _, _, _)`, Error: `instantiation_error`},
+	{Goal: `sub_atom(f(a), _, _, _, _)`, Error: `type_error(atom, f(a))`},
+	{Goal: `sub_atom(abc, a, _, _, _)`, Error: `type_error(integer, a)`},
+	{Goal: `sub_atom(abc, _, _, _, 1)`, Error: `type_error(atom, 1)`},
+	{Goal: `atom_chars(_, _)`, Error: `instantiation_error`},
+	{Goal: `atom_chars(_, [a|_])`, Error: `instantiation_error`},
+	{Goal: `atom_chars(_, [a, _])`, Error: `instantiation_error`},
+	{Goal: `atom_chars(_, [a, f(b)])`, Error: `type_error(character, f(b))`},
+	{Goal: `atom_chars(f(a), _)`, Error: `type_error(atom, f(a))`},
+	{Goal: `atom_chars(_, foo)`, Error: `type_error(list, foo)`},
+	{Goal: `atom_codes(_, _)`, Error: `instantiation_error`},
+	{Goal: `atom_codes(f(a), _)`, Error: `type_error(atom, f(a))`},
+	{Goal: `atom_codes(_, [0'a, -1])`, Error: `representation_error(character_code)`},
+	{Goal: `atom_codes(_, [0'a|_])`, Error: `instantiation_error`},
+	{Goal: `char_code(_, _)`, Error: `instantiation_error`},
+	{Goal: `char_code(ab, _)`, Error: `type_error(character, ab)`},
+	{Goal: `char_code(_, a)`, Error: `type_error(integer, a)`},
+	{Goal: `char_code(_, -2)`, Error: `representation_error(character_code)`},
+	{Goal: `number_chars(_, _)`, Error: `instantiation_error`},
+	{Goal: `number_chars(a, _)`, Error: `type_error(number, a)`},
+	{Goal: `number_chars(_, [a|_])`, Error: `instantiation_error`},
+	{Goal: `number_chars(_, ['3', ' '])`, Error: `syntax_error(_)`},
+	{Goal: `number_chars(_, [a])`, Error: `syntax_error(_)`},
+	{Goal: `number_chars(_, ['3', f(a)])`, Error: `type_error(character, f(a))`},
+	{Goal: `number_chars(_, 3)`, Error: `type_error(list, 3)`},
+	{Goal: `number_codes(_, _)`, Error: `instantiation_error`},
+	{Goal: `number_codes(a, _)`, Error: `type_error(number, a)`},
+	{Goal: `number_codes(_, [0'a])`, Error: `syntax_error(_)`},
+	{Goal: `number_codes(_, [0'1, -1])`, Error: `representation_error(character_code)`},
+
+	// Implementation defined hooks
+	{Goal: `set_prolog_flag(_, off)`, Error: `instantiation_error`},
+	{Goal: `set_prolog_flag(debug, _)`, Error: `instantiation_error`},
+	{Goal: `set_prolog_flag(5, decimals)`, Error: `type_error(atom, 5)`},
+	{Goal: `set_prolog_flag(date, 'July 1999')`, Error: `domain_error(prolog_flag, date)`},
+	{Goal: `set_prolog_flag(debug, trace)`, Error: `domain_error(flag_value, debug+trace)`},
+	{Goal: `set_prolog_flag(bounded, false)`, Error: `permission_error(modify, flag, bounded)`},
+	{Goal: `current_prolog_flag(5, _)`, Error: `type_error(atom, 5)`},
+	{Goal: `halt(_)`, Error: `instantiation_error`},
+	{Goal: `halt(a)`, Error: `type_error(integer, a)`},
+
+	// Definite clause grammar
+	{Goal: `phrase(_, _, _)`, Error: `instantiation_error`},
+	{Goal: `phrase(1, _, _)`, Error: `type_error(callable, 1)`},
+
+	// Lists
+	{Goal: `length(_, -1)`, Error: `domain_error(not_less_than_zero, -1)`},
+	{Goal: `length(_, a)`, Error: `type_error(integer, a)`},
+	{Goal: `between(_, 2, _)`, Error: `instantiation_error`},
+	{Goal: `between(1, _, _)`, Error: `instantiation_error`},
+	{Goal: `between(a, 2, _)`, Error: `type_error(integer, a)`},
+	{Goal: `between(1, 2, a)`, Error: `type_error(integer, a)`},
+	{Goal: `succ(_, _)`, Error: `instantiation_error`},
+	{Goal: `succ(a, _)`, Error: `type_error(integer, a)`},
+	{Goal: `succ(-1, _)`, Error: `domain_error(not_less_than_zero, -1)`},
+	{Goal: `nth0(a, [a], _)`, Error: `type_error(integer, a)`},
+	{Goal: `nth1(a, [a], _)`, Error: `type_error(integer, a)`},
+	{Goal: `maplist(_, [a])`, Error: `instantiation_error`},
+	{Goal: `foldl(_, [a], 0, _)`, Error: `instantiation_error`},
+	{Goal: `call_nth(true, a)`, Error: `type_error(integer, a)`},
+
+	// Misc
+	{Goal: `fallback(_, a/1, [])`, Error: `instantiation_error`},
+	{Goal: `fallback(a/1, b, [])`, Error: `type_error(predicate_indicator, b)`},
+	{Goal: `fallback(a/1, b/2, [])`, Error: `domain_error(fallback, b/2)`},
+	{Goal: `prolog_frame_attribute(_, goal, _)`, Error: `instantiation_error`},
+	{Goal: `prolog_frame_attribute(a, goal, _)`, Error: `type_error(frame, a)`},
+	{Goal: `random_between(a, 2, _)`, Error: `type_error(integer, a)`},
+	{Goal: `consult(_)`, Error: `instantiation_error`},
+}
@@ -0,0 +1,99 @@
+// Package errortest checks that predicates raise the exact ISO error terms for erroneous calls.
+//
+// A Case is a goal and the formal part of the error it must raise, i.e. error(Formal, _). Builtins is the golden suite
+// of the documented error conditions of the builtin predicates of prolog.New. Run the same harness on your own
+// foreign predicates to make sure they report errors in the same way as the builtins do:
+//
+//	func TestMyPredicates(t *testing.T) {
+//		p := prolog.New(nil, nil)
+//		p.Register2(engine.NewAtom("fetch"), Fetch)
+//		errortest.Run(t, p, []errortest.Case{
+//			{Goal: `fetch(_, _)`, Error: `instantiation_error`},
+//			{Goal: `fetch(1, _)`, Error: `type_error(atom, 1)`},
+//		})
+//	}
+package errortest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ichiban/prolog"
+)
+
+// ErrMismatch indicates the goal of a Case didn't raise the expected error.
+var ErrMismatch = errors.New("mismatch")
+
+// Case is an erroneous call and the error it must raise.
+type Case struct {
+	// Setup is a goal called before Goal e.g. to open a stream. The variables of the same names are shared with Goal.
+	Setup string
+
+	// Goal is the erroneous call e.g. `atom_length(_, _)`.
+	Goal string
+
+	// Error is the expected formal term of error(Formal, Context) e.g. `type_error(integer, a)`.
+	// Its variables match any terms e.g. `syntax_error(_)`.
+	Error string
+}
+
+func (c Case) String() string {
+	if c.Setup == "" {
+		return c.Goal
+	}
+	return c.Setup + ", " + c.Goal
+}
+
+const helper = `
+'$errortest_outcome'(Ball, _, succeeded) :- var(Ball), !.
+'$errortest_outcome'(error(Formal, _), Expected, ok) :- subsumes_term(Expected, Formal), !.
+'$errortest_outcome'(Ball, _, raised(Ball)).
+`
+
+// Check calls the goal of c on a fork of p and returns an error wrapping ErrMismatch unless it raises the expected
+// error. The database of p is left untouched.
+func Check(ctx context.Context, p *prolog.Interpreter, c Case) error {
+	f := p.Fork()
+	if err := f.ExecContext(ctx, helper); err != nil {
+		return err
+	}
+
+	setup := c.Setup
+	if setup == "" {
+		setup = "true"
+	}
+	q := fmt.Sprintf(`(%s), catch((%s), ErrortestBall, true), '$errortest_outcome'(ErrortestBall, (%s), ErrortestOutcome).`, setup, c.Goal, c.Error)
+	var s struct {
+		Outcome prolog.TermString `prolog:"ErrortestOutcome"`
+	}
+	switch err := f.QuerySolutionContext(ctx, q).Scan(&s); {
+	case errors.Is(err, prolog.ErrNoSolutions):
+		return fmt.Errorf("%w: %s: failed, want error(%s, _)", ErrMismatch, c, c.Error)
+	case err != nil:
+		return err
+	}
+	switch s.Outcome {
+	case "ok":
+		return nil
+	case "succeeded":
+		return fmt.Errorf("%w: %s: succeeded, want error(%s, _)", ErrMismatch, c, c.Error)
+	default:
+		ball := s.Outcome[len("raised(") : len(s.Outcome)-len(")")]
+		return fmt.Errorf("%w: %s: raised %s, want error(%s, _)", ErrMismatch, c, ball, c.Error)
+	}
+}
+
+// Run checks each of cases in a subtest.
+func Run(t *testing.T, p *prolog.Interpreter, cases []Case) {
+	t.Helper()
+	for _, c := range cases {
+		c := c
+		t.Run(c.String(), func(t *testing.T) {
+			if err := Check(context.Background(), p, c); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package errortest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ichiban/prolog"
+)
+
+func TestBuiltins(t *testing.T) {
+	Run(t, prolog.New(nil, nil), Builtins)
+}
+
+func TestCheck(t *testing.T) {
+	p := prolog.New(nil, nil)
+	assert.NoError(t, p.Exec(`
+fetch(URL, _) :- var(URL), throw(error(instantiation_error, fetch/2)).
+fetch(URL, _) :- \+ atom(URL), throw(oops).
+fetch(_, body).
+`))
+
+	tests := []struct {
+		c   Case
+		err string
+	}{
+		{c: Case{Goal: `fetch(_, _)`, Error: `instantiation_error`}},
+		{c: Case{Setup: `X = _`, Goal: `fetch(X, _)`, Error: `instantiation_error`}},
+		{c: Case{Goal: `fetch(_, _)`, Error: `_`}},
+		{c: Case{Goal: `fetch(_, _)`, Error: `type_error(atom, _)`}, err: "mismatch: fetch(_, _): raised error(instantiation_error,fetch/2), want error(type_error(atom, _), _)"},
+		{c: Case{Goal: `fetch(1, _)`, Error: `type_error(atom, 1)`}, err: "mismatch: fetch(1, _): raised oops, want error(type_error(atom, 1), _)"},
+		{c: Case{Goal: `fetch(a, _)`, Error: `instantiation_error`}, err: "mismatch: fetch(a, _): succeeded, want error(instantiation_error, _)"},
+		{c: Case{Setup: `fail`, Goal: `fetch(a, _)`, Error: `instantiation_error`}, err: "mismatch: fail, fetch(a, _): failed, want error(instantiation_error, _)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.c.String(), func(t *testing.T) {
+			err := Check(context.Background(), p, tt.c)
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.True(t, errors.Is(err, ErrMismatch))
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+
+	t.Run("syntax error", func(t *testing.T) {
+		err := Check(context.Background(), p, Case{Goal: `fetch(`, Error: `instantiation_error`})
+		assert.Error(t, err)
+		assert.False(t, errors.Is(err, ErrMismatch))
+	})
+
+	t.Run("database untouched", func(t *testing.T) {
+		assert.NoError(t, Check(context.Background(), p, Case{Setup: `assertz(seen)`, Goal: `call(_)`, Error: `instantiation_error`}))
+		assert.Error(t, p.QuerySolution(`seen.`).Err())
+	})
+}
@@ -16,7 +16,7 @@ func main() {
 		// Check if the input arguments are of the types you expected.
 		u, ok := env.Resolve(url).(engine.Atom)
 		if !ok {
-			return engine.Error(engine.TypeError(engine.NewAtom("atom"), url, env))
+			return engine.Error(engine.TypeError(engine.ValidTypeAtom, url, env))
 		}
 
 		// Do whatever you want with the given inputs.
@@ -0,0 +1,11 @@
+// Package cookbook is a collection of recipes for embedding Prolog in Go programs.
+//
+// Each recipe is a runnable example in example_test.go which go test runs and checks against its output. So they
+// stay in sync with the public API:
+//
+//   - Example_rulesService serves authorization rules over HTTP.
+//   - Example_csvIngestion loads CSV rows as facts and queries them.
+//   - Example_puzzle solves a constraint puzzle by placing a queen at a time while checking the constraints.
+//   - Example_customBuiltin calls Go from Prolog through a predicate written in Go.
+//   - Example_sandbox evaluates an untrusted program with a minimal set of predicates and a quota.
+package cookbook
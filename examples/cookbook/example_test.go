@@ -0,0 +1,242 @@
+package cookbook_test
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/ichiban/prolog"
+	"github.com/ichiban/prolog/engine"
+	"github.com/ichiban/prolog/ingest"
+)
+
+func Example_rulesService() {
+	p := prolog.New(nil, nil)
+	if err := p.Exec(`
+role(alice, admin).
+role(bob, user).
+
+can(User, delete) :- role(User, admin).
+can(User, read) :- role(User, _).
+`); err != nil {
+		panic(err)
+	}
+
+	// GET /can?user=bob&action=read answers whether the user can do the action.
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, action := r.FormValue("user"), r.FormValue("action")
+		// Go strings are passed as lists of characters. So they're turned into atoms before they're looked up.
+		sol := p.QuerySolutionContext(r.Context(), `atom_chars(U, ?), atom_chars(A, ?), can(U, A).`, user, action)
+		switch err := sol.Err(); {
+		case err == nil:
+			fmt.Fprintln(w, "allowed")
+		case errors.Is(err, prolog.ErrNoSolutions):
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintln(w, "denied")
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}))
+	defer s.Close()
+
+	for _, q := range []string{"user=alice&action=delete", "user=bob&action=read", "user=bob&action=delete"} {
+		resp, err := http.Get(s.URL + "/can?" + q)
+		if err != nil {
+			panic(err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		fmt.Printf("%s: %d %s", q, resp.StatusCode, b)
+	}
+
+	// Output:
+	// user=alice&action=delete: 200 allowed
+	// user=bob&action=read: 200 allowed
+	// user=bob&action=delete: 403 denied
+}
+
+func Example_csvIngestion() {
+	p := prolog.New(nil, nil)
+	if err := p.Exec(`
+adult(Name) :- user(Name, Age), Age >= 18.
+`); err != nil {
+		panic(err)
+	}
+
+	l := ingest.Loader{
+		Interpreter: p,
+		Mapping: ingest.Mapping{
+			Name: "user",
+			Columns: []ingest.Column{
+				{Field: "name"},
+				{Field: "age", Type: ingest.Integer},
+			},
+			Index: [][]int{{1}},
+		},
+		MaxRejected: -1,
+	}
+	report, err := l.LoadCSV(context.Background(), csv.NewReader(strings.NewReader(`name,age
+alice,30
+bob,12
+carol,unknown
+dave,45
+`)))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("loaded: %d\n", report.Loaded)
+	for _, e := range report.Rejected {
+		fmt.Printf("rejected: %v\n", e)
+	}
+
+	sols, err := p.Query(`adult(Name).`)
+	if err != nil {
+		panic(err)
+	}
+	defer sols.Close()
+	for sols.Next() {
+		var s struct {
+			Name string
+		}
+		if err := sols.Scan(&s); err != nil {
+			panic(err)
+		}
+		fmt.Printf("adult: %s\n", s.Name)
+	}
+	if err := sols.Err(); err != nil {
+		panic(err)
+	}
+
+	// Output:
+	// loaded: 3
+	// rejected: record 4: field age: strconv.ParseInt: parsing "unknown": invalid syntax
+	// adult: alice
+	// adult: dave
+}
+
+func Example_puzzle() {
+	p := prolog.New(nil, nil)
+
+	// Place N queens on an N×N board so that no two queens attack each other. Qs are the rows of the queens in the
+	// columns. Each queen is checked against the ones already placed so that the search prunes early.
+	if err := p.Exec(`
+queens(N, Qs) :-
+	numlist(1, N, Rows),
+	place(Rows, [], Qs).
+
+place([], Qs, Qs).
+place(Rows, Placed, Qs) :-
+	select(Q, Rows, Rest),
+	safe(Q, Placed, 1),
+	place(Rest, [Q|Placed], Qs).
+
+safe(_, [], _).
+safe(Q, [Q1|Qs], D) :-
+	Q =\= Q1 + D,
+	Q =\= Q1 - D,
+	D1 is D + 1,
+	safe(Q, Qs, D1).
+
+numlist(N, N, [N]) :- !.
+numlist(M, N, [M|Ms]) :- M < N, M1 is M + 1, numlist(M1, N, Ms).
+`); err != nil {
+		panic(err)
+	}
+
+	sol := p.QuerySolution(`queens(8, Qs).`)
+	var s struct {
+		Qs []int
+	}
+	if err := sol.Scan(&s); err != nil {
+		panic(err)
+	}
+	fmt.Println(s.Qs)
+
+	var n struct {
+		N int
+	}
+	if err := p.QuerySolution(`aggregate_all(count, queens(6, _), N).`).Scan(&n); err != nil {
+		panic(err)
+	}
+	fmt.Printf("6 queens: %d solutions\n", n.N)
+
+	// Output:
+	// [4 2 7 3 6 8 5 1]
+	// 6 queens: 4 solutions
+}
+
+func Example_customBuiltin() {
+	p := prolog.New(nil, nil)
+
+	// shout(+Atom, -Upper) is a predicate written in Go. It raises a type error like builtin predicates do.
+	p.Register2(engine.NewAtom("shout"), func(vm *engine.VM, in, out engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+		a, ok := env.Resolve(in).(engine.Atom)
+		if !ok {
+			return engine.Error(engine.TypeError(engine.ValidTypeAtom, in, env))
+		}
+		return engine.Unify(vm, out, engine.NewAtom(strings.ToUpper(a.String())), k, env)
+	})
+
+	var s struct {
+		X string
+	}
+	if err := p.QuerySolution(`shout(hello, X).`).Scan(&s); err != nil {
+		panic(err)
+	}
+	fmt.Println(s.X)
+
+	err := p.QuerySolution(`shout(1, X).`).Err()
+	fmt.Println(err)
+
+	// Output:
+	// HELLO
+	// error(type_error(atom,1),shout/2)
+}
+
+func Example_sandbox() {
+	// A zero Interpreter has no predicates. Register only the ones the untrusted program may use.
+	var p prolog.Interpreter
+	p.Register3(engine.NewAtom("op"), engine.Op)
+	p.Register2(engine.NewAtom("is"), engine.Is)
+	if err := p.Exec(`
+:-(op(1200, xfx, :-)).
+:-(op(1000, xfy, ',')).
+:-(op(700, xfx, is)).
+:-(op(500, yfx, +)).
+`); err != nil {
+		panic(err)
+	}
+
+	// Bound the number of calls so that a runaway program stops.
+	p.Quota.Inferences = 1000
+
+	if err := p.Exec(`
+double(X, Y) :- Y is X + X.
+forever :- forever.
+`); err != nil {
+		panic(err)
+	}
+
+	var s struct {
+		Y int
+	}
+	if err := p.QuerySolution(`double(21, Y).`).Scan(&s); err != nil {
+		panic(err)
+	}
+	fmt.Println(s.Y)
+
+	// The program can't reach the predicates which aren't registered e.g. I/O.
+	fmt.Println(p.QuerySolution(`open('/etc/passwd', read, _).`).Err())
+
+	fmt.Println(p.QuerySolution(`forever.`).Err())
+
+	// Output:
+	// 42
+	// error(existence_error(procedure,open/3),root)
+	// error(resource_error(inferences),forever/0)
+}
@@ -0,0 +1,669 @@
+// Package ingest loads CSV rows and JSON objects into an interpreter as facts.
+//
+// A Mapping declares how a record maps to a fact: which field goes to which argument, what type the value is coerced
+// to, and which records are skipped. Loader converts the records in parallel and adds the facts in batches in the
+// order of the input, building the declared indexes as it goes. So, a large data set doesn't have to be turned into a
+// Prolog text and parsed:
+//
+//	l := ingest.Loader{
+//		Interpreter: p,
+//		Mapping: ingest.Mapping{
+//			Name: "user",
+//			Columns: []ingest.Column{
+//				{Field: "name"},
+//				{Field: "age", Type: ingest.Integer},
+//				{Field: "role", Default: engine.NewAtom("guest")},
+//			},
+//			Skip:  []ingest.Skip{{Field: "status", Values: []string{"deleted"}}},
+//			Index: [][]int{{1}},
+//		},
+//	}
+//	report, err := l.LoadCSV(ctx, csv.NewReader(f))
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ichiban/prolog"
+	"github.com/ichiban/prolog/engine"
+)
+
+var (
+	// ErrMissing indicates a field is missing or empty and its column has no default value.
+	ErrMissing = errors.New("missing value")
+
+	// ErrTooManyRejected indicates more records than Loader.MaxRejected were rejected.
+	ErrTooManyRejected = errors.New("too many rejected records")
+)
+
+// Type is the type of argument a value is coerced to.
+type Type int
+
+// Types.
+const (
+	// Atom makes an atom of the text of the value.
+	Atom Type = iota
+	// String makes a string of the text of the value.
+	String
+	// Integer parses the value as an integer.
+	Integer
+	// Float parses the value as a float.
+	Float
+	// Number parses the value as an integer if possible, otherwise as a float.
+	Number
+	// Boolean parses the value as true or false. It accepts what strconv.ParseBool does.
+	Boolean
+	// Term parses the value as a Prolog term without the full stop.
+	// JSON arrays become lists and JSON objects become lists of Key=Value pairs ordered by key.
+	Term
+)
+
+func (t Type) String() string {
+	return [...]string{
+		Atom:    "atom",
+		String:  "string",
+		Integer: "integer",
+		Float:   "float",
+		Number:  "number",
+		Boolean: "boolean",
+		Term:    "term",
+	}[t]
+}
+
+// Column maps a field of a record to an argument of a fact.
+type Column struct {
+	// Field is the name of the field: a column name in the CSV header or a key of the JSON object.
+	// A 1-based position e.g. "3" also names a CSV column. A dotted path e.g. "address.city" names a field of a
+	// nested JSON object unless the object has the key as it is.
+	Field string
+
+	// Type is the type the value is coerced to.
+	Type Type
+
+	// Default is the argument for the records whose field is missing, empty, or null.
+	// If it's nil, such records are rejected with ErrMissing.
+	Default engine.Term
+}
+
+// Skip is a rule to skip records.
+type Skip struct {
+	// Field is the name of the field as in Column.
+	Field string
+
+	// Values are the values of the field the records are skipped for. "" matches a missing, empty, or null field.
+	Values []string
+}
+
+// Mapping declares how records map to facts.
+type Mapping struct {
+	// Name is the name of the facts.
+	Name string
+
+	// Columns are the arguments of the facts in order.
+	Columns []Column
+
+	// Skip lists the rules to skip records. A record is skipped if any of them matches.
+	Skip []Skip
+
+	// Index lists the 1-based argument positions of the indexes just like the directive index/2.
+	Index [][]int
+}
+
+// RecordError tells why a record was rejected.
+type RecordError struct {
+	// Record is the line number of the CSV row or the 1-based position of the JSON object.
+	Record int
+
+	// Field is the field which caused the error if any.
+	Field string
+
+	// Err is the cause. It may be an engine.Exception of schema_error/1 if the fact doesn't conform to the
+	// fact schema of the procedure.
+	Err error
+}
+
+func (e *RecordError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("record %d: %v", e.Record, e.Err)
+	}
+	return fmt.Sprintf("record %d: field %s: %v", e.Record, e.Field, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// Report is the result of loading.
+type Report struct {
+	// Loaded is the number of facts added.
+	Loaded int
+
+	// Skipped is the number of records skipped by the skip rules.
+	Skipped int
+
+	// Rejected are the errors of the records which weren't loaded in the order of the input.
+	Rejected []*RecordError
+}
+
+// Loader loads records into an interpreter as facts.
+// The facts are added as by assertz/1. So, the procedure has to be dynamic, or it's created as such.
+type Loader struct {
+	// Interpreter is the interpreter to load the facts into. It must not be used by others while loading.
+	Interpreter *prolog.Interpreter
+
+	// Mapping declares how records map to facts.
+	Mapping Mapping
+
+	// Workers is the number of goroutines converting records to facts. It defaults to runtime.GOMAXPROCS(0).
+	Workers int
+
+	// BatchSize is the number of records converted and added at once. It defaults to 1024.
+	BatchSize int
+
+	// MaxRejected is the number of rejected records tolerated. Once it's exceeded, the load stops with
+	// ErrTooManyRejected and the batch with the last rejected record isn't added. The zero value rejects the whole
+	// batch for a single bad record. A negative value tolerates any number of them.
+	MaxRejected int
+
+	// NoHeader tells that the first CSV row is a record rather than a header. Then, columns are named only by
+	// their positions.
+	NoHeader bool
+}
+
+// LoadCSV loads the rows read by r.
+func (l *Loader) LoadCSV(ctx context.Context, r *csv.Reader) (*Report, error) {
+	var header map[string]int
+	if !l.NoHeader {
+		names, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				return &Report{}, nil
+			}
+			return &Report{}, err
+		}
+		header = make(map[string]int, len(names))
+		for i, n := range names {
+			header[n] = i
+		}
+	}
+
+	return l.load(ctx, func() (record, int, error) {
+		fields, err := r.Read()
+		if err != nil {
+			return nil, 0, err
+		}
+		line, _ := r.FieldPos(0)
+		return csvRecord{header: header, fields: fields}, line, nil
+	})
+}
+
+// LoadJSON loads the objects read from r. The input is either an array of objects or a sequence of objects e.g.
+// JSON Lines.
+func (l *Loader) LoadJSON(ctx context.Context, r io.Reader) (*Report, error) {
+	br := bufio.NewReader(r)
+	var b byte
+	for {
+		bs, err := br.Peek(1)
+		if err != nil {
+			if err == io.EOF {
+				return &Report{}, nil
+			}
+			return &Report{}, err
+		}
+		if b = bs[0]; b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			break
+		}
+		_, _ = br.ReadByte()
+	}
+
+	dec := json.NewDecoder(br)
+	dec.UseNumber()
+	array := b == '['
+	if array {
+		if _, err := dec.Token(); err != nil {
+			return &Report{}, err
+		}
+	}
+	var n int
+	return l.load(ctx, func() (record, int, error) {
+		if array && !dec.More() {
+			if _, err := dec.Token(); err != nil {
+				return nil, 0, err
+			}
+			return nil, 0, io.EOF
+		}
+		var o map[string]interface{}
+		if err := dec.Decode(&o); err != nil {
+			return nil, 0, err
+		}
+		n++
+		return jsonRecord(o), n, nil
+	})
+}
+
+// chunk is a batch of records passing through the pipeline.
+type chunk struct {
+	seq     int
+	records []record
+	nums    []int
+	err     error // The error which ended the input after the records.
+
+	facts    []engine.Term
+	factNums []int
+	skipped  int
+	rejected []*RecordError
+}
+
+func (l *Loader) load(ctx context.Context, next func() (record, int, error)) (*Report, error) {
+	var report Report
+	m := l.Mapping
+	if m.Name == "" || len(m.Columns) == 0 {
+		return &report, errors.New("ingest: mapping needs a name and columns")
+	}
+	vm := &l.Interpreter.VM
+	name := engine.NewAtom(m.Name)
+	for _, positions := range m.Index {
+		if err := vm.DeclareIndex(name, len(m.Columns), positions...); err != nil {
+			return &report, err
+		}
+	}
+
+	workers := l.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	size := l.BatchSize
+	if size <= 0 {
+		size = 1024
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer func() {
+		// Don't return while the goroutines may still be reading the input.
+		cancel()
+		wg.Wait()
+	}()
+
+	in, out := make(chan *chunk, workers), make(chan *chunk, workers)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(in)
+		for seq := 0; ; seq++ {
+			c := chunk{seq: seq}
+			for len(c.records) < size {
+				if ctx.Err() != nil {
+					return
+				}
+				r, n, err := next()
+				if err != nil {
+					if err != io.EOF {
+						c.err = err
+					}
+					break
+				}
+				c.records = append(c.records, r)
+				c.nums = append(c.nums, n)
+			}
+			select {
+			case in <- &c:
+			case <-ctx.Done():
+				return
+			}
+			if len(c.records) < size {
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range in {
+				l.convert(vm, name, c)
+				select {
+				case out <- c:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	// The chunks are converted in parallel but added in the order of the input.
+	pending := map[int]*chunk{}
+	var seq int
+	for c := range out {
+		pending[c.seq] = c
+		for {
+			c, ok := pending[seq]
+			if !ok {
+				break
+			}
+			delete(pending, seq)
+			seq++
+			if err := l.add(vm, &report, c); err != nil {
+				return &report, err
+			}
+			if c.err != nil {
+				return &report, c.err
+			}
+		}
+	}
+	return &report, ctx.Err()
+}
+
+// add adds the facts of the chunk to the database.
+func (l *Loader) add(vm *engine.VM, report *Report, c *chunk) error {
+	report.Skipped += c.skipped
+	report.Rejected = append(report.Rejected, c.rejected...)
+	if l.tooMany(report) {
+		return ErrTooManyRejected
+	}
+
+	err := vm.AssertFacts(c.facts)
+	if err == nil {
+		report.Loaded += len(c.facts)
+		return nil
+	}
+	vs, ok := schemaViolations(err)
+	if !ok {
+		return err
+	}
+
+	// Map the violations back to the records. AssertFacts reports them in the order of the facts and, for each fact,
+	// in the order of the arguments. So a violation belongs to the fact of the previous one if it's about a later
+	// argument of an equal fact. Otherwise, it belongs to the next equal fact so that equal records are told apart.
+	byFact := map[int][]engine.Term{}
+	i, last := -1, engine.Integer(0)
+	for _, v := range vs {
+		n, _ := v.Arg(1).(engine.Integer)
+		if i < 0 || n <= last || v.Arg(0).Compare(c.facts[i], nil) != 0 {
+			for i++; i < len(c.facts); i++ {
+				if v.Arg(0).Compare(c.facts[i], nil) == 0 {
+					break
+				}
+			}
+			if i == len(c.facts) {
+				break
+			}
+		}
+		byFact[i] = append(byFact[i], v)
+		last = n
+	}
+	start := len(report.Rejected) - len(c.rejected)
+	for i, vs := range byFact {
+		e := RecordError{
+			Record: c.factNums[i],
+			Err:    engine.NewException(engine.NewAtom("error").Apply(engine.NewAtom("schema_error").Apply(engine.List(vs...)), engine.NewVariable()), nil),
+		}
+		if n, ok := vs[0].(engine.Compound).Arg(1).(engine.Integer); ok && n >= 1 && int(n) <= len(l.Mapping.Columns) {
+			e.Field = l.Mapping.Columns[n-1].Field
+		}
+		report.Rejected = append(report.Rejected, &e)
+	}
+	rs := report.Rejected[start:]
+	sort.Slice(rs, func(i, j int) bool {
+		return rs[i].Record < rs[j].Record
+	})
+	report.Loaded += len(c.facts) - len(byFact)
+	if l.tooMany(report) {
+		return ErrTooManyRejected
+	}
+	return nil
+}
+
+func (l *Loader) tooMany(report *Report) bool {
+	return l.MaxRejected >= 0 && len(report.Rejected) > l.MaxRejected
+}
+
+// schemaViolations returns the violations if err is schema_error(Violations).
+func schemaViolations(err error) ([]engine.Compound, bool) {
+	var e engine.Exception
+	if !errors.As(err, &e) {
+		return nil, false
+	}
+	t, ok := e.Term().(engine.Compound)
+	if !ok || t.Functor() != engine.NewAtom("error") || t.Arity() != 2 {
+		return nil, false
+	}
+	s, ok := t.Arg(0).(engine.Compound)
+	if !ok || s.Functor() != engine.NewAtom("schema_error") || s.Arity() != 1 {
+		return nil, false
+	}
+	var vs []engine.Compound
+	iter := engine.ListIterator{List: s.Arg(0)}
+	for iter.Next() {
+		if v, ok := iter.Current().(engine.Compound); ok && v.Arity() == 4 {
+			vs = append(vs, v)
+		}
+	}
+	return vs, true
+}
+
+// convert turns the records of the chunk into facts.
+func (l *Loader) convert(vm *engine.VM, name engine.Atom, c *chunk) {
+	m := l.Mapping
+	c.facts = make([]engine.Term, 0, len(c.records))
+	c.factNums = make([]int, 0, len(c.records))
+records:
+	for i, r := range c.records {
+		if m.skip(r) {
+			c.skipped++
+			continue
+		}
+		args := make([]engine.Term, len(m.Columns))
+		for j, col := range m.Columns {
+			a, err := col.arg(vm, r)
+			if err != nil {
+				c.rejected = append(c.rejected, &RecordError{Record: c.nums[i], Field: col.Field, Err: err})
+				continue records
+			}
+			args[j] = a
+		}
+		c.facts = append(c.facts, name.Apply(args...))
+		c.factNums = append(c.factNums, c.nums[i])
+	}
+}
+
+func (m *Mapping) skip(r record) bool {
+	for _, s := range m.Skip {
+		v, ok := r.get(s.Field)
+		var text string
+		if ok {
+			text, _ = textOf(v)
+		}
+		for _, want := range s.Values {
+			if text == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *Column) arg(vm *engine.VM, r record) (engine.Term, error) {
+	v, ok := r.get(c.Field)
+	if ok {
+		switch v := v.(type) {
+		case nil:
+			ok = false
+		case string:
+			ok = v != ""
+		}
+	}
+	if !ok {
+		if c.Default == nil {
+			return nil, ErrMissing
+		}
+		return c.Default, nil
+	}
+
+	if c.Type == Term {
+		switch v.(type) {
+		case []interface{}, map[string]interface{}:
+			return termOf(v), nil
+		}
+	}
+
+	text, ok := textOf(v)
+	if !ok {
+		return nil, fmt.Errorf("%s expected, found a JSON array or object", c.Type)
+	}
+	switch c.Type {
+	case Atom:
+		return engine.NewAtom(text), nil
+	case String:
+		return engine.String(text), nil
+	case Integer:
+		n, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return engine.Integer(n), nil
+	case Float:
+		f, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil {
+			return nil, err
+		}
+		return engine.Float(f), nil
+	case Number:
+		text = strings.TrimSpace(text)
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return engine.Integer(n), nil
+		}
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, err
+		}
+		return engine.Float(f), nil
+	case Boolean:
+		b, err := strconv.ParseBool(strings.TrimSpace(text))
+		if err != nil {
+			return nil, err
+		}
+		if b {
+			return engine.NewAtom("true"), nil
+		}
+		return engine.NewAtom("false"), nil
+	case Term:
+		p := engine.NewParser(vm, strings.NewReader(text+" ."))
+		return p.Term()
+	default:
+		return nil, fmt.Errorf("unknown type: %d", c.Type)
+	}
+}
+
+// textOf returns the text of a scalar value.
+func textOf(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", true
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	default:
+		return "", false
+	}
+}
+
+// termOf converts a JSON value to a term. Strings become atoms and null becomes the atom null.
+func termOf(v interface{}) engine.Term {
+	switch v := v.(type) {
+	case nil:
+		return engine.NewAtom("null")
+	case string:
+		return engine.NewAtom(v)
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return engine.Integer(n)
+		}
+		f, _ := v.Float64()
+		return engine.Float(f)
+	case bool:
+		return engine.NewAtom(strconv.FormatBool(v))
+	case []interface{}:
+		es := make([]engine.Term, len(v))
+		for i, e := range v {
+			es[i] = termOf(e)
+		}
+		return engine.List(es...)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		es := make([]engine.Term, len(keys))
+		for i, k := range keys {
+			es[i] = engine.NewAtom("=").Apply(engine.NewAtom(k), termOf(v[k]))
+		}
+		return engine.List(es...)
+	default:
+		return engine.NewAtom(fmt.Sprint(v))
+	}
+}
+
+// record is a row of CSV or an object of JSON.
+type record interface {
+	get(field string) (interface{}, bool)
+}
+
+type csvRecord struct {
+	header map[string]int
+	fields []string
+}
+
+func (r csvRecord) get(field string) (interface{}, bool) {
+	i, ok := r.header[field]
+	if !ok {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, false
+		}
+		i = n - 1
+	}
+	if i < 0 || i >= len(r.fields) {
+		return nil, false
+	}
+	return r.fields[i], true
+}
+
+type jsonRecord map[string]interface{}
+
+func (r jsonRecord) get(field string) (interface{}, bool) {
+	if v, ok := r[field]; ok {
+		return v, true
+	}
+	var v interface{} = map[string]interface{}(r)
+	for _, k := range strings.Split(field, ".") {
+		o, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = o[k]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
@@ -0,0 +1,250 @@
+package ingest
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ichiban/prolog"
+	"github.com/ichiban/prolog/engine"
+)
+
+var users = Mapping{
+	Name: "user",
+	Columns: []Column{
+		{Field: "name"},
+		{Field: "age", Type: Integer},
+		{Field: "role", Default: engine.NewAtom("guest")},
+	},
+	Skip:  []Skip{{Field: "status", Values: []string{"deleted"}}},
+	Index: [][]int{{1}},
+}
+
+func facts(t *testing.T, p *prolog.Interpreter, query string) []string {
+	t.Helper()
+	sols, err := p.Query(query)
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, sols.Close())
+	}()
+	var ret []string
+	for sols.Next() {
+		var s struct {
+			F prolog.TermString
+		}
+		assert.NoError(t, sols.Scan(&s))
+		ret = append(ret, string(s.F))
+	}
+	assert.NoError(t, sols.Err())
+	return ret
+}
+
+func TestLoader_LoadCSV(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		p := prolog.New(nil, nil)
+		l := Loader{Interpreter: p, Mapping: users}
+		r, err := l.LoadCSV(context.Background(), csv.NewReader(strings.NewReader(`name,age,role,status
+alice,30,admin,active
+bob,40,,active
+carol,50,admin,deleted
+`)))
+		assert.NoError(t, err)
+		assert.Equal(t, &Report{Loaded: 2, Skipped: 1}, r)
+		assert.Equal(t, []string{"user(alice,30,admin)", "user(bob,40,guest)"}, facts(t, p, `F = user(_, _, _), F.`))
+	})
+
+	t.Run("no header", func(t *testing.T) {
+		p := prolog.New(nil, nil)
+		l := Loader{Interpreter: p, Mapping: Mapping{
+			Name: "point",
+			Columns: []Column{
+				{Field: "2", Type: Float},
+				{Field: "1", Type: Number},
+			},
+		}, NoHeader: true}
+		r, err := l.LoadCSV(context.Background(), csv.NewReader(strings.NewReader("1,2.5\n3.5,4\n")))
+		assert.NoError(t, err)
+		assert.Equal(t, &Report{Loaded: 2}, r)
+		assert.Equal(t, []string{"point(2.5,1)", "point(4.0,3.5)"}, facts(t, p, `F = point(_, _), F.`))
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		p := prolog.New(nil, nil)
+		l := Loader{Interpreter: p, Mapping: users, MaxRejected: -1}
+		r, err := l.LoadCSV(context.Background(), csv.NewReader(strings.NewReader(`name,age,role,status
+alice,thirty,admin,active
+,40,admin,active
+carol,50,admin,active
+`)))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, r.Loaded)
+		assert.Len(t, r.Rejected, 2)
+		assert.Equal(t, 2, r.Rejected[0].Record)
+		assert.Equal(t, "age", r.Rejected[0].Field)
+		assert.Equal(t, 3, r.Rejected[1].Record)
+		assert.Equal(t, "name", r.Rejected[1].Field)
+		assert.True(t, errors.Is(r.Rejected[1], ErrMissing))
+		assert.Equal(t, []string{"user(carol,50,admin)"}, facts(t, p, `F = user(_, _, _), F.`))
+	})
+
+	t.Run("too many rejected", func(t *testing.T) {
+		p := prolog.New(nil, nil)
+		l := Loader{Interpreter: p, Mapping: users, BatchSize: 1}
+		r, err := l.LoadCSV(context.Background(), csv.NewReader(strings.NewReader(`name,age,role,status
+alice,30,admin,active
+bob,forty,admin,active
+carol,50,admin,active
+`)))
+		assert.Equal(t, ErrTooManyRejected, err)
+		assert.Equal(t, 1, r.Loaded)
+		assert.Len(t, r.Rejected, 1)
+		assert.Equal(t, []string{"user(alice,30,admin)"}, facts(t, p, `F = user(_, _, _), F.`))
+	})
+
+	t.Run("fact schema", func(t *testing.T) {
+		p := prolog.New(nil, nil)
+		assert.NoError(t, p.Exec(`:- dynamic(user/3). :- fact_schema(user(atom, nonneg, oneof([admin, guest]))).`))
+		l := Loader{Interpreter: p, Mapping: users, MaxRejected: -1}
+		r, err := l.LoadCSV(context.Background(), csv.NewReader(strings.NewReader(`name,age,role,status
+alice,30,admin,active
+bob,-1,admin,active
+carol,50,root,active
+`)))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, r.Loaded)
+		assert.Len(t, r.Rejected, 2)
+		assert.Equal(t, 3, r.Rejected[0].Record)
+		assert.Equal(t, "age", r.Rejected[0].Field)
+		assert.Equal(t, 4, r.Rejected[1].Record)
+		assert.Equal(t, "role", r.Rejected[1].Field)
+		assert.Equal(t, []string{"user(alice,30,admin)"}, facts(t, p, `F = user(_, _, _), F.`))
+	})
+
+	t.Run("identical rejected", func(t *testing.T) {
+		p := prolog.New(nil, nil)
+		assert.NoError(t, p.Exec(`:- dynamic(user/3). :- fact_schema(user(atom, nonneg, oneof([admin, guest]))).`))
+		l := Loader{Interpreter: p, Mapping: users, MaxRejected: -1}
+		r, err := l.LoadCSV(context.Background(), csv.NewReader(strings.NewReader(`name,age,role,status
+bob,-1,root,active
+alice,30,admin,active
+bob,-1,root,active
+`)))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, r.Loaded)
+		assert.Len(t, r.Rejected, 2)
+		assert.Equal(t, 2, r.Rejected[0].Record)
+		assert.Equal(t, 4, r.Rejected[1].Record)
+		assert.Equal(t, []string{"user(alice,30,admin)"}, facts(t, p, `F = user(_, _, _), F.`))
+	})
+
+	t.Run("static procedure", func(t *testing.T) {
+		p := prolog.New(nil, nil)
+		assert.NoError(t, p.Exec(`user(alice, 30, admin).`))
+		l := Loader{Interpreter: p, Mapping: users}
+		_, err := l.LoadCSV(context.Background(), csv.NewReader(strings.NewReader("name,age,role,status\nbob,40,admin,active\n")))
+		assert.Error(t, err)
+	})
+
+	t.Run("stop reading", func(t *testing.T) {
+		p := prolog.New(nil, nil)
+		assert.NoError(t, p.Exec(`user(alice, 30, admin).`))
+		l := Loader{Interpreter: p, Mapping: Mapping{Name: users.Name, Columns: users.Columns}, BatchSize: 1}
+		var in endlessReader
+		_, err := l.LoadCSV(context.Background(), csv.NewReader(io.MultiReader(strings.NewReader("name,age,role,status\n"), &in)))
+		assert.Error(t, err)
+
+		// The input is no longer read after LoadCSV returned.
+		n := in.reads.Load()
+		assert.Zero(t, in.reading.Load())
+		time.Sleep(10 * time.Millisecond)
+		assert.Equal(t, n, in.reads.Load())
+	})
+
+	t.Run("order", func(t *testing.T) {
+		var sb strings.Builder
+		sb.WriteString("n\n")
+		for i := 0; i < 1000; i++ {
+			_, _ = fmt.Fprintf(&sb, "%d\n", i)
+		}
+		p := prolog.New(nil, nil)
+		l := Loader{Interpreter: p, Mapping: Mapping{Name: "n", Columns: []Column{{Field: "n", Type: Integer}}}, Workers: 4, BatchSize: 7}
+		r, err := l.LoadCSV(context.Background(), csv.NewReader(strings.NewReader(sb.String())))
+		assert.NoError(t, err)
+		assert.Equal(t, 1000, r.Loaded)
+		fs := facts(t, p, `F = n(_), F.`)
+		assert.Len(t, fs, 1000)
+		for i, f := range fs {
+			assert.Equal(t, fmt.Sprintf("n(%d)", i), f)
+		}
+	})
+}
+
+// endlessReader is an endless and slow CSV input of the same record.
+type endlessReader struct {
+	reads, reading atomic.Int32
+}
+
+func (r *endlessReader) Read(p []byte) (int, error) {
+	r.reading.Add(1)
+	defer r.reading.Add(-1)
+	r.reads.Add(1)
+	time.Sleep(time.Millisecond)
+	return copy(p, "bob,40,admin,active\n"), nil
+}
+
+func TestLoader_LoadJSON(t *testing.T) {
+	m := Mapping{
+		Name: "user",
+		Columns: []Column{
+			{Field: "name"},
+			{Field: "address.city", Type: String},
+			{Field: "admin", Type: Boolean},
+			{Field: "tags", Type: Term},
+		},
+	}
+
+	t.Run("array", func(t *testing.T) {
+		p := prolog.New(nil, nil)
+		l := Loader{Interpreter: p, Mapping: m}
+		r, err := l.LoadJSON(context.Background(), strings.NewReader(`
+[
+	{"name": "alice", "address": {"city": "Tokyo"}, "admin": true, "tags": ["a", 1]},
+	{"name": "bob", "address": {"city": "Osaka"}, "admin": "false", "tags": "f(X, y)"}
+]
+`))
+		assert.NoError(t, err)
+		assert.Equal(t, &Report{Loaded: 2}, r)
+		assert.Equal(t, []string{`user(alice,"Tokyo",true,[a,1])`}, facts(t, p, `F = user(_, _, _, _), F, ground(F).`))
+		assert.Equal(t, []string{`"Osaka"`}, facts(t, p, `user(bob, F, false, f(X, y)), var(X).`))
+	})
+
+	t.Run("lines", func(t *testing.T) {
+		p := prolog.New(nil, nil)
+		l := Loader{Interpreter: p, Mapping: m, MaxRejected: -1}
+		r, err := l.LoadJSON(context.Background(), strings.NewReader(`{"name": "alice", "address": {"city": "Tokyo"}, "admin": true, "tags": {"b": 2, "a": null}}
+{"name": "bob", "address": {"city": "Osaka"}, "admin": "maybe", "tags": []}
+`))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, r.Loaded)
+		assert.Len(t, r.Rejected, 1)
+		assert.Equal(t, 2, r.Rejected[0].Record)
+		assert.Equal(t, "admin", r.Rejected[0].Field)
+		assert.Equal(t, []string{`user(alice,"Tokyo",true,[a=null,b=2])`}, facts(t, p, `F = user(_, _, _, _), F.`))
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		p := prolog.New(nil, nil)
+		l := Loader{Interpreter: p, Mapping: m}
+		r, err := l.LoadJSON(context.Background(), strings.NewReader(`{"name": "alice", "address": {"city": "Tokyo"}, "admin": true, "tags": []} {"name":`))
+		assert.Error(t, err)
+		assert.Equal(t, 1, r.Loaded)
+	})
+}
@@ -1,6 +1,7 @@
 package prolog
 
 import (
+	"bytes"
 	"context"
 	_ "embed" // for go:embed
 	"errors"
@@ -9,6 +10,7 @@ import (
 	"io/fs"
 	"os"
 	"strings"
+	"sync"
 )
 
 //go:embed bootstrap.pl
@@ -17,7 +19,20 @@ var bootstrap string
 // Interpreter is a Prolog interpreter. The zero value is a valid interpreter without any predicates/operators defined.
 type Interpreter struct {
 	engine.VM
+
+	// AuditLog is where the interpreter writes an AuditRecord in JSON for each solution of queries.
+	// If it's set, queries record their derivations as if TrackDerivation is on.
+	AuditLog io.Writer
+
+	// Strict makes the interpreter detect the common misuse of the API and report it with errors.
+	// See ErrConcurrentUse, ErrNoCurrentSolution, and CheckLeaks.
+	Strict bool
+
 	loaded map[string]struct{}
+
+	busy     int32 // The number of the goroutines using the interpreter while Strict.
+	strictMu sync.Mutex
+	open     map[*Solutions]string // The Solutions neither closed nor exhausted and their callers while Strict.
 }
 
 // New creates a new Prolog interpreter with predefined predicates/operators.
@@ -30,7 +45,9 @@ func New(in io.Reader, out io.Writer) *Interpreter {
 	// Control constructs
 	i.Register1(engine.NewAtom("call"), engine.Call)
 	i.Register3(engine.NewAtom("catch"), engine.Catch)
+	i.Register3(engine.NewAtom("catch_with_backtrace"), engine.CatchWithBacktrace)
 	i.Register1(engine.NewAtom("throw"), engine.Throw)
+	i.Register3(engine.NewAtom("setup_call_cleanup"), engine.SetupCallCleanup)
 
 	// Term unification
 	i.Register2(engine.NewAtom("="), engine.Unify)
@@ -49,6 +66,8 @@ func New(in io.Reader, out io.Writer) *Interpreter {
 	i.Register3(engine.NewAtom("compare"), engine.Compare)
 	i.Register2(engine.NewAtom("sort"), engine.Sort)
 	i.Register2(engine.NewAtom("keysort"), engine.KeySort)
+	i.Register2(engine.NewAtom("msort"), engine.MSort)
+	i.Register4(engine.NewAtom("sort"), engine.Sort4)
 
 	// Term creation and decomposition
 	i.Register3(engine.NewAtom("functor"), engine.Functor)
@@ -71,17 +90,45 @@ func New(in io.Reader, out io.Writer) *Interpreter {
 	// Clause retrieval and information
 	i.Register2(engine.NewAtom("clause"), engine.Clause)
 	i.Register1(engine.NewAtom("current_predicate"), engine.CurrentPredicate)
+	i.Register2(engine.NewAtom("predicate_property"), engine.PredicateProperty)
 
 	// Clause creation and destruction
 	i.Register1(engine.NewAtom("asserta"), engine.Asserta)
 	i.Register1(engine.NewAtom("assertz"), engine.Assertz)
 	i.Register1(engine.NewAtom("retract"), engine.Retract)
 	i.Register1(engine.NewAtom("abolish"), engine.Abolish)
+	i.Register2(engine.NewAtom("asserta"), engine.AssertaRef)
+	i.Register2(engine.NewAtom("assertz"), engine.AssertzRef)
+	i.Register1(engine.NewAtom("erase"), engine.Erase)
+	i.Register2(engine.NewAtom("with_facts"), engine.WithFacts)
+	i.Register1(engine.NewAtom("fact_schema"), engine.FactSchema)
+	i.Register2(engine.NewAtom("instance"), engine.Instance)
+	i.Register3(engine.NewAtom("diff_program"), engine.DiffProgram)
+
+	// Recorded database
+	i.Register3(engine.NewAtom("recorda"), engine.Recorda)
+	i.Register3(engine.NewAtom("recordz"), engine.Recordz)
+	i.Register3(engine.NewAtom("recorded"), engine.Recorded)
 
 	// All solutions
 	i.Register3(engine.NewAtom("findall"), engine.FindAll)
 	i.Register3(engine.NewAtom("bagof"), engine.BagOf)
 	i.Register3(engine.NewAtom("setof"), engine.SetOf)
+	i.Register3(engine.NewAtom("aggregate_all"), engine.AggregateAll)
+	i.Register4(engine.NewAtom("aggregate_stream"), engine.AggregateStream)
+	i.Register4(engine.NewAtom("aggregate_window"), engine.AggregateWindow)
+	i.Register4(engine.NewAtom("foldall"), engine.FoldAll)
+	i.Register3(engine.NewAtom("forall_count"), engine.ForAllCount)
+	i.Register1(engine.NewAtom("random"), engine.Random)
+	i.Register3(engine.NewAtom("random_between"), engine.RandomBetween)
+	i.Register2(engine.NewAtom("random_permutation"), engine.RandomPermutation)
+	i.Register3(engine.NewAtom("crypto_hash"), engine.CryptoHash)
+	i.Register1(engine.NewAtom("get_time"), engine.GetTime)
+	i.Register3(engine.NewAtom("stamp_date_time"), engine.StampDateTime)
+	i.Register2(engine.NewAtom("date_time_stamp"), engine.DateTimeStamp)
+	i.Register3(engine.NewAtom("format_time"), engine.FormatTime)
+	i.Register2(engine.NewAtom("print_message"), engine.PrintMessage)
+	i.Register3(engine.NewAtom("message_to_codes"), engine.MessageToCodes)
 
 	// Stream selection and control
 	i.Register1(engine.NewAtom("current_input"), engine.CurrentInput)
@@ -93,6 +140,9 @@ func New(in io.Reader, out io.Writer) *Interpreter {
 	i.Register1(engine.NewAtom("flush_output"), engine.FlushOutput)
 	i.Register2(engine.NewAtom("stream_property"), engine.StreamProperty)
 	i.Register2(engine.NewAtom("set_stream_position"), engine.SetStreamPosition)
+	i.Register1(engine.NewAtom("at_end_of_stream"), engine.AtEndOfStream)
+	i.Register3(engine.NewAtom("tee_stream"), engine.TeeStream)
+	i.Register2(engine.NewAtom("log_stream"), engine.LogStream)
 
 	// Character input/output
 	i.Register2(engine.NewAtom("get_char"), engine.GetChar)
@@ -122,6 +172,10 @@ func New(in io.Reader, out io.Writer) *Interpreter {
 	i.Register6(engine.NewAtom("call"), engine.Call5)
 	i.Register7(engine.NewAtom("call"), engine.Call6)
 	i.Register8(engine.NewAtom("call"), engine.Call7)
+	i.Register2(engine.NewAtom("yield"), engine.Yield)
+	i.Register3(engine.NewAtom("fallback"), engine.Fallback)
+	i.Register1(engine.NewAtom("prolog_current_frame"), engine.PrologCurrentFrame)
+	i.Register3(engine.NewAtom("prolog_frame_attribute"), engine.PrologFrameAttribute)
 
 	// Atomic term processing
 	i.Register2(engine.NewAtom("atom_length"), engine.AtomLength)
@@ -133,10 +187,22 @@ func New(in io.Reader, out io.Writer) *Interpreter {
 	i.Register2(engine.NewAtom("number_chars"), engine.NumberChars)
 	i.Register2(engine.NewAtom("number_codes"), engine.NumberCodes)
 
+	// Strings
+	i.Register1(engine.NewAtom("string"), engine.TypeString)
+	i.Register3(engine.NewAtom("string_concat"), engine.StringConcat)
+	i.Register4(engine.NewAtom("split_string"), engine.SplitString)
+	i.Register3(engine.NewAtom("string_code"), engine.StringCode)
+	i.Register2(engine.NewAtom("string_chars"), engine.StringChars)
+	i.Register2(engine.NewAtom("string_codes"), engine.StringCodes)
+	i.Register2(engine.NewAtom("string_length"), engine.StringLength)
+	i.Register2(engine.NewAtom("atom_string"), engine.AtomString)
+
 	// Implementation defined hooks
 	i.Register2(engine.NewAtom("set_prolog_flag"), engine.SetPrologFlag)
 	i.Register2(engine.NewAtom("current_prolog_flag"), engine.CurrentPrologFlag)
 	i.Register1(engine.NewAtom("halt"), engine.Halt)
+	i.Register3(engine.NewAtom("prolog_version"), engine.PrologVersion)
+	i.Register1(engine.NewAtom("feature"), engine.FeatureProvided)
 
 	// Consult
 	i.Register1(engine.NewAtom("consult"), engine.Consult)
@@ -153,12 +219,68 @@ func New(in io.Reader, out io.Writer) *Interpreter {
 	i.Register3(engine.NewAtom("nth0"), engine.Nth0)
 	i.Register3(engine.NewAtom("nth1"), engine.Nth1)
 	i.Register2(engine.NewAtom("call_nth"), engine.CallNth)
+	i.Register2(engine.NewAtom("maplist"), engine.MapList1)
+	i.Register3(engine.NewAtom("maplist"), engine.MapList2)
+	i.Register4(engine.NewAtom("maplist"), engine.MapList3)
+	i.Register5(engine.NewAtom("maplist"), engine.MapList4)
+	i.Register6(engine.NewAtom("maplist"), engine.MapList5)
+	i.Register7(engine.NewAtom("maplist"), engine.MapList6)
+	i.Register8(engine.NewAtom("maplist"), engine.MapList7)
+	i.Register4(engine.NewAtom("foldl"), engine.FoldL1)
+	i.Register5(engine.NewAtom("foldl"), engine.FoldL2)
+	i.Register6(engine.NewAtom("foldl"), engine.FoldL3)
+
+	// The builtins which do no I/O, don't touch the database, and depend only on their arguments.
+	for _, pi := range []struct {
+		name  string
+		arity int
+	}{
+		{"=", 2}, {"unify_with_occurs_check", 2}, {"subsumes_term", 2},
+		{"var", 1}, {"atom", 1}, {"integer", 1}, {"float", 1}, {"compound", 1}, {"acyclic_term", 1}, {"string", 1},
+		{"compare", 3}, {"sort", 2}, {"keysort", 2}, {"msort", 2}, {"sort", 4},
+		{"functor", 3}, {"arg", 3}, {"=..", 2}, {"copy_term", 2}, {"term_variables", 2},
+		{"is", 2}, {"=:=", 2}, {`=\=`, 2}, {"<", 2}, {"=<", 2}, {">", 2}, {">=", 2},
+		{"throw", 1}, {"repeat", 0},
+		{"atom_length", 2}, {"atom_concat", 3}, {"sub_atom", 5}, {"atom_chars", 2}, {"atom_codes", 2},
+		{"char_code", 2}, {"number_chars", 2}, {"number_codes", 2},
+		{"string_concat", 3}, {"split_string", 4}, {"string_code", 3}, {"string_chars", 2}, {"string_codes", 2},
+		{"string_length", 2}, {"atom_string", 2},
+		{"prolog_version", 3}, {"feature", 1}, {"crypto_hash", 3},
+		{"stamp_date_time", 3}, {"date_time_stamp", 2},
+		{"append", 3}, {"length", 2}, {"between", 3}, {"succ", 2}, {"nth0", 3}, {"nth1", 3},
+	} {
+		i.DeclarePure(engine.NewAtom(pi.name), pi.arity)
+	}
 
 	_ = i.Exec(bootstrap)
 
 	return &i
 }
 
+// NewWithImage creates a new Prolog interpreter like New and restores the image saved by engine.VM.SaveImage
+// e.g. an image embedded via go:embed. If the initialization goals in the image call your own predicates, use New,
+// register them, and then call LoadImage instead.
+func NewWithImage(in io.Reader, out io.Writer, image []byte) (*Interpreter, error) {
+	i := New(in, out)
+	if err := i.LoadImage(bytes.NewReader(image)); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// Fork returns a new interpreter which starts with the same database, flags, and operators as i.
+// See engine.VM.Fork for what's shared.
+func (i *Interpreter) Fork() *Interpreter {
+	f := Interpreter{VM: *i.VM.Fork(), AuditLog: i.AuditLog, Strict: i.Strict}
+	if i.loaded != nil {
+		f.loaded = make(map[string]struct{}, len(i.loaded))
+		for k, v := range i.loaded {
+			f.loaded[k] = v
+		}
+	}
+	return &f
+}
+
 // Exec executes a prolog program.
 func (i *Interpreter) Exec(query string, args ...interface{}) error {
 	return i.ExecContext(context.Background(), query, args...)
@@ -166,6 +288,12 @@ func (i *Interpreter) Exec(query string, args ...interface{}) error {
 
 // ExecContext executes a prolog program with context.
 func (i *Interpreter) ExecContext(ctx context.Context, query string, args ...interface{}) error {
+	if i.Strict {
+		if err := i.acquire(); err != nil {
+			return err
+		}
+		defer i.release()
+	}
 	return i.Compile(ctx, query, args...)
 }
 
@@ -176,7 +304,22 @@ func (i *Interpreter) Query(query string, args ...interface{}) (*Solutions, erro
 
 // QueryContext executes a prolog query and returns *Solutions with context.
 func (i *Interpreter) QueryContext(ctx context.Context, query string, args ...interface{}) (*Solutions, error) {
+	return i.query(ctx, nil, query, args...)
+}
+
+// QueryScopedContext executes a prolog query like QueryContext but interns atoms made from runtime data in scope.
+// It includes the atoms in the query and args. Call scope.Release() once you're done with the solutions.
+func (i *Interpreter) QueryScopedContext(ctx context.Context, scope *engine.AtomScope, query string, args ...interface{}) (*Solutions, error) {
+	return i.query(ctx, scope, query, args...)
+}
+
+func (i *Interpreter) query(ctx context.Context, scope *engine.AtomScope, query string, args ...interface{}) (*Solutions, error) {
 	p := engine.NewParser(&i.VM, strings.NewReader(query))
+	var env *engine.Env
+	if scope != nil {
+		p.SetAtomScope(scope)
+		env = env.WithAtomScope(scope)
+	}
 	if err := p.SetPlaceholder(engine.NewAtom("?"), args...); err != nil {
 		return nil, err
 	}
@@ -186,23 +329,41 @@ func (i *Interpreter) QueryContext(ctx context.Context, query string, args ...in
 		return nil, err
 	}
 
-	var env *engine.Env
+	auditLog := i.AuditLog
+	if auditLog != nil {
+		env = env.WithDerivation()
+	}
 
 	more := make(chan bool, 1)
 	next := make(chan *engine.Env)
 	sols := Solutions{
 		vm:   &i.VM,
+		env:  env,
 		vars: p.Vars,
+		goal: t,
 		more: more,
 		next: next,
 	}
+	if i.Strict {
+		sols.strict = i
+		i.opened(&sols)
+	}
 
 	go func() {
 		defer close(next)
 		if !<-more {
 			return
 		}
+		// The combinators of Solutions may have replaced the goal and the bindings until now.
+		t, env := sols.goal, sols.env
+		var n int
 		if _, err := engine.Call(&i.VM, t, func(env *engine.Env) *engine.Promise {
+			n++
+			if auditLog != nil {
+				if err := writeAuditRecord(auditLog, &i.VM, query, n, env); err != nil {
+					return engine.Error(err)
+				}
+			}
 			next <- env
 			return engine.Bool(!<-more)
 		}, env).Force(ctx); err != nil {
@@ -213,6 +374,40 @@ func (i *Interpreter) QueryContext(ctx context.Context, query string, args ...in
 	return &sols, nil
 }
 
+// MeasureQuery executes a prolog query for the first solution under the ceilings and returns the resources it consumed.
+// It's for tests asserting that rules stay within budgets e.g. on large inputs. See engine.VM.Measure.
+func (i *Interpreter) MeasureQuery(ctx context.Context, c engine.Ceilings, query string, args ...interface{}) (engine.Measurement, bool, error) {
+	p := engine.NewParser(&i.VM, strings.NewReader(query))
+	if err := p.SetPlaceholder(engine.NewAtom("?"), args...); err != nil {
+		return engine.Measurement{}, false, err
+	}
+	t, err := p.Term()
+	if err != nil {
+		return engine.Measurement{}, false, err
+	}
+	return i.Measure(ctx, t, nil, c)
+}
+
+// WithFacts appends the clauses in text to the database just like assertz/1, calls f, and erases them afterward even if
+// f panics. It's handy for isolating the tests of rule sets from each other.
+func (i *Interpreter) WithFacts(text string, f func() error) error {
+	p := engine.NewParser(&i.VM, strings.NewReader(text))
+	var facts []engine.Term
+	for p.More() {
+		t, err := p.Term()
+		if err != nil {
+			return err
+		}
+		facts = append(facts, t)
+	}
+	erase, err := i.AssertScoped(facts, nil)
+	if err != nil {
+		return err
+	}
+	defer erase()
+	return f()
+}
+
 // ErrNoSolutions indicates there's no solutions for the query.
 var ErrNoSolutions = errors.New("no solutions")
 
@@ -8,8 +8,13 @@ import (
 	"github.com/ichiban/prolog/engine"
 	"github.com/stretchr/testify/assert"
 	"io"
+	"math/rand"
 	"os"
+	"path/filepath"
 	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strings"
 	"testing"
 	"time"
 )
@@ -710,6 +715,135 @@ a.`, output: `syntax err.`},
 	}
 }
 
+func TestNew_streamErrors(t *testing.T) {
+	// Every stream predicate is checked against every erroneous stream it can be given (ISO/IEC 13211-1 8.11-8.14).
+	dir := t.TempDir()
+	file := func(name string, content []byte) string {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, content, 0644))
+		return strings.ReplaceAll(path, `'`, `''`)
+	}
+	var (
+		text   = file("text.txt", []byte("abc"))
+		binary = file("binary.bin", []byte{0x01, 0x02})
+		empty  = file("empty.txt", nil)
+		sink   = file("output.txt", nil)
+	)
+
+	var (
+		textInput     = []string{`get_char(S, _)`, `get_code(S, _)`, `peek_char(S, _)`, `peek_code(S, _)`, `read_term(S, _, [])`, `read(S, _)`}
+		binaryInput   = []string{`get_byte(S, _)`, `peek_byte(S, _)`}
+		textOutput    = []string{`put_char(S, a)`, `put_code(S, 0'a)`, `nl(S)`, `write(S, a)`, `writeq(S, a)`, `write_canonical(S, a)`, `write_term(S, a, [])`}
+		binaryOutput  = []string{`put_byte(S, 0)`}
+		input         = append(append([]string{`set_input(S)`}, textInput...), binaryInput...)
+		output        = append(append([]string{`flush_output(S)`, `set_output(S)`}, textOutput...), binaryOutput...)
+		streamOrAlias = append(append([]string{`at_end_of_stream(S)`, `close(S)`, `set_stream_position(S, 0)`}, input...), output...)
+	)
+
+	type condition struct {
+		name  string
+		setup string
+		err   string
+		goals []string
+	}
+	conditions := []condition{
+		{name: "variable", setup: `true`, err: `instantiation_error`, goals: streamOrAlias},
+		{name: "not a stream", setup: `S = f(x)`, err: `domain_error(stream_or_alias, S)`, goals: streamOrAlias},
+		{name: "not a stream", setup: `S = f(x)`, err: `domain_error(stream, S)`, goals: []string{`stream_property(S, _)`}},
+		{name: "no such alias", setup: `S = nosuch`, err: `existence_error(stream, S)`, goals: streamOrAlias},
+		{name: "closed", setup: fmt.Sprintf(`open('%s', read, S), close(S)`, text), err: `existence_error(stream, S)`, goals: append([]string{`stream_property(S, _)`}, streamOrAlias...)},
+		{name: "output stream", setup: fmt.Sprintf(`open('%s', write, S)`, sink), err: `permission_error(input, stream, S)`, goals: input},
+		{name: "input stream", setup: fmt.Sprintf(`open('%s', read, S)`, text), err: `permission_error(output, stream, S)`, goals: output},
+		{name: "binary input stream", setup: fmt.Sprintf(`open('%s', read, S, [type(binary)])`, binary), err: `permission_error(input, binary_stream, S)`, goals: textInput},
+		{name: "text input stream", setup: fmt.Sprintf(`open('%s', read, S)`, text), err: `permission_error(input, text_stream, S)`, goals: binaryInput},
+		{name: "binary output stream", setup: fmt.Sprintf(`open('%s', write, S, [type(binary)])`, sink), err: `permission_error(output, binary_stream, S)`, goals: textOutput},
+		{name: "text output stream", setup: fmt.Sprintf(`open('%s', write, S)`, sink), err: `permission_error(output, text_stream, S)`, goals: binaryOutput},
+		{name: "past end of text stream", setup: fmt.Sprintf(`open('%s', read, S, [eof_action(error)]), get_char(S, _)`, empty), err: `permission_error(input, past_end_of_stream, S)`, goals: textInput},
+		{name: "past end of binary stream", setup: fmt.Sprintf(`open('%s', read, S, [type(binary), eof_action(error)]), get_byte(S, _)`, empty), err: `permission_error(input, past_end_of_stream, S)`, goals: binaryInput},
+		{name: "not repositionable", setup: fmt.Sprintf(`open('%s', read, S, [reposition(false)])`, text), err: `permission_error(reposition, stream, S)`, goals: []string{`set_stream_position(S, 0)`}},
+	}
+
+	// The same errors are expected when the stream is referred to by its alias.
+	open := regexp.MustCompile(`open\(('(?:[^']|'')*'), (read|write), S(?:, \[(.*)\])?\)`)
+	for _, c := range conditions {
+		if !open.MatchString(c.setup) {
+			continue
+		}
+		c.name += " alias"
+		c.setup = open.ReplaceAllStringFunc(c.setup, func(s string) string {
+			m := open.FindStringSubmatch(s)
+			opts := "alias(s)"
+			if m[3] != "" {
+				opts = m[3] + ", " + opts
+			}
+			return fmt.Sprintf("open(%s, %s, _, [%s]), S = s", m[1], m[2], opts)
+		})
+		var goals []string
+		for _, g := range c.goals {
+			if !strings.HasPrefix(g, "stream_property(") { // stream_property/2 doesn't accept aliases.
+				goals = append(goals, g)
+			}
+		}
+		c.goals = goals
+		conditions = append(conditions, c)
+	}
+
+	for _, c := range conditions {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			for _, g := range c.goals {
+				g := g
+				t.Run(g, func(t *testing.T) {
+					p := New(nil, nil)
+					defer func() {
+						assert.NoError(t, p.QuerySolution(`stream_property(S, file_name(_)), close(S), fail ; true.`).Err())
+					}()
+
+					var r struct {
+						R TermString
+					}
+					q := fmt.Sprintf(`%s, catch((%s, R = none), error(E, _), (E == %s -> R = ok ; R = E)).`, c.setup, g, c.err)
+					assert.NoError(t, p.QuerySolution(q).Scan(&r))
+					assert.Equal(t, TermString("ok"), r.R)
+				})
+			}
+		})
+	}
+}
+
+func TestNew_fallback(t *testing.T) {
+	p := New(nil, nil)
+	var messages []string
+	p.OnMessage = func(_ engine.Severity, _ engine.Term, lines []string) {
+		messages = append(messages, lines...)
+	}
+	assert.NoError(t, p.Exec(`
+geo_lookup(_, _) :- throw(error(timeout, geo_lookup/2)).
+cached_geo_lookup(paris, '48.86,2.35').
+:- fallback(geo_lookup/2, cached_geo_lookup/2).
+`))
+
+	var s struct {
+		Pos string
+	}
+	assert.NoError(t, p.QuerySolution(`geo_lookup(paris, Pos).`).Scan(&s))
+	assert.Equal(t, "48.86,2.35", s.Pos)
+	assert.Len(t, messages, 1)
+	assert.Regexp(t, `^geo_lookup\(paris,_\d+\) raised error\(timeout,geo_lookup/2\), falling back to cached_geo_lookup\(paris,_\d+\)$`, messages[0])
+}
+
+func TestNew_currentGoal(t *testing.T) {
+	p := New(nil, nil)
+	assert.NoError(t, p.Exec(`
+:- set_prolog_flag(debug, on).
+must_be_positive(X) :- X > 0, !.
+must_be_positive(_) :- current_goal(G), throw(assertion_failed(G)).
+withdraw(Amount) :- must_be_positive(Amount).
+`))
+
+	assert.EqualError(t, p.QuerySolution(`withdraw(-1).`).Err(), "assertion_failed(must_be_positive(-1))")
+}
+
 func TestInterpreter_Exec(t *testing.T) {
 	tests := []struct {
 		query   string
@@ -830,6 +964,28 @@ foo(a, 1, 2.0, [abc, def]).
 	}
 }
 
+func TestInterpreter_QueryScopedContext(t *testing.T) {
+	i := New(nil, nil)
+	scope := engine.NewAtomScope()
+	sols, err := i.QueryScopedContext(context.Background(), scope, `atom_chars(A, ?), atom_length(A, N).`, "scoped_query_atom")
+	assert.NoError(t, err)
+
+	var s struct {
+		A string
+		N int
+	}
+	assert.True(t, sols.Next())
+	assert.NoError(t, sols.Scan(&s))
+	assert.Equal(t, "scoped_query_atom", s.A)
+	assert.Equal(t, 17, s.N)
+	assert.NoError(t, sols.Close())
+
+	assert.Equal(t, 1, scope.Len())
+	before := i.AtomStats()
+	scope.Release()
+	assert.Equal(t, before.Temporary-1, i.AtomStats().Temporary)
+}
+
 func TestInterpreter_Query_close(t *testing.T) {
 	var i Interpreter
 	i.Register0(engine.NewAtom("do_not_call"), func(_ *engine.VM, k engine.Cont, env *engine.Env) *engine.Promise {
@@ -841,6 +997,83 @@ func TestInterpreter_Query_close(t *testing.T) {
 	assert.NoError(t, sols.Close())
 }
 
+func TestInterpreter_AuditLog(t *testing.T) {
+	var buf bytes.Buffer
+	i := New(nil, nil)
+	i.AuditLog = &buf
+	assert.NoError(t, i.Exec(`
+:- clause_metadata([author(alice), version(2)]).
+price(apple, 100).
+price(orange, 80).
+:- clause_metadata([]).
+cheap :- price(orange, 80).
+`))
+
+	sols, err := i.Query(`cheap.`)
+	assert.NoError(t, err)
+	assert.True(t, sols.Next())
+	assert.Equal(t, []engine.Provenance{
+		{
+			Indicator: engine.NewAtom("/").Apply(engine.NewAtom("cheap"), engine.Integer(0)),
+			Clause:    engine.NewAtom(":-").Apply(engine.NewAtom("cheap"), engine.NewAtom("price").Apply(engine.NewAtom("orange"), engine.Integer(80))),
+		},
+		{
+			Indicator: engine.NewAtom("/").Apply(engine.NewAtom("price"), engine.Integer(2)),
+			Clause:    engine.NewAtom("price").Apply(engine.NewAtom("orange"), engine.Integer(80)),
+			Metadata:  engine.List(engine.NewAtom("author").Apply(engine.NewAtom("alice")), engine.NewAtom("version").Apply(engine.Integer(2))),
+		},
+	}, sols.Derivation())
+	assert.False(t, sols.Next())
+	assert.NoError(t, sols.Close())
+
+	assert.Equal(t, `{"query":"cheap.","solution":1,"clauses":[{"predicate":"cheap/0","clause":"cheap:-price(orange,80)"},{"predicate":"price/2","clause":"price(orange,80)","metadata":"[author(alice),version(2)]"}],"proof":[{"predicate":"cheap/0","clause":"cheap:-price(orange,80)","children":[{"predicate":"price/2","clause":"price(orange,80)","metadata":"[author(alice),version(2)]"}]}]}
+`, buf.String())
+	assert.False(t, i.TrackDerivation)
+
+	t.Run("proof tree", func(t *testing.T) {
+		i := New(nil, nil)
+		i.AuditLog = io.Discard
+		assert.NoError(t, i.Exec(`
+price(apple, 100).
+price(orange, 80).
+cheap :- price(orange, 80).
+both :- cheap, price(apple, 100).
+`))
+		sols, err := i.Query(`both.`)
+		assert.NoError(t, err)
+		defer func() {
+			assert.NoError(t, sols.Close())
+		}()
+		assert.True(t, sols.Next())
+
+		var tree func(ps []*engine.Proof) []string
+		tree = func(ps []*engine.Proof) []string {
+			var ret []string
+			for _, p := range ps {
+				s := writeq(&i.VM, p.Indicator)
+				for _, c := range tree(p.Children) {
+					s += " [" + c + "]"
+				}
+				ret = append(ret, s)
+			}
+			return ret
+		}
+		assert.Equal(t, []string{"both/0 [cheap/0 [price/2]] [price/2]"}, tree(sols.ProofTree()))
+		assert.Len(t, sols.Derivation(), 4)
+	})
+
+	t.Run("not tracked", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`foo.`))
+		sols, err := i.Query(`foo.`)
+		assert.NoError(t, err)
+		assert.True(t, sols.Next())
+		assert.Nil(t, sols.Derivation())
+		assert.Nil(t, sols.ProofTree())
+		assert.NoError(t, sols.Close())
+	})
+}
+
 func TestMisc(t *testing.T) {
 	t.Run("negation", func(t *testing.T) {
 		i := New(nil, nil)
@@ -850,6 +1083,29 @@ func TestMisc(t *testing.T) {
 		assert.False(t, sols.Next())
 	})
 
+	t.Run("strings", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`
+:- set_prolog_flag(double_quotes, string).
+greeting("hello").
+`))
+
+		sols, err := i.Query(`greeting(G), string(G), string_concat(G, " world", S), split_string(S, " ", "", L).`)
+		assert.NoError(t, err)
+		defer func() {
+			assert.NoError(t, sols.Close())
+		}()
+
+		var s struct {
+			S string
+			L []string
+		}
+		assert.True(t, sols.Next())
+		assert.NoError(t, sols.Scan(&s))
+		assert.Equal(t, "hello world", s.S)
+		assert.Equal(t, []string{"hello", "world"}, s.L)
+	})
+
 	t.Run("cut", func(t *testing.T) {
 		// https://www.cs.uleth.ca/~gaur/post/prolog-cut-negation/
 		t.Run("p", func(t *testing.T) {
@@ -1140,6 +1396,404 @@ foo :- throw(unreachable).
 		assert.NoError(t, sols.Err())
 	})
 
+	t.Run("dialect", func(t *testing.T) {
+		var out bytes.Buffer
+		i := New(nil, &out)
+		assert.Error(t, i.QuerySolution(`not(fail).`).Err())
+
+		assert.NoError(t, i.Exec(`:- set_prolog_flag(dialect, compat).`))
+		assert.NoError(t, i.QuerySolution(`not(fail).`).Err())
+		assert.NoError(t, i.QuerySolution(`concat_atom([a, b], '-', 'a-b'), concat_atom(L, '-', 'a-b'), L = [a, b].`).Err())
+		assert.NoError(t, i.QuerySolution(`string_to_atom("abc", abc).`).Err())
+		assert.NoError(t, i.QuerySolution(`writef('%w-%w\n', [a, b]).`).Err())
+		assert.Equal(t, "a-b\n", out.String())
+
+		assert.NoError(t, i.Exec(`:- set_prolog_flag(dialect, iso).`))
+		assert.Error(t, i.QuerySolution(`not(fail).`).Err())
+	})
+
+	t.Run("clause references", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`:- dynamic(foo/1).`))
+		assert.NoError(t, i.QuerySolution(`assertz(foo(a), R1), assertz(foo(b), R2), asserta(foo(c), _), erase(R1), instance(R2, (foo(b) :- true)), findall(X, foo(X), [c, b]).`).Err())
+		assert.Error(t, i.QuerySolution(`assertz(foo(d), R), erase(R), erase(R).`).Err())
+	})
+
+	t.Run("recorded", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.NoError(t, i.QuerySolution(`recordz(k, a), recordz(k, b, R), recorda(k, c), findall(X, recorded(k, X), [c, a, b]), erase(R), findall(X, recorded(k, X), [c, a]).`).Err())
+		assert.NoError(t, i.QuerySolution(`recorded(k, c, R), instance(R, c).`).Err())
+		assert.Equal(t, ErrNoSolutions, i.QuerySolution(`recorded(j, _).`).Err())
+	})
+
+	t.Run("all solutions", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`
+age(peter, 7).
+age(ann, 11).
+age(pat, 8).
+age(tom, 5).
+age(mike, 11).
+age(bob, 11).
+
+nums(N, N, [N]) :- !.
+nums(M, N, [M|Ns]) :- M1 is M + 1, nums(M1, N, Ns).
+`))
+		assert.NoError(t, i.QuerySolution(`findall(A-Ns, bagof(N, age(N, A), Ns), [7-[peter], 11-[ann, mike, bob], 8-[pat], 5-[tom]]).`).Err())
+		assert.NoError(t, i.QuerySolution(`findall(A-Ns, setof(N, age(N, A), Ns), [7-[peter], 11-[ann, bob, mike], 8-[pat], 5-[tom]]).`).Err())
+		assert.NoError(t, i.QuerySolution(`setof(A-N, age(N, A), [5-tom, 7-peter, 8-pat, 11-ann, 11-bob, 11-mike]).`).Err())
+		assert.NoError(t, i.QuerySolution(`aggregate_all(count, age(_, _), 6), aggregate_all(sum(A), age(_, A), 53), aggregate_all(max(A), age(_, A), 11).`).Err())
+		assert.NoError(t, i.QuerySolution(`aggregate_all(set(A), age(_, A), [5, 7, 8, 11]), aggregate_all(bag(N), age(N, 11), [ann, mike, bob]).`).Err())
+		assert.NoError(t, i.QuerySolution(`aggregate_all(topk(2, A-N), age(N, A), [11-mike, 11-bob]).`).Err())
+
+		i.SetUserInput(engine.NewInputTextStream(strings.NewReader(`age(peter, 7). age(ann, 11). age(pat, 8).`)))
+		assert.NoError(t, i.QuerySolution(`aggregate_stream(sum(A), age(_, A), user_input, 26).`).Err())
+		assert.NoError(t, i.QuerySolution(`nums(1, 5000, L), findall(X-_, member(X, L), S), length(S, 5000), setof(X, member(X, L), L).`).Err())
+	})
+
+	t.Run("random and hash", func(t *testing.T) {
+		i := New(nil, nil)
+		i.Rand = rand.New(rand.NewSource(1))
+		assert.NoError(t, i.QuerySolution(`random(X), X >= 0.0, X < 1.0.`).Err())
+		assert.NoError(t, i.QuerySolution(`random_between(1, 6, X), between(1, 6, X).`).Err())
+		assert.NoError(t, i.QuerySolution(`random_permutation([a, b, c], P), msort(P, [a, b, c]).`).Err())
+		assert.NoError(t, i.QuerySolution(`crypto_hash(md5, abc, '900150983cd24fb0d6963f7d28e17f72').`).Err())
+		assert.NoError(t, i.QuerySolution(`crypto_hash(sha256, "abc", 'ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad').`).Err())
+	})
+
+	t.Run("date and time", func(t *testing.T) {
+		i := New(nil, nil)
+		i.Clock = func() time.Time {
+			return time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC)
+		}
+		assert.NoError(t, i.QuerySolution(`get_time(T), stamp_date_time(T, date(2023, 4, 5, 6, 7, _, 0, 'UTC', false), 'UTC').`).Err())
+		assert.NoError(t, i.QuerySolution(`get_time(T), stamp_date_time(T, D, 'UTC'), date_time_stamp(D, T).`).Err())
+		assert.NoError(t, i.QuerySolution(`get_time(T), stamp_date_time(T, D, 'UTC'), format_time(atom('2023-04-05T06:07:08'), '%FT%T', D).`).Err())
+	})
+
+	t.Run("messages", func(t *testing.T) {
+		var lines []string
+		i := New(nil, nil)
+		i.OnMessage = func(severity engine.Severity, term engine.Term, ls []string) {
+			lines = append(lines, severity.String()+": "+strings.Join(ls, "\n"))
+		}
+		assert.NoError(t, i.QuerySolution(`catch(atom_length(X, _), E, print_message(error, E)).`).Err())
+		assert.NoError(t, i.QuerySolution(`message_to_codes(error(type_error(integer, a), foo/1), error, Cs), atom_codes(A, Cs), sub_atom(A, 0, _, _, 'foo/1: Type error').`).Err())
+		assert.Equal(t, []string{"error: atom_length/2: Arguments are not sufficiently instantiated"}, lines)
+	})
+
+	t.Run("fact schema", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`
+:- dynamic(user/3).
+:- fact_schema(user(atom, integer, oneof([admin, guest]))).
+user(alice, 30, admin).
+`))
+		assert.NoError(t, i.QuerySolution(`assertz(user(bob, 40, guest)), findall(N, user(N, _, _), [alice, bob]).`).Err())
+		assert.NoError(t, i.QuerySolution(`catch(assertz(user(carol, old, root)), error(schema_error([violation(_, 2, integer, old), violation(_, 3, _, root)]), _), true).`).Err())
+		assert.NoError(t, i.QuerySolution(`catch(assertz(user(carol, old, root)), E, true), message_to_codes(E, error, Cs), atom_codes(A, Cs), sub_atom(A, 0, _, _, 'Schema violation: argument 2 of user(carol,old,root)').`).Err())
+		assert.Error(t, i.Exec(`
+:- fact_schema(item(atom, number)).
+item(apple, 1.5).
+item(pear, cheap).
+`))
+		assert.NoError(t, i.QuerySolution(`fact_schema(tag(atom)), assertz(tag(a)), \+ catch(assertz(tag(1)), _, fail).`).Err())
+	})
+
+	t.Run("list and apply", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`plus(X, V0, V) :- V is V0 + X.`))
+		assert.NoError(t, i.QuerySolution(`findall(X, between(1, 5, X), L), maplist(succ, L, L1), foldl(plus, L1, 0, S), S = 20.`).Err())
+		assert.NoError(t, i.QuerySolution(`msort([b, a, c, a], [a, a, b, c]), sort(0, @>=, [b, a, c, a], [c, b, a, a]).`).Err())
+		assert.NoError(t, i.QuerySolution(`sort(2, @<, [f(1, b), f(2, a), f(3, b)], [f(2, a), f(1, b)]).`).Err())
+		assert.NoError(t, i.QuerySolution(`maplist(=(x), L), length(L, 2), !, L = [x, x].`).Err())
+	})
+
+	t.Run("image", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`
+:- op(700, xfx, ===>).
+:- set_prolog_flag(double_quotes, atom).
+:- dynamic(counter/1).
+counter(0).
+greet(Name, S) :- atom_concat('hello, ', Name, S).
+`))
+		var buf bytes.Buffer
+		assert.NoError(t, i.SaveImage(&buf))
+
+		i, err := NewWithImage(nil, nil, buf.Bytes())
+		assert.NoError(t, err)
+		assert.NoError(t, i.QuerySolution(`greet(world, 'hello, world').`).Err())
+		assert.NoError(t, i.QuerySolution(`retract(counter(0)), assertz(counter(1)), counter(1).`).Err())
+		assert.NoError(t, i.QuerySolution(`X = (a ===> b), X =.. ['===>', a, b].`).Err())
+		assert.NoError(t, i.QuerySolution(`current_prolog_flag(double_quotes, atom), X = "abc", atom(X).`).Err())
+
+		i, err = NewWithImage(nil, nil, []byte("foo"))
+		assert.Error(t, err)
+		assert.Nil(t, i)
+	})
+
+	t.Run("read_term options", func(t *testing.T) {
+		i := New(strings.NewReader(`foo(X, _, Y, X). bar(A, A).`), nil)
+		assert.NoError(t, i.QuerySolution(`read_term(T, [variables(Vs), variable_names(Ns), singletons(Ss)]), T = foo(X, A, Y, X), Vs == [X, A, Y], Ns == ['X'=X, 'Y'=Y], Ss == ['Y'=Y].`).Err())
+		assert.NoError(t, i.QuerySolution(`read_term(T, [variable_names(Ns), singletons(Ss)]), T = bar(A, A), Ns == ['A'=A], Ss == [].`).Err())
+	})
+
+	t.Run("purity", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`
+:- dynamic(seen/1).
+len([], 0).
+len([_|T], N) :- len(T, N0), N is N0 + 1.
+lens(Ls, Ns) :- maplist(len, Ls, Ns).
+log(X) :- write(X), nl.
+remember(X) :- assertz(seen(X)).
+`))
+		assert.NoError(t, i.QuerySolution(`predicate_property(len(_, _), pure), predicate_property(lens(_, _), pure), predicate_property(member(_, _), pure).`).Err())
+		assert.NoError(t, i.QuerySolution(`\+ predicate_property(log(_), pure), \+ predicate_property(remember(_), pure), \+ predicate_property(seen(_), pure).`).Err())
+		assert.NoError(t, i.QuerySolution(`predicate_property(seen(_), dynamic), predicate_property(len(_, _), number_of_clauses(2)), predicate_property(atom_length(_, _), built_in).`).Err())
+	})
+
+	t.Run("parallel conjunction", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`
+digit(D) :- between(0, 9, D).
+pair(X, Y) :- digit(X), digit(Y), X + Y =:= 9.
+`))
+		i.Parallel = true
+
+		assert.NoError(t, i.QuerySolution(`findall(X-Y, pair(X, Y), [0-9, 1-8, 2-7, 3-6, 4-5, 5-4, 6-3, 7-2, 8-1, 9-0]).`).Err())
+	})
+
+	t.Run("version and features", func(t *testing.T) {
+		i := New(nil, nil)
+		major, minor, patch := engine.Version()
+		assert.NoError(t, i.QuerySolution(`prolog_version(?, ?, ?).`, major, minor, patch).Err())
+		assert.NoError(t, i.QuerySolution(`feature(strings), \+ feature(tabling), findall(F, feature(F), [strings|_]).`).Err())
+		assert.NoError(t, i.Exec(`
+text(S) :- feature(strings) -> S = "yes" ; S = no.
+`))
+		var s struct {
+			S string
+		}
+		assert.NoError(t, i.QuerySolution(`text(S).`).Scan(&s))
+		assert.Equal(t, "yes", s.S)
+	})
+
+	t.Run("setup_call_cleanup", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`
+:- dynamic(cl/1).
+cut :- setup_call_cleanup(true, member(X, [1, 2]), assertz(cl(X))), !.
+det :- setup_call_cleanup(true, X = 1, assertz(cl(X))), cl(1).
+exception :- catch(call_cleanup(throw(e), assertz(cl(e))), e, true).
+`))
+		assert.NoError(t, i.QuerySolution(`cut, retract(cl(1)).`).Err())
+		assert.NoError(t, i.QuerySolution(`det, retract(cl(1)).`).Err())
+		assert.NoError(t, i.QuerySolution(`exception, retract(cl(e)).`).Err())
+		assert.NoError(t, i.QuerySolution(`\+ setup_call_cleanup(true, fail, assertz(cl(f))), retract(cl(f)).`).Err())
+
+		// Closing the solutions abandons the choice points of member/2.
+		assert.NoError(t, i.QuerySolution(`setup_call_cleanup(true, member(X, [a, b]), assertz(cl(X))).`).Err())
+		assert.NoError(t, i.QuerySolution(`retract(cl(a)).`).Err())
+	})
+
+	t.Run("index", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`
+:- dynamic(edge/2).
+:- index(edge/2, [1, 2]).
+:- index(edge/2, [2]).
+edge(a, b).
+edge(b, c).
+edge(c, c).
+`))
+
+		from := func(to string) []string {
+			sols, err := i.Query(fmt.Sprintf(`edge(X, %s).`, to))
+			assert.NoError(t, err)
+			defer func() {
+				assert.NoError(t, sols.Close())
+			}()
+
+			var xs []string
+			for sols.Next() {
+				var s struct {
+					X string
+				}
+				assert.NoError(t, sols.Scan(&s))
+				xs = append(xs, s.X)
+			}
+			return xs
+		}
+
+		assert.Equal(t, []string{"b", "c"}, from("c"))
+		assert.NoError(t, i.Exec(`:- assertz(edge(d, c)), asserta(edge(e, c)), retract(edge(b, c)).`))
+		assert.Equal(t, []string{"e", "c", "d"}, from("c"))
+		assert.NoError(t, i.QuerySolution(`edge(d, c).`).Err())
+		assert.Equal(t, ErrNoSolutions, i.QuerySolution(`edge(b, c).`).Err())
+	})
+
+	t.Run("soft-cut", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`
+s(X) :- (member(X, [1, 2, 3]) *-> ! ; true).
+s(4).
+`))
+
+		tests := []struct {
+			query string
+			xs    []interface{}
+		}{
+			{query: `(member(X, [1, 2, 3]) *-> true ; X = 0).`, xs: []interface{}{1, 2, 3}},
+			{query: `(fail *-> X = 1 ; X = 0).`, xs: []interface{}{0}},
+			{query: `member(X, [1, 2]) *-> true.`, xs: []interface{}{1, 2}},
+			{query: `fail *-> X = 1.`, xs: nil},
+			{query: `G = (member(X, [1, 2]) *-> true ; X = 0), call(G).`, xs: []interface{}{1, 2}},
+			{query: `if(member(X, [1, 2]), true, X = 0).`, xs: []interface{}{1, 2}},
+			{query: `if(fail, X = 1, X = 0).`, xs: []interface{}{0}},
+			{query: `((member(X, [1, 2]), !) *-> true ; X = 0).`, xs: []interface{}{1}},
+			{query: `s(X).`, xs: []interface{}{1}},
+			{query: `catch((throw(e) *-> X = 1 ; X = 0), e, X = caught).`, xs: []interface{}{"caught"}},
+			{query: `catch((true *-> throw(e) ; X = 0), e, X = caught).`, xs: []interface{}{"caught"}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.query, func(t *testing.T) {
+				sols, err := i.Query(tt.query)
+				assert.NoError(t, err)
+				defer func() {
+					assert.NoError(t, sols.Close())
+				}()
+
+				var xs []interface{}
+				for sols.Next() {
+					var s struct {
+						X interface{}
+					}
+					assert.NoError(t, sols.Scan(&s))
+					xs = append(xs, s.X)
+				}
+				assert.NoError(t, sols.Err())
+				assert.Equal(t, tt.xs, xs)
+			})
+		}
+	})
+
+	t.Run("last call", func(t *testing.T) {
+		// Without last-call optimization, the chain of continuations exhausts the limited stack.
+		defer debug.SetMaxStack(debug.SetMaxStack(1 << 18))
+
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`
+count(N, N) :- !.
+count(I, N) :- I1 is I + 1, count(I1, N).
+
+loop(I, N) :- (I < N -> I1 is I + 1, loop(I1, N) ; true).
+`))
+		assert.NoError(t, i.QuerySolution(`count(0, 20000).`).Err())
+		assert.NoError(t, i.QuerySolution(`loop(0, 20000).`).Err())
+	})
+
+	t.Run("constant memory", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("long loops")
+		}
+
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`
+count(N, N) :- !.
+count(I, N) :- I1 is I + 1, count(I1, N).
+`))
+
+		// Measure the heap at the end of the loop while everything the loop retains is still reachable.
+		var heap uint64
+		i.Register0(engine.NewAtom("heap"), func(_ *engine.VM, k engine.Cont, env *engine.Env) *engine.Promise {
+			runtime.GC()
+			var m runtime.MemStats
+			runtime.ReadMemStats(&m)
+			heap = m.HeapAlloc
+			return k(env)
+		})
+
+		assert.NoError(t, i.QuerySolution(`count(0, 100000), heap.`).Err())
+		small := heap
+		assert.NoError(t, i.QuerySolution(`count(0, 1000000), heap.`).Err())
+		large := heap
+
+		// 900000 more iterations would take hundreds of megabytes if each left something behind.
+		assert.Less(t, int64(large)-int64(small), int64(1<<20))
+	})
+
+	t.Run("cut barriers", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`
+a(X) :- (X = 1, ! ; X = 2).
+a(3).
+b(X) :- (true -> X = 1, ! ; X = 2).
+b(3).
+c(X) :- (fail -> true ; X = 1, !).
+c(3).
+d(X) :- call((member(X, [1, 2]), !)).
+d(3).
+e(X) :- \+ (member(X, [1, 2]), !), X = 4.
+e(3).
+f(X) :- findall(Y, (member(Y, [1, 2]), !), X).
+f(3).
+g(X) :- catch((member(X, [1, 2]), !), _, true).
+g(3).
+h(X) :- G = (member(X, [1, 2]), !), G.
+h(3).
+i(X) :- true, (member(X, [1, 2]), ! ; X = 0).
+i(3).
+j(X) :- ((member(X, [1, 2]), !) -> true ; true).
+j(3).
+k(X) :- (member(X, [1, 2]) -> true).
+k(3).
+`))
+
+		tests := []struct {
+			query string
+			xs    []interface{}
+		}{
+			// A cut in a disjunction or in the then/else branch of if-then-else is transparent.
+			{query: `a(X).`, xs: []interface{}{1}},
+			{query: `b(X).`, xs: []interface{}{1}},
+			{query: `c(X).`, xs: []interface{}{1}},
+			{query: `i(X).`, xs: []interface{}{1}},
+
+			// call/1, \+/1, findall/3, catch/3, a variable goal, and the condition of if-then-else are opaque.
+			{query: `d(X).`, xs: []interface{}{1, 3}},
+			{query: `e(X).`, xs: []interface{}{3}},
+			{query: `f(X).`, xs: []interface{}{[]interface{}{1}, 3}},
+			{query: `g(X).`, xs: []interface{}{1, 3}},
+			{query: `h(X).`, xs: []interface{}{1, 3}},
+			{query: `j(X).`, xs: []interface{}{1, 3}},
+			{query: `k(X).`, xs: []interface{}{1, 3}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.query, func(t *testing.T) {
+				sols, err := i.Query(tt.query)
+				assert.NoError(t, err)
+				defer func() {
+					assert.NoError(t, sols.Close())
+				}()
+
+				var xs []interface{}
+				for sols.Next() {
+					var s struct {
+						X interface{}
+					}
+					assert.NoError(t, sols.Scan(&s))
+					xs = append(xs, s.X)
+				}
+				assert.NoError(t, sols.Err())
+				assert.Equal(t, tt.xs, xs)
+			})
+		}
+	})
+
 	t.Run("counter", func(t *testing.T) {
 		i := New(nil, nil)
 		assert.NoError(t, i.Exec(`
@@ -1240,6 +1894,88 @@ foo(c, d).
 	})
 }
 
+func TestInterpreter_MeasureQuery(t *testing.T) {
+	i := New(nil, nil)
+	assert.NoError(t, i.Exec(`
+nat(0, []) :- !.
+nat(N, [N|Ns]) :- N1 is N - 1, nat(N1, Ns).
+`))
+
+	m, ok, err := i.MeasureQuery(context.Background(), engine.Ceilings{}, `nat(?, _).`, 100)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 101, m.Depth)
+
+	_, _, err = i.MeasureQuery(context.Background(), engine.Ceilings{Depth: 50}, `nat(?, _).`, 100)
+	assert.EqualError(t, err, "error(resource_error(call_depth),nat/2)")
+
+	_, _, err = i.MeasureQuery(context.Background(), engine.Ceilings{}, `nat(`)
+	assert.Error(t, err)
+}
+
+func TestInterpreter_WithFacts(t *testing.T) {
+	i := New(nil, nil)
+	assert.NoError(t, i.Exec(`
+:- dynamic(role/2).
+admin(U) :- role(U, admin).
+`))
+	count := func() int {
+		var n int
+		sols, err := i.Query(`role(_, _).`)
+		assert.NoError(t, err)
+		for sols.Next() {
+			n++
+		}
+		assert.NoError(t, sols.Close())
+		return n
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		assert.NoError(t, i.WithFacts(`role(alice, admin). role(bob, user).`, func() error {
+			assert.Equal(t, 2, count())
+			return i.QuerySolution(`admin(alice), \+admin(bob).`).Err()
+		}))
+		assert.Equal(t, 0, count())
+	})
+
+	t.Run("error", func(t *testing.T) {
+		err := errors.New("failed")
+		assert.Equal(t, err, i.WithFacts(`role(alice, admin).`, func() error {
+			return err
+		}))
+		assert.Equal(t, 0, count())
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		assert.Panics(t, func() {
+			_ = i.WithFacts(`role(alice, admin).`, func() error {
+				panic("failed")
+			})
+		})
+		assert.Equal(t, 0, count())
+	})
+
+	t.Run("static", func(t *testing.T) {
+		assert.Error(t, i.WithFacts(`role(alice, admin). admin(bob).`, func() error {
+			t.Fatal("unreachable")
+			return nil
+		}))
+		assert.Equal(t, 0, count())
+	})
+
+	t.Run("syntax error", func(t *testing.T) {
+		assert.Error(t, i.WithFacts(`role(alice, `, func() error {
+			t.Fatal("unreachable")
+			return nil
+		}))
+	})
+
+	t.Run("with_facts/2", func(t *testing.T) {
+		assert.NoError(t, i.QuerySolution(`with_facts([role(carol, admin)], admin(carol)), \+role(_, _).`).Err())
+		assert.Equal(t, 0, count())
+	})
+}
+
 func ExampleInterpreter_Exec_placeholders() {
 	p := New(nil, os.Stdout)
 
@@ -1599,6 +2335,121 @@ func ExampleNew_arg() {
 	// error(type_error(compound,3),arg/3)
 }
 
+func TestInterpreter_Strict(t *testing.T) {
+	newInterpreter := func() *Interpreter {
+		i := New(nil, nil)
+		i.Strict = true
+		assert.NoError(t, i.Exec(`foo(a). foo(b).`))
+		return i
+	}
+
+	t.Run("closed", func(t *testing.T) {
+		i := newInterpreter()
+		sols, err := i.Query(`foo(X).`)
+		assert.NoError(t, err)
+		assert.True(t, sols.Next())
+		assert.NoError(t, sols.Close())
+
+		assert.False(t, sols.Next())
+		assert.Equal(t, ErrClosed, sols.Err())
+		var s struct{ X string }
+		assert.Equal(t, ErrClosed, sols.Scan(&s))
+	})
+
+	t.Run("scan before next", func(t *testing.T) {
+		i := newInterpreter()
+		sols, err := i.Query(`foo(X).`)
+		assert.NoError(t, err)
+		defer func() {
+			assert.NoError(t, sols.Close())
+		}()
+
+		var s struct{ X string }
+		assert.Equal(t, ErrNoCurrentSolution, sols.Scan(&s))
+		assert.True(t, sols.Next())
+		assert.NoError(t, sols.Scan(&s))
+		assert.Equal(t, "a", s.X)
+	})
+
+	t.Run("scan after error", func(t *testing.T) {
+		i := newInterpreter()
+		sols, err := i.Query(`foo(X), throw(oops).`)
+		assert.NoError(t, err)
+		defer func() {
+			assert.NoError(t, sols.Close())
+		}()
+
+		assert.False(t, sols.Next())
+		assert.Error(t, sols.Err())
+		var s struct{ X string }
+		err = sols.Scan(&s)
+		assert.True(t, errors.Is(err, ErrNoCurrentSolution))
+		assert.EqualError(t, err, "no current solution: the query failed: oops")
+	})
+
+	t.Run("query solution", func(t *testing.T) {
+		i := newInterpreter()
+		var s struct{ X string }
+		assert.NoError(t, i.QuerySolution(`foo(X).`).Scan(&s))
+		assert.Equal(t, "a", s.X)
+		assert.NoError(t, i.CheckLeaks())
+	})
+
+	t.Run("leaks", func(t *testing.T) {
+		i := newInterpreter()
+
+		exhausted, err := i.Query(`foo(X).`)
+		assert.NoError(t, err)
+		for exhausted.Next() {
+		}
+
+		_, file, line, _ := runtime.Caller(0)
+		abandoned, err := i.Query(`foo(X).`)
+		assert.NoError(t, err)
+		assert.True(t, abandoned.Next())
+
+		err = i.CheckLeaks()
+		assert.True(t, errors.Is(err, ErrUnclosedSolutions))
+		assert.EqualError(t, err, fmt.Sprintf("solutions not closed: 1 opened at %s:%d", file, line+1))
+
+		assert.NoError(t, abandoned.Close())
+		assert.NoError(t, i.CheckLeaks())
+	})
+
+	t.Run("concurrent use", func(t *testing.T) {
+		i := newInterpreter()
+		started, done := make(chan struct{}), make(chan struct{})
+		i.Register0(engine.NewAtom("wait"), func(_ *engine.VM, k engine.Cont, env *engine.Env) *engine.Promise {
+			close(started)
+			<-done
+			return k(env)
+		})
+
+		sols, err := i.Query(`wait.`)
+		assert.NoError(t, err)
+		ok := make(chan bool)
+		go func() {
+			ok <- sols.Next()
+		}()
+		<-started
+
+		assert.Equal(t, ErrConcurrentUse, i.Exec(`bar.`))
+		other, err := i.Query(`foo(X).`)
+		assert.NoError(t, err)
+		assert.False(t, other.Next())
+		assert.Equal(t, ErrConcurrentUse, other.Err())
+		assert.NoError(t, other.Close())
+
+		close(done)
+		assert.True(t, <-ok)
+		assert.NoError(t, sols.Close())
+
+		forked := i.Fork()
+		assert.True(t, forked.Strict)
+		assert.NoError(t, forked.Exec(`bar.`))
+	})
+}
+
 func TestDefaultFS_Open(t *testing.T) {
 	var fs defaultFS
 	f, err := fs.Open("interpreter.go")
@@ -0,0 +1,496 @@
+// Package lint checks Prolog texts for common mistakes with the static analyses of the compiler and reports them as
+// findings with positions and severities e.g. for editors and CI:
+//
+//	findings, err := lint.Text(ctx, p, "rules.pl", text)
+//	for _, f := range findings {
+//		fmt.Println(f) // rules.pl:3:1: warning: Singleton variables: [Y] (singleton)
+//	}
+//
+// The text is consulted in a fork of the interpreter so that the cross-reference checks see the predicates defined in
+// the interpreter as well as the ones in the text. The directives in the text are run as usual.
+package lint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/ichiban/prolog"
+	"github.com/ichiban/prolog/engine"
+)
+
+// Check is the name of a check.
+type Check string
+
+// Checks.
+const (
+	// CheckSyntax reports the term which can't be read. The rest of the text isn't checked.
+	CheckSyntax Check = "syntax"
+	// CheckLoad reports the error which stops consulting the text e.g. a directive raising an exception.
+	CheckLoad Check = "load"
+	// CheckSchema reports the facts which don't conform to their fact_schema/1 declarations.
+	CheckSchema Check = "schema"
+	// CheckDiscontiguous reports the clauses of a predicate which aren't together without discontiguous/1.
+	CheckDiscontiguous Check = "discontiguous"
+	// CheckSingleton reports the named variables which appear only once in a clause. Names starting with _ are exempt.
+	CheckSingleton Check = "singleton"
+	// CheckUndefined reports the calls to the procedures which are neither defined, declared, nor foreign.
+	CheckUndefined Check = "undefined"
+	// CheckFloundering reports the negations which are called with unbound variables used after them.
+	CheckFloundering Check = "floundering"
+	// CheckPurity reports the predicates which have side effects or call unknown goals. See engine.VM.IsPure.
+	CheckPurity Check = "purity"
+)
+
+// Finding is a problem found in a Prolog text.
+type Finding struct {
+	File     string
+	Line     int // Line is 1-based. It's 0 if the position is unknown.
+	Column   int // Column is 1-based and counted in characters.
+	Severity engine.Severity
+	Check    Check
+	Message  string
+}
+
+// String returns the finding in the format of compilers e.g. "foo.pl:3:1: warning: Singleton variables: [X] (singleton)".
+func (f Finding) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s (%s)", f.File, f.Line, f.Column, f.Severity, f.Message, f.Check)
+}
+
+// MarshalJSON encodes the finding with the name of the severity.
+func (f Finding) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		File     string `json:"file"`
+		Line     int    `json:"line"`
+		Column   int    `json:"column"`
+		Severity string `json:"severity"`
+		Check    Check  `json:"check"`
+		Message  string `json:"message"`
+	}{
+		File:     f.File,
+		Line:     f.Line,
+		Column:   f.Column,
+		Severity: f.Severity.String(),
+		Check:    f.Check,
+		Message:  f.Message,
+	})
+}
+
+// Text checks the Prolog text of file against p and returns the findings in the order of their positions.
+// p isn't modified. It returns an error only if ctx is done.
+func Text(ctx context.Context, p *prolog.Interpreter, file, text string) ([]Finding, error) {
+	l := linter{ctx: ctx, p: p.Fork(), file: file}
+	l.p.OnMessage = func(engine.Severity, engine.Term, []string) {} // The findings tell the problems instead.
+
+	ok := l.read(text)
+	l.checkClauses()
+	if ok && l.load(text) {
+		l.checkXref()
+	}
+
+	sort.SliceStable(l.findings, func(i, j int) bool {
+		a, b := l.findings[i], l.findings[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return l.findings, ctx.Err()
+}
+
+type linter struct {
+	ctx      context.Context
+	p        *prolog.Interpreter
+	file     string
+	terms    []term
+	findings []Finding
+
+	discontiguous []engine.Term // The predicate indicators of the discontiguous predicates.
+}
+
+// term is a term in the text as read.
+type term struct {
+	position
+	expanded  engine.Term
+	vars      []engine.ParsedVariable
+	directive engine.Term // The goal if it's a directive.
+	pi        predicateIndicator
+}
+
+type predicateIndicator struct {
+	name  engine.Atom
+	arity int
+}
+
+func (pi predicateIndicator) term() engine.Term {
+	return atomSlash.Apply(pi.name, engine.Integer(pi.arity))
+}
+
+var (
+	atomDiscontiguous = engine.NewAtom("discontiguous")
+	atomError         = engine.NewAtom("error")
+	atomIf            = engine.NewAtom(":-")
+	atomOp            = engine.NewAtom("op")
+	atomSchemaError   = engine.NewAtom("schema_error")
+	atomSlash         = engine.NewAtom("/")
+)
+
+func (l *linter) report(pos position, s engine.Severity, c Check, format string, args ...interface{}) {
+	l.findings = append(l.findings, Finding{
+		File:     l.file,
+		Line:     pos.line,
+		Column:   pos.column,
+		Severity: s,
+		Check:    c,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// read reads the terms in the text with their positions. It runs op/3 directives as it goes so that the rest of the
+// text is read with the operators. It tells if the whole text is read.
+func (l *linter) read(text string) bool {
+	r := newReader(ignoreShebangLine(text))
+	p := engine.NewParser(&l.p.VM, r)
+	for p.More() {
+		t, err := p.Term()
+		if err != nil {
+			l.report(r.start, engine.SeverityError, CheckSyntax, "%v", err)
+			return false
+		}
+		tm := term{position: r.start, vars: p.Vars}
+		r.reset()
+
+		if c, ok := t.(engine.Compound); ok && c.Functor() == atomIf && c.Arity() == 1 {
+			tm.directive = c.Arg(0)
+			if d, ok := tm.directive.(engine.Compound); ok && d.Functor() == atomOp && d.Arity() == 3 {
+				_, _ = engine.Call(&l.p.VM, d, engine.Success, nil).Force(l.ctx)
+			}
+			l.terms = append(l.terms, tm)
+			continue
+		}
+
+		tm.expanded = t
+		v := engine.NewVariable()
+		_, _ = engine.ExpandTerm(&l.p.VM, t, v, func(env *engine.Env) *engine.Promise {
+			tm.expanded = env.Resolve(v)
+			return engine.Bool(true)
+		}, nil).Force(l.ctx)
+		tm.pi = headOf(tm.expanded)
+		l.terms = append(l.terms, tm)
+	}
+	return true
+}
+
+// checkClauses checks each term on its own.
+func (l *linter) checkClauses() {
+	var (
+		declared = map[predicateIndicator]bool{}
+		seen     = map[predicateIndicator]bool{}
+		reported = map[predicateIndicator]bool{}
+		last     predicateIndicator
+	)
+	for _, t := range l.terms {
+		var singletons []string
+		for _, v := range t.vars {
+			if n := v.Name.String(); v.Count == 1 && !strings.HasPrefix(n, "_") {
+				singletons = append(singletons, n)
+			}
+		}
+		if len(singletons) > 0 {
+			l.report(t.position, engine.SeverityWarning, CheckSingleton, "Singleton variables: [%s]", strings.Join(singletons, ","))
+		}
+
+		if t.directive != nil {
+			if d, ok := t.directive.(engine.Compound); ok && d.Functor() == atomDiscontiguous && d.Arity() == 1 {
+				for _, pi := range indicators(d.Arg(0)) {
+					declared[pi] = true
+				}
+			}
+			last = predicateIndicator{} // A directive ends the clauses of the predicate before it.
+			continue
+		}
+
+		if t.pi != last && seen[t.pi] && !declared[t.pi] && !reported[t.pi] {
+			l.report(t.position, engine.SeverityError, CheckDiscontiguous, "Clauses of %s are not together", l.writeq(t.pi.term()))
+			reported[t.pi] = true
+			l.discontiguous = append(l.discontiguous, t.pi.term())
+		}
+		seen[t.pi], last = true, t.pi
+
+		for _, w := range engine.Floundering(t.expanded, t.vars) {
+			l.report(t.position, engine.SeverityWarning, CheckFloundering, "%s", l.message(w))
+		}
+	}
+}
+
+// load consults the text in the interpreter as if the discontiguous predicates were declared so. It tells if the text
+// is loaded.
+func (l *linter) load(text string) bool {
+	if len(l.discontiguous) > 0 {
+		var sb strings.Builder
+		sb.WriteString(":- discontiguous(")
+		sb.WriteString(l.writeq(engine.List(l.discontiguous...)))
+		sb.WriteString(").\n")
+		i := 0
+		if strings.HasPrefix(text, "#!") {
+			i = strings.Index(text, "\n") + 1
+			if i == 0 {
+				i = len(text)
+			}
+		}
+		text = text[:i] + sb.String() + text[i:]
+	}
+
+	err := l.p.Compile(l.ctx, text)
+	if err == nil {
+		return true
+	}
+	e, ok := err.(engine.Exception)
+	if !ok {
+		l.report(position{}, engine.SeverityError, CheckLoad, "%v", err)
+		return false
+	}
+	vs, ok := schemaViolations(e.Term())
+	if !ok {
+		l.report(position{}, engine.SeverityError, CheckLoad, "%s", l.message(e.Term()))
+		return false
+	}
+	for _, v := range vs {
+		pos := position{}
+		if c, ok := v.(engine.Compound); ok && c.Arity() == 4 {
+			pos = l.fact(c.Arg(0))
+		}
+		l.report(pos, engine.SeverityError, CheckSchema, "%s", l.message(atomError.Apply(atomSchemaError.Apply(engine.List(v)), engine.NewVariable())))
+	}
+	return false
+}
+
+// checkXref checks the clauses against the database.
+func (l *linter) checkXref() {
+	defined := map[predicateIndicator]bool{}
+	for _, t := range l.terms {
+		if t.directive != nil {
+			continue
+		}
+		for _, pi := range l.p.UndefinedCalls(t.expanded) {
+			l.report(t.position, engine.SeverityWarning, CheckUndefined, "Unknown procedure: %s", l.writeq(pi))
+		}
+
+		if defined[t.pi] {
+			continue
+		}
+		defined[t.pi] = true
+		if p, ok := l.p.Clauses(t.pi.name, t.pi.arity); ok && p.Dynamic {
+			continue
+		}
+		if !l.p.IsPure(t.pi.name, t.pi.arity) {
+			l.report(t.position, engine.SeverityInformational, CheckPurity, "%s is not pure", l.writeq(t.pi.term()))
+		}
+	}
+}
+
+// fact returns the position of the clause which is fact.
+func (l *linter) fact(fact engine.Term) position {
+	for _, t := range l.terms {
+		if t.expanded == nil {
+			continue
+		}
+		if t.expanded.Compare(fact, nil) == 0 {
+			return t.position
+		}
+	}
+	return position{}
+}
+
+// message returns the text of a message term e.g. floundering(\+ G, Vars, Bindings) as print_message/2 does.
+func (l *linter) message(t engine.Term) string {
+	var (
+		msg   string
+		codes = engine.NewVariable()
+	)
+	_, _ = engine.MessageToCodes(&l.p.VM, t, atomError, codes, func(env *engine.Env) *engine.Promise {
+		var sb strings.Builder
+		iter := engine.ListIterator{List: codes, Env: env}
+		for iter.Next() {
+			if c, ok := env.Resolve(iter.Current()).(engine.Integer); ok {
+				sb.WriteRune(rune(c))
+			}
+		}
+		msg = sb.String()
+		return engine.Bool(true)
+	}, nil).Force(l.ctx)
+	return msg
+}
+
+func (l *linter) writeq(t engine.Term) string {
+	var sb strings.Builder
+	s := engine.NewOutputTextStream(&sb)
+	_, _ = engine.WriteTerm(&l.p.VM, s, t, engine.List(engine.NewAtom("quoted").Apply(engine.NewAtom("true"))), engine.Success, nil).Force(l.ctx)
+	return sb.String()
+}
+
+// headOf returns the predicate indicator of the head of clause.
+func headOf(clause engine.Term) predicateIndicator {
+	h := clause
+	if c, ok := h.(engine.Compound); ok && c.Functor() == atomIf && c.Arity() == 2 {
+		h = c.Arg(0)
+	}
+	switch h := h.(type) {
+	case engine.Atom:
+		return predicateIndicator{name: h}
+	case engine.Compound:
+		return predicateIndicator{name: h.Functor(), arity: h.Arity()}
+	default:
+		return predicateIndicator{}
+	}
+}
+
+// indicators returns the predicate indicators in the argument of a declaration e.g. foo/1, [foo/1, bar/2], or
+// (foo/1, bar/2).
+func indicators(t engine.Term) []predicateIndicator {
+	c, ok := t.(engine.Compound)
+	if !ok {
+		return nil
+	}
+	switch {
+	case c.Functor() == atomSlash && c.Arity() == 2:
+		n, ok := c.Arg(0).(engine.Atom)
+		if !ok {
+			return nil
+		}
+		a, ok := c.Arg(1).(engine.Integer)
+		if !ok {
+			return nil
+		}
+		return []predicateIndicator{{name: n, arity: int(a)}}
+	case c.Functor() == engine.NewAtom(",") && c.Arity() == 2:
+		return append(indicators(c.Arg(0)), indicators(c.Arg(1))...)
+	default:
+		var pis []predicateIndicator
+		iter := engine.ListIterator{List: c}
+		for iter.Next() {
+			pis = append(pis, indicators(iter.Current())...)
+		}
+		return pis
+	}
+}
+
+// schemaViolations returns the violations if t is error(schema_error(Violations), _).
+func schemaViolations(t engine.Term) ([]engine.Term, bool) {
+	e, ok := t.(engine.Compound)
+	if !ok || e.Functor() != atomError || e.Arity() != 2 {
+		return nil, false
+	}
+	f, ok := e.Arg(0).(engine.Compound)
+	if !ok || f.Functor() != atomSchemaError || f.Arity() != 1 {
+		return nil, false
+	}
+	var vs []engine.Term
+	iter := engine.ListIterator{List: f.Arg(0)}
+	for iter.Next() {
+		vs = append(vs, iter.Current())
+	}
+	return vs, true
+}
+
+// ignoreShebangLine blanks out the shebang line if any so that the lines are counted as they are.
+func ignoreShebangLine(text string) string {
+	if !strings.HasPrefix(text, "#!") {
+		return text
+	}
+	i := strings.Index(text, "\n")
+	if i < 0 {
+		return ""
+	}
+	return text[i:]
+}
+
+// position is a position in a text.
+type position struct {
+	line, column int
+}
+
+// reader reads a text and remembers where the current term starts i.e. the first character which is neither a white
+// space nor in a comment after the previous term.
+type reader struct {
+	r     io.RuneReader
+	pos   position // The position of the next character.
+	state readerState
+	start position
+}
+
+type readerState int
+
+const (
+	readerSeeking readerState = iota
+	readerSlash               // Seen / which may start a block comment.
+	readerLineComment
+	readerBlockComment
+	readerBlockCommentStar // Seen * which may end a block comment.
+	readerInTerm
+)
+
+func newReader(text string) *reader {
+	return &reader{r: strings.NewReader(text), pos: position{line: 1, column: 1}}
+}
+
+func (r *reader) ReadRune() (rune, int, error) {
+	c, n, err := r.r.ReadRune()
+	if err != nil {
+		return c, n, err
+	}
+	pos := r.pos
+	if c == '\n' {
+		r.pos.line++
+		r.pos.column = 1
+	} else {
+		r.pos.column++
+	}
+
+	switch r.state {
+	case readerSeeking:
+		switch {
+		case unicode.IsSpace(c):
+		case c == '%':
+			r.state = readerLineComment
+		case c == '/':
+			r.state, r.start = readerSlash, pos
+		default:
+			r.state, r.start = readerInTerm, pos
+		}
+	case readerSlash:
+		if c == '*' {
+			r.state = readerBlockComment
+		} else {
+			r.state = readerInTerm
+		}
+	case readerLineComment:
+		if c == '\n' {
+			r.state = readerSeeking
+		}
+	case readerBlockComment:
+		if c == '*' {
+			r.state = readerBlockCommentStar
+		}
+	case readerBlockCommentStar:
+		switch c {
+		case '/':
+			r.state = readerSeeking
+		case '*':
+		default:
+			r.state = readerBlockComment
+		}
+	}
+	return c, n, nil
+}
+
+// reset starts seeking the next term.
+func (r *reader) reset() {
+	if r.state == readerInTerm {
+		r.state = readerSeeking
+	}
+}
@@ -0,0 +1,141 @@
+package lint
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ichiban/prolog"
+	"github.com/ichiban/prolog/engine"
+)
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		title    string
+		text     string
+		findings []string
+	}{
+		{title: "clean", text: `
+foo(X) :- bar(X).
+bar(a).
+`},
+		{title: "singleton", text: `% A comment.
+/* A block
+comment. */ foo(X, Y, _Z) :- bar(X).
+bar(a).
+`, findings: []string{
+			"a.pl:3:13: warning: Singleton variables: [Y] (singleton)",
+		}},
+		{title: "undefined", text: `
+foo(X) :- bar(X), (baz(X) -> true ; findall(Y, qux(X, Y), _)).
+bar(a).
+:- dynamic(baz/1).
+`, findings: []string{
+			"a.pl:2:1: warning: Unknown procedure: qux/2 (undefined)",
+			"a.pl:2:1: informational: foo/1 is not pure (purity)",
+		}},
+		{title: "discontiguous", text: `
+foo(a).
+bar(a).
+foo(b).
+bar(b).
+foo(c).
+`, findings: []string{
+			"a.pl:4:1: error: Clauses of foo/1 are not together (discontiguous)",
+			"a.pl:5:1: error: Clauses of bar/1 are not together (discontiguous)",
+		}},
+		{title: "declared discontiguous", text: `
+:- discontiguous([foo/1]).
+foo(a).
+bar(a).
+foo(b).
+`},
+		{title: "floundering", text: `
+foo :- \+ bar(X), bar(X).
+bar(a).
+`, findings: []string{
+			"a.pl:2:1: warning: Floundering: \\+bar(X) is called with X unbound (floundering)",
+		}},
+		{title: "purity", text: `
+hello :- greeting(G), write(G).
+greeting(hello).
+`, findings: []string{
+			"a.pl:2:1: informational: hello/0 is not pure (purity)",
+		}},
+		{title: "dcg", text: `
+greeting --> [hello], name.
+name --> [world].
+`},
+		{title: "operators", text: `
+:- op(700, xfx, likes).
+alice likes bob.
+`},
+		{title: "shebang", text: `#!/usr/bin/env 1pl
+foo(X).
+`, findings: []string{
+			"a.pl:2:1: warning: Singleton variables: [X] (singleton)",
+		}},
+		{title: "schema", text: `
+:- fact_schema(age(atom, integer)).
+age(alice, 3).
+age(bob, x).
+`, findings: []string{
+			"a.pl:4:1: error: Schema violation: argument 2 of age(bob,x): `integer' expected, found `x' (schema)",
+		}},
+		{title: "load", text: `
+:- foo.
+`, findings: []string{
+			"a.pl:0:0: error: Unknown procedure: foo/0 (load)",
+		}},
+		{title: "syntax", text: `
+foo(X).
+bar(.
+baz(Y).
+`, findings: []string{
+			"a.pl:2:1: warning: Singleton variables: [X] (singleton)",
+			"a.pl:3:1: error: unexpected token: end(.) (syntax)",
+		}},
+	}
+
+	p := prolog.New(nil, nil)
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			fs, err := Text(context.Background(), p, "a.pl", tt.text)
+			assert.NoError(t, err)
+			var ss []string
+			for _, f := range fs {
+				ss = append(ss, f.String())
+			}
+			assert.Equal(t, tt.findings, ss)
+		})
+	}
+
+	t.Run("interpreter is intact", func(t *testing.T) {
+		_, err := Text(context.Background(), p, "a.pl", `foo(a).`)
+		assert.NoError(t, err)
+		_, ok := p.Clauses(engine.NewAtom("foo"), 1)
+		assert.False(t, ok)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := Text(ctx, p, "a.pl", `foo(a).`)
+		assert.Equal(t, context.Canceled, err)
+	})
+}
+
+func TestFinding_MarshalJSON(t *testing.T) {
+	b, err := json.Marshal(Finding{
+		File:     "a.pl",
+		Line:     3,
+		Column:   1,
+		Severity: engine.SeverityWarning,
+		Check:    CheckSingleton,
+		Message:  "Singleton variables: [X]",
+	})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"file":"a.pl","line":3,"column":1,"severity":"warning","check":"singleton","message":"Singleton variables: [X]"}`, string(b))
+}
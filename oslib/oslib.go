@@ -0,0 +1,170 @@
+// Package oslib provides builtin predicates to interact with the operating system.
+//
+// They're not available by default so that embedded or sandboxed programs can't reach the host.
+// Call Install to enable them e.g. for scripting:
+//
+//	p := prolog.New(os.Stdin, os.Stdout)
+//	oslib.Install(&p.VM)
+//
+// The predicates are:
+//
+//   - getenv(+Name, -Value) succeeds iff the environment variable Name is set to Value.
+//   - setenv(+Name, +Value) sets the environment variable Name to Value.
+//   - shell(+Command, -Status) runs Command by the shell and unifies Status with its exit status.
+//   - argv(-List) unifies List with the command-line arguments including the program name.
+//   - pid(-PID) unifies PID with the process ID.
+//   - directory_files(+Directory, -Entries) unifies Entries with the names of the entries in Directory.
+package oslib
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/ichiban/prolog/engine"
+)
+
+// Install registers the predicates of the operating system interface to vm.
+func Install(vm *engine.VM) {
+	vm.Register2(engine.NewAtom("getenv"), Getenv)
+	vm.Register2(engine.NewAtom("setenv"), Setenv)
+	vm.Register2(engine.NewAtom("shell"), Shell)
+	vm.Register1(engine.NewAtom("argv"), Argv)
+	vm.Register1(engine.NewAtom("pid"), PID)
+	vm.Register2(engine.NewAtom("directory_files"), DirectoryFiles)
+}
+
+// Getenv succeeds iff the environment variable name is set and its value unifies with value.
+func Getenv(vm *engine.VM, name, value engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+	n, err := text(name, env)
+	if err != nil {
+		return engine.Error(err)
+	}
+	v, ok := os.LookupEnv(n)
+	if !ok {
+		return engine.Bool(false)
+	}
+	return engine.Unify(vm, value, engine.NewAtom(v), k, env)
+}
+
+// Setenv sets the environment variable name to value.
+func Setenv(_ *engine.VM, name, value engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+	n, err := text(name, env)
+	if err != nil {
+		return engine.Error(err)
+	}
+	v, err := text(value, env)
+	if err != nil {
+		return engine.Error(err)
+	}
+	if err := os.Setenv(n, v); err != nil {
+		return engine.Error(engine.DomainError(atomEnvironmentVariable, name, env))
+	}
+	return k(env)
+}
+
+// Shell runs command by sh and unifies status with its exit status.
+// The command shares the standard input, output, and error of the process.
+func Shell(vm *engine.VM, command, status engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+	c, err := text(command, env)
+	if err != nil {
+		return engine.Error(err)
+	}
+	return engine.Delay(func(ctx context.Context) *engine.Promise {
+		cmd := exec.CommandContext(ctx, "sh", "-c", c)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		err := cmd.Run()
+		var exitErr *exec.ExitError
+		switch {
+		case err == nil:
+			return engine.Unify(vm, status, engine.Integer(0), k, env)
+		case errors.As(err, &exitErr):
+			return engine.Unify(vm, status, engine.Integer(exitErr.ExitCode()), k, env)
+		default:
+			return engine.Error(err)
+		}
+	})
+}
+
+// Argv unifies list with the command-line arguments of the process including the program name.
+func Argv(vm *engine.VM, list engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+	args := make([]engine.Term, len(os.Args))
+	for i, a := range os.Args {
+		args[i] = engine.NewAtom(a)
+	}
+	return engine.Unify(vm, list, engine.List(args...), k, env)
+}
+
+// PID unifies pid with the process ID.
+func PID(vm *engine.VM, pid engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+	return engine.Unify(vm, pid, engine.Integer(os.Getpid()), k, env)
+}
+
+// DirectoryFiles unifies entries with the names of the entries in directory in lexical order.
+// As well as the other Prolog processors, they include '.' and '..'.
+func DirectoryFiles(vm *engine.VM, directory, entries engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+	d, err := text(directory, env)
+	if err != nil {
+		return engine.Error(err)
+	}
+	es, err := os.ReadDir(d)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return engine.Error(engine.ExistenceError(atomDirectory, directory, env))
+	case errors.Is(err, fs.ErrPermission):
+		return engine.Error(engine.PermissionError(engine.OperationOpen, atomDirectory, directory, env))
+	case err != nil:
+		return engine.Error(err)
+	}
+	names := []string{".", ".."}
+	for _, e := range es {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	ts := make([]engine.Term, len(names))
+	for i, n := range names {
+		ts[i] = engine.NewAtom(n)
+	}
+	return engine.Unify(vm, entries, engine.List(ts...), k, env)
+}
+
+// text returns the text of t which is either an atom, a list of characters, or a list of character codes.
+func text(t engine.Term, env *engine.Env) (string, error) {
+	switch t := env.Resolve(t).(type) {
+	case engine.Variable:
+		return "", engine.InstantiationError(env)
+	case engine.Atom:
+		return t.String(), nil
+	}
+
+	var sb strings.Builder
+	iter := engine.ListIterator{List: t, Env: env}
+	for iter.Next() {
+		switch e := env.Resolve(iter.Current()).(type) {
+		case engine.Variable:
+			return "", engine.InstantiationError(env)
+		case engine.Atom:
+			if r := []rune(e.String()); len(r) == 1 {
+				_, _ = sb.WriteRune(r[0])
+				continue
+			}
+		case engine.Integer:
+			_, _ = sb.WriteRune(rune(e))
+			continue
+		}
+		return "", engine.TypeError(engine.ValidTypeText, t, env)
+	}
+	if err := iter.Err(); err != nil {
+		return "", engine.TypeError(engine.ValidTypeText, t, env)
+	}
+	return sb.String(), nil
+}
+
+var (
+	atomDirectory           = engine.NewAtom("directory")
+	atomEnvironmentVariable = engine.NewAtom("environment_variable")
+)
@@ -0,0 +1,71 @@
+package oslib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ichiban/prolog"
+)
+
+func TestInstall(t *testing.T) {
+	t.Run("disabled by default", func(t *testing.T) {
+		p := prolog.New(nil, nil)
+		for _, q := range []string{`getenv('HOME', _).`, `pid(_).`, `shell(true, _).`} {
+			assert.Error(t, p.QuerySolution(q).Err(), q)
+		}
+	})
+
+	p := prolog.New(nil, nil)
+	Install(&p.VM)
+
+	t.Run("getenv/setenv", func(t *testing.T) {
+		t.Setenv("OSLIB_TEST", "")
+		assert.NoError(t, p.QuerySolution(`setenv('OSLIB_TEST', foo).`).Err())
+		assert.Equal(t, "foo", os.Getenv("OSLIB_TEST"))
+
+		var s struct{ V string }
+		assert.NoError(t, p.QuerySolution(`getenv('OSLIB_TEST', V).`).Scan(&s))
+		assert.Equal(t, "foo", s.V)
+
+		assert.NoError(t, os.Unsetenv("OSLIB_TEST"))
+		assert.Equal(t, prolog.ErrNoSolutions, p.QuerySolution(`getenv('OSLIB_TEST', _).`).Err())
+		assert.Error(t, p.QuerySolution(`getenv(_, _).`).Err())
+		assert.Error(t, p.QuerySolution(`setenv(foo, f(x)).`).Err())
+	})
+
+	t.Run("shell", func(t *testing.T) {
+		var s struct{ S int }
+		assert.NoError(t, p.QuerySolution(`shell(true, S).`).Scan(&s))
+		assert.Equal(t, 0, s.S)
+		assert.NoError(t, p.QuerySolution(`shell('exit 3', S).`).Scan(&s))
+		assert.Equal(t, 3, s.S)
+	})
+
+	t.Run("argv", func(t *testing.T) {
+		var s struct{ Args []string }
+		assert.NoError(t, p.QuerySolution(`argv(Args).`).Scan(&s))
+		assert.Equal(t, os.Args, s.Args)
+	})
+
+	t.Run("pid", func(t *testing.T) {
+		var s struct{ PID int }
+		assert.NoError(t, p.QuerySolution(`pid(PID).`).Scan(&s))
+		assert.Equal(t, os.Getpid(), s.PID)
+	})
+
+	t.Run("directory_files", func(t *testing.T) {
+		dir := t.TempDir()
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "b.pl"), nil, 0644))
+		assert.NoError(t, os.Mkdir(filepath.Join(dir, "a"), 0755))
+
+		var s struct{ Entries []string }
+		assert.NoError(t, p.QuerySolution(`directory_files(?, Entries).`, dir).Scan(&s))
+		assert.Equal(t, []string{".", "..", "a", "b.pl"}, s.Entries)
+
+		err := p.QuerySolution(`catch(directory_files(?, _), error(existence_error(directory, _), _), fail).`, filepath.Join(dir, "none")).Err()
+		assert.Equal(t, prolog.ErrNoSolutions, err)
+	})
+}
@@ -0,0 +1,232 @@
+// Package policy provides a policy decision point backed by a Prolog program.
+//
+// A policy program defines allow/3 and optionally deny/3 over subject, action, and resource.
+// A request is allowed iff allow/3 succeeds and deny/3 doesn't. Otherwise, it's denied.
+package policy
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ichiban/prolog"
+	"github.com/ichiban/prolog/engine"
+)
+
+// Decision is the result of an authorization request.
+type Decision int
+
+// Decisions.
+const (
+	Deny Decision = iota
+	Allow
+)
+
+func (d Decision) String() string {
+	return [...]string{
+		Deny:  "deny",
+		Allow: "allow",
+	}[d]
+}
+
+// Explanation tells why the decision was made.
+type Explanation struct {
+	// Clauses are the clauses which derived the decision in the order of use.
+	// It's empty if the request is denied by default i.e. neither allow/3 nor deny/3 succeeded.
+	Clauses []engine.Provenance
+
+	vm *engine.VM
+}
+
+func (e Explanation) String() string {
+	var sb strings.Builder
+	for _, p := range e.Clauses {
+		_, _ = fmt.Fprintf(&sb, "%s: %s\n", writeq(e.vm, p.Indicator), writeq(e.vm, p.Clause))
+	}
+	return sb.String()
+}
+
+// Policy is a compiled policy program.
+type Policy struct {
+	i *prolog.Interpreter
+}
+
+// New compiles the policy program.
+func New(program string) (*Policy, error) {
+	i := prolog.New(nil, nil)
+	if err := i.Exec(program); err != nil {
+		return nil, err
+	}
+	return &Policy{i: i}, nil
+}
+
+// Decide evaluates the request. subject, action, and resource are converted to Prolog terms:
+// strings to atoms, numbers to numbers, bools to true/false, slices and arrays to lists,
+// and structs and maps to lists of Key=Value pairs ordered by key.
+// A struct field is keyed by its `prolog` tag if any, otherwise by its name.
+// The atoms made of the strings in the request are released after the decision so that a long-running service doesn't
+// accumulate user IDs or resource paths in the atom table.
+func (p *Policy) Decide(ctx context.Context, subject, action, resource interface{}) (Decision, Explanation, error) {
+	s := engine.NewAtomScope()
+	defer s.Release()
+
+	var args [3]engine.Term
+	for i, v := range []interface{}{subject, action, resource} {
+		t, err := termOf(s, reflect.ValueOf(v))
+		if err != nil {
+			return Deny, Explanation{}, err
+		}
+		args[i] = t
+	}
+
+	ok, e, err := p.solve(ctx, s, atomDeny, args)
+	switch {
+	case err != nil:
+		return Deny, Explanation{}, err
+	case ok:
+		return Deny, e, nil
+	}
+
+	ok, e, err = p.solve(ctx, s, atomAllow, args)
+	switch {
+	case err != nil:
+		return Deny, Explanation{}, err
+	case ok:
+		return Allow, e, nil
+	default:
+		return Deny, Explanation{vm: &p.i.VM}, nil
+	}
+}
+
+func (p *Policy) solve(ctx context.Context, s *engine.AtomScope, name engine.Atom, args [3]engine.Term) (bool, Explanation, error) {
+	vm := &p.i.VM
+	goal := name.Apply(args[:]...)
+	// An undefined rule such as deny/3 simply fails.
+	goal = atomCatch.Apply(goal, atomError.Apply(atomExistenceError.Apply(atomProcedure, atomSlash.Apply(name, engine.Integer(3))), engine.NewVariable()), atomFail)
+
+	e := Explanation{vm: vm}
+	ok, err := engine.Call(vm, goal, func(env *engine.Env) *engine.Promise {
+		e.Clauses = engine.Derivation(env)
+		return engine.Bool(true)
+	}, engine.NewEnv().WithDerivation().WithAtomScope(s)).Force(ctx)
+	return ok, e, err
+}
+
+func termOf(s *engine.AtomScope, o reflect.Value) (engine.Term, error) {
+	if !o.IsValid() {
+		return atomEmptyList, nil
+	}
+	if t, ok := o.Interface().(engine.Term); ok {
+		return t, nil
+	}
+
+	switch o.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if o.IsNil() {
+			return atomEmptyList, nil
+		}
+		return termOf(s, o.Elem())
+	case reflect.String:
+		return s.NewAtom(o.String()), nil
+	case reflect.Bool:
+		if o.Bool() {
+			return atomTrue, nil
+		}
+		return atomFalse, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return engine.Integer(o.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := o.Uint()
+		if u > math.MaxInt64 {
+			return nil, fmt.Errorf("integer overflow: %d", u)
+		}
+		return engine.Integer(u), nil
+	case reflect.Float32, reflect.Float64:
+		return engine.Float(o.Float()), nil
+	case reflect.Slice, reflect.Array:
+		ts := make([]engine.Term, o.Len())
+		for i := range ts {
+			t, err := termOf(s, o.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			ts[i] = t
+		}
+		return engine.List(ts...), nil
+	case reflect.Map:
+		if o.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("map key is not string: %s", o.Type())
+		}
+		keys := o.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+		ts := make([]engine.Term, len(keys))
+		for i, k := range keys {
+			t, err := termOf(s, o.MapIndex(k))
+			if err != nil {
+				return nil, err
+			}
+			ts[i] = atomEqual.Apply(s.NewAtom(k.String()), t)
+		}
+		return engine.List(ts...), nil
+	case reflect.Struct:
+		type field struct {
+			name  string
+			value reflect.Value
+		}
+		t := o.Type()
+		var fs []field
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name := f.Name
+			if alias, ok := f.Tag.Lookup("prolog"); ok {
+				name = alias
+			}
+			fs = append(fs, field{name: name, value: o.Field(i)})
+		}
+		sort.Slice(fs, func(i, j int) bool {
+			return fs[i].name < fs[j].name
+		})
+		ts := make([]engine.Term, len(fs))
+		for i, f := range fs {
+			t, err := termOf(s, f.value)
+			if err != nil {
+				return nil, err
+			}
+			ts[i] = atomEqual.Apply(engine.NewAtom(f.name), t)
+		}
+		return engine.List(ts...), nil
+	default:
+		return nil, fmt.Errorf("can't convert to term: %v", o)
+	}
+}
+
+func writeq(vm *engine.VM, t engine.Term) string {
+	var sb strings.Builder
+	s := engine.NewOutputTextStream(&sb)
+	_, _ = engine.WriteTerm(vm, s, t, engine.List(atomQuoted.Apply(atomTrue)), engine.Success, nil).Force(context.Background())
+	return sb.String()
+}
+
+var (
+	atomAllow          = engine.NewAtom("allow")
+	atomCatch          = engine.NewAtom("catch")
+	atomDeny           = engine.NewAtom("deny")
+	atomEmptyList      = engine.NewAtom("[]")
+	atomEqual          = engine.NewAtom("=")
+	atomError          = engine.NewAtom("error")
+	atomExistenceError = engine.NewAtom("existence_error")
+	atomFail           = engine.NewAtom("fail")
+	atomFalse          = engine.NewAtom("false")
+	atomProcedure      = engine.NewAtom("procedure")
+	atomQuoted         = engine.NewAtom("quoted")
+	atomSlash          = engine.NewAtom("/")
+	atomTrue           = engine.NewAtom("true")
+)
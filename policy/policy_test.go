@@ -0,0 +1,141 @@
+package policy
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ichiban/prolog/engine"
+)
+
+type user struct {
+	Name  string   `prolog:"name"`
+	Roles []string `prolog:"roles"`
+	Age   int
+}
+
+const program = `
+allow(S, read, doc(_)) :- member(roles=Roles, S), member(reader, Roles).
+allow(S, write, doc(Owner)) :- member(name=Owner, S).
+
+deny(S, _, _) :- member(name=mallory, S).
+`
+
+func TestPolicy_Decide(t *testing.T) {
+	p, err := New(program)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		title    string
+		subject  interface{}
+		action   interface{}
+		resource interface{}
+		decision Decision
+		clauses  []engine.Term
+		err      bool
+	}{
+		{title: "allow", subject: user{Name: "alice", Roles: []string{"reader"}}, action: "read", resource: engine.NewAtom("doc").Apply(engine.NewAtom("x")), decision: Allow, clauses: []engine.Term{
+			engine.NewAtom("/").Apply(engine.NewAtom("allow"), engine.Integer(3)),
+		}},
+		{title: "allow: owner", subject: &user{Name: "bob"}, action: "write", resource: engine.NewAtom("doc").Apply(engine.NewAtom("bob")), decision: Allow, clauses: []engine.Term{
+			engine.NewAtom("/").Apply(engine.NewAtom("allow"), engine.Integer(3)),
+		}},
+		{title: "deny by default", subject: user{Name: "bob"}, action: "read", resource: engine.NewAtom("doc").Apply(engine.NewAtom("x")), decision: Deny},
+		{title: "deny explicitly", subject: map[string]interface{}{"name": "mallory", "roles": []string{"reader"}}, action: "read", resource: engine.NewAtom("doc").Apply(engine.NewAtom("x")), decision: Deny, clauses: []engine.Term{
+			engine.NewAtom("/").Apply(engine.NewAtom("deny"), engine.Integer(3)),
+		}},
+		{title: "unsupported", subject: make(chan int), action: "read", resource: "x", decision: Deny, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			d, e, err := p.Decide(context.Background(), tt.subject, tt.action, tt.resource)
+			assert.Equal(t, tt.err, err != nil)
+			assert.Equal(t, tt.decision, d)
+
+			// Clauses from the library such as member/2 may follow the rule.
+			var pis []engine.Term
+			for i, c := range e.Clauses {
+				if i < len(tt.clauses) {
+					pis = append(pis, c.Indicator)
+				}
+			}
+			assert.Equal(t, tt.clauses, pis)
+		})
+	}
+}
+
+func TestPolicy_Decide_noDeny(t *testing.T) {
+	p, err := New(`allow(alice, read, x).`)
+	assert.NoError(t, err)
+	d, e, err := p.Decide(context.Background(), "alice", "read", "x")
+	assert.NoError(t, err)
+	assert.Equal(t, Allow, d)
+	assert.Equal(t, "allow/3: allow(alice,read,x)\n", e.String())
+}
+
+func TestPolicy_Decide_error(t *testing.T) {
+	p, err := New(`allow(_, _, _) :- throw(oops).`)
+	assert.NoError(t, err)
+	d, _, err := p.Decide(context.Background(), "alice", "read", "x")
+	assert.Error(t, err)
+	assert.Equal(t, Deny, d)
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(`allow(`)
+	assert.Error(t, err)
+}
+
+func TestDecision_String(t *testing.T) {
+	assert.Equal(t, "allow", Allow.String())
+	assert.Equal(t, "deny", Deny.String())
+}
+
+func TestTermOf(t *testing.T) {
+	type s struct {
+		B bool
+		F float64
+		P *int
+		U uint8
+	}
+	as := engine.NewAtomScope()
+	defer as.Release()
+	tm, err := termOf(as, reflect.ValueOf(s{B: true, F: 1.5, U: 2}))
+	assert.NoError(t, err)
+	assert.Equal(t, engine.List(
+		engine.NewAtom("=").Apply(engine.NewAtom("B"), engine.NewAtom("true")),
+		engine.NewAtom("=").Apply(engine.NewAtom("F"), engine.Float(1.5)),
+		engine.NewAtom("=").Apply(engine.NewAtom("P"), engine.NewAtom("[]")),
+		engine.NewAtom("=").Apply(engine.NewAtom("U"), engine.Integer(2)),
+	), tm)
+
+	_, err = termOf(as, reflect.ValueOf(map[int]int{}))
+	assert.Error(t, err)
+
+	tm, err = termOf(as, reflect.ValueOf([]interface{}{uint64(math.MaxInt64), uintptr(1)}))
+	assert.NoError(t, err)
+	assert.Equal(t, engine.List(engine.Integer(math.MaxInt64), engine.Integer(1)), tm)
+
+	_, err = termOf(as, reflect.ValueOf(uint64(math.MaxInt64+1)))
+	assert.Error(t, err)
+	_, err = termOf(as, reflect.ValueOf(uint(math.MaxUint)))
+	assert.Error(t, err)
+}
+
+func TestPolicy_Decide_atoms(t *testing.T) {
+	p, err := New(program)
+	assert.NoError(t, err)
+
+	var vm engine.VM
+	before := vm.AtomStats()
+	d, _, err := p.Decide(context.Background(), map[string]interface{}{"name": "policy_user_1234", "policy_attribute_1234": "policy_value_1234"}, "read", "policy_resource_1234")
+	assert.NoError(t, err)
+	assert.Equal(t, Deny, d)
+	after := vm.AtomStats()
+	assert.Equal(t, before.Atoms, after.Atoms)
+	assert.Equal(t, before.Temporary, after.Temporary)
+}
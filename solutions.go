@@ -13,18 +13,25 @@ import (
 // ErrClosed indicates the Solutions are already closed and unable to perform the operation.
 var ErrClosed = errors.New("closed")
 
+// ErrStarted indicates the search for the Solutions has already started and unable to perform the operation.
+var ErrStarted = errors.New("started")
+
 var errConversion = errors.New("conversion failed")
 
 // Solutions is the result of a query. Everytime the Next method is called, it searches for the next solution.
 // By calling the Scan method, you can retrieve the content of the solution.
 type Solutions struct {
-	vm     *engine.VM
-	env    *engine.Env
-	vars   []engine.ParsedVariable
-	more   chan<- bool
-	next   <-chan *engine.Env
-	err    error
-	closed bool
+	vm      *engine.VM
+	env     *engine.Env
+	vars    []engine.ParsedVariable
+	goal    engine.Term
+	more    chan<- bool
+	next    <-chan *engine.Env
+	err     error
+	closed  bool
+	started bool
+	current bool         // Next has found a solution.
+	strict  *Interpreter // The interpreter which detects misuse if it's Strict.
 }
 
 // Close closes the Solutions and terminates the search for other solutions.
@@ -34,23 +41,158 @@ func (s *Solutions) Close() error {
 	}
 	close(s.more)
 	s.closed = true
+	if s.strict != nil {
+		s.strict.closed(s)
+	}
+	// Wait for the search to stop so that the cleanups of setup_call_cleanup/3 are done.
+	if s.next != nil {
+		for range s.next {
+		}
+	}
 	return nil
 }
 
 // Next prepares the next solution for reading with the Scan method. It returns true if it finds another solution,
 // or false if there's no further solutions or if there's an error.
 func (s *Solutions) Next() bool {
+	s.current = false
 	if s.closed {
+		if s.strict != nil && s.err == nil {
+			s.err = ErrClosed
+		}
 		return false
 	}
+	if i := s.strict; i != nil {
+		if err := i.acquire(); err != nil {
+			s.err = err
+			return false
+		}
+		defer i.release()
+	}
+	s.started = true
 	s.more <- true
 	var ok bool
 	s.env, ok = <-s.next
+	s.current = ok
+	if !ok && s.strict != nil {
+		s.strict.closed(s) // The search is over so nothing leaks.
+	}
 	return ok
 }
 
+// OrderBy makes the Solutions yield the solutions sorted by key in the standard order of terms.
+// key is a Prolog term without the trailing period and may refer to the named variables in the query, e.g. "A-N".
+// Solutions with the same key keep their original order. Call it before Next.
+func (s *Solutions) OrderBy(key string, args ...interface{}) error {
+	k, err := s.key(key, args...)
+	if err != nil {
+		return err
+	}
+	pair, ps, ss := atomMinus.Apply(k, s.template()), engine.NewVariable(), engine.NewVariable()
+	s.goal = conjunction(
+		atomFindAll.Apply(pair, s.goal, ps),
+		atomSort.Apply(engine.Integer(1), atomAtLessOrEqual, ps, ss),
+		atomMember.Apply(pair, ss),
+	)
+	return nil
+}
+
+// TopK makes the Solutions yield at most n solutions with the greatest keys from the greatest.
+// key is the same as OrderBy. Unlike OrderBy, it holds only n solutions at a time. Call it before Next.
+func (s *Solutions) TopK(n int, key string, args ...interface{}) error {
+	k, err := s.key(key, args...)
+	if err != nil {
+		return err
+	}
+	pair, ps := atomMinus.Apply(k, s.template()), engine.NewVariable()
+	s.goal = conjunction(
+		atomAggregateAll.Apply(atomTopK.Apply(engine.Integer(n), pair), s.goal, ps),
+		atomMember.Apply(pair, ps),
+	)
+	return nil
+}
+
+// key parses key and shares the named variables with the query.
+func (s *Solutions) key(key string, args ...interface{}) (engine.Term, error) {
+	switch {
+	case s.closed:
+		return nil, ErrClosed
+	case s.started:
+		return nil, ErrStarted
+	}
+	p := engine.NewParser(s.vm, strings.NewReader(key+"."))
+	if err := p.SetPlaceholder(engine.NewAtom("?"), args...); err != nil {
+		return nil, err
+	}
+	t, err := p.Term()
+	if err != nil {
+		return nil, err
+	}
+	for _, kv := range p.Vars {
+		for _, qv := range s.vars {
+			if kv.Name == qv.Name {
+				s.env, _ = s.env.Unify(kv.Variable, qv.Variable)
+			}
+		}
+	}
+	return t, nil
+}
+
+// template returns a term which carries the named variables in the query.
+func (s *Solutions) template() engine.Term {
+	vs := make([]engine.Term, len(s.vars))
+	for i, v := range s.vars {
+		vs[i] = v.Variable
+	}
+	return engine.List(vs...)
+}
+
+func conjunction(goals ...engine.Term) engine.Term {
+	g := goals[len(goals)-1]
+	for i := len(goals) - 2; i >= 0; i-- {
+		g = atomComma.Apply(goals[i], g)
+	}
+	return g
+}
+
+// Vars returns the named variables in the query in the order of appearance.
+func (s *Solutions) Vars() []engine.ParsedVariable {
+	return s.vars
+}
+
+// Env returns the bindings of the current solution. Resolve the variables from Vars with it.
+func (s *Solutions) Env() *engine.Env {
+	return s.env
+}
+
+// Derivation returns the clauses which contributed to the current solution.
+// It returns nil unless the interpreter has TrackDerivation on or AuditLog set.
+func (s *Solutions) Derivation() []engine.Provenance {
+	return engine.Derivation(s.env)
+}
+
+// ProofTree returns the proof trees of the goals in the query for the current solution.
+// It returns nil unless the interpreter has TrackDerivation on or AuditLog set.
+func (s *Solutions) ProofTree() []*engine.Proof {
+	return engine.ProofTree(s.env)
+}
+
 // Scan copies the variable values of the current solution into the specified struct/map.
 func (s *Solutions) Scan(dest interface{}) error {
+	if s.strict != nil {
+		switch {
+		case s.closed:
+			return ErrClosed
+		case !s.current && s.err != nil:
+			return fmt.Errorf("%w: the query failed: %v", ErrNoCurrentSolution, s.err)
+		case !s.current:
+			return ErrNoCurrentSolution
+		}
+	}
+	return s.scan(dest)
+}
+
+func (s *Solutions) scan(dest interface{}) error {
 	o := reflect.ValueOf(dest)
 	for o.Kind() == reflect.Ptr {
 		o = o.Elem()
@@ -100,7 +242,17 @@ func (s *Solutions) Scan(dest interface{}) error {
 	}
 }
 
-var atomEmptyList = engine.NewAtom("[]")
+var (
+	atomAggregateAll  = engine.NewAtom("aggregate_all")
+	atomAtLessOrEqual = engine.NewAtom("@=<")
+	atomComma         = engine.NewAtom(",")
+	atomEmptyList     = engine.NewAtom("[]")
+	atomFindAll       = engine.NewAtom("findall")
+	atomMember        = engine.NewAtom("member")
+	atomMinus         = engine.NewAtom("-")
+	atomSort          = engine.NewAtom("sort")
+	atomTopK          = engine.NewAtom("topk")
+)
 
 func convertAssign(dest interface{}, vm *engine.VM, t engine.Term, env *engine.Env) error {
 	switch d := dest.(type) {
@@ -141,6 +293,9 @@ func convertAssignAny(d *interface{}, vm *engine.VM, t engine.Term, env *engine.
 			*d = t.String()
 		}
 		return nil
+	case engine.String:
+		*d = string(t)
+		return nil
 	case engine.Integer:
 		*d = int(t)
 		return nil
@@ -289,7 +444,7 @@ func (s *Solution) Scan(dest interface{}) error {
 	if err := s.err; err != nil {
 		return err
 	}
-	return s.sols.Scan(dest)
+	return s.sols.scan(dest)
 }
 
 // Err returns an error that occurred while querying for the Solution, if any.
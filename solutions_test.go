@@ -290,3 +290,105 @@ func ExampleSolutions_Scan_list() {
 	// Floats = [1.1 2.1]
 	// Mixed = [foo 1 1.1]
 }
+
+func TestSolutions_OrderBy(t *testing.T) {
+	p := New(nil, nil)
+	assert.NoError(t, p.Exec(`
+age(peter, 7).
+age(ann, 11).
+age(pat, 8).
+age(tom, 5).
+age(mike, 11).
+`))
+
+	names := func(sols *Solutions) []string {
+		var ns []string
+		for sols.Next() {
+			var s struct{ N string }
+			assert.NoError(t, sols.Scan(&s))
+			ns = append(ns, s.N)
+		}
+		assert.NoError(t, sols.Err())
+		assert.NoError(t, sols.Close())
+		return ns
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		sols, err := p.Query(`age(N, A).`)
+		assert.NoError(t, err)
+		assert.NoError(t, sols.OrderBy(`A`))
+		assert.Equal(t, []string{"tom", "peter", "pat", "ann", "mike"}, names(sols))
+	})
+
+	t.Run("placeholder", func(t *testing.T) {
+		sols, err := p.Query(`age(N, A).`)
+		assert.NoError(t, err)
+		assert.NoError(t, sols.OrderBy(`f(A, N, ?)`, "x"))
+		assert.Equal(t, []string{"tom", "peter", "pat", "ann", "mike"}, names(sols))
+	})
+
+	t.Run("combined", func(t *testing.T) {
+		sols, err := p.Query(`age(N, A).`)
+		assert.NoError(t, err)
+		assert.NoError(t, sols.TopK(3, `A-N`))
+		assert.NoError(t, sols.OrderBy(`N`))
+		assert.Equal(t, []string{"ann", "mike", "pat"}, names(sols))
+	})
+
+	t.Run("syntax error", func(t *testing.T) {
+		sols, err := p.Query(`age(N, A).`)
+		assert.NoError(t, err)
+		assert.Error(t, sols.OrderBy(`A B`))
+		assert.NoError(t, sols.Close())
+	})
+
+	t.Run("started", func(t *testing.T) {
+		sols, err := p.Query(`age(N, A).`)
+		assert.NoError(t, err)
+		assert.True(t, sols.Next())
+		assert.Equal(t, ErrStarted, sols.OrderBy(`A`))
+		assert.NoError(t, sols.Close())
+		assert.Equal(t, ErrClosed, sols.OrderBy(`A`))
+	})
+}
+
+func TestSolutions_TopK(t *testing.T) {
+	p := New(nil, nil)
+	assert.NoError(t, p.Exec(`
+age(peter, 7).
+age(ann, 11).
+age(pat, 8).
+age(tom, 5).
+age(mike, 11).
+`))
+
+	sols, err := p.Query(`age(N, A).`)
+	assert.NoError(t, err)
+	assert.NoError(t, sols.TopK(2, `A-N`))
+	var ss []struct {
+		N string
+		A int
+	}
+	for sols.Next() {
+		var s struct {
+			N string
+			A int
+		}
+		assert.NoError(t, sols.Scan(&s))
+		ss = append(ss, s)
+	}
+	assert.NoError(t, sols.Err())
+	assert.NoError(t, sols.Close())
+	assert.Equal(t, []struct {
+		N string
+		A int
+	}{{N: "mike", A: 11}, {N: "ann", A: 11}}, ss)
+
+	t.Run("zero", func(t *testing.T) {
+		sols, err := p.Query(`age(N, A).`)
+		assert.NoError(t, err)
+		assert.NoError(t, sols.TopK(0, `A`))
+		assert.False(t, sols.Next())
+		assert.NoError(t, sols.Close())
+	})
+}
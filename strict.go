@@ -0,0 +1,91 @@
+package prolog
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// While Interpreter.Strict is on, the interpreter detects the common misuse of the API and reports it with errors
+// instead of data races or silent leaks:
+//
+//   - Solutions used after Close: Next returns false and Err returns ErrClosed.
+//   - Scan without a current solution e.g. before Next, or after Next returned false because of an error: Scan returns
+//     ErrNoCurrentSolution.
+//   - Concurrent use of the interpreter from multiple goroutines: the operation which overlaps with another fails with
+//     ErrConcurrentUse. Fork the interpreter for each goroutine instead.
+//   - Solutions abandoned without Close while the search is still suspended: CheckLeaks reports them.
+//
+// It's for development and tests since it costs bookkeeping for every query.
+
+// ErrConcurrentUse indicates the interpreter is being used by another goroutine.
+var ErrConcurrentUse = errors.New("concurrent use of interpreter")
+
+// ErrNoCurrentSolution indicates Scan is called without a solution found by Next.
+var ErrNoCurrentSolution = errors.New("no current solution")
+
+// ErrUnclosedSolutions indicates some Solutions are neither closed nor exhausted.
+var ErrUnclosedSolutions = errors.New("solutions not closed")
+
+// CheckLeaks returns an error telling where the Solutions which are neither closed nor exhausted were opened.
+// It only knows about the Solutions opened while Strict is on.
+func (i *Interpreter) CheckLeaks() error {
+	i.strictMu.Lock()
+	defer i.strictMu.Unlock()
+	if len(i.open) == 0 {
+		return nil
+	}
+	callers := make([]string, 0, len(i.open))
+	for _, c := range i.open {
+		callers = append(callers, c)
+	}
+	sort.Strings(callers)
+	return fmt.Errorf("%w: %d opened at %s", ErrUnclosedSolutions, len(callers), strings.Join(callers, ", "))
+}
+
+// acquire marks the interpreter busy. It fails if the interpreter is already busy.
+func (i *Interpreter) acquire() error {
+	if atomic.AddInt32(&i.busy, 1) > 1 {
+		atomic.AddInt32(&i.busy, -1)
+		return ErrConcurrentUse
+	}
+	return nil
+}
+
+func (i *Interpreter) release() {
+	atomic.AddInt32(&i.busy, -1)
+}
+
+// opened records s with the caller of the API which opened s.
+func (i *Interpreter) opened(s *Solutions) {
+	i.strictMu.Lock()
+	defer i.strictMu.Unlock()
+	if i.open == nil {
+		i.open = map[*Solutions]string{}
+	}
+	i.open[s] = caller()
+}
+
+func (i *Interpreter) closed(s *Solutions) {
+	i.strictMu.Lock()
+	defer i.strictMu.Unlock()
+	delete(i.open, s)
+}
+
+// caller returns the location of the first caller outside the methods of Interpreter.
+func caller() string {
+	pc := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pc[:runtime.Callers(3, pc)])
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, "github.com/ichiban/prolog.(*Interpreter).") {
+			return fmt.Sprintf("%s:%d", f.File, f.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
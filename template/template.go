@@ -0,0 +1,319 @@
+// Package template renders texts e.g. reports and emails with the results of Prolog goals evaluated against the
+// database of an interpreter, much like text/template does with Go values.
+//
+// A template is a text with actions delimited by {{ and }}. The text outside the actions is copied to the output as it
+// is. An action is one of:
+//
+//	{{Term}}                            Writes Term as write/1 does with the current bindings of its variables.
+//	{{range Goal}} T1 {{end}}           Renders T1 for each solution of Goal.
+//	{{range Goal}} T1 {{else}} T0 {{end}}
+//	                                    Renders T0 instead if Goal has no solutions.
+//	{{if Goal}} T1 {{end}}              Renders T1 with the first solution of Goal if any.
+//	{{if Goal}} T1 {{else}} T0 {{end}}  Renders T0 instead if Goal has no solutions.
+//	{{findall Template, Goal, List}} T1 {{end}}
+//	                                    Renders T1 with List bound to the list of the instances of Template for each
+//	                                    solution of Goal, just like findall/3.
+//
+// The variables of the same name are the same variable throughout the template and the bindings by the goal of a block
+// are visible inside the block. An action ends at the first }}. Just like text/template, "{{- " trims the white spaces
+// before the action and " -}}" trims the ones after the action:
+//
+//	t, err := template.Parse(p, `Orders of {{User}}:
+//	{{range order(User, Item, Qty)}}- {{Item}} x {{Qty}}
+//	{{else}}none
+//	{{end -}}
+//	{{findall Q, order(User, _, Q), Qs}}Total: {{Qs}}{{end}}`)
+//	err = t.Execute(ctx, w, map[string]engine.Term{"User": engine.NewAtom("alice")})
+package template
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/ichiban/prolog"
+	"github.com/ichiban/prolog/engine"
+)
+
+// ErrSyntax indicates the structure of the actions in a template is malformed.
+var ErrSyntax = errors.New("syntax error")
+
+// Template is a parsed template. It's safe for concurrent use as long as the interpreter is.
+type Template struct {
+	// Escape converts the text of each {{Term}} before it's written if it's set, e.g. html.EscapeString.
+	// The text outside the actions isn't converted.
+	Escape func(string) string
+
+	p     *prolog.Interpreter
+	nodes []node
+	vars  []engine.ParsedVariable
+}
+
+// Parse parses text into a template which evaluates the goals against p.
+// The terms in the actions are read with the operators of p at the time.
+func Parse(p *prolog.Interpreter, text string) (*Template, error) {
+	items, err := lex(text)
+	if err != nil {
+		return nil, err
+	}
+	ps := parser{vm: &p.VM, items: items}
+	ns, stop, err := ps.nodes()
+	if err != nil {
+		return nil, err
+	}
+	if stop != nil {
+		return nil, fmt.Errorf("%w: line %d: unexpected {{%s}}", ErrSyntax, stop.line, stop.text)
+	}
+	return &Template{p: p, nodes: ns, vars: ps.vars}, nil
+}
+
+// Must panics if err is not nil. It's for the templates defined at initialization e.g. in package level variables.
+func Must(t *Template, err error) *Template {
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Execute renders the template to w. vars binds the variables in the template by name beforehand.
+func (t *Template) Execute(ctx context.Context, w io.Writer, vars map[string]engine.Term) error {
+	var env *engine.Env
+	first := map[engine.Atom]engine.Variable{}
+	for _, v := range t.vars {
+		if f, ok := first[v.Name]; ok {
+			env, _ = env.Unify(v.Variable, f)
+			continue
+		}
+		first[v.Name] = v.Variable
+	}
+	for name, value := range vars {
+		if v, ok := first[engine.NewAtom(name)]; ok {
+			env, _ = env.Unify(v, value)
+		}
+	}
+	e := executor{ctx: ctx, vm: &t.p.VM, w: w, escape: t.Escape}
+	return e.run(t.nodes, env)
+}
+
+type node interface {
+	execute(e *executor, env *engine.Env) error
+}
+
+// textNode is the text outside the actions.
+type textNode string
+
+func (n textNode) execute(e *executor, _ *engine.Env) error {
+	_, err := io.WriteString(e.w, string(n))
+	return err
+}
+
+// termNode is {{Term}}.
+type termNode struct {
+	term engine.Term
+	line int
+}
+
+var writeOptions = engine.List(engine.NewAtom("numbervars").Apply(engine.NewAtom("true")))
+
+func (n *termNode) execute(e *executor, env *engine.Env) error {
+	var sb strings.Builder
+	if _, err := engine.WriteTerm(e.vm, engine.NewOutputTextStream(&sb), n.term, writeOptions, engine.Success, env).Force(e.ctx); err != nil {
+		return fmt.Errorf("line %d: %w", n.line, err)
+	}
+	s := sb.String()
+	if e.escape != nil {
+		s = e.escape(s)
+	}
+	_, err := io.WriteString(e.w, s)
+	return err
+}
+
+// blockNode is {{range Goal}}, {{if Goal}}, or {{findall Template, Goal, List}} with the nodes up to {{end}}.
+type blockNode struct {
+	all  bool // Renders body for every solution of goal.
+	goal engine.Term
+	body []node
+	els  []node // The nodes after {{else}}.
+	line int
+}
+
+func (n *blockNode) execute(e *executor, env *engine.Env) error {
+	var found bool
+	_, err := engine.Call(e.vm, n.goal, func(env *engine.Env) *engine.Promise {
+		found = true
+		if err := e.run(n.body, env); err != nil {
+			return engine.Error(err)
+		}
+		return engine.Bool(!n.all)
+	}, env).Force(e.ctx)
+	if err != nil {
+		if _, ok := err.(engine.Exception); ok {
+			return fmt.Errorf("line %d: %w", n.line, err)
+		}
+		return err // The error of the body which tells the line already.
+	}
+	if !found {
+		return e.run(n.els, env)
+	}
+	return nil
+}
+
+type executor struct {
+	ctx    context.Context
+	vm     *engine.VM
+	w      io.Writer
+	escape func(string) string
+}
+
+func (e *executor) run(ns []node, env *engine.Env) error {
+	for _, n := range ns {
+		if err := n.execute(e, env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// item is either a text or the content of an action.
+type item struct {
+	action bool
+	text   string
+	line   int
+}
+
+// lex splits text into texts and actions, trimming the white spaces around the actions with the trim markers.
+func lex(text string) ([]item, error) {
+	var (
+		items []item
+		line  = 1
+	)
+	for len(text) > 0 {
+		i := strings.Index(text, "{{")
+		if i < 0 {
+			items = append(items, item{text: text, line: line})
+			break
+		}
+		lit, rest := text[:i], text[i+2:]
+		j := strings.Index(rest, "}}")
+		if j < 0 {
+			return nil, fmt.Errorf("%w: line %d: unclosed action", ErrSyntax, line+strings.Count(lit, "\n"))
+		}
+		action, after := rest[:j], rest[j+2:]
+
+		if strings.HasPrefix(action, "- ") {
+			lit = strings.TrimRightFunc(lit, unicode.IsSpace)
+		}
+		if lit != "" {
+			items = append(items, item{text: lit, line: line})
+		}
+		line += strings.Count(text[:i], "\n")
+		items = append(items, item{action: true, text: trimMarkers(action), line: line})
+		line += strings.Count(action, "\n")
+		if strings.HasSuffix(action, " -") {
+			trimmed := strings.TrimLeftFunc(after, unicode.IsSpace)
+			line += strings.Count(after[:len(after)-len(trimmed)], "\n")
+			after = trimmed
+		}
+		text = after
+	}
+	return items, nil
+}
+
+// trimMarkers returns the content of an action without the trim markers and the white spaces around it.
+func trimMarkers(action string) string {
+	action = strings.TrimPrefix(action, "- ")
+	action = strings.TrimSuffix(action, " -")
+	return strings.TrimSpace(action)
+}
+
+type parser struct {
+	vm    *engine.VM
+	items []item
+	pos   int
+	vars  []engine.ParsedVariable
+}
+
+// nodes parses the items until {{else}}, {{end}}, or the end of the template and returns the item it stopped at.
+func (p *parser) nodes() ([]node, *item, error) {
+	var ns []node
+	for p.pos < len(p.items) {
+		it := &p.items[p.pos]
+		p.pos++
+		if !it.action {
+			ns = append(ns, textNode(it.text))
+			continue
+		}
+
+		keyword, rest := it.text, ""
+		if i := strings.IndexFunc(it.text, unicode.IsSpace); i >= 0 {
+			keyword, rest = it.text[:i], it.text[i+1:]
+		}
+		switch keyword {
+		case "else", "end":
+			if rest != "" {
+				return nil, nil, fmt.Errorf("%w: line %d: unexpected %s after {{%s}}", ErrSyntax, it.line, rest, keyword)
+			}
+			return ns, it, nil
+		case "range", "if", "findall":
+			n, err := p.block(it, keyword, rest)
+			if err != nil {
+				return nil, nil, err
+			}
+			ns = append(ns, n)
+		default:
+			t, err := p.term(it.text, it.line)
+			if err != nil {
+				return nil, nil, err
+			}
+			ns = append(ns, &termNode{term: t, line: it.line})
+		}
+	}
+	return ns, nil, nil
+}
+
+func (p *parser) block(it *item, keyword, goal string) (*blockNode, error) {
+	if keyword == "findall" {
+		goal = "findall(" + goal + ")"
+	}
+	g, err := p.term(goal, it.line)
+	if err != nil {
+		return nil, err
+	}
+	n := blockNode{all: keyword == "range", goal: g, line: it.line}
+
+	var stop *item
+	n.body, stop, err = p.nodes()
+	if err != nil {
+		return nil, err
+	}
+	if stop != nil && stop.text == "else" && keyword != "findall" {
+		n.els, stop, err = p.nodes()
+		if err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case stop == nil:
+		return nil, fmt.Errorf("%w: line %d: unclosed {{%s}}", ErrSyntax, it.line, keyword)
+	case stop.text != "end":
+		return nil, fmt.Errorf("%w: line %d: unexpected {{%s}}", ErrSyntax, stop.line, stop.text)
+	}
+	return &n, nil
+}
+
+// term parses the text of an action as a Prolog term.
+func (p *parser) term(text string, line int) (engine.Term, error) {
+	ps := engine.NewParser(p.vm, strings.NewReader(text+" ."))
+	t, err := ps.Term()
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %w", line, err)
+	}
+	if ps.More() {
+		return nil, fmt.Errorf("%w: line %d: extra input after %s", ErrSyntax, line, text)
+	}
+	p.vars = append(p.vars, ps.Vars...)
+	return t, nil
+}
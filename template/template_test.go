@@ -0,0 +1,161 @@
+package template
+
+import (
+	"context"
+	"errors"
+	"html"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ichiban/prolog"
+	"github.com/ichiban/prolog/engine"
+)
+
+func newInterpreter(t *testing.T) *prolog.Interpreter {
+	t.Helper()
+	p := prolog.New(nil, nil)
+	assert.NoError(t, p.Exec(`
+user(alice).
+user(bob).
+user(carol).
+order(alice, apple, 3).
+order(alice, 'banana split', 1).
+order(bob, cherry, 12).
+note(alice, '<b>VIP</b>').
+`))
+	return p
+}
+
+func TestTemplate_Execute(t *testing.T) {
+	tests := []struct {
+		title  string
+		text   string
+		vars   map[string]engine.Term
+		escape func(string) string
+		output string
+		err    string
+	}{
+		{title: "text", text: "hello, world", output: "hello, world"},
+		{title: "term", text: "{{foo('b c', [1, 2], 'X'+1)}}", output: "foo(b c,[1,2],X+1)"},
+		{title: "vars", text: "Dear {{User}},", vars: map[string]engine.Term{"User": engine.NewAtom("alice")}, output: "Dear alice,"},
+		{title: "unused vars", text: "hi", vars: map[string]engine.Term{"User": engine.NewAtom("alice")}, output: "hi"},
+		{
+			title:  "range",
+			text:   "{{range user(U)}}[{{U}}]{{end}}",
+			output: "[alice][bob][carol]",
+		},
+		{
+			title:  "range else",
+			text:   "{{range order(dave, I, _)}}{{I}}{{else}}none{{end}}",
+			output: "none",
+		},
+		{
+			title:  "nested range",
+			text:   "{{range user(U)}}{{U}}:{{range order(U, I, Q)}} {{Q}}x{{I}}{{else}} -{{end}};{{end}}",
+			output: "alice: 3xapple 1xbanana split;bob: 12xcherry;carol: -;",
+		},
+		{
+			title:  "if",
+			text:   "{{if order(U, cherry, Q)}}{{U}} ordered {{Q}}{{end}}",
+			output: "bob ordered 12",
+		},
+		{
+			title:  "if else",
+			text:   "{{if order(carol, _, _)}}yes{{else}}no{{end}}",
+			output: "no",
+		},
+		{
+			title:  "bindings are scoped",
+			text:   "{{if user(U)}}{{U}}{{end}} {{if var(U)}}unbound{{end}}",
+			output: "alice unbound",
+		},
+		{
+			title:  "findall",
+			text:   "{{findall I-Q, order(alice, I, Q), L}}{{L}}{{end}}",
+			output: "[apple-3,banana split-1]",
+		},
+		{
+			title:  "trim markers",
+			text:   "Orders: \n{{- range order(alice, I, _)}}\n- {{I}}\n{{- end}}\n{{if true -}}\n   Total: 2\n{{- end}}",
+			output: "Orders:\n- apple\n- banana split\nTotal: 2",
+		},
+		{
+			title:  "escape",
+			text:   "<p>{{if note(alice, N)}}{{N}}{{end}}</p>",
+			escape: html.EscapeString,
+			output: "<p>&lt;b&gt;VIP&lt;/b&gt;</p>",
+		},
+		{
+			title: "runtime error",
+			text:  "ok\n{{range user(U)}}\n{{if foo(U)}}{{end}}{{end}}",
+			err:   "line 3: error(existence_error(procedure,foo/1),user/1)",
+		},
+		{
+			title: "instantiation error",
+			text:  "{{range G}}{{end}}",
+			err:   "line 1: error(instantiation_error,root)",
+		},
+	}
+
+	p := newInterpreter(t)
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			tmpl, err := Parse(p, tt.text)
+			assert.NoError(t, err)
+			tmpl.Escape = tt.escape
+
+			var sb strings.Builder
+			err = tmpl.Execute(context.Background(), &sb, tt.vars)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.output, sb.String())
+		})
+	}
+
+	t.Run("cancelled", func(t *testing.T) {
+		tmpl := Must(Parse(p, "{{range user(U)}}{{U}}{{end}}"))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var sb strings.Builder
+		assert.Equal(t, context.Canceled, tmpl.Execute(ctx, &sb, nil))
+	})
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		title  string
+		text   string
+		syntax bool
+		err    string
+	}{
+		{title: "unclosed action", text: "a\n{{foo", syntax: true, err: "syntax error: line 2: unclosed action"},
+		{title: "unclosed block", text: "{{range user(U)}}\n{{U}}", syntax: true, err: "syntax error: line 1: unclosed {{range}}"},
+		{title: "unexpected end", text: "a\n\n{{end}}", syntax: true, err: "syntax error: line 3: unexpected {{end}}"},
+		{title: "unexpected else", text: "{{else}}", syntax: true, err: "syntax error: line 1: unexpected {{else}}"},
+		{title: "else in findall", text: "{{findall X, user(X), L}}{{else}}{{end}}", syntax: true, err: "syntax error: line 1: unexpected {{else}}"},
+		{title: "double else", text: "{{if true}}{{else}}{{else}}{{end}}", syntax: true, err: "syntax error: line 1: unexpected {{else}}"},
+		{title: "end with argument", text: "{{if true}}{{end if}}", syntax: true, err: "syntax error: line 1: unexpected if after {{end}}"},
+		{title: "extra input", text: "{{a. b}}", syntax: true, err: "syntax error: line 1: extra input after a. b"},
+		{title: "invalid term", text: "x\n{{-}}\n{{foo(}}", err: "line 3: unexpected token: end(.)"},
+	}
+
+	p := newInterpreter(t)
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			_, err := Parse(p, tt.text)
+			assert.Equal(t, tt.syntax, errors.Is(err, ErrSyntax))
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+
+	t.Run("must", func(t *testing.T) {
+		assert.Panics(t, func() {
+			Must(Parse(p, "{{end}}"))
+		})
+	})
+}
@@ -0,0 +1,152 @@
+// Package tenant hosts many tenants on top of one Prolog program.
+//
+// A Manager compiles the base program once. Each tenant gets an overlay of the base which it can extend by
+// asserting or consulting clauses without affecting the base nor the other tenants.
+// The clauses, memory, and inferences each tenant consumes are tracked and limited by its quota.
+package tenant
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/ichiban/prolog"
+	"github.com/ichiban/prolog/engine"
+)
+
+// Manager keeps the base program and the tenant overlays. It's safe for concurrent use.
+type Manager struct {
+	// Quota is the quota for the tenants created afterwards. Quota.Inferences limits each call of Tenant.Do.
+	Quota engine.Quota
+
+	base *prolog.Interpreter
+
+	mu      sync.Mutex
+	tenants map[string]*Tenant
+}
+
+// New compiles the base program.
+func New(program string) (*Manager, error) {
+	i := prolog.New(nil, nil)
+	if err := i.Exec(program); err != nil {
+		return nil, err
+	}
+	return &Manager{base: i}, nil
+}
+
+// Tenant returns the tenant of id. If there's no such tenant, it creates a new one with the base program.
+func (m *Manager) Tenant(id string) *Tenant {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if t, ok := m.tenants[id]; ok {
+		return t
+	}
+
+	i := m.base.Fork()
+	i.Quota = m.Quota
+	// The tenant shouldn't write to nor read from the base's streams.
+	i.SetUserInput(engine.NewInputTextStream(nil))
+	i.SetUserOutput(engine.NewOutputTextStream(nil))
+
+	t := Tenant{id: id, i: i}
+	if m.tenants == nil {
+		m.tenants = map[string]*Tenant{}
+	}
+	m.tenants[id] = &t
+	return &t
+}
+
+// Remove discards the tenant of id. The ongoing calls of Tenant.Do still complete.
+func (m *Manager) Remove(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.tenants, id)
+}
+
+// Tenants returns the IDs of the tenants in order.
+func (m *Manager) Tenants() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := make([]string, 0, len(m.tenants))
+	for id := range m.tenants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Usage returns the usage of each tenant.
+func (m *Manager) Usage() map[string]engine.Usage {
+	m.mu.Lock()
+	ts := make([]*Tenant, 0, len(m.tenants))
+	for _, t := range m.tenants {
+		ts = append(ts, t)
+	}
+	m.mu.Unlock()
+
+	u := make(map[string]engine.Usage, len(ts))
+	for _, t := range ts {
+		u[t.id] = t.Usage()
+	}
+	return u
+}
+
+// Tenant is an overlay of the base program. Its methods are safe for concurrent use but run one at a time.
+type Tenant struct {
+	id string
+
+	mu         sync.Mutex
+	i          *prolog.Interpreter
+	inferences int64
+}
+
+// ID returns the ID of the tenant.
+func (t *Tenant) ID() string {
+	return t.id
+}
+
+// Do calls f with the interpreter of the tenant exclusively.
+// f shouldn't retain the interpreter nor the solutions of its queries after it returns.
+func (t *Tenant) Do(f func(i *prolog.Interpreter) error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.i.ResetInferences()
+	defer func() {
+		t.inferences += t.i.Usage().Inferences
+	}()
+	return f(t.i)
+}
+
+// Exec executes a Prolog text in the tenant e.g. to add clauses.
+func (t *Tenant) Exec(ctx context.Context, text string, args ...interface{}) error {
+	return t.Do(func(i *prolog.Interpreter) error {
+		return i.ExecContext(ctx, text, args...)
+	})
+}
+
+// QuerySolution executes a Prolog query in the tenant for the first solution.
+func (t *Tenant) QuerySolution(ctx context.Context, query string, args ...interface{}) *prolog.Solution {
+	var sol *prolog.Solution
+	_ = t.Do(func(i *prolog.Interpreter) error {
+		sol = i.QuerySolutionContext(ctx, query, args...)
+		return nil
+	})
+	return sol
+}
+
+// SetQuota replaces the quota of the tenant.
+func (t *Tenant) SetQuota(q engine.Quota) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.i.Quota = q
+}
+
+// Usage returns the resources the tenant has consumed. Clauses and Memory are net of the base program.
+// Inferences is the total of all the calls of Do.
+func (t *Tenant) Usage() engine.Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u := t.i.Usage()
+	u.Inferences = t.inferences
+	return u
+}
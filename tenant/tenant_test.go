@@ -0,0 +1,138 @@
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ichiban/prolog"
+	"github.com/ichiban/prolog/engine"
+)
+
+const program = `
+:- dynamic(setting/2).
+setting(theme, light).
+
+greeting(Name, S) :- setting(greeting, G), atom_concat(G, Name, S).
+greeting(Name, S) :- \+ setting(greeting, _), atom_concat('hello, ', Name, S).
+`
+
+func TestManager_Tenant(t *testing.T) {
+	m, err := New(program)
+	assert.NoError(t, err)
+
+	a, b := m.Tenant("a"), m.Tenant("b")
+	assert.Same(t, a, m.Tenant("a"))
+	assert.Equal(t, "a", a.ID())
+	assert.Equal(t, []string{"a", "b"}, m.Tenants())
+
+	ctx := context.Background()
+	assert.NoError(t, a.Exec(ctx, `:- retract(setting(theme, _)), assertz(setting(theme, dark)), assertz(setting(greeting, 'hi, ')).`))
+	assert.NoError(t, a.Exec(ctx, `vip(alice).`))
+
+	var s struct{ S string }
+	assert.NoError(t, a.QuerySolution(ctx, `greeting(alice, S).`).Scan(&s))
+	assert.Equal(t, "hi, alice", s.S)
+	assert.NoError(t, b.QuerySolution(ctx, `greeting(alice, S).`).Scan(&s))
+	assert.Equal(t, "hello, alice", s.S)
+
+	assert.NoError(t, a.QuerySolution(ctx, `setting(theme, dark).`).Err())
+	assert.NoError(t, b.QuerySolution(ctx, `setting(theme, light).`).Err())
+	assert.NoError(t, m.Tenant("c").QuerySolution(ctx, `setting(theme, light).`).Err())
+	assert.Error(t, b.QuerySolution(ctx, `vip(alice).`).Err())
+
+	m.Remove("c")
+	assert.Equal(t, []string{"a", "b"}, m.Tenants())
+}
+
+func TestManager_Usage(t *testing.T) {
+	m, err := New(program)
+	assert.NoError(t, err)
+	m.Quota = engine.Quota{Clauses: 3, Inferences: 1000}
+
+	ctx := context.Background()
+	a := m.Tenant("a")
+	assert.NoError(t, a.Exec(ctx, `:- assertz(setting(a, 1)), assertz(setting(b, 2)).`))
+	assert.NoError(t, a.QuerySolution(ctx, `retract(setting(theme, _)).`).Err())
+
+	u := m.Usage()["a"]
+	assert.Equal(t, 1, u.Clauses)
+	assert.True(t, u.Memory > 0)
+	assert.True(t, u.Inferences > 0)
+	assert.Equal(t, engine.Usage{}, m.Tenant("b").Usage())
+
+	t.Run("inferences", func(t *testing.T) {
+		assert.NoError(t, a.Exec(ctx, `loop :- loop.`))
+		err := a.QuerySolution(ctx, `loop.`).Err()
+		assert.Equal(t, "error(resource_error(inferences),loop/0)", err.Error())
+
+		// The quota is for each call.
+		assert.NoError(t, a.QuerySolution(ctx, `setting(a, X).`).Err())
+		assert.True(t, a.Usage().Inferences > 1000)
+	})
+
+	t.Run("clauses", func(t *testing.T) {
+		err := a.Exec(ctx, `:- assertz(setting(c, 3)), assertz(setting(d, 4)), assertz(setting(e, 5)).`)
+		assert.Error(t, err)
+		assert.Equal(t, 3, a.Usage().Clauses)
+	})
+
+	t.Run("set quota", func(t *testing.T) {
+		b := m.Tenant("b")
+		b.SetQuota(engine.Quota{Clauses: 1})
+		assert.NoError(t, b.Exec(ctx, `foo(a).`))
+		assert.Error(t, b.Exec(ctx, `bar(a).`))
+	})
+}
+
+func TestTenant_Do(t *testing.T) {
+	m, err := New(program)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for n := 0; n < 8; n++ {
+		n := n
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tn := m.Tenant(fmt.Sprintf("t%d", n))
+			assert.NoError(t, tn.Do(func(i *prolog.Interpreter) error {
+				for j := 0; j < 100; j++ {
+					if err := i.QuerySolution(`assertz(setting(?, ?)), greeting(x, _).`, j, n).Err(); err != nil {
+						return err
+					}
+				}
+				return nil
+			}))
+		}()
+	}
+	wg.Wait()
+
+	for n := 0; n < 8; n++ {
+		assert.Equal(t, 100, m.Tenant(fmt.Sprintf("t%d", n)).Usage().Clauses)
+	}
+}
+
+func TestTenant_closeInheritedStream(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	m, err := New(fmt.Sprintf(`:- open('%s', write, _, [alias(log)]).`, path))
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	a, b := m.Tenant("a"), m.Tenant("b")
+	assert.NoError(t, a.QuerySolution(ctx, `close(log).`).Err())
+
+	// The stream is gone only for the tenant which closed it. It's still open for the others.
+	assert.Error(t, a.QuerySolution(ctx, `write(log, a).`).Err())
+	assert.NoError(t, b.QuerySolution(ctx, `write(log, b), flush_output(log).`).Err())
+	assert.NoError(t, m.base.QuerySolution(`write(log, base), close(log).`).Err())
+
+	log, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "bbase", string(log))
+}
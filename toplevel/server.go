@@ -0,0 +1,248 @@
+package toplevel
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/ichiban/prolog"
+	"github.com/ichiban/prolog/engine"
+)
+
+// ErrNoToken indicates Server has no token to authenticate clients with.
+var ErrNoToken = errors.New("no token")
+
+// Server lets developers attach a top level to a live interpreter e.g. embedded in a running Go service to inspect
+// its dynamic state and run diagnostic queries. It's opt-in and serves nothing until Serve is called:
+//
+//	l, err := net.Listen("unix", "/tmp/prolog.sock")
+//	if err != nil {
+//		panic(err)
+//	}
+//	s := toplevel.Server{Interpreter: p, Token: os.Getenv("PROLOG_DEBUG_TOKEN")}
+//	go s.Serve(ctx, l)
+//
+// Then, attach with a line-oriented client e.g. `socat - UNIX-CONNECT:/tmp/prolog.sock` and enter the token first.
+//
+// Each connection queries its own fork of Interpreter taken when the connection is established. So, the queries never
+// run on the live interpreter and changes to the database, the flags, and the operators made by them don't reach it.
+// The service may keep modifying the database of Interpreter by queries meanwhile. See engine.VM.Fork.
+// The queries can't have effects outside the connection either: user_input is empty, user_output and the messages
+// go to the connection, opening files, consulting files, and writing to or repositioning the streams of the service
+// raise permission errors, and halt/0 and halt/1 close the connection instead of exiting the process.
+type Server struct {
+	// Interpreter is the live interpreter to attach to.
+	Interpreter *prolog.Interpreter
+
+	// Token authenticates clients. A client has to send it as the first line. It must not be empty.
+	Token string
+}
+
+// Serve accepts connections on l and runs a top level for each of them until ctx is done.
+// It closes l and waits for the connections to finish before it returns.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	if s.Token == "" {
+		return ErrNoToken
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		_ = l.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serve(ctx, conn)
+		}()
+	}
+}
+
+func (s *Server) serve(ctx context.Context, conn net.Conn) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+
+	t := connTerminal{r: bufio.NewReader(conn), w: conn}
+	token, err := t.ReadLine()
+	if err != nil {
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+		_, _ = fmt.Fprintf(conn, "authentication failed\n")
+		return
+	}
+
+	i := s.Interpreter.Fork()
+	confine(i, conn)
+	if _, err := fmt.Fprintf(conn, "Attached to the interpreter.\n"); err != nil {
+		return
+	}
+
+	tl := New(i, &t)
+	tl.Keys = &t
+	_ = tl.Run(ctx)
+}
+
+// confine keeps the queries on the fork i from having effects outside conn.
+func confine(i *prolog.Interpreter, conn net.Conn) {
+	out := engine.NewOutputTextStream(conn)
+	i.SetUserInput(engine.NewInputTextStream(strings.NewReader("")))
+	i.SetUserOutput(out)
+	i.OnMessage = nil // print_message/2 writes to user_output.
+
+	// output checks if the stream is the connection before the output predicates write to it.
+	output := func(vm *engine.VM, streamOrAlias engine.Term, env *engine.Env) error {
+		switch s := env.Resolve(streamOrAlias).(type) {
+		case *engine.Stream:
+			if s == out {
+				return nil
+			}
+		case engine.Atom:
+			if s == atomUserOutput {
+				return nil
+			}
+		case engine.Variable:
+			return nil // Let the predicate raise an instantiation error.
+		}
+		return engine.PermissionError(atomOutput, atomStream, streamOrAlias, env)
+	}
+	i.Register1(atomSetOutput, func(vm *engine.VM, s engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+		if err := output(vm, s, env); err != nil {
+			return engine.Error(err)
+		}
+		return engine.SetOutput(vm, s, k, env)
+	})
+	i.Register1(atomFlushOutput, func(vm *engine.VM, s engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+		if err := output(vm, s, env); err != nil {
+			return engine.Error(err)
+		}
+		return engine.FlushOutput(vm, s, k, env)
+	})
+	i.Register2(atomPutChar, func(vm *engine.VM, s, c engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+		if err := output(vm, s, env); err != nil {
+			return engine.Error(err)
+		}
+		return engine.PutChar(vm, s, c, k, env)
+	})
+	i.Register2(atomPutByte, func(vm *engine.VM, s, b engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+		if err := output(vm, s, env); err != nil {
+			return engine.Error(err)
+		}
+		return engine.PutByte(vm, s, b, k, env)
+	})
+	i.Register3(atomWriteTerm, func(vm *engine.VM, s, t, options engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+		if err := output(vm, s, env); err != nil {
+			return engine.Error(err)
+		}
+		return engine.WriteTerm(vm, s, t, options, k, env)
+	})
+
+	i.Register4(atomOpen, func(_ *engine.VM, sourceSink, _, _, _ engine.Term, _ engine.Cont, env *engine.Env) *engine.Promise {
+		return engine.Error(engine.PermissionError(atomOpen, atomSourceSink, sourceSink, env))
+	})
+	i.Register1(atomConsult, func(_ *engine.VM, file engine.Term, _ engine.Cont, env *engine.Env) *engine.Promise {
+		return engine.Error(engine.PermissionError(atomOpen, atomSourceSink, file, env))
+	})
+	i.Register2(atomSetStreamPosition, func(_ *engine.VM, s, _ engine.Term, _ engine.Cont, env *engine.Env) *engine.Promise {
+		return engine.Error(engine.PermissionError(atomReposition, atomStream, s, env))
+	})
+	i.Register3(atomTeeStream, func(_ *engine.VM, s, _, _ engine.Term, _ engine.Cont, env *engine.Env) *engine.Promise {
+		return engine.Error(engine.PermissionError(atomOpen, atomStream, s, env))
+	})
+	i.Register2(atomLogStream, func(_ *engine.VM, s, _ engine.Term, _ engine.Cont, env *engine.Env) *engine.Promise {
+		return engine.Error(engine.PermissionError(atomOpen, atomStream, s, env))
+	})
+
+	i.Register0(atomHalt, func(_ *engine.VM, _ engine.Cont, _ *engine.Env) *engine.Promise {
+		_ = conn.Close()
+		return engine.Bool(false)
+	})
+	i.Register1(atomHalt, func(_ *engine.VM, _ engine.Term, _ engine.Cont, _ *engine.Env) *engine.Promise {
+		_ = conn.Close()
+		return engine.Bool(false)
+	})
+}
+
+var (
+	atomConsult           = engine.NewAtom("consult")
+	atomFlushOutput       = engine.NewAtom("flush_output")
+	atomLogStream         = engine.NewAtom("log_stream")
+	atomOpen              = engine.NewAtom("open")
+	atomOutput            = engine.NewAtom("output")
+	atomPutByte           = engine.NewAtom("put_byte")
+	atomPutChar           = engine.NewAtom("put_char")
+	atomReposition        = engine.NewAtom("reposition")
+	atomSetOutput         = engine.NewAtom("set_output")
+	atomSetStreamPosition = engine.NewAtom("set_stream_position")
+	atomSourceSink        = engine.NewAtom("source_sink")
+	atomStream            = engine.NewAtom("stream")
+	atomTeeStream         = engine.NewAtom("tee_stream")
+	atomUserOutput        = engine.NewAtom("user_output")
+	atomWriteTerm         = engine.NewAtom("write_term")
+)
+
+// connTerminal is a Terminal over a connection. It shows the prompt when it reads a line.
+// It's also the source of the keys after answers which reads a line without the prompt.
+type connTerminal struct {
+	r      *bufio.Reader
+	w      io.Writer
+	prompt string
+}
+
+func (c *connTerminal) Write(p []byte) (int, error) {
+	return c.w.Write(p)
+}
+
+func (c *connTerminal) ReadLine() (string, error) {
+	if _, err := io.WriteString(c.w, c.prompt); err != nil {
+		return "", err
+	}
+	return c.readLine()
+}
+
+// ReadRune reads a line and returns the first rune of it. It returns '.' for an empty line.
+func (c *connTerminal) ReadRune() (rune, int, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, r := range line {
+		return r, utf8.RuneLen(r), nil
+	}
+	return '.', 1, nil
+}
+
+func (c *connTerminal) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (c *connTerminal) SetPrompt(prompt string) {
+	c.prompt = prompt
+}
@@ -0,0 +1,129 @@
+package toplevel
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ichiban/prolog"
+)
+
+func TestServer_Serve(t *testing.T) {
+	serve := func(t *testing.T, s *Server) (string, func()) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- s.Serve(ctx, l)
+		}()
+		return l.Addr().String(), func() {
+			cancel()
+			assert.Equal(t, context.Canceled, <-done)
+		}
+	}
+
+	// session sends the lines and returns everything the server wrote until it closed the connection.
+	session := func(t *testing.T, addr string, lines ...string) string {
+		conn, err := net.Dial("tcp", addr)
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		for _, l := range lines {
+			_, err := fmt.Fprintln(conn, l)
+			assert.NoError(t, err)
+		}
+		_ = conn.(*net.TCPConn).CloseWrite()
+		b, err := io.ReadAll(bufio.NewReader(conn))
+		assert.NoError(t, err)
+		return string(b)
+	}
+
+	t.Run("fork", func(t *testing.T) {
+		p := prolog.New(nil, nil)
+		assert.NoError(t, p.Exec(`:- dynamic(count/1). count(1).`))
+		addr, stop := serve(t, &Server{Interpreter: p, Token: "secret"})
+		defer stop()
+
+		out := session(t, addr, "secret", "count(X).", "", "retract(count(1)), assertz(count(2)).", "", "count(X).", "")
+		assert.Equal(t, "Attached to the interpreter.\n?- X = 1.\n?- true.\n?- X = 2.\n?- ", out)
+		assert.NoError(t, p.QuerySolution(`count(1).`).Err())
+
+		out = session(t, addr, "secret", "halt.", "count(X).")
+		assert.Equal(t, "Attached to the interpreter.\n?- ", out)
+	})
+
+	t.Run("concurrent with the service", func(t *testing.T) {
+		p := prolog.New(nil, nil)
+		assert.NoError(t, p.Exec(`:- dynamic(count/1). count(0).`))
+		addr, stop := serve(t, &Server{Interpreter: p, Token: "secret"})
+		defer stop()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 100; i++ {
+				assert.NoError(t, p.QuerySolution(`retract(count(N)), M is N + 1, assertz(count(M)).`).Err())
+			}
+		}()
+		for i := 0; i < 10; i++ {
+			assert.Contains(t, session(t, addr, "secret", "count(_).", ""), "?- true.\n")
+		}
+		<-done
+	})
+
+	t.Run("side effects", func(t *testing.T) {
+		var service bytes.Buffer
+		p := prolog.New(nil, &service)
+		addr, stop := serve(t, &Server{Interpreter: p, Token: "secret"})
+		defer stop()
+
+		file := filepath.Join(t.TempDir(), "out.txt")
+		for _, tt := range []struct {
+			query, answer string
+		}{
+			{query: "write(foo), nl.", answer: "foo\ntrue.\n"},
+			{query: "write(user_output, foo), nl(user_output).", answer: "foo\ntrue.\n"},
+			{query: "print_message(error, foo).", answer: "ERROR: foo\ntrue.\n"},
+			{query: "get_char(C).", answer: "C = end_of_file.\n"},
+			{query: "write(user_error, foo).", answer: "error(permission_error(output,stream,user_error),write_term/3)\n?- "},
+			{query: "set_output(user_error).", answer: "error(permission_error(output,stream,user_error),set_output/1)\n?- "},
+			{query: fmt.Sprintf("open('%s', write, S).", file), answer: fmt.Sprintf("error(permission_error(open,source_sink,%s),open/4)\n?- ", file)},
+			{query: fmt.Sprintf("consult('%s').", file), answer: fmt.Sprintf("error(permission_error(open,source_sink,%s),consult/1)\n?- ", file)},
+			{query: "set_stream_position(user_output, 0).", answer: "error(permission_error(reposition,stream,user_output),set_stream_position/2)\n?- "},
+			{query: "tee_stream(user_output, user_output, S).", answer: "error(permission_error(open,stream,user_output),tee_stream/3)\n?- "},
+		} {
+			t.Run(tt.query, func(t *testing.T) {
+				assert.Equal(t, "Attached to the interpreter.\n?- "+tt.answer+"?- ", session(t, addr, "secret", tt.query, ""))
+			})
+		}
+		assert.Empty(t, service.String())
+		assert.NoFileExists(t, file)
+	})
+
+	t.Run("authentication failed", func(t *testing.T) {
+		p := prolog.New(nil, nil)
+		addr, stop := serve(t, &Server{Interpreter: p, Token: "secret"})
+		defer stop()
+
+		assert.Equal(t, "authentication failed\n", session(t, addr, "wrong", "true."))
+	})
+
+	t.Run("no token", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer func() {
+			_ = l.Close()
+		}()
+		s := Server{Interpreter: prolog.New(nil, nil)}
+		assert.Equal(t, ErrNoToken, s.Serve(context.Background(), l))
+	})
+}
@@ -0,0 +1,250 @@
+// Package toplevel provides an interactive top level for Prolog interpreters.
+package toplevel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/ichiban/prolog"
+	"github.com/ichiban/prolog/engine"
+)
+
+// Prompts shown by TopLevel.
+const (
+	Prompt     = "?- "
+	ContPrompt = "|- "
+)
+
+// ErrInterrupted indicates the query was aborted by Interrupt or by a Ctrl-C key.
+var ErrInterrupted = errors.New("interrupted")
+
+const keyCtrlC = 3
+
+// Terminal is a line-oriented user interface.
+// *terminal.Terminal from golang.org/x/crypto/ssh/terminal satisfies this interface.
+type Terminal interface {
+	io.Writer
+	ReadLine() (string, error)
+	SetPrompt(prompt string)
+}
+
+// TopLevel is an interactive loop which reads queries from Terminal and prints their answers.
+type TopLevel struct {
+	Interpreter *prolog.Interpreter
+	Terminal    Terminal
+
+	// Keys is where TopLevel reads a key after each answer: `;` for the next answer and anything else to stop.
+	// If nil, TopLevel reads a line from Terminal and uses the first rune of it instead.
+	Keys io.RuneReader
+
+	// History is a list of queries in the order of execution.
+	History []string
+
+	buf strings.Builder
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// New creates a TopLevel for the given interpreter and terminal.
+func New(i *prolog.Interpreter, t Terminal) *TopLevel {
+	t.SetPrompt(Prompt)
+	return &TopLevel{
+		Interpreter: i,
+		Terminal:    t,
+	}
+}
+
+// Run reads and executes queries until Terminal reaches the end of input or ctx is done.
+// It returns nil when Terminal reports io.EOF.
+func (t *TopLevel) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		switch err := t.Step(ctx); err {
+		case nil:
+			break
+		case io.EOF:
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+// Step reads a line from Terminal. Once the lines so far form a complete query, it executes the query.
+func (t *TopLevel) Step(ctx context.Context) error {
+	line, err := t.Terminal.ReadLine()
+	if err != nil {
+		return err
+	}
+	_, _ = t.buf.WriteString(line)
+	_, _ = t.buf.WriteString("\n")
+
+	q := t.buf.String()
+	p := engine.NewParser(&t.Interpreter.VM, strings.NewReader(q))
+	switch _, err := p.Term(); err {
+	case nil:
+		break
+	case io.EOF:
+		if strings.TrimSpace(q) != "" {
+			// The query continues to the next line.
+			t.Terminal.SetPrompt(ContPrompt)
+			return nil
+		}
+		t.reset()
+		return nil
+	default:
+		t.reset()
+		_, err := fmt.Fprintf(t.Terminal, "%v\n", err)
+		return err
+	}
+	t.reset()
+
+	t.History = append(t.History, strings.TrimSpace(q))
+
+	return t.query(ctx, q)
+}
+
+// Interrupt aborts the currently running query, if any.
+func (t *TopLevel) Interrupt() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cancel != nil {
+		t.cancel()
+	}
+}
+
+func (t *TopLevel) reset() {
+	t.buf.Reset()
+	t.Terminal.SetPrompt(Prompt)
+}
+
+// query runs q through the interpreter so that the settings of the interpreter e.g. AuditLog apply.
+func (t *TopLevel) query(ctx context.Context, q string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	t.mu.Lock()
+	t.cancel = cancel
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		t.cancel = nil
+		t.mu.Unlock()
+		cancel()
+	}()
+
+	sols, err := t.Interpreter.QueryContext(ctx, q)
+	if err != nil {
+		_, err := fmt.Fprintf(t.Terminal, "%v\n", err)
+		return err
+	}
+	defer func() {
+		_ = sols.Close()
+	}()
+
+	for sols.Next() {
+		if err := t.printAnswer(ctx, sols.Vars(), sols.Env()); err != nil {
+			return err
+		}
+
+		r, err := t.readKey()
+		if err != nil {
+			return err
+		}
+		switch r {
+		case ';':
+			if _, err := fmt.Fprintf(t.Terminal, ";\n"); err != nil {
+				return err
+			}
+		case keyCtrlC:
+			_, err := fmt.Fprintf(t.Terminal, "\n%v\n", ErrInterrupted)
+			return err
+		default:
+			_, err := fmt.Fprintf(t.Terminal, ".\n")
+			return err
+		}
+	}
+
+	switch err := sols.Err(); {
+	case errors.Is(err, context.Canceled):
+		_, err := fmt.Fprintf(t.Terminal, "%v\n", ErrInterrupted)
+		return err
+	case err != nil:
+		_, err := fmt.Fprintf(t.Terminal, "%v\n", err)
+		return err
+	default:
+		_, err := fmt.Fprintf(t.Terminal, "%t.\n", false)
+		return err
+	}
+}
+
+func (t *TopLevel) printAnswer(ctx context.Context, vars []engine.ParsedVariable, env *engine.Env) error {
+	vm := &t.Interpreter.VM
+
+	vns := make([]engine.Term, len(vars))
+	for i, v := range vars {
+		vns[i] = atomEqual.Apply(v.Name, v.Variable)
+	}
+	opts := engine.List(
+		atomQuoted.Apply(atomTrue),
+		atomNumberVars.Apply(atomTrue),
+		atomVariableNames.Apply(engine.List(vns...)),
+	)
+
+	var ls []string
+	for _, v := range vars {
+		n := v.Name.String()
+		if strings.HasPrefix(n, "_") {
+			continue
+		}
+		var sb strings.Builder
+		s := engine.NewOutputTextStream(&sb)
+		if _, err := engine.WriteTerm(vm, s, v.Variable, opts, engine.Success, env).Force(ctx); err != nil {
+			return err
+		}
+		if sb.String() == n { // Free variable.
+			continue
+		}
+		ls = append(ls, fmt.Sprintf("%s = %s", n, sb.String()))
+	}
+
+	if len(ls) == 0 {
+		_, err := fmt.Fprintf(t.Terminal, "%t", true)
+		return err
+	}
+	_, err := fmt.Fprint(t.Terminal, strings.Join(ls, ",\n"))
+	return err
+}
+
+func (t *TopLevel) readKey() (rune, error) {
+	if t.Keys != nil {
+		r, _, err := t.Keys.ReadRune()
+		return r, err
+	}
+
+	line, err := t.Terminal.ReadLine()
+	if err != nil {
+		return 0, err
+	}
+	for _, r := range line {
+		return r, nil
+	}
+	return '.', nil
+}
+
+var (
+	atomEqual         = engine.NewAtom("=")
+	atomHalt          = engine.NewAtom("halt")
+	atomQuoted        = engine.NewAtom("quoted")
+	atomNumberVars    = engine.NewAtom("numbervars")
+	atomVariableNames = engine.NewAtom("variable_names")
+	atomTrue          = engine.NewAtom("true")
+)
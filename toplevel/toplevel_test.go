@@ -0,0 +1,111 @@
+package toplevel
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ichiban/prolog"
+	"github.com/ichiban/prolog/engine"
+)
+
+type fakeTerminal struct {
+	lines   []string
+	prompts []string
+	out     bytes.Buffer
+}
+
+func (f *fakeTerminal) Write(p []byte) (int, error) {
+	return f.out.Write(p)
+}
+
+func (f *fakeTerminal) ReadLine() (string, error) {
+	if len(f.lines) == 0 {
+		return "", io.EOF
+	}
+	var l string
+	l, f.lines = f.lines[0], f.lines[1:]
+	return l, nil
+}
+
+func (f *fakeTerminal) SetPrompt(prompt string) {
+	f.prompts = append(f.prompts, prompt)
+}
+
+func TestTopLevel_Run(t *testing.T) {
+	tests := []struct {
+		title   string
+		lines   []string
+		keys    string
+		out     string
+		history []string
+	}{
+		{title: "true", lines: []string{`true.`}, keys: ".", out: "true.\n", history: []string{`true.`}},
+		{title: "false", lines: []string{`fail.`}, out: "false.\n", history: []string{`fail.`}},
+		{title: "bindings", lines: []string{`X = f(Y), Z = 1.`}, keys: ".", out: "X = f(Y),\nZ = 1.\n", history: []string{`X = f(Y), Z = 1.`}},
+		{title: "next answer", lines: []string{`member(X, [a, b]).`}, keys: ";;", out: "X = a;\nX = b;\nfalse.\n", history: []string{`member(X, [a, b]).`}},
+		{title: "stop", lines: []string{`member(X, [a, b]).`}, keys: ".", out: "X = a.\n", history: []string{`member(X, [a, b]).`}},
+		{title: "multiple lines", lines: []string{`X =`, `foo.`}, keys: ".", out: "X = foo.\n", history: []string{"X =\nfoo."}},
+		{title: "anonymous variables", lines: []string{`_X = 1, Y = 2.`}, keys: ".", out: "Y = 2.\n", history: []string{`_X = 1, Y = 2.`}},
+		{title: "quoted", lines: []string{`X = 'hello world'.`}, keys: ".", out: "X = 'hello world'.\n", history: []string{`X = 'hello world'.`}},
+		{title: "exception", lines: []string{`throw(foo).`}, out: "foo\n", history: []string{`throw(foo).`}},
+		{title: "syntax error", lines: []string{`foo(.`}, out: "unexpected token: end(.)\n"},
+		{title: "interrupted by key", lines: []string{`repeat.`}, keys: "\x03", out: "true\n" + ErrInterrupted.Error() + "\n", history: []string{`repeat.`}},
+		{title: "blank", lines: []string{``, `true.`}, keys: ".", out: "true.\n", history: []string{`true.`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			term := fakeTerminal{lines: tt.lines}
+			tl := New(prolog.New(nil, nil), &term)
+			tl.Keys = strings.NewReader(tt.keys)
+			assert.NoError(t, tl.Run(context.Background()))
+			assert.Equal(t, tt.out, term.out.String())
+			assert.Equal(t, tt.history, tl.History)
+		})
+	}
+
+	t.Run("keys from terminal", func(t *testing.T) {
+		term := fakeTerminal{lines: []string{`member(X, [a, b]).`, `;`, ``}}
+		tl := New(prolog.New(nil, nil), &term)
+		assert.NoError(t, tl.Run(context.Background()))
+		assert.Equal(t, "X = a;\nX = b.\n", term.out.String())
+	})
+
+	t.Run("prompts", func(t *testing.T) {
+		term := fakeTerminal{lines: []string{`X =`, `foo.`}}
+		tl := New(prolog.New(nil, nil), &term)
+		tl.Keys = strings.NewReader(".")
+		assert.NoError(t, tl.Run(context.Background()))
+		assert.Equal(t, []string{Prompt, ContPrompt, Prompt}, term.prompts)
+	})
+
+	t.Run("audit log", func(t *testing.T) {
+		var log bytes.Buffer
+		i := prolog.New(nil, nil)
+		i.AuditLog = &log
+		term := fakeTerminal{lines: []string{`X = a.`}}
+		tl := New(i, &term)
+		tl.Keys = strings.NewReader(".")
+		assert.NoError(t, tl.Run(context.Background()))
+		assert.Equal(t, "X = a.\n", term.out.String())
+		assert.Contains(t, log.String(), `X = a.`)
+	})
+}
+
+func TestTopLevel_Interrupt(t *testing.T) {
+	term := fakeTerminal{lines: []string{`interrupt, repeat, fail.`}}
+	tl := New(prolog.New(nil, nil), &term)
+	assert.NotPanics(t, tl.Interrupt) // No running query.
+
+	tl.Interpreter.Register0(engine.NewAtom("interrupt"), func(_ *engine.VM, k engine.Cont, env *engine.Env) *engine.Promise {
+		tl.Interrupt()
+		return k(env)
+	})
+	assert.NoError(t, tl.Run(context.Background()))
+	assert.Equal(t, ErrInterrupted.Error()+"\n", term.out.String())
+}